@@ -96,10 +96,18 @@ func (a *Api) forceDocumentProcessing(c echo.Context) error {
 		step = models.ProcessParseContent
 	case "detect-language":
 		step = models.ProcessDetectLanguage
+	case "extract-fields":
+		step = models.ProcessExtractFields
 	case "rules":
 		step = models.ProcessRules
 	case "fts":
 		step = models.ProcessFts
+	case "similarity":
+		step = models.ProcessSimilarity
+	case "duplicates":
+		step = models.ProcessDuplicates
+	case "suggest-metadata":
+		step = models.ProcessSuggestMetadata
 	default:
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid step")
 	}
@@ -326,3 +334,54 @@ func (a *Api) adminRestoreDeletedDocument(c echo.Context) error {
 	opOk = true
 	return c.JSON(200, nil)
 }
+
+// SearchIndexVerifyRequest starts search index verification.
+// swagger:model SearchIndexVerifyRequest
+type SearchIndexVerifyRequest struct {
+	// verify only user's documents. 0 verifies all documents.
+	UserId int `json:"user_id" valid:"-"`
+	// only report differences, do not modify the index
+	DryRun bool `json:"dry_run" valid:"-"`
+}
+
+func (a *Api) verifySearchIndex(c echo.Context) error {
+	// swagger:route POST /api/v1/admin/search/verify Admin AdminVerifySearchIndex
+	// Verify search index
+	//
+	// Compare search index against database in background. Unless dry_run is set, missing and stale documents
+	// are re-indexed and documents that no longer exist are removed from the index.
+	// Use GET /api/v1/admin/search/verify to follow the progress.
+	// Consumes:
+	// - application/json
+	//
+	// responses:
+	//   200: RespOk
+	//   400: RespBadRequest
+	//   401: RespForbidden
+
+	ctx := c.(UserContext)
+	body := &SearchIndexVerifyRequest{}
+	err := unMarshalBody(c.Request(), body)
+	if err != nil {
+		return err
+	}
+	opOk := false
+	defer logCrudAdminSearch(ctx.UserId, "verify search index", &opOk, "user: %d, dry run: %t", body.UserId, body.DryRun)
+	err = a.adminService.StartSearchIndexVerification(getContext(c), body.UserId, body.DryRun)
+	if err != nil {
+		return err
+	}
+	opOk = true
+	return c.JSON(http.StatusOK, a.adminService.GetSearchIndexStatus(getContext(c)))
+}
+
+func (a *Api) getSearchIndexStatus(c echo.Context) error {
+	// swagger:route GET /api/v1/admin/search/verify Admin AdminGetSearchIndexStatus
+	// Get status of the latest search index verification
+	//
+	// responses:
+	//   200: RespOk
+	//   401: RespForbidden
+
+	return c.JSON(http.StatusOK, a.adminService.GetSearchIndexStatus(getContext(c)))
+}
@@ -19,6 +19,7 @@
 package api
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/labstack/echo/v4"
 	"io"
@@ -66,6 +67,8 @@ type DocumentUpdateRequest struct {
 	Date        int64             `json:"date" valid:"optional,range(0|4106139691000)"` // year 2200 in ms
 	Metadata    []MetadataRequest `json:"metadata" valid:"-"`
 	Lang        string            `json:"lang" valid:"language, optional"`
+	// DocumentTypeId sets the document type, 0 removes the type.
+	DocumentTypeId int `json:"document_type_id" valid:"optional"`
 }
 
 func (a *Api) getDocuments(c echo.Context) error {
@@ -174,6 +177,22 @@ func (a *Api) getDocumentLogs(c echo.Context) error {
 	return resourceList(c, job, len(*job))
 }
 
+func (a *Api) getDocumentRulesTrace(c echo.Context) error {
+	// swagger:route GET /api/v1/documents/{id}/rules-trace Documents GetDocumentRulesTrace
+	// Get the evaluated rules, matched conditions and executed actions of the latest rule run for the document.
+	// responses:
+	//   200: RespOk
+	//   401: RespForbidden
+	//   403: RespNotFound
+	//   500: RespInternalError
+	id := c.Param("id")
+	traces, err := a.documentService.GetRuleTraces(getContext(c), id)
+	if err != nil {
+		return err
+	}
+	return resourceList(c, traces, len(traces))
+}
+
 func (a *Api) getDocumentPreview(c echo.Context) error {
 	// swagger:route GET /api/v1/documents/{id}/preview Documents GetDocumentPreview
 	// Get document preview, a small png image of first page of document.
@@ -347,6 +366,7 @@ func (a *Api) updateDocument(c echo.Context) error {
 		metadata[i] = aggregates.Metadata{
 			KeyId:   v.KeyId,
 			ValueId: v.ValueId,
+			Value:   v.Value,
 		}
 	}
 
@@ -357,6 +377,8 @@ func (a *Api) updateDocument(c echo.Context) error {
 		Date:        time.Time{},
 		Metadata:    metadata,
 		Lang:        dto.Lang,
+
+		DocumentTypeId: dto.DocumentTypeId,
 	}
 
 	if dto.Date != 0 {
@@ -394,6 +416,44 @@ func (a *Api) updateDocumentSharing(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
 }
 
+func (a *Api) updateDocumentInvoicePaid(c echo.Context) error {
+	// swagger:route PUT /api/v1/documents/{id}/invoice/paid Documents UpdateInvoicePaid
+	// Mark invoice as paid or not paid
+	// Responses:
+	//  200: Document
+
+	ctx := c.(UserContext)
+	id := c.Param("id")
+	dto := &aggregates.DocumentInvoicePaidRequest{}
+	err := unMarshalBody(c.Request(), dto)
+	if err != nil {
+		return err
+	}
+	if dto.PaidDate < 0 {
+		e := errors.ErrInvalid
+		e.ErrMsg = "invalid paid_date"
+		return e
+	}
+	paidDate := time.Now()
+	if dto.PaidDate != 0 {
+		paidDate = time.UnixMilli(dto.PaidDate)
+	}
+
+	opOk := false
+	defer logCrudDocument(ctx.UserId, "update-invoice-paid", &opOk, "document: %s, paid: %v", id, dto.Paid)
+	err = a.documentService.SetInvoicePaid(getContext(c), ctx.UserId, id, dto.Paid, paidDate)
+	if err != nil {
+		return err
+	}
+	doc, err := a.documentService.GetDocument(getContext(c), ctx.UserId, id, false)
+	if err != nil {
+		return err
+	}
+	opOk = true
+	documentAggregateToResponse(doc)
+	return c.JSON(http.StatusOK, doc)
+}
+
 func (a *Api) searchDocuments(userId int, filter *search.DocumentFilter, c echo.Context) error {
 	paging := getPagination(c)
 	sort := getSort(c)
@@ -570,6 +630,111 @@ func (a *Api) getDocumentHistory(c echo.Context) error {
 	return resourceList(c, data, len(*data))
 }
 
+func (a *Api) getSimilarDocuments(c echo.Context) error {
+	// swagger:route GET /api/v1/documents/:id/similar Documents GetSimilarDocuments
+	// Get user's other documents ranked by similarity to the document
+	// Responses:
+	//   200: RespOk
+	//   401: RespForbidden
+	//   403: RespNotFound
+	//   500: RespInternalError
+
+	ctx := c.(UserContext)
+	id := c.Param("id")
+	paging := getPagination(c)
+	opOk := false
+	defer logCrudDocument(ctx.UserId, "get similar documents", &opOk, "document: %s", id)
+	docs, total, err := a.documentService.GetSimilarDocuments(getContext(c), ctx.UserId, id, paging.toPagination())
+	if err != nil {
+		return err
+	}
+	opOk = true
+	return resourceList(c, docs, total)
+}
+
+func (a *Api) getDuplicateDocuments(c echo.Context) error {
+	// swagger:route GET /api/v1/documents/duplicates Documents GetDuplicateDocuments
+	// Get clusters of user's documents that are likely duplicates of each other
+	// Responses:
+	//   200: RespOk
+	//   401: RespForbidden
+	//   500: RespInternalError
+
+	ctx := c.(UserContext)
+	opOk := false
+	defer logCrudDocument(ctx.UserId, "get duplicate documents", &opOk, "")
+	clusters, err := a.documentService.GetDuplicateClusters(getContext(c), ctx.UserId)
+	if err != nil {
+		return err
+	}
+	opOk = true
+	return resourceList(c, clusters, len(clusters))
+}
+
+type mergeDuplicatesRequest struct {
+	// document to keep
+	TargetId string `json:"target_id" valid:"uuid~Invalid target id"`
+	// duplicates to merge into target document
+	DocumentIds []string `json:"document_ids" valid:"required,uuidarray~Invalid ids"`
+}
+
+func (a *Api) mergeDuplicateDocuments(c echo.Context) error {
+	// swagger:route POST /api/v1/documents/duplicates/merge Documents MergeDuplicateDocuments
+	// Merge duplicate documents into target document. Duplicates are moved to trash bin.
+	// Responses:
+	//   200: RespOk
+	//   400: RespBadRequest
+	//   401: RespForbidden
+	//   404: RespNotFound
+	//   500: RespInternalError
+
+	ctx := c.(UserContext)
+	dto := &mergeDuplicatesRequest{}
+	err := unMarshalBody(c.Request(), dto)
+	if err != nil {
+		return err
+	}
+	opOk := false
+	defer logCrudDocument(ctx.UserId, "merge duplicates", &opOk, "document: %s, duplicates: %v", dto.TargetId, dto.DocumentIds)
+	err = a.documentService.MergeDuplicates(getContext(c), ctx.UserId, dto.TargetId, dto.DocumentIds)
+	if err != nil {
+		return err
+	}
+	opOk = true
+	return c.JSON(http.StatusOK, map[string]string{"id": dto.TargetId})
+}
+
+type dismissDuplicatesRequest struct {
+	// documents that are not duplicates of each other
+	DocumentIds []string `json:"document_ids" valid:"required,uuidarray~Invalid ids"`
+}
+
+func (a *Api) dismissDuplicateDocuments(c echo.Context) error {
+	// swagger:route POST /api/v1/documents/duplicates/dismiss Documents DismissDuplicateDocuments
+	// Mark documents as not being duplicates of each other
+	// Responses:
+	//   200: RespOk
+	//   400: RespBadRequest
+	//   401: RespForbidden
+	//   404: RespNotFound
+	//   500: RespInternalError
+
+	ctx := c.(UserContext)
+	dto := &dismissDuplicatesRequest{}
+	err := unMarshalBody(c.Request(), dto)
+	if err != nil {
+		return err
+	}
+	opOk := false
+	defer logCrudDocument(ctx.UserId, "dismiss duplicates", &opOk, "documents: %v", dto.DocumentIds)
+	err = a.documentService.DismissDuplicates(getContext(c), ctx.UserId, dto.DocumentIds)
+	if err != nil {
+		return err
+	}
+	opOk = true
+	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+}
+
 func (a *Api) restoreDeletedDocument(c echo.Context) error {
 	// swagger:route PUT /api/v1/documents/deleted/:id/restore User UserRestoreDeletedDocument
 	// Restore deleted document
@@ -612,3 +777,67 @@ func (a *Api) flushDeletedDocument(c echo.Context) error {
 	opOk = err == nil
 	return err
 }
+
+const maxDocumentCsvImportSize = 10 * 1024 * 1024
+
+func (a *Api) exportDocumentsCsv(c echo.Context) error {
+	// swagger:route GET /api/v1/documents/csv Documents ExportDocumentsCsv
+	// Export documents as csv
+	//
+	// Columns are id, name, date, filename and one column per metadata key.
+	// Multiple values of a key are separated with ';'. Separators and backslashes in values are escaped with '\'.
+	// responses:
+	//   200: RespOk
+
+	ctx := c.(UserContext)
+	buf := &bytes.Buffer{}
+	_, err := a.documentService.ExportDocumentsCsv(getContext(c), ctx.UserId, buf)
+	if err != nil {
+		return err
+	}
+	c.Response().Header().Set("Content-Disposition", "attachment; filename=documents.csv")
+	return c.Blob(http.StatusOK, "text/csv", buf.Bytes())
+}
+
+func (a *Api) importDocumentsCsv(c echo.Context) error {
+	// swagger:route POST /api/v1/documents/csv Documents ImportDocumentsCsv
+	// Import documents csv
+	//
+	// Body is csv in the format of the export. Only column 'id' is required.
+	// All lines are validated first and nothing is saved if any line has errors.
+	// Query parameter dry_run=1 only validates the file and reports the changes.
+	// Query parameter create_values=1 creates metadata values that do not exist.
+	// Body must be at most 10 MiB.
+	// responses:
+	//   200: RespOk
+	//   400: RespBadRequest
+	//   413: RespBadRequest
+
+	ctx := c.(UserContext)
+	dryRun, err := bindQueryFlag(c, "dry_run")
+	if err != nil {
+		return err
+	}
+	createValues, err := bindQueryFlag(c, "create_values")
+	if err != nil {
+		return err
+	}
+	opts := services.DocumentCsvImportOptions{DryRun: dryRun, CreateValues: createValues}
+
+	opOk := false
+	defer logCrudDocument(ctx.UserId, "import csv", &opOk, "dry run: %v, create values: %v", opts.DryRun, opts.CreateValues)
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxDocumentCsvImportSize+1))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "read body")
+	}
+	if len(body) > maxDocumentCsvImportSize {
+		return echo.NewHTTPError(http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("csv file must be at most %d MiB", maxDocumentCsvImportSize/1024/1024))
+	}
+	status, err := a.documentService.ImportDocumentsCsv(getContext(c), ctx.UserId, bytes.NewReader(body), opts)
+	if err != nil {
+		return err
+	}
+	opOk = true
+	return c.JSON(http.StatusOK, status)
+}
@@ -0,0 +1,148 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"tryffel.net/go/virtualpaper/errors"
+	"tryffel.net/go/virtualpaper/models"
+)
+
+// DocumentNoteRequest
+// swagger:model DocumentNoteRequestBody
+type DocumentNoteRequest struct {
+	Content string `json:"content" valid:"required"`
+	// Page starts from 1. 0 means the note is for the whole document.
+	Page int `json:"page"`
+	// PositionX and PositionY are relative to page size, between 0 and 1. Both are optional.
+	PositionX *float64 `json:"position_x" valid:"-"`
+	PositionY *float64 `json:"position_y" valid:"-"`
+}
+
+func (r *DocumentNoteRequest) toDocumentNote(docId string) (*models.DocumentNote, error) {
+	if r.Page < 0 {
+		e := errors.ErrInvalid
+		e.ErrMsg = "page must be >= 0"
+		return nil, e
+	}
+	return &models.DocumentNote{
+		DocumentId: docId,
+		Content:    r.Content,
+		Page:       models.IntId(r.Page),
+		PositionX:  r.PositionX,
+		PositionY:  r.PositionY,
+	}, nil
+}
+
+func (a *Api) getDocumentNotes(c echo.Context) error {
+	// swagger:route GET /api/v1/documents/{id}/notes Documents GetDocumentNotes
+	// Get document notes
+	// Responses:
+	//  200: DocumentNotesResponse
+	ctx := c.(UserContext)
+	docId := bindPathId(c)
+	notes, err := a.documentService.GetDocumentNotes(getContext(c), ctx.UserId, docId)
+	if err != nil {
+		return err
+	}
+	return resourceList(c, notes, len(notes))
+}
+
+func (a *Api) addDocumentNote(c echo.Context) error {
+	// swagger:route POST /api/v1/documents/{id}/notes Documents AddDocumentNote
+	// Add note to document. Requires write permission to the document.
+	// Responses:
+	//  200: DocumentNoteResponse
+	ctx := c.(UserContext)
+	docId := bindPathId(c)
+	dto := &DocumentNoteRequest{}
+	err := unMarshalBody(c.Request(), dto)
+	if err != nil {
+		return err
+	}
+	note, err := dto.toDocumentNote(docId)
+	if err != nil {
+		return err
+	}
+
+	opOk := false
+	defer logCrudDocument(ctx.UserId, "add note", &opOk, "document: %s", docId)
+	err = a.documentService.AddDocumentNote(getContext(c), ctx.UserId, note)
+	if err != nil {
+		return err
+	}
+	opOk = true
+	return resourceList(c, note, 1)
+}
+
+func (a *Api) updateDocumentNote(c echo.Context) error {
+	// swagger:route PUT /api/v1/documents/{id}/notes/{noteId} Documents UpdateDocumentNote
+	// Update document note. Only the author can edit the note.
+	// Responses:
+	//  200: DocumentNoteResponse
+	ctx := c.(UserContext)
+	docId := bindPathId(c)
+	noteId, err := bindPathInt(c, "noteId")
+	if err != nil {
+		return err
+	}
+	dto := &DocumentNoteRequest{}
+	err = unMarshalBody(c.Request(), dto)
+	if err != nil {
+		return err
+	}
+	note, err := dto.toDocumentNote(docId)
+	if err != nil {
+		return err
+	}
+	note.Id = noteId
+
+	opOk := false
+	defer logCrudDocument(ctx.UserId, "update note", &opOk, "document: %s, note: %d", docId, noteId)
+	err = a.documentService.UpdateDocumentNote(getContext(c), ctx.UserId, note)
+	if err != nil {
+		return err
+	}
+	opOk = true
+	return resourceList(c, note, 1)
+}
+
+func (a *Api) deleteDocumentNote(c echo.Context) error {
+	// swagger:route DELETE /api/v1/documents/{id}/notes/{noteId} Documents DeleteDocumentNote
+	// Delete document note. The author and the document owner can delete the note.
+	// Responses:
+	//  200:
+	ctx := c.(UserContext)
+	docId := bindPathId(c)
+	noteId, err := bindPathInt(c, "noteId")
+	if err != nil {
+		return err
+	}
+
+	opOk := false
+	defer logCrudDocument(ctx.UserId, "delete note", &opOk, "document: %s, note: %d", docId, noteId)
+	err = a.documentService.DeleteDocumentNote(getContext(c), ctx.UserId, docId, noteId)
+	if err != nil {
+		return err
+	}
+	opOk = true
+	return c.String(http.StatusOK, "ok")
+}
@@ -0,0 +1,196 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"tryffel.net/go/virtualpaper/models"
+	"tryffel.net/go/virtualpaper/models/aggregates"
+)
+
+// DocumentTypeRequest
+// swagger:model DocumentTypeRequestBody
+type DocumentTypeRequest struct {
+	Name        string                   `json:"name" valid:"required,stringlength(1|100)"`
+	Description string                   `json:"description" valid:"maxstringlength(1000),optional"`
+	Keys        []DocumentTypeKeyRequest `json:"keys" valid:"-"`
+}
+
+type DocumentTypeKeyRequest struct {
+	KeyId    int  `json:"key_id"`
+	Required bool `json:"required"`
+	// DefaultValueId is added to documents that do not have the key when the type is set.
+	DefaultValueId int `json:"default_value_id"`
+}
+
+func (r *DocumentTypeRequest) toDocumentType(userId int) *models.DocumentType {
+	docType := &models.DocumentType{
+		UserId:      userId,
+		Name:        r.Name,
+		Description: r.Description,
+		Keys:        make([]models.DocumentTypeKey, len(r.Keys)),
+	}
+	for i, v := range r.Keys {
+		docType.Keys[i] = models.DocumentTypeKey{
+			KeyId:          v.KeyId,
+			Required:       v.Required,
+			DefaultValueId: models.IntId(v.DefaultValueId),
+		}
+	}
+	return docType
+}
+
+func (a *Api) getDocumentTypes(c echo.Context) error {
+	// swagger:route GET /api/v1/document-types DocumentTypes GetDocumentTypes
+	// Get document types
+	// Responses:
+	//  200: DocumentTypeResponse
+	ctx := c.(UserContext)
+	paging := getPagination(c)
+	sort := getSort(c)
+
+	types, count, err := a.metadataService.GetDocumentTypes(getContext(c), ctx.UserId, sort.ToKey(), paging.toPagination())
+	if err != nil {
+		return err
+	}
+	return resourceList(c, types, count)
+}
+
+func (a *Api) getDocumentType(c echo.Context) error {
+	// swagger:route GET /api/v1/document-types/{id} DocumentTypes GetDocumentType
+	// Get document type
+	// Responses:
+	//  200: DocumentTypeResponse
+	ctx := c.(UserContext)
+	id, err := bindPathIdInt(c)
+	if err != nil {
+		return err
+	}
+
+	docType, err := a.metadataService.GetDocumentType(getContext(c), ctx.UserId, id)
+	if err != nil {
+		return err
+	}
+	return resourceList(c, docType, 1)
+}
+
+func (a *Api) addDocumentType(c echo.Context) error {
+	// swagger:route POST /api/v1/document-types DocumentTypes AddDocumentType
+	// Add document type
+	// Responses:
+	//  200: DocumentTypeResponse
+	ctx := c.(UserContext)
+	dto := &DocumentTypeRequest{}
+	err := unMarshalBody(c.Request(), dto)
+	if err != nil {
+		return err
+	}
+
+	opOk := false
+	defer logCrudMetadata(ctx.UserId, "create document type", &opOk, "name: %s", dto.Name)
+
+	docType := dto.toDocumentType(ctx.UserId)
+	err = a.metadataService.CreateDocumentType(getContext(c), docType)
+	if err != nil {
+		return err
+	}
+	created, err := a.metadataService.GetDocumentType(getContext(c), ctx.UserId, docType.Id)
+	if err != nil {
+		return err
+	}
+	opOk = true
+	return resourceList(c, created, 1)
+}
+
+func (a *Api) updateDocumentType(c echo.Context) error {
+	// swagger:route PUT /api/v1/document-types/{id} DocumentTypes UpdateDocumentType
+	// Update document type. Keys are replaced with the given keys.
+	// Responses:
+	//  200: DocumentTypeResponse
+	ctx := c.(UserContext)
+	id, err := bindPathIdInt(c)
+	if err != nil {
+		return err
+	}
+	dto := &DocumentTypeRequest{}
+	err = unMarshalBody(c.Request(), dto)
+	if err != nil {
+		return err
+	}
+
+	opOk := false
+	defer logCrudMetadata(ctx.UserId, "update document type", &opOk, "document type: %d", id)
+
+	docType := dto.toDocumentType(ctx.UserId)
+	docType.Id = id
+	err = a.metadataService.UpdateDocumentType(getContext(c), docType)
+	if err != nil {
+		return err
+	}
+	updated, err := a.metadataService.GetDocumentType(getContext(c), ctx.UserId, id)
+	if err != nil {
+		return err
+	}
+	opOk = true
+	return resourceList(c, updated, 1)
+}
+
+func (a *Api) deleteDocumentType(c echo.Context) error {
+	// swagger:route DELETE /api/v1/document-types/{id} DocumentTypes DeleteDocumentType
+	// Delete document type. Documents of the type are left without a type.
+	// Responses:
+	//  200:
+	ctx := c.(UserContext)
+	id, err := bindPathIdInt(c)
+	if err != nil {
+		return err
+	}
+
+	opOk := false
+	defer logCrudMetadata(ctx.UserId, "delete document type", &opOk, "document type: %d", id)
+	err = a.metadataService.DeleteDocumentType(getContext(c), ctx.UserId, id)
+	if err != nil {
+		return err
+	}
+	opOk = true
+	return c.String(http.StatusOK, "ok")
+}
+
+func (a *Api) getIncompleteDocuments(c echo.Context) error {
+	// swagger:route GET /api/v1/documents/incomplete Documents GetIncompleteDocuments
+	// Get documents that do not have a document type or are missing required metadata of their type.
+	//
+	// responses:
+	//   200: Document
+	ctx := c.(UserContext)
+
+	paging := getPagination(c)
+	sort := getSort(c)
+	docs, count, err := a.documentService.GetIncompleteDocuments(getContext(c), ctx.UserId, paging.toPagination(), sort.ToKey())
+	if err != nil {
+		return err
+	}
+	respDocs := make([]*aggregates.Document, len(*docs))
+	for i, v := range *docs {
+		respDocs[i] = responseFromDocument(&v)
+	}
+	return resourceList(c, respDocs, count)
+}
@@ -53,6 +53,10 @@ func logCrudAdminUsers(userId int, action string, success *bool, fmt string, arg
 	logCrudOp("admin-users", action, userId, success).Infof(fmt, args...)
 }
 
+func logCrudAdminSearch(userId int, action string, success *bool, fmt string, args ...interface{}) {
+	logCrudOp("admin-search", action, userId, success).Infof(fmt, args...)
+}
+
 func loggingMiddlware() echo.MiddlewareFunc {
 	var logger *logrus.Logger
 
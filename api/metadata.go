@@ -30,7 +30,10 @@ import (
 
 type MetadataRequest struct {
 	KeyId   int `valid:"required" json:"key_id"`
-	ValueId int `valid:"required" json:"value_id"`
+	ValueId int `valid:"optional" json:"value_id"`
+	// Value is a free-form value for typed keys, used when value_id is not set.
+	// It is validated by the type of the key.
+	Value string `valid:"optional" json:"value"`
 }
 
 type MetadataKeyRequest struct {
@@ -38,6 +41,11 @@ type MetadataKeyRequest struct {
 	Comment string `json:"comment" valid:"maxstringlength(1000),optional"`
 	Icon    string `json:"icon" valid:"optional"`
 	Style   string `json:"style" valid:"json,optional"`
+	// Type of the key: text (default), free_text, number, money, date or boolean.
+	Type string `json:"type" valid:"in(text|free_text|number|money|date|boolean),optional"`
+	// AutoApplyThreshold is the confidence (0-1) above which suggested values are added to documents.
+	// 0 disables adding suggestions automatically.
+	AutoApplyThreshold float64 `json:"auto_apply_threshold" valid:"optional"`
 }
 
 type MetadataValueRequest struct {
@@ -50,6 +58,18 @@ type MetadataValueRequest struct {
 	// validate MatchType when creating, allowing default to be empty string
 	MatchType   string `json:"match_type" valid:"in(regex|exact),optional"`
 	MatchFilter string `json:"match_filter" valid:"maxstringlength(100),optional"`
+	// ParentId is the parent value, if value belongs to a hierarchy.
+	ParentId int `json:"parent_id" valid:"optional"`
+}
+
+type MetadataValueMergeRequest struct {
+	// TargetValueId is the value to merge into. It must belong to the same key.
+	TargetValueId int `json:"target_value_id" valid:"required"`
+}
+
+type MetadataKeyMergeRequest struct {
+	// TargetKeyId is the key to merge or move into.
+	TargetKeyId int `json:"target_key_id" valid:"required"`
 }
 
 type MetadataUpdateRequest struct {
@@ -63,6 +83,7 @@ func (m *MetadataUpdateRequest) ToAggregate() []aggregates.Metadata {
 		metadata[i] = aggregates.Metadata{
 			KeyId:   v.KeyId,
 			ValueId: v.ValueId,
+			Value:   v.Value,
 		}
 	}
 	return metadata
@@ -152,7 +173,7 @@ func (a *Api) getMetadataKey(c echo.Context) error {
 
 func (a *Api) getMetadataKeyValues(c echo.Context) error {
 	// swagger:route GET /api/v1/metadata/keys/{id}/values Metadata GetMetadataKeyValues
-	// Get metadata key values
+	// Get metadata key values. With query parameter tree=1, all values are returned as a tree of parent values.
 	// Responses:
 	//  200: MetadataKeyValueResponse
 	key, err := bindPathIdInt(c)
@@ -160,8 +181,22 @@ func (a *Api) getMetadataKeyValues(c echo.Context) error {
 		return err
 	}
 
+	tree := c.QueryParam("tree")
+	if tree != "1" && tree != "0" && tree != "" {
+		err := errors.ErrInvalid
+		err.ErrMsg = "query parameter 'tree' must be either 1 or 0"
+		return err
+	}
+
 	paging := getPagination(c)
 	sort := getSort(c)
+	if tree == "1" {
+		values, total, err := a.metadataService.GetKeyValueTree(getContext(c), key, sort.ToKey())
+		if err != nil {
+			return err
+		}
+		return resourceList(c, values, total)
+	}
 	keys, err := a.metadataService.GetKeyValues(getContext(c), key, sort.ToKey(), paging.toPagination())
 	if err != nil {
 		return err
@@ -187,12 +222,14 @@ func (a *Api) addMetadataKey(c echo.Context) error {
 	}
 
 	key := &models.MetadataKey{
-		UserId:    ctx.UserId,
-		Key:       dto.Key,
-		CreatedAt: time.Now(),
-		Comment:   dto.Comment,
-		Icon:      dto.Icon,
-		Style:     dto.Style,
+		UserId:             ctx.UserId,
+		Key:                dto.Key,
+		CreatedAt:          time.Now(),
+		Comment:            dto.Comment,
+		Icon:               dto.Icon,
+		Style:              dto.Style,
+		Type:               models.MetadataKeyType(dto.Type),
+		AutoApplyThreshold: dto.AutoApplyThreshold,
 	}
 
 	if key.Style == "" {
@@ -238,6 +275,7 @@ func (a *Api) addMetadataValue(c echo.Context) error {
 		MatchDocuments: dto.MatchDocuments,
 		MatchType:      models.MetadataRuleType(dto.MatchType),
 		MatchFilter:    dto.MatchFilter,
+		ParentId:       models.IntId(dto.ParentId),
 	}
 
 	if value.MatchType == "" {
@@ -292,6 +330,7 @@ func (a *Api) updateMetadataValue(c echo.Context) error {
 		MatchDocuments: dto.MatchDocuments,
 		MatchType:      models.MetadataRuleType(dto.MatchType),
 		MatchFilter:    dto.MatchFilter,
+		ParentId:       models.IntId(dto.ParentId),
 	}
 	// rest should be enclodes in a transaction
 	err = a.metadataService.UpdateValue(getContext(c), value)
@@ -328,12 +367,14 @@ func (a *Api) updateMetadataKey(c echo.Context) error {
 	opOk := false
 	defer logCrudMetadata(ctx.UserId, "update key", &opOk, "key: %d", keyId)
 	key := &models.MetadataKey{
-		Id:      keyId,
-		UserId:  ctx.UserId,
-		Key:     dto.Key,
-		Comment: dto.Comment,
-		Icon:    dto.Icon,
-		Style:   dto.Style,
+		Id:                 keyId,
+		UserId:             ctx.UserId,
+		Key:                dto.Key,
+		Comment:            dto.Comment,
+		Icon:               dto.Icon,
+		Style:              dto.Style,
+		Type:               models.MetadataKeyType(dto.Type),
+		AutoApplyThreshold: dto.AutoApplyThreshold,
 	}
 
 	if key.Style == "" {
@@ -446,3 +487,186 @@ func (a *Api) updateLinkedDocuments(c echo.Context) error {
 	data := map[string]string{"id": "1"}
 	return c.JSON(http.StatusOK, data)
 }
+
+func (a *Api) mergeMetadataValue(c echo.Context) error {
+	// swagger:route POST /api/v1/metadata/keys/{key_id}/values/{id}/merge Metadata MergeMetadataValue
+	// Merge metadata value into another value of the same key.
+	// Documents and rules that use the value are changed to use the target value and the value is deleted.
+	// Responses:
+	//  200: MetadataKeyValueResponse
+
+	ctx := c.(UserContext)
+	keyId, err := bindPathInt(c, "keyId")
+	if err != nil {
+		return err
+	}
+
+	valueId, err := bindPathInt(c, "valueId")
+	if err != nil {
+		return err
+	}
+
+	dto := &MetadataValueMergeRequest{}
+	err = unMarshalBody(c.Request(), dto)
+	if err != nil {
+		return err
+	}
+
+	opOk := false
+	defer logCrudMetadata(ctx.UserId, "merge value", &opOk, "key: %d, value: %d, target value: %d", keyId, valueId, dto.TargetValueId)
+
+	value, err := a.metadataService.MergeValues(getContext(c), ctx.UserId, keyId, valueId, dto.TargetValueId)
+	if err != nil {
+		return err
+	}
+	opOk = true
+	return resourceList(c, value, 1)
+}
+
+func (a *Api) moveMetadataValue(c echo.Context) error {
+	// swagger:route POST /api/v1/metadata/keys/{key_id}/values/{id}/move Metadata MoveMetadataValue
+	// Move metadata value to another key. If the key already has a value with the same name, the values are merged.
+	// Responses:
+	//  200: MetadataKeyValueResponse
+
+	ctx := c.(UserContext)
+	keyId, err := bindPathInt(c, "keyId")
+	if err != nil {
+		return err
+	}
+
+	valueId, err := bindPathInt(c, "valueId")
+	if err != nil {
+		return err
+	}
+
+	dto := &MetadataKeyMergeRequest{}
+	err = unMarshalBody(c.Request(), dto)
+	if err != nil {
+		return err
+	}
+
+	opOk := false
+	defer logCrudMetadata(ctx.UserId, "move value", &opOk, "key: %d, value: %d, target key: %d", keyId, valueId, dto.TargetKeyId)
+
+	value, err := a.metadataService.MoveValue(getContext(c), ctx.UserId, keyId, valueId, dto.TargetKeyId)
+	if err != nil {
+		return err
+	}
+	opOk = true
+	return resourceList(c, value, 1)
+}
+
+func (a *Api) mergeMetadataKey(c echo.Context) error {
+	// swagger:route POST /api/v1/metadata/keys/{id}/merge Metadata MergeMetadataKey
+	// Merge metadata key into another key. All values are moved to the target key and the key is deleted.
+	// Responses:
+	//  200: MetadataKeyResponse
+
+	ctx := c.(UserContext)
+	keyId, err := bindPathIdInt(c)
+	if err != nil {
+		return err
+	}
+
+	dto := &MetadataKeyMergeRequest{}
+	err = unMarshalBody(c.Request(), dto)
+	if err != nil {
+		return err
+	}
+
+	opOk := false
+	defer logCrudMetadata(ctx.UserId, "merge key", &opOk, "key: %d, target key: %d", keyId, dto.TargetKeyId)
+
+	key, err := a.metadataService.MergeKeys(getContext(c), ctx.UserId, keyId, dto.TargetKeyId)
+	if err != nil {
+		return err
+	}
+	opOk = true
+	return resourceList(c, key, 1)
+}
+
+func (a *Api) getMetadataUsage(c echo.Context) error {
+	// swagger:route GET /api/v1/metadata/usage Metadata GetMetadataUsage
+	// Get metadata usage statistics.
+	// Lists values that are not used in any document, near-duplicate values of the same key,
+	// keys used in at most max_documents (default 3) documents and values that are not used in any rule.
+	// Values are near-duplicates if they differ by at most max_typos (default 1, max 3) inserted, deleted,
+	// substituted or swapped characters, case-insensitive.
+	// Responses:
+	//  200: MetadataUsageResponse
+
+	ctx := c.(UserContext)
+	maxDocuments, err := bindQueryInt(c, "max_documents", 3)
+	if err != nil {
+		return err
+	}
+	maxTypos, err := bindQueryInt(c, "max_typos", 1)
+	if err != nil {
+		return err
+	}
+	if maxTypos > 3 {
+		e := errors.ErrInvalid
+		e.ErrMsg = "max_typos must be at most 3"
+		return e
+	}
+
+	report, err := a.metadataService.GetMetadataUsage(getContext(c), ctx.UserId, maxDocuments, maxTypos)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, report)
+}
+
+type MetadataValueMergeItem struct {
+	SourceId int `json:"source_id" valid:"required"`
+	TargetId int `json:"target_id" valid:"required"`
+}
+
+type MetadataCleanupRequest struct {
+	// DeleteKeys are the keys to delete with all their values.
+	DeleteKeys []int `json:"delete_keys" valid:"optional"`
+	// DeleteValues are the values to delete.
+	DeleteValues []int `json:"delete_values" valid:"optional"`
+	// MergeValues are merged before deleting anything. Source and target must belong to the same key.
+	MergeValues []MetadataValueMergeItem `json:"merge_values" valid:"optional"`
+}
+
+func (m *MetadataCleanupRequest) ToCleanup() *models.MetadataCleanup {
+	cleanup := &models.MetadataCleanup{
+		DeleteKeys:   m.DeleteKeys,
+		DeleteValues: m.DeleteValues,
+		MergeValues:  make([]models.MetadataValueMerge, len(m.MergeValues)),
+	}
+	for i, v := range m.MergeValues {
+		cleanup.MergeValues[i] = models.MetadataValueMerge{SourceId: v.SourceId, TargetId: v.TargetId}
+	}
+	return cleanup
+}
+
+func (a *Api) cleanupMetadata(c echo.Context) error {
+	// swagger:route POST /api/v1/metadata/cleanup Metadata CleanupMetadata
+	// Merge and delete metadata values and delete keys in one transaction.
+	// If any of the keys or values does not exist, nothing is changed.
+	// Rules that have conditions or actions with the deleted keys or values are disabled.
+	// Responses:
+	//  200: MetadataCleanupResponse
+
+	ctx := c.(UserContext)
+	dto := &MetadataCleanupRequest{}
+	err := unMarshalBody(c.Request(), dto)
+	if err != nil {
+		return err
+	}
+
+	opOk := false
+	defer logCrudMetadata(ctx.UserId, "cleanup", &opOk, "delete keys: %v, delete values: %v, merge values: %d",
+		dto.DeleteKeys, dto.DeleteValues, len(dto.MergeValues))
+
+	result, err := a.metadataService.CleanupMetadata(getContext(c), ctx.UserId, dto.ToCleanup())
+	if err != nil {
+		return err
+	}
+	opOk = true
+	return c.JSON(http.StatusOK, result)
+}
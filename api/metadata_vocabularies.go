@@ -0,0 +1,224 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"tryffel.net/go/virtualpaper/models"
+)
+
+// MetadataVocabularyRequest
+// swagger:model MetadataVocabularyRequestBody
+type MetadataVocabularyRequest struct {
+	Name        string `json:"name" valid:"required,stringlength(1|100)"`
+	Description string `json:"description" valid:"maxstringlength(1000),optional"`
+	// Editable allows subscribers to add and edit values of the keys.
+	Editable bool `json:"editable" valid:"-"`
+	// KeyIds are the keys of the vocabulary. User must own the keys.
+	KeyIds []int `json:"key_ids" valid:"-"`
+	// MemberIds are the users that are allowed to see and subscribe to the vocabulary.
+	MemberIds []int `json:"member_ids" valid:"-"`
+}
+
+func (r *MetadataVocabularyRequest) toVocabulary(userId int) *models.MetadataVocabulary {
+	vocabulary := &models.MetadataVocabulary{
+		UserId:      userId,
+		Name:        r.Name,
+		Description: r.Description,
+		Editable:    r.Editable,
+		Keys:        make([]models.MetadataVocabularyKey, len(r.KeyIds)),
+		Members:     make([]models.MetadataVocabularyMember, len(r.MemberIds)),
+	}
+	for i, v := range r.KeyIds {
+		vocabulary.Keys[i] = models.MetadataVocabularyKey{KeyId: v}
+	}
+	for i, v := range r.MemberIds {
+		vocabulary.Members[i] = models.MetadataVocabularyMember{UserId: v}
+	}
+	return vocabulary
+}
+
+func (a *Api) getMetadataVocabularies(c echo.Context) error {
+	// swagger:route GET /api/v1/metadata/vocabularies Metadata GetMetadataVocabularies
+	// Get metadata vocabularies that user owns, is a member of or has subscribed to
+	// Responses:
+	//  200: MetadataVocabularyResponse
+	ctx := c.(UserContext)
+	paging := getPagination(c)
+	sort := getSort(c)
+
+	vocabularies, count, err := a.metadataService.GetVocabularies(getContext(c), ctx.UserId, sort.ToKey(), paging.toPagination())
+	if err != nil {
+		return err
+	}
+	return resourceList(c, vocabularies, count)
+}
+
+func (a *Api) getMetadataVocabulary(c echo.Context) error {
+	// swagger:route GET /api/v1/metadata/vocabularies/{id} Metadata GetMetadataVocabulary
+	// Get metadata vocabulary
+	// Responses:
+	//  200: MetadataVocabularyResponse
+	ctx := c.(UserContext)
+	id, err := bindPathIdInt(c)
+	if err != nil {
+		return err
+	}
+
+	vocabulary, err := a.metadataService.GetVocabulary(getContext(c), ctx.UserId, id)
+	if err != nil {
+		return err
+	}
+	return resourceList(c, vocabulary, 1)
+}
+
+func (a *Api) addMetadataVocabulary(c echo.Context) error {
+	// swagger:route POST /api/v1/metadata/vocabularies Metadata AddMetadataVocabulary
+	// Share metadata keys as a vocabulary
+	// Responses:
+	//  200: MetadataVocabularyResponse
+	ctx := c.(UserContext)
+	dto := &MetadataVocabularyRequest{}
+	err := unMarshalBody(c.Request(), dto)
+	if err != nil {
+		return err
+	}
+
+	opOk := false
+	defer logCrudMetadata(ctx.UserId, "create vocabulary", &opOk, "name: %s", dto.Name)
+
+	vocabulary := dto.toVocabulary(ctx.UserId)
+	err = a.metadataService.CreateVocabulary(getContext(c), vocabulary)
+	if err != nil {
+		return err
+	}
+	created, err := a.metadataService.GetVocabulary(getContext(c), ctx.UserId, vocabulary.Id)
+	if err != nil {
+		return err
+	}
+	opOk = true
+	return resourceList(c, created, 1)
+}
+
+func (a *Api) updateMetadataVocabulary(c echo.Context) error {
+	// swagger:route PUT /api/v1/metadata/vocabularies/{id} Metadata UpdateMetadataVocabulary
+	// Update metadata vocabulary. Keys and members are replaced with the given ones.
+	// Users that are removed from members lose their subscription.
+	// Responses:
+	//  200: MetadataVocabularyResponse
+	ctx := c.(UserContext)
+	id, err := bindPathIdInt(c)
+	if err != nil {
+		return err
+	}
+	dto := &MetadataVocabularyRequest{}
+	err = unMarshalBody(c.Request(), dto)
+	if err != nil {
+		return err
+	}
+
+	opOk := false
+	defer logCrudMetadata(ctx.UserId, "update vocabulary", &opOk, "vocabulary: %d", id)
+
+	vocabulary := dto.toVocabulary(ctx.UserId)
+	vocabulary.Id = id
+	err = a.metadataService.UpdateVocabulary(getContext(c), vocabulary)
+	if err != nil {
+		return err
+	}
+	updated, err := a.metadataService.GetVocabulary(getContext(c), ctx.UserId, id)
+	if err != nil {
+		return err
+	}
+	opOk = true
+	return resourceList(c, updated, 1)
+}
+
+func (a *Api) deleteMetadataVocabulary(c echo.Context) error {
+	// swagger:route DELETE /api/v1/metadata/vocabularies/{id} Metadata DeleteMetadataVocabulary
+	// Delete metadata vocabulary. Subscribers' documents keep their metadata.
+	// Responses:
+	//  200:
+	ctx := c.(UserContext)
+	id, err := bindPathIdInt(c)
+	if err != nil {
+		return err
+	}
+
+	opOk := false
+	defer logCrudMetadata(ctx.UserId, "delete vocabulary", &opOk, "vocabulary: %d", id)
+	err = a.metadataService.DeleteVocabulary(getContext(c), ctx.UserId, id)
+	if err != nil {
+		return err
+	}
+	opOk = true
+	return c.String(http.StatusOK, "ok")
+}
+
+func (a *Api) subscribeMetadataVocabulary(c echo.Context) error {
+	// swagger:route POST /api/v1/metadata/vocabularies/{id}/subscription Metadata SubscribeMetadataVocabulary
+	// Subscribe to metadata vocabulary to use its keys. Owner must have added the user as a member.
+	// Responses:
+	//  200: MetadataVocabularyResponse
+	ctx := c.(UserContext)
+	id, err := bindPathIdInt(c)
+	if err != nil {
+		return err
+	}
+
+	opOk := false
+	defer logCrudMetadata(ctx.UserId, "subscribe vocabulary", &opOk, "vocabulary: %d", id)
+	err = a.metadataService.SubscribeVocabulary(getContext(c), ctx.UserId, id)
+	if err != nil {
+		return err
+	}
+	vocabulary, err := a.metadataService.GetVocabulary(getContext(c), ctx.UserId, id)
+	if err != nil {
+		return err
+	}
+	opOk = true
+	return resourceList(c, vocabulary, 1)
+}
+
+func (a *Api) unsubscribeMetadataVocabulary(c echo.Context) error {
+	// swagger:route DELETE /api/v1/metadata/vocabularies/{id}/subscription Metadata UnsubscribeMetadataVocabulary
+	// Unsubscribe from metadata vocabulary. Documents keep the metadata they already have.
+	// Responses:
+	//  200: MetadataVocabularyResponse
+	ctx := c.(UserContext)
+	id, err := bindPathIdInt(c)
+	if err != nil {
+		return err
+	}
+
+	opOk := false
+	defer logCrudMetadata(ctx.UserId, "unsubscribe vocabulary", &opOk, "vocabulary: %d", id)
+	err = a.metadataService.UnsubscribeVocabulary(getContext(c), ctx.UserId, id)
+	if err != nil {
+		return err
+	}
+	vocabulary, err := a.metadataService.GetVocabulary(getContext(c), ctx.UserId, id)
+	if err != nil {
+		return err
+	}
+	opOk = true
+	return resourceList(c, vocabulary, 1)
+}
@@ -19,7 +19,9 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/asaskevich/govalidator"
 	"github.com/labstack/echo/v4"
 	"net/http"
@@ -239,6 +241,20 @@ func mDocumentWriteAccess(service *services.DocumentService) func(idKey string)
 }
 
 func mMetadataKeyOwner(service *services.MetadataService) func(idKey string) echo.MiddlewareFunc {
+	return mMetadataKeyPermission(service.UserOwnsKey)
+}
+
+// mMetadataKeyAccess allows users that own the key or use it through a vocabulary.
+func mMetadataKeyAccess(service *services.MetadataService) func(idKey string) echo.MiddlewareFunc {
+	return mMetadataKeyPermission(service.UserCanAccessKey)
+}
+
+// mMetadataKeyValueEditor allows users that own the key or use it through an editable vocabulary.
+func mMetadataKeyValueEditor(service *services.MetadataService) func(idKey string) echo.MiddlewareFunc {
+	return mMetadataKeyPermission(service.UserCanEditKeyValues)
+}
+
+func mMetadataKeyPermission(hasPermission func(ctx context.Context, userId, keyId int) (bool, error)) func(idKey string) echo.MiddlewareFunc {
 	return func(idKey string) echo.MiddlewareFunc {
 		return func(next echo.HandlerFunc) echo.HandlerFunc {
 			return func(c echo.Context) error {
@@ -249,7 +265,7 @@ func mMetadataKeyOwner(service *services.MetadataService) func(idKey string) ech
 					userErr.ErrMsg = "id must be integer"
 					return userErr
 				}
-				owns, err := service.UserOwnsKey(getContext(ctx), ctx.UserId, id)
+				owns, err := hasPermission(getContext(ctx), ctx.UserId, id)
 				if err != nil {
 					return err
 				}
@@ -294,6 +310,32 @@ func bindPathIdInt(c echo.Context) (int, error) {
 	return bindPathInt(c, "id")
 }
 
+// bindQueryFlag returns true if query parameter is '1'. Missing parameter is false.
+func bindQueryFlag(c echo.Context, name string) (bool, error) {
+	flag := c.QueryParam(name)
+	if flag != "1" && flag != "0" && flag != "" {
+		e := errors.ErrInvalid
+		e.ErrMsg = fmt.Sprintf("query parameter '%s' must be either 1 or 0", name)
+		return false, e
+	}
+	return flag == "1", nil
+}
+
+// bindQueryInt returns the integer query parameter, or defaultValue if the parameter is missing.
+func bindQueryInt(c echo.Context, name string, defaultValue int) (int, error) {
+	param := c.QueryParam(name)
+	if param == "" {
+		return defaultValue, nil
+	}
+	value, err := strconv.Atoi(param)
+	if err != nil || value < 0 {
+		e := errors.ErrInvalid
+		e.ErrMsg = fmt.Sprintf("query parameter '%s' must be a non-negative integer", name)
+		return 0, e
+	}
+	return value, nil
+}
+
 func bindPathInt(c echo.Context, name string) (int, error) {
 	idStr := c.Param(name)
 	id, err := strconv.Atoi(idStr)
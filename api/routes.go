@@ -47,6 +47,8 @@ func (api *Api) addRoutesV2() {
 	mDocCanRead := mDocumentReadAccess(api.documentService)
 	mDocCanWrite := mDocumentWriteAccess(api.documentService)
 	mMetadataOwner := mMetadataKeyOwner(api.metadataService)
+	mMetadataAccess := mMetadataKeyAccess(api.metadataService)
+	mMetadataValueEditor := mMetadataKeyValueEditor(api.metadataService)
 	mRule := mRuleOwner(api.ruleService)
 
 	authGroup.POST("/login", api.LoginV2)
@@ -62,9 +64,16 @@ func (api *Api) addRoutesV2() {
 	api.privateRouter.POST("/documents", api.uploadFile)
 	api.privateRouter.GET("/documents", api.getDocuments, mPagination(), mSort(&models.Document{})).Name = "get-documents"
 	api.privateRouter.GET("/documents/deleted", api.getDeletedDocuments, mPagination(), mSort(&models.Document{})).Name = "get-deleted-documents"
+	api.privateRouter.GET("/documents/incomplete", api.getIncompleteDocuments, mPagination(), mSort(&models.Document{}))
+	api.privateRouter.GET("/documents/csv", api.exportDocumentsCsv)
+	api.privateRouter.POST("/documents/csv", api.importDocumentsCsv)
+	api.privateRouter.GET("/documents/duplicates", api.getDuplicateDocuments)
+	api.privateRouter.POST("/documents/duplicates/merge", api.mergeDuplicateDocuments)
+	api.privateRouter.POST("/documents/duplicates/dismiss", api.dismissDuplicateDocuments)
 	api.privateRouter.GET("/documents/:id", api.getDocument, mDocCanRead("id")).Name = "get-document"
 	api.privateRouter.PUT("/documents/:id", api.updateDocument, mDocCanWrite("id"))
 	api.privateRouter.PUT("/documents/:id/sharing", api.updateDocumentSharing, mDocOwner("id"))
+	api.privateRouter.PUT("/documents/:id/invoice/paid", api.updateDocumentInvoicePaid, mDocOwner("id"))
 	api.privateRouter.DELETE("/documents/:id", api.deleteDocument, mDocOwner("id"))
 	api.privateRouter.POST("/documents/deleted/:id/restore", api.restoreDeletedDocument, mDocOwner("id"))
 	api.privateRouter.DELETE("/documents/deleted/:id", api.flushDeletedDocument, mDocOwner("id"))
@@ -73,10 +82,16 @@ func (api *Api) addRoutesV2() {
 	api.privateRouter.GET("/documents/:id/content", api.getDocumentContent, mDocCanRead("id"))
 	api.privateRouter.GET("/documents/:id/download", api.downloadDocument, mDocCanRead("id"))
 	api.privateRouter.GET("/documents/:id/linked-documents", api.getLinkedDocuments, mDocOwner("id"))
+	api.privateRouter.GET("/documents/:id/similar", api.getSimilarDocuments, mDocOwner("id"), mPagination())
 	api.privateRouter.POST("/documents/:id/process", api.requestDocumentProcessing, mDocOwner("id"))
 	api.privateRouter.PUT("/documents/:id/linked-documents", api.updateLinkedDocuments, mDocOwner("id"))
 	api.privateRouter.GET("/documents/:id/history", api.getDocumentHistory, mDocCanRead("id"))
+	api.privateRouter.GET("/documents/:id/notes", api.getDocumentNotes, mDocCanRead("id"))
+	api.privateRouter.POST("/documents/:id/notes", api.addDocumentNote, mDocCanWrite("id"))
+	api.privateRouter.PUT("/documents/:id/notes/:noteId", api.updateDocumentNote, mDocCanWrite("id"))
+	api.privateRouter.DELETE("/documents/:id/notes/:noteId", api.deleteDocumentNote, mDocCanWrite("id"))
 	api.privateRouter.GET("/documents/:id/jobs", api.getDocumentLogs, mDocCanRead("id"))
+	api.privateRouter.GET("/documents/:id/rules-trace", api.getDocumentRulesTrace, mDocOwner("id"))
 
 	api.privateRouter.POST("/documents/bulkEdit", api.bulkEditDocuments)
 
@@ -85,28 +100,59 @@ func (api *Api) addRoutesV2() {
 	api.privateRouter.GET("/metadata/keys", api.getMetadataKeys, mPagination(), mSort(&models.MetadataKeyAnnotated{}))
 	api.privateRouter.POST("/metadata/keys", api.addMetadataKey)
 	api.privateRouter.PUT("/metadata/keys/:id", api.updateMetadataKey, mMetadataOwner("id"))
-	api.privateRouter.GET("/metadata/keys/:id", api.getMetadataKey, mMetadataOwner("id"))
-	api.privateRouter.GET("/metadata/keys/:id/values", api.getMetadataKeyValues, mMetadataOwner("id"), mPagination(), mSort(&models.MetadataValue{}))
-	api.privateRouter.POST("/metadata/keys/:id/values", api.addMetadataValue, mMetadataOwner("id"))
+	api.privateRouter.GET("/metadata/keys/:id", api.getMetadataKey, mMetadataAccess("id"))
+	api.privateRouter.GET("/metadata/keys/:id/values", api.getMetadataKeyValues, mMetadataAccess("id"), mPagination(), mSort(&models.MetadataValue{}))
+	api.privateRouter.POST("/metadata/keys/:id/values", api.addMetadataValue, mMetadataValueEditor("id"))
 	api.privateRouter.DELETE("/metadata/keys/:id", api.deleteMetadataKey, mMetadataOwner("id"))
-	api.privateRouter.PUT("/metadata/keys/:keyId/values/:valueId", api.updateMetadataValue, mMetadataOwner("keyId"))
+	api.privateRouter.PUT("/metadata/keys/:keyId/values/:valueId", api.updateMetadataValue, mMetadataValueEditor("keyId"))
 	api.privateRouter.DELETE("/metadata/keys/:keyId/values/:valueId", api.deleteMetadataValue, mMetadataOwner("keyId"))
+	api.privateRouter.POST("/metadata/keys/:id/merge", api.mergeMetadataKey, mMetadataOwner("id"))
+	api.privateRouter.POST("/metadata/keys/:keyId/values/:valueId/merge", api.mergeMetadataValue, mMetadataOwner("keyId"))
+	api.privateRouter.POST("/metadata/keys/:keyId/values/:valueId/move", api.moveMetadataValue, mMetadataOwner("keyId"))
+	api.privateRouter.GET("/metadata/usage", api.getMetadataUsage)
+	api.privateRouter.POST("/metadata/cleanup", api.cleanupMetadata)
+
+	api.privateRouter.GET("/metadata/vocabularies", api.getMetadataVocabularies, mPagination(), mSort(&models.MetadataVocabulary{}))
+	api.privateRouter.POST("/metadata/vocabularies", api.addMetadataVocabulary)
+	api.privateRouter.GET("/metadata/vocabularies/:id", api.getMetadataVocabulary)
+	api.privateRouter.PUT("/metadata/vocabularies/:id", api.updateMetadataVocabulary)
+	api.privateRouter.DELETE("/metadata/vocabularies/:id", api.deleteMetadataVocabulary)
+	api.privateRouter.POST("/metadata/vocabularies/:id/subscription", api.subscribeMetadataVocabulary)
+	api.privateRouter.DELETE("/metadata/vocabularies/:id/subscription", api.unsubscribeMetadataVocabulary)
+
+	api.privateRouter.GET("/document-types", api.getDocumentTypes, mPagination(), mSort(&models.DocumentType{}))
+	api.privateRouter.POST("/document-types", api.addDocumentType)
+	api.privateRouter.GET("/document-types/:id", api.getDocumentType)
+	api.privateRouter.PUT("/document-types/:id", api.updateDocumentType)
+	api.privateRouter.DELETE("/document-types/:id", api.deleteDocumentType)
 
 	api.privateRouter.GET("/processing/rules", api.getUserRules, mPagination(), mSort(&models.Rule{}))
 	api.privateRouter.PUT("/processing/rules/reorder", api.reorderRules)
+	api.privateRouter.GET("/processing/rules/export", api.exportRules)
+	api.privateRouter.POST("/processing/rules/import", api.importRules)
 	api.privateRouter.POST("/processing/rules", api.addUserRule)
 	api.privateRouter.GET("/processing/rules/:id", api.getUserRule, mRule("id"))
 	api.privateRouter.PUT("/processing/rules/:id", api.updateUserRule, mRule("id"))
 	api.privateRouter.DELETE("/processing/rules/:id", api.deleteUserRule, mRule("id"))
 	api.privateRouter.PUT("/processing/rules/:id/test", api.testRule, mRule("id"))
+	api.privateRouter.POST("/processing/rules/:id/apply", api.applyRule, mRule("id"))
+	api.privateRouter.GET("/processing/rules/:id/apply", api.getRuleApplyStatus, mRule("id"))
 
 	api.privateRouter.GET("/preferences/user", api.getUserPreferences).Name = "get-user-preferences"
 	api.privateRouter.PUT("/preferences/user", api.updateUserPreferences)
+	api.privateRouter.GET("/preferences/search", api.getSearchSettings)
+	api.privateRouter.POST("/preferences/search/synonyms", api.addSearchSynonym)
+	api.privateRouter.PUT("/preferences/search/synonyms/:id", api.updateSearchSynonym)
+	api.privateRouter.DELETE("/preferences/search/synonyms/:id", api.deleteSearchSynonym)
+	api.privateRouter.PUT("/preferences/search/stop-words", api.updateSearchStopWords)
+	api.privateRouter.PUT("/preferences/search/ranking", api.updateSearchRanking)
 	api.privateRouter.GET("/users", api.GetUsers)
 
 	api.adminRouter.GET("/documents/process", api.getDocumentProcessQueue)
 	api.adminRouter.POST("/documents/process", api.forceDocumentProcessing)
 	api.adminRouter.POST("/documents/deleted/:id/restore", api.adminRestoreDeletedDocument)
+	api.adminRouter.GET("/search/verify", api.getSearchIndexStatus)
+	api.adminRouter.POST("/search/verify", api.verifySearchIndex)
 
 	api.adminRouter.GET("/users", api.adminGetUsers)
 	api.adminRouter.POST("/users", api.adminAddUser, api.ConfirmAuthorizedToken())
@@ -21,10 +21,13 @@ package api
 import (
 	"fmt"
 	"github.com/labstack/echo/v4"
+	"io"
 	"net/http"
+	"strings"
 	"tryffel.net/go/virtualpaper/config"
 	"tryffel.net/go/virtualpaper/errors"
 	"tryffel.net/go/virtualpaper/models"
+	"tryffel.net/go/virtualpaper/services"
 )
 
 type Rule struct {
@@ -36,6 +39,13 @@ type Rule struct {
 	Mode        string `json:"mode" valid:"-"`
 	CreatedAt   int64  `json:"created_at" valid:"-"`
 	UpdatedAt   int64  `json:"updated_at" valid:"-"`
+	// Triggers are the events that run the rule: upload, edit, metadata, share, schedule.
+	// Defaults to upload.
+	Triggers []string `json:"triggers" valid:"-"`
+	// Schedule is the cron schedule for schedule trigger, e.g. '0 3 * * *'.
+	Schedule string `json:"schedule" valid:"-"`
+	// StopProcessing stops running the rest of the rules when this rule matches the document.
+	StopProcessing bool `json:"stop_processing" valid:"-"`
 
 	Conditions []RuleCondition `json:"conditions" valid:"-"`
 	Actions    []RuleAction    `json:"actions" valid:"-"`
@@ -52,6 +62,9 @@ type RuleCondition struct {
 	Value           string          `json:"value" valid:"-"`
 	DateFmt         string          `json:"date_fmt" valid:"-"`
 	Metadata        models.Metadata `json:"metadata" valid:"-"`
+	// Mode and Conditions are set for condition_type 'group'.
+	Mode       string          `json:"mode,omitempty" valid:"-"`
+	Conditions []RuleCondition `json:"conditions,omitempty" valid:"-"`
 }
 
 type RuleAction struct {
@@ -68,6 +81,15 @@ type RuleTest struct {
 	DocumentId string `json:"document_id" valid:"required"`
 }
 
+// RuleApplyRequest applies rule to existing documents.
+// swagger:model RuleApplyRequest
+type RuleApplyRequest struct {
+	// search query to limit the documents. Empty query applies rule to all documents.
+	Query string `json:"query" valid:"-"`
+	// apply the rule. If false, only preview of the changes is returned.
+	Confirm bool `json:"confirm" valid:"-"`
+}
+
 func (r *RuleAction) ToAction() *models.RuleAction {
 	return &models.RuleAction{
 		Enabled:       r.Enabled,
@@ -96,8 +118,8 @@ func actionToResp(action *models.RuleAction) RuleAction {
 	}
 }
 
-func (r *RuleCondition) ToCondition() *models.RuleCondition {
-	return &models.RuleCondition{
+func (r *RuleCondition) ToCondition() (*models.RuleCondition, error) {
+	condition := &models.RuleCondition{
 		Enabled:         r.Enabled,
 		CaseInsensitive: r.CaseInsensitive,
 		Inverted:        r.Inverted,
@@ -108,10 +130,26 @@ func (r *RuleCondition) ToCondition() *models.RuleCondition {
 		MetadataKey:     models.IntId(r.Metadata.KeyId),
 		MetadataValue:   models.IntId(r.Metadata.ValueId),
 	}
+	if condition.ConditionType != models.RuleConditionGroup {
+		return condition, nil
+	}
+
+	err := condition.Mode.FromString(r.Mode)
+	if err != nil {
+		return nil, err
+	}
+	condition.Children = make([]*models.RuleCondition, len(r.Conditions))
+	for i, v := range r.Conditions {
+		condition.Children[i], err = v.ToCondition()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return condition, nil
 }
 
 func conditionToResp(cond *models.RuleCondition) RuleCondition {
-	return RuleCondition{
+	resp := RuleCondition{
 		Id:              cond.Id,
 		RuleId:          cond.RuleId,
 		Enabled:         cond.Enabled,
@@ -129,6 +167,14 @@ func conditionToResp(cond *models.RuleCondition) RuleCondition {
 			Value:   cond.MetadataValueName.String(),
 		},
 	}
+	if cond.IsGroup() {
+		resp.Mode = cond.Mode.String()
+		resp.Conditions = make([]RuleCondition, len(cond.Children))
+		for i, v := range cond.Children {
+			resp.Conditions[i] = conditionToResp(v)
+		}
+	}
+	return resp
 }
 
 func ruleToResp(rule *models.Rule) *Rule {
@@ -141,6 +187,13 @@ func ruleToResp(rule *models.Rule) *Rule {
 		Mode:        rule.Mode.String(),
 		CreatedAt:   rule.CreatedAt.Unix() * 1000,
 		UpdatedAt:   rule.UpdatedAt.Unix() * 1000,
+		Triggers:    make([]string, len(rule.Triggers)),
+		Schedule:    rule.Schedule,
+
+		StopProcessing: rule.StopProcessing,
+	}
+	for i, v := range rule.Triggers {
+		resp.Triggers[i] = v.String()
 	}
 
 	resp.Conditions = make([]RuleCondition, len(rule.Conditions))
@@ -168,12 +221,23 @@ func (r *Rule) ToRule() (*models.Rule, error) {
 		Enabled:     r.Enabled,
 		Order:       r.Order,
 		Mode:        mode,
-		Conditions:  make([]*models.RuleCondition, len(r.Conditions)),
-		Actions:     make([]*models.RuleAction, len(r.Actions)),
+		Triggers:    make(models.RuleTriggers, 0, len(r.Triggers)),
+		Schedule:    r.Schedule,
+
+		StopProcessing: r.StopProcessing,
+		Conditions:     make([]*models.RuleCondition, len(r.Conditions)),
+		Actions:        make([]*models.RuleAction, len(r.Actions)),
+	}
+
+	for _, v := range r.Triggers {
+		rule.Triggers = rule.Triggers.Add(models.RuleTrigger(v))
 	}
 
 	for i, v := range r.Conditions {
-		rule.Conditions[i] = v.ToCondition()
+		rule.Conditions[i], err = v.ToCondition()
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	for i, v := range r.Actions {
@@ -386,3 +450,153 @@ func (a *Api) reorderRules(c echo.Context) error {
 	out := map[string]interface{}{"id": "rules"}
 	return c.JSON(200, out)
 }
+
+func (a *Api) applyRule(c echo.Context) error {
+	// swagger:route POST /api/v1/processing/rules/{id}/apply Processing ApplyRule
+	// Apply rule to existing documents
+	//
+	// Without confirm, run the rule against documents without saving and return the documents that would change.
+	// With confirm, apply the rule in background and return the status of the job.
+	// Use GET /api/v1/processing/rules/{id}/apply to follow the progress.
+	// Consumes:
+	// - application/json
+	//
+	// responses:
+	//   200: RespOk
+	//   400: RespBadRequest
+	//   401: RespForbidden
+	//   404: RespNotFound
+
+	ctx := c.(UserContext)
+	id, err := bindPathIdInt(c)
+	if err != nil {
+		return err
+	}
+
+	body := &RuleApplyRequest{}
+	err = unMarshalBody(c.Request(), body)
+	if err != nil {
+		return err
+	}
+
+	if !body.Confirm {
+		preview, err := a.ruleService.PreviewApplyRule(getContext(c), ctx.UserId, id, body.Query)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, preview)
+	}
+
+	opOk := false
+	defer logCrudRule(ctx.UserId, "apply", &opOk, "rule: %d, query: '%s'", id, body.Query)
+	status, err := a.ruleService.StartApplyRule(getContext(c), ctx.UserId, id, body.Query)
+	if err != nil {
+		return err
+	}
+	opOk = true
+	return c.JSON(http.StatusOK, status)
+}
+
+func (a *Api) getRuleApplyStatus(c echo.Context) error {
+	// swagger:route GET /api/v1/processing/rules/{id}/apply Processing GetRuleApplyStatus
+	// Get the status of applying rule to existing documents
+	// responses:
+	//   200: RespOk
+	//   404: RespNotFound
+
+	ctx := c.(UserContext)
+	id, err := bindPathIdInt(c)
+	if err != nil {
+		return err
+	}
+	status, err := a.ruleService.GetApplyRuleStatus(getContext(c), ctx.UserId, id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
+// maximum size of rule import body
+const maxRuleImportSize = 5 * 1024 * 1024
+
+func ruleExportFormat(c echo.Context) string {
+	format := strings.ToLower(c.QueryParam("format"))
+	switch format {
+	case "":
+		return services.RuleExportFormatJson
+	case "yml":
+		return services.RuleExportFormatYaml
+	}
+	return format
+}
+
+func (a *Api) exportRules(c echo.Context) error {
+	// swagger:route GET /api/v1/processing/rules/export Processing ExportRules
+	// Export all processing rules
+	//
+	// Query parameter format is either 'json' (default) or 'yaml'.
+	// Metadata keys, values and document types are exported by their names.
+	// responses:
+	//   200: RespOk
+	//   400: RespBadRequest
+
+	ctx := c.(UserContext)
+	format := ruleExportFormat(c)
+	export, err := a.ruleService.ExportRules(getContext(c), ctx.UserId)
+	if err != nil {
+		return err
+	}
+	data, err := services.MarshalRuleExport(export, format)
+	if err != nil {
+		return err
+	}
+
+	contentType := "application/json"
+	if format == services.RuleExportFormatYaml {
+		contentType = "application/yaml"
+	}
+	c.Response().Header().Set("Content-Disposition", "attachment; filename=rules."+format)
+	return c.Blob(http.StatusOK, contentType, data)
+}
+
+func (a *Api) importRules(c echo.Context) error {
+	// swagger:route POST /api/v1/processing/rules/import Processing ImportRules
+	// Import processing rules
+	//
+	// Body is the rule export in either json or yaml, defined with query parameter format.
+	// Metadata keys, values and document types that do not exist are created.
+	// Query parameter conflict defines what to do with existing rules with same name:
+	// 'skip' (default), 'replace' or 'duplicate'.
+	// responses:
+	//   200: RespOk
+	//   400: RespBadRequest
+
+	ctx := c.(UserContext)
+	format := ruleExportFormat(c)
+	conflict := services.RuleImportConflict(c.QueryParam("conflict"))
+	if conflict == "" {
+		conflict = services.RuleImportSkip
+	}
+	err := conflict.Validate()
+	if err != nil {
+		return err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(c.Request().Body, maxRuleImportSize))
+	if err != nil {
+		return fmt.Errorf("read body: %v", err)
+	}
+	export, err := services.UnmarshalRuleExport(data, format)
+	if err != nil {
+		return err
+	}
+
+	opOk := false
+	defer logCrudRule(ctx.UserId, "import", &opOk, "rules: %d, conflict: %s", len(export.Rules), conflict)
+	status, err := a.ruleService.ImportRules(getContext(c), ctx.UserId, export, conflict)
+	if err != nil {
+		return err
+	}
+	opOk = true
+	return c.JSON(http.StatusOK, status)
+}
@@ -33,3 +33,15 @@ type metadataKeyValueResponse struct {
 	// in:body
 	Body []models.MetadataValue
 }
+
+// swagger:response MetadataUsageResponse
+type metadataUsageResponse struct {
+	// in:body
+	Body models.MetadataUsageReport
+}
+
+// swagger:response MetadataCleanupResponse
+type metadataCleanupResponse struct {
+	// in:body
+	Body models.MetadataCleanupResult
+}
@@ -118,3 +118,146 @@ func (a *Api) GetUsers(c echo.Context) error {
 	}
 	return resourceList(c, users, len(*users))
 }
+
+func (a *Api) getSearchSettings(c echo.Context) error {
+	// swagger:route GET /api/v1/preferences/search Preferences GetSearchSettings
+	// Get user's search synonyms, stop words and ranking rules
+	// responses:
+	//   200: RespOk
+	//   401: RespForbidden
+	//   500: RespInternalError
+	ctx := c.(UserContext)
+	settings, err := a.userService.GetSearchSettings(getContext(c), ctx.UserId)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, settings)
+}
+
+// swagger:model SearchSynonymRequest
+type SearchSynonymRequest struct {
+	// words that are considered equal
+	Words []string `json:"words" valid:"required"`
+}
+
+func (a *Api) addSearchSynonym(c echo.Context) error {
+	// swagger:route POST /api/v1/preferences/search/synonyms Preferences AddSearchSynonym
+	// Add synonym group. Searching for any of the words matches documents that contain any word in the group.
+	// responses:
+	//   200: RespOk
+	//   400: RespBadRequest
+	//   401: RespForbidden
+	//   500: RespInternalError
+	ctx := c.(UserContext)
+	dto := &SearchSynonymRequest{}
+	err := unMarshalBody(c.Request(), dto)
+	if err != nil {
+		return err
+	}
+	synonym := &models.SearchSynonym{UserId: ctx.UserId, Words: dto.Words}
+	err = a.userService.AddSearchSynonym(getContext(c), synonym)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, synonym)
+}
+
+func (a *Api) updateSearchSynonym(c echo.Context) error {
+	// swagger:route PUT /api/v1/preferences/search/synonyms/{id} Preferences UpdateSearchSynonym
+	// Update synonym group
+	// responses:
+	//   200: RespOk
+	//   400: RespBadRequest
+	//   401: RespForbidden
+	//   404: RespNotFound
+	//   500: RespInternalError
+	ctx := c.(UserContext)
+	id, err := bindPathIdInt(c)
+	if err != nil {
+		return err
+	}
+	dto := &SearchSynonymRequest{}
+	err = unMarshalBody(c.Request(), dto)
+	if err != nil {
+		return err
+	}
+	synonym := &models.SearchSynonym{Id: id, UserId: ctx.UserId, Words: dto.Words}
+	err = a.userService.UpdateSearchSynonym(getContext(c), synonym)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, synonym)
+}
+
+func (a *Api) deleteSearchSynonym(c echo.Context) error {
+	// swagger:route DELETE /api/v1/preferences/search/synonyms/{id} Preferences DeleteSearchSynonym
+	// Delete synonym group
+	// responses:
+	//   200: RespOk
+	//   401: RespForbidden
+	//   404: RespNotFound
+	//   500: RespInternalError
+	ctx := c.(UserContext)
+	id, err := bindPathIdInt(c)
+	if err != nil {
+		return err
+	}
+	err = a.userService.DeleteSearchSynonym(getContext(c), ctx.UserId, id)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]int{"id": id})
+}
+
+// swagger:model SearchWordsRequest
+type SearchWordsRequest struct {
+	Words []string `json:"words" valid:"-"`
+}
+
+func (a *Api) updateSearchStopWords(c echo.Context) error {
+	// swagger:route PUT /api/v1/preferences/search/stop-words Preferences UpdateSearchStopWords
+	// Replace stop words. Stop words are removed from search queries.
+	// responses:
+	//   200: RespOk
+	//   400: RespBadRequest
+	//   401: RespForbidden
+	//   500: RespInternalError
+	ctx := c.(UserContext)
+	dto := &SearchWordsRequest{}
+	err := unMarshalBody(c.Request(), dto)
+	if err != nil {
+		return err
+	}
+	words, err := a.userService.SetSearchStopWords(getContext(c), ctx.UserId, dto.Words)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, SearchWordsRequest{Words: words})
+}
+
+// swagger:model SearchRankingRequest
+type SearchRankingRequest struct {
+	// ranking rules in order of importance, e.g. 'date:desc'.
+	Rules []string `json:"rules" valid:"-"`
+}
+
+func (a *Api) updateSearchRanking(c echo.Context) error {
+	// swagger:route PUT /api/v1/preferences/search/ranking Preferences UpdateSearchRanking
+	// Replace ranking rules. Ranking rules order search results that are equally relevant.
+	// responses:
+	//   200: RespOk
+	//   400: RespBadRequest
+	//   401: RespForbidden
+	//   500: RespInternalError
+	ctx := c.(UserContext)
+	dto := &SearchRankingRequest{}
+	err := unMarshalBody(c.Request(), dto)
+	if err != nil {
+		return err
+	}
+	rules, err := a.userService.SetSearchRanking(getContext(c), ctx.UserId, dto.Rules)
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, SearchRankingRequest{Rules: rules})
+}
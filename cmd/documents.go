@@ -0,0 +1,135 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"tryffel.net/go/virtualpaper/config"
+	"tryffel.net/go/virtualpaper/services"
+)
+
+var documentsCmd = &cobra.Command{
+	Use:   "documents",
+	Short: "Export and import documents metadata",
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+var documentsExportCsvCmd = &cobra.Command{
+	Use:   "export-csv",
+	Short: "Export user's documents as csv to file or stdout",
+	Long: "Export user's documents as csv. Columns are id, name, date, filename and one column per metadata key. " +
+		"Multiple values of a key are separated with '" + services.DocumentCsvValueSeparator + "'.",
+	Run: func(cmd *cobra.Command, args []string) {
+		db, userId := initUserCmd(documentsUserName)
+		defer config.DeinitLogging()
+		defer db.Close()
+
+		var out io.Writer = os.Stdout
+		if documentsFile != "" {
+			file, err := os.OpenFile(documentsFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+			if err != nil {
+				logrus.Fatalf("open file: %v", err)
+			}
+			defer file.Close()
+			out = file
+		}
+
+		service := services.NewDocumentService(db, nil, nil)
+		count, err := service.ExportDocumentsCsv(context.Background(), userId, out)
+		if err != nil {
+			logrus.Fatalf("export documents: %v", err)
+		}
+		if documentsFile != "" {
+			logrus.Infof("Exported %d documents to %s", count, documentsFile)
+		}
+	},
+}
+
+var documentsImportCsvCmd = &cobra.Command{
+	Use:   "import-csv",
+	Short: "Import documents metadata from csv for user",
+	Long: "Import documents metadata from csv in the format of export-csv. Only column 'id' is required. " +
+		"By default the file is only validated and the changes are printed, use --apply to save the changes. " +
+		"Nothing is saved if any line has errors.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if documentsFile == "" {
+			logrus.Fatalf("file is required")
+		}
+		db, userId := initUserCmd(documentsUserName)
+		defer config.DeinitLogging()
+		defer db.Close()
+
+		file, err := os.Open(documentsFile)
+		if err != nil {
+			logrus.Fatalf("open file: %v", err)
+		}
+		defer file.Close()
+
+		service := services.NewDocumentService(db, nil, nil)
+		status, err := service.ImportDocumentsCsv(context.Background(), userId, file, services.DocumentCsvImportOptions{
+			DryRun:       !documentsApply,
+			CreateValues: documentsCreateValues,
+		})
+		if err != nil {
+			logrus.Fatalf("import documents: %v", err)
+		}
+		for _, v := range status.Errors {
+			fmt.Printf("line %d: %s %s\n", v.Line, v.DocumentId, v.Error)
+		}
+		for _, v := range status.Documents {
+			fmt.Printf("%s: %s (%v)\n", v.DocumentId, v.Name, v.Changes)
+		}
+		fmt.Printf("Rows: %d, changed: %d, unchanged: %d, errors: %d, new metadata values: %d\n",
+			status.Rows, status.Changed, status.Unchanged, len(status.Errors), status.CreatedValues)
+		if status.Applied {
+			fmt.Println("Changes saved")
+		} else if len(status.Errors) > 0 {
+			fmt.Println("Fix the errors and run again, no changes were saved")
+		} else {
+			fmt.Println("Dry run, no changes were saved. Use --apply to save the changes")
+		}
+	},
+}
+
+var documentsUserName string
+var documentsFile string
+var documentsApply bool
+var documentsCreateValues bool
+
+func init() {
+	manageCmd.AddCommand(documentsCmd)
+	documentsCmd.AddCommand(documentsExportCsvCmd)
+	documentsCmd.AddCommand(documentsImportCsvCmd)
+	documentsCmd.PersistentFlags().StringVarP(&documentsUserName, "user", "u", "",
+		"Name of the user whose documents to export or import")
+	documentsCmd.PersistentFlags().StringVarP(&documentsFile, "file", "f", "",
+		"File to export to or import from. Export prints to stdout if empty")
+	documentsImportCsvCmd.Flags().BoolVar(&documentsApply, "apply", false,
+		"Save the changes. Otherwise the file is only validated")
+	documentsImportCsvCmd.Flags().BoolVar(&documentsCreateValues, "create-values", false,
+		"Create metadata values that do not exist")
+}
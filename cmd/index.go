@@ -19,52 +19,15 @@
 package cmd
 
 import (
-	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"tryffel.net/go/virtualpaper/config"
-	"tryffel.net/go/virtualpaper/services/search"
-	"tryffel.net/go/virtualpaper/storage"
 )
 
+// indexCmd indexes documents that are missing from or outdated in search index. It is the same as
+// 'manage search reindex'.
 var indexCmd = &cobra.Command{
 	Use:   "index",
 	Short: "Index documents to meilisearch for full-text-search",
 	Run: func(cmd *cobra.Command, args []string) {
-		initConfig()
-		db, err := storage.NewDatabase(config.C.Database)
-		if err != nil {
-			logrus.Fatalf("Connect to database: %v", err)
-		}
-		defer db.Close()
-
-		engine, err := search.NewEngine(db, &config.C.Meilisearch)
-		if err != nil {
-			logrus.Fatalf("Init search engine: %v", err)
-		}
-
-		users, err := db.UserStore.GetUsers()
-		if err != nil {
-			logrus.Errorf("get users: %v", err)
-			return
-		}
-
-		paging := storage.Paging{
-			Offset: 0,
-			Limit:  200,
-		}
-
-		for _, v := range *users {
-			docs, err := db.DocumentStore.GetNeedsIndexing(v.Id, paging)
-			if err != nil {
-				logrus.Warningf("get indexing documents got user: %v", err)
-				continue
-			}
-
-			logrus.Infof("index %d documents for useer %s", len(*docs), v.Name)
-			err = engine.IndexDocuments(docs, v.Id)
-			if err != nil {
-				logrus.Warningf("index documents: %v", err)
-			}
-		}
+		verifySearchIndex(false)
 	},
 }
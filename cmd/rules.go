@@ -0,0 +1,163 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"tryffel.net/go/virtualpaper/config"
+	"tryffel.net/go/virtualpaper/services"
+	"tryffel.net/go/virtualpaper/storage"
+)
+
+var rulesCmd = &cobra.Command{
+	Use:   "rules",
+	Short: "Export and import processing rules",
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+var rulesExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export user's processing rules to file or stdout",
+	Run: func(cmd *cobra.Command, args []string) {
+		db, userId := initRulesCmd()
+		defer config.DeinitLogging()
+		defer db.Close()
+
+		format := rulesFormat(rulesFile)
+		service := services.NewRuleService(db, nil, nil)
+		export, err := service.ExportRules(context.Background(), userId)
+		if err != nil {
+			logrus.Fatalf("export rules: %v", err)
+		}
+		data, err := services.MarshalRuleExport(export, format)
+		if err != nil {
+			logrus.Fatalf("serialize rules: %v", err)
+		}
+		if rulesFile == "" {
+			fmt.Println(string(data))
+			return
+		}
+		err = os.WriteFile(rulesFile, data, 0600)
+		if err != nil {
+			logrus.Fatalf("write file: %v", err)
+		}
+		logrus.Infof("Exported %d rules to %s", len(export.Rules), rulesFile)
+	},
+}
+
+var rulesImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import processing rules from file for user",
+	Long: "Import processing rules from file. Metadata keys and values that do not exist are created. " +
+		"Existing rules with same name are handled according to --conflict: skip, replace or duplicate.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if rulesFile == "" {
+			logrus.Fatalf("file is required")
+		}
+		db, userId := initRulesCmd()
+		defer config.DeinitLogging()
+		defer db.Close()
+
+		data, err := os.ReadFile(rulesFile)
+		if err != nil {
+			logrus.Fatalf("read file: %v", err)
+		}
+		export, err := services.UnmarshalRuleExport(data, rulesFormat(rulesFile))
+		if err != nil {
+			logrus.Fatalf("parse rules: %v", err)
+		}
+		service := services.NewRuleService(db, nil, nil)
+		status, err := service.ImportRules(context.Background(), userId, export,
+			services.RuleImportConflict(rulesConflict))
+		if err != nil {
+			logrus.Fatalf("import rules: %v", err)
+		}
+		for _, v := range status.Rules {
+			fmt.Printf("%s: %s (id: %d)\n", v.Status, v.Name, v.RuleId)
+		}
+		fmt.Printf("Created: %d, replaced: %d, skipped: %d\n", status.Created, status.Replaced, status.Skipped)
+		fmt.Printf("Created metadata keys: %d, values: %d\n", status.CreatedKeys, status.CreatedValues)
+	},
+}
+
+var rulesUserName string
+var rulesFile string
+var rulesFileFormat string
+var rulesConflict string
+
+func initRulesCmd() (*storage.Database, int) {
+	return initUserCmd(rulesUserName)
+}
+
+// initUserCmd initializes config, logging and database for a command that operates on the given user.
+func initUserCmd(userName string) (*storage.Database, int) {
+	initConfig()
+	err := config.InitLogging()
+	if err != nil {
+		logrus.Fatalf("init log: %v", err)
+	}
+
+	if userName == "" {
+		logrus.Fatalf("user is required")
+	}
+	db, err := storage.NewDatabase(config.C.Database)
+	if err != nil {
+		logrus.Fatalf("Connect to database: %v", err)
+	}
+	user, err := db.UserStore.GetUserByName(userName)
+	if err != nil {
+		logrus.Fatalf("user not found: %v", err)
+	}
+	return db, user.Id
+}
+
+// rulesFormat returns the format from flag or from file extension.
+func rulesFormat(file string) string {
+	if rulesFileFormat != "" {
+		return rulesFileFormat
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		return services.RuleExportFormatYaml
+	}
+	return services.RuleExportFormatJson
+}
+
+func init() {
+	manageCmd.AddCommand(rulesCmd)
+	rulesCmd.AddCommand(rulesExportCmd)
+	rulesCmd.AddCommand(rulesImportCmd)
+	rulesCmd.PersistentFlags().StringVarP(&rulesUserName, "user", "u", "",
+		"Name of the user whose rules to export or import")
+	rulesCmd.PersistentFlags().StringVarP(&rulesFile, "file", "f", "",
+		"File to export to or import from. Export prints to stdout if empty")
+	rulesCmd.PersistentFlags().StringVar(&rulesFileFormat, "format", "",
+		"Format, either json or yaml. Defaults to file extension, or json")
+	rulesImportCmd.Flags().StringVar(&rulesConflict, "conflict", string(services.RuleImportSkip),
+		"What to do with existing rules with same name: skip, replace or duplicate")
+}
@@ -0,0 +1,132 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"tryffel.net/go/virtualpaper/config"
+	"tryffel.net/go/virtualpaper/services/search"
+	"tryffel.net/go/virtualpaper/storage"
+)
+
+var searchCmd = &cobra.Command{
+	Use:   "search",
+	Short: "Manage search index",
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+var searchVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Compare search index against database and report missing, stale and orphaned documents",
+	Run: func(cmd *cobra.Command, args []string) {
+		verifySearchIndex(true)
+	},
+}
+
+var searchReindexCmd = &cobra.Command{
+	Use:   "reindex",
+	Short: "Re-index missing and stale documents and delete orphaned documents from search index",
+	Run: func(cmd *cobra.Command, args []string) {
+		verifySearchIndex(searchDryRun)
+	},
+}
+
+var searchUserName string
+var searchDryRun bool
+var searchBatchSize int
+
+func verifySearchIndex(dryRun bool) {
+	initConfig()
+	err := config.InitLogging()
+	if err != nil {
+		logrus.Fatalf("init log: %v", err)
+		return
+	}
+	defer config.DeinitLogging()
+
+	db, err := storage.NewDatabase(config.C.Database)
+	if err != nil {
+		logrus.Fatalf("Connect to database: %v", err)
+	}
+	defer db.Close()
+
+	engine, err := search.NewEngine(db, &config.C.Meilisearch)
+	if err != nil {
+		logrus.Fatalf("Init search engine: %v", err)
+	}
+
+	opts := search.VerifyOptions{
+		DryRun:    dryRun,
+		BatchSize: searchBatchSize,
+		Progress: func(progress search.VerifyProgress) {
+			if progress.Total > 0 {
+				fmt.Printf("%s: %d / %d\n", progress.Stage, progress.Processed, progress.Total)
+			} else if progress.Stage != search.VerifyStageDone {
+				fmt.Printf("%s: %d\n", progress.Stage, progress.Processed)
+			}
+		},
+	}
+	if searchUserName != "" {
+		user, err := db.UserStore.GetUserByName(searchUserName)
+		if err != nil {
+			logrus.Fatalf("user not found: %v", err)
+		}
+		opts.UserId = user.Id
+	}
+
+	report, err := engine.VerifyIndex(context.Background(), opts)
+	if report != nil {
+		fmt.Printf("Documents in database: %d\n", report.Documents)
+		fmt.Printf("Documents in index: %d\n", report.Indexed)
+		printIds("Missing", report.Missing)
+		printIds("Stale", report.Stale)
+		printIds("Orphaned", report.Orphaned)
+		if !report.DryRun {
+			fmt.Printf("Re-indexed: %d, deleted: %d\n", report.Reindexed, report.Deleted)
+		}
+	}
+	if err != nil {
+		logrus.Fatalf("verify search index: %v", err)
+	}
+}
+
+func printIds(name string, ids []string) {
+	fmt.Printf("%s: %d\n", name, len(ids))
+	for _, v := range ids {
+		fmt.Printf("  %s\n", v)
+	}
+}
+
+func init() {
+	manageCmd.AddCommand(searchCmd)
+	searchCmd.AddCommand(searchVerifyCmd)
+	searchCmd.AddCommand(searchReindexCmd)
+	searchCmd.PersistentFlags().StringVarP(&searchUserName, "user", "u", "",
+		"Only verify documents of given user")
+	searchCmd.PersistentFlags().IntVar(&searchBatchSize, "batch-size", 200,
+		"Number of documents to handle at once")
+	searchReindexCmd.Flags().BoolVar(&searchDryRun, "dry-run", false,
+		"Only report changes, do not modify the index")
+}
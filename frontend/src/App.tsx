@@ -5,6 +5,8 @@ import TagIcon from "@mui/icons-material/Tag";
 import ConstructionIcon from "@mui/icons-material/Construction";
 import ArticleIcon from "@mui/icons-material/Article";
 import DeleteIcon from "@mui/icons-material/Delete";
+import CategoryIcon from "@mui/icons-material/Category";
+import GroupsIcon from "@mui/icons-material/Groups";
 
 import { Route } from "react-router-dom";
 
@@ -17,6 +19,8 @@ import { lightTheme, darkTheme } from "./theme";
 import Layout from "./layout/Layout";
 import MetadataKeys from "./resources/MetadataKeys";
 import Rules from "./resources/Rules";
+import DocumentTypes from "./resources/DocumentTypes";
+import MetadataVocabularies from "./resources/MetadataVocabularies";
 
 import { ProfileEdit } from "./resources/Preferences";
 import AdminView from "./resources/Admin";
@@ -55,6 +59,18 @@ const App = () => (
       icon={TagIcon}
     />
     <Resource name="metadata/values" options={{ label: "metadata values" }} />
+    <Resource
+      name="metadata/vocabularies"
+      options={{ label: "Vocabularies" }}
+      {...MetadataVocabularies}
+      icon={GroupsIcon}
+    />
+    <Resource
+      name="document-types"
+      options={{ label: "Document types" }}
+      {...DocumentTypes}
+      icon={CategoryIcon}
+    />
     <Resource
       name="processing/rules"
       options={{ label: "Processing" }}
@@ -274,6 +274,8 @@ export const dataProvider: DataProvider = {
       url = `${apiUrl}/metadata/keys/${params.id}/values?${stringify(query)}`;
     } else if (resource === "documents/edithistory" && params.id) {
       url = `${apiUrl}/documents/${params.id}/history?${stringify(query)}`;
+    } else if (resource === "documents/notes" && params.id) {
+      url = `${apiUrl}/documents/${params.id}/notes?${stringify(query)}`;
     } else if (resource === "documents/linked" && params.id) {
       url = `${apiUrl}/documents/${params.id}/linked-documents?${stringify(
         query
@@ -437,6 +439,69 @@ export const dataProvider: DataProvider = {
       data: { ...params.data, ...json },
     })),
 
+  subscribeMetadataVocabulary: (params: any) =>
+    httpClient(`${apiUrl}/metadata/vocabularies/${params.id}/subscription`, {
+      method: "POST",
+    }).then(({ json }) => ({
+      data: { ...json },
+    })),
+
+  unsubscribeMetadataVocabulary: (params: any) =>
+    httpClient(`${apiUrl}/metadata/vocabularies/${params.id}/subscription`, {
+      method: "DELETE",
+    }).then(({ json }) => ({
+      data: { ...json },
+    })),
+
+  importDocumentsCsv: (params: any) =>
+    httpClient(
+      `${apiUrl}/documents/csv?${stringify({
+        dry_run: params.dryRun ? 1 : 0,
+        create_values: params.createValues ? 1 : 0,
+      })}`,
+      {
+        method: "POST",
+        headers: new Headers({
+          Accept: "application/json",
+          "Content-Type": "text/csv",
+        }),
+        body: params.data,
+      }
+    ).then(({ json }) => ({
+      data: { ...json },
+    })),
+
+  addDocumentNote: (params: any) =>
+    httpClient(`${apiUrl}/documents/${params.id}/notes`, {
+      method: "POST",
+      body: JSON.stringify(params.data),
+    }).then(({ json }) => ({
+      data: { ...json },
+    })),
+
+  updateDocumentNote: (params: any) =>
+    httpClient(`${apiUrl}/documents/${params.id}/notes/${params.noteId}`, {
+      method: "PUT",
+      body: JSON.stringify(params.data),
+    }).then(({ json }) => ({
+      data: { ...json },
+    })),
+
+  deleteDocumentNote: (params: any) =>
+    httpClient(`${apiUrl}/documents/${params.id}/notes/${params.noteId}`, {
+      method: "DELETE",
+    }).then(() => ({
+      data: { id: params.noteId },
+    })),
+
+  updateInvoicePaid: (params: any) =>
+    httpClient(`${apiUrl}/documents/${params.id}/invoice/paid`, {
+      method: "PUT",
+      body: JSON.stringify(params.data),
+    }).then(({ json }) => ({
+      data: { ...json },
+    })),
+
   suggestSearch: (params: any) =>
     httpClient(`${apiUrl}/documents/search/suggest`, {
       method: "POST",
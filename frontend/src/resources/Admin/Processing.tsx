@@ -79,6 +79,11 @@ const steps = [
     name: "Detect language",
     description: "Detect the language of the document",
   },
+  {
+    id: "extract-fields",
+    name: "Invoice fields",
+    description: "Extract amount, IBAN, reference, VAT number and due date",
+  },
   {
     id: "rules",
     name: "User Rules",
@@ -89,6 +94,21 @@ const steps = [
     name: "Index",
     description: "Reindex document in full-text-search engine",
   },
+  {
+    id: "similarity",
+    name: "Similarity",
+    description: "Compute similarity signature for finding similar documents",
+  },
+  {
+    id: "duplicates",
+    name: "Duplicates",
+    description: "Detect near-duplicate documents",
+  },
+  {
+    id: "suggest-metadata",
+    name: "Suggest metadata",
+    description: "Suggest metadata learned from existing documents",
+  },
 ];
 //}
 
@@ -0,0 +1,35 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+import * as React from "react";
+import { Create, SimpleForm, TextInput } from "react-admin";
+import { DocumentTypeKeysInput } from "./Keys";
+
+export const DocumentTypeCreate = () => (
+  <Create title={<CreateTitle />} redirect="list">
+    <SimpleForm defaultValues={{ keys: [] }}>
+      <TextInput source="name" label="Name" />
+      <TextInput source="description" label="Description" fullWidth />
+      <DocumentTypeKeysInput />
+    </SimpleForm>
+  </Create>
+);
+
+const CreateTitle = () => {
+  return <span>Add document type</span>;
+};
@@ -0,0 +1,51 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+import * as React from "react";
+import {
+  ArrayInput,
+  BooleanInput,
+  FormDataConsumer,
+  ReferenceInput,
+  SelectInput,
+  SimpleFormIterator,
+} from "react-admin";
+import { MetadataValueInput } from "../Documents/Edit";
+
+// DocumentTypeKeysInput edits the metadata keys of the document type.
+export const DocumentTypeKeysInput = () => (
+  <ArrayInput source="keys" label={"Metadata keys"}>
+    <SimpleFormIterator inline disableReordering fullWidth>
+      <ReferenceInput label="Key" source="key_id" reference="metadata/keys">
+        <SelectInput optionText="key" />
+      </ReferenceInput>
+      <BooleanInput source="required" label="Required" />
+      <FormDataConsumer>
+        {({ scopedFormData, getSource }) =>
+          scopedFormData && scopedFormData.key_id ? (
+            <MetadataValueInput
+              source={getSource ? getSource("default_value_id") : ""}
+              record={scopedFormData}
+              label={"Default value"}
+            />
+          ) : null
+        }
+      </FormDataConsumer>
+    </SimpleFormIterator>
+  </ArrayInput>
+);
@@ -0,0 +1,52 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+import * as React from "react";
+import { List, Datagrid, ChipField, TextField, DateField } from "react-admin";
+
+import { useMediaQuery } from "@mui/material";
+import { EmptyResourcePage } from "../../components/primitives/EmptyPage";
+
+export const DocumentTypeList = () => {
+  const isSmall = useMediaQuery((theme: any) => theme.breakpoints.down("sm"));
+
+  return (
+    <List
+      title="Document types"
+      sort={{ field: "name", order: "ASC" }}
+      empty={<EmptyDocumentTypeList />}
+    >
+      <Datagrid rowClick="edit" bulkActionButtons={false}>
+        <ChipField source="name" label={"Name"} />
+        <TextField source="description" label={"Description"} />
+        {!isSmall ? (
+          <DateField source="created_at" label={"Created at"} />
+        ) : null}
+      </Datagrid>
+    </List>
+  );
+};
+
+const EmptyDocumentTypeList = () => {
+  return (
+    <EmptyResourcePage
+      title={"No document types"}
+      subTitle={"Do you want to add one?"}
+    />
+  );
+};
@@ -0,0 +1,180 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+import * as React from "react";
+import { Button, useDataProvider, useNotify, useRefresh } from "react-admin";
+import {
+  Checkbox,
+  Dialog,
+  DialogActions,
+  DialogContent,
+  DialogTitle,
+  FormControlLabel,
+  Typography,
+} from "@mui/material";
+import DownloadIcon from "@mui/icons-material/Download";
+import UploadIcon from "@mui/icons-material/Upload";
+import { downloadFile } from "./Thumbnail";
+import { config } from "../../env";
+
+// CsvExportButton downloads user's documents and their metadata as csv.
+export const CsvExportButton = () => {
+  const notify = useNotify();
+
+  const exportCsv = () => {
+    downloadFile(`${config.url}/documents/csv`)
+      .then((response) => {
+        if (!response.ok) {
+          throw new Error(response.statusText);
+        }
+        return response.blob();
+      })
+      .then((blob) => {
+        const link = document.createElement("a");
+        link.href = window.URL.createObjectURL(blob);
+        link.download = "documents.csv";
+        link.click();
+        window.URL.revokeObjectURL(link.href);
+      })
+      .catch((error) => {
+        notify(`Error: ${error.message}`, { type: "error" });
+      });
+  };
+
+  return (
+    <Button label="CSV" onClick={exportCsv}>
+      <DownloadIcon />
+    </Button>
+  );
+};
+
+// CsvImportButton validates the csv with a dry run before the changes can be applied.
+export const CsvImportButton = () => {
+  const [open, setOpen] = React.useState(false);
+  const [data, setData] = React.useState("");
+  const [createValues, setCreateValues] = React.useState(false);
+  const [status, setStatus] = React.useState<any>(null);
+  const [loading, setLoading] = React.useState(false);
+  const dataProvider = useDataProvider();
+  const notify = useNotify();
+  const refresh = useRefresh();
+
+  const close = () => {
+    setOpen(false);
+    setData("");
+    setStatus(null);
+  };
+
+  const selectFile = (e: React.ChangeEvent<HTMLInputElement>) => {
+    setStatus(null);
+    const file = e.target.files?.[0];
+    if (file) {
+      file.text().then(setData);
+    }
+  };
+
+  const runImport = (dryRun: boolean) => {
+    setLoading(true);
+    dataProvider
+      .importDocumentsCsv({ data, dryRun, createValues })
+      .then(({ data }: { data: any }) => {
+        setStatus(data);
+        if (data.applied) {
+          notify(`Updated ${data.changed} documents`, { type: "success" });
+          refresh();
+          close();
+        }
+      })
+      .catch((error: any) => {
+        notify(`Error: ${error.message}`, { type: "error" });
+      })
+      .finally(() => setLoading(false));
+  };
+
+  const valid =
+    status && status.dry_run && status.errors.length === 0 && status.changed;
+
+  return (
+    <>
+      <Button label="Import CSV" onClick={() => setOpen(true)}>
+        <UploadIcon />
+      </Button>
+      <Dialog open={open} onClose={close} scroll="paper" fullWidth>
+        <DialogTitle>Import documents csv</DialogTitle>
+        <DialogContent>
+          <Typography variant="body2" sx={{ mb: 2 }}>
+            Edit the exported csv and import it to update the documents. Only
+            column 'id' is required. Multiple values are separated with ';',
+            and ';' within a value is written as '\;'.
+          </Typography>
+          <input type="file" accept=".csv,text/csv" onChange={selectFile} />
+          <FormControlLabel
+            control={
+              <Checkbox
+                checked={createValues}
+                onChange={(e) => {
+                  setCreateValues(e.target.checked);
+                  setStatus(null);
+                }}
+              />
+            }
+            label="Create metadata values that do not exist"
+          />
+          {status ? <CsvImportStatus status={status} /> : null}
+        </DialogContent>
+        <DialogActions>
+          <Button label="Cancel" onClick={close} />
+          <Button
+            label="Validate"
+            onClick={() => runImport(true)}
+            disabled={!data || loading}
+          />
+          <Button
+            label="Apply"
+            onClick={() => runImport(false)}
+            disabled={!valid || loading}
+          />
+        </DialogActions>
+      </Dialog>
+    </>
+  );
+};
+
+const CsvImportStatus = (props: { status: any }) => {
+  const { status } = props;
+  return (
+    <>
+      <Typography variant="body2" sx={{ mt: 2 }}>
+        Rows: {status.rows}, changed: {status.changed}, unchanged:{" "}
+        {status.unchanged}, new metadata values: {status.created_values}
+      </Typography>
+      {status.errors.map((error: any) => (
+        <Typography variant="body2" color="error" key={error.line}>
+          Line {error.line}: {error.error}
+        </Typography>
+      ))}
+      {status.errors.length === 0
+        ? status.documents.map((doc: any) => (
+            <Typography variant="body2" key={doc.document_id}>
+              {doc.name}: {doc.changes.join(", ")}
+            </Typography>
+          ))
+        : null}
+    </>
+  );
+};
@@ -32,6 +32,7 @@ import {
   FormDataConsumer,
   AutocompleteInput,
   useGetManyReference,
+  useGetOne,
   Labeled,
   Toolbar,
   SaveButton,
@@ -43,7 +44,7 @@ import {
 } from "react-admin";
 
 import { MarkdownInput } from "../../components/Markdown";
-import { Typography, Grid, Box, useMediaQuery } from "@mui/material";
+import { Typography, Grid, Box, Chip, useMediaQuery } from "@mui/material";
 import LinkIcon from "@mui/icons-material/Link";
 import ArticleIcon from "@mui/icons-material/Article";
 import get from "lodash/get";
@@ -51,6 +52,8 @@ import { IndexingStatusField } from "./IndexingStatus";
 import { EmbedFile } from "./Thumbnail";
 import { EditLinkedDocuments } from "./EditLinkedDocuments";
 import { languages } from "../../languages";
+import { useFormContext, useWatch } from "react-hook-form";
+import { isTypedKey } from "../MetadataKeys/KeyTypeSelect";
 
 const EditToolBar = () => {
   return (
@@ -108,6 +111,20 @@ export const DocumentEdit = () => {
               <Box flex={1} mr={{ xs: 0, sm: "0.5em" }}>
                 <LanguageSelectInput source={"lang"} label={"language"} />
               </Box>
+              <Box flex={1} mr={{ xs: 0, sm: "0.5em" }}>
+                <ReferenceInput
+                  label="Document type"
+                  source="document_type_id"
+                  reference="document-types"
+                >
+                  <SelectInput
+                    optionText="name"
+                    emptyValue={0}
+                    format={(value: number) => value || ""}
+                    fullWidth
+                  />
+                </ReferenceInput>
+              </Box>
             </Box>
             <Box display={{ xs: "block", sm: "flex" }}>
               <MarkdownInput source="description" label="Description" />
@@ -141,6 +158,7 @@ export const DocumentEdit = () => {
                   </FormDataConsumer>
                 </SimpleFormIterator>
               </ArrayInput>
+              <MetadataSuggestionsInput />
             </Box>
             <Box display={{ xs: "block", sm: "block" }}>
               <Labeled label="Created at">
@@ -170,6 +188,11 @@ export const MetadataValueInput = (props: MetadataValueInputProps) => {
     // @ts-ignore
     keyId = get(props.record, "key_id");
   }
+  const { data: key } = useGetOne(
+    "metadata/keys",
+    { id: keyId },
+    { enabled: keyId !== 0 },
+  );
   const { data, isLoading, error } = useGetManyReference("metadata/values", {
     target: "id",
     id: keyId !== 0 ? keyId : -1,
@@ -184,6 +207,10 @@ export const MetadataValueInput = (props: MetadataValueInputProps) => {
     return null;
   }
 
+  if (isTypedKey(key?.type)) {
+    return <TypedMetadataValueInput {...props} type={key.type} />;
+  }
+
   if (isLoading) return <Loading />;
   if (error) return <Typography>Error {error.message}</Typography>;
   if (data) {
@@ -200,6 +227,32 @@ export const MetadataValueInput = (props: MetadataValueInputProps) => {
   }
 };
 
+const typedValueHints: { [key: string]: string } = {
+  free_text: "Any text",
+  number: "e.g. 1234.5",
+  money: "e.g. 123.45 EUR",
+  date: "e.g. 2024-05-01",
+  boolean: "true or false",
+};
+
+// TypedMetadataValueInput edits free-form value of a typed key. Value is sent as is, and server resolves the value id.
+const TypedMetadataValueInput = (
+  props: MetadataValueInputProps & { type: string },
+) => {
+  const { setValue } = useFormContext();
+  const { type, source, ...rest } = props;
+  const valueSource = source.replace(/value_id$/, "value");
+
+  return (
+    <TextInput
+      {...rest}
+      source={valueSource}
+      helperText={typedValueHints[type]}
+      onChange={() => setValue(source, 0)}
+    />
+  );
+};
+
 export const LanguageSelectInput = (props: any) => {
   const choices = Object.keys(languages).map((key) => {
     return {
@@ -245,6 +298,58 @@ const DocumentEditActions = (props: { open: any; setOpen: any }) => {
   );
 };
 
+type MetadataSuggestion = {
+  key_id: number;
+  key: string;
+  value_id: number;
+  value: string;
+  confidence: number;
+};
+
+// MetadataSuggestionsInput lists the suggested metadata of the document. Clicking a suggestion adds it to the metadata.
+const MetadataSuggestionsInput = () => {
+  const record = useRecordContext();
+  const { setValue } = useFormContext();
+  const metadata = useWatch({ name: "metadata" }) ?? [];
+  const suggestions: MetadataSuggestion[] = (
+    get(record, "metadata_suggestions") ?? []
+  ).filter(
+    (suggestion: MetadataSuggestion) =>
+      !metadata.some((m: any) => m.value_id === suggestion.value_id),
+  );
+  if (suggestions.length === 0) {
+    return null;
+  }
+
+  const addSuggestion = (suggestion: MetadataSuggestion) => {
+    setValue(
+      "metadata",
+      [
+        ...metadata,
+        { key_id: suggestion.key_id, value_id: suggestion.value_id },
+      ],
+      { shouldDirty: true },
+    );
+  };
+
+  return (
+    <Box sx={{ mb: 2 }}>
+      <Typography variant="body2">Suggested metadata</Typography>
+      {suggestions.map((suggestion) => (
+        <Chip
+          key={suggestion.value_id}
+          label={`${suggestion.key}: ${suggestion.value} (${Math.round(
+            suggestion.confidence * 100,
+          )}%)`}
+          onClick={() => addSuggestion(suggestion)}
+          size="small"
+          sx={{ mr: 0.5, mt: 0.5 }}
+        />
+      ))}
+    </Box>
+  );
+};
+
 const EditLinkedDocumentsButton = () => {
   const record = useRecordContext();
   const [open, setOpen] = React.useState(false);
@@ -47,6 +47,7 @@ import { Link } from "react-router-dom";
 import { DocumentCard } from "./DocumentCard";
 import { ShowDocumentsIndexing } from "../Dashboard";
 import { EmptyResourcePage } from "../../components/primitives/EmptyPage";
+import { CsvExportButton, CsvImportButton } from "./Csv";
 
 const DocumentPagination = () => (
   <Pagination rowsPerPageOptions={[10, 25, 50, 100]} />
@@ -58,10 +59,19 @@ const DocumentListActions = () => (
     <DocumentHelp />
     <SortButton
       label="Sort"
-      fields={["date", "name", "updated_at", "created_at"]}
+      fields={[
+        "date",
+        "name",
+        "updated_at",
+        "created_at",
+        "invoice_amount",
+        "invoice_due_date",
+      ]}
     />
     <CreateButton label={"Upload document"} />
     <ExportButton />
+    <CsvExportButton />
+    <CsvImportButton />
   </TopToolbar>
 );
 
@@ -186,6 +196,9 @@ const DocumentHelp = () => {
         <Typography>- key:value</Typography>
         <Typography>- author:doyle</Typography>
         <Typography>- (author:doyle OR author:christie)</Typography>
+        <Typography>- author:* (document has any author)</Typography>
+        <Typography>- author:doy* (author starts with 'doy')</Typography>
+        <Typography>- -author:doyle (author is not doyle)</Typography>
       </p>
       <p>
         <Typography>Date</Typography>
@@ -194,6 +207,23 @@ const DocumentHelp = () => {
         <Typography>- date:2015|2022 #(range between dates) </Typography>
         <Typography>- date:2015|today </Typography>
         <Typography>- date:2015-6-12|2022-8 </Typography>
+        <Typography>- date&gt;2022-03-01 (after the date) </Typography>
+        <Typography>- date&lt;=2022 (before or during the year) </Typography>
+      </p>
+      <p>
+        <Typography>Size</Typography>
+        <Typography>- size&gt;5mb</Typography>
+        <Typography>- size&lt;=500kb</Typography>
+      </p>
+      <p>
+        <Typography>Invoice</Typography>
+        <Typography>- invoice.amount&gt;100</Typography>
+        <Typography>- invoice.due&lt;2023-06 (due before June)</Typography>
+        <Typography>- invoice.due:2023-05|2023-06</Typography>
+        <Typography>- invoice.paid:no (not paid yet)</Typography>
+        <Typography>- invoice.paid&gt;=2023-06 (paid in June or later)</Typography>
+        <Typography>- invoice.iban:FI2112345600000785</Typography>
+        <Typography>- invoice.reference:RF18539007547034</Typography>
       </p>
       <p>
         <Typography>Sharing</Typography>
@@ -121,6 +121,10 @@ const ShowDocumentsEditHistoryItem = (props: { item: DocumentHistoryItem }) => {
       return (
         <DocumentHistoryRemoveMetadata pretty_time={timeString} item={item} />
       );
+    case "merge metadata":
+      return (
+        <DocumentHistoryMergeMetadata pretty_time={timeString} item={item} />
+      );
     case "delete":
       return <DocumentHistoryDelete pretty_time={timeString} item={item} />;
     case "restore":
@@ -134,6 +138,78 @@ const ShowDocumentsEditHistoryItem = (props: { item: DocumentHistoryItem }) => {
           item={item}
         />
       );
+    case "share":
+      return (
+        <DocumentHistoryValue
+          label="Shared"
+          pretty_time={timeString}
+          item={item}
+        />
+      );
+    case "link document":
+      return (
+        <DocumentHistoryValue
+          label="Linked document"
+          pretty_time={timeString}
+          item={item}
+        />
+      );
+    case "document type":
+      return (
+        <DocumentHistoryValue
+          label="Set document type"
+          pretty_time={timeString}
+          item={item}
+        />
+      );
+    case "add note":
+      return (
+        <DocumentHistoryValue
+          label="Added note"
+          pretty_time={timeString}
+          item={item}
+        />
+      );
+    case "edit note":
+      return (
+        <DocumentHistoryValue
+          label="Edited note"
+          pretty_time={timeString}
+          item={item}
+        />
+      );
+    case "remove note":
+      return (
+        <DocumentHistoryValue
+          label="Removed note"
+          pretty_time={timeString}
+          item={item}
+          value={item.old_value}
+        />
+      );
+    case "invoice paid":
+      return (
+        <DocumentHistoryValue
+          label={
+            item.new_value ? "Marked invoice paid" : "Marked invoice not paid"
+          }
+          pretty_time={timeString}
+          item={item}
+          value={
+            item.new_value
+              ? new Date(Number(item.new_value) * 1000).toLocaleDateString()
+              : ""
+          }
+        />
+      );
+    case "notification":
+      return (
+        <DocumentHistoryValue
+          label="Sent notification"
+          pretty_time={timeString}
+          item={item}
+        />
+      );
   }
 
   return (
@@ -280,6 +356,19 @@ const DocumentHistoryRemoveMetadata = (props: HistoryProps) => {
   );
 };
 
+const DocumentHistoryMergeMetadata = (props: HistoryProps) => {
+  return (
+    <Step key={`${props.item.id}`} expanded active completed>
+      <StepLabel icon={<TagIcon />}>Merged metadata</StepLabel>
+      <StepContent>
+        <ItemLabel {...props} />
+        <Typography variant="body1">From: {props.item.old_value}</Typography>
+        <Typography variant="body1">To: {props.item.new_value}</Typography>
+      </StepContent>
+    </Step>
+  );
+};
+
 const DocumentHistoryContent = (props: HistoryProps) => {
   const { item, pretty_time } = props;
   return (
@@ -325,6 +414,21 @@ const DocumentHistoryModifyLinkedDocuments = (props: HistoryProps) => {
   );
 };
 
+const DocumentHistoryValue = (
+  props: HistoryProps & { label: string; value?: string }
+) => {
+  const { item, label, value } = props;
+  return (
+    <Step key={`${item.id}`} expanded active completed>
+      <StepLabel icon={<FormatListBulletedIcon />}>{label}</StepLabel>
+      <StepContent>
+        <ItemLabel {...props} />
+        <Typography variant="body1">{value ?? item.new_value}</Typography>
+      </StepContent>
+    </Step>
+  );
+};
+
 const DocumentHistoryDelete = (props: HistoryProps) => {
   const { item } = props;
 
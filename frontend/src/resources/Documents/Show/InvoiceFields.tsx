@@ -0,0 +1,113 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+import React from "react";
+import {
+  Button,
+  LabeledClasses,
+  useDataProvider,
+  useNotify,
+  useRecordContext,
+  useRefresh,
+} from "react-admin";
+import { Typography } from "@mui/material";
+import List from "@mui/material/List";
+import ListItem from "@mui/material/ListItem";
+import ListItemText from "@mui/material/ListItemText";
+import get from "lodash/get";
+
+type InvoiceFields = {
+  iban: string;
+  reference: string;
+  amount: number | null;
+  currency: string;
+  vat_number: string;
+  due_date: number | null;
+  paid: boolean;
+  paid_date: number | null;
+};
+
+// InvoiceFieldList shows the fields that were extracted from the invoice, if any, and the paid state.
+export const InvoiceFieldList = () => {
+  const record = useRecordContext();
+  const dataProvider = useDataProvider();
+  const notify = useNotify();
+  const refresh = useRefresh();
+  const invoice: InvoiceFields | undefined = get(record, "invoice");
+  if (!record || !invoice) {
+    return null;
+  }
+
+  const fields = [
+    {
+      label: "Amount",
+      value:
+        invoice.amount !== null
+          ? `${invoice.amount.toFixed(2)} ${invoice.currency}`.trim()
+          : "",
+    },
+    {
+      label: "Due date",
+      value: invoice.due_date
+        ? new Date(invoice.due_date).toLocaleDateString()
+        : "",
+    },
+    { label: "IBAN", value: formatGroups(invoice.iban) },
+    { label: "Reference", value: formatGroups(invoice.reference) },
+    { label: "VAT number", value: invoice.vat_number },
+    {
+      label: "Paid",
+      value: invoice.paid_date
+        ? new Date(invoice.paid_date).toLocaleDateString()
+        : "",
+    },
+  ].filter((field) => field.value !== "");
+
+  if (fields.length === 0) {
+    return null;
+  }
+
+  const setPaid = (paid: boolean) => {
+    dataProvider
+      .updateInvoicePaid({ id: record.id, data: { paid } })
+      .then(refresh)
+      .catch((error: any) =>
+        notify(`Error: ${error.message}`, { type: "error" }),
+      );
+  };
+
+  return (
+    <>
+      <Typography className={LabeledClasses.label}>Invoice</Typography>
+      <List dense>
+        {fields.map((field) => (
+          <ListItem key={field.label}>
+            <ListItemText primary={field.value} secondary={field.label} />
+          </ListItem>
+        ))}
+      </List>
+      <Button
+        label={invoice.paid ? "Mark as not paid" : "Mark as paid"}
+        onClick={() => setPaid(!invoice.paid)}
+      />
+    </>
+  );
+};
+
+// formatGroups splits account and reference numbers to groups of four, e.g. 'FI21 1234 5600 0007 85'.
+const formatGroups = (value: string) => value.replace(/(.{4})(?=.)/g, "$1 ");
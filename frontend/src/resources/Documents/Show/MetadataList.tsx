@@ -19,6 +19,17 @@ type Metadata = {
   style: string;
 };
 
+type MissingMetadata = {
+  key_id: number;
+  key: string;
+};
+
+type MetadataSuggestion = {
+  key: string;
+  value: string;
+  confidence: number;
+};
+
 export const MetadataList = () => {
   const record = useRecordContext();
   if (!record) {
@@ -29,6 +40,9 @@ export const MetadataList = () => {
   if (!array) {
     return null;
   }
+  const missing: MissingMetadata[] = get(record, "missing_metadata") ?? [];
+  const suggestions: MetadataSuggestion[] =
+    get(record, "metadata_suggestions") ?? [];
 
   return (
     <>
@@ -38,6 +52,25 @@ export const MetadataList = () => {
           return <MetadataValue metadata={item} />;
         })}
       </List>
+      {missing.length > 0 && (
+        <Typography variant="body2" color="error">
+          Missing required metadata:{" "}
+          {missing.map((item) => item.key).join(", ")}
+        </Typography>
+      )}
+      {suggestions.length > 0 && (
+        <Typography variant="body2" color="text.secondary">
+          Suggested metadata:{" "}
+          {suggestions
+            .map(
+              (item) =>
+                `${item.key}: ${item.value} (${Math.round(
+                  item.confidence * 100,
+                )}%)`,
+            )
+            .join(", ")}
+        </Typography>
+      )}
     </>
   );
 };
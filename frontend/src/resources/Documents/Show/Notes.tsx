@@ -0,0 +1,225 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+
+import React from "react";
+import {
+  Button,
+  useDataProvider,
+  useGetManyReference,
+  useNotify,
+  useRecordContext,
+} from "react-admin";
+import {
+  IconButton,
+  List,
+  ListItem,
+  ListItemText,
+  ListSubheader,
+  Stack,
+  TextField,
+  Typography,
+} from "@mui/material";
+import AddCommentIcon from "@mui/icons-material/AddComment";
+import DeleteIcon from "@mui/icons-material/Delete";
+import EditIcon from "@mui/icons-material/Edit";
+import SaveIcon from "@mui/icons-material/Save";
+import CloseIcon from "@mui/icons-material/Close";
+import { PrettifyRelativeTime } from "../../../components/util";
+
+export type DocumentNote = {
+  id: number;
+  document_id: string;
+  user_id: number;
+  user_name: string;
+  content: string;
+  page: number;
+  position_x: number | null;
+  position_y: number | null;
+  created_at: number;
+  updated_at: number;
+  editable: boolean;
+  deletable: boolean;
+};
+
+export const DocumentNotes = () => {
+  const record = useRecordContext();
+  const dataProvider = useDataProvider();
+  const notify = useNotify();
+  const [content, setContent] = React.useState("");
+  const [page, setPage] = React.useState("");
+
+  const { data, isLoading, refetch } = useGetManyReference("documents/notes", {
+    target: "id",
+    id: record?.id,
+    sort: { field: "created_at", order: "ASC" },
+  });
+
+  if (!record || isLoading) {
+    return null;
+  }
+
+  const onError = (error: any) =>
+    notify(`Error: ${error.message}`, { type: "error" });
+
+  const addNote = () => {
+    dataProvider
+      .addDocumentNote({
+        id: record.id,
+        data: { content, page: page ? parseInt(page) : 0 },
+      })
+      .then(() => {
+        setContent("");
+        setPage("");
+        refetch();
+      })
+      .catch(onError);
+  };
+
+  return (
+    <List subheader={<ListSubheader>Notes</ListSubheader>} dense>
+      {data?.map((note: DocumentNote) => (
+        <DocumentNoteItem
+          key={note.id}
+          note={note}
+          refetch={refetch}
+          onError={onError}
+        />
+      ))}
+      <ListItem>
+        <Stack direction="column" spacing={1} sx={{ width: "100%" }}>
+          <TextField
+            label="Add note"
+            value={content}
+            onChange={(e) => setContent(e.target.value)}
+            multiline
+            size="small"
+            fullWidth
+          />
+          <Stack direction="row" spacing={1} alignItems="center">
+            <TextField
+              label="Page"
+              type="number"
+              value={page}
+              onChange={(e) => setPage(e.target.value)}
+              size="small"
+              inputProps={{ min: 1 }}
+              sx={{ width: 100 }}
+            />
+            <Button
+              label="Add"
+              onClick={addNote}
+              disabled={content.trim() === ""}
+            >
+              <AddCommentIcon />
+            </Button>
+          </Stack>
+        </Stack>
+      </ListItem>
+    </List>
+  );
+};
+
+const DocumentNoteItem = ({
+  note,
+  refetch,
+  onError,
+}: {
+  note: DocumentNote;
+  refetch: () => void;
+  onError: (error: any) => void;
+}) => {
+  const dataProvider = useDataProvider();
+  const [editing, setEditing] = React.useState(false);
+  const [content, setContent] = React.useState(note.content);
+
+  const params = { id: note.document_id, noteId: note.id };
+
+  const save = () => {
+    dataProvider
+      .updateDocumentNote({
+        ...params,
+        data: {
+          content,
+          page: note.page,
+          position_x: note.position_x,
+          position_y: note.position_y,
+        },
+      })
+      .then(() => {
+        setEditing(false);
+        refetch();
+      })
+      .catch(onError);
+  };
+
+  const remove = () => {
+    dataProvider.deleteDocumentNote(params).then(refetch).catch(onError);
+  };
+
+  if (editing) {
+    return (
+      <ListItem>
+        <TextField
+          value={content}
+          onChange={(e) => setContent(e.target.value)}
+          multiline
+          size="small"
+          fullWidth
+        />
+        <IconButton onClick={save} disabled={content.trim() === ""}>
+          <SaveIcon />
+        </IconButton>
+        <IconButton onClick={() => setEditing(false)}>
+          <CloseIcon />
+        </IconButton>
+      </ListItem>
+    );
+  }
+
+  return (
+    <ListItem
+      secondaryAction={
+        <>
+          {note.editable && (
+            <IconButton onClick={() => setEditing(true)}>
+              <EditIcon />
+            </IconButton>
+          )}
+          {note.deletable && (
+            <IconButton onClick={remove}>
+              <DeleteIcon />
+            </IconButton>
+          )}
+        </>
+      }
+    >
+      <ListItemText
+        primary={note.content}
+        primaryTypographyProps={{ sx: { whiteSpace: "pre-wrap" } }}
+        secondary={
+          <Typography variant="caption">
+            {note.user_name}
+            {note.page ? `, page ${note.page}` : ""},{" "}
+            {PrettifyRelativeTime(note.created_at)}
+          </Typography>
+        }
+      />
+    </ListItem>
+  );
+};
@@ -57,6 +57,8 @@ import {
 import { IndexingStatusField } from "../IndexingStatus";
 import { MarkdownField } from "../../../components/Markdown";
 import { ShowDocumentsEditHistory } from "./DocumentHistory";
+import { DocumentNotes } from "./Notes";
+import { InvoiceFieldList } from "./InvoiceFields";
 import { LinkedDocumentList } from "./LinkedDocuments";
 import {
   DocumentBasicInfo,
@@ -259,12 +261,18 @@ const DocumentGeneralTabLarge = () => {
           <Grid item xs={12} sm={8}>
             <MetadataList />
           </Grid>
+          <Grid item xs={12} sm={8}>
+            <InvoiceFieldList />
+          </Grid>
           <Grid item xs={12} sm={12}>
             <LinkedDocumentList />
           </Grid>
           <Grid item xs={12} sm={12}>
             <ListSharedUsers />
           </Grid>
+          <Grid item xs={12} sm={12}>
+            <DocumentNotes />
+          </Grid>
           <Grid item xs={4} sm={2} md={4} alignContent={"flex-end"}>
             <Labeled label={"File size"}>
               <TextField source={"pretty_size"} />
@@ -306,12 +314,18 @@ const DocumentGeneralTablSmall = () => {
       <Grid item xs={12}>
         <MetadataList />
       </Grid>
+      <Grid item xs={12}>
+        <InvoiceFieldList />
+      </Grid>
       <Grid item xs={12}>
         <LinkedDocumentList />
       </Grid>
       <Grid item xs={12}>
         <ListSharedUsers />
       </Grid>
+      <Grid item xs={12}>
+        <DocumentNotes />
+      </Grid>
       <Grid item xs={4} sm={3}>
         <Labeled label={"File size"}>
           <TextField source={"pretty_size"} />
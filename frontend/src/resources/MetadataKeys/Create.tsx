@@ -19,6 +19,8 @@
 import * as React from "react";
 import { Create, SimpleForm, TextInput } from "react-admin";
 import { IconSelect } from "./IconSelect";
+import { MetadataKeyTypeSelect } from "./KeyTypeSelect";
+import { AutoApplyThresholdInput } from "./Edit";
 
 export const MetadataKeyCreate = () => (
   <Create
@@ -28,9 +30,18 @@ export const MetadataKeyCreate = () => (
       style: JSON.stringify(data.style),
     })}
   >
-    <SimpleForm defaultValues={{ icon: "Label", style: "{}" }}>
+    <SimpleForm
+      defaultValues={{
+        icon: "Label",
+        style: "{}",
+        type: "text",
+        auto_apply_threshold: 0,
+      }}
+    >
       <TextInput source="key" label="Name" />
       <TextInput source="comment" label="Description" />
+      <MetadataKeyTypeSelect />
+      <AutoApplyThresholdInput />
       <IconSelect source={"icon"} displayIcon={true} />
     </SimpleForm>
   </Create>
@@ -32,6 +32,7 @@ import {
   useRecordContext,
   FunctionField,
   FormDataConsumer,
+  NumberInput,
 } from "react-admin";
 
 import { MarkdownInput } from "../../components/Markdown";
@@ -43,6 +44,7 @@ import { useState } from "react";
 import get from "lodash/get";
 import { IconByName, iconExists } from "../../components/icons";
 import { IconColorSelect, IconSelect } from "./IconSelect";
+import { MetadataKeyTypeSelect } from "./KeyTypeSelect";
 
 export const MetadataKeyEdit = () => {
   const { record } = useEditController();
@@ -100,6 +102,8 @@ export const MetadataKeyEdit = () => {
         </Labeled>
         <IconSelect source={"icon"} displayIcon={true} />
         <IconColorSelect />
+        <MetadataKeyTypeSelect />
+        <AutoApplyThresholdInput />
 
         <ReferenceManyField
           label="Values"
@@ -135,6 +139,17 @@ export const MetadataKeyEdit = () => {
   );
 };
 
+export const AutoApplyThresholdInput = () => (
+  <NumberInput
+    source="auto_apply_threshold"
+    label="Auto-apply suggestions"
+    helperText="Add suggested values with at least this confidence (0-1) automatically. 0 disables."
+    min={0}
+    max={1}
+    step={0.05}
+  />
+);
+
 const EditTitle = () => {
   const record = useRecordContext();
   const name = get(record, "key") ?? "";
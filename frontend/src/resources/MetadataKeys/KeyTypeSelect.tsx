@@ -0,0 +1,41 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2022  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+import * as React from "react";
+import { SelectInput } from "react-admin";
+
+export const metadataKeyTypes = [
+  { id: "text", name: "Predefined values" },
+  { id: "free_text", name: "Free text" },
+  { id: "number", name: "Number" },
+  { id: "money", name: "Money, e.g. 123.45 EUR" },
+  { id: "date", name: "Date" },
+  { id: "boolean", name: "Yes / no" },
+];
+
+export const isTypedKey = (type?: string) => !!type && type !== "text";
+
+export const MetadataKeyTypeSelect = () => (
+  <SelectInput
+    source="type"
+    label="Value type"
+    choices={metadataKeyTypes}
+    defaultValue="text"
+    helperText="Typed keys accept any value of the type and can be compared in search, e.g. amount>100. Type cannot be changed once the key has values."
+  />
+);
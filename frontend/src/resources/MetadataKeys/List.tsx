@@ -25,6 +25,7 @@ import {
   TextField,
   DateField,
   NumberField,
+  BooleanField,
 } from "react-admin";
 
 import { useMediaQuery } from "@mui/material";
@@ -47,6 +48,7 @@ export const MetadataKeyList = () => {
         ) : null}
         <NumberField source="metadata_values_count" label={"Total keys"} />
         <NumberField source="documents_count" label={"Total documents"} />
+        <BooleanField source="shared" label={"Shared"} />
       </Datagrid>
     </List>
   );
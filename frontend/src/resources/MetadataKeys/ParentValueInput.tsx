@@ -0,0 +1,49 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2022  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+import * as React from "react";
+import { AutocompleteInput, useGetManyReference } from "react-admin";
+
+// ParentValueInput selects the parent value of a metadata value. Value itself cannot be its parent.
+export const ParentValueInput = (props: {
+  keyId: number;
+  valueId?: number;
+}) => {
+  const { keyId, valueId } = props;
+  const { data, isLoading } = useGetManyReference("metadata/values", {
+    target: "id",
+    id: keyId,
+    pagination: { page: 1, perPage: 500 },
+    sort: { field: "value", order: "ASC" },
+  });
+
+  const choices = (data ?? []).filter((value: any) => value.id !== valueId);
+  return (
+    <AutocompleteInput
+      source="parent_id"
+      label="Parent value"
+      choices={choices}
+      optionText="value"
+      isLoading={isLoading}
+      parse={(value: any) => (value ? value : 0)}
+      format={(value: any) => (value ? value : null)}
+      helperText="Searching for the parent value also matches documents with this value"
+      fullWidth
+    />
+  );
+};
@@ -39,6 +39,7 @@ import {
 } from "@mui/material";
 
 import { Create, Cancel } from "@mui/icons-material";
+import { ParentValueInput } from "./ParentValueInput";
 
 const MetadataValueCreateButton = (record: any) => {
   const [showDialog, setShowDialog] = useState(false);
@@ -90,6 +91,7 @@ const MetadataValueCreateButton = (record: any) => {
           {" "}
           <DialogContent>
             <TextInput source="value" validate={required()} fullWidth />
+            <ParentValueInput keyId={record.id} />
             <BooleanInput label="Automatic matching" source="match_documents" />
             <RadioButtonGroupInput
               source="match_type"
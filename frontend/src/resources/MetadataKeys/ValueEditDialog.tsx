@@ -43,6 +43,7 @@ import {
 import DeleteIcon from "@mui/icons-material/Delete";
 import { Link } from "react-router-dom";
 import { EscapeWhitespace } from "../../components/util";
+import { ParentValueInput } from "./ParentValueInput";
 
 export interface MetadataValueUpdateDialogProps {
   showDialog: boolean;
@@ -171,6 +172,7 @@ const MetadataValueUpdateDialog = (props: MetadataValueUpdateDialogProps) => {
           <DialogContent>
             <TextInput source="value" validate={required()} fullWidth />
             <TextInput label="description" source="comment" fullWidth />
+            <ParentValueInput keyId={keyId} valueId={record?.id as number} />
             <BooleanInput label="Automatic matching" source="match_documents" />
             <RadioButtonGroupInput
               source="match_type"
@@ -0,0 +1,64 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+import * as React from "react";
+import {
+  ArrayInput,
+  BooleanInput,
+  ReferenceInput,
+  SelectInput,
+  SimpleFormIterator,
+  TextInput,
+} from "react-admin";
+
+// MetadataVocabularyInputs edits the fields of the vocabulary.
+export const MetadataVocabularyInputs = () => (
+  <>
+    <TextInput source="name" label="Name" />
+    <TextInput source="description" label="Description" fullWidth />
+    <BooleanInput
+      source="editable"
+      label="Subscribers can add and edit values"
+    />
+    <ArrayInput source="keys" label={"Metadata keys"}>
+      <SimpleFormIterator inline disableReordering>
+        <ReferenceInput label="Key" source="key_id" reference="metadata/keys">
+          <SelectInput optionText="key" />
+        </ReferenceInput>
+      </SimpleFormIterator>
+    </ArrayInput>
+    <ArrayInput source="members" label={"Users allowed to subscribe"}>
+      <SimpleFormIterator inline disableReordering>
+        <ReferenceInput label="User" source="user_id" reference="users">
+          <SelectInput optionText="name" />
+        </ReferenceInput>
+      </SimpleFormIterator>
+    </ArrayInput>
+  </>
+);
+
+// transformVocabulary converts the form keys to the key ids expected by the api.
+export const transformVocabulary = (data: any) => ({
+  ...data,
+  key_ids: (data.keys ?? [])
+    .filter((key: any) => key && key.key_id)
+    .map((key: any) => key.key_id),
+  member_ids: (data.members ?? [])
+    .filter((member: any) => member && member.user_id)
+    .map((member: any) => member.user_id),
+});
@@ -0,0 +1,105 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+import * as React from "react";
+import {
+  List,
+  Datagrid,
+  ChipField,
+  TextField,
+  BooleanField,
+  NumberField,
+  Button,
+  useDataProvider,
+  useNotify,
+  useRecordContext,
+  useRefresh,
+} from "react-admin";
+
+import { useMediaQuery } from "@mui/material";
+import { EmptyResourcePage } from "../../components/primitives/EmptyPage";
+
+export const MetadataVocabularyList = () => {
+  const isSmall = useMediaQuery((theme: any) => theme.breakpoints.down("sm"));
+
+  return (
+    <List
+      title="Metadata vocabularies"
+      sort={{ field: "name", order: "ASC" }}
+      empty={<EmptyVocabularyList />}
+    >
+      <Datagrid
+        rowClick={(id, resource, record) => (record.owned ? "edit" : false)}
+        bulkActionButtons={false}
+      >
+        <ChipField source="name" label={"Name"} />
+        <TextField source="description" label={"Description"} />
+        {!isSmall ? <TextField source="owner_name" label={"Owner"} /> : null}
+        {!isSmall ? (
+          <BooleanField source="editable" label={"Editable"} />
+        ) : null}
+        <NumberField source="subscribers" label={"Subscribers"} />
+        <SubscribeButton />
+      </Datagrid>
+    </List>
+  );
+};
+
+const SubscribeButton = () => {
+  const record = useRecordContext();
+  const dataProvider = useDataProvider();
+  const notify = useNotify();
+  const refresh = useRefresh();
+
+  if (!record || record.owned) {
+    return null;
+  }
+
+  const toggle = (e: React.MouseEvent) => {
+    e.stopPropagation();
+    const request = record.subscribed
+      ? dataProvider.unsubscribeMetadataVocabulary({ id: record.id })
+      : dataProvider.subscribeMetadataVocabulary({ id: record.id });
+    request
+      .then(() => {
+        notify(record.subscribed ? "Unsubscribed" : "Subscribed", {
+          type: "success",
+        });
+        refresh();
+      })
+      .catch((error: any) => {
+        notify(`Error: ${error.message}`, { type: "error" });
+      });
+  };
+
+  return (
+    <Button
+      label={record.subscribed ? "Unsubscribe" : "Subscribe"}
+      onClick={toggle}
+    />
+  );
+};
+
+const EmptyVocabularyList = () => {
+  return (
+    <EmptyResourcePage
+      title={"No metadata vocabularies"}
+      subTitle={"Do you want to share your metadata keys?"}
+    />
+  );
+};
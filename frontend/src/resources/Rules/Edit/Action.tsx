@@ -24,7 +24,15 @@ export const ActionTypeInput = (props: any) => {
         { id: "description_append", name: "Append description" },
         { id: "metadata_add", name: "Add metadata" },
         { id: "metadata_remove", name: "Remove metadata" },
+        { id: "metadata_extract", name: "Extract metadata (regex)" },
         { id: "date_set", name: "Set date" },
+        { id: "date_metadata_set", name: "Set detected date as metadata" },
+        { id: "lang_set", name: "Set language" },
+        { id: "document_type_set", name: "Set document type" },
+        { id: "share", name: "Share with user" },
+        { id: "link_latest", name: "Link to latest document with metadata" },
+        { id: "trash", name: "Move to trash bin" },
+        { id: "notify", name: "Send notification" },
       ]}
       required
     />
@@ -53,7 +61,16 @@ const ScopedActionEdit = (props: { scopedFormData: any; getSource: any }) => {
   const { scopedFormData, getSource } = props;
 
   const hasAction = !!scopedFormData.action;
-  const editingMetadata = scopedFormData?.action?.startsWith("metadata");
+  const settingDateMetadata = scopedFormData?.action === "date_metadata_set";
+  const extractingMetadata =
+    scopedFormData?.action === "metadata_extract" || settingDateMetadata;
+  const editingMetadata =
+    !extractingMetadata &&
+    (scopedFormData?.action?.startsWith("metadata") ||
+      scopedFormData?.action === "link_latest");
+  const hasValue = hasAction && scopedFormData?.action !== "trash";
+  const sharing = scopedFormData?.action === "share";
+  const settingDocumentType = scopedFormData?.action === "document_type_set";
 
   return (
     <Grid
@@ -101,9 +118,56 @@ const ScopedActionEdit = (props: { scopedFormData: any; getSource: any }) => {
             />
           </Grid>
           <Grid item xs={12} sm={12} md={6} lg={6}>
-            {hasAction && !editingMetadata && (
+            {hasValue && !editingMetadata && !settingDocumentType && (
               <Grid item sm={12}>
-                <TextInput label="Value" source={getSource("value")} />
+                <TextInput
+                  label={
+                    settingDateMetadata
+                      ? "Date role"
+                      : extractingMetadata
+                      ? "Regex"
+                      : "Value"
+                  }
+                  source={getSource("value")}
+                  helperText={
+                    sharing
+                      ? '{"user_id": 2, "permissions": {"read": true, "write": false, "delete": false}}'
+                      : settingDateMetadata
+                      ? "document or due"
+                      : undefined
+                  }
+                />
+              </Grid>
+            )}
+            {settingDocumentType && (
+              <Grid item sm={12}>
+                <ReferenceInput
+                  label="Document type"
+                  source={getSource("value")}
+                  record={scopedFormData}
+                  reference="document-types"
+                  fullWidth
+                >
+                  <SelectInput
+                    optionText="name"
+                    format={(value: string) => (value ? Number(value) : "")}
+                    parse={(value: number) => (value ? String(value) : "")}
+                    fullWidth
+                  />
+                </ReferenceInput>
+              </Grid>
+            )}
+            {extractingMetadata && (
+              <Grid item sm={12}>
+                <ReferenceInput
+                  label="Key"
+                  source={getSource("metadata.key_id")}
+                  record={scopedFormData}
+                  reference="metadata/keys"
+                  fullWidth
+                >
+                  <SelectInput optionText="key" fullWidth />
+                </ReferenceInput>
               </Grid>
             )}
             {hasAction && editingMetadata && (
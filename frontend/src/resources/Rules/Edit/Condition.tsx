@@ -32,12 +32,34 @@ export const ConditionTypeInput = (props: any) => {
         { id: "date_is", name: " Date is" },
         { id: "date_after", name: " Date is after" },
         { id: "date_before", name: " Date is before" },
+        { id: "date_detect", name: " Date is found (document or due date)" },
 
         { id: "metadata_has_key", name: " Metadata contains" },
         { id: "metadata_has_key_value", name: " Metadata contains key-value" },
         { id: "metadata_count", name: " Metadata count equals" },
         { id: "metadata_count_less_than", name: " Metadata count less than" },
         { id: "metadata_count_more_than", name: " Metadata count more than" },
+
+        { id: "filename_is", name: " Filename is" },
+        { id: "filename_starts", name: " Filename starts" },
+        { id: "filename_contains", name: " Filename contains" },
+
+        { id: "mimetype_is", name: " File type is" },
+        { id: "mimetype_starts", name: " File type starts" },
+
+        { id: "lang_is", name: " Language is" },
+
+        { id: "size_less_than", name: " File size less than (e.g. 5 MB)" },
+        { id: "size_more_than", name: " File size more than (e.g. 5 MB)" },
+
+        { id: "page_count", name: " Page count equals" },
+        { id: "page_count_less_than", name: " Page count less than" },
+        { id: "page_count_more_than", name: " Page count more than" },
+
+        { id: "created_older_than", name: " Uploaded before (e.g. 7y, 6m, 30d)" },
+        { id: "created_newer_than", name: " Uploaded within (e.g. 7y, 6m, 30d)" },
+
+        { id: "expression", name: " Expression" },
       ]}
       required
     />
@@ -109,12 +131,23 @@ export const ConditionEdit = () => {
                         record={scopedFormData}
                         fullWidth
                         resettable
+                        multiline={
+                          scopedFormData.condition_type === "expression"
+                        }
+                        helperText={
+                          scopedFormData.condition_type === "expression"
+                            ? 'E.g. count(["invoice", "due date"], fuzzy(doc.content, #)) >= 2 && quarter(doc.date) == 4'
+                            : scopedFormData.condition_type === "date_detect"
+                            ? "Date role: document or due. Empty value finds the document date"
+                            : undefined
+                        }
                       />
                     </Box>
                   ) : null}
                   {scopedFormData &&
                   scopedFormData.condition_type &&
-                  scopedFormData.condition_type.startsWith("date") ? (
+                  scopedFormData.condition_type.startsWith("date") &&
+                  scopedFormData.condition_type !== "date_detect" ? (
                     <Box flex={2} mr={{ xs: 0, sm: "0.5em" }}>
                       <TextInput
                         label="Date format"
@@ -21,7 +21,9 @@ import {
   ArrayInput,
   BooleanInput,
   DateField,
+  CheckboxGroupInput,
   Edit,
+  FormDataConsumer,
   RadioButtonGroupInput,
   SimpleForm,
   TextInput,
@@ -63,6 +65,23 @@ export const RuleEdit = () => {
             <Box flex={1}>
               <MarkdownInput source="description" />
               <MatchTypeSelectInput source="mode" />
+              <TriggersInput source="triggers" />
+              <FormDataConsumer>
+                {({ formData }) =>
+                  formData.triggers?.includes("schedule") && (
+                    <TextInput
+                      source="schedule"
+                      label="Schedule (cron)"
+                      helperText="E.g. '0 3 * * *' runs the rule every night at 3:00"
+                    />
+                  )
+                }
+              </FormDataConsumer>
+              <BooleanInput
+                label="Stop processing"
+                source="stop_processing"
+                helperText="Do not run the rest of the rules when this rule matches"
+              />
               <Typography variant="h5">Rule Conditions</Typography>
               <ArrayInput
                 source="conditions"
@@ -119,3 +138,20 @@ const MatchTypeSelectInput = (props: SourceProps) => {
     />
   );
 };
+
+const TriggersInput = (props: SourceProps) => {
+  const { source } = props;
+  return (
+    <CheckboxGroupInput
+      label="Run rule on"
+      source={source}
+      choices={[
+        { id: "upload", name: "Upload" },
+        { id: "edit", name: "Edit" },
+        { id: "metadata", name: "Metadata change" },
+        { id: "share", name: "Sharing change" },
+        { id: "schedule", name: "Schedule" },
+      ]}
+    />
+  );
+};
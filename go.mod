@@ -7,6 +7,7 @@ require (
 	github.com/Masterminds/squirrel v1.5.4
 	github.com/asaskevich/govalidator v0.0.0-20230301143203-a9d515a09cc2
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
+	github.com/expr-lang/expr v1.16.9
 	github.com/hashicorp/go-uuid v1.0.3
 	github.com/jmoiron/sqlx v1.3.5
 	github.com/labstack/echo/v4 v4.11.1
@@ -27,6 +28,7 @@ require (
 	golang.org/x/time v0.3.0
 	gopkg.in/h2non/baloo.v3 v3.1.0
 	gopkg.in/h2non/gentleman.v2 v2.0.5
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -74,5 +76,4 @@ require (
 	google.golang.org/protobuf v1.31.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20200227125254-8fa46927fb4f // indirect
 	gopkg.in/ini.v1 v1.67.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -35,6 +35,7 @@ func closeDb(db *storage.Database, t *testing.T) {
 }
 
 var dbMetadataTables = []string{
+	"metadata_vocabularies",
 	"documents",
 	"metadata_values",
 	"metadata_keys",
@@ -47,6 +48,8 @@ var dbProcessingRuleTables = []string{
 }
 
 var dbDocumentTables = []string{
+	"document_rule_traces",
+	"document_notes",
 	"user_shared_documents",
 	"document_view_history",
 	"document_history",
@@ -59,6 +62,11 @@ var dbPasswordResetTables = []string{
 	"password_reset_tokens",
 }
 
+var dbSearchSettingsTables = []string{
+	"search_synonyms",
+	"search_stop_words",
+}
+
 func clearDbMetadataTables(t *testing.T, db *storage.Database) {
 	for _, v := range dbMetadataTables {
 		db.Engine().MustExec(fmt.Sprintf("DELETE FROM %s WHERE 1=1", v))
@@ -83,6 +91,12 @@ func clearPasswordResetTables(t *testing.T, db *storage.Database) {
 	}
 }
 
+func clearSearchSettingsTables(t *testing.T, db *storage.Database) {
+	for _, v := range dbSearchSettingsTables {
+		db.Engine().MustExec(fmt.Sprintf("DELETE FROM %s WHERE 1=1", v))
+	}
+}
+
 func clearTestUsersTables(t *testing.T, db *storage.Database) {
 	users, err := db.UserStore.GetUsers()
 	if err != nil {
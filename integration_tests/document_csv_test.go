@@ -0,0 +1,196 @@
+package integrationtest
+
+import (
+	"encoding/csv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"tryffel.net/go/virtualpaper/models"
+	"tryffel.net/go/virtualpaper/services"
+)
+
+type DocumentCsvSuite struct {
+	ApiTestSuite
+	keys   map[string]*models.MetadataKey
+	values map[string]map[string]*models.MetadataValue
+}
+
+func TestDocumentCsv(t *testing.T) {
+	suite.Run(t, new(DocumentCsvSuite))
+}
+
+func (suite *DocumentCsvSuite) SetupTest() {
+	suite.Init()
+	clearDbMetadataTables(suite.T(), suite.db)
+	clearDbDocumentTables(suite.T(), suite.db)
+	suite.keys, suite.values = initMetadataKeyValues(suite.T(), suite.userHttp)
+
+	err := insertTestDocuments(suite.T(), suite.db)
+	if err != nil {
+		suite.T().Errorf("insert test documents: %v", err)
+		suite.T().Fail()
+	}
+}
+
+func (suite *DocumentCsvSuite) TestExportCsv() {
+	doc := getDocument(suite.T(), suite.userHttp, testDocumentX86.Id, 200)
+	doc.Metadata = []models.Metadata{
+		{KeyId: suite.keys["author"].Id, ValueId: suite.values["author"]["doyle"].Id},
+		{KeyId: suite.keys["author"].Id, ValueId: suite.values["author"]["darwin"].Id},
+	}
+	updateDocument(suite.T(), suite.userHttp, doc, 200)
+
+	rows := exportDocumentsCsv(suite.T(), suite.userHttp)
+	if !assert.True(suite.T(), len(rows) > 1) {
+		return
+	}
+	assert.Equal(suite.T(), []string{"id", "name", "date", "filename", "author", "category", "test"}, rows[0])
+	found := false
+	for _, row := range rows[1:] {
+		assert.NotEqual(suite.T(), testDocumentTransistorCountAdminUser.Id, row[0], "other user's document")
+		if row[0] == testDocumentX86.Id {
+			found = true
+			assert.Equal(suite.T(), testDocumentX86.Name, row[1])
+			assert.Equal(suite.T(), "darwin; doyle", row[4])
+			assert.Equal(suite.T(), "", row[5])
+		}
+	}
+	assert.True(suite.T(), found, "document exported")
+}
+
+func (suite *DocumentCsvSuite) TestCsvValueSeparator() {
+	// api does not accept separators in values, but extracted values may have them
+	key, err := suite.db.MetadataStore.GetKey(suite.keys["author"].Id)
+	if !assert.NoError(suite.T(), err) {
+		return
+	}
+	value := &models.MetadataValue{UserId: key.UserId, KeyId: key.Id, Value: `smith; jones\`,
+		MatchType: models.MetadataMatchExact}
+	if !assert.NoError(suite.T(), suite.db.MetadataStore.CreateValue(value)) {
+		return
+	}
+	doc := getDocument(suite.T(), suite.userHttp, testDocumentX86.Id, 200)
+	doc.Metadata = []models.Metadata{
+		{KeyId: suite.keys["author"].Id, ValueId: suite.values["author"]["doyle"].Id},
+		{KeyId: suite.keys["author"].Id, ValueId: value.Id},
+	}
+	updateDocument(suite.T(), suite.userHttp, doc, 200)
+
+	rows := exportDocumentsCsv(suite.T(), suite.userHttp)
+	data := strings.Builder{}
+	for _, row := range rows {
+		if row[0] == testDocumentX86.Id {
+			assert.Equal(suite.T(), `doyle; smith\; jones\\`, row[4])
+		}
+		if row[0] == "id" || row[0] == testDocumentX86.Id {
+			writer := csv.NewWriter(&data)
+			_ = writer.Write(row)
+			writer.Flush()
+		}
+	}
+
+	status := importDocumentsCsv(suite.T(), suite.userHttp, data.String(), false, false, 200)
+	assert.Len(suite.T(), status.Errors, 0)
+	assert.Equal(suite.T(), 0, status.Changed, "exported values are imported unchanged")
+}
+
+func (suite *DocumentCsvSuite) TestImportCsv() {
+	data := "id,name,author,category\n" +
+		testDocumentX86.Id + ",x86 renamed,doyle; darwin,invoice\n" +
+		testDocumentX86Intel.Id + "," + testDocumentX86Intel.Name + ",,\n"
+
+	status := importDocumentsCsv(suite.T(), suite.userHttp, data, true, false, 200)
+	assert.False(suite.T(), status.Applied)
+	assert.Equal(suite.T(), 2, status.Rows)
+	assert.Equal(suite.T(), 1, status.Changed)
+	assert.Equal(suite.T(), 1, status.Unchanged)
+	assert.Len(suite.T(), status.Errors, 0)
+	doc := getDocument(suite.T(), suite.userHttp, testDocumentX86.Id, 200)
+	assert.Equal(suite.T(), testDocumentX86.Name, doc.Name, "dry run does not change document")
+
+	status = importDocumentsCsv(suite.T(), suite.userHttp, data, false, false, 200)
+	assert.True(suite.T(), status.Applied)
+	doc = getDocument(suite.T(), suite.userHttp, testDocumentX86.Id, 200)
+	assert.Equal(suite.T(), "x86 renamed", doc.Name)
+	assertDocumentMetadataMatches(suite.T(), doc, []*models.MetadataValue{
+		suite.values["author"]["doyle"], suite.values["author"]["darwin"], suite.values["category"]["invoice"],
+	})
+
+	history := getDocumentHistory(suite.T(), suite.userHttp, testDocumentX86.Id, 200)
+	actions := map[string]int{}
+	for _, v := range *history {
+		actions[v.Action]++
+	}
+	assert.Equal(suite.T(), 1, actions[models.DocumentHistoryActionRename])
+	assert.Equal(suite.T(), 3, actions[models.DocumentHistoryActionMetadataAdd])
+}
+
+func (suite *DocumentCsvSuite) TestImportCsvErrors() {
+	importDocumentsCsv(suite.T(), suite.userHttp, "name\nfoo\n", false, false, 400)
+	importDocumentsCsv(suite.T(), suite.userHttp, "id,unknown key\n"+testDocumentX86.Id+",foo\n", false, false, 400)
+	importDocumentsCsv(suite.T(), suite.userHttp, "id,name\n"+strings.Repeat("x", 10*1024*1024), false, false, 413)
+
+	data := "id,name,date,author\n" +
+		testDocumentX86.Id + ",x86 renamed,2023-02-01,tolkien\n" +
+		testDocumentJupiterMoons.Id + ",,2023-02-01,\n" +
+		testDocumentYear1962.Id + ",1962,01.02.2023,\n" +
+		testDocumentTransistorCountAdminUser.Id + ",transistors,2023-02-01,\n"
+	status := importDocumentsCsv(suite.T(), suite.userHttp, data, false, false, 200)
+	assert.False(suite.T(), status.Applied)
+	if assert.Len(suite.T(), status.Errors, 4) {
+		assert.Equal(suite.T(), 2, status.Errors[0].Line)
+		assert.Contains(suite.T(), status.Errors[0].Error, "tolkien")
+	}
+	doc := getDocument(suite.T(), suite.userHttp, testDocumentX86.Id, 200)
+	assert.Equal(suite.T(), testDocumentX86.Name, doc.Name, "nothing is saved on errors")
+
+	// unknown values can be created
+	data = "id,author\n" + testDocumentX86.Id + ",tolkien\n"
+	status = importDocumentsCsv(suite.T(), suite.userHttp, data, false, true, 200)
+	assert.True(suite.T(), status.Applied)
+	assert.Equal(suite.T(), 1, status.CreatedValues)
+	doc = getDocument(suite.T(), suite.userHttp, testDocumentX86.Id, 200)
+	if assert.Len(suite.T(), doc.Metadata, 1) {
+		assert.Equal(suite.T(), "tolkien", doc.Metadata[0].Value)
+	}
+}
+
+func exportDocumentsCsv(t *testing.T, client *httpClient) [][]string {
+	var rows [][]string
+	client.Get("/api/v1/documents/csv").req.Expect(t).Status(200).
+		AssertFunc(func(r *http.Response, w *http.Request) error {
+			data, err := io.ReadAll(r.Body)
+			if err != nil {
+				return err
+			}
+			rows, err = csv.NewReader(strings.NewReader(string(data))).ReadAll()
+			if err != nil {
+				t.Errorf("parse csv: %v", err)
+			}
+			return nil
+		}).Done()
+	return rows
+}
+
+func importDocumentsCsv(t *testing.T, client *httpClient, data string, dryRun, createValues bool, wantHttpStatus int) *services.DocumentCsvImportStatus {
+	flag := func(b bool) string {
+		if b {
+			return "1"
+		}
+		return "0"
+	}
+	req := client.Post("/api/v1/documents/csv").
+		SetQueryParam("dry_run", flag(dryRun)).
+		SetQueryParam("create_values", flag(createValues))
+	req.req.SetHeader("Content-Type", "text/csv").BodyString(data)
+	status := &services.DocumentCsvImportStatus{}
+	if wantHttpStatus == 200 {
+		req.Expect(t).Json(t, status).e.Status(200).Done()
+		return status
+	}
+	req.req.Expect(t).Status(wantHttpStatus).Done()
+	return nil
+}
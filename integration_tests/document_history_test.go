@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 	"tryffel.net/go/virtualpaper/models"
+	"tryffel.net/go/virtualpaper/models/aggregates"
 )
 
 func TestDocumentHistory(t *testing.T) {
@@ -152,3 +153,44 @@ func (suite *DocumentHistoryTestSuite) TestChangeMetadata() {
 	assert.Equal(suite.T(), (*history)[4].OldValue, "")
 	assert.Equal(suite.T(), (*history)[4].NewValue, fmt.Sprintf(`{"key_id":%d,"value_id":%d}`, key2.Id, value3.Id))
 }
+
+func (suite *DocumentHistoryTestSuite) TestInvoicePaid() {
+	docId := testDocumentX86.Id
+	paidDate := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	updateInvoicePaid(suite.T(), suite.adminHttp, docId, &aggregates.DocumentInvoicePaidRequest{Paid: true}, 404)
+
+	doc := updateInvoicePaid(suite.T(), suite.userHttp, docId,
+		&aggregates.DocumentInvoicePaidRequest{Paid: true, PaidDate: paidDate.UnixMilli()}, 200)
+	assert.True(suite.T(), doc.Invoice.Paid)
+	assert.EqualValues(suite.T(), models.MidnightForDate(paidDate).UnixMilli(), doc.Invoice.PaidDate)
+
+	// updating document does not reset paid date
+	doc.Name = "paid invoice"
+	updateDocument(suite.T(), suite.userHttp, doc, 200)
+	doc = getDocument(suite.T(), suite.userHttp, docId, 200)
+	assert.True(suite.T(), doc.Invoice.Paid)
+
+	history := getDocumentHistory(suite.T(), suite.userHttp, docId, 200)
+	assert.Len(suite.T(), *history, 3)
+	assert.Equal(suite.T(), models.DocumentHistoryActionInvoicePaid, (*history)[1].Action)
+	assert.Equal(suite.T(), "", (*history)[1].OldValue)
+	assert.Equal(suite.T(), fmt.Sprintf("%d", models.MidnightForDate(paidDate).Unix()), (*history)[1].NewValue)
+
+	doc = updateInvoicePaid(suite.T(), suite.userHttp, docId, &aggregates.DocumentInvoicePaidRequest{Paid: false}, 200)
+	assert.False(suite.T(), doc.Invoice.Paid)
+	assert.Nil(suite.T(), doc.Invoice.PaidDate)
+	history = getDocumentHistory(suite.T(), suite.userHttp, docId, 200)
+	assert.Len(suite.T(), *history, 4)
+	assert.Equal(suite.T(), "", (*history)[3].NewValue)
+}
+
+func updateInvoicePaid(t *testing.T, client *httpClient, docId string, input *aggregates.DocumentInvoicePaidRequest, wantHttpStatus int) *aggregates.Document {
+	dto := &aggregates.Document{}
+	req := client.Put(fmt.Sprintf("/api/v1/documents/%s/invoice/paid", docId)).Json(t, input)
+	if wantHttpStatus == 200 {
+		req.ExpectName(t, "update invoice paid", false).Json(t, dto).e.Status(200).Done()
+	} else {
+		req.ExpectName(t, "update invoice paid", false).e.Status(wantHttpStatus).Done()
+	}
+	return dto
+}
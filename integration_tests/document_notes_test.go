@@ -0,0 +1,153 @@
+package integrationtest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"strconv"
+	"testing"
+	"tryffel.net/go/virtualpaper/api"
+	"tryffel.net/go/virtualpaper/models"
+	"tryffel.net/go/virtualpaper/models/aggregates"
+)
+
+type DocumentNoteSuite struct {
+	ApiTestSuite
+	users map[string]models.User
+}
+
+func TestDocumentNotes(t *testing.T) {
+	suite.Run(t, new(DocumentNoteSuite))
+}
+
+func (suite *DocumentNoteSuite) SetupTest() {
+	suite.Init()
+	clearDbDocumentTables(suite.T(), suite.db)
+	err := insertTestDocuments(suite.T(), suite.db)
+	if err != nil {
+		suite.T().Errorf("insert test documents: %v", err)
+		suite.T().Fail()
+	}
+
+	users, err := suite.db.UserStore.GetUsers()
+	if err != nil {
+		suite.T().Error("get users from db", err)
+	} else {
+		suite.users = map[string]models.User{}
+		for _, v := range *users {
+			suite.users[v.Name] = v
+		}
+	}
+}
+
+func (suite *DocumentNoteSuite) TestAddNote() {
+	docId := testDocumentX86.Id
+	addDocumentNote(suite.T(), suite.userHttp, docId, &api.DocumentNoteRequest{Content: " "}, 400)
+	x := 0.5
+	addDocumentNote(suite.T(), suite.userHttp, docId, &api.DocumentNoteRequest{Content: "note", PositionX: &x}, 400)
+	addDocumentNote(suite.T(), suite.adminHttp, docId, &api.DocumentNoteRequest{Content: "note"}, 404)
+
+	y := 0.25
+	note := addDocumentNote(suite.T(), suite.userHttp, docId, &api.DocumentNoteRequest{
+		Content: "check the totals", Page: 2, PositionX: &x, PositionY: &y}, 200)
+	assert.Equal(suite.T(), "check the totals", note.Content)
+	assert.Equal(suite.T(), "user", note.UserName)
+	assert.Equal(suite.T(), models.IntId(2), note.Page)
+	assert.True(suite.T(), note.Editable)
+	assert.True(suite.T(), note.Deletable)
+
+	notes := getDocumentNotes(suite.T(), suite.userHttp, docId, 200)
+	assert.Len(suite.T(), *notes, 1)
+	getDocumentNotes(suite.T(), suite.adminHttp, docId, 404)
+
+	history := getDocumentHistory(suite.T(), suite.userHttp, docId, 200)
+	last := (*history)[len(*history)-1]
+	assert.Equal(suite.T(), models.DocumentHistoryActionNoteAdd, last.Action)
+	assert.Equal(suite.T(), "check the totals", last.NewValue)
+}
+
+func (suite *DocumentNoteSuite) TestUpdateNote() {
+	docId := testDocumentX86.Id
+	note := addDocumentNote(suite.T(), suite.userHttp, docId, &api.DocumentNoteRequest{Content: "first"}, 200)
+	updateDocumentNote(suite.T(), suite.userHttp, docId, note.Id, &api.DocumentNoteRequest{Content: ""}, 400)
+	updateDocumentNote(suite.T(), suite.userHttp, docId, note.Id, &api.DocumentNoteRequest{Content: "second"}, 200)
+	updateDocumentNote(suite.T(), suite.userHttp, docId, note.Id+1000, &api.DocumentNoteRequest{Content: "second"}, 404)
+
+	notes := getDocumentNotes(suite.T(), suite.userHttp, docId, 200)
+	assert.Equal(suite.T(), "second", (*notes)[0].Content)
+
+	history := getDocumentHistory(suite.T(), suite.userHttp, docId, 200)
+	last := (*history)[len(*history)-1]
+	assert.Equal(suite.T(), models.DocumentHistoryActionNoteEdit, last.Action)
+	assert.Equal(suite.T(), "first", last.OldValue)
+	assert.Equal(suite.T(), "second", last.NewValue)
+
+	deleteDocumentNote(suite.T(), suite.userHttp, docId, note.Id, 200)
+	notes = getDocumentNotes(suite.T(), suite.userHttp, docId, 200)
+	assert.Len(suite.T(), *notes, 0)
+	history = getDocumentHistory(suite.T(), suite.userHttp, docId, 200)
+	last = (*history)[len(*history)-1]
+	assert.Equal(suite.T(), models.DocumentHistoryActionNoteRemove, last.Action)
+	assert.Equal(suite.T(), "second", last.OldValue)
+}
+
+func (suite *DocumentNoteSuite) TestSharedDocumentNotes() {
+	docId := testDocumentX86.Id
+	ownerNote := addDocumentNote(suite.T(), suite.userHttp, docId, &api.DocumentNoteRequest{Content: "owner"}, 200)
+
+	request := &aggregates.DocumentUpdateSharingRequest{Users: []aggregates.UserPermissions{
+		{UserId: suite.users["admin"].Id, Permissions: models.Permissions{Read: true}},
+		{UserId: suite.users["tester"].Id, Permissions: models.Permissions{Read: true, Write: true}},
+	}}
+	updateDocumentSharing(suite.T(), suite.userHttp, docId, request, 200)
+
+	// read-only share can list notes but not add them
+	notes := getDocumentNotes(suite.T(), suite.adminHttp, docId, 200)
+	assert.Len(suite.T(), *notes, 1)
+	assert.False(suite.T(), (*notes)[0].Editable)
+	assert.False(suite.T(), (*notes)[0].Deletable)
+	addDocumentNote(suite.T(), suite.adminHttp, docId, &api.DocumentNoteRequest{Content: "admin"}, 404)
+
+	testerNote := addDocumentNote(suite.T(), suite.testerHttp, docId, &api.DocumentNoteRequest{Content: "tester"}, 200)
+	updateDocumentNote(suite.T(), suite.testerHttp, docId, ownerNote.Id, &api.DocumentNoteRequest{Content: "edited"}, 403)
+	deleteDocumentNote(suite.T(), suite.testerHttp, docId, ownerNote.Id, 403)
+	updateDocumentNote(suite.T(), suite.userHttp, docId, testerNote.Id, &api.DocumentNoteRequest{Content: "edited"}, 403)
+
+	notes = getDocumentNotes(suite.T(), suite.userHttp, docId, 200)
+	assert.Len(suite.T(), *notes, 2)
+	deleteDocumentNote(suite.T(), suite.userHttp, docId, testerNote.Id, 200)
+	notes = getDocumentNotes(suite.T(), suite.testerHttp, docId, 200)
+	assert.Len(suite.T(), *notes, 1)
+}
+
+func getDocumentNotes(t *testing.T, client *httpClient, docId string, wantHttpStatus int) *[]models.DocumentNote {
+	dto := &[]models.DocumentNote{}
+	req := client.Get("/api/v1/documents/" + docId + "/notes").Expect(t)
+	if wantHttpStatus == 200 {
+		req.Json(t, dto).e.Status(200).Done()
+		return dto
+	}
+	req.e.Status(wantHttpStatus).Done()
+	return nil
+}
+
+func addDocumentNote(t *testing.T, client *httpClient, docId string, dto *api.DocumentNoteRequest, wantHttpStatus int) *models.DocumentNote {
+	req := client.Post("/api/v1/documents/"+docId+"/notes").Json(t, dto)
+	body := &models.DocumentNote{}
+	if wantHttpStatus == 200 {
+		req.Expect(t).Json(t, body).e.Status(200).Done()
+		assert.True(t, body.Id > 0, "id must be > 0")
+		return body
+	}
+	req.req.Expect(t).Status(wantHttpStatus).Done()
+	return nil
+}
+
+func updateDocumentNote(t *testing.T, client *httpClient, docId string, noteId int, dto *api.DocumentNoteRequest, wantHttpStatus int) {
+	req := client.Put("/api/v1/documents/"+docId+"/notes/"+strconv.Itoa(noteId)).Json(t, dto)
+	req.req.Expect(t).Status(wantHttpStatus).Done()
+}
+
+func deleteDocumentNote(t *testing.T, client *httpClient, docId string, noteId int, wantHttpStatus int) {
+	req := client.Delete("/api/v1/documents/" + docId + "/notes/" + strconv.Itoa(noteId))
+	req.Expect(t).e.Status(wantHttpStatus).Done()
+}
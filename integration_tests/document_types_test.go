@@ -0,0 +1,188 @@
+package integrationtest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"strconv"
+	"testing"
+	"tryffel.net/go/virtualpaper/api"
+	"tryffel.net/go/virtualpaper/models"
+	"tryffel.net/go/virtualpaper/models/aggregates"
+)
+
+type DocumentTypeSuite struct {
+	ApiTestSuite
+	keys   map[string]*models.MetadataKey
+	values map[string]map[string]*models.MetadataValue
+}
+
+func TestDocumentTypes(t *testing.T) {
+	suite.Run(t, new(DocumentTypeSuite))
+}
+
+func (suite *DocumentTypeSuite) SetupTest() {
+	suite.Init()
+	clearDbDocumentTables(suite.T(), suite.db)
+	_, err := suite.db.Exec("DELETE FROM document_types")
+	if err != nil {
+		suite.T().Errorf("clear document types: %v", err)
+	}
+	suite.keys, suite.values = initMetadataKeyValues(suite.T(), suite.userHttp)
+
+	err = insertTestDocuments(suite.T(), suite.db)
+	if err != nil {
+		suite.T().Errorf("insert test documents: %v", err)
+		suite.T().Fail()
+	}
+}
+
+func (suite *DocumentTypeSuite) TestCreateDocumentType() {
+	AddDocumentType(suite.T(), suite.userHttp, &api.DocumentTypeRequest{Name: ""}, 400)
+	AddDocumentType(suite.T(), suite.userHttp, &api.DocumentTypeRequest{
+		Name: "invoice",
+		Keys: []api.DocumentTypeKeyRequest{{KeyId: suite.keys["author"].Id, DefaultValueId: suite.values["category"]["paper"].Id}},
+	}, 400)
+	AddDocumentType(suite.T(), suite.adminHttp, &api.DocumentTypeRequest{
+		Name: "invoice",
+		Keys: []api.DocumentTypeKeyRequest{{KeyId: suite.keys["author"].Id}},
+	}, 400)
+
+	invoice := AddDocumentType(suite.T(), suite.userHttp, &api.DocumentTypeRequest{
+		Name: "invoice",
+		Keys: []api.DocumentTypeKeyRequest{
+			{KeyId: suite.keys["author"].Id, Required: true},
+			{KeyId: suite.keys["category"].Id, Required: true, DefaultValueId: suite.values["category"]["invoice"].Id},
+		},
+	}, 200)
+	if assert.Len(suite.T(), invoice.Keys, 2) {
+		assert.True(suite.T(), invoice.Keys[0].Required)
+		assert.Equal(suite.T(), models.IntId(suite.values["category"]["invoice"].Id), invoice.Keys[1].DefaultValueId)
+	}
+	AddDocumentType(suite.T(), suite.userHttp, &api.DocumentTypeRequest{Name: "invoice"}, 304)
+
+	GetDocumentType(suite.T(), suite.adminHttp, invoice.Id, 404)
+	types := GetDocumentTypes(suite.T(), suite.userHttp, 200)
+	assert.Len(suite.T(), types, 1)
+}
+
+func (suite *DocumentTypeSuite) TestSetDocumentType() {
+	invoice := AddDocumentType(suite.T(), suite.userHttp, &api.DocumentTypeRequest{
+		Name: "invoice",
+		Keys: []api.DocumentTypeKeyRequest{
+			{KeyId: suite.keys["author"].Id, Required: true},
+			{KeyId: suite.keys["category"].Id, Required: true, DefaultValueId: suite.values["category"]["invoice"].Id},
+		},
+	}, 200)
+
+	doc := getDocument(suite.T(), suite.userHttp, testDocumentX86.Id, 200)
+	doc.DocumentTypeId = invoice.Id
+	updateDocument(suite.T(), suite.userHttp, doc, 200)
+
+	doc = getDocument(suite.T(), suite.userHttp, testDocumentX86.Id, 200)
+	assert.Equal(suite.T(), invoice.Id, doc.DocumentTypeId)
+	assertDocumentMetadataMatches(suite.T(), doc, []*models.MetadataValue{suite.values["category"]["invoice"]})
+	if assert.Len(suite.T(), doc.MissingMetadata, 1) {
+		assert.Equal(suite.T(), suite.keys["author"].Id, doc.MissingMetadata[0].KeyId)
+	}
+	assertDocumentInArray(suite.T(), testDocumentX86.Id, getIncompleteDocuments(suite.T(), suite.userHttp, 200))
+
+	history := getDocumentHistory(suite.T(), suite.userHttp, testDocumentX86.Id, 200)
+	found := false
+	for _, v := range *history {
+		if v.Action == models.DocumentHistoryActionDocumentType {
+			found = true
+			assert.Equal(suite.T(), strconv.Itoa(invoice.Id), v.NewValue)
+		}
+	}
+	assert.True(suite.T(), found, "document type history")
+
+	doc.Metadata = append(doc.Metadata, models.Metadata{KeyId: suite.keys["author"].Id, ValueId: suite.values["author"]["doyle"].Id})
+	updateDocument(suite.T(), suite.userHttp, doc, 200)
+	doc = getDocument(suite.T(), suite.userHttp, testDocumentX86.Id, 200)
+	assert.Len(suite.T(), doc.MissingMetadata, 0)
+	assertDocumentNotInArray(suite.T(), testDocumentX86.Id, getIncompleteDocuments(suite.T(), suite.userHttp, 200))
+
+	// deleting type leaves the document without type
+	DeleteDocumentType(suite.T(), suite.adminHttp, invoice.Id, 404)
+	DeleteDocumentType(suite.T(), suite.userHttp, invoice.Id, 200)
+	doc = getDocument(suite.T(), suite.userHttp, testDocumentX86.Id, 200)
+	assert.Equal(suite.T(), 0, doc.DocumentTypeId)
+	assert.Len(suite.T(), doc.Metadata, 2)
+}
+
+func (suite *DocumentTypeSuite) TestSetOtherUsersDocumentType() {
+	contract := AddDocumentType(suite.T(), suite.adminHttp, &api.DocumentTypeRequest{Name: "contract"}, 200)
+	doc := getDocument(suite.T(), suite.userHttp, testDocumentX86.Id, 200)
+	doc.DocumentTypeId = contract.Id
+	updateDocument(suite.T(), suite.userHttp, doc, 404)
+}
+
+func (suite *DocumentTypeSuite) TestRuleSetOtherUsersDocumentType() {
+	clearDbProcessingRuleTables(suite.T(), suite.db)
+	contract := AddDocumentType(suite.T(), suite.adminHttp, &api.DocumentTypeRequest{Name: "contract"}, 200)
+	invoice := AddDocumentType(suite.T(), suite.userHttp, &api.DocumentTypeRequest{Name: "invoice"}, 200)
+	rule := &api.Rule{
+		Name:       "contracts",
+		Enabled:    true,
+		Mode:       "match_all",
+		Conditions: []api.RuleCondition{{ConditionType: "content_contains", Value: "contract", Enabled: true}},
+		Actions: []api.RuleAction{{
+			Action:  "document_type_set",
+			Enabled: true,
+			Value:   strconv.Itoa(contract.Id),
+		}},
+	}
+	addRule(suite.T(), suite.userHttp, rule, 400, "add rule with other user's document type")
+	rule.Actions[0].Value = strconv.Itoa(invoice.Id)
+	addRule(suite.T(), suite.userHttp, rule, 200, "add rule with own document type")
+}
+
+func AddDocumentType(t *testing.T, client *httpClient, dto *api.DocumentTypeRequest, wantHttpStatus int) *models.DocumentType {
+	req := client.Post("/api/v1/document-types").Json(t, dto)
+	body := &models.DocumentType{}
+	if wantHttpStatus == 200 {
+		req.Expect(t).Json(t, body).e.Status(200).Done()
+		assert.True(t, body.Id > 0, "id must be > 0")
+		return body
+	}
+	req.req.Expect(t).Status(wantHttpStatus).Done()
+	return nil
+}
+
+func GetDocumentType(t *testing.T, client *httpClient, typeId int, wantHttpStatus int) *models.DocumentType {
+	req := client.Get("/api/v1/document-types/" + strconv.Itoa(typeId))
+	body := &models.DocumentType{}
+	if wantHttpStatus == 200 {
+		req.Expect(t).Json(t, body).e.Status(200).Done()
+		return body
+	}
+	req.req.Expect(t).Status(wantHttpStatus).Done()
+	return nil
+}
+
+func GetDocumentTypes(t *testing.T, client *httpClient, wantHttpStatus int) []models.DocumentType {
+	req := client.Get("/api/v1/document-types")
+	body := []models.DocumentType{}
+	if wantHttpStatus == 200 {
+		req.Expect(t).Json(t, &body).e.Status(200).Done()
+		return body
+	}
+	req.req.Expect(t).Status(wantHttpStatus).Done()
+	return nil
+}
+
+func DeleteDocumentType(t *testing.T, client *httpClient, typeId int, wantHttpStatus int) {
+	req := client.Delete("/api/v1/document-types/" + strconv.Itoa(typeId))
+	req.Expect(t).e.Status(wantHttpStatus).Done()
+}
+
+func getIncompleteDocuments(t *testing.T, client *httpClient, wantHttpStatus int) *[]aggregates.Document {
+	dto := &[]aggregates.Document{}
+	req := client.Get("/api/v1/documents/incomplete").Expect(t)
+	if wantHttpStatus == 200 {
+		req.Json(t, dto).e.Status(200).Done()
+		return dto
+	}
+	req.e.Status(wantHttpStatus).Done()
+	return nil
+}
@@ -0,0 +1,109 @@
+package integrationtest
+
+import (
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"tryffel.net/go/virtualpaper/models"
+	"tryffel.net/go/virtualpaper/services/process"
+)
+
+func TestDuplicateDocuments(t *testing.T) {
+	suite.Run(t, new(DuplicateDocumentsTestSuite))
+}
+
+type DuplicateDocumentsTestSuite struct {
+	ApiTestSuite
+}
+
+func (suite *DuplicateDocumentsTestSuite) SetupTest() {
+	suite.Init()
+	clearDbDocumentTables(suite.T(), suite.db)
+	_ = insertTestDocuments(suite.T(), suite.db)
+
+	// mark x86 documents as duplicates of each other.
+	first := models.DocumentFingerprint{DocumentId: testDocumentX86.Id, ImageHash: sql.NullInt64{Int64: 0xff, Valid: true}}
+	second := models.DocumentFingerprint{DocumentId: testDocumentX86Intel.Id, ImageHash: sql.NullInt64{Int64: 0xfe, Valid: true}}
+	for _, v := range []models.DocumentFingerprint{first, second} {
+		err := suite.db.DocumentStore.SetFingerprint(testDocumentX86.UserId, v)
+		if err != nil {
+			suite.T().Errorf("set fingerprint: %v", err)
+		}
+	}
+	pair, ok := process.CompareFingerprints(first, second)
+	assert.True(suite.T(), ok, "documents are duplicates")
+	err := suite.db.DocumentStore.UpdateDuplicates(testDocumentX86.UserId, testDocumentX86.Id, []models.DocumentDuplicate{pair})
+	if err != nil {
+		suite.T().Errorf("update duplicates: %v", err)
+	}
+}
+
+func (suite *DuplicateDocumentsTestSuite) TestListDuplicates() {
+	clusters := getDuplicateClusters(suite.T(), suite.userHttp, 200)
+	if assert.Len(suite.T(), *clusters, 1) {
+		ids := []string{(*clusters)[0].Documents[0].DocumentId, (*clusters)[0].Documents[1].DocumentId}
+		assert.ElementsMatch(suite.T(), []string{testDocumentX86.Id, testDocumentX86Intel.Id}, ids)
+	}
+
+	doc := getDocument(suite.T(), suite.userHttp, testDocumentX86.Id, 200)
+	assert.Equal(suite.T(), []string{testDocumentX86Intel.Id}, doc.Duplicates)
+
+	clusters = getDuplicateClusters(suite.T(), suite.adminHttp, 200)
+	assert.Len(suite.T(), *clusters, 0, "other user's duplicates are not listed")
+}
+
+func (suite *DuplicateDocumentsTestSuite) TestDismissDuplicates() {
+	docs := []string{testDocumentX86.Id, testDocumentX86Intel.Id}
+	dismissDuplicates(suite.T(), suite.adminHttp, docs, 404)
+	dismissDuplicates(suite.T(), suite.userHttp, docs, 200)
+
+	clusters := getDuplicateClusters(suite.T(), suite.userHttp, 200)
+	assert.Len(suite.T(), *clusters, 0)
+	doc := getDocument(suite.T(), suite.userHttp, testDocumentX86.Id, 200)
+	assert.Len(suite.T(), doc.Duplicates, 0)
+}
+
+func (suite *DuplicateDocumentsTestSuite) TestMergeDuplicates() {
+	mergeDuplicates(suite.T(), suite.userHttp, testDocumentX86.Id, []string{testDocumentX86.Id}, 400)
+	mergeDuplicates(suite.T(), suite.userHttp, testDocumentX86.Id, []string{testDocumentTransistorCountAdminUser.Id}, 404)
+	mergeDuplicates(suite.T(), suite.userHttp, testDocumentX86.Id, []string{testDocumentX86Intel.Id}, 200)
+
+	duplicate := getDocument(suite.T(), suite.userHttp, testDocumentX86Intel.Id, 200)
+	assert.NotNil(suite.T(), duplicate.DeletedAt, "duplicate is moved to trash")
+
+	clusters := getDuplicateClusters(suite.T(), suite.userHttp, 200)
+	assert.Len(suite.T(), *clusters, 0)
+
+	history := getDocumentHistory(suite.T(), suite.userHttp, testDocumentX86.Id, 200)
+	found := false
+	for _, v := range *history {
+		if v.Action == models.DocumentHistoryActionMergeDuplicate && v.NewValue == testDocumentX86Intel.Id {
+			found = true
+		}
+	}
+	assert.True(suite.T(), found, "merge is recorded in history")
+}
+
+func getDuplicateClusters(t *testing.T, client *httpClient, wantHttpStatus int) *[]models.DuplicateCluster {
+	data := &[]models.DuplicateCluster{}
+	req := client.Get("/api/v1/documents/duplicates")
+	if wantHttpStatus == 200 {
+		req.ExpectName(t, "get duplicate documents", false).Json(t, data).e.Status(wantHttpStatus).Done()
+	} else {
+		req.ExpectName(t, "get duplicate documents", false).e.Status(wantHttpStatus).Done()
+	}
+	return data
+}
+
+func mergeDuplicates(t *testing.T, client *httpClient, targetId string, docIds []string, wantHttpStatus int) {
+	body := map[string]interface{}{"target_id": targetId, "document_ids": docIds}
+	client.Post("/api/v1/documents/duplicates/merge").Json(t, body).ExpectName(t, "merge duplicates", false).
+		e.Status(wantHttpStatus).Done()
+}
+
+func dismissDuplicates(t *testing.T, client *httpClient, docIds []string, wantHttpStatus int) {
+	body := map[string]interface{}{"document_ids": docIds}
+	client.Post("/api/v1/documents/duplicates/dismiss").Json(t, body).ExpectName(t, "dismiss duplicates", false).
+		e.Status(wantHttpStatus).Done()
+}
@@ -1,6 +1,7 @@
 package integrationtest
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"strconv"
 	"testing"
@@ -29,6 +30,23 @@ func AddMetadataKey(t *testing.T, client *httpClient, key string, comment string
 	return body
 }
 
+func AddTypedMetadataKey(t *testing.T, client *httpClient, key string, keyType models.MetadataKeyType, wantHttpStatus int) *models.MetadataKey {
+	dto := &api.MetadataKeyRequest{
+		Key:  key,
+		Type: string(keyType),
+	}
+
+	req := client.Post("/api/v1/metadata/keys").Json(t, dto)
+	body := &models.MetadataKey{}
+	if wantHttpStatus == 200 {
+		req.Expect(t).Json(t, body).e.Status(200).Done()
+		assert.Equal(t, keyType, body.Type, "key type")
+	} else {
+		req.req.Expect(t).Status(wantHttpStatus).Done()
+	}
+	return body
+}
+
 func GetMetadataKeys(t *testing.T, client *httpClient, wantHttpStatus int, editFunc func(request *httpRequest) *httpRequest) *[]models.MetadataKey {
 	req := client.Get("/api/v1/metadata/keys")
 	if editFunc != nil {
@@ -73,6 +91,7 @@ func AddMetadataValue(t *testing.T, client *httpClient, keyId int, value *models
 		MatchDocuments: value.MatchDocuments,
 		MatchType:      string(value.MatchType),
 		MatchFilter:    value.MatchFilter,
+		ParentId:       int(value.ParentId),
 	}
 
 	req := client.Post("/api/v1/metadata/keys/"+strconv.Itoa(keyId)+"/values").Json(t, dto)
@@ -87,3 +106,61 @@ func AddMetadataValue(t *testing.T, client *httpClient, keyId int, value *models
 	}
 	return nil
 }
+
+func UpdateMetadataValue(t *testing.T, client *httpClient, value *models.MetadataValue, wantHttpStatus int) {
+	dto := &api.MetadataValueRequest{
+		Value:          value.Value,
+		Comment:        value.Comment,
+		MatchDocuments: value.MatchDocuments,
+		MatchType:      string(value.MatchType),
+		MatchFilter:    value.MatchFilter,
+		ParentId:       int(value.ParentId),
+	}
+	req := client.Put(fmt.Sprintf("/api/v1/metadata/keys/%d/values/%d", value.KeyId, value.Id)).Json(t, dto)
+	req.req.Expect(t).Status(wantHttpStatus).Done()
+}
+
+func GetMetadataKeyValues(t *testing.T, client *httpClient, keyId int, wantHttpStatus int) []*models.MetadataValue {
+	req := client.Get("/api/v1/metadata/keys/"+strconv.Itoa(keyId)+"/values").Sort("value", "ASC")
+	dto := []*models.MetadataValue{}
+	if wantHttpStatus == 200 {
+		req.Expect(t).Json(t, &dto).e.Status(200).Done()
+	} else {
+		req.req.Expect(t).Status(wantHttpStatus).Done()
+	}
+	return dto
+}
+
+func DeleteMetadataValue(t *testing.T, client *httpClient, keyId, valueId int, wantHttpStatus int) {
+	req := client.Delete(fmt.Sprintf("/api/v1/metadata/keys/%d/values/%d", keyId, valueId))
+	req.Expect(t).e.Status(wantHttpStatus).Done()
+}
+
+func GetMetadataValueTree(t *testing.T, client *httpClient, keyId int, wantHttpStatus int) []*models.MetadataValue {
+	req := client.Get("/api/v1/metadata/keys/"+strconv.Itoa(keyId)+"/values").Sort("value", "ASC").SetQueryParam("tree", "1")
+	dto := []*models.MetadataValue{}
+	if wantHttpStatus == 200 {
+		req.Expect(t).Json(t, &dto).e.Status(200).Done()
+	} else {
+		req.req.Expect(t).Status(wantHttpStatus).Done()
+	}
+	return dto
+}
+
+func MergeMetadataValue(t *testing.T, client *httpClient, keyId, valueId, targetValueId int, wantHttpStatus int) {
+	dto := &api.MetadataValueMergeRequest{TargetValueId: targetValueId}
+	req := client.Post(fmt.Sprintf("/api/v1/metadata/keys/%d/values/%d/merge", keyId, valueId)).Json(t, dto)
+	req.req.Expect(t).Status(wantHttpStatus).Done()
+}
+
+func MoveMetadataValue(t *testing.T, client *httpClient, keyId, valueId, targetKeyId int, wantHttpStatus int) {
+	dto := &api.MetadataKeyMergeRequest{TargetKeyId: targetKeyId}
+	req := client.Post(fmt.Sprintf("/api/v1/metadata/keys/%d/values/%d/move", keyId, valueId)).Json(t, dto)
+	req.req.Expect(t).Status(wantHttpStatus).Done()
+}
+
+func MergeMetadataKey(t *testing.T, client *httpClient, keyId, targetKeyId int, wantHttpStatus int) {
+	dto := &api.MetadataKeyMergeRequest{TargetKeyId: targetKeyId}
+	req := client.Post(fmt.Sprintf("/api/v1/metadata/keys/%d/merge", keyId)).Json(t, dto)
+	req.req.Expect(t).Status(wantHttpStatus).Done()
+}
@@ -50,6 +50,18 @@ func (suite *MetadataKeySuite) TestUpdateKey() {
 	assert.Equal(suite.T(), "testing author", newKey.Key, "key key")
 }
 
+func (suite *MetadataKeySuite) TestUpdateKeyAutoApplyThreshold() {
+	key := suite.keys["author"]
+	key.AutoApplyThreshold = 1.5
+	UpdateMetadataKey(suite.T(), suite.userHttp, 400, key)
+
+	key.AutoApplyThreshold = 0.9
+	UpdateMetadataKey(suite.T(), suite.userHttp, 200, key)
+
+	newKey := GetMetadataKey(suite.T(), suite.userHttp, key.Id, 200)
+	assert.InDelta(suite.T(), 0.9, newKey.AutoApplyThreshold, 0.0001, "auto apply threshold")
+}
+
 func (suite *MetadataKeySuite) TestDeleteKey() {
 	key := suite.keys["author"]
 
@@ -0,0 +1,114 @@
+package integrationtest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"tryffel.net/go/virtualpaper/api"
+	"tryffel.net/go/virtualpaper/models"
+)
+
+type MetadataMergeSuite struct {
+	ApiTestSuite
+	keys   map[string]*models.MetadataKey
+	values map[string]map[string]*models.MetadataValue
+}
+
+func TestMetadataMerge(t *testing.T) {
+	suite.Run(t, new(MetadataMergeSuite))
+}
+
+func (suite *MetadataMergeSuite) SetupTest() {
+	suite.Init()
+	clearDbDocumentTables(suite.T(), suite.db)
+	suite.keys, suite.values = initMetadataKeyValues(suite.T(), suite.userHttp)
+
+	err := insertTestDocuments(suite.T(), suite.db)
+	if err != nil {
+		suite.T().Errorf("insert test documents: %v", err)
+		suite.T().Fail()
+	}
+
+	doBulkEditRequest(suite.T(), suite.userHttp, &api.BulkEditDocumentsRequest{
+		Documents: []string{testDocumentX86.Id},
+		AddMetadata: api.MetadataUpdateRequest{Metadata: []api.MetadataRequest{
+			{KeyId: suite.keys["author"].Id, ValueId: suite.values["author"]["doyle"].Id},
+			{KeyId: suite.keys["author"].Id, ValueId: suite.values["author"]["darwin"].Id},
+		}},
+	}, 200)
+	doBulkEditRequest(suite.T(), suite.userHttp, &api.BulkEditDocumentsRequest{
+		Documents: []string{testDocumentX86Intel.Id},
+		AddMetadata: api.MetadataUpdateRequest{Metadata: []api.MetadataRequest{
+			{KeyId: suite.keys["author"].Id, ValueId: suite.values["author"]["doyle"].Id},
+			{KeyId: suite.keys["category"].Id, ValueId: suite.values["category"]["invoice"].Id},
+		}},
+	}, 200)
+}
+
+func (suite *MetadataMergeSuite) TestMergeValues() {
+	doyle := suite.values["author"]["doyle"]
+	darwin := suite.values["author"]["darwin"]
+	keyId := suite.keys["author"].Id
+
+	MergeMetadataValue(suite.T(), suite.userHttp, keyId, doyle.Id, doyle.Id, 400)
+	MergeMetadataValue(suite.T(), suite.userHttp, keyId, doyle.Id, suite.values["category"]["paper"].Id, 404)
+	MergeMetadataValue(suite.T(), suite.adminHttp, keyId, doyle.Id, darwin.Id, 404)
+	MergeMetadataValue(suite.T(), suite.userHttp, keyId, doyle.Id, darwin.Id, 200)
+
+	doc := getDocument(suite.T(), suite.userHttp, testDocumentX86.Id, 200)
+	assertDocumentMetadataMatches(suite.T(), doc, []*models.MetadataValue{darwin})
+	doc = getDocument(suite.T(), suite.userHttp, testDocumentX86Intel.Id, 200)
+	assertDocumentMetadataMatches(suite.T(), doc, []*models.MetadataValue{darwin, suite.values["category"]["invoice"]})
+
+	history := getDocumentHistory(suite.T(), suite.userHttp, testDocumentX86Intel.Id, 200)
+	last := (*history)[len(*history)-1]
+	assert.Equal(suite.T(), models.DocumentHistoryActionMetadataMerge, last.Action)
+	assert.Equal(suite.T(), "author:doyle", last.OldValue)
+	assert.Equal(suite.T(), "author:darwin", last.NewValue)
+
+	_, err := suite.db.MetadataStore.GetValue(suite.db, doyle.Id)
+	assert.Error(suite.T(), err, "merged value is deleted")
+}
+
+func (suite *MetadataMergeSuite) TestMoveValue() {
+	invoice := suite.values["category"]["invoice"]
+	suite.keys["type"] = AddMetadataKey(suite.T(), suite.userHttp, "type", "document type", 200)
+	amount := AddTypedMetadataKey(suite.T(), suite.userHttp, "amount", models.MetadataKeyTypeNumber, 200)
+
+	MoveMetadataValue(suite.T(), suite.userHttp, suite.keys["category"].Id, invoice.Id, amount.Id, 400)
+	MoveMetadataValue(suite.T(), suite.userHttp, suite.keys["category"].Id, invoice.Id, suite.keys["type"].Id, 200)
+
+	doc := getDocument(suite.T(), suite.userHttp, testDocumentX86Intel.Id, 200)
+	if assert.Len(suite.T(), doc.Metadata, 2) {
+		for _, v := range doc.Metadata {
+			if v.ValueId == invoice.Id {
+				assert.Equal(suite.T(), suite.keys["type"].Id, v.KeyId)
+				assert.Equal(suite.T(), "type", v.Key)
+			}
+		}
+	}
+}
+
+func (suite *MetadataMergeSuite) TestMergeKeys() {
+	writer := AddMetadataKey(suite.T(), suite.userHttp, "writer", "document writer", 200)
+	doyle := AddMetadataValue(suite.T(), suite.userHttp, writer.Id, &models.MetadataValue{Value: "Doyle"}, 200)
+	kafka := AddMetadataValue(suite.T(), suite.userHttp, writer.Id, &models.MetadataValue{Value: "kafka"}, 200)
+	doBulkEditRequest(suite.T(), suite.userHttp, &api.BulkEditDocumentsRequest{
+		Documents: []string{testDocumentMetamorphosis.Id, testDocumentX86.Id},
+		AddMetadata: api.MetadataUpdateRequest{Metadata: []api.MetadataRequest{
+			{KeyId: writer.Id, ValueId: doyle.Id},
+			{KeyId: writer.Id, ValueId: kafka.Id},
+		}},
+	}, 200)
+
+	MergeMetadataKey(suite.T(), suite.userHttp, writer.Id, writer.Id, 400)
+	MergeMetadataKey(suite.T(), suite.userHttp, writer.Id, suite.keys["author"].Id, 200)
+	GetMetadataKey(suite.T(), suite.userHttp, writer.Id, 404)
+
+	authorDoyle := suite.values["author"]["doyle"]
+	authorKafka := &models.MetadataValue{Id: kafka.Id, KeyId: suite.keys["author"].Id, Value: "kafka"}
+	doc := getDocument(suite.T(), suite.userHttp, testDocumentMetamorphosis.Id, 200)
+	assertDocumentMetadataMatches(suite.T(), doc, []*models.MetadataValue{authorDoyle, authorKafka})
+	doc = getDocument(suite.T(), suite.userHttp, testDocumentX86.Id, 200)
+	assertDocumentMetadataMatches(suite.T(), doc, []*models.MetadataValue{authorDoyle, suite.values["author"]["darwin"], authorKafka})
+}
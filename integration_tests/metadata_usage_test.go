@@ -0,0 +1,196 @@
+package integrationtest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"tryffel.net/go/virtualpaper/api"
+	"tryffel.net/go/virtualpaper/models"
+)
+
+type MetadataUsageSuite struct {
+	ApiTestSuite
+	keys   map[string]*models.MetadataKey
+	values map[string]map[string]*models.MetadataValue
+}
+
+func TestMetadataUsage(t *testing.T) {
+	suite.Run(t, new(MetadataUsageSuite))
+}
+
+func (suite *MetadataUsageSuite) SetupTest() {
+	suite.Init()
+	clearDbProcessingRuleTables(suite.T(), suite.db)
+	clearDbDocumentTables(suite.T(), suite.db)
+	clearDbMetadataTables(suite.T(), suite.db)
+	suite.keys, suite.values = initMetadataKeyValues(suite.T(), suite.userHttp)
+	suite.values["author"]["doyel"] = AddMetadataValue(suite.T(), suite.userHttp, suite.keys["author"].Id,
+		&models.MetadataValue{Value: "doyel"}, 200)
+
+	err := insertTestDocuments(suite.T(), suite.db)
+	if err != nil {
+		suite.T().Errorf("insert test documents: %v", err)
+		suite.T().Fail()
+	}
+
+	doBulkEditRequest(suite.T(), suite.userHttp, &api.BulkEditDocumentsRequest{
+		Documents: []string{testDocumentX86.Id},
+		AddMetadata: api.MetadataUpdateRequest{Metadata: []api.MetadataRequest{
+			{KeyId: suite.keys["author"].Id, ValueId: suite.values["author"]["doyle"].Id},
+			{KeyId: suite.keys["author"].Id, ValueId: suite.values["author"]["darwin"].Id},
+		}},
+	}, 200)
+	doBulkEditRequest(suite.T(), suite.userHttp, &api.BulkEditDocumentsRequest{
+		Documents: []string{testDocumentX86Intel.Id},
+		AddMetadata: api.MetadataUpdateRequest{Metadata: []api.MetadataRequest{
+			{KeyId: suite.keys["author"].Id, ValueId: suite.values["author"]["doyle"].Id},
+			{KeyId: suite.keys["category"].Id, ValueId: suite.values["category"]["invoice"].Id},
+		}},
+	}, 200)
+
+	addRule(suite.T(), suite.userHttp, &api.Rule{
+		Name:       "invoices",
+		Enabled:    true,
+		Mode:       "match_any",
+		Conditions: []api.RuleCondition{{ConditionType: "content_contains", Value: "invoice", Enabled: true}},
+		Actions: []api.RuleAction{{
+			Action:   "metadata_add",
+			Enabled:  true,
+			Metadata: models.Metadata{KeyId: suite.keys["category"].Id, ValueId: suite.values["category"]["invoice"].Id},
+		}},
+	}, 200, "add rule")
+}
+
+func (suite *MetadataUsageSuite) TestGetUsage() {
+	getMetadataUsage(suite.T(), suite.userHttp, "x", 400)
+
+	report := getMetadataUsage(suite.T(), suite.userHttp, "1", 200)
+	assert.ElementsMatch(suite.T(), []string{"doyel", "paper"}, usageValueNames(report.UnusedValues))
+	assert.ElementsMatch(suite.T(), []string{"doyel", "doyle", "darwin", "paper"}, usageValueNames(report.ValuesWithoutRules))
+	if assert.Len(suite.T(), report.SimilarValues, 1) {
+		assert.Equal(suite.T(), "doyel", report.SimilarValues[0].Source.Value)
+		assert.Equal(suite.T(), "doyle", report.SimilarValues[0].Target.Value)
+		assert.Equal(suite.T(), 2, report.SimilarValues[0].Target.NumDocuments)
+	}
+
+	keys := make([]string, len(report.RarelyUsedKeys))
+	for i, v := range report.RarelyUsedKeys {
+		keys[i] = v.Key
+	}
+	assert.Equal(suite.T(), []string{"test", "category"}, keys)
+
+	report = getMetadataUsage(suite.T(), suite.adminHttp, "", 200)
+	assert.Len(suite.T(), report.UnusedValues, 0)
+	assert.Len(suite.T(), report.SimilarValues, 0)
+}
+
+func (suite *MetadataUsageSuite) TestCleanup() {
+	doyle := suite.values["author"]["doyle"]
+	doyel := suite.values["author"]["doyel"]
+	darwin := suite.values["author"]["darwin"]
+	paper := suite.values["category"]["paper"]
+
+	cleanupMetadata(suite.T(), suite.userHttp, &api.MetadataCleanupRequest{}, 400)
+	cleanupMetadata(suite.T(), suite.adminHttp, &api.MetadataCleanupRequest{DeleteValues: []int{paper.Id}}, 404)
+	cleanupMetadata(suite.T(), suite.userHttp, &api.MetadataCleanupRequest{
+		MergeValues: []api.MetadataValueMergeItem{{SourceId: doyel.Id, TargetId: suite.values["category"]["invoice"].Id}},
+	}, 404)
+
+	// nothing is changed if any item fails
+	cleanupMetadata(suite.T(), suite.userHttp, &api.MetadataCleanupRequest{
+		MergeValues:  []api.MetadataValueMergeItem{{SourceId: doyel.Id, TargetId: doyle.Id}},
+		DeleteValues: []int{paper.Id, paper.Id + 1000},
+	}, 404)
+	_, err := suite.db.MetadataStore.GetValue(suite.db, doyel.Id)
+	assert.NoError(suite.T(), err, "value is not merged")
+	_, err = suite.db.MetadataStore.GetValue(suite.db, paper.Id)
+	assert.NoError(suite.T(), err, "value is not deleted")
+
+	result := cleanupMetadata(suite.T(), suite.userHttp, &api.MetadataCleanupRequest{
+		MergeValues: []api.MetadataValueMergeItem{
+			{SourceId: doyel.Id, TargetId: doyle.Id},
+			{SourceId: darwin.Id, TargetId: doyle.Id},
+		},
+		DeleteValues: []int{paper.Id},
+		DeleteKeys:   []int{suite.keys["test"].Id},
+	}, 200)
+	assert.Equal(suite.T(), 2, result.MergedValues)
+	assert.Equal(suite.T(), 1, result.DeletedValues)
+	assert.Equal(suite.T(), 1, result.DeletedKeys)
+	assert.Equal(suite.T(), 1, result.NumDocuments)
+
+	doc := getDocument(suite.T(), suite.userHttp, testDocumentX86.Id, 200)
+	assertDocumentMetadataMatches(suite.T(), doc, []*models.MetadataValue{doyle})
+	GetMetadataKey(suite.T(), suite.userHttp, suite.keys["test"].Id, 404)
+	for _, v := range []*models.MetadataValue{doyel, darwin, paper} {
+		_, err = suite.db.MetadataStore.GetValue(suite.db, v.Id)
+		assert.Error(suite.T(), err, "value %s is deleted", v.Value)
+	}
+}
+
+func (suite *MetadataUsageSuite) TestCleanupDisablesRules() {
+	paper := suite.values["category"]["paper"]
+	rule := addRule(suite.T(), suite.userHttp, &api.Rule{
+		Name:    "papers",
+		Enabled: true,
+		Mode:    "match_all",
+		Conditions: []api.RuleCondition{{
+			ConditionType: "metadata_has_key_value",
+			Enabled:       true,
+			Metadata:      models.Metadata{KeyId: suite.keys["category"].Id, ValueId: paper.Id},
+		}},
+		Actions: []api.RuleAction{{
+			Action:   "metadata_add",
+			Enabled:  true,
+			Metadata: models.Metadata{KeyId: suite.keys["author"].Id, ValueId: suite.values["author"]["doyle"].Id},
+		}},
+	}, 200, "add rule")
+
+	result := cleanupMetadata(suite.T(), suite.userHttp, &api.MetadataCleanupRequest{DeleteValues: []int{paper.Id}}, 200)
+	assert.Equal(suite.T(), []int{rule.Id}, result.DisabledRules)
+
+	rule = getRule(suite.T(), suite.userHttp, rule.Id, 200)
+	assert.False(suite.T(), rule.Enabled, "rule is disabled")
+	assert.Len(suite.T(), rule.Conditions, 0, "condition is deleted with the value")
+
+	rules := getRules(suite.T(), suite.userHttp, 200, nil)
+	for _, v := range *rules {
+		if v.Name == "invoices" {
+			assert.True(suite.T(), v.Enabled, "unrelated rule is not disabled")
+		}
+	}
+}
+
+func usageValueNames(values []models.MetadataValueUsage) []string {
+	names := make([]string, len(values))
+	for i, v := range values {
+		names[i] = v.Value
+	}
+	return names
+}
+
+func getMetadataUsage(t *testing.T, client *httpClient, maxDocuments string, wantHttpStatus int) *models.MetadataUsageReport {
+	req := client.Get("/api/v1/metadata/usage")
+	if maxDocuments != "" {
+		req = req.SetQueryParam("max_documents", maxDocuments)
+	}
+	dto := &models.MetadataUsageReport{}
+	if wantHttpStatus == 200 {
+		req.Expect(t).Json(t, dto).e.Status(200).Done()
+	} else {
+		req.req.Expect(t).Status(wantHttpStatus).Done()
+	}
+	return dto
+}
+
+func cleanupMetadata(t *testing.T, client *httpClient, dto *api.MetadataCleanupRequest, wantHttpStatus int) *models.MetadataCleanupResult {
+	req := client.Post("/api/v1/metadata/cleanup").Json(t, dto)
+	result := &models.MetadataCleanupResult{}
+	if wantHttpStatus == 200 {
+		req.Expect(t).Json(t, result).e.Status(200).Done()
+	} else {
+		req.req.Expect(t).Status(wantHttpStatus).Done()
+	}
+	return result
+}
@@ -1,9 +1,12 @@
 package integrationtest
 
 import (
+	"fmt"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
+	"strings"
 	"testing"
+	"tryffel.net/go/virtualpaper/api"
 	"tryffel.net/go/virtualpaper/models"
 )
 
@@ -86,6 +89,116 @@ func (suite *MetadataValueSuite) TestInvalidValues() {
 	}, 400)
 }
 
+func (suite *MetadataValueSuite) TestTypedValues() {
+	AddTypedMetadataKey(suite.T(), suite.userHttp, "invalid", "decimal", 400)
+	amount := AddTypedMetadataKey(suite.T(), suite.userHttp, "amount", models.MetadataKeyTypeMoney, 200)
+
+	value := AddMetadataValue(suite.T(), suite.userHttp, amount.Id, &models.MetadataValue{Value: "€1 234,5"}, 200)
+	assert.Equal(suite.T(), "1234.50 EUR", value.Value)
+	assert.Equal(suite.T(), "EUR", value.Currency)
+	if assert.NotNil(suite.T(), value.NumberValue) {
+		assert.Equal(suite.T(), 1234.5, *value.NumberValue)
+	}
+	AddMetadataValue(suite.T(), suite.userHttp, amount.Id, &models.MetadataValue{Value: "a lot"}, 400)
+
+	// type cannot be changed once key has values
+	amount.Type = models.MetadataKeyTypeNumber
+	UpdateMetadataKey(suite.T(), suite.userHttp, 400, amount)
+	amount.Type = models.MetadataKeyTypeMoney
+	UpdateMetadataKey(suite.T(), suite.userHttp, 200, amount)
+}
+
+func (suite *MetadataValueSuite) TestValueHierarchy() {
+	keyId := suite.keys["category"].Id
+	finance := AddMetadataValue(suite.T(), suite.userHttp, keyId, &models.MetadataValue{Value: "finance"}, 200)
+	taxes := AddMetadataValue(suite.T(), suite.userHttp, keyId, &models.MetadataValue{Value: "taxes", ParentId: models.IntId(finance.Id)}, 200)
+	AddMetadataValue(suite.T(), suite.userHttp, keyId, &models.MetadataValue{Value: "invoices", ParentId: models.IntId(finance.Id)}, 200)
+	vat := AddMetadataValue(suite.T(), suite.userHttp, keyId, &models.MetadataValue{Value: "vat", ParentId: models.IntId(taxes.Id)}, 200)
+
+	// parent must belong to the same key
+	AddMetadataValue(suite.T(), suite.userHttp, suite.keys["author"].Id, &models.MetadataValue{Value: "x", ParentId: models.IntId(finance.Id)}, 400)
+
+	// cycles are not allowed
+	finance.ParentId = models.IntId(vat.Id)
+	UpdateMetadataValue(suite.T(), suite.userHttp, finance, 400)
+	finance.ParentId = models.IntId(finance.Id)
+	UpdateMetadataValue(suite.T(), suite.userHttp, finance, 400)
+
+	tree := GetMetadataValueTree(suite.T(), suite.userHttp, keyId, 200)
+	if assert.Len(suite.T(), tree, 1) {
+		assert.Equal(suite.T(), "finance", tree[0].Value)
+		if assert.Len(suite.T(), tree[0].Children, 2) {
+			assert.Equal(suite.T(), "invoices", tree[0].Children[0].Value)
+			assert.Equal(suite.T(), "taxes", tree[0].Children[1].Value)
+			assert.Len(suite.T(), tree[0].Children[1].Children, 1)
+		}
+	}
+
+	// moving value to top level
+	vat.ParentId = 0
+	UpdateMetadataValue(suite.T(), suite.userHttp, vat, 200)
+	tree = GetMetadataValueTree(suite.T(), suite.userHttp, keyId, 200)
+	assert.Len(suite.T(), tree, 2)
+}
+
+func (suite *MetadataValueSuite) TestValueHierarchyDepth() {
+	keyId := suite.keys["category"].Id
+	chain := func(name string, levels int) []*models.MetadataValue {
+		values := make([]*models.MetadataValue, levels)
+		for i := range values {
+			value := &models.MetadataValue{Value: fmt.Sprintf("%s%d", name, i+1)}
+			if i > 0 {
+				value.ParentId = models.IntId(values[i-1].Id)
+			}
+			values[i] = AddMetadataValue(suite.T(), suite.userHttp, keyId, value, 200)
+		}
+		return values
+	}
+	a := chain("a", 6)
+	b := chain("b", 5)
+
+	// the whole subtree of the moved value must fit in the hierarchy
+	b[0].ParentId = models.IntId(a[5].Id)
+	UpdateMetadataValue(suite.T(), suite.userHttp, b[0], 400)
+	b[0].ParentId = models.IntId(a[4].Id)
+	UpdateMetadataValue(suite.T(), suite.userHttp, b[0], 200)
+	AddMetadataValue(suite.T(), suite.userHttp, keyId,
+		&models.MetadataValue{Value: "too deep", ParentId: models.IntId(b[4].Id)}, 400)
+}
+
+func (suite *MetadataValueSuite) TestTypedDocumentValues() {
+	clearDbDocumentTables(suite.T(), suite.db)
+	err := insertTestDocuments(suite.T(), suite.db)
+	if !assert.NoError(suite.T(), err) {
+		return
+	}
+	due := AddTypedMetadataKey(suite.T(), suite.userHttp, "due", models.MetadataKeyTypeDate, 200)
+	note := AddTypedMetadataKey(suite.T(), suite.userHttp, "note", models.MetadataKeyTypeFreeText, 200)
+	doc := getDocument(suite.T(), suite.userHttp, testDocumentX86.Id, 200)
+
+	update := func(value string, wantHttpStatus int) {
+		dto := &api.DocumentUpdateRequest{
+			Name:     doc.Name,
+			Filename: doc.Filename,
+			Date:     doc.Date,
+			Metadata: []api.MetadataRequest{
+				{KeyId: due.Id, Value: "2024-05-01T10:00:00Z"},
+				{KeyId: note.Id, Value: value},
+			},
+		}
+		suite.userHttp.Put("/api/v1/documents/"+doc.Id).Json(suite.T(), dto).Expect(suite.T()).e.Status(wantHttpStatus).Done()
+	}
+	update("paid: "+strings.Repeat("x", 100), 200)
+	update(strings.Repeat("x", models.MetadataFreeTextMaxLength+1), 400)
+
+	doc = getDocument(suite.T(), suite.userHttp, testDocumentX86.Id, 200)
+	values := []string{}
+	for _, v := range doc.Metadata {
+		values = append(values, v.Value)
+	}
+	assert.ElementsMatch(suite.T(), []string{"2024-05-01", "paid: " + strings.Repeat("x", 100)}, values)
+}
+
 func (suite *MetadataValueSuite) TestUnauthorized() {
 	AddMetadataValue(suite.T(), suite.userHttp, suite.keys["admin-test"].Id, &models.MetadataValue{
 		Value:          "another",
@@ -0,0 +1,203 @@
+package integrationtest
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"strconv"
+	"testing"
+	"tryffel.net/go/virtualpaper/api"
+	"tryffel.net/go/virtualpaper/models"
+)
+
+type MetadataVocabularySuite struct {
+	ApiTestSuite
+	keys   map[string]*models.MetadataKey
+	values map[string]map[string]*models.MetadataValue
+	users  map[string]models.User
+}
+
+func TestMetadataVocabularies(t *testing.T) {
+	suite.Run(t, new(MetadataVocabularySuite))
+}
+
+func (suite *MetadataVocabularySuite) SetupTest() {
+	suite.Init()
+	clearDbMetadataTables(suite.T(), suite.db)
+	clearDbDocumentTables(suite.T(), suite.db)
+	suite.keys, suite.values = initMetadataKeyValues(suite.T(), suite.userHttp)
+
+	err := insertTestDocuments(suite.T(), suite.db)
+	if err != nil {
+		suite.T().Errorf("insert test documents: %v", err)
+		suite.T().Fail()
+	}
+
+	users, err := suite.db.UserStore.GetUsers()
+	if err != nil {
+		suite.T().Error("get users from db", err)
+	} else {
+		suite.users = map[string]models.User{}
+		for _, v := range *users {
+			suite.users[v.Name] = v
+		}
+	}
+}
+
+func (suite *MetadataVocabularySuite) TestCreateVocabulary() {
+	AddMetadataVocabulary(suite.T(), suite.userHttp, &api.MetadataVocabularyRequest{Name: ""}, 400)
+	AddMetadataVocabulary(suite.T(), suite.adminHttp, &api.MetadataVocabularyRequest{
+		Name:   "team",
+		KeyIds: []int{suite.keys["author"].Id},
+	}, 400)
+
+	AddMetadataVocabulary(suite.T(), suite.userHttp, &api.MetadataVocabularyRequest{
+		Name:      "invalid members",
+		MemberIds: []int{suite.users["user"].Id},
+	}, 400)
+
+	vocabulary := AddMetadataVocabulary(suite.T(), suite.userHttp, &api.MetadataVocabularyRequest{
+		Name:      "team",
+		KeyIds:    []int{suite.keys["author"].Id, suite.keys["category"].Id},
+		MemberIds: []int{suite.users["admin"].Id},
+	}, 200)
+	assert.Len(suite.T(), vocabulary.Keys, 2)
+	assert.True(suite.T(), vocabulary.Owned)
+	if assert.Len(suite.T(), vocabulary.Members, 1) {
+		assert.Equal(suite.T(), suite.users["admin"].Id, vocabulary.Members[0].UserId)
+	}
+	AddMetadataVocabulary(suite.T(), suite.userHttp, &api.MetadataVocabularyRequest{Name: "team"}, 304)
+
+	// members can see but not modify the vocabulary
+	other := GetMetadataVocabulary(suite.T(), suite.adminHttp, vocabulary.Id, 200)
+	assert.False(suite.T(), other.Owned)
+	assert.True(suite.T(), other.Member)
+	assert.False(suite.T(), other.Subscribed)
+	assert.Len(suite.T(), other.Members, 0, "only owner sees members")
+	GetMetadataVocabulary(suite.T(), suite.testerHttp, vocabulary.Id, 404)
+	UpdateMetadataVocabulary(suite.T(), suite.adminHttp, vocabulary.Id, &api.MetadataVocabularyRequest{Name: "other"}, 404)
+	DeleteMetadataVocabulary(suite.T(), suite.adminHttp, vocabulary.Id, 404)
+
+	UpdateMetadataVocabulary(suite.T(), suite.userHttp, vocabulary.Id, &api.MetadataVocabularyRequest{
+		Name:   "team",
+		KeyIds: []int{suite.keys["author"].Id},
+	}, 200)
+	vocabulary = GetMetadataVocabulary(suite.T(), suite.userHttp, vocabulary.Id, 200)
+	assert.Len(suite.T(), vocabulary.Keys, 1)
+	DeleteMetadataVocabulary(suite.T(), suite.userHttp, vocabulary.Id, 200)
+	GetMetadataVocabulary(suite.T(), suite.userHttp, vocabulary.Id, 404)
+}
+
+func (suite *MetadataVocabularySuite) TestSubscribeVocabulary() {
+	vocabulary := AddMetadataVocabulary(suite.T(), suite.userHttp, &api.MetadataVocabularyRequest{
+		Name:      "team",
+		KeyIds:    []int{suite.keys["author"].Id},
+		MemberIds: []int{suite.users["admin"].Id},
+	}, 200)
+	authorKeyId := suite.keys["author"].Id
+
+	GetMetadataKey(suite.T(), suite.adminHttp, authorKeyId, 404)
+	SubscribeMetadataVocabulary(suite.T(), suite.userHttp, vocabulary.Id, 400)
+	SubscribeMetadataVocabulary(suite.T(), suite.testerHttp, vocabulary.Id, 404)
+	GetMetadataKey(suite.T(), suite.testerHttp, authorKeyId, 404)
+	SubscribeMetadataVocabulary(suite.T(), suite.adminHttp, vocabulary.Id, 200)
+
+	key := GetMetadataKey(suite.T(), suite.adminHttp, authorKeyId, 200)
+	assert.Equal(suite.T(), authorKeyId, key.Id)
+	UpdateMetadataKey(suite.T(), suite.adminHttp, 404, key)
+
+	doc := getDocument(suite.T(), suite.adminHttp, testDocumentTransistorCountAdminUser.Id, 200)
+	doc.Metadata = []models.Metadata{{KeyId: authorKeyId, ValueId: suite.values["author"]["doyle"].Id}}
+	updateDocument(suite.T(), suite.adminHttp, doc, 200)
+	doc = getDocument(suite.T(), suite.adminHttp, testDocumentTransistorCountAdminUser.Id, 200)
+	assert.Len(suite.T(), doc.Metadata, 1)
+
+	// vocabulary is read-only
+	AddMetadataValue(suite.T(), suite.adminHttp, authorKeyId, &models.MetadataValue{Value: "tolkien"}, 404)
+
+	UnsubscribeMetadataVocabulary(suite.T(), suite.adminHttp, vocabulary.Id, 200)
+	UnsubscribeMetadataVocabulary(suite.T(), suite.adminHttp, vocabulary.Id, 404)
+	GetMetadataKey(suite.T(), suite.adminHttp, authorKeyId, 404)
+}
+
+func (suite *MetadataVocabularySuite) TestRemoveMember() {
+	vocabulary := AddMetadataVocabulary(suite.T(), suite.userHttp, &api.MetadataVocabularyRequest{
+		Name:      "team",
+		KeyIds:    []int{suite.keys["author"].Id},
+		MemberIds: []int{suite.users["admin"].Id},
+	}, 200)
+	SubscribeMetadataVocabulary(suite.T(), suite.adminHttp, vocabulary.Id, 200)
+	GetMetadataKey(suite.T(), suite.adminHttp, suite.keys["author"].Id, 200)
+
+	UpdateMetadataVocabulary(suite.T(), suite.userHttp, vocabulary.Id, &api.MetadataVocabularyRequest{
+		Name:   "team",
+		KeyIds: []int{suite.keys["author"].Id},
+	}, 200)
+	GetMetadataVocabulary(suite.T(), suite.adminHttp, vocabulary.Id, 404)
+	GetMetadataKey(suite.T(), suite.adminHttp, suite.keys["author"].Id, 404)
+}
+
+func (suite *MetadataVocabularySuite) TestEditableVocabulary() {
+	vocabulary := AddMetadataVocabulary(suite.T(), suite.userHttp, &api.MetadataVocabularyRequest{
+		Name:      "team",
+		Editable:  true,
+		KeyIds:    []int{suite.keys["author"].Id},
+		MemberIds: []int{suite.users["admin"].Id},
+	}, 200)
+	SubscribeMetadataVocabulary(suite.T(), suite.adminHttp, vocabulary.Id, 200)
+
+	value := AddMetadataValue(suite.T(), suite.adminHttp, suite.keys["author"].Id, &models.MetadataValue{Value: "tolkien"}, 200)
+	values := GetMetadataKeyValues(suite.T(), suite.userHttp, suite.keys["author"].Id, 200)
+	found := false
+	for _, v := range values {
+		if v.Id == value.Id {
+			found = true
+		}
+	}
+	assert.True(suite.T(), found, "owner sees the value added by subscriber")
+
+	// subscribers cannot delete values
+	DeleteMetadataValue(suite.T(), suite.adminHttp, suite.keys["author"].Id, value.Id, 404)
+}
+
+func AddMetadataVocabulary(t *testing.T, client *httpClient, dto *api.MetadataVocabularyRequest, wantHttpStatus int) *models.MetadataVocabulary {
+	req := client.Post("/api/v1/metadata/vocabularies").Json(t, dto)
+	body := &models.MetadataVocabulary{}
+	if wantHttpStatus == 200 {
+		req.Expect(t).Json(t, body).e.Status(200).Done()
+		assert.True(t, body.Id > 0, "id must be > 0")
+		return body
+	}
+	req.req.Expect(t).Status(wantHttpStatus).Done()
+	return nil
+}
+
+func GetMetadataVocabulary(t *testing.T, client *httpClient, id int, wantHttpStatus int) *models.MetadataVocabulary {
+	req := client.Get("/api/v1/metadata/vocabularies/" + strconv.Itoa(id))
+	body := &models.MetadataVocabulary{}
+	if wantHttpStatus == 200 {
+		req.Expect(t).Json(t, body).e.Status(200).Done()
+		return body
+	}
+	req.req.Expect(t).Status(wantHttpStatus).Done()
+	return nil
+}
+
+func UpdateMetadataVocabulary(t *testing.T, client *httpClient, id int, dto *api.MetadataVocabularyRequest, wantHttpStatus int) {
+	req := client.Put("/api/v1/metadata/vocabularies/"+strconv.Itoa(id)).Json(t, dto)
+	req.req.Expect(t).Status(wantHttpStatus).Done()
+}
+
+func DeleteMetadataVocabulary(t *testing.T, client *httpClient, id int, wantHttpStatus int) {
+	req := client.Delete("/api/v1/metadata/vocabularies/" + strconv.Itoa(id))
+	req.Expect(t).e.Status(wantHttpStatus).Done()
+}
+
+func SubscribeMetadataVocabulary(t *testing.T, client *httpClient, id int, wantHttpStatus int) {
+	req := client.Post("/api/v1/metadata/vocabularies/" + strconv.Itoa(id) + "/subscription")
+	req.Expect(t).e.Status(wantHttpStatus).Done()
+}
+
+func UnsubscribeMetadataVocabulary(t *testing.T, client *httpClient, id int, wantHttpStatus int) {
+	req := client.Delete("/api/v1/metadata/vocabularies/" + strconv.Itoa(id) + "/subscription")
+	req.Expect(t).e.Status(wantHttpStatus).Done()
+}
@@ -7,6 +7,8 @@ import (
 	"strconv"
 	"testing"
 	"tryffel.net/go/virtualpaper/api"
+	"tryffel.net/go/virtualpaper/models"
+	"tryffel.net/go/virtualpaper/services"
 	"tryffel.net/go/virtualpaper/services/process"
 )
 
@@ -22,6 +24,10 @@ func (suite *RuleApiTestSuite) SetupTest() {
 	suite.Init()
 	clearDbMetadataTables(suite.T(), suite.db)
 	clearDbProcessingRuleTables(suite.T(), suite.db)
+	_, err := suite.db.Exec("DELETE FROM document_types")
+	if err != nil {
+		suite.T().Errorf("clear document types: %v", err)
+	}
 }
 
 func (suite *RuleApiTestSuite) AddRules() {
@@ -382,6 +388,293 @@ func (suite *RuleApiTestSuite) TestRuleTestingMatch() {
 	assert.Equal(suite.T(), ruleTest.ActionOutput[0], []string{"action is disabled"})
 }
 
+func (suite *RuleApiTestSuite) TestRuleConditionGroups() {
+	_ = insertTestDocuments(suite.T(), suite.db)
+
+	rule := &api.Rule{
+		Name:    "test rule groups",
+		Enabled: true,
+		Mode:    "match_all",
+		Conditions: []api.RuleCondition{
+			{
+				ConditionType: "content_contains",
+				Value:         "widely used",
+				Enabled:       true,
+			},
+			{
+				ConditionType: "group",
+				Mode:          "match_any",
+				Enabled:       true,
+				Conditions: []api.RuleCondition{
+					{
+						ConditionType: "content_contains",
+						Value:         "no such text",
+						Enabled:       true,
+					},
+					{
+						ConditionType: "name_contains",
+						Value:         "intel",
+						Enabled:       true,
+						Inverted:      true,
+					},
+					{
+						ConditionType: "content_contains",
+						Value:         "widely used",
+						Enabled:       true,
+					},
+				},
+			},
+		},
+		Actions: []api.RuleAction{
+			{
+				Action:  "description_append",
+				Value:   "test",
+				Enabled: true,
+			},
+		},
+	}
+
+	gotRule := addRule(suite.T(), suite.userHttp, rule, 200, "add rule with group")
+	rule.Id = gotRule.Id
+	storedRule := getRule(suite.T(), suite.userHttp, rule.Id, 200)
+	if assert.Len(suite.T(), storedRule.Conditions, 2) {
+		group := storedRule.Conditions[1]
+		assert.Equal(suite.T(), "group", group.ConditionType)
+		assert.Equal(suite.T(), "match_any", group.Mode)
+		if assert.Len(suite.T(), group.Conditions, 3) {
+			assert.Equal(suite.T(), "no such text", group.Conditions[0].Value)
+			assert.Equal(suite.T(), true, group.Conditions[1].Inverted)
+			assert.Equal(suite.T(), "widely used", group.Conditions[2].Value)
+		}
+	}
+
+	ruleTest := testRule(suite.T(), suite.userHttp, rule.Id, testDocumentX86Intel.Id, 200)
+	assert.Equal(suite.T(), true, ruleTest.Match)
+	if assert.Len(suite.T(), ruleTest.Conditions, 2) && assert.Len(suite.T(), ruleTest.Conditions[1].Children, 3) {
+		assert.Equal(suite.T(), true, ruleTest.Conditions[1].Matched)
+		assert.Equal(suite.T(), false, ruleTest.Conditions[1].Children[0].Matched)
+		assert.Equal(suite.T(), false, ruleTest.Conditions[1].Children[1].Matched)
+		assert.Equal(suite.T(), true, ruleTest.Conditions[1].Children[2].Matched)
+	}
+
+	rule.Conditions[1].Conditions = nil
+	updateRule(suite.T(), suite.userHttp, rule, 400, "group without conditions")
+
+	rule.Conditions[1].Mode = ""
+	rule.Conditions[1].Conditions = []api.RuleCondition{{ConditionType: "content_contains", Value: "a", Enabled: true}}
+	updateRule(suite.T(), suite.userHttp, rule, 400, "group without mode")
+}
+
+func (suite *RuleApiTestSuite) TestRuleTriggers() {
+	rule := &api.Rule{
+		Name:    "test rule triggers",
+		Enabled: true,
+		Mode:    "match_all",
+		Conditions: []api.RuleCondition{
+			{
+				ConditionType: "content_contains",
+				Value:         "widely used",
+				Enabled:       true,
+			},
+		},
+		Actions: []api.RuleAction{
+			{
+				Action:  "description_append",
+				Value:   "test",
+				Enabled: true,
+			},
+		},
+	}
+
+	gotRule := addRule(suite.T(), suite.userHttp, rule, 200, "rule without triggers")
+	assert.Equal(suite.T(), []string{"upload"}, gotRule.Triggers, "rule runs on upload by default")
+
+	rule.Triggers = []string{"edit", "schedule"}
+	addRule(suite.T(), suite.userHttp, rule, 400, "schedule trigger without schedule")
+	rule.Schedule = "every night"
+	addRule(suite.T(), suite.userHttp, rule, 400, "invalid schedule")
+	rule.Triggers = []string{"edit", "delete"}
+	rule.Schedule = ""
+	addRule(suite.T(), suite.userHttp, rule, 400, "invalid trigger")
+
+	rule.Triggers = []string{"edit", "metadata", "schedule"}
+	rule.Schedule = "0 3 * * *"
+	gotRule = addRule(suite.T(), suite.userHttp, rule, 200, "rule with triggers")
+	storedRule := getRule(suite.T(), suite.userHttp, gotRule.Id, 200)
+	assert.Equal(suite.T(), []string{"edit", "metadata", "schedule"}, storedRule.Triggers)
+	assert.Equal(suite.T(), "0 3 * * *", storedRule.Schedule)
+
+	storedRule.Triggers = []string{"share"}
+	storedRule.Schedule = ""
+	updatedRule := updateRule(suite.T(), suite.userHttp, storedRule, 200, "update triggers")
+	assert.Equal(suite.T(), []string{"share"}, updatedRule.Triggers)
+	assert.Equal(suite.T(), "", updatedRule.Schedule)
+}
+
+func (suite *RuleApiTestSuite) TestRuleFileConditions() {
+	_ = insertTestDocuments(suite.T(), suite.db)
+
+	rule := &api.Rule{
+		Name:    "test file conditions",
+		Enabled: true,
+		Mode:    "match_all",
+		Conditions: []api.RuleCondition{
+			{
+				ConditionType: "size_more_than",
+				Value:         "5 TB",
+				Enabled:       true,
+			},
+		},
+		Actions: []api.RuleAction{
+			{
+				Action:  "description_append",
+				Value:   "test",
+				Enabled: true,
+			},
+		},
+	}
+	addRule(suite.T(), suite.userHttp, rule, 400, "invalid size")
+
+	rule.Conditions = []api.RuleCondition{
+		{
+			ConditionType: "size_less_than",
+			Value:         "1 GB",
+			Enabled:       true,
+		},
+		{
+			ConditionType: "created_newer_than",
+			Value:         "1y",
+			Enabled:       true,
+		},
+		{
+			ConditionType: "mimetype_is",
+			Value:         "text/plain",
+			Enabled:       true,
+			Inverted:      true,
+		},
+	}
+	gotRule := addRule(suite.T(), suite.userHttp, rule, 200, "valid file conditions")
+	ruleTest := testRule(suite.T(), suite.userHttp, gotRule.Id, testDocumentX86Intel.Id, 200)
+	assert.True(suite.T(), ruleTest.Match, "rule matches")
+	assert.Len(suite.T(), ruleTest.Conditions, 3)
+}
+
+func (suite *RuleApiTestSuite) TestExportImportRules() {
+	key := AddMetadataKey(suite.T(), suite.userHttp, "Category", "", 200)
+	value := AddMetadataValue(suite.T(), suite.userHttp, key.Id, &models.MetadataValue{Value: "Invoices"}, 200)
+	docType := AddDocumentType(suite.T(), suite.userHttp, &api.DocumentTypeRequest{Name: "Invoice"}, 200)
+
+	rule := &api.Rule{
+		Name:     "invoices",
+		Enabled:  true,
+		Mode:     "match_all",
+		Triggers: []string{"upload", "edit"},
+		Conditions: []api.RuleCondition{
+			{
+				ConditionType: "group",
+				Mode:          "match_any",
+				Enabled:       true,
+				Conditions: []api.RuleCondition{
+					{ConditionType: "content_contains", Value: "invoice", Enabled: true},
+					{ConditionType: "name_contains", Value: "invoice", Enabled: true},
+				},
+			},
+		},
+		Actions: []api.RuleAction{
+			{
+				Action:   "metadata_add",
+				Enabled:  true,
+				Metadata: models.Metadata{KeyId: key.Id, ValueId: value.Id},
+			},
+			{
+				Action:  "document_type_set",
+				Enabled: true,
+				Value:   strconv.Itoa(docType.Id),
+			},
+		},
+	}
+	addRule(suite.T(), suite.userHttp, rule, 200, "add rule")
+
+	export := &services.RuleExport{}
+	suite.userHttp.Get("/api/v1/processing/rules/export").
+		ExpectName(suite.T(), "export rules", false).Json(suite.T(), export).e.Status(200).Done()
+	suite.userHttp.Get("/api/v1/processing/rules/export").SetQueryParam("format", "xml").
+		ExpectName(suite.T(), "export invalid format", false).e.Status(400).Done()
+
+	assert.Equal(suite.T(), services.RuleExportVersion, export.Version)
+	if !assert.Len(suite.T(), export.Rules, 1) || !assert.Len(suite.T(), export.Rules[0].Actions, 2) {
+		return
+	}
+	assert.Equal(suite.T(), "Category", export.Rules[0].Actions[0].MetadataKey)
+	assert.Equal(suite.T(), "Invoices", export.Rules[0].Actions[0].MetadataValue)
+	assert.Equal(suite.T(), "Invoice", export.Rules[0].Actions[1].DocumentType)
+	assert.Equal(suite.T(), "", export.Rules[0].Actions[1].Value)
+	assert.Equal(suite.T(), []string{"upload", "edit"}, export.Rules[0].Triggers)
+	if assert.Len(suite.T(), export.Rules[0].Conditions, 1) {
+		assert.Len(suite.T(), export.Rules[0].Conditions[0].Conditions, 2)
+	}
+
+	importRules := func(client *httpClient, conflict string, status int) *services.RuleImportStatus {
+		result := &services.RuleImportStatus{}
+		req := client.Post("/api/v1/processing/rules/import").SetQueryParam("conflict", conflict).
+			Json(suite.T(), export).ExpectName(suite.T(), "import rules: "+conflict, false)
+		if status == 200 {
+			req = req.Json(suite.T(), result)
+		}
+		req.e.Status(status).Done()
+		return result
+	}
+
+	importRules(suite.testerHttp, "overwrite", 400)
+
+	// metadata created for the first rule is rolled back if a later rule fails
+	rules := export.Rules
+	export.Rules = append(export.Rules, services.RuleExportedRule{Name: "", Mode: "match_all"})
+	importRules(suite.testerHttp, "skip", 400)
+	export.Rules = rules
+	assert.Len(suite.T(), *GetMetadataKeys(suite.T(), suite.testerHttp, 200, nil), 0, "metadata key is not created")
+
+	// other user does not have the metadata
+	result := importRules(suite.testerHttp, "skip", 200)
+	assert.Equal(suite.T(), 1, result.Created)
+	assert.Equal(suite.T(), 1, result.CreatedKeys)
+	assert.Equal(suite.T(), 1, result.CreatedValues)
+	assert.Equal(suite.T(), 1, result.CreatedTypes)
+
+	testerTypeId := 0
+	for _, v := range GetDocumentTypes(suite.T(), suite.testerHttp, 200) {
+		if v.Name == "Invoice" {
+			testerTypeId = v.Id
+		}
+	}
+	assert.NotEqual(suite.T(), 0, testerTypeId, "document type is created")
+	testerRules := getRules(suite.T(), suite.testerHttp, 200, nil)
+	if assert.Len(suite.T(), *testerRules, 1) && assert.Len(suite.T(), (*testerRules)[0].Actions, 2) {
+		imported := (*testerRules)[0]
+		assert.Equal(suite.T(), "invoices", imported.Name)
+		assert.NotEqual(suite.T(), key.Id, imported.Actions[0].Metadata.KeyId)
+		assert.Equal(suite.T(), "Invoices", imported.Actions[0].Metadata.Value)
+		assert.Equal(suite.T(), strconv.Itoa(testerTypeId), imported.Actions[1].Value)
+	}
+
+	result = importRules(suite.testerHttp, "skip", 200)
+	assert.Equal(suite.T(), 1, result.Skipped)
+	assert.Equal(suite.T(), 0, result.CreatedKeys)
+	assert.Equal(suite.T(), 0, result.CreatedTypes)
+
+	export.Rules[0].Description = "replaced"
+	result = importRules(suite.testerHttp, "replace", 200)
+	assert.Equal(suite.T(), 1, result.Replaced)
+	testerRules = getRules(suite.T(), suite.testerHttp, 200, nil)
+	if assert.Len(suite.T(), *testerRules, 1) {
+		assert.Equal(suite.T(), "replaced", (*testerRules)[0].Description)
+	}
+
+	result = importRules(suite.testerHttp, "duplicate", 200)
+	assert.Equal(suite.T(), 1, result.Created)
+	assert.Len(suite.T(), *getRules(suite.T(), suite.testerHttp, 200, nil), 2)
+}
+
 func (suite *RuleApiTestSuite) TestRuleTestingNoMatch() {
 	_ = insertTestDocuments(suite.T(), suite.db)
 	doc := getDocument(suite.T(), suite.userHttp, testDocumentX86Intel.Id, 200)
@@ -0,0 +1,172 @@
+package integrationtest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"tryffel.net/go/virtualpaper/api"
+	"tryffel.net/go/virtualpaper/services"
+)
+
+func TestApplyRule(t *testing.T) {
+	suite.Run(t, new(RuleApplyTestSuite))
+}
+
+type RuleApplyTestSuite struct {
+	ApiTestSuite
+}
+
+func (suite *RuleApplyTestSuite) SetupTest() {
+	suite.Init()
+	clearDbMetadataTables(suite.T(), suite.db)
+	clearDbProcessingRuleTables(suite.T(), suite.db)
+	clearDbDocumentTables(suite.T(), suite.db)
+	_ = insertTestDocuments(suite.T(), suite.db)
+}
+
+func (suite *RuleApplyTestSuite) addRule() *api.Rule {
+	rule := &api.Rule{
+		Name:    "isa documents",
+		Enabled: true,
+		Mode:    "match_all",
+		Conditions: []api.RuleCondition{
+			{
+				ConditionType: "content_contains",
+				Value:         "widely used",
+				Enabled:       true,
+			},
+		},
+		Actions: []api.RuleAction{
+			{
+				Action:  "description_set",
+				Value:   "instruction set",
+				Enabled: true,
+			},
+		},
+	}
+	return addRule(suite.T(), suite.userHttp, rule, 200, "add rule")
+}
+
+func (suite *RuleApplyTestSuite) TestPreviewAndApply() {
+	rule := suite.addRule()
+
+	preview := &services.RuleApplyPreview{}
+	suite.userHttp.Post(fmt.Sprintf("/api/v1/processing/rules/%d/apply", rule.Id)).
+		Json(suite.T(), &api.RuleApplyRequest{}).
+		ExpectName(suite.T(), "preview apply rule", false).Json(suite.T(), preview).e.Status(200).Done()
+
+	if assert.Len(suite.T(), preview.Changed, 1) {
+		assert.Equal(suite.T(), testDocumentX86Intel.Id, preview.Changed[0].DocumentId)
+		if assert.Len(suite.T(), preview.Changed[0].Changes, 1) {
+			assert.Equal(suite.T(), "description", preview.Changed[0].Changes[0].Action)
+			assert.Equal(suite.T(), "instruction set", preview.Changed[0].Changes[0].NewValue)
+		}
+	}
+	doc := getDocument(suite.T(), suite.userHttp, testDocumentX86Intel.Id, 200)
+	assert.Equal(suite.T(), testDocumentX86Intel.Description, doc.Description, "preview does not modify document")
+
+	status := &services.RuleApplyStatus{}
+	suite.userHttp.Post(fmt.Sprintf("/api/v1/processing/rules/%d/apply", rule.Id)).
+		Json(suite.T(), &api.RuleApplyRequest{Confirm: true}).
+		ExpectName(suite.T(), "apply rule", false).Json(suite.T(), status).e.Status(200).Done()
+	assert.Equal(suite.T(), preview.Documents, status.Total)
+
+	for i := 0; i < 50 && status.Running; i++ {
+		time.Sleep(time.Millisecond * 100)
+		suite.userHttp.Get(fmt.Sprintf("/api/v1/processing/rules/%d/apply", rule.Id)).
+			ExpectName(suite.T(), "get apply status", false).Json(suite.T(), status).e.Status(200).Done()
+	}
+	assert.False(suite.T(), status.Running)
+	assert.Equal(suite.T(), 1, status.Changed)
+	assert.Equal(suite.T(), status.Total, status.Processed)
+	assert.Equal(suite.T(), "", status.Error)
+
+	doc = getDocument(suite.T(), suite.userHttp, testDocumentX86Intel.Id, 200)
+	assert.Equal(suite.T(), "instruction set", doc.Description)
+
+	history := getDocumentHistory(suite.T(), suite.userHttp, testDocumentX86Intel.Id, 200)
+	last := (*history)[len(*history)-1]
+	assert.Equal(suite.T(), "description", last.Action)
+	assert.Equal(suite.T(), rule.Id, last.RuleId)
+	assert.Equal(suite.T(), "Rule: isa documents", last.User)
+}
+
+func (suite *RuleApplyTestSuite) TestPreviewWithQuery() {
+	rule := suite.addRule()
+
+	preview := &services.RuleApplyPreview{}
+	suite.userHttp.Post(fmt.Sprintf("/api/v1/processing/rules/%d/apply", rule.Id)).
+		Json(suite.T(), &api.RuleApplyRequest{Query: "jupiter"}).
+		ExpectName(suite.T(), "preview apply rule", false).Json(suite.T(), preview).e.Status(200).Done()
+	assert.Len(suite.T(), preview.Changed, 0)
+}
+
+func (suite *RuleApplyTestSuite) TestInvalidPermissions() {
+	rule := suite.addRule()
+	suite.adminHttp.Post(fmt.Sprintf("/api/v1/processing/rules/%d/apply", rule.Id)).
+		Json(suite.T(), &api.RuleApplyRequest{}).
+		ExpectName(suite.T(), "apply other user's rule", false).e.Status(404).Done()
+	suite.userHttp.Get(fmt.Sprintf("/api/v1/processing/rules/%d/apply", rule.Id)).
+		ExpectName(suite.T(), "rule has not been applied", false).e.Status(404).Done()
+}
+
+func (suite *RuleApplyTestSuite) TestApplyShareAndLangActions() {
+	admin, err := suite.db.UserStore.GetUserByName("admin")
+	if !assert.NoError(suite.T(), err) {
+		return
+	}
+	rule := &api.Rule{
+		Name:    "share isa documents",
+		Enabled: true,
+		Mode:    "match_all",
+		Conditions: []api.RuleCondition{
+			{
+				ConditionType: "content_contains",
+				Value:         "widely used",
+				Enabled:       true,
+			},
+		},
+		Actions: []api.RuleAction{
+			{
+				Action:  "share",
+				Value:   `{"user_id": -1, "permissions": {"read": true}}`,
+				Enabled: true,
+			},
+		},
+	}
+	addRule(suite.T(), suite.userHttp, rule, 400, "share with invalid user")
+	rule.Actions[0].Value = fmt.Sprintf(`{"user_id": %d, "permissions": {"read": true}}`, admin.Id)
+	rule.Actions = append(rule.Actions, api.RuleAction{Action: "lang_set", Value: "fi", Enabled: true})
+	rule = addRule(suite.T(), suite.userHttp, rule, 200, "add rule")
+
+	preview := &services.RuleApplyPreview{}
+	suite.userHttp.Post(fmt.Sprintf("/api/v1/processing/rules/%d/apply", rule.Id)).
+		Json(suite.T(), &api.RuleApplyRequest{}).
+		ExpectName(suite.T(), "preview apply rule", false).Json(suite.T(), preview).e.Status(200).Done()
+	getDocument(suite.T(), suite.adminHttp, testDocumentX86Intel.Id, 404)
+
+	status := &services.RuleApplyStatus{}
+	suite.userHttp.Post(fmt.Sprintf("/api/v1/processing/rules/%d/apply", rule.Id)).
+		Json(suite.T(), &api.RuleApplyRequest{Confirm: true}).
+		ExpectName(suite.T(), "apply rule", false).Json(suite.T(), status).e.Status(200).Done()
+	for i := 0; i < 50 && status.Running; i++ {
+		time.Sleep(time.Millisecond * 100)
+		suite.userHttp.Get(fmt.Sprintf("/api/v1/processing/rules/%d/apply", rule.Id)).
+			ExpectName(suite.T(), "get apply status", false).Json(suite.T(), status).e.Status(200).Done()
+	}
+	assert.Equal(suite.T(), "", status.Error)
+
+	doc := getDocument(suite.T(), suite.adminHttp, testDocumentX86Intel.Id, 200)
+	assert.Equal(suite.T(), "fi", doc.Lang)
+
+	history := getDocumentHistory(suite.T(), suite.userHttp, testDocumentX86Intel.Id, 200)
+	actions := map[string]int{}
+	for _, v := range *history {
+		actions[v.Action] = v.RuleId
+	}
+	assert.Equal(suite.T(), rule.Id, actions["share"])
+	assert.Equal(suite.T(), rule.Id, actions["lang"])
+}
@@ -509,6 +509,73 @@ func (suite *RuleProcessingTestSuite) TestConditionMetadata() {
 	assert.Equal(suite.T(), docX86.Name, testDocumentX86.Name)
 }
 
+func (suite *RuleProcessingTestSuite) TestStopProcessingAndTrace() {
+	stopRule := &api.Rule{
+		Name:           "stop processing",
+		Enabled:        true,
+		Mode:           "match_all",
+		StopProcessing: true,
+		Conditions: []api.RuleCondition{
+			{
+				ConditionType:   "content_contains",
+				Value:           "personal",
+				Enabled:         true,
+				CaseInsensitive: true,
+			},
+		},
+		Actions: []api.RuleAction{
+			{Action: "description_append", Value: " first", Enabled: true, OnCondition: true},
+		},
+	}
+	skippedRule := &api.Rule{
+		Name:    "not run",
+		Enabled: true,
+		Mode:    "match_all",
+		Conditions: []api.RuleCondition{
+			{ConditionType: "content_contains", Value: "personal", Enabled: true, CaseInsensitive: true},
+		},
+		Actions: []api.RuleAction{
+			{Action: "description_append", Value: " second", Enabled: true, OnCondition: true},
+		},
+	}
+
+	gotRule := addRule(suite.T(), suite.userHttp, stopRule, 200, "add rule")
+	assert.True(suite.T(), gotRule.StopProcessing)
+	addRule(suite.T(), suite.userHttp, skippedRule, 200, "add rule")
+
+	requestDocumentProcessing(suite.T(), suite.userHttp, testDocumentX86Intel.Id, 200)
+	time.Sleep(time.Second)
+	waitIndexingReady(suite.T(), suite.userHttp, 10)
+
+	doc := getDocument(suite.T(), suite.userHttp, testDocumentX86Intel.Id, 200)
+	assert.Equal(suite.T(), "description - x86 intel first", doc.Description)
+
+	getDocumentRulesTrace(suite.T(), suite.adminHttp, testDocumentX86Intel.Id, 404)
+	traces := getDocumentRulesTrace(suite.T(), suite.userHttp, testDocumentX86Intel.Id, 200)
+	if assert.Len(suite.T(), *traces, 1) {
+		trace := (*traces)[0]
+		assert.Equal(suite.T(), models.IntId(gotRule.Id), trace.RuleId)
+		assert.Equal(suite.T(), "stop processing", trace.RuleName)
+		assert.True(suite.T(), trace.Matched)
+		assert.True(suite.T(), trace.Stopped)
+		assert.Len(suite.T(), trace.Conditions, 1)
+		assert.True(suite.T(), trace.Conditions[0].Matched)
+		assert.Len(suite.T(), trace.Actions, 1)
+		assert.Equal(suite.T(), "description_append", trace.Actions[0].ActionType)
+	}
+}
+
+func getDocumentRulesTrace(t *testing.T, client *httpClient, docId string, wantHttpStatus int) *[]models.DocumentRuleTrace {
+	dto := &[]models.DocumentRuleTrace{}
+	req := client.Get("/api/v1/documents/" + docId + "/rules-trace").Expect(t)
+	if wantHttpStatus == 200 {
+		req.Json(t, dto).e.Status(200).Done()
+		return dto
+	}
+	req.e.Status(wantHttpStatus).Done()
+	return nil
+}
+
 func requestDocumentProcessing(t *testing.T, client *httpClient, docId string, expectStatus int) {
 	client.Post(fmt.Sprintf("/api/v1/documents/%s/process", docId)).Expect(t).e.Status(expectStatus).Done()
 }
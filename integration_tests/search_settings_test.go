@@ -0,0 +1,96 @@
+package integrationtest
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"tryffel.net/go/virtualpaper/api"
+	"tryffel.net/go/virtualpaper/models"
+)
+
+func TestSearchSettings(t *testing.T) {
+	suite.Run(t, new(SearchSettingsTestSuite))
+}
+
+type SearchSettingsTestSuite struct {
+	ApiTestSuite
+}
+
+func (suite *SearchSettingsTestSuite) SetupTest() {
+	suite.Init()
+	clearSearchSettingsTables(suite.T(), suite.db)
+}
+
+func (suite *SearchSettingsTestSuite) TestSynonyms() {
+	synonym := addSearchSynonym(suite.T(), suite.userHttp, []string{"Car", " automobile ", "car"}, 200)
+	assert.Equal(suite.T(), []string{"car", "automobile"}, synonym.Words, "words are normalized")
+
+	addSearchSynonym(suite.T(), suite.userHttp, []string{"car"}, 400)
+	addSearchSynonym(suite.T(), suite.userHttp, []string{"two words", "car"}, 400)
+
+	updated := updateSearchSynonym(suite.T(), suite.userHttp, synonym.Id, []string{"car", "vehicle"}, 200)
+	assert.Equal(suite.T(), []string{"car", "vehicle"}, updated.Words)
+	updateSearchSynonym(suite.T(), suite.adminHttp, synonym.Id, []string{"car", "truck"}, 404)
+
+	settings := getSearchSettings(suite.T(), suite.userHttp)
+	if assert.Len(suite.T(), settings.Synonyms, 1) {
+		assert.Equal(suite.T(), []string{"car", "vehicle"}, settings.Synonyms[0].Words)
+	}
+	assert.Len(suite.T(), getSearchSettings(suite.T(), suite.adminHttp).Synonyms, 0, "settings are per user")
+
+	deleteSearchSynonym(suite.T(), suite.adminHttp, synonym.Id, 404)
+	deleteSearchSynonym(suite.T(), suite.userHttp, synonym.Id, 200)
+	assert.Len(suite.T(), getSearchSettings(suite.T(), suite.userHttp).Synonyms, 0)
+}
+
+func (suite *SearchSettingsTestSuite) TestStopWordsAndRanking() {
+	words := &api.SearchWordsRequest{}
+	suite.userHttp.Put("/api/v1/preferences/search/stop-words").Json(suite.T(), &api.SearchWordsRequest{Words: []string{"The", "of", "the"}}).
+		ExpectName(suite.T(), "update stop words", false).Json(suite.T(), words).e.Status(200).Done()
+	assert.Equal(suite.T(), []string{"of", "the"}, words.Words)
+
+	suite.userHttp.Put("/api/v1/preferences/search/ranking").Json(suite.T(), &api.SearchRankingRequest{Rules: []string{"date:desc", "name:asc"}}).
+		ExpectName(suite.T(), "update ranking", false).e.Status(200).Done()
+	suite.userHttp.Put("/api/v1/preferences/search/ranking").Json(suite.T(), &api.SearchRankingRequest{Rules: []string{"content:desc"}}).
+		ExpectName(suite.T(), "update invalid ranking", false).e.Status(400).Done()
+
+	settings := getSearchSettings(suite.T(), suite.userHttp)
+	assert.Equal(suite.T(), []string{"of", "the"}, settings.StopWords)
+	assert.Equal(suite.T(), []string{"date:desc", "name:asc"}, settings.Ranking)
+}
+
+func getSearchSettings(t *testing.T, client *httpClient) *models.SearchSettings {
+	settings := &models.SearchSettings{}
+	client.Get("/api/v1/preferences/search").ExpectName(t, "get search settings", false).Json(t, settings).e.Status(200).Done()
+	return settings
+}
+
+func addSearchSynonym(t *testing.T, client *httpClient, words []string, wantHttpStatus int) *models.SearchSynonym {
+	synonym := &models.SearchSynonym{}
+	req := client.Post("/api/v1/preferences/search/synonyms").Json(t, &api.SearchSynonymRequest{Words: words}).
+		ExpectName(t, "add search synonym", false)
+	if wantHttpStatus == 200 {
+		req.Json(t, synonym).e.Status(wantHttpStatus).Done()
+	} else {
+		req.e.Status(wantHttpStatus).Done()
+	}
+	return synonym
+}
+
+func updateSearchSynonym(t *testing.T, client *httpClient, id int, words []string, wantHttpStatus int) *models.SearchSynonym {
+	synonym := &models.SearchSynonym{}
+	req := client.Put(fmt.Sprintf("/api/v1/preferences/search/synonyms/%d", id)).Json(t, &api.SearchSynonymRequest{Words: words}).
+		ExpectName(t, "update search synonym", false)
+	if wantHttpStatus == 200 {
+		req.Json(t, synonym).e.Status(wantHttpStatus).Done()
+	} else {
+		req.e.Status(wantHttpStatus).Done()
+	}
+	return synonym
+}
+
+func deleteSearchSynonym(t *testing.T, client *httpClient, id int, wantHttpStatus int) {
+	client.Delete(fmt.Sprintf("/api/v1/preferences/search/synonyms/%d", id)).
+		ExpectName(t, "delete search synonym", false).e.Status(wantHttpStatus).Done()
+}
@@ -0,0 +1,59 @@
+package integrationtest
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+	"testing"
+	"tryffel.net/go/virtualpaper/models"
+	"tryffel.net/go/virtualpaper/services/process"
+)
+
+func TestSimilarDocuments(t *testing.T) {
+	suite.Run(t, new(SimilarDocumentsTestSuite))
+}
+
+type SimilarDocumentsTestSuite struct {
+	ApiTestSuite
+}
+
+func (suite *SimilarDocumentsTestSuite) SetupTest() {
+	suite.Init()
+	clearDbDocumentTables(suite.T(), suite.db)
+	_ = insertTestDocuments(suite.T(), suite.db)
+
+	for _, v := range testDocuments {
+		err := suite.db.DocumentStore.SetSimilaritySignature(v.UserId, v.Id, process.MinHashSignature(v.Content))
+		if err != nil {
+			suite.T().Errorf("set similarity signature: %v", err)
+		}
+	}
+}
+
+func (suite *SimilarDocumentsTestSuite) TestSimilarByContent() {
+	docs := getSimilarDocuments(suite.T(), suite.userHttp, testDocumentX86.Id, 200)
+	if assert.NotEmpty(suite.T(), *docs) {
+		assert.Equal(suite.T(), testDocumentX86Intel.Id, (*docs)[0].DocumentId)
+		assert.Greater(suite.T(), (*docs)[0].ContentScore, 0.0)
+	}
+	for _, v := range *docs {
+		assert.NotEqual(suite.T(), testDocumentX86.Id, v.DocumentId, "document itself is not similar")
+		assert.NotEqual(suite.T(), testDocumentTransistorCountAdminUser.Id, v.DocumentId, "other user's documents are not listed")
+	}
+}
+
+func (suite *SimilarDocumentsTestSuite) TestInvalidPermissions() {
+	getSimilarDocuments(suite.T(), suite.userHttp, testDocumentTransistorCountAdminUser.Id, 404)
+	getSimilarDocuments(suite.T(), suite.userHttp, "1234", 404)
+}
+
+func getSimilarDocuments(t *testing.T, client *httpClient, docId string, wantHttpStatus int) *[]models.SimilarDocument {
+	data := &[]models.SimilarDocument{}
+	req := client.Get(fmt.Sprintf("/api/v1/documents/%s/similar", docId))
+	if wantHttpStatus == 200 {
+		req.ExpectName(t, "get similar documents", false).Json(t, data).e.Status(wantHttpStatus).Done()
+	} else {
+		req.ExpectName(t, "get similar documents", false).e.Status(wantHttpStatus).Done()
+	}
+	return data
+}
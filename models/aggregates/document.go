@@ -30,6 +30,51 @@ type Document struct {
 	Tags        []models.Tag           `json:"tags"`
 	Lang        string                 `json:"lang"`
 	Shares      int                    `json:"shares"`
+	// PageCount is 0 if not known
+	PageCount int `json:"page_count"`
+	// ids of documents that are likely duplicates of this document
+	Duplicates []string `json:"duplicates"`
+	// DocumentTypeId is the user-defined document type, 0 if document has no type.
+	DocumentTypeId int `json:"document_type_id"`
+	// MissingMetadata are the required keys of the document type that document does not have.
+	MissingMetadata []models.DocumentTypeKey `json:"missing_metadata"`
+	// MetadataSuggestions are the metadata values that were learned to likely belong to the document.
+	MetadataSuggestions []models.MetadataSuggestion `json:"metadata_suggestions"`
+	// Invoice are the fields that were extracted from the content, and the paid date set by user.
+	Invoice InvoiceFields `json:"invoice"`
+}
+
+// InvoiceFields are the fields extracted from the invoice. Empty strings and nulls were not found.
+type InvoiceFields struct {
+	Iban      string   `json:"iban"`
+	Reference string   `json:"reference"`
+	Amount    *float64 `json:"amount"`
+	Currency  string   `json:"currency"`
+	VatNumber string   `json:"vat_number"`
+	// swagger:strfmt either null or unix epoch in milliseconds
+	DueDate interface{} `json:"due_date"`
+	// Paid is set by the user.
+	Paid bool `json:"paid"`
+	// swagger:strfmt either null or unix epoch in milliseconds
+	PaidDate interface{} `json:"paid_date"`
+}
+
+func invoiceFieldsToAggregate(fields *models.InvoiceFields) InvoiceFields {
+	invoice := InvoiceFields{
+		Iban:      fields.Iban,
+		Reference: fields.Reference,
+		Amount:    fields.Amount,
+		Currency:  fields.Currency,
+		VatNumber: fields.VatNumber,
+	}
+	if fields.DueDate != nil {
+		invoice.DueDate = fields.DueDate.Unix() * 1000
+	}
+	if fields.PaidAt != nil {
+		invoice.Paid = true
+		invoice.PaidDate = fields.PaidAt.Unix() * 1000
+	}
+	return invoice
 }
 
 func DocumentToAggregate(doc *models.Document, shares *[]models.DocumentSharePermission) *Document {
@@ -52,6 +97,13 @@ func DocumentToAggregate(doc *models.Document, shares *[]models.DocumentSharePer
 		Tags:        doc.Tags,
 		Lang:        doc.Lang.String(),
 		Shares:      doc.Shares,
+		PageCount:   doc.PageCount,
+		Duplicates:  []string{},
+
+		DocumentTypeId:      int(doc.DocumentTypeId),
+		MissingMetadata:     []models.DocumentTypeKey{},
+		MetadataSuggestions: []models.MetadataSuggestion{},
+		Invoice:             invoiceFieldsToAggregate(&doc.InvoiceFields),
 	}
 	if doc.DeletedAt.Valid {
 		resp.DeletedAt = doc.DeletedAt.Time.Unix() * 1000
@@ -96,6 +148,8 @@ type BulkEditDocumentsRequest struct {
 type Metadata struct {
 	KeyId   int `json:"key_id"`
 	ValueId int `json:"value_id"`
+	// Value is a free-form value for typed keys, used if ValueId is 0.
+	Value string `json:"value,omitempty"`
 }
 
 func (m Metadata) ToMetadata() models.Metadata {
@@ -137,6 +191,8 @@ type DocumentUpdate struct {
 	Date        time.Time
 	Metadata    MetadataArray
 	Lang        string
+	// DocumentTypeId is the new document type, 0 to remove the type.
+	DocumentTypeId int
 }
 
 type UserDocumentStatistics struct {
@@ -168,6 +224,14 @@ type DocumentUpdateSharingRequest struct {
 	Users []UserPermissions `json:"users" valid:"-"`
 }
 
+// DocumentInvoicePaidRequest
+// swagger:model DocumentInvoicePaidRequestBody
+type DocumentInvoicePaidRequest struct {
+	Paid bool `json:"paid" valid:"-"`
+	// PaidDate in unix milliseconds. Defaults to today if paid and not set.
+	PaidDate int64 `json:"paid_date" valid:"-"`
+}
+
 type UserPermissions struct {
 	UserId      int                `json:"user_id" valid:"-"`
 	Permissions models.Permissions `json:"permissions" valid:"-"`
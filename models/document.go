@@ -49,6 +49,12 @@ type Document struct {
 	Tags        []Tag
 	Lang        Lang `db:"lang"`
 	Shares      int  `db:"shares"`
+	// PageCount is the number of pages, or 0 if not known.
+	PageCount int `db:"page_count"`
+	// DocumentTypeId is the user-defined document type, or 0 if document has no type.
+	DocumentTypeId IntId `db:"document_type_id"`
+	// InvoiceFields are extracted from the content in processing step ProcessExtractFields.
+	InvoiceFields
 
 	DeletedAt sql.NullTime `db:"deleted_at"`
 }
@@ -106,7 +112,8 @@ func (d *Document) GetSize() string {
 
 func (d *Document) FilterAttributes() []string {
 	ts := d.Timestamp.FilterAttributes()
-	doc := []string{"id", "name", "content", "description", "filename", "hash", "mimetype", "size", "date", "deleted_at", "created_at", "updated_at"}
+	doc := []string{"id", "name", "content", "description", "filename", "hash", "mimetype", "size", "date", "deleted_at", "created_at", "updated_at", "document_type_id",
+		"invoice_amount", "invoice_due_date"}
 	return append(doc, ts...)
 }
 
@@ -146,6 +153,8 @@ type Metadata struct {
 	Style   string `db:"style" json:"style"`
 	ValueId int    `db:"value_id" json:"value_id"`
 	Value   string `db:"value" json:"value"`
+	// KeyType is the type of the key. Empty type is treated as text.
+	KeyType MetadataKeyType `db:"key_type" json:"key_type,omitempty"`
 }
 
 type MetadataKey struct {
@@ -156,6 +165,11 @@ type MetadataKey struct {
 	Comment   string    `db:"comment" json:"comment"`
 	Icon      string    `db:"icon" json:"icon"`
 	Style     string    `db:"style" json:"style"`
+	// Type defines the values the key accepts, see MetadataKeyType.
+	Type MetadataKeyType `db:"value_type" json:"type"`
+	// AutoApplyThreshold is the confidence (0-1) above which suggested values are added to documents automatically.
+	// 0 disables adding suggestions.
+	AutoApplyThreshold float64 `db:"auto_apply_threshold" json:"auto_apply_threshold"`
 }
 
 func MetadataDiff(id string, userId int, original, updated *[]Metadata) []DocumentHistory {
@@ -221,6 +235,8 @@ type MetadataKeyStatistics struct {
 type MetadataKeyAnnotated struct {
 	MetadataKey
 	MetadataKeyStatistics
+	// Shared is true if the key belongs to another user and is used through a vocabulary.
+	Shared bool `db:"shared" json:"shared"`
 }
 
 func (m *MetadataKey) Update() {}
@@ -251,13 +267,24 @@ type MetadataValue struct {
 	MatchDocuments bool             `db:"match_documents" json:"match_documents"`
 	MatchType      MetadataRuleType `db:"match_type" json:"match_type"`
 	MatchFilter    string           `db:"match_filter" json:"match_filter"`
+
+	// Typed values are set for values of typed keys, see MetadataKeyType.
+	NumberValue *float64   `db:"value_number" json:"number_value,omitempty"`
+	DateValue   *time.Time `db:"value_date" json:"date_value,omitempty"`
+	BoolValue   *bool      `db:"value_bool" json:"bool_value,omitempty"`
+	Currency    string     `db:"value_currency" json:"currency,omitempty"`
+
+	// ParentId is the parent value in a hierarchy of values, or 0 if value is at the top level.
+	ParentId IntId `db:"parent_id" json:"parent_id"`
+	// Children are set when values are returned as a tree.
+	Children []*MetadataValue `db:"-" json:"children,omitempty"`
 }
 
 func (m *MetadataValue) Update() {}
 
 func (m *MetadataValue) FilterAttributes() []string {
 	return []string{"id", "key", "value", "created_at", "comment", "documents_count",
-		"match_documents", "match_type", "match_filter"}
+		"match_documents", "match_type", "match_filter", "parent_id"}
 }
 
 func (m *MetadataValue) SortAttributes() []string {
@@ -268,6 +295,31 @@ func (m *MetadataValue) SortNoCase() []string {
 	return []string{"key", "value", "comment", "match_filter"}
 }
 
+// MaxMetadataValueDepth is the maximum depth of metadata value hierarchy.
+const MaxMetadataValueDepth = 10
+
+// MetadataValueTree arranges values into a tree by their parents, keeping the order of the values.
+// Values whose parent is not in values are returned as roots.
+func MetadataValueTree(values []MetadataValue) []*MetadataValue {
+	byId := make(map[int]*MetadataValue, len(values))
+	for i := range values {
+		values[i].Children = nil
+		byId[values[i].Id] = &values[i]
+	}
+
+	roots := make([]*MetadataValue, 0, len(values))
+	for i := range values {
+		value := &values[i]
+		parent, ok := byId[int(value.ParentId)]
+		if value.ParentId == 0 || !ok || parent == value {
+			roots = append(roots, value)
+			continue
+		}
+		parent.Children = append(parent.Children, value)
+	}
+	return roots
+}
+
 type DocumentHistory struct {
 	Id         int       `db:"id" json:"id"`
 	DocumentId string    `db:"document_id" json:"document_id"`
@@ -276,6 +328,7 @@ type DocumentHistory struct {
 	NewValue   string    `db:"new_value" json:"new_value"`
 	UserId     int       `db:"user_id" json:"user_id"`
 	User       string    `db:"user" json:"user"`
+	RuleId     int       `db:"rule_id" json:"rule_id"`
 	CreatedAt  time.Time `db:"created_at" json:"created_at"`
 }
 
@@ -311,6 +364,17 @@ const (
 	DocumentHistoryActionMetadataAdd    = "add metadata"
 	DocumentHistoryActionDelete         = "delete"
 	DocumentHistoryActionRestore        = "restore"
+	DocumentHistoryActionMergeDuplicate = "merge duplicate"
+	DocumentHistoryActionMergedInto     = "merged into"
+	DocumentHistoryActionShare          = "share"
+	DocumentHistoryActionLink           = "link document"
+	DocumentHistoryActionNotification   = "notification"
+	DocumentHistoryActionMetadataMerge  = "merge metadata"
+	DocumentHistoryActionDocumentType   = "document type"
+	DocumentHistoryActionNoteAdd        = "add note"
+	DocumentHistoryActionNoteEdit       = "edit note"
+	DocumentHistoryActionNoteRemove     = "remove note"
+	DocumentHistoryActionInvoicePaid    = "invoice paid"
 )
 
 // Diffs returns a list of DocumentHistory items from d -> newDocument.
@@ -350,12 +414,84 @@ func (d *Document) Diff(newDocument *Document, userId int) ([]DocumentHistory, e
 	if d.Lang != d2.Lang {
 		addHistoryItem(DocumentHistoryActionLanguage, d.Lang.String(), d2.Lang.String())
 	}
+	if d.DocumentTypeId != d2.DocumentTypeId {
+		addHistoryItem(DocumentHistoryActionDocumentType, formatDocumentTypeId(d.DocumentTypeId), formatDocumentTypeId(d2.DocumentTypeId))
+	}
 	return history, nil
 }
 
+func formatDocumentTypeId(id IntId) string {
+	if id == 0 {
+		return ""
+	}
+	return strconv.Itoa(int(id))
+}
+
 // LinkedDocument represents documents that are linked together
 type LinkedDocument struct {
 	DocumentId   string    `json:"id"`
 	DocumentName string    `json:"name"`
 	CreatedAt    time.Time `json:"created_at"`
 }
+
+// SimilarDocument is a document ranked by its similarity to another document.
+// Score is a combination of ContentScore and MetadataScore, each in range [0, 1].
+type SimilarDocument struct {
+	DocumentId     string    `json:"id"`
+	DocumentName   string    `json:"name"`
+	Date           time.Time `json:"date"`
+	Score          float64   `json:"score"`
+	ContentScore   float64   `json:"content_score"`
+	MetadataScore  float64   `json:"metadata_score"`
+	SharedMetadata int       `json:"shared_metadata"`
+}
+
+// DocumentIndexState is the minimal document info needed to verify that the search index is up-to-date.
+type DocumentIndexState struct {
+	DocumentId string    `db:"id"`
+	UserId     int       `db:"user_id"`
+	UpdatedAt  time.Time `db:"updated_at"`
+}
+
+// DocumentFingerprint contains fingerprints of document content and its thumbnail.
+// Similar documents have similar fingerprints, which is used to detect near-duplicate documents.
+// Fingerprint is null if it cannot be computed, e.g. document has too little content.
+type DocumentFingerprint struct {
+	DocumentId  string        `db:"document_id"`
+	ContentHash sql.NullInt64 `db:"content_hash"`
+	ImageHash   sql.NullInt64 `db:"image_hash"`
+}
+
+// DocumentDuplicate is a pair of documents that are likely duplicates of each other.
+// DocA is always less than DocB.
+type DocumentDuplicate struct {
+	DocA            string        `db:"doc_a_id"`
+	DocB            string        `db:"doc_b_id"`
+	ContentDistance sql.NullInt32 `db:"content_distance"`
+	ImageDistance   sql.NullInt32 `db:"image_distance"`
+}
+
+// DuplicateDocument is a document in a duplicate cluster.
+type DuplicateDocument struct {
+	DocumentId string    `json:"id" db:"id"`
+	Name       string    `json:"name" db:"name"`
+	Date       time.Time `json:"date" db:"date"`
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+	Size       int64     `json:"size" db:"size"`
+	Mimetype   string    `json:"mimetype" db:"mimetype"`
+}
+
+// DuplicateCluster is a group of documents that are likely duplicates of each other.
+type DuplicateCluster struct {
+	Documents []DuplicateDocument `json:"documents"`
+}
+
+// SimilarityCandidate contains the data needed to compare document against another document.
+type SimilarityCandidate struct {
+	DocumentId     string    `db:"document_id"`
+	DocumentName   string    `db:"name"`
+	Date           time.Time `db:"date"`
+	Signature      []int64   `db:"-"`
+	MetadataCount  int       `db:"metadata_count"`
+	SharedMetadata int       `db:"shared_metadata"`
+}
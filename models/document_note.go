@@ -0,0 +1,80 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"tryffel.net/go/virtualpaper/errors"
+)
+
+// MaxDocumentNoteLength is the maximum length of the note content in characters.
+const MaxDocumentNoteLength = 10000
+
+// DocumentNote is a free-form note attached to a document by the owner or a user the document is shared with.
+// The note can optionally be anchored to a page and to a position on the page.
+type DocumentNote struct {
+	Timestamp
+	Id         int    `db:"id" json:"id"`
+	DocumentId string `db:"document_id" json:"document_id"`
+	UserId     int    `db:"user_id" json:"user_id"`
+	UserName   string `db:"user_name" json:"user_name"`
+	Content    string `db:"content" json:"content"`
+	// Page starts from 1. 0 means the note is for the whole document.
+	Page IntId `db:"page" json:"page"`
+	// PositionX and PositionY are relative to page size, between 0 and 1. Nil if the note is not anchored to a position.
+	PositionX *float64 `db:"position_x" json:"position_x"`
+	PositionY *float64 `db:"position_y" json:"position_y"`
+
+	// Editable and Deletable tell whether the requesting user can modify the note.
+	Editable  bool `db:"-" json:"editable"`
+	Deletable bool `db:"-" json:"deletable"`
+}
+
+// Validate normalizes the content and ensures the anchor is valid.
+func (n *DocumentNote) Validate() error {
+	invalid := func(format string, args ...interface{}) error {
+		e := errors.ErrInvalid
+		e.ErrMsg = fmt.Sprintf(format, args...)
+		return e
+	}
+	n.Content = strings.TrimSpace(n.Content)
+	if n.Content == "" {
+		return invalid("note content is required")
+	}
+	if len([]rune(n.Content)) > MaxDocumentNoteLength {
+		return invalid("note can be at most %d characters", MaxDocumentNoteLength)
+	}
+	if (n.PositionX == nil) != (n.PositionY == nil) {
+		return invalid("both x and y position are required")
+	}
+	if n.PositionX == nil {
+		return nil
+	}
+	if n.Page == 0 {
+		return invalid("page is required when position is set")
+	}
+	for _, v := range []float64{*n.PositionX, *n.PositionY} {
+		if v < 0 || v > 1 {
+			return invalid("position must be between 0 and 1, got %v", v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2020  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDocumentNote_Validate(t *testing.T) {
+	position := func(v float64) *float64 {
+		return &v
+	}
+
+	tests := []struct {
+		name    string
+		note    DocumentNote
+		wantErr bool
+	}{
+		{name: "content", note: DocumentNote{Content: "called them, they promised refund"}},
+		{name: "empty content", note: DocumentNote{Content: "  \n "}, wantErr: true},
+		{name: "too long", note: DocumentNote{Content: strings.Repeat("a", MaxDocumentNoteLength+1)}, wantErr: true},
+		{name: "page", note: DocumentNote{Content: "note", Page: 2}},
+		{name: "position", note: DocumentNote{Content: "note", Page: 1, PositionX: position(0), PositionY: position(1)}},
+		{name: "position without page", note: DocumentNote{Content: "note", PositionX: position(0.5), PositionY: position(0.5)}, wantErr: true},
+		{name: "only x", note: DocumentNote{Content: "note", Page: 1, PositionX: position(0.5)}, wantErr: true},
+		{name: "position out of page", note: DocumentNote{Content: "note", Page: 1, PositionX: position(0.5), PositionY: position(1.2)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.note.Validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	note := &DocumentNote{Content: "  trimmed\n"}
+	assert.NoError(t, note.Validate())
+	assert.Equal(t, "trimmed", note.Content)
+}
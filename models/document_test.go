@@ -33,6 +33,7 @@ func TestDocument_Diff(t *testing.T) {
 		Content     string
 		Date        time.Time
 		Metadata    []Metadata
+		TypeId      IntId
 	}
 	type args struct {
 		newDocument *Document
@@ -95,6 +96,26 @@ func TestDocument_Diff(t *testing.T) {
 				{DocumentId: "id", Action: "description", OldValue: "empty", NewValue: "description"},
 			},
 		},
+		{
+			name: "change document type",
+			fields: fields{
+				Id:     "id",
+				TypeId: 2,
+			},
+			args:    args{newDocument: &Document{Id: "id", DocumentTypeId: 5}},
+			wantErr: false,
+			want:    []DocumentHistory{{DocumentId: "id", Action: "document type", OldValue: "2", NewValue: "5"}},
+		},
+		{
+			name: "remove document type",
+			fields: fields{
+				Id:     "id",
+				TypeId: 2,
+			},
+			args:    args{newDocument: &Document{Id: "id"}},
+			wantErr: false,
+			want:    []DocumentHistory{{DocumentId: "id", Action: "document type", OldValue: "2", NewValue: ""}},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -105,6 +126,8 @@ func TestDocument_Diff(t *testing.T) {
 				Content:     tt.fields.Content,
 				Date:        tt.fields.Date,
 				Metadata:    tt.fields.Metadata,
+
+				DocumentTypeId: tt.fields.TypeId,
 			}
 			got, err := d.Diff(tt.args.newDocument, tt.args.userId)
 			if (err != nil) != tt.wantErr {
@@ -176,3 +199,29 @@ func TestDocument_Metadata_Diff(t *testing.T) {
 		})
 	}
 }
+
+func TestMetadataValueTree(t *testing.T) {
+	values := []MetadataValue{
+		{Id: 1, Value: "acme"},
+		{Id: 2, Value: "2024", ParentId: 1},
+		{Id: 3, Value: "phase-2", ParentId: 2},
+		{Id: 4, Value: "2023", ParentId: 1},
+		{Id: 5, Value: "other"},
+		{Id: 6, Value: "orphan", ParentId: 100},
+	}
+
+	tree := MetadataValueTree(values)
+	if assert.Len(t, tree, 3) {
+		assert.Equal(t, "acme", tree[0].Value)
+		assert.Equal(t, "other", tree[1].Value)
+		assert.Equal(t, "orphan", tree[2].Value)
+	}
+	if assert.Len(t, tree[0].Children, 2) {
+		assert.Equal(t, "2024", tree[0].Children[0].Value)
+		assert.Equal(t, "2023", tree[0].Children[1].Value)
+		if assert.Len(t, tree[0].Children[0].Children, 1) {
+			assert.Equal(t, "phase-2", tree[0].Children[0].Children[0].Value)
+		}
+	}
+	assert.Empty(t, tree[1].Children)
+}
@@ -0,0 +1,84 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package models
+
+// DocumentType is a user-defined kind of document, e.g. invoice or contract.
+// It lists the metadata keys that documents of the type are expected to have.
+type DocumentType struct {
+	Timestamp
+	Id          int    `db:"id" json:"id"`
+	UserId      int    `db:"user_id" json:"-"`
+	Name        string `db:"name" json:"name"`
+	Description string `db:"description" json:"description"`
+
+	Keys []DocumentTypeKey `db:"-" json:"keys"`
+}
+
+func (d *DocumentType) FilterAttributes() []string {
+	return []string{"id", "name", "description", "created_at", "updated_at"}
+}
+
+func (d *DocumentType) SortAttributes() []string {
+	return d.FilterAttributes()
+}
+
+func (d *DocumentType) SortNoCase() []string {
+	return []string{"name", "description"}
+}
+
+// DocumentTypeKey is a metadata key in document type.
+type DocumentTypeKey struct {
+	DocumentTypeId int    `db:"document_type_id" json:"-"`
+	KeyId          int    `db:"key_id" json:"key_id"`
+	Key            string `db:"key" json:"key"`
+	Required       bool   `db:"required" json:"required"`
+	// DefaultValueId is added to documents that do not have the key when the type is set. 0 if no default.
+	DefaultValueId IntId `db:"default_value_id" json:"default_value_id"`
+}
+
+// MissingKeys returns the required keys that the metadata does not have.
+func (d *DocumentType) MissingKeys(metadata []Metadata) []DocumentTypeKey {
+	missing := make([]DocumentTypeKey, 0)
+	for _, key := range d.Keys {
+		if key.Required && !hasMetadataKey(metadata, key.KeyId) {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
+
+// Defaults returns the default values for the keys that the metadata does not have.
+func (d *DocumentType) Defaults(metadata []Metadata) []Metadata {
+	defaults := make([]Metadata, 0)
+	for _, key := range d.Keys {
+		if key.DefaultValueId != 0 && !hasMetadataKey(metadata, key.KeyId) {
+			defaults = append(defaults, Metadata{KeyId: key.KeyId, ValueId: int(key.DefaultValueId)})
+		}
+	}
+	return defaults
+}
+
+func hasMetadataKey(metadata []Metadata, keyId int) bool {
+	for _, v := range metadata {
+		if v.KeyId == keyId {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2020  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDocumentType_MissingKeys(t *testing.T) {
+	docType := &DocumentType{
+		Keys: []DocumentTypeKey{
+			{KeyId: 1, Key: "company", Required: true},
+			{KeyId: 2, Key: "amount", Required: true},
+			{KeyId: 3, Key: "project", Required: false},
+		},
+	}
+
+	assert.Equal(t, []DocumentTypeKey{docType.Keys[0], docType.Keys[1]}, docType.MissingKeys(nil))
+	assert.Equal(t, []DocumentTypeKey{docType.Keys[1]}, docType.MissingKeys([]Metadata{{KeyId: 1, ValueId: 10}, {KeyId: 4, ValueId: 11}}))
+	assert.Equal(t, []DocumentTypeKey{}, docType.MissingKeys([]Metadata{{KeyId: 1, ValueId: 10}, {KeyId: 2, ValueId: 12}}))
+}
+
+func TestDocumentType_Defaults(t *testing.T) {
+	docType := &DocumentType{
+		Keys: []DocumentTypeKey{
+			{KeyId: 1, Key: "company", Required: true},
+			{KeyId: 2, Key: "category", Required: true, DefaultValueId: 20},
+			{KeyId: 3, Key: "project", DefaultValueId: 30},
+		},
+	}
+
+	assert.Equal(t, []Metadata{{KeyId: 2, ValueId: 20}, {KeyId: 3, ValueId: 30}}, docType.Defaults(nil))
+	assert.Equal(t, []Metadata{{KeyId: 3, ValueId: 30}}, docType.Defaults([]Metadata{{KeyId: 2, ValueId: 21}}))
+}
@@ -0,0 +1,158 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// InvoiceFields are the structured fields extracted from the document content.
+// Empty strings and nil values are fields that were not found.
+type InvoiceFields struct {
+	// Iban is the account number without spaces, e.g. 'FI2112345600000785'.
+	Iban string `db:"invoice_iban"`
+	// Reference is either Finnish reference number or RF creditor reference without spaces.
+	Reference string     `db:"invoice_reference"`
+	Amount    *float64   `db:"invoice_amount"`
+	Currency  string     `db:"invoice_currency"`
+	VatNumber string     `db:"invoice_vat_number"`
+	DueDate   *time.Time `db:"invoice_due_date"`
+	// PaidAt is set by the user when the invoice is paid, it is not extracted. Nil if invoice is not paid.
+	PaidAt *time.Time `db:"invoice_paid_at"`
+}
+
+// IsEmpty returns true if no fields were found.
+func (f *InvoiceFields) IsEmpty() bool {
+	return f.Iban == "" && f.Reference == "" && f.Amount == nil && f.Currency == "" && f.VatNumber == "" && f.DueDate == nil
+}
+
+// ibanLengths are the lengths of IBANs in European countries.
+var ibanLengths = map[string]int{
+	"AD": 24, "AT": 20, "AX": 18, "BE": 16, "BG": 22, "CH": 21, "CY": 28, "CZ": 24, "DE": 22, "DK": 18,
+	"EE": 20, "ES": 24, "FI": 18, "FO": 18, "FR": 27, "GB": 22, "GI": 23, "GL": 18, "GR": 27, "HR": 21,
+	"HU": 28, "IE": 22, "IS": 26, "IT": 27, "LI": 21, "LT": 20, "LU": 20, "LV": 21, "MC": 27, "MT": 31,
+	"NL": 18, "NO": 15, "PL": 28, "PT": 25, "RO": 24, "SE": 24, "SI": 19, "SK": 24, "SM": 27, "VA": 22,
+}
+
+// NormalizeIban removes spaces from the IBAN and converts it to upper case.
+func NormalizeIban(iban string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(iban), ""))
+}
+
+// ValidIban returns true if iban has valid length and checksum. Iban must be normalized.
+func ValidIban(iban string) bool {
+	if len(iban) < 15 || len(iban) > 34 || !isAlphaNumeric(iban) {
+		return false
+	}
+	if length, ok := ibanLengths[iban[:2]]; ok && len(iban) != length {
+		return false
+	}
+	if !isDigits(iban[2:4]) || iban[:2] == "RF" {
+		// creditor reference has the same checksum
+		return false
+	}
+	return mod97(iban[4:]+iban[:4]) == 1
+}
+
+// IbanLength returns the IBAN length of the country, or 0 if country is not known.
+func IbanLength(country string) int {
+	return ibanLengths[country]
+}
+
+// ValidFinnishReference returns true if reference is a valid Finnish bank reference number:
+// 4-20 digits, the last one being the check digit.
+func ValidFinnishReference(reference string) bool {
+	if len(reference) < 4 || len(reference) > 20 || !isDigits(reference) {
+		return false
+	}
+	weights := []int{7, 3, 1}
+	sum := 0
+	base := reference[:len(reference)-1]
+	for i := 0; i < len(base); i++ {
+		digit := int(base[len(base)-1-i] - '0')
+		sum += digit * weights[i%3]
+	}
+	check := (10 - sum%10) % 10
+	return check == int(reference[len(reference)-1]-'0')
+}
+
+// ValidCreditorReference returns true if reference is a valid international RF creditor reference (ISO 11649).
+func ValidCreditorReference(reference string) bool {
+	if len(reference) < 5 || len(reference) > 25 || !strings.HasPrefix(reference, "RF") {
+		return false
+	}
+	if !isDigits(reference[2:4]) || !isAlphaNumeric(reference[4:]) {
+		return false
+	}
+	return mod97(reference[4:]+reference[:4]) == 1
+}
+
+// ValidFinnishBusinessId returns true if id is a valid Finnish business id (Y-tunnus), e.g. '1234567-1'.
+func ValidFinnishBusinessId(id string) bool {
+	if len(id) != 9 || id[7] != '-' || !isDigits(id[:7]) || !isDigits(id[8:]) {
+		return false
+	}
+	weights := []int{7, 9, 10, 5, 8, 4, 2}
+	sum := 0
+	for i, w := range weights {
+		sum += int(id[i]-'0') * w
+	}
+	remainder := sum % 11
+	if remainder == 1 {
+		return false
+	}
+	check := 0
+	if remainder > 1 {
+		check = 11 - remainder
+	}
+	return check == int(id[8]-'0')
+}
+
+// mod97 computes the ISO 7064 remainder of value where letters are converted to numbers A=10 ... Z=35.
+func mod97(value string) int {
+	remainder := 0
+	for _, c := range value {
+		if c >= 'A' && c <= 'Z' {
+			n := int(c-'A') + 10
+			remainder = (remainder*100 + n) % 97
+		} else {
+			remainder = (remainder*10 + int(c-'0')) % 97
+		}
+	}
+	return remainder
+}
+
+func isDigits(value string) bool {
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return value != ""
+}
+
+func isAlphaNumeric(value string) bool {
+	for _, c := range value {
+		if (c < '0' || c > '9') && (c < 'A' || c > 'Z') {
+			return false
+		}
+	}
+	return value != ""
+}
@@ -0,0 +1,72 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidIban(t *testing.T) {
+	tests := []struct {
+		iban string
+		want bool
+	}{
+		{iban: "FI2112345600000785", want: true},
+		{iban: "DE89370400440532013000", want: true},
+		{iban: "GB82WEST12345698765432", want: true},
+		{iban: "FI2112345600000786", want: false},
+		{iban: "FI21123456000007", want: false},
+		{iban: "DE8937040044053201300", want: false},
+		{iban: "fi2112345600000785", want: false},
+		{iban: "FIXX12345600000785", want: false},
+		{iban: "RF18539007547034", want: false},
+		{iban: "", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.iban, func(t *testing.T) {
+			assert.Equal(t, tt.want, ValidIban(tt.iban))
+		})
+	}
+	assert.Equal(t, "FI2112345600000785", NormalizeIban("fi21 1234 5600 0007 85"))
+}
+
+func TestValidReferences(t *testing.T) {
+	assert.True(t, ValidFinnishReference("1232"))
+	assert.True(t, ValidFinnishReference("12345614"))
+	assert.True(t, ValidFinnishReference("20230000122"))
+	assert.False(t, ValidFinnishReference("1233"))
+	assert.False(t, ValidFinnishReference("123"))
+	assert.False(t, ValidFinnishReference("123456789012345678901"))
+	assert.False(t, ValidFinnishReference("12a2"))
+
+	assert.True(t, ValidCreditorReference("RF18539007547034"))
+	assert.True(t, ValidCreditorReference("RF712348231"))
+	assert.False(t, ValidCreditorReference("RF19539007547034"))
+	assert.False(t, ValidCreditorReference("RF18"))
+	assert.False(t, ValidCreditorReference("XX18539007547034"))
+}
+
+func TestValidFinnishBusinessId(t *testing.T) {
+	assert.True(t, ValidFinnishBusinessId("0112038-9"))
+	assert.False(t, ValidFinnishBusinessId("0112038-8"))
+	assert.False(t, ValidFinnishBusinessId("01120389"))
+	assert.False(t, ValidFinnishBusinessId("0112038-"))
+}
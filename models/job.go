@@ -86,34 +86,46 @@ func (jc *JobComposite) SetDuration() {
 type ProcessStep string
 
 const (
-	ProcessHash           ProcessStep = "hash"
-	ProcessThumbnail      ProcessStep = "thumbnail"
-	ProcessParseContent   ProcessStep = "extract"
-	ProcessDetectLanguage ProcessStep = "detect-language"
-	ProcessRules          ProcessStep = "rules"
-	ProcessFts            ProcessStep = "fts"
+	ProcessHash            ProcessStep = "hash"
+	ProcessThumbnail       ProcessStep = "thumbnail"
+	ProcessParseContent    ProcessStep = "extract"
+	ProcessDetectLanguage  ProcessStep = "detect-language"
+	ProcessExtractFields   ProcessStep = "extract-fields"
+	ProcessRules           ProcessStep = "rules"
+	ProcessFts             ProcessStep = "fts"
+	ProcessSimilarity      ProcessStep = "similarity"
+	ProcessDuplicates      ProcessStep = "duplicates"
+	ProcessSuggestMetadata ProcessStep = "suggest-metadata"
 )
 
 // ProcessStepsAll is a list of default steps to run for new document.
-var ProcessStepsAll = []ProcessStep{ProcessHash, ProcessThumbnail, ProcessParseContent, ProcessDetectLanguage, ProcessRules, ProcessFts}
+var ProcessStepsAll = []ProcessStep{ProcessHash, ProcessThumbnail, ProcessParseContent, ProcessDetectLanguage, ProcessExtractFields, ProcessRules, ProcessFts, ProcessSimilarity, ProcessDuplicates, ProcessSuggestMetadata}
 
 // ProcessStepsOrder is the order in which the steps are to be run in ascending order.
 var ProcessStepsOrder = map[ProcessStep]int{
-	ProcessHash:           1,
-	ProcessThumbnail:      2,
-	ProcessParseContent:   3,
-	ProcessDetectLanguage: 4,
-	ProcessRules:          5,
-	ProcessFts:            6,
+	ProcessHash:            1,
+	ProcessThumbnail:       2,
+	ProcessParseContent:    3,
+	ProcessDetectLanguage:  4,
+	ProcessExtractFields:   5,
+	ProcessRules:           6,
+	ProcessFts:             7,
+	ProcessSimilarity:      8,
+	ProcessDuplicates:      9,
+	ProcessSuggestMetadata: 10,
 }
 
 var ProcessStepsKeys = map[ProcessStep]string{
-	ProcessHash:           "hash",
-	ProcessThumbnail:      "thumbnail",
-	ProcessParseContent:   "content",
-	ProcessDetectLanguage: "detect-language",
-	ProcessRules:          "rules",
-	ProcessFts:            "fts",
+	ProcessHash:            "hash",
+	ProcessThumbnail:       "thumbnail",
+	ProcessParseContent:    "content",
+	ProcessDetectLanguage:  "detect-language",
+	ProcessExtractFields:   "extract-fields",
+	ProcessRules:           "rules",
+	ProcessFts:             "fts",
+	ProcessSimilarity:      "similarity",
+	ProcessDuplicates:      "duplicates",
+	ProcessSuggestMetadata: "suggest-metadata",
 }
 
 func (ps *ProcessStep) Value() (driver.Value, error) {
@@ -139,4 +151,6 @@ type ProcessItem struct {
 	Document   *Document
 	Action     ProcessStep `db:"action"`
 	CreatedAt  time.Time   `db:"created_at"`
+	// Triggers that caused running rules, if action is ProcessRules.
+	Triggers RuleTriggers `db:"rule_triggers"`
 }
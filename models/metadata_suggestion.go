@@ -0,0 +1,61 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"tryffel.net/go/virtualpaper/errors"
+)
+
+// MetadataSuggestion is a key-value pair that is likely to belong to the document,
+// based on the metadata of the user's other documents.
+type MetadataSuggestion struct {
+	DocumentId string `db:"document_id" json:"-"`
+	KeyId      int    `db:"key_id" json:"key_id"`
+	Key        string `db:"key" json:"key"`
+	ValueId    int    `db:"value_id" json:"value_id"`
+	Value      string `db:"value" json:"value"`
+	// Confidence is the estimated probability (0-1) that the value belongs to the document.
+	Confidence float64   `db:"confidence" json:"confidence"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+}
+
+// MetadataTrainingDocument is a classified document, which metadata suggestions are learned from.
+type MetadataTrainingDocument struct {
+	DocumentId string
+	Content    string
+	Metadata   []Metadata
+}
+
+// ValidateAutoApplyThreshold ensures the threshold is a valid confidence.
+func (m *MetadataKey) ValidateAutoApplyThreshold() error {
+	if m.AutoApplyThreshold < 0 || m.AutoApplyThreshold > 1 {
+		e := errors.ErrInvalid
+		e.ErrMsg = fmt.Sprintf("auto apply threshold must be between 0 and 1, got %v", m.AutoApplyThreshold)
+		return e
+	}
+	return nil
+}
+
+// AutoApplies returns true if the suggestion is confident enough to add it to the document.
+func (m *MetadataKey) AutoApplies(suggestion MetadataSuggestion) bool {
+	return m.AutoApplyThreshold > 0 && suggestion.Confidence >= m.AutoApplyThreshold
+}
@@ -0,0 +1,46 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2020  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetadataKey_ValidateAutoApplyThreshold(t *testing.T) {
+	for _, threshold := range []float64{0, 0.5, 1} {
+		key := &MetadataKey{AutoApplyThreshold: threshold}
+		assert.NoError(t, key.ValidateAutoApplyThreshold(), threshold)
+	}
+	for _, threshold := range []float64{-0.1, 1.1, 90} {
+		key := &MetadataKey{AutoApplyThreshold: threshold}
+		assert.Error(t, key.ValidateAutoApplyThreshold(), threshold)
+	}
+}
+
+func TestMetadataKey_AutoApplies(t *testing.T) {
+	disabled := &MetadataKey{AutoApplyThreshold: 0}
+	assert.False(t, disabled.AutoApplies(MetadataSuggestion{Confidence: 0.99}))
+
+	key := &MetadataKey{AutoApplyThreshold: 0.9}
+	assert.False(t, key.AutoApplies(MetadataSuggestion{Confidence: 0.89}))
+	assert.True(t, key.AutoApplies(MetadataSuggestion{Confidence: 0.9}))
+	assert.True(t, key.AutoApplies(MetadataSuggestion{Confidence: 0.95}))
+}
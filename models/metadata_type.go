@@ -0,0 +1,256 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"tryffel.net/go/virtualpaper/errors"
+)
+
+// MetadataKeyType defines what kind of values the metadata key accepts.
+type MetadataKeyType string
+
+const (
+	// MetadataKeyTypeText is the default type: values are picked from a list of predefined values.
+	MetadataKeyTypeText MetadataKeyType = "text"
+	// MetadataKeyTypeFreeText accepts any text.
+	MetadataKeyTypeFreeText MetadataKeyType = "free_text"
+	MetadataKeyTypeNumber   MetadataKeyType = "number"
+	// MetadataKeyTypeMoney is an amount with an optional currency, e.g. '123.45 EUR'.
+	MetadataKeyTypeMoney   MetadataKeyType = "money"
+	MetadataKeyTypeDate    MetadataKeyType = "date"
+	MetadataKeyTypeBoolean MetadataKeyType = "boolean"
+)
+
+var AllMetadataKeyTypes = []MetadataKeyType{
+	MetadataKeyTypeText,
+	MetadataKeyTypeFreeText,
+	MetadataKeyTypeNumber,
+	MetadataKeyTypeMoney,
+	MetadataKeyTypeDate,
+	MetadataKeyTypeBoolean,
+}
+
+func (t MetadataKeyType) String() string {
+	if t == "" {
+		return string(MetadataKeyTypeText)
+	}
+	return string(t)
+}
+
+func (t MetadataKeyType) Validate() error {
+	if t == "" {
+		return nil
+	}
+	for _, v := range AllMetadataKeyTypes {
+		if t == v {
+			return nil
+		}
+	}
+	err := errors.ErrInvalid
+	err.ErrMsg = fmt.Sprintf("invalid metadata key type: '%s'", t)
+	return err
+}
+
+// IsTyped returns true if key accepts free-form values instead of predefined ones.
+func (t MetadataKeyType) IsTyped() bool {
+	return t != "" && t != MetadataKeyTypeText
+}
+
+// IsNumeric returns true if values of the key are indexed as numbers.
+func (t MetadataKeyType) IsNumeric() bool {
+	switch t {
+	case MetadataKeyTypeNumber, MetadataKeyTypeMoney, MetadataKeyTypeDate, MetadataKeyTypeBoolean:
+		return true
+	}
+	return false
+}
+
+// TypedMetadataValue is a parsed value of a typed metadata key.
+type TypedMetadataValue struct {
+	// Value is the normalized value, e.g. '1234.5', '123.45 EUR', '2024-05-01' or 'true'.
+	Value    string
+	Number   *float64
+	Date     *time.Time
+	Bool     *bool
+	Currency string
+}
+
+// SearchNumber returns the value as a number for indexing: numbers and amounts as is,
+// dates as unix timestamps and booleans as 1 or 0.
+func (t *TypedMetadataValue) SearchNumber() (float64, bool) {
+	switch {
+	case t.Number != nil:
+		return *t.Number, true
+	case t.Date != nil:
+		return float64(t.Date.Unix()), true
+	case t.Bool != nil:
+		if *t.Bool {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+var currencySymbols = map[string]string{
+	"€": "EUR",
+	"$": "USD",
+	"£": "GBP",
+}
+
+var regexMoney = regexp.MustCompile(`^([A-Za-z]{3}|[€$£])?\s*([-+]?[\d\s.,]+?)\s*([A-Za-z]{3}|[€$£])?$`)
+
+var regexNumber = regexp.MustCompile(`^[-+]?(\d+\.?\d*|\.\d+)$`)
+
+// MetadataFreeTextMaxLength is the maximum length of a free text value in characters.
+const MetadataFreeTextMaxLength = 1000
+
+var metadataDateLayouts = []string{"2006-01-02", "2.1.2006", "2006/1/2", time.RFC3339}
+
+// ParseTypedMetadataValue parses and normalizes a free-form value of a typed key.
+func ParseTypedMetadataValue(keyType MetadataKeyType, value string) (*TypedMetadataValue, error) {
+	value = strings.TrimSpace(value)
+	invalid := func(format string, args ...interface{}) error {
+		err := errors.ErrInvalid
+		err.ErrMsg = fmt.Sprintf(format, args...)
+		return err
+	}
+	if value == "" {
+		return nil, invalid("empty value")
+	}
+
+	typed := &TypedMetadataValue{}
+	switch keyType {
+	case MetadataKeyTypeFreeText:
+		if utf8.RuneCountInString(value) > MetadataFreeTextMaxLength {
+			return nil, invalid("value is longer than %d characters", MetadataFreeTextMaxLength)
+		}
+		typed.Value = value
+	case MetadataKeyTypeNumber:
+		number, ok := parseMetadataNumber(value)
+		if !ok {
+			return nil, invalid("invalid number: '%s'", value)
+		}
+		typed.Number = &number
+		typed.Value = strconv.FormatFloat(number, 'f', -1, 64)
+	case MetadataKeyTypeMoney:
+		match := regexMoney.FindStringSubmatch(value)
+		if match == nil || (match[1] != "" && match[3] != "") {
+			return nil, invalid("invalid amount: '%s', expected e.g. '123.45 EUR'", value)
+		}
+		number, ok := parseMetadataNumber(match[2])
+		if !ok {
+			return nil, invalid("invalid amount: '%s', expected e.g. '123.45 EUR'", value)
+		}
+		currency := strings.ToUpper(match[1] + match[3])
+		if code, ok := currencySymbols[currency]; ok {
+			currency = code
+		}
+		typed.Number = &number
+		typed.Currency = currency
+		typed.Value = strings.TrimSpace(fmt.Sprintf("%.2f %s", number, currency))
+	case MetadataKeyTypeDate:
+		for _, layout := range metadataDateLayouts {
+			t, err := time.Parse(layout, value)
+			if err == nil {
+				date := MidnightForDate(t)
+				typed.Date = &date
+				typed.Value = date.Format("2006-01-02")
+				break
+			}
+		}
+		if typed.Date == nil {
+			return nil, invalid("invalid date: '%s', expected e.g. '2024-05-01'", value)
+		}
+	case MetadataKeyTypeBoolean:
+		var b bool
+		switch strings.ToLower(value) {
+		case "true", "yes", "on", "1":
+			b = true
+		case "false", "no", "off", "0":
+			b = false
+		default:
+			return nil, invalid("invalid boolean: '%s', expected true or false", value)
+		}
+		typed.Bool = &b
+		typed.Value = strconv.FormatBool(b)
+	default:
+		return nil, invalid("metadata key type '%s' does not accept free-form values", keyType.String())
+	}
+	return typed, nil
+}
+
+// parseMetadataNumber parses a number with either '.' or ',' as the decimal separator,
+// ignoring whitespace and thousand separators: '1 234,5', '1,234.5' and '1234.5' are all 1234.5.
+func parseMetadataNumber(value string) (float64, bool) {
+	value = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\u00a0' || r == '\'' {
+			return -1
+		}
+		return r
+	}, value)
+
+	lastDot := strings.LastIndex(value, ".")
+	lastComma := strings.LastIndex(value, ",")
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		if lastComma > lastDot {
+			value = strings.ReplaceAll(value, ".", "")
+			value = strings.Replace(value, ",", ".", 1)
+		} else {
+			value = strings.ReplaceAll(value, ",", "")
+		}
+	case strings.Count(value, ",") > 1:
+		value = strings.ReplaceAll(value, ",", "")
+	case strings.Count(value, ".") > 1:
+		value = strings.ReplaceAll(value, ".", "")
+	default:
+		value = strings.Replace(value, ",", ".", 1)
+	}
+
+	if !regexNumber.MatchString(value) {
+		return 0, false
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, false
+	}
+	return number, true
+}
+
+// SetTypedValue parses the value for the key type and sets the normalized value and typed columns.
+func (m *MetadataValue) SetTypedValue(keyType MetadataKeyType, value string) error {
+	typed, err := ParseTypedMetadataValue(keyType, value)
+	if err != nil {
+		return err
+	}
+	m.Value = typed.Value
+	m.NumberValue = typed.Number
+	m.DateValue = typed.Date
+	m.BoolValue = typed.Bool
+	m.Currency = typed.Currency
+	return nil
+}
@@ -0,0 +1,91 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2020  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTypedMetadataValue(t *testing.T) {
+	tests := []struct {
+		keyType  MetadataKeyType
+		value    string
+		want     string
+		currency string
+		number   float64
+		wantErr  bool
+	}{
+		{keyType: MetadataKeyTypeNumber, value: "1234.5", want: "1234.5", number: 1234.5},
+		{keyType: MetadataKeyTypeNumber, value: "1 234,50", want: "1234.5", number: 1234.5},
+		{keyType: MetadataKeyTypeNumber, value: "1,234.50", want: "1234.5", number: 1234.5},
+		{keyType: MetadataKeyTypeNumber, value: "1.234.567", want: "1234567", number: 1234567},
+		{keyType: MetadataKeyTypeNumber, value: "-3", want: "-3", number: -3},
+		{keyType: MetadataKeyTypeNumber, value: "NaN", wantErr: true},
+		{keyType: MetadataKeyTypeNumber, value: "12a", wantErr: true},
+		{keyType: MetadataKeyTypeMoney, value: "123.45 EUR", want: "123.45 EUR", currency: "EUR", number: 123.45},
+		{keyType: MetadataKeyTypeMoney, value: "€10", want: "10.00 EUR", currency: "EUR", number: 10},
+		{keyType: MetadataKeyTypeMoney, value: "usd 1,234.5", want: "1234.50 USD", currency: "USD", number: 1234.5},
+		{keyType: MetadataKeyTypeMoney, value: "99,9", want: "99.90", number: 99.9},
+		{keyType: MetadataKeyTypeMoney, value: "EUR 10 USD", wantErr: true},
+		{keyType: MetadataKeyTypeMoney, value: "ten euros", wantErr: true},
+		{keyType: MetadataKeyTypeDate, value: "2024-05-01", want: "2024-05-01", number: 1714521600},
+		{keyType: MetadataKeyTypeDate, value: "1.5.2024", want: "2024-05-01", number: 1714521600},
+		{keyType: MetadataKeyTypeDate, value: "2024/05/01", want: "2024-05-01", number: 1714521600},
+		{keyType: MetadataKeyTypeDate, value: "2024-13-01", wantErr: true},
+		{keyType: MetadataKeyTypeBoolean, value: "Yes", want: "true", number: 1},
+		{keyType: MetadataKeyTypeBoolean, value: "0", want: "false", number: 0},
+		{keyType: MetadataKeyTypeBoolean, value: "maybe", wantErr: true},
+		{keyType: MetadataKeyTypeFreeText, value: "  some text ", want: "some text"},
+		{keyType: MetadataKeyTypeFreeText, value: " ", wantErr: true},
+		{keyType: MetadataKeyTypeFreeText, value: strings.Repeat("a", 100), want: strings.Repeat("a", 100)},
+		{keyType: MetadataKeyTypeFreeText, value: strings.Repeat("a", 1001), wantErr: true},
+		{keyType: MetadataKeyTypeFreeText, value: "note: see page 2", want: "note: see page 2"},
+		{keyType: MetadataKeyTypeText, value: "value", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.keyType)+" "+tt.value, func(t *testing.T) {
+			got, err := ParseTypedMetadataValue(tt.keyType, tt.value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.want, got.Value)
+			assert.Equal(t, tt.currency, got.Currency)
+			number, ok := got.SearchNumber()
+			assert.Equal(t, tt.keyType.IsNumeric(), ok)
+			assert.Equal(t, tt.number, number)
+		})
+	}
+}
+
+func TestMetadataKeyType_Validate(t *testing.T) {
+	for _, v := range AllMetadataKeyTypes {
+		assert.NoError(t, v.Validate())
+	}
+	assert.NoError(t, MetadataKeyType("").Validate())
+	assert.Error(t, MetadataKeyType("decimal").Validate())
+	assert.False(t, MetadataKeyType("").IsTyped())
+	assert.True(t, MetadataKeyTypeDate.IsTyped())
+}
@@ -0,0 +1,81 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package models
+
+// MetadataValueUsage tells how many documents and rules use the metadata value.
+type MetadataValueUsage struct {
+	KeyId        int             `db:"key_id" json:"key_id"`
+	Key          string          `db:"key" json:"key"`
+	KeyType      MetadataKeyType `db:"key_type" json:"-"`
+	ValueId      int             `db:"value_id" json:"value_id"`
+	Value        string          `db:"value" json:"value"`
+	NumDocuments int             `db:"documents_count" json:"documents_count"`
+	NumRules     int             `db:"rules_count" json:"rules_count"`
+}
+
+// MetadataKeyUsage tells how many documents use the metadata key.
+type MetadataKeyUsage struct {
+	KeyId        int    `db:"key_id" json:"key_id"`
+	Key          string `db:"key" json:"key"`
+	NumDocuments int    `db:"documents_count" json:"documents_count"`
+	NumValues    int    `db:"values_count" json:"values_count"`
+}
+
+// MetadataSimilarValues is a pair of near-duplicate values of the same key. Source is suggested to be
+// merged into target, which is the more used value.
+type MetadataSimilarValues struct {
+	Source MetadataValueUsage `json:"source"`
+	Target MetadataValueUsage `json:"target"`
+}
+
+// MetadataUsageReport lists user's metadata keys and values that are candidates for cleaning up.
+type MetadataUsageReport struct {
+	// UnusedValues are not set to any document.
+	UnusedValues []MetadataValueUsage `json:"unused_values"`
+	// SimilarValues are values that are likely typos or duplicates of another value.
+	SimilarValues []MetadataSimilarValues `json:"similar_values"`
+	// RarelyUsedKeys are used in only a few documents.
+	RarelyUsedKeys []MetadataKeyUsage `json:"rarely_used_keys"`
+	// ValuesWithoutRules are not referenced by any rule condition or action.
+	ValuesWithoutRules []MetadataValueUsage `json:"values_without_rules"`
+}
+
+// MetadataValueMerge merges value SourceId into TargetId.
+type MetadataValueMerge struct {
+	SourceId int `json:"source_id"`
+	TargetId int `json:"target_id"`
+}
+
+// MetadataCleanup is a batch of keys and values to delete and values to merge.
+type MetadataCleanup struct {
+	DeleteKeys   []int
+	DeleteValues []int
+	MergeValues  []MetadataValueMerge
+}
+
+// MetadataCleanupResult summarizes the executed cleanup.
+type MetadataCleanupResult struct {
+	DeletedKeys   int `json:"deleted_keys"`
+	DeletedValues int `json:"deleted_values"`
+	MergedValues  int `json:"merged_values"`
+	// NumDocuments is the number of documents whose metadata changed.
+	NumDocuments int `json:"documents_count"`
+	// DisabledRules are the rules that referred to deleted keys or values.
+	DisabledRules []int `json:"disabled_rules"`
+}
@@ -0,0 +1,69 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package models
+
+// MetadataVocabulary is a group of metadata keys that the owner shares with other users.
+// Subscribers can use the keys in their documents, and add and edit values of the keys if the vocabulary is editable.
+type MetadataVocabulary struct {
+	Timestamp
+	Id          int    `db:"id" json:"id"`
+	UserId      int    `db:"user_id" json:"user_id"`
+	OwnerName   string `db:"owner_name" json:"owner_name"`
+	Name        string `db:"name" json:"name"`
+	Description string `db:"description" json:"description"`
+	// Editable allows subscribers to add and edit values.
+	Editable bool `db:"editable" json:"editable"`
+	// Owned is true if the requesting user owns the vocabulary.
+	Owned bool `db:"owned" json:"owned"`
+	// Member is true if the owner has allowed the requesting user to subscribe to the vocabulary.
+	Member bool `db:"member" json:"member"`
+	// Subscribed is true if the requesting user has subscribed to the vocabulary.
+	Subscribed  bool `db:"subscribed" json:"subscribed"`
+	Subscribers int  `db:"subscribers" json:"subscribers"`
+
+	Keys []MetadataVocabularyKey `db:"-" json:"keys"`
+	// Members are the users allowed to subscribe. Only the owner sees the members.
+	Members []MetadataVocabularyMember `db:"-" json:"members"`
+}
+
+func (v *MetadataVocabulary) FilterAttributes() []string {
+	return []string{"id", "name", "description", "owner_name", "subscribers", "created_at", "updated_at"}
+}
+
+func (v *MetadataVocabulary) SortAttributes() []string {
+	return v.FilterAttributes()
+}
+
+func (v *MetadataVocabulary) SortNoCase() []string {
+	return []string{"name", "description", "owner_name"}
+}
+
+// MetadataVocabularyKey is a metadata key in vocabulary.
+type MetadataVocabularyKey struct {
+	VocabularyId int    `db:"vocabulary_id" json:"-"`
+	KeyId        int    `db:"key_id" json:"key_id"`
+	Key          string `db:"key" json:"key"`
+}
+
+// MetadataVocabularyMember is a user that is allowed to subscribe to the vocabulary.
+type MetadataVocabularyMember struct {
+	VocabularyId int    `db:"vocabulary_id" json:"-"`
+	UserId       int    `db:"user_id" json:"user_id"`
+	UserName     string `db:"user_name" json:"user_name"`
+}
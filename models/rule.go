@@ -19,9 +19,13 @@
 package models
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"tryffel.net/go/virtualpaper/errors"
 )
@@ -48,7 +52,7 @@ func (r *RuleConditionMatchType) FromString(str string) error {
 	default:
 		e := errors.ErrInvalid
 		e.ErrMsg = "invalid match type: " + str
-		return errors.ErrInvalid
+		return e
 	}
 	return nil
 }
@@ -68,6 +72,12 @@ type Rule struct {
 	Enabled     bool                   `db:"enabled"`
 	Order       int                    `db:"rule_order"`
 	Mode        RuleConditionMatchType `db:"mode"`
+	// Triggers are the events that run the rule.
+	Triggers RuleTriggers `db:"triggers"`
+	// Schedule is the cron schedule for rules with schedule trigger.
+	Schedule string `db:"schedule"`
+	// StopProcessing stops running the rest of the rules if the rule matches.
+	StopProcessing bool `db:"stop_processing"`
 	Timestamp
 
 	Conditions []*RuleCondition
@@ -75,8 +85,13 @@ type Rule struct {
 }
 
 func (r *Rule) Validate() error {
+	err := r.validateTriggers()
+	if err != nil {
+		return err
+	}
+
 	for i, v := range r.Conditions {
-		err := v.Validate()
+		err := v.validate(1)
 		if err != nil {
 			if isErr, ok := err.(errors.Error); ok {
 				isErr.ErrMsg = fmt.Sprintf("condition %d: %s", i+1, isErr.ErrMsg)
@@ -91,6 +106,16 @@ func (r *Rule) Validate() error {
 	if len(r.Actions) == 0 {
 		return errors.ErrInvalid
 	}
+	for i, v := range r.Actions {
+		err := v.Validate()
+		if err != nil {
+			if isErr, ok := err.(errors.Error); ok {
+				isErr.ErrMsg = fmt.Sprintf("action %d: %s", i+1, isErr.ErrMsg)
+				return isErr
+			}
+			return fmt.Errorf("action %d: %v", i+1, err)
+		}
+	}
 	return nil
 }
 
@@ -116,14 +141,76 @@ const (
 	RuleConditionDateIs     RuleConditionType = "date_is"
 	RuleConditionDateAfter  RuleConditionType = "date_after"
 	RuleConditionDateBefore RuleConditionType = "date_before"
+	// RuleConditionDateDetect finds dates in common numeric and written formats without a regex.
+	// Value is the date role, see RuleDateRole.
+	RuleConditionDateDetect RuleConditionType = "date_detect"
 
 	RuleConditionMetadataHasKey        RuleConditionType = "metadata_has_key"
 	RuleConditionMetadataHasKeyValue   RuleConditionType = "metadata_has_key_value"
 	RuleConditionMetadataCount         RuleConditionType = "metadata_count"
 	RuleConditionMetadataCountLessThan RuleConditionType = "metadata_count_less_than"
 	RuleConditionMetadataCountMoreThan RuleConditionType = "metadata_count_more_than"
+
+	RuleConditionFilenameIs       RuleConditionType = "filename_is"
+	RuleConditionFilenameStarts   RuleConditionType = "filename_starts"
+	RuleConditionFilenameContains RuleConditionType = "filename_contains"
+
+	RuleConditionMimetypeIs     RuleConditionType = "mimetype_is"
+	RuleConditionMimetypeStarts RuleConditionType = "mimetype_starts"
+
+	RuleConditionLangIs RuleConditionType = "lang_is"
+
+	// size conditions accept size in bytes or with unit, e.g. '5 MB'.
+	RuleConditionSizeLessThan RuleConditionType = "size_less_than"
+	RuleConditionSizeMoreThan RuleConditionType = "size_more_than"
+
+	RuleConditionPageCount         RuleConditionType = "page_count"
+	RuleConditionPageCountLessThan RuleConditionType = "page_count_less_than"
+	RuleConditionPageCountMoreThan RuleConditionType = "page_count_more_than"
+
+	// created conditions compare the upload date of the document to age, e.g. '7y', '6m', '2w' or '30d'.
+	RuleConditionCreatedOlderThan RuleConditionType = "created_older_than"
+	RuleConditionCreatedNewerThan RuleConditionType = "created_newer_than"
+
+	// RuleConditionExpression evaluates the expression in value, see RuleExpressionEnv.
+	RuleConditionExpression RuleConditionType = "expression"
+
+	// RuleConditionGroup contains nested conditions that are matched with the group's own mode.
+	RuleConditionGroup RuleConditionType = "group"
+)
+
+// RuleDateRole is the meaning of a detected date. Dates are scored by the keywords near them,
+// e.g. 'due date' or 'eräpäivä' for due date.
+type RuleDateRole string
+
+const (
+	// RuleDateRoleDocument is the date the document was written, e.g. invoice date.
+	RuleDateRoleDocument RuleDateRole = "document"
+	// RuleDateRoleDue is the due date of a payment.
+	RuleDateRoleDue RuleDateRole = "due"
 )
 
+var AllRuleDateRoles = []RuleDateRole{RuleDateRoleDocument, RuleDateRoleDue}
+
+// ParseRuleDateRole parses date role. Empty value is the document date.
+func ParseRuleDateRole(value string) (RuleDateRole, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return RuleDateRoleDocument, nil
+	}
+	for _, v := range AllRuleDateRoles {
+		if value == string(v) {
+			return v, nil
+		}
+	}
+	err := errors.ErrInvalid
+	err.ErrMsg = fmt.Sprintf("invalid date role: '%s', must be one of: document, due", value)
+	return "", err
+}
+
+// MaxRuleConditionDepth is the maximum depth of nested condition groups.
+const MaxRuleConditionDepth = 5
+
 var AllConditionTypes = []RuleConditionType{
 	RuleConditionNameIs,
 	RuleConditionNameStarts,
@@ -140,12 +227,36 @@ var AllConditionTypes = []RuleConditionType{
 	RuleConditionDateIs,
 	RuleConditionDateAfter,
 	RuleConditionDateBefore,
+	RuleConditionDateDetect,
 
 	RuleConditionMetadataHasKey,
 	RuleConditionMetadataHasKeyValue,
 	RuleConditionMetadataCount,
 	RuleConditionMetadataCountLessThan,
 	RuleConditionMetadataCountMoreThan,
+
+	RuleConditionFilenameIs,
+	RuleConditionFilenameStarts,
+	RuleConditionFilenameContains,
+
+	RuleConditionMimetypeIs,
+	RuleConditionMimetypeStarts,
+
+	RuleConditionLangIs,
+
+	RuleConditionSizeLessThan,
+	RuleConditionSizeMoreThan,
+
+	RuleConditionPageCount,
+	RuleConditionPageCountLessThan,
+	RuleConditionPageCountMoreThan,
+
+	RuleConditionCreatedOlderThan,
+	RuleConditionCreatedNewerThan,
+
+	RuleConditionExpression,
+
+	RuleConditionGroup,
 }
 
 type RuleCondition struct {
@@ -168,11 +279,35 @@ type RuleCondition struct {
 	MetadataValue     IntId `db:"metadata_value"`
 	MetadataKeyName   Text  `db:"metadata_key_name"`
 	MetadataValueName Text  `db:"metadata_value_name"`
+
+	// ParentId is the group this condition belongs to, or 0 if condition is at the top level of the rule.
+	ParentId IntId `db:"parent_id"`
+	// Mode is the match mode of a group condition.
+	Mode RuleConditionMatchType `db:"group_mode"`
+	// Children are the conditions of a group condition.
+	Children []*RuleCondition `db:"-"`
+}
+
+// IsGroup returns true if condition is a group of other conditions.
+func (r *RuleCondition) IsGroup() bool {
+	return r.ConditionType == RuleConditionGroup
 }
 
 func (r *RuleCondition) Validate() error {
+	return r.validate(1)
+}
+
+func (r *RuleCondition) validate(depth int) error {
 	err := errors.ErrInvalid
 
+	if r.IsGroup() {
+		return r.validateGroup(depth)
+	}
+	if len(r.Children) > 0 {
+		err.ErrMsg = "only group condition can have nested conditions"
+		return err
+	}
+
 	validType := false
 	for _, v := range AllConditionTypes {
 		if r.ConditionType == v {
@@ -209,6 +344,63 @@ func (r *RuleCondition) Validate() error {
 		}
 	}
 
+	switch r.ConditionType {
+	case RuleConditionMimetypeIs, RuleConditionMimetypeStarts, RuleConditionLangIs,
+		RuleConditionSizeLessThan, RuleConditionSizeMoreThan,
+		RuleConditionPageCount, RuleConditionPageCountLessThan, RuleConditionPageCountMoreThan,
+		RuleConditionCreatedOlderThan, RuleConditionCreatedNewerThan:
+		if r.MetadataKey != 0 || r.MetadataValue != 0 {
+			err.ErrMsg = condText + " cannot match metadata"
+			return err
+		}
+		if r.Value == "" {
+			err.ErrMsg = "matching value is empty"
+			return err
+		}
+	}
+
+	switch r.ConditionType {
+	case RuleConditionLangIs, RuleConditionSizeLessThan, RuleConditionSizeMoreThan,
+		RuleConditionPageCount, RuleConditionPageCountLessThan, RuleConditionPageCountMoreThan,
+		RuleConditionCreatedOlderThan, RuleConditionCreatedNewerThan:
+		if r.IsRegex {
+			err.ErrMsg = condText + " does not support regex"
+			return err
+		}
+	}
+
+	switch r.ConditionType {
+	case RuleConditionSizeLessThan, RuleConditionSizeMoreThan:
+		if _, sizeErr := ParseRuleFileSize(r.Value); sizeErr != nil {
+			err.ErrMsg = "invalid size: " + sizeErr.Error()
+			return err
+		}
+	case RuleConditionPageCount, RuleConditionPageCountLessThan, RuleConditionPageCountMoreThan:
+		if pages, pageErr := strconv.Atoi(r.Value); pageErr != nil || pages < 0 {
+			err.ErrMsg = "page count must be a non-negative number"
+			return err
+		}
+	case RuleConditionCreatedOlderThan, RuleConditionCreatedNewerThan:
+		if _, ageErr := ParseRuleAge(r.Value); ageErr != nil {
+			err.ErrMsg = "invalid age: " + ageErr.Error()
+			return err
+		}
+	}
+
+	if r.ConditionType == RuleConditionExpression {
+		return r.validateExpression()
+	}
+	if r.ConditionType == RuleConditionDateDetect {
+		if r.IsRegex || r.DateFmt != "" || r.MetadataKey != 0 || r.MetadataValue != 0 {
+			err.ErrMsg = "date detection cannot have regex, date format or metadata"
+			return err
+		}
+		if _, roleErr := ParseRuleDateRole(r.Value); roleErr != nil {
+			return roleErr
+		}
+		return nil
+	}
+
 	if r.ConditionType == RuleConditionMetadataHasKey {
 		if r.MetadataKey == 0 {
 			err.ErrMsg = "must have metadata key defined"
@@ -235,6 +427,145 @@ func (r *RuleCondition) Validate() error {
 	return nil
 }
 
+func (r *RuleCondition) validateExpression() error {
+	err := errors.ErrInvalid
+	if r.IsRegex || r.MetadataKey != 0 || r.MetadataValue != 0 || r.DateFmt != "" {
+		err.ErrMsg = "expression cannot have regex, metadata or date format"
+		return err
+	}
+	if strings.TrimSpace(r.Value) == "" {
+		err.ErrMsg = "expression is empty"
+		return err
+	}
+	if len(r.Value) > MaxRuleExpressionLength {
+		err.ErrMsg = fmt.Sprintf("expression can be at most %d characters", MaxRuleExpressionLength)
+		return err
+	}
+	_, compileErr := CompileRuleExpression(r.Value)
+	if compileErr != nil {
+		err.ErrMsg = "invalid expression: " + compileErr.Error()
+		err.Err = compileErr
+		return err
+	}
+	return nil
+}
+
+func (r *RuleCondition) validateGroup(depth int) error {
+	err := errors.ErrInvalid
+	if depth > MaxRuleConditionDepth {
+		err.ErrMsg = fmt.Sprintf("condition groups can be nested at most %d levels", MaxRuleConditionDepth)
+		return err
+	}
+	if r.Mode != RuleMatchAll && r.Mode != RuleMatchAny {
+		err.ErrMsg = "group must have mode defined"
+		return err
+	}
+	if r.Value != "" || r.MetadataKey != 0 || r.MetadataValue != 0 {
+		err.ErrMsg = "group cannot have value or metadata"
+		return err
+	}
+	if len(r.Children) == 0 {
+		err.ErrMsg = "group must have conditions"
+		return err
+	}
+	for i, v := range r.Children {
+		childErr := v.validate(depth + 1)
+		if childErr != nil {
+			if isErr, ok := childErr.(errors.Error); ok {
+				isErr.ErrMsg = fmt.Sprintf("condition %d: %s", i+1, isErr.ErrMsg)
+				return isErr
+			}
+			return fmt.Errorf("condition %d: %v", i+1, childErr)
+		}
+	}
+	return nil
+}
+
+// ParseRuleFileSize parses file size in bytes. Size can have unit B, K, KB, KiB, M, MB, MiB, G, GB or GiB,
+// e.g. '5 MB', '1.5GB' or '500k'. Units are powers of 1024.
+func ParseRuleFileSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	multiplier := float64(1)
+	for _, unit := range []struct {
+		suffix     string
+		multiplier float64
+	}{
+		{"GIB", 1 << 30}, {"MIB", 1 << 20}, {"KIB", 1 << 10},
+		{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+	} {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	size, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(size) || math.IsInf(size, 0) {
+		return 0, fmt.Errorf("not a number: %s", value)
+	}
+	if size < 0 {
+		return 0, fmt.Errorf("size cannot be negative")
+	}
+	size *= multiplier
+	if size >= math.MaxInt64 {
+		return 0, fmt.Errorf("size is too large")
+	}
+	return int64(size), nil
+}
+
+// RuleAge is an age of document in years, months and days.
+type RuleAge struct {
+	Years  int
+	Months int
+	Days   int
+}
+
+// Before returns the time that is age before t.
+func (a RuleAge) Before(t time.Time) time.Time {
+	return t.AddDate(-a.Years, -a.Months, -a.Days)
+}
+
+// ParseRuleAge parses age with unit y (years), m (months), w (weeks) or d (days), e.g. '7y' or '30d'.
+func ParseRuleAge(value string) (RuleAge, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	age := RuleAge{}
+	if len(value) < 2 {
+		return age, fmt.Errorf("age must be a number with unit y, m, w or d")
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value[:len(value)-1]))
+	if err != nil || n < 0 {
+		return age, fmt.Errorf("not a non-negative number: %s", value[:len(value)-1])
+	}
+	switch value[len(value)-1] {
+	case 'y':
+		age.Years = n
+	case 'm':
+		age.Months = n
+	case 'w':
+		age.Days = n * 7
+	case 'd':
+		age.Days = n
+	default:
+		return age, fmt.Errorf("unknown unit: %c, must be one of y, m, w, d", value[len(value)-1])
+	}
+	return age, nil
+}
+
+// AllConditions returns all conditions of the rule, including the nested conditions in groups.
+func (r *Rule) AllConditions() []*RuleCondition {
+	conditions := make([]*RuleCondition, 0, len(r.Conditions))
+	var walk func(items []*RuleCondition)
+	walk = func(items []*RuleCondition) {
+		for _, v := range items {
+			conditions = append(conditions, v)
+			walk(v.Children)
+		}
+	}
+	walk(r.Conditions)
+	return conditions
+}
+
 func (r *RuleCondition) HasMetadata() bool {
 	return r.MetadataKey > 0 && r.MetadataValue > 0
 }
@@ -253,6 +584,25 @@ const (
 	RuleActionAddMetadata       RuleActionType = "metadata_add"
 	RuleActionRemoveMetadata    RuleActionType = "metadata_remove"
 	RuleActionSetDate           RuleActionType = "date_set"
+	// RuleActionExtractMetadata extracts metadata value with regex capture group
+	// and creates the value under the key if it does not exist yet.
+	RuleActionExtractMetadata RuleActionType = "metadata_extract"
+	// RuleActionSetLang sets the document language.
+	RuleActionSetLang RuleActionType = "lang_set"
+	// RuleActionShare shares the document with a user. Value contains the sharing as json.
+	RuleActionShare RuleActionType = "share"
+	// RuleActionLinkLatest links the document to the latest document that has the same metadata value.
+	// If metadata value is not defined, the document's own values for the metadata key are used.
+	RuleActionLinkLatest RuleActionType = "link_latest"
+	// RuleActionTrash moves the document to trash bin.
+	RuleActionTrash RuleActionType = "trash"
+	// RuleActionNotify sends an email notification to the document owner. Value is the message.
+	RuleActionNotify RuleActionType = "notify"
+	// RuleActionSetDateMetadata stores a date found with date_detect condition as metadata value
+	// formatted as YYYY-MM-DD. Value is the date role.
+	RuleActionSetDateMetadata RuleActionType = "date_metadata_set"
+	// RuleActionSetDocumentType sets the document type and adds its default metadata. Value is the document type id.
+	RuleActionSetDocumentType RuleActionType = "document_type_set"
 )
 
 type RuleAction struct {
@@ -270,6 +620,101 @@ type RuleAction struct {
 	MetadataValueName Text           `db:"metadata_value_name"`
 }
 
+func (r *RuleAction) Validate() error {
+	err := errors.ErrInvalid
+	switch r.Action {
+	case RuleActionExtractMetadata:
+		return r.validateExtractMetadata()
+	case RuleActionSetLang:
+		if !ruleLangRe.MatchString(r.Value) {
+			err.ErrMsg = "language must be a language code, e.g. 'en'"
+			return err
+		}
+	case RuleActionShare:
+		_, shareErr := r.Sharing()
+		return shareErr
+	case RuleActionLinkLatest:
+		if r.MetadataKey == 0 {
+			err.ErrMsg = "must have metadata key defined"
+			return err
+		}
+	case RuleActionNotify:
+		if strings.TrimSpace(r.Value) == "" {
+			err.ErrMsg = "notification message cannot be empty"
+			return err
+		}
+	case RuleActionSetDateMetadata:
+		if r.MetadataKey == 0 {
+			err.ErrMsg = "must have metadata key defined"
+			return err
+		}
+		_, roleErr := ParseRuleDateRole(r.Value)
+		return roleErr
+	case RuleActionSetDocumentType:
+		if _, typeErr := r.DocumentTypeId(); typeErr != nil {
+			return typeErr
+		}
+	}
+	return nil
+}
+
+// DocumentTypeId returns the document type id of the document type action.
+func (r *RuleAction) DocumentTypeId() (int, error) {
+	id, err := strconv.Atoi(r.Value)
+	if err != nil || id <= 0 {
+		e := errors.ErrInvalid
+		e.ErrMsg = "value must be a document type id"
+		return 0, e
+	}
+	return id, nil
+}
+
+var ruleLangRe = regexp.MustCompile(`^[a-z]{2,3}$`)
+
+// Sharing returns the user sharing of the share action.
+func (r *RuleAction) Sharing() (UpdateUserSharing, error) {
+	sharing := UpdateUserSharing{}
+	err := errors.ErrInvalid
+	jsonErr := json.Unmarshal([]byte(r.Value), &sharing)
+	if jsonErr != nil {
+		err.ErrMsg = `sharing must be json, e.g. {"user_id": 2, "permissions": {"read": true}}`
+		err.Err = jsonErr
+		return sharing, err
+	}
+	if sharing.UserId <= 0 {
+		err.ErrMsg = "sharing must have user defined"
+		return sharing, err
+	}
+	if !sharing.Permissions.Read {
+		err.ErrMsg = "sharing must have read permission"
+		return sharing, err
+	}
+	return sharing, nil
+}
+
+func (r *RuleAction) validateExtractMetadata() error {
+	err := errors.ErrInvalid
+	if r.MetadataKey == 0 {
+		err.ErrMsg = "must have metadata key defined"
+		return err
+	}
+	if r.MetadataValue != 0 {
+		err.ErrMsg = "cannot have metadata value defined, value is extracted from document"
+		return err
+	}
+	re, regexErr := regexp.Compile(r.Value)
+	if regexErr != nil {
+		err.ErrMsg = "invalid regex"
+		err.Err = regexErr
+		return err
+	}
+	if re.NumSubexp() == 0 {
+		err.ErrMsg = "regex must have a capture group"
+		return err
+	}
+	return nil
+}
+
 type MetadataRuleType string
 
 const (
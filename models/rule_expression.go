@@ -0,0 +1,92 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package models
+
+import (
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// MaxRuleExpressionLength is the maximum length of an expression condition.
+const MaxRuleExpressionLength = 2000
+
+// RuleExpressionDocument is the read-only view of the document that expression conditions are evaluated against.
+type RuleExpressionDocument struct {
+	Id          string `expr:"id"`
+	Name        string `expr:"name"`
+	Description string `expr:"description"`
+	Content     string `expr:"content"`
+	Filename    string `expr:"filename"`
+	Mimetype    string `expr:"mimetype"`
+	Lang        string `expr:"lang"`
+	Size        int64  `expr:"size"`
+	PageCount   int    `expr:"page_count"`
+	// Metadata maps key names to value names.
+	Metadata  map[string][]string `expr:"metadata"`
+	Date      time.Time           `expr:"date"`
+	CreatedAt time.Time           `expr:"created_at"`
+	UpdatedAt time.Time           `expr:"updated_at"`
+}
+
+// RuleExpressionEnv is the environment of expression conditions, e.g.
+// 'count(["invoice", "receipt"], fuzzy(doc.content, #)) >= 2 && quarter(doc.date) == 4'.
+// Functions are set by the rule runner, compiling only needs their signatures.
+type RuleExpressionEnv struct {
+	Doc RuleExpressionDocument `expr:"doc"`
+	Now time.Time              `expr:"now"`
+
+	// Regex reports whether text matches the regular expression.
+	Regex func(text, pattern string) (bool, error) `expr:"regex"`
+	// Fuzzy reports whether text contains the value, allowing typos for longer values.
+	Fuzzy func(text, value string) (bool, error) `expr:"fuzzy"`
+	// HasMetadata reports whether document has the key, and any of the values if given.
+	HasMetadata func(key string, values ...string) bool `expr:"has_metadata"`
+	// Quarter returns the quarter (1-4) of the date.
+	Quarter func(date time.Time) int `expr:"quarter"`
+}
+
+// CompileRuleExpression compiles the expression of an expression condition. The expression must return a boolean.
+func CompileRuleExpression(expression string) (*vm.Program, error) {
+	return expr.Compile(expression, expr.Env(RuleExpressionEnv{}), expr.AsBool())
+}
+
+// NewRuleExpressionDocument returns a copy of the document values for expression conditions.
+func NewRuleExpressionDocument(doc *Document) RuleExpressionDocument {
+	view := RuleExpressionDocument{
+		Id:          doc.Id,
+		Name:        doc.Name,
+		Description: doc.Description,
+		Content:     doc.Content,
+		Filename:    doc.Filename,
+		Mimetype:    doc.Mimetype,
+		Lang:        doc.Lang.String(),
+		Size:        doc.Size,
+		PageCount:   doc.PageCount,
+		Metadata:    make(map[string][]string, len(doc.Metadata)),
+		Date:        doc.Date,
+		CreatedAt:   doc.CreatedAt,
+		UpdatedAt:   doc.UpdatedAt,
+	}
+	for _, v := range doc.Metadata {
+		view.Metadata[v.Key] = append(view.Metadata[v.Key], v.Value)
+	}
+	return view
+}
@@ -0,0 +1,286 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRule_ValidateConditionGroups(t *testing.T) {
+	leaf := func() *RuleCondition {
+		return &RuleCondition{Enabled: true, ConditionType: RuleConditionContentContains, Value: "invoice"}
+	}
+	group := func(children ...*RuleCondition) *RuleCondition {
+		return &RuleCondition{Enabled: true, ConditionType: RuleConditionGroup, Mode: RuleMatchAny, Children: children}
+	}
+	nested := func(depth int) *RuleCondition {
+		cond := group(leaf())
+		for i := 1; i < depth; i++ {
+			cond = group(cond)
+		}
+		return cond
+	}
+
+	tests := []struct {
+		name      string
+		condition *RuleCondition
+		wantErr   bool
+	}{
+		{"group", group(leaf(), leaf()), false},
+		{"empty group", group(), true},
+		{"group without mode", &RuleCondition{ConditionType: RuleConditionGroup, Children: []*RuleCondition{leaf()}}, true},
+		{"group with value", &RuleCondition{ConditionType: RuleConditionGroup, Mode: RuleMatchAll, Value: "a", Children: []*RuleCondition{leaf()}}, true},
+		{"invalid nested condition", group(&RuleCondition{ConditionType: RuleConditionContentContains}), true},
+		{"condition with children", &RuleCondition{ConditionType: RuleConditionContentContains, Value: "a", Children: []*RuleCondition{leaf()}}, true},
+		{"max depth", nested(MaxRuleConditionDepth), false},
+		{"too deep", nested(MaxRuleConditionDepth + 1), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := &Rule{
+				Mode:       RuleMatchAll,
+				Conditions: []*RuleCondition{tt.condition},
+				Actions:    []*RuleAction{{Action: RuleActionSetName, Value: "a"}},
+			}
+			if err := rule.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRule_ValidateTriggers(t *testing.T) {
+	tests := []struct {
+		name     string
+		triggers RuleTriggers
+		schedule string
+		wantErr  bool
+	}{
+		{"no triggers", nil, "", false},
+		{"edit and metadata", RuleTriggers{RuleTriggerEdit, RuleTriggerMetadata}, "", false},
+		{"invalid trigger", RuleTriggers{"delete"}, "", true},
+		{"schedule", RuleTriggers{RuleTriggerSchedule}, "0 3 * * *", false},
+		{"schedule without spec", RuleTriggers{RuleTriggerSchedule}, "", true},
+		{"invalid schedule", RuleTriggers{RuleTriggerSchedule}, "every night", true},
+		{"spec without schedule trigger", RuleTriggers{RuleTriggerUpload}, "0 3 * * *", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := &Rule{
+				Mode:       RuleMatchAll,
+				Triggers:   tt.triggers,
+				Schedule:   tt.schedule,
+				Conditions: []*RuleCondition{{Enabled: true, ConditionType: RuleConditionContentContains, Value: "invoice"}},
+				Actions:    []*RuleAction{{Action: RuleActionSetName, Value: "a"}},
+			}
+			if err := rule.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRuleTriggers_Scan(t *testing.T) {
+	triggers := RuleTriggers{}
+	if err := triggers.Scan("edit,metadata,edit"); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if triggers.String() != "edit,metadata" {
+		t.Errorf("Scan() = %s, want edit,metadata", triggers.String())
+	}
+	if err := triggers.Scan(""); err != nil || len(triggers) != 0 {
+		t.Errorf("Scan() empty = %v, %v", triggers, err)
+	}
+}
+
+func TestRule_ScheduleDue(t *testing.T) {
+	rule := &Rule{Triggers: RuleTriggers{RuleTriggerSchedule}, Schedule: "30 3 * * *"}
+	if !rule.ScheduleDue(time.Date(2023, 5, 10, 3, 30, 12, 0, time.Local)) {
+		t.Errorf("ScheduleDue() expected due at 3:30")
+	}
+	if rule.ScheduleDue(time.Date(2023, 5, 10, 3, 31, 0, 0, time.Local)) {
+		t.Errorf("ScheduleDue() expected not due at 3:31")
+	}
+	rule.Triggers = RuleTriggers{RuleTriggerUpload}
+	if rule.ScheduleDue(time.Date(2023, 5, 10, 3, 30, 0, 0, time.Local)) {
+		t.Errorf("ScheduleDue() expected not due without schedule trigger")
+	}
+}
+
+func TestParseRuleFileSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{"100", 100, false},
+		{"100 B", 100, false},
+		{"5 MB", 5 << 20, false},
+		{"1.5gb", 3 << 29, false},
+		{"2KB", 2048, false},
+		{"2k", 2048, false},
+		{"2kib", 2048, false},
+		{"1.5mib", 3 << 19, false},
+		{"1g", 1 << 30, false},
+		{"-1", 0, true},
+		{"MB", 0, true},
+		{"five", 0, true},
+		{"nan", 0, true},
+		{"inf", 0, true},
+		{"1e99", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRuleFileSize(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRuleFileSize(%s) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseRuleFileSize(%s) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseRuleAge(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    RuleAge
+		wantErr bool
+	}{
+		{"7y", RuleAge{Years: 7}, false},
+		{"6m", RuleAge{Months: 6}, false},
+		{"2w", RuleAge{Days: 14}, false},
+		{"30D", RuleAge{Days: 30}, false},
+		{"30", RuleAge{}, true},
+		{"y", RuleAge{}, true},
+		{"-1d", RuleAge{}, true},
+		{"7 years", RuleAge{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRuleAge(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRuleAge(%s) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseRuleAge(%s) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRuleCondition_ValidateFileConditions(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition RuleCondition
+		wantErr   bool
+	}{
+		{"mimetype", RuleCondition{ConditionType: RuleConditionMimetypeStarts, Value: "image/"}, false},
+		{"empty mimetype", RuleCondition{ConditionType: RuleConditionMimetypeIs}, true},
+		{"filename regex", RuleCondition{ConditionType: RuleConditionFilenameStarts, Value: "^SCAN_", IsRegex: true}, false},
+		{"lang", RuleCondition{ConditionType: RuleConditionLangIs, Value: "fi"}, false},
+		{"lang with metadata", RuleCondition{ConditionType: RuleConditionLangIs, Value: "fi", MetadataKey: 1}, true},
+		{"size", RuleCondition{ConditionType: RuleConditionSizeMoreThan, Value: "5 MB"}, false},
+		{"invalid size", RuleCondition{ConditionType: RuleConditionSizeMoreThan, Value: "5 TB"}, true},
+		{"size regex", RuleCondition{ConditionType: RuleConditionSizeMoreThan, Value: "5", IsRegex: true}, true},
+		{"page count", RuleCondition{ConditionType: RuleConditionPageCountMoreThan, Value: "10"}, false},
+		{"invalid page count", RuleCondition{ConditionType: RuleConditionPageCount, Value: "-1"}, true},
+		{"created", RuleCondition{ConditionType: RuleConditionCreatedOlderThan, Value: "7y"}, false},
+		{"invalid created", RuleCondition{ConditionType: RuleConditionCreatedOlderThan, Value: "7x"}, true},
+		{"date detect", RuleCondition{ConditionType: RuleConditionDateDetect}, false},
+		{"date detect due", RuleCondition{ConditionType: RuleConditionDateDetect, Value: "Due"}, false},
+		{"date detect invalid role", RuleCondition{ConditionType: RuleConditionDateDetect, Value: "delivery"}, true},
+		{"date detect format", RuleCondition{ConditionType: RuleConditionDateDetect, DateFmt: "2006-01-02"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.condition.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRuleAction_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		action  RuleAction
+		wantErr bool
+	}{
+		{"lang", RuleAction{Action: RuleActionSetLang, Value: "fi"}, false},
+		{"invalid lang", RuleAction{Action: RuleActionSetLang, Value: "finnish"}, true},
+		{"share", RuleAction{Action: RuleActionShare, Value: `{"user_id": 2, "permissions": {"read": true, "write": true}}`}, false},
+		{"share without user", RuleAction{Action: RuleActionShare, Value: `{"permissions": {"read": true}}`}, true},
+		{"share without read", RuleAction{Action: RuleActionShare, Value: `{"user_id": 2, "permissions": {"write": true}}`}, true},
+		{"share invalid json", RuleAction{Action: RuleActionShare, Value: "user 2"}, true},
+		{"link latest", RuleAction{Action: RuleActionLinkLatest, MetadataKey: 1}, false},
+		{"link latest without key", RuleAction{Action: RuleActionLinkLatest}, true},
+		{"trash", RuleAction{Action: RuleActionTrash}, false},
+		{"notify", RuleAction{Action: RuleActionNotify, Value: "new invoice"}, false},
+		{"notify without message", RuleAction{Action: RuleActionNotify, Value: " "}, true},
+		{"date metadata", RuleAction{Action: RuleActionSetDateMetadata, Value: "due", MetadataKey: 1}, false},
+		{"date metadata without key", RuleAction{Action: RuleActionSetDateMetadata, Value: "due"}, true},
+		{"date metadata invalid role", RuleAction{Action: RuleActionSetDateMetadata, Value: "x", MetadataKey: 1}, true},
+		{"document type", RuleAction{Action: RuleActionSetDocumentType, Value: "3"}, false},
+		{"document type without id", RuleAction{Action: RuleActionSetDocumentType, Value: ""}, true},
+		{"document type invalid id", RuleAction{Action: RuleActionSetDocumentType, Value: "invoice"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.action.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRuleTraceConditions_ValueScan(t *testing.T) {
+	var empty RuleTraceConditions
+	value, err := empty.Value()
+	if err != nil || value != "[]" {
+		t.Errorf("Value() empty = %v, %v", value, err)
+	}
+
+	conditions := NewRuleTraceConditions([]*RuleCondition{
+		{Id: 1, ConditionType: RuleConditionNameIs},
+		{Id: 2, ConditionType: RuleConditionGroup, Children: []*RuleCondition{{Id: 3, ConditionType: RuleConditionNameIs}}},
+	})
+	conditions[1].Children[0].Matched = true
+	value, err = RuleTraceConditions(conditions).Value()
+	if err != nil {
+		t.Fatalf("Value() error = %v", err)
+	}
+
+	scanned := RuleTraceConditions{}
+	if err := scanned.Scan(value); err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if len(scanned) != 2 || !scanned[0].Skipped || scanned[1].ConditionId != 2 {
+		t.Errorf("Scan() = %+v", scanned)
+	}
+	if len(scanned[1].Children) != 1 || !scanned[1].Children[0].Matched {
+		t.Errorf("Scan() children = %+v", scanned[1].Children)
+	}
+}
+
+func TestRuleCondition_ValidateExpression(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		wantErr    bool
+	}{
+		{"valid", `fuzzy(doc.content, "invoice") && quarter(doc.date) == 4`, false},
+		{"metadata", `has_metadata("category") || len(doc.metadata["author"]) > 0`, false},
+		{"empty", " ", true},
+		{"syntax error", `doc.name ==`, true},
+		{"unknown field", `doc.title == "invoice"`, true},
+		{"not bool", `doc.size + 1`, true},
+		{"wrong argument type", `quarter(doc.name) == 1`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition := RuleCondition{ConditionType: RuleConditionExpression, Value: tt.expression}
+			if err := condition.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
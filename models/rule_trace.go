@@ -0,0 +1,128 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DocumentRuleTrace records the evaluation of a single rule for a document.
+type DocumentRuleTrace struct {
+	Id         int          `db:"id" json:"id"`
+	DocumentId string       `db:"document_id" json:"document_id"`
+	RuleId     IntId        `db:"rule_id" json:"rule_id"`
+	RuleName   string       `db:"rule_name" json:"rule_name"`
+	Triggers   RuleTriggers `db:"triggers" json:"triggers"`
+	// Pass is the pass of the rule run, see MaxRulePasses.
+	Pass    int  `db:"pass" json:"pass"`
+	Matched bool `db:"matched" json:"matched"`
+	// Stopped is set if the rule matched and stopped processing the rest of the rules.
+	Stopped    bool                `db:"stopped" json:"stopped"`
+	Conditions RuleTraceConditions `db:"conditions" json:"conditions"`
+	Actions    RuleTraceActions    `db:"actions" json:"actions"`
+	Error      string              `db:"error" json:"error"`
+	CreatedAt  time.Time           `db:"created_at" json:"created_at"`
+}
+
+// RuleTraceCondition is the result of evaluating a condition.
+type RuleTraceCondition struct {
+	ConditionId   int    `json:"condition_id"`
+	ConditionType string `json:"condition_type"`
+	Matched       bool   `json:"matched"`
+	// Skipped is set for disabled conditions and conditions that were not evaluated.
+	Skipped  bool                 `json:"skipped"`
+	Children []RuleTraceCondition `json:"children,omitempty"`
+}
+
+// RuleTraceAction is the result of running an action.
+type RuleTraceAction struct {
+	ActionId   int    `json:"action_id"`
+	ActionType string `json:"action_type"`
+	Skipped    bool   `json:"skipped"`
+	Error      string `json:"error,omitempty"`
+}
+
+// NewRuleTraceConditions returns trace for conditions where each condition is skipped.
+func NewRuleTraceConditions(conditions []*RuleCondition) []RuleTraceCondition {
+	trace := make([]RuleTraceCondition, len(conditions))
+	for i, v := range conditions {
+		trace[i] = RuleTraceCondition{
+			ConditionId:   v.Id,
+			ConditionType: v.ConditionType.String(),
+			Skipped:       true,
+		}
+		if v.IsGroup() {
+			trace[i].Children = NewRuleTraceConditions(v.Children)
+		}
+	}
+	return trace
+}
+
+type RuleTraceConditions []RuleTraceCondition
+
+func (r RuleTraceConditions) Value() (driver.Value, error) {
+	return jsonValue(r, "[]")
+}
+
+func (r *RuleTraceConditions) Scan(src interface{}) error {
+	return scanJson(src, r)
+}
+
+type RuleTraceActions []RuleTraceAction
+
+func (r RuleTraceActions) Value() (driver.Value, error) {
+	return jsonValue(r, "[]")
+}
+
+func (r *RuleTraceActions) Scan(src interface{}) error {
+	return scanJson(src, r)
+}
+
+func jsonValue(value interface{}, empty string) (driver.Value, error) {
+	out, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if string(out) == "null" {
+		return empty, nil
+	}
+	return string(out), nil
+}
+
+func scanJson(src interface{}, dest interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("invalid type: %v, expected string", src)
+	}
+	err := json.Unmarshal(data, dest)
+	if err != nil {
+		return fmt.Errorf("json: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"tryffel.net/go/virtualpaper/errors"
+)
+
+// RuleTrigger is an event that runs the rule for the document.
+type RuleTrigger string
+
+func (r RuleTrigger) String() string {
+	return string(r)
+}
+
+const (
+	// RuleTriggerUpload runs rule when document is processed after uploading it or when processing is requested.
+	RuleTriggerUpload RuleTrigger = "upload"
+	// RuleTriggerEdit runs rule when user edits the document.
+	RuleTriggerEdit RuleTrigger = "edit"
+	// RuleTriggerMetadata runs rule when document's metadata changes.
+	RuleTriggerMetadata RuleTrigger = "metadata"
+	// RuleTriggerShare runs rule when document's sharing changes.
+	RuleTriggerShare RuleTrigger = "share"
+	// RuleTriggerSchedule runs rule periodically for all user's documents.
+	RuleTriggerSchedule RuleTrigger = "schedule"
+)
+
+var AllRuleTriggers = []RuleTrigger{
+	RuleTriggerUpload,
+	RuleTriggerEdit,
+	RuleTriggerMetadata,
+	RuleTriggerShare,
+	RuleTriggerSchedule,
+}
+
+// MaxRulePasses is the maximum number of times rules are run for a document for a single trigger.
+// Rules that change the document trigger rules with edit and metadata triggers again,
+// and the chain is stopped after this many passes.
+const MaxRulePasses = 5
+
+// RuleTriggers is a set of triggers. It is stored as a comma-separated list.
+// Rule without triggers is run on upload.
+type RuleTriggers []RuleTrigger
+
+func (r RuleTriggers) Value() (driver.Value, error) {
+	return r.String(), nil
+}
+
+func (r *RuleTriggers) Scan(src interface{}) error {
+	var str string
+	switch val := src.(type) {
+	case nil:
+	case string:
+		str = val
+	case []byte:
+		str = string(val)
+	default:
+		return fmt.Errorf("unknown type: %v", src)
+	}
+
+	triggers := RuleTriggers{}
+	for _, v := range strings.Split(str, ",") {
+		if v != "" {
+			triggers = triggers.Add(RuleTrigger(v))
+		}
+	}
+	*r = triggers
+	return nil
+}
+
+func (r RuleTriggers) String() string {
+	items := make([]string, len(r))
+	for i, v := range r {
+		items[i] = v.String()
+	}
+	return strings.Join(items, ",")
+}
+
+// Has returns true if triggers contain the trigger.
+func (r RuleTriggers) Has(trigger RuleTrigger) bool {
+	for _, v := range r {
+		if v == trigger {
+			return true
+		}
+	}
+	return false
+}
+
+// Any returns true if any of the triggers is in r.
+func (r RuleTriggers) Any(triggers RuleTriggers) bool {
+	for _, v := range triggers {
+		if r.Has(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add returns triggers with trigger added, if it did not exist already.
+func (r RuleTriggers) Add(trigger RuleTrigger) RuleTriggers {
+	if r.Has(trigger) {
+		return r
+	}
+	return append(r, trigger)
+}
+
+func (r RuleTriggers) validate() error {
+	err := errors.ErrInvalid
+	for _, v := range r {
+		valid := false
+		for _, trigger := range AllRuleTriggers {
+			if v == trigger {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			err.ErrMsg = fmt.Sprintf("invalid trigger: %s", v)
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Rule) validateTriggers() error {
+	err := errors.ErrInvalid
+	if triggerErr := r.Triggers.validate(); triggerErr != nil {
+		return triggerErr
+	}
+
+	if !r.Triggers.Has(RuleTriggerSchedule) {
+		if r.Schedule != "" {
+			err.ErrMsg = "schedule requires schedule trigger"
+			return err
+		}
+		return nil
+	}
+	if r.Schedule == "" {
+		err.ErrMsg = "schedule trigger requires schedule"
+		return err
+	}
+	_, cronErr := cron.ParseStandard(r.Schedule)
+	if cronErr != nil {
+		err.ErrMsg = "invalid schedule: " + cronErr.Error()
+		return err
+	}
+	return nil
+}
+
+// ScheduleDue returns true if rule's schedule fires at the minute of t.
+func (r *Rule) ScheduleDue(t time.Time) bool {
+	if !r.Triggers.Has(RuleTriggerSchedule) {
+		return false
+	}
+	schedule, err := cron.ParseStandard(r.Schedule)
+	if err != nil {
+		return false
+	}
+	minute := t.Truncate(time.Minute)
+	return schedule.Next(minute.Add(-time.Second)).Equal(minute)
+}
+
+// ChangeTriggers returns the triggers for the changes between original and updated document.
+func ChangeTriggers(original, updated *Document) RuleTriggers {
+	triggers := RuleTriggers{}
+	diff, err := original.Diff(updated, 0)
+	if err != nil {
+		return triggers
+	}
+	for _, v := range diff {
+		if v.Action != DocumentHistoryActionContent {
+			triggers = triggers.Add(RuleTriggerEdit)
+		}
+	}
+	if len(MetadataDiff(original.Id, 0, &original.Metadata, &updated.Metadata)) > 0 {
+		triggers = triggers.Add(RuleTriggerMetadata)
+	}
+	return triggers
+}
@@ -80,6 +80,23 @@ type UserPreferences struct {
 	IsAdmin       bool      `json:"is_admin" db:"is_admin"`
 }
 
+// SearchSynonym is a group of words that are considered equal when user searches documents.
+type SearchSynonym struct {
+	Id        int       `json:"id" db:"id"`
+	UserId    int       `json:"user_id" db:"user_id"`
+	Words     []string  `json:"words" db:"-"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// SearchSettings are user's settings that are applied when searching documents.
+type SearchSettings struct {
+	Synonyms  []SearchSynonym `json:"synonyms"`
+	StopWords []string        `json:"stop_words"`
+	// Ranking contains sort rules, e.g. 'date:desc', that are used to rank documents with equal relevance.
+	Ranking []string `json:"ranking"`
+}
+
 type UserInfo struct {
 	UserId        int       `json:"id" db:"user_id"`
 	UserName      string    `json:"user_name" db:"username"`
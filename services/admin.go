@@ -8,6 +8,7 @@ import (
 	"os/exec"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 	"tryffel.net/go/virtualpaper/config"
 	"tryffel.net/go/virtualpaper/errors"
@@ -23,6 +24,9 @@ type AdminService struct {
 	db      *storage.Database
 	process *process.Manager
 	search  *search.Engine
+
+	indexLock   sync.Mutex
+	indexStatus SearchIndexStatus
 }
 
 func NewAdminService(db *storage.Database, manager *process.Manager, search *search.Engine) *AdminService {
@@ -33,6 +37,62 @@ func NewAdminService(db *storage.Database, manager *process.Manager, search *sea
 	}
 }
 
+// SearchIndexStatus is the status of the latest search index verification.
+type SearchIndexStatus struct {
+	Running    bool                  `json:"running"`
+	StartedAt  time.Time             `json:"started_at"`
+	FinishedAt time.Time             `json:"finished_at"`
+	Progress   search.VerifyProgress `json:"progress"`
+	Report     *search.VerifyReport  `json:"report"`
+	Error      string                `json:"error"`
+}
+
+// StartSearchIndexVerification verifies search index in background. If dryRun is false,
+// missing and stale documents are re-indexed and orphaned documents are deleted from the index.
+// Only one verification can run at a time.
+func (service *AdminService) StartSearchIndexVerification(ctx context.Context, userId int, dryRun bool) error {
+	service.indexLock.Lock()
+	defer service.indexLock.Unlock()
+	if service.indexStatus.Running {
+		e := errors.ErrAlreadyExists
+		e.ErrMsg = "search index verification is already running"
+		return e
+	}
+
+	logger.Context(ctx).Infof("Start search index verification, user: %d, dry run: %t", userId, dryRun)
+	service.indexStatus = SearchIndexStatus{Running: true, StartedAt: time.Now()}
+	opts := search.VerifyOptions{
+		UserId: userId,
+		DryRun: dryRun,
+		Progress: func(progress search.VerifyProgress) {
+			service.indexLock.Lock()
+			service.indexStatus.Progress = progress
+			service.indexLock.Unlock()
+		},
+	}
+
+	go func() {
+		report, err := service.search.VerifyIndex(context.Background(), opts)
+		service.indexLock.Lock()
+		defer service.indexLock.Unlock()
+		service.indexStatus.Running = false
+		service.indexStatus.FinishedAt = time.Now()
+		service.indexStatus.Report = report
+		if err != nil {
+			logrus.Errorf("verify search index: %v", err)
+			service.indexStatus.Error = err.Error()
+		}
+	}()
+	return nil
+}
+
+// GetSearchIndexStatus returns the status of the latest search index verification.
+func (service *AdminService) GetSearchIndexStatus(ctx context.Context) SearchIndexStatus {
+	service.indexLock.Lock()
+	defer service.indexLock.Unlock()
+	return service.indexStatus
+}
+
 func (service *AdminService) GetDocumentProcessQueue(ctx context.Context) (*[]models.ProcessItem, int, error) {
 	return service.db.JobStore.GetPendingProcessing()
 }
@@ -0,0 +1,604 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"tryffel.net/go/virtualpaper/errors"
+	"tryffel.net/go/virtualpaper/models"
+	"tryffel.net/go/virtualpaper/storage"
+	"tryffel.net/go/virtualpaper/util/logger"
+)
+
+// DocumentCsvValueSeparator separates multiple values of the same key in a single cell.
+// Separators and backslashes in values are escaped with a backslash, e.g. 'a\;b'.
+const DocumentCsvValueSeparator = ";"
+
+// documentCsvEscape is the escape character of the separator in values.
+const documentCsvEscape = '\\'
+
+// DocumentCsvDateFormat is the format of the date column.
+const DocumentCsvDateFormat = "2006-01-02"
+
+const (
+	documentCsvColumnId       = "id"
+	documentCsvColumnName     = "name"
+	documentCsvColumnDate     = "date"
+	documentCsvColumnFilename = "filename"
+)
+
+// DocumentCsvImportOptions controls how the csv is imported.
+type DocumentCsvImportOptions struct {
+	// DryRun only validates the file and reports the changes without applying them.
+	DryRun bool
+	// CreateValues creates metadata values that do not exist yet.
+	// Otherwise unknown values are reported as errors.
+	CreateValues bool
+}
+
+// DocumentCsvImportError is a validation error of a single line in the csv.
+type DocumentCsvImportError struct {
+	Line       int    `json:"line"`
+	DocumentId string `json:"document_id,omitempty"`
+	Error      string `json:"error"`
+}
+
+// DocumentCsvImportChange lists the fields that are changed in the document.
+type DocumentCsvImportChange struct {
+	DocumentId string   `json:"document_id"`
+	Name       string   `json:"name"`
+	Changes    []string `json:"changes"`
+}
+
+type DocumentCsvImportStatus struct {
+	DryRun bool `json:"dry_run"`
+	// Applied is true if the changes were saved. Nothing is saved if any line has errors.
+	Applied   bool `json:"applied"`
+	Rows      int  `json:"rows"`
+	Changed   int  `json:"changed"`
+	Unchanged int  `json:"unchanged"`
+	// CreatedValues is the number of new metadata values, or values that would be created in dry run.
+	CreatedValues int                       `json:"created_values"`
+	Errors        []DocumentCsvImportError  `json:"errors"`
+	Documents     []DocumentCsvImportChange `json:"documents"`
+}
+
+// ExportDocumentsCsv writes user's documents as csv: id, name, date, filename and one column per metadata key.
+// Multiple values of a key are separated with DocumentCsvValueSeparator.
+// It returns the number of documents exported.
+func (service *DocumentService) ExportDocumentsCsv(ctx context.Context, userId int, w io.Writer) (int, error) {
+	docs, err := service.db.DocumentStore.GetUserDocumentsForExport(userId)
+	if err != nil {
+		return 0, err
+	}
+	keys, err := service.db.MetadataStore.GetAccessibleKeys(userId)
+	if err != nil {
+		return 0, err
+	}
+	keys = uniqueKeyNames(keys)
+	metadata, err := service.db.MetadataStore.GetUserDocumentsMetadata(userId)
+	if err != nil {
+		return 0, err
+	}
+
+	writer := csv.NewWriter(w)
+	header := []string{documentCsvColumnId, documentCsvColumnName, documentCsvColumnDate, documentCsvColumnFilename}
+	for _, v := range keys {
+		header = append(header, v.Key)
+	}
+	err = writer.Write(header)
+	if err != nil {
+		return 0, fmt.Errorf("write csv: %v", err)
+	}
+
+	for _, doc := range docs {
+		values := make(map[int][]string)
+		for _, v := range metadata[doc.Id] {
+			values[v.KeyId] = append(values[v.KeyId], escapeCsvValue(v.Value))
+		}
+		row := []string{doc.Id, doc.Name, doc.Date.Format(DocumentCsvDateFormat), doc.Filename}
+		for _, key := range keys {
+			row = append(row, strings.Join(values[key.Id], DocumentCsvValueSeparator+" "))
+		}
+		err = writer.Write(row)
+		if err != nil {
+			return 0, fmt.Errorf("write csv: %v", err)
+		}
+	}
+	writer.Flush()
+	if err = writer.Error(); err != nil {
+		return 0, fmt.Errorf("write csv: %v", err)
+	}
+	logger.Context(ctx).Infof("Exported %d documents as csv for user %d", len(docs), userId)
+	return len(docs), nil
+}
+
+// uniqueKeyNames removes keys that have the same name as a previous key. Keys are matched by
+// their name in csv, so user's own keys take precedence over keys from vocabularies.
+func uniqueKeyNames(keys []models.MetadataKey) []models.MetadataKey {
+	seen := make(map[string]bool)
+	unique := make([]models.MetadataKey, 0, len(keys))
+	for _, v := range keys {
+		name := strings.ToLower(v.Key)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		unique = append(unique, v)
+	}
+	sort.SliceStable(unique, func(i, j int) bool {
+		return strings.ToLower(unique[i].Key) < strings.ToLower(unique[j].Key)
+	})
+	return unique
+}
+
+// documentCsvColumns maps csv columns to document fields. Index is -1 if the column is missing.
+type documentCsvColumns struct {
+	id       int
+	name     int
+	date     int
+	filename int
+	// keys maps column index to metadata key
+	keys map[int]*models.MetadataKey
+}
+
+func (service *DocumentService) parseDocumentCsvHeader(userId int, header []string) (*documentCsvColumns, error) {
+	keys, err := service.db.MetadataStore.GetAccessibleKeys(userId)
+	if err != nil {
+		return nil, err
+	}
+	keys = uniqueKeyNames(keys)
+	keysByName := make(map[string]*models.MetadataKey)
+	for i, v := range keys {
+		keysByName[strings.ToLower(v.Key)] = &keys[i]
+	}
+
+	columns := &documentCsvColumns{id: -1, name: -1, date: -1, filename: -1, keys: make(map[int]*models.MetadataKey)}
+	seen := make(map[string]bool)
+	for i, v := range header {
+		if i == 0 {
+			// spreadsheet applications often prefix the file with byte order mark
+			v = strings.TrimPrefix(v, "\ufeff")
+		}
+		name := strings.ToLower(strings.TrimSpace(v))
+		if seen[name] {
+			return nil, invalidCsv(fmt.Sprintf("duplicate column '%s'", v))
+		}
+		seen[name] = true
+		switch name {
+		case documentCsvColumnId:
+			columns.id = i
+		case documentCsvColumnName:
+			columns.name = i
+		case documentCsvColumnDate:
+			columns.date = i
+		case documentCsvColumnFilename:
+			columns.filename = i
+		default:
+			key, ok := keysByName[name]
+			if !ok {
+				return nil, invalidCsv(fmt.Sprintf("unknown metadata key '%s'", v))
+			}
+			columns.keys[i] = key
+		}
+	}
+	if columns.id == -1 {
+		return nil, invalidCsv("column 'id' is required")
+	}
+	return columns, nil
+}
+
+func invalidCsv(msg string) error {
+	e := errors.ErrInvalid
+	e.ErrMsg = "invalid csv: " + msg
+	return e
+}
+
+// csvRowError is a validation error of a single line. It is reported in the import status
+// instead of failing the whole import.
+func csvRowError(format string, args ...interface{}) error {
+	e := errors.ErrInvalid
+	e.ErrMsg = fmt.Sprintf(format, args...)
+	return e
+}
+
+// documentCsvUpdate is a validated change to a single document.
+type documentCsvUpdate struct {
+	doc             *models.Document
+	original        models.Document
+	metadata        []models.Metadata
+	docChanged      bool
+	metadataChanged bool
+	// pending contains values that need to be created before updating the document metadata.
+	pending []*models.MetadataValue
+}
+
+// documentCsvValues resolves metadata values by their names and collects values to create.
+type documentCsvValues struct {
+	service  *DocumentService
+	userId   int
+	create   bool
+	existing map[string]int
+	pending  map[string]*models.MetadataValue
+	editable map[int]bool
+}
+
+func (v *documentCsvValues) resolve(key *models.MetadataKey, name string) (int, *models.MetadataValue, error) {
+	value := &models.MetadataValue{
+		UserId:    key.UserId,
+		KeyId:     key.Id,
+		Value:     name,
+		MatchType: models.MetadataMatchExact,
+	}
+	if key.Type.IsTyped() {
+		err := value.SetTypedValue(key.Type, name)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+	id := fmt.Sprintf("%d:%s", key.Id, strings.ToLower(value.Value))
+	if valueId, ok := v.existing[id]; ok {
+		return valueId, nil, nil
+	}
+	if pending, ok := v.pending[id]; ok {
+		return 0, pending, nil
+	}
+
+	existing, err := v.service.db.MetadataStore.GetValueByName(key.UserId, key.Id, value.Value)
+	if err == nil {
+		v.existing[id] = existing.Id
+		return existing.Id, nil, nil
+	} else if !errors.Is(err, errors.ErrRecordNotFound) {
+		return 0, nil, err
+	}
+
+	if !v.create {
+		return 0, nil, csvRowError("value '%s' does not exist for key '%s'", name, key.Key)
+	}
+	if key.UserId != v.userId {
+		editable, ok := v.editable[key.Id]
+		if !ok {
+			editable, err = v.service.db.MetadataStore.UserCanEditKeyValues(v.userId, key.Id)
+			if err != nil {
+				return 0, nil, err
+			}
+			v.editable[key.Id] = editable
+		}
+		if !editable {
+			return 0, nil, csvRowError("metadata key '%s' is read-only", key.Key)
+		}
+	}
+	v.pending[id] = value
+	return 0, value, nil
+}
+
+// ImportDocumentsCsv updates user's documents from csv that is in the format of ExportDocumentsCsv.
+// Only column 'id' is required, other fields are updated only if the column exists.
+// Metadata keys that have a column replace all document's values of the key, other metadata is kept.
+// All lines are validated first and nothing is saved if any line has errors.
+func (service *DocumentService) ImportDocumentsCsv(ctx context.Context, userId int, r io.Reader, opts DocumentCsvImportOptions) (*DocumentCsvImportStatus, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, invalidCsv("file is empty")
+	} else if err != nil {
+		return nil, invalidCsv(err.Error())
+	}
+	columns, err := service.parseDocumentCsvHeader(userId, header)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &DocumentCsvImportStatus{
+		DryRun:    opts.DryRun,
+		Errors:    []DocumentCsvImportError{},
+		Documents: []DocumentCsvImportChange{},
+	}
+	values := &documentCsvValues{
+		service:  service,
+		userId:   userId,
+		create:   opts.CreateValues,
+		existing: make(map[string]int),
+		pending:  make(map[string]*models.MetadataValue),
+		editable: make(map[int]bool),
+	}
+	seenDocs := make(map[string]bool)
+	updates := make([]*documentCsvUpdate, 0)
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				status.Errors = append(status.Errors, DocumentCsvImportError{Line: parseErr.StartLine, Error: parseErr.Err.Error()})
+				continue
+			}
+			return nil, fmt.Errorf("read csv: %v", err)
+		}
+		line, _ := reader.FieldPos(0)
+		status.Rows += 1
+
+		docId := strings.TrimSpace(row[columns.id])
+		addError := func(msg string) {
+			status.Errors = append(status.Errors, DocumentCsvImportError{Line: line, DocumentId: docId, Error: msg})
+		}
+		if docId == "" {
+			addError("id is required")
+			continue
+		}
+		if seenDocs[docId] {
+			addError("duplicate document")
+			continue
+		}
+		seenDocs[docId] = true
+
+		update, err := service.parseDocumentCsvRow(userId, docId, row, columns, values)
+		if err != nil {
+			var rowErr errors.Error
+			if errors.Is(err, errors.ErrInvalid) && errors.As(err, &rowErr) {
+				addError(rowErr.ErrMsg)
+				continue
+			}
+			return nil, err
+		}
+		if !update.docChanged && !update.metadataChanged {
+			status.Unchanged += 1
+			continue
+		}
+		status.Changed += 1
+		status.Documents = append(status.Documents, DocumentCsvImportChange{
+			DocumentId: docId,
+			Name:       update.doc.Name,
+			Changes:    update.changes(),
+		})
+		updates = append(updates, update)
+	}
+	status.CreatedValues = len(values.pending)
+
+	if len(status.Errors) > 0 || opts.DryRun {
+		return status, nil
+	}
+	err = service.applyDocumentCsvUpdates(ctx, userId, updates, values)
+	if err != nil {
+		return nil, err
+	}
+	status.Applied = true
+	logger.Context(ctx).Infof("Imported csv for user %d, updated %d documents, created %d values",
+		userId, status.Changed, status.CreatedValues)
+	return status, nil
+}
+
+func (service *DocumentService) parseDocumentCsvRow(userId int, docId string, row []string, columns *documentCsvColumns, values *documentCsvValues) (*documentCsvUpdate, error) {
+	doc, err := service.db.DocumentStore.GetDocument(docId)
+	if errors.Is(err, errors.ErrRecordNotFound) {
+		return nil, csvRowError("document not found")
+	} else if err != nil {
+		return nil, err
+	}
+	if doc.UserId != userId || doc.DeletedAt.Valid {
+		return nil, csvRowError("document not found")
+	}
+	metadata, err := service.db.MetadataStore.GetDocumentMetadata(userId, docId)
+	if err != nil {
+		return nil, err
+	}
+
+	update := &documentCsvUpdate{doc: doc, original: *doc}
+	if columns.name != -1 {
+		name := strings.TrimSpace(row[columns.name])
+		if name == "" {
+			return nil, csvRowError("name is required")
+		}
+		if name != doc.Name {
+			doc.Name = name
+			update.docChanged = true
+		}
+	}
+	if columns.date != -1 {
+		date, err := time.Parse(DocumentCsvDateFormat, strings.TrimSpace(row[columns.date]))
+		if err != nil {
+			return nil, csvRowError("invalid date, expected format YYYY-MM-DD")
+		}
+		if date.Format(DocumentCsvDateFormat) != doc.Date.Format(DocumentCsvDateFormat) {
+			doc.Date = date
+			update.docChanged = true
+		}
+	}
+	if columns.filename != -1 {
+		filename := strings.TrimSpace(row[columns.filename])
+		if filename != doc.Filename {
+			doc.Filename = filename
+			update.docChanged = true
+		}
+	}
+
+	// keep metadata of keys that are not in the csv
+	replacedKeys := make(map[int]bool)
+	for _, key := range columns.keys {
+		replacedKeys[key.Id] = true
+	}
+	for _, v := range *metadata {
+		if v.KeyId != 0 && !replacedKeys[v.KeyId] {
+			update.metadata = append(update.metadata, models.Metadata{KeyId: v.KeyId, ValueId: v.ValueId})
+		}
+	}
+
+	indexes := make([]int, 0, len(columns.keys))
+	for i := range columns.keys {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	for _, i := range indexes {
+		key := columns.keys[i]
+		for _, name := range splitCsvValues(row[i]) {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			valueId, pending, err := values.resolve(key, name)
+			if err != nil {
+				return nil, err
+			}
+			if pending != nil {
+				update.pending = append(update.pending, pending)
+				update.metadataChanged = true
+				continue
+			}
+			if !hasMetadataValue(update.metadata, key.Id, valueId) {
+				update.metadata = append(update.metadata, models.Metadata{KeyId: key.Id, ValueId: valueId})
+			}
+		}
+	}
+	if !update.metadataChanged {
+		update.metadataChanged = !sameMetadata(*metadata, update.metadata)
+	}
+	return update, nil
+}
+
+func (update *documentCsvUpdate) changes() []string {
+	changes := make([]string, 0)
+	if update.doc.Name != update.original.Name {
+		changes = append(changes, documentCsvColumnName)
+	}
+	if !update.doc.Date.Equal(update.original.Date) {
+		changes = append(changes, documentCsvColumnDate)
+	}
+	if update.doc.Filename != update.original.Filename {
+		changes = append(changes, documentCsvColumnFilename)
+	}
+	if update.metadataChanged {
+		changes = append(changes, "metadata")
+	}
+	return changes
+}
+
+// applyDocumentCsvUpdates creates the pending values and updates the documents in a single transaction.
+// Documents are queued for processing after the transaction is committed.
+func (service *DocumentService) applyDocumentCsvUpdates(ctx context.Context, userId int, updates []*documentCsvUpdate, values *documentCsvValues) error {
+	tx, err := storage.NewTx(service.db, ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+
+	for _, v := range values.pending {
+		err := service.db.MetadataStore.CreateValueTx(tx, v)
+		if err != nil {
+			return fmt.Errorf("create value: %v", err)
+		}
+	}
+
+	docIds := make([]string, 0, len(updates))
+	editedDocIds := make([]string, 0, len(updates))
+	metadataDocIds := make([]string, 0, len(updates))
+	for _, update := range updates {
+		if update.docChanged {
+			update.doc.Update()
+			err := service.db.DocumentStore.UpdateTx(tx, userId, update.doc)
+			if err != nil {
+				return err
+			}
+		}
+		if update.metadataChanged {
+			metadata := update.metadata
+			for _, v := range update.pending {
+				if !hasMetadataValue(metadata, v.KeyId, v.Id) {
+					metadata = append(metadata, models.Metadata{KeyId: v.KeyId, ValueId: v.Id})
+				}
+			}
+			err := service.db.MetadataStore.UpdateDocumentKeyValuesTx(tx, userId, update.doc.Id, metadata)
+			if err != nil {
+				return err
+			}
+			metadataDocIds = append(metadataDocIds, update.doc.Id)
+		} else {
+			editedDocIds = append(editedDocIds, update.doc.Id)
+		}
+		docIds = append(docIds, update.doc.Id)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	if len(docIds) == 0 {
+		return nil
+	}
+
+	err = service.db.JobStore.AddRuleTriggers(service.db, editedDocIds, models.RuleTriggers{models.RuleTriggerEdit})
+	if err != nil {
+		logger.Context(ctx).Warnf("error queueing rules for imported documents: %v", err)
+	}
+	err = service.db.JobStore.AddRuleTriggers(service.db, metadataDocIds,
+		models.RuleTriggers{models.RuleTriggerEdit, models.RuleTriggerMetadata})
+	if err != nil {
+		logger.Context(ctx).Warnf("error queueing rules for imported documents: %v", err)
+	}
+	err = service.db.JobStore.AddDocuments(service.db, userId, docIds, []models.ProcessStep{models.ProcessFts})
+	if err != nil && !errors.Is(err, errors.ErrAlreadyExists) {
+		return err
+	}
+	if service.process != nil {
+		service.process.PullDocumentsToProcess()
+	}
+	return nil
+}
+
+// escapeCsvValue escapes separators and escape characters in the value.
+func escapeCsvValue(value string) string {
+	value = strings.ReplaceAll(value, string(documentCsvEscape), string(documentCsvEscape)+string(documentCsvEscape))
+	return strings.ReplaceAll(value, DocumentCsvValueSeparator, string(documentCsvEscape)+DocumentCsvValueSeparator)
+}
+
+// splitCsvValues splits the cell to values by unescaped separators and unescapes the values.
+func splitCsvValues(cell string) []string {
+	values := make([]string, 0)
+	value := strings.Builder{}
+	escaped := false
+	for _, r := range cell {
+		if escaped {
+			value.WriteRune(r)
+			escaped = false
+		} else if r == documentCsvEscape {
+			escaped = true
+		} else if string(r) == DocumentCsvValueSeparator {
+			values = append(values, value.String())
+			value.Reset()
+		} else {
+			value.WriteRune(r)
+		}
+	}
+	return append(values, value.String())
+}
+
+func hasMetadataValue(metadata []models.Metadata, keyId, valueId int) bool {
+	for _, v := range metadata {
+		if v.KeyId == keyId && v.ValueId == valueId {
+			return true
+		}
+	}
+	return false
+}
+
+// sameMetadata returns true if both contain the same key-value pairs.
+func sameMetadata(a, b []models.Metadata) bool {
+	count := 0
+	for _, v := range a {
+		if v.KeyId == 0 {
+			continue
+		}
+		if !hasMetadataValue(b, v.KeyId, v.ValueId) {
+			return false
+		}
+		count += 1
+	}
+	return count == len(b)
+}
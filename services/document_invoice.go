@@ -0,0 +1,35 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"tryffel.net/go/virtualpaper/models"
+	"tryffel.net/go/virtualpaper/storage"
+)
+
+// SetInvoicePaid marks user's invoice as paid on the date, or as not paid if paid is false.
+// Date is truncated to the day.
+func (service *DocumentService) SetInvoicePaid(ctx context.Context, userId int, docId string, paid bool, date time.Time) error {
+	var paidAt *time.Time
+	if paid {
+		day := models.MidnightForDate(date)
+		paidAt = &day
+	}
+	tx, err := storage.NewTx(service.db, ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+
+	err = service.db.DocumentStore.SetInvoicePaid(tx, userId, docId, paidAt)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	service.reindexDocument(ctx, docId)
+	return nil
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+
+	"tryffel.net/go/virtualpaper/errors"
+	"tryffel.net/go/virtualpaper/models"
+	"tryffel.net/go/virtualpaper/models/aggregates"
+	"tryffel.net/go/virtualpaper/storage"
+	"tryffel.net/go/virtualpaper/util/logger"
+)
+
+// GetDocumentNotes returns the notes of the document. Caller must ensure the user can read the document.
+func (service *DocumentService) GetDocumentNotes(ctx context.Context, userId int, docId string) ([]models.DocumentNote, error) {
+	perms, err := service.DocumentPermissions(ctx, docId, userId)
+	if err != nil {
+		return nil, err
+	}
+	notes, err := service.db.DocumentStore.GetDocumentNotes(docId)
+	if err != nil {
+		return nil, err
+	}
+	for i := range notes {
+		setNotePermissions(&notes[i], perms)
+	}
+	return notes, nil
+}
+
+// AddDocumentNote adds a note to the document. Caller must ensure the user can write the document.
+func (service *DocumentService) AddDocumentNote(ctx context.Context, userId int, note *models.DocumentNote) error {
+	err := note.Validate()
+	if err != nil {
+		return err
+	}
+	perms, err := service.DocumentPermissions(ctx, note.DocumentId, userId)
+	if err != nil {
+		return err
+	}
+	note.UserId = userId
+
+	tx, err := storage.NewTx(service.db, ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+	err = service.db.DocumentStore.CreateDocumentNote(tx, note)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	created, err := service.db.DocumentStore.GetDocumentNote(note.DocumentId, note.Id)
+	if err != nil {
+		return err
+	}
+	*note = *created
+	setNotePermissions(note, perms)
+	service.reindexDocument(ctx, note.DocumentId)
+	return nil
+}
+
+// UpdateDocumentNote updates the note. Only the author can edit the note.
+func (service *DocumentService) UpdateDocumentNote(ctx context.Context, userId int, note *models.DocumentNote) error {
+	err := note.Validate()
+	if err != nil {
+		return err
+	}
+	perms, err := service.DocumentPermissions(ctx, note.DocumentId, userId)
+	if err != nil {
+		return err
+	}
+	original, err := service.db.DocumentStore.GetDocumentNote(note.DocumentId, note.Id)
+	if err != nil {
+		return err
+	}
+	setNotePermissions(original, perms)
+	if !original.Editable {
+		e := errors.ErrForbidden
+		e.ErrMsg = "only the author can edit the note"
+		return e
+	}
+
+	tx, err := storage.NewTx(service.db, ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+	err = service.db.DocumentStore.UpdateDocumentNote(tx, userId, original, note)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	updated, err := service.db.DocumentStore.GetDocumentNote(note.DocumentId, note.Id)
+	if err != nil {
+		return err
+	}
+	*note = *updated
+	setNotePermissions(note, perms)
+	if original.Content != note.Content {
+		service.reindexDocument(ctx, note.DocumentId)
+	}
+	return nil
+}
+
+// DeleteDocumentNote deletes the note. The author and the document owner can delete the note.
+func (service *DocumentService) DeleteDocumentNote(ctx context.Context, userId int, docId string, noteId int) error {
+	perms, err := service.DocumentPermissions(ctx, docId, userId)
+	if err != nil {
+		return err
+	}
+	note, err := service.db.DocumentStore.GetDocumentNote(docId, noteId)
+	if err != nil {
+		return err
+	}
+	setNotePermissions(note, perms)
+	if !note.Deletable {
+		e := errors.ErrForbidden
+		e.ErrMsg = "only the author or the document owner can delete the note"
+		return e
+	}
+
+	tx, err := storage.NewTx(service.db, ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+	err = service.db.DocumentStore.DeleteDocumentNote(tx, userId, note)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	service.reindexDocument(ctx, docId)
+	return nil
+}
+
+// setNotePermissions sets whether the user can modify the note. Authors can edit their own notes
+// as long as they have write access, and document owner can remove any note.
+func setNotePermissions(note *models.DocumentNote, perms *aggregates.DocumentPermissions) {
+	canWrite := perms.Owner || perms.SharedPermissions.Write
+	note.Editable = canWrite && note.UserId == perms.UserId
+	note.Deletable = note.Editable || perms.Owner
+}
+
+// reindexDocument updates the document, e.g. its notes, in search index.
+func (service *DocumentService) reindexDocument(ctx context.Context, docId string) {
+	err := service.db.JobStore.ForceProcessingDocument(docId, []models.ProcessStep{models.ProcessFts})
+	if err != nil {
+		logger.Context(ctx).Warnf("error marking document for processing (doc %s): %v", docId, err)
+		return
+	}
+	err = service.process.AddDocumentForProcessing(docId)
+	if err != nil {
+		logger.Context(ctx).Warnf("error adding document for processing (doc: %s): %v", docId, err)
+	}
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"tryffel.net/go/virtualpaper/errors"
+	"tryffel.net/go/virtualpaper/models"
+	"tryffel.net/go/virtualpaper/storage"
+	"tryffel.net/go/virtualpaper/util/logger"
+)
+
+func (service *MetadataService) GetDocumentTypes(ctx context.Context, userId int, sort storage.SortKey, paging storage.Paging) ([]*models.DocumentType, int, error) {
+	return service.db.MetadataStore.GetDocumentTypes(userId, sort, paging)
+}
+
+func (service *MetadataService) GetDocumentType(ctx context.Context, userId, typeId int) (*models.DocumentType, error) {
+	return service.db.MetadataStore.GetDocumentType(userId, typeId)
+}
+
+func (service *MetadataService) CreateDocumentType(ctx context.Context, docType *models.DocumentType) error {
+	err := service.validateDocumentTypeKeys(docType)
+	if err != nil {
+		return err
+	}
+	tx, err := storage.NewTx(service.db, ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+
+	err = service.db.MetadataStore.CreateDocumentType(tx, docType)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (service *MetadataService) UpdateDocumentType(ctx context.Context, docType *models.DocumentType) error {
+	existing, err := service.db.MetadataStore.GetDocumentType(docType.UserId, docType.Id)
+	if err != nil {
+		return err
+	}
+	err = service.validateDocumentTypeKeys(docType)
+	if err != nil {
+		return err
+	}
+	tx, err := storage.NewTx(service.db, ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+
+	err = service.db.MetadataStore.UpdateDocumentType(tx, docType)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	if existing.Name != docType.Name {
+		service.reindexDocumentType(ctx, docType.UserId, docType.Id)
+	}
+	return nil
+}
+
+// DeleteDocumentType deletes the document type. Documents of the type are left without a type.
+func (service *MetadataService) DeleteDocumentType(ctx context.Context, userId, typeId int) error {
+	_, err := service.db.MetadataStore.GetDocumentType(userId, typeId)
+	if err != nil {
+		return err
+	}
+	tx, err := storage.NewTx(service.db, ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+
+	// documents cannot be found by the type after deleting, so queue them by id.
+	docIds, err := service.db.MetadataStore.DeleteDocumentType(tx, userId, typeId)
+	if err != nil {
+		return err
+	}
+	if len(docIds) > 0 {
+		err = service.db.JobStore.AddDocuments(tx, 0, docIds, []models.ProcessStep{models.ProcessFts})
+		if err != nil {
+			return err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	service.process.PullDocumentsToProcess()
+	return nil
+}
+
+// validateDocumentTypeKeys ensures user can use the keys and default values of the document type.
+func (service *MetadataService) validateDocumentTypeKeys(docType *models.DocumentType) error {
+	keys := map[int]bool{}
+	for _, v := range docType.Keys {
+		if keys[v.KeyId] {
+			e := errors.ErrInvalid
+			e.ErrMsg = fmt.Sprintf("duplicate key %d in document type", v.KeyId)
+			return e
+		}
+		keys[v.KeyId] = true
+
+		ok, err := service.db.MetadataStore.UserCanAccessKey(docType.UserId, v.KeyId)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			e := errors.ErrInvalid
+			e.ErrMsg = fmt.Sprintf("metadata key %d not found", v.KeyId)
+			return e
+		}
+		if v.DefaultValueId == 0 {
+			continue
+		}
+		ok, err = service.db.MetadataStore.UserHasKeyValue(docType.UserId, v.KeyId, int(v.DefaultValueId))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			e := errors.ErrInvalid
+			e.ErrMsg = fmt.Sprintf("default value %d does not belong to key %d", v.DefaultValueId, v.KeyId)
+			return e
+		}
+	}
+	return nil
+}
+
+func (service *MetadataService) reindexDocumentType(ctx context.Context, userId, typeId int) {
+	err := service.db.JobStore.IndexDocumentsByDocumentType(userId, typeId)
+	if err != nil {
+		logger.Context(ctx).Errorf("queue indexing documents of document type %d: %v", typeId, err)
+		return
+	}
+	service.process.PullDocumentsToProcess()
+}
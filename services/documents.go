@@ -80,9 +80,31 @@ func (service *DocumentService) GetDocument(ctx context.Context, userId int, id
 	}
 	aggregate := aggregates.DocumentToAggregate(doc, sharedUsers)
 	aggregate.Status = status
+	if userId == doc.UserId {
+		aggregate.Duplicates, err = service.db.DocumentStore.GetDocumentDuplicates(id)
+		if err != nil {
+			return nil, err
+		}
+		if doc.DocumentTypeId != 0 {
+			docType, err := service.db.MetadataStore.GetDocumentType(userId, int(doc.DocumentTypeId))
+			if err != nil {
+				return nil, err
+			}
+			aggregate.MissingMetadata = docType.MissingKeys(doc.Metadata)
+		}
+		aggregate.MetadataSuggestions, err = service.db.MetadataStore.GetDocumentMetadataSuggestions(id)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return aggregate, nil
 }
 
+// GetIncompleteDocuments returns documents that do not have a document type or are missing required metadata.
+func (service *DocumentService) GetIncompleteDocuments(ctx context.Context, userId int, paging storage.Paging, sort storage.SortKey) (*[]models.Document, int, error) {
+	return service.db.DocumentStore.GetIncompleteDocuments(userId, paging, sort)
+}
+
 func (service *DocumentService) GetDeletedDocuments(userId int, paging storage.Paging, sort storage.SortKey, limitContent bool) (*[]models.Document, int, error) {
 	return service.db.DocumentStore.GetDocuments(service.db, userId, paging, sort, limitContent, true, true)
 }
@@ -335,7 +357,6 @@ func (service *DocumentService) BulkEditDocuments(ctx context.Context, req *aggr
 	}
 
 	if len(req.AddMetadata) > 0 {
-		addMetadata := req.AddMetadata.ToMetadataArray()
 		keys := req.AddMetadata.UniqueKeys()
 		ok, err := service.db.MetadataStore.UserHasKeys(tx, userId, keys)
 		if err != nil {
@@ -344,6 +365,11 @@ func (service *DocumentService) BulkEditDocuments(ctx context.Context, req *aggr
 		if !ok {
 			return errors.ErrRecordNotFound
 		}
+		err = resolveTypedMetadata(service.db, userId, req.AddMetadata)
+		if err != nil {
+			return err
+		}
+		addMetadata := req.AddMetadata.ToMetadataArray()
 		err = service.db.MetadataStore.UpsertDocumentMetadata(tx, userId, req.Documents, addMetadata)
 		if err != nil {
 			return err
@@ -386,6 +412,15 @@ func (service *DocumentService) BulkEditDocuments(ctx context.Context, req *aggr
 		}
 	}
 
+	triggers := models.RuleTriggers{models.RuleTriggerEdit}
+	if len(req.AddMetadata) > 0 || len(req.RemoveMetadata) > 0 {
+		triggers = triggers.Add(models.RuleTriggerMetadata)
+	}
+	err = service.db.JobStore.AddRuleTriggers(tx, req.Documents, triggers)
+	if err != nil {
+		return fmt.Errorf("queue rules: %v", err)
+	}
+
 	// need to reindex
 	err = service.db.JobStore.AddDocuments(tx, userId, req.Documents, []models.ProcessStep{models.ProcessFts})
 	if err != nil {
@@ -405,16 +440,35 @@ func (service *DocumentService) UpdateDocument(ctx context.Context, userId int,
 		return nil, err
 	}
 
+	oldMetadata, err := service.db.MetadataStore.GetDocumentMetadata(userId, docId)
+	if err != nil {
+		return nil, err
+	}
+
 	if len(updated.Metadata) > 0 {
-		uniqueKeys := updated.Metadata.UniqueKeys()
-		owns, err := service.db.MetadataStore.UserHasKeys(service.db, userId, uniqueKeys)
+		// keys that document already has are kept, e.g. after unsubscribing from a vocabulary
+		newKeys := make([]int, 0)
+		for _, key := range updated.Metadata.UniqueKeys() {
+			if !hasMetadataKey(*oldMetadata, key) {
+				newKeys = append(newKeys, key)
+			}
+		}
+		if len(newKeys) > 0 {
+			owns, err := service.db.MetadataStore.UserHasKeys(service.db, userId, newKeys)
+			if err != nil {
+				return nil, err
+			}
+			if !owns {
+				return nil, errors.ErrRecordNotFound
+			}
+		}
+		err = resolveTypedMetadata(service.db, userId, updated.Metadata)
 		if err != nil {
 			return nil, err
 		}
-		if !owns {
-			return nil, errors.ErrRecordNotFound
-		}
 	}
+	original := *doc
+	original.Metadata = *oldMetadata
 
 	if !updated.Date.IsZero() {
 		doc.Date = updated.Date
@@ -434,6 +488,16 @@ func (service *DocumentService) UpdateDocument(ctx context.Context, userId int,
 			ValueId: v.ValueId,
 		}
 	}
+	if updated.DocumentTypeId != int(doc.DocumentTypeId) {
+		doc.DocumentTypeId = models.IntId(updated.DocumentTypeId)
+		if doc.DocumentTypeId != 0 {
+			docType, err := service.db.MetadataStore.GetDocumentType(userId, updated.DocumentTypeId)
+			if err != nil {
+				return nil, err
+			}
+			metadata = append(metadata, docType.Defaults(metadata)...)
+		}
+	}
 	doc.Update()
 	doc.Metadata = metadata
 
@@ -446,6 +510,15 @@ func (service *DocumentService) UpdateDocument(ctx context.Context, userId int,
 	if err != nil {
 		return nil, err
 	}
+
+	triggers := models.RuleTriggers{models.RuleTriggerEdit}
+	if models.ChangeTriggers(&original, doc).Has(models.RuleTriggerMetadata) {
+		triggers = triggers.Add(models.RuleTriggerMetadata)
+	}
+	err = service.db.JobStore.AddRuleTriggers(service.db, []string{doc.Id}, triggers)
+	if err != nil {
+		logger.Context(ctx).Warnf("error queueing rules for document (doc %s): %v", doc.Id, err)
+	}
 	err = service.db.JobStore.ForceProcessingDocument(doc.Id, []models.ProcessStep{models.ProcessFts})
 	if err != nil {
 		logger.Context(ctx).Warnf("error marking document for processing (doc %s): %v", doc.Id, err)
@@ -482,6 +555,10 @@ func (service *DocumentService) UpdateSharing(ctx context.Context, docId string,
 		return err
 	}
 
+	err = service.db.JobStore.AddRuleTriggers(service.db, []string{docId}, models.RuleTriggers{models.RuleTriggerShare})
+	if err != nil {
+		logger.Context(ctx).Warnf("error queueing rules for document (doc %s): %v", docId, err)
+	}
 	err = service.db.JobStore.ForceProcessingDocument(docId, []models.ProcessStep{models.ProcessFts})
 	if err != nil {
 		logger.Context(ctx).Warnf("error marking document for processing (doc %s): %v", docId, err)
@@ -555,6 +632,170 @@ func (service *DocumentService) UpdateLinkedDocuments(ctx context.Context, userI
 	return nil
 }
 
+// GetSimilarDocuments returns user's other documents ranked by content similarity and shared metadata.
+// Returns also the total number of similar documents.
+func (service *DocumentService) GetSimilarDocuments(ctx context.Context, userId int, docId string, paging storage.Paging) ([]models.SimilarDocument, int, error) {
+	signature, metadataCount, err := service.db.DocumentStore.GetSimilaritySignature(docId)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(signature) == 0 {
+		logger.Context(ctx).Debugf("document %s does not have similarity signature yet, match only by metadata", docId)
+	}
+
+	candidates, err := service.db.DocumentStore.GetSimilarityCandidates(userId, docId)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	docs := process.RankSimilarDocuments(signature, metadataCount, candidates)
+	total := len(docs)
+	if paging.Offset >= total {
+		return []models.SimilarDocument{}, total, nil
+	}
+	end := paging.Offset + paging.Limit
+	if end > total {
+		end = total
+	}
+	return docs[paging.Offset:end], total, nil
+}
+
+// GetDuplicateClusters returns user's documents grouped by likely duplicates.
+func (service *DocumentService) GetDuplicateClusters(ctx context.Context, userId int) ([]models.DuplicateCluster, error) {
+	pairs, err := service.db.DocumentStore.GetDuplicatePairs(userId)
+	if err != nil {
+		return nil, err
+	}
+	clusters := process.ClusterDuplicates(pairs)
+
+	ids := make([]string, 0, len(pairs)*2)
+	for _, v := range clusters {
+		ids = append(ids, v...)
+	}
+	docs, err := service.db.DocumentStore.GetDuplicateDocuments(userId, ids)
+	if err != nil {
+		return nil, err
+	}
+	docMap := make(map[string]models.DuplicateDocument, len(docs))
+	for _, v := range docs {
+		docMap[v.DocumentId] = v
+	}
+
+	result := make([]models.DuplicateCluster, 0, len(clusters))
+	for _, cluster := range clusters {
+		item := models.DuplicateCluster{Documents: make([]models.DuplicateDocument, 0, len(cluster))}
+		for _, id := range cluster {
+			if doc, ok := docMap[id]; ok {
+				item.Documents = append(item.Documents, doc)
+			}
+		}
+		if len(item.Documents) > 1 {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+// MergeDuplicates merges duplicate documents into the target document. Metadata of the duplicates is
+// added to target document and the duplicates are moved to trash bin.
+func (service *DocumentService) MergeDuplicates(ctx context.Context, userId int, targetId string, docIds []string) error {
+	for _, v := range docIds {
+		if v == targetId {
+			e := errors.ErrInvalid
+			e.ErrMsg = "cannot merge document into itself"
+			return e
+		}
+	}
+
+	ownership, err := service.db.DocumentStore.UserOwnsDocuments(service.db, userId, append([]string{targetId}, docIds...))
+	if err != nil {
+		return err
+	}
+	if !ownership {
+		return errors.ErrRecordNotFound
+	}
+
+	target, err := service.db.MetadataStore.GetDocumentMetadata(userId, targetId)
+	if err != nil {
+		return err
+	}
+	metadata := *target
+	values := make(map[int]bool, len(metadata))
+	for _, v := range metadata {
+		values[v.ValueId] = true
+	}
+	for _, docId := range docIds {
+		docMetadata, err := service.db.MetadataStore.GetDocumentMetadata(userId, docId)
+		if err != nil {
+			return err
+		}
+		for _, v := range *docMetadata {
+			if !values[v.ValueId] {
+				values[v.ValueId] = true
+				metadata = append(metadata, v)
+			}
+		}
+	}
+
+	tx, err := storage.NewTx(service.db, ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+
+	if len(metadata) > len(*target) {
+		err = service.db.MetadataStore.UpdateDocumentKeyValuesTx(tx, userId, targetId, metadata)
+		if err != nil {
+			return err
+		}
+	}
+	for _, docId := range docIds {
+		err = service.db.DocumentStore.MarkDocumentDeletedTx(tx, userId, docId)
+		if err != nil {
+			return err
+		}
+	}
+	err = service.db.DocumentStore.AddDuplicateMergeHistory(tx, userId, targetId, docIds)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	logger.Context(ctx).WithField("documentId", targetId).Infof("Merged %d duplicate documents", len(docIds))
+	for _, docId := range docIds {
+		err = service.search.DeleteDocument(docId, userId)
+		if err != nil {
+			return fmt.Errorf("delete document from search index: %v", err)
+		}
+	}
+
+	err = service.db.JobStore.ForceProcessingDocument(targetId, []models.ProcessStep{models.ProcessFts})
+	if err != nil {
+		logger.Context(ctx).Warnf("error marking document for processing (doc %s): %v", targetId, err)
+	} else {
+		err = service.process.AddDocumentForProcessing(targetId)
+		if err != nil {
+			logger.Context(ctx).Warnf("error adding updated document for processing (doc: %s): %v", targetId, err)
+		}
+	}
+	return nil
+}
+
+// DismissDuplicates marks documents as not being duplicates of each other.
+func (service *DocumentService) DismissDuplicates(ctx context.Context, userId int, docIds []string) error {
+	ownership, err := service.db.DocumentStore.UserOwnsDocuments(service.db, userId, docIds)
+	if err != nil {
+		return err
+	}
+	if !ownership {
+		return errors.ErrRecordNotFound
+	}
+	return service.db.DocumentStore.DismissDuplicates(userId, docIds)
+}
+
 func (service *DocumentService) GetContent(ctx context.Context, docId string) (*string, error) {
 	return service.db.DocumentStore.GetContent(docId)
 }
@@ -579,6 +820,11 @@ func (service *DocumentService) GetStatistics(ctx context.Context, userId int) (
 	return stats, nil
 }
 
+// GetRuleTraces returns the trace of the rules that were last run for the document.
+func (service *DocumentService) GetRuleTraces(ctx context.Context, docId string) ([]*models.DocumentRuleTrace, error) {
+	return service.db.RuleStore.GetDocumentRuleTraces(docId)
+}
+
 func (service *DocumentService) GetDocumentLogs(ctx context.Context, docId string) (*[]models.Job, error) {
 	return service.db.JobStore.GetJobsByDocumentId(docId)
 }
@@ -610,3 +856,12 @@ func docStatsToUserStats(stats *models.UserDocumentStatistics) *aggregates.UserD
 	}
 	return uds
 }
+
+func hasMetadataKey(metadata []models.Metadata, keyId int) bool {
+	for _, v := range metadata {
+		if v.KeyId == keyId {
+			return true
+		}
+	}
+	return false
+}
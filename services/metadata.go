@@ -2,7 +2,12 @@ package services
 
 import (
 	"context"
+	"fmt"
+
+	"tryffel.net/go/virtualpaper/config"
+	"tryffel.net/go/virtualpaper/errors"
 	"tryffel.net/go/virtualpaper/models"
+	"tryffel.net/go/virtualpaper/models/aggregates"
 	"tryffel.net/go/virtualpaper/services/process"
 	"tryffel.net/go/virtualpaper/storage"
 )
@@ -27,44 +32,182 @@ func (service *MetadataService) UserOwnsKey(ctx context.Context, userId, keyId i
 	return service.db.MetadataStore.UserHasKey(userId, keyId)
 }
 
+// UserCanAccessKey returns true if the user owns the key or uses it through a vocabulary.
+func (service *MetadataService) UserCanAccessKey(ctx context.Context, userId, keyId int) (bool, error) {
+	return service.db.MetadataStore.UserCanAccessKey(userId, keyId)
+}
+
+// UserCanEditKeyValues returns true if the user owns the key or uses it through an editable vocabulary.
+func (service *MetadataService) UserCanEditKeyValues(ctx context.Context, userId, keyId int) (bool, error) {
+	return service.db.MetadataStore.UserCanEditKeyValues(userId, keyId)
+}
+
 func (service *MetadataService) GetKeyValues(ctx context.Context, keyId int, sort storage.SortKey, paging storage.Paging) (*[]models.MetadataValue, error) {
 	return service.db.MetadataStore.GetValues(keyId, sort, paging)
 }
 
+// GetKeyValueTree returns all values of the key arranged by their parents.
+func (service *MetadataService) GetKeyValueTree(ctx context.Context, keyId int, sort storage.SortKey) ([]*models.MetadataValue, int, error) {
+	values, err := service.db.MetadataStore.GetValues(keyId, sort, storage.Paging{Limit: config.MaxRows})
+	if err != nil {
+		return nil, 0, err
+	}
+	return models.MetadataValueTree(*values), len(*values), nil
+}
+
 func (service *MetadataService) GetKey(ctx context.Context, keyId int) (*models.MetadataKey, error) {
 	return service.db.MetadataStore.GetKey(keyId)
 }
 
 func (service *MetadataService) Create(ctx context.Context, userId int, key *models.MetadataKey) error {
+	err := key.Type.Validate()
+	if err != nil {
+		return err
+	}
+	err = key.ValidateAutoApplyThreshold()
+	if err != nil {
+		return err
+	}
 	return service.db.MetadataStore.CreateKey(userId, key)
 }
 
 func (service *MetadataService) CreateValue(ctx context.Context, value *models.MetadataValue) error {
+	err := service.normalizeValue(value)
+	if err != nil {
+		return err
+	}
+	err = service.validateParent(value)
+	if err != nil {
+		return err
+	}
 	return service.db.MetadataStore.CreateValue(value)
 }
 
+// validateParent ensures the parent value belongs to the same key and does not create a cycle.
+func (service *MetadataService) validateParent(value *models.MetadataValue) error {
+	if value.ParentId == 0 {
+		return nil
+	}
+	parentId := int(value.ParentId)
+	ok, err := service.db.MetadataStore.UserHasKeyValue(value.UserId, value.KeyId, parentId)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		e := errors.ErrInvalid
+		e.ErrMsg = "parent value does not exist"
+		return e
+	}
+
+	ancestors, err := service.db.MetadataStore.GetValueAncestors(parentId)
+	if err != nil {
+		return err
+	}
+	for _, id := range ancestors {
+		if id == value.Id {
+			e := errors.ErrInvalid
+			e.ErrMsg = "value cannot be a parent of itself"
+			return e
+		}
+	}
+	height := 0
+	if value.Id != 0 {
+		// the children of the value are moved with it
+		height, err = service.db.MetadataStore.GetValueHeight(value.Id)
+		if err != nil {
+			return err
+		}
+	}
+	if len(ancestors)+height >= models.MaxMetadataValueDepth {
+		e := errors.ErrInvalid
+		e.ErrMsg = fmt.Sprintf("values can be nested at most %d levels deep", models.MaxMetadataValueDepth)
+		return e
+	}
+	return nil
+}
+
+// normalizeValue parses the value if the key is typed. Values belong to the owner of the key,
+// also when added by a vocabulary subscriber.
+func (service *MetadataService) normalizeValue(value *models.MetadataValue) error {
+	key, err := service.db.MetadataStore.GetKey(value.KeyId)
+	if err != nil {
+		return err
+	}
+	value.UserId = key.UserId
+	if !key.Type.IsTyped() {
+		return nil
+	}
+	return value.SetTypedValue(key.Type, value.Value)
+}
+
 func (service *MetadataService) UpdateValue(ctx context.Context, value *models.MetadataValue) error {
+	err := service.normalizeValue(value)
+	if err != nil {
+		return err
+	}
+	ok, err := service.db.MetadataStore.UserHasKeyValue(value.UserId, value.KeyId, value.Id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		e := errors.ErrRecordNotFound
+		e.ErrMsg = "metadata value not found"
+		return e
+	}
+	err = service.validateParent(value)
+	if err != nil {
+		return err
+	}
 	// TODO: wrap in transaction
-	err := service.db.MetadataStore.UpdateValue(value)
+	err = service.db.MetadataStore.UpdateValue(value)
 	if err != nil {
 		return err
 	}
-	return service.db.JobStore.IndexDocumentsByMetadata(value.UserId, value.KeyId, value.Id)
+	// documents of vocabulary subscribers have the value too
+	return service.db.JobStore.IndexDocumentsByMetadata(0, value.KeyId, value.Id)
 }
 
 func (service *MetadataService) UpdateKey(ctx context.Context, key *models.MetadataKey) error {
+	err := key.Type.Validate()
+	if err != nil {
+		return err
+	}
+	err = key.ValidateAutoApplyThreshold()
+	if err != nil {
+		return err
+	}
+	existing, err := service.db.MetadataStore.GetKey(key.Id)
+	if err != nil {
+		return err
+	}
+	if key.Type == "" {
+		key.Type = existing.Type
+	}
+	if existing.Type.String() != key.Type.String() {
+		hasValues, err := service.db.MetadataStore.KeyHasValues(key.Id)
+		if err != nil {
+			return err
+		}
+		if hasValues {
+			e := errors.ErrInvalid
+			e.ErrMsg = "cannot change type of a key that has values"
+			return e
+		}
+	}
+
 	// TODO: wrap in transaction
-	err := service.db.MetadataStore.UpdateKey(key)
+	err = service.db.MetadataStore.UpdateKey(key)
 	if err != nil {
 		return err
 	}
-	return service.db.JobStore.IndexDocumentsByMetadata(key.UserId, key.Id, 0)
+	// documents of vocabulary subscribers have the key too
+	return service.db.JobStore.IndexDocumentsByMetadata(0, key.Id, 0)
 }
 
 func (service *MetadataService) DeleteKey(ctx context.Context, userId int, keyId int) error {
-	// need to add processing when the metadata still exists
+	// need to add processing when the metadata still exists, including documents of vocabulary subscribers
 	// TODO: wrap in transaction
-	err := service.db.JobStore.IndexDocumentsByMetadata(userId, keyId, 0)
+	err := service.db.JobStore.IndexDocumentsByMetadata(0, keyId, 0)
 	if err != nil {
 		return err
 	}
@@ -78,8 +221,8 @@ func (service *MetadataService) DeleteKey(ctx context.Context, userId int, keyId
 }
 
 func (service *MetadataService) DeleteValue(ctx context.Context, userId, keyId, valueId int) error {
-	// need to add processing when the metadata still exists
-	err := service.db.JobStore.IndexDocumentsByMetadata(userId, keyId, valueId)
+	// need to add processing when the metadata still exists, including documents of vocabulary subscribers
+	err := service.db.JobStore.IndexDocumentsByMetadata(0, keyId, valueId)
 	if err != nil {
 		return err
 	}
@@ -91,3 +234,70 @@ func (service *MetadataService) DeleteValue(ctx context.Context, userId, keyId,
 	service.process.PullDocumentsToProcess()
 	return nil
 }
+
+// resolveTypedMetadata sets the value ids of free-form values of typed keys, creating the values if needed.
+func resolveTypedMetadata(db *storage.Database, userId int, metadata aggregates.MetadataArray) error {
+	for i, v := range metadata {
+		if v.ValueId != 0 {
+			continue
+		}
+		if v.Value == "" {
+			e := errors.ErrInvalid
+			e.ErrMsg = "metadata value is required"
+			return e
+		}
+		key, err := db.MetadataStore.GetKey(v.KeyId)
+		if err != nil {
+			return err
+		}
+		if key.UserId != userId {
+			ok, err := db.MetadataStore.UserCanAccessKey(userId, key.Id)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return errors.ErrRecordNotFound
+			}
+		}
+		if !key.Type.IsTyped() {
+			e := errors.ErrInvalid
+			e.ErrMsg = fmt.Sprintf("metadata key '%s' only accepts existing values", key.Key)
+			return e
+		}
+
+		// values belong to the owner of the key
+		value := &models.MetadataValue{
+			UserId:    key.UserId,
+			KeyId:     key.Id,
+			MatchType: models.MetadataMatchExact,
+		}
+		err = value.SetTypedValue(key.Type, v.Value)
+		if err != nil {
+			return err
+		}
+		existing, err := db.MetadataStore.GetValueByName(key.UserId, key.Id, value.Value)
+		if err == nil {
+			metadata[i].ValueId = existing.Id
+			continue
+		} else if !errors.Is(err, errors.ErrRecordNotFound) {
+			return err
+		}
+		if key.UserId != userId {
+			ok, err := db.MetadataStore.UserCanEditKeyValues(userId, key.Id)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				e := errors.ErrInvalid
+				e.ErrMsg = fmt.Sprintf("metadata key '%s' is read-only", key.Key)
+				return e
+			}
+		}
+		err = db.MetadataStore.CreateValue(value)
+		if err != nil {
+			return err
+		}
+		metadata[i].ValueId = value.Id
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"tryffel.net/go/virtualpaper/errors"
+	"tryffel.net/go/virtualpaper/models"
+	"tryffel.net/go/virtualpaper/storage"
+)
+
+// MergeValues merges value sourceId into value targetId of the same key. Documents and rules that refer to
+// the source value are changed to use the target value and the source value is deleted.
+func (service *MetadataService) MergeValues(ctx context.Context, userId, keyId, sourceId, targetId int) (*models.MetadataValue, error) {
+	if sourceId == targetId {
+		e := errors.ErrInvalid
+		e.ErrMsg = "cannot merge value into itself"
+		return nil, e
+	}
+	key, err := service.getUserKey(userId, keyId)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := storage.NewTx(service.db, ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Close()
+
+	source, err := service.getKeyValue(tx, keyId, sourceId)
+	if err != nil {
+		return nil, err
+	}
+	target, err := service.getKeyValue(tx, keyId, targetId)
+	if err != nil {
+		return nil, err
+	}
+	_, err = service.mergeValue(tx, userId, key, source, key, target)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	service.reindexMetadata(keyId, targetId)
+	return target, nil
+}
+
+// MoveValue moves the value to another key. If the key already has a value with the same name,
+// the value is merged into it. Moved value is removed from the value hierarchy.
+func (service *MetadataService) MoveValue(ctx context.Context, userId, keyId, valueId, targetKeyId int) (*models.MetadataValue, error) {
+	if keyId == targetKeyId {
+		e := errors.ErrInvalid
+		e.ErrMsg = "value already belongs to the key"
+		return nil, e
+	}
+	key, err := service.getUserKey(userId, keyId)
+	if err != nil {
+		return nil, err
+	}
+	targetKey, err := service.getUserKey(userId, targetKeyId)
+	if err != nil {
+		return nil, err
+	}
+	err = validateMergeKeyTypes(key, targetKey)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := storage.NewTx(service.db, ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Close()
+
+	value, err := service.getKeyValue(tx, keyId, valueId)
+	if err != nil {
+		return nil, err
+	}
+	err = service.db.MetadataStore.DetachValue(tx, value.Id)
+	if err != nil {
+		return nil, err
+	}
+	value, err = service.moveValue(tx, userId, key, value, targetKey)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	service.reindexMetadata(targetKeyId, value.Id)
+	return value, nil
+}
+
+// MergeKeys moves all values of key sourceId to key targetId and deletes the source key.
+// Values that exist in both keys are merged.
+func (service *MetadataService) MergeKeys(ctx context.Context, userId, sourceId, targetId int) (*models.MetadataKey, error) {
+	if sourceId == targetId {
+		e := errors.ErrInvalid
+		e.ErrMsg = "cannot merge key into itself"
+		return nil, e
+	}
+	source, err := service.getUserKey(userId, sourceId)
+	if err != nil {
+		return nil, err
+	}
+	target, err := service.getUserKey(userId, targetId)
+	if err != nil {
+		return nil, err
+	}
+	err = validateMergeKeyTypes(source, target)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := storage.NewTx(service.db, ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Close()
+
+	values, err := service.db.MetadataStore.GetKeyValues(tx, sourceId)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range values {
+		_, err = service.moveValue(tx, userId, source, v, target)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = service.db.MetadataStore.MergeKey(tx, userId, source, target)
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	service.reindexMetadata(targetId, 0)
+	return target, nil
+}
+
+// moveValue moves value to the target key, or merges it if target key has a value with the same name.
+func (service *MetadataService) moveValue(tx storage.SqlExecer, userId int, key *models.MetadataKey, value *models.MetadataValue, targetKey *models.MetadataKey) (*models.MetadataValue, error) {
+	existing, err := service.db.MetadataStore.GetValueByName(userId, targetKey.Id, value.Value)
+	if err == nil {
+		_, err = service.mergeValue(tx, userId, key, value, targetKey, existing)
+		return existing, err
+	} else if !errors.Is(err, errors.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	docs, err := service.db.MetadataStore.MoveValue(tx, value, targetKey.Id)
+	if err != nil {
+		return nil, err
+	}
+	err = service.db.MetadataStore.AddMetadataMergeHistory(tx, userId, docs,
+		formatMergeHistory(key, value), formatMergeHistory(targetKey, value))
+	return value, err
+}
+
+// mergeValue merges source into target and returns the ids of the documents that had the source value.
+func (service *MetadataService) mergeValue(tx storage.SqlExecer, userId int, key *models.MetadataKey, source *models.MetadataValue, targetKey *models.MetadataKey, target *models.MetadataValue) ([]string, error) {
+	ancestors, err := service.db.MetadataStore.GetValueAncestors(target.Id)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ancestors {
+		if id == source.Id {
+			e := errors.ErrInvalid
+			e.ErrMsg = fmt.Sprintf("cannot merge value '%s' into its child value '%s'", source.Value, target.Value)
+			return nil, e
+		}
+	}
+
+	docs, err := service.db.MetadataStore.MergeValue(tx, source, target)
+	if err != nil {
+		return nil, err
+	}
+	err = service.db.MetadataStore.AddMetadataMergeHistory(tx, userId, docs,
+		formatMergeHistory(key, source), formatMergeHistory(targetKey, target))
+	return docs, err
+}
+
+func (service *MetadataService) getUserKey(userId, keyId int) (*models.MetadataKey, error) {
+	key, err := service.db.MetadataStore.GetKey(keyId)
+	if err != nil {
+		return nil, err
+	}
+	if key.UserId != userId {
+		return nil, errors.ErrRecordNotFound
+	}
+	return key, nil
+}
+
+func (service *MetadataService) getKeyValue(tx storage.SqlExecer, keyId, valueId int) (*models.MetadataValue, error) {
+	value, err := service.db.MetadataStore.GetValue(tx, valueId)
+	if err != nil {
+		return nil, err
+	}
+	if value.KeyId != keyId {
+		return nil, errors.ErrRecordNotFound
+	}
+	return value, nil
+}
+
+// reindexMetadata queues documents with the metadata for indexing. Merge is already committed,
+// so errors are only logged.
+func (service *MetadataService) reindexMetadata(keyId, valueId int) {
+	// documents of vocabulary subscribers have the metadata too
+	err := service.db.JobStore.IndexDocumentsByMetadata(0, keyId, valueId)
+	if err != nil {
+		logrus.Errorf("queue indexing documents after merging metadata (key %d, value %d): %v", keyId, valueId, err)
+		return
+	}
+	service.process.PullDocumentsToProcess()
+}
+
+func validateMergeKeyTypes(source, target *models.MetadataKey) error {
+	if source.Type.String() != target.Type.String() {
+		e := errors.ErrInvalid
+		e.ErrMsg = fmt.Sprintf("keys have different types: %s and %s", source.Type.String(), target.Type.String())
+		return e
+	}
+	return nil
+}
+
+func formatMergeHistory(key *models.MetadataKey, value *models.MetadataValue) string {
+	return key.Key + ":" + value.Value
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"unicode/utf8"
+
+	"tryffel.net/go/virtualpaper/errors"
+	"tryffel.net/go/virtualpaper/models"
+	"tryffel.net/go/virtualpaper/services/process"
+	"tryffel.net/go/virtualpaper/storage"
+)
+
+// GetMetadataUsage returns user's metadata keys and values that are candidates for cleaning up.
+// Keys that are used in at most maxDocuments documents are reported as rarely used, and values of the same key
+// that differ by at most maxTypos characters are reported as similar.
+func (service *MetadataService) GetMetadataUsage(ctx context.Context, userId, maxDocuments, maxTypos int) (*models.MetadataUsageReport, error) {
+	values, err := service.db.MetadataStore.GetMetadataValueUsage(userId)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := service.db.MetadataStore.GetRarelyUsedKeys(userId, maxDocuments)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.MetadataUsageReport{
+		UnusedValues:       []models.MetadataValueUsage{},
+		SimilarValues:      findSimilarValues(values, maxTypos),
+		RarelyUsedKeys:     keys,
+		ValuesWithoutRules: []models.MetadataValueUsage{},
+	}
+	for _, v := range values {
+		if v.NumDocuments == 0 {
+			report.UnusedValues = append(report.UnusedValues, v)
+		}
+		if v.NumRules == 0 {
+			report.ValuesWithoutRules = append(report.ValuesWithoutRules, v)
+		}
+	}
+	return report, nil
+}
+
+// findSimilarValues returns the pairs of values of the same key that are similar to each other.
+// Values must be ordered by key. Values of typed keys are not compared, since they are not free text.
+func findSimilarValues(values []models.MetadataValueUsage, maxTypos int) []models.MetadataSimilarValues {
+	similar := []models.MetadataSimilarValues{}
+	start := 0
+	for start < len(values) {
+		end := start + 1
+		for end < len(values) && values[end].KeyId == values[start].KeyId {
+			end += 1
+		}
+		if !values[start].KeyType.IsTyped() {
+			// values whose lengths differ by more than maxTypos can't be similar, so after sorting by length
+			// each value is only compared to the values that follow it within that length window.
+			keyValues := make([]models.MetadataValueUsage, end-start)
+			copy(keyValues, values[start:end])
+			lengths := make([]int, len(keyValues))
+			for i := range keyValues {
+				lengths[i] = utf8.RuneCountInString(keyValues[i].Value)
+			}
+			sort.Sort(valuesByLength{values: keyValues, lengths: lengths})
+			for i := range keyValues {
+				for j := i + 1; j < len(keyValues) && lengths[j]-lengths[i] <= maxTypos; j++ {
+					if !process.SimilarTexts(keyValues[i].Value, keyValues[j].Value, maxTypos) {
+						continue
+					}
+					source, target := keyValues[i], keyValues[j]
+					if source.NumDocuments > target.NumDocuments ||
+						(source.NumDocuments == target.NumDocuments && source.ValueId < target.ValueId) {
+						source, target = target, source
+					}
+					similar = append(similar, models.MetadataSimilarValues{Source: source, Target: target})
+				}
+			}
+		}
+		start = end
+	}
+	return similar
+}
+
+// valuesByLength sorts values by their length in characters, keeping the original order for equal lengths.
+type valuesByLength struct {
+	values  []models.MetadataValueUsage
+	lengths []int
+}
+
+func (v valuesByLength) Len() int { return len(v.values) }
+func (v valuesByLength) Less(i, j int) bool {
+	if v.lengths[i] != v.lengths[j] {
+		return v.lengths[i] < v.lengths[j]
+	}
+	return v.values[i].ValueId < v.values[j].ValueId
+}
+func (v valuesByLength) Swap(i, j int) {
+	v.values[i], v.values[j] = v.values[j], v.values[i]
+	v.lengths[i], v.lengths[j] = v.lengths[j], v.lengths[i]
+}
+
+// CleanupMetadata merges and deletes user's metadata values and deletes keys in a single transaction.
+// Values are merged first, then values are deleted and finally keys are deleted. Rules that refer to
+// the deleted values or keys are disabled, since deleting would silently remove their conditions and actions.
+// If any of the items does not exist or user does not own it, nothing is changed.
+func (service *MetadataService) CleanupMetadata(ctx context.Context, userId int, cleanup *models.MetadataCleanup) (*models.MetadataCleanupResult, error) {
+	if len(cleanup.DeleteKeys) == 0 && len(cleanup.DeleteValues) == 0 && len(cleanup.MergeValues) == 0 {
+		e := errors.ErrInvalid
+		e.ErrMsg = "no keys or values to clean up"
+		return nil, e
+	}
+
+	tx, err := storage.NewTx(service.db, ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Close()
+
+	result := &models.MetadataCleanupResult{DisabledRules: []int{}}
+	docs := map[string]bool{}
+	addDocs := func(ids []string) {
+		for _, v := range ids {
+			docs[v] = true
+		}
+	}
+
+	for _, v := range cleanup.MergeValues {
+		if v.SourceId == v.TargetId {
+			e := errors.ErrInvalid
+			e.ErrMsg = "cannot merge value into itself"
+			return nil, e
+		}
+		source, err := service.db.MetadataStore.GetValue(tx, v.SourceId)
+		if err != nil {
+			return nil, err
+		}
+		key, err := service.getUserKey(userId, source.KeyId)
+		if err != nil {
+			return nil, err
+		}
+		target, err := service.getKeyValue(tx, key.Id, v.TargetId)
+		if err != nil {
+			return nil, err
+		}
+		merged, err := service.mergeValue(tx, userId, key, source, key, target)
+		if err != nil {
+			return nil, err
+		}
+		addDocs(merged)
+		result.MergedValues += 1
+	}
+
+	for _, id := range cleanup.DeleteValues {
+		value, err := service.db.MetadataStore.GetValue(tx, id)
+		if err != nil {
+			return nil, err
+		}
+		key, err := service.getUserKey(userId, value.KeyId)
+		if err != nil {
+			return nil, err
+		}
+		rules, err := service.db.RuleStore.DisableRulesByMetadata(tx, key.Id, value.Id)
+		if err != nil {
+			return nil, err
+		}
+		result.DisabledRules = append(result.DisabledRules, rules...)
+		deleted, err := service.db.MetadataStore.PurgeValue(tx, key, value)
+		if err != nil {
+			return nil, err
+		}
+		addDocs(deleted)
+		result.DeletedValues += 1
+	}
+
+	for _, id := range cleanup.DeleteKeys {
+		key, err := service.getUserKey(userId, id)
+		if err != nil {
+			return nil, err
+		}
+		rules, err := service.db.RuleStore.DisableRulesByMetadata(tx, key.Id, 0)
+		if err != nil {
+			return nil, err
+		}
+		result.DisabledRules = append(result.DisabledRules, rules...)
+		deleted, err := service.db.MetadataStore.PurgeKey(tx, key)
+		if err != nil {
+			return nil, err
+		}
+		addDocs(deleted)
+		result.DeletedKeys += 1
+	}
+
+	docIds := make([]string, 0, len(docs))
+	for id := range docs {
+		docIds = append(docIds, id)
+	}
+	if len(docIds) > 0 {
+		// documents of vocabulary subscribers have the metadata too
+		err = service.db.JobStore.AddDocuments(tx, 0, docIds, []models.ProcessStep{models.ProcessFts})
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	result.NumDocuments = len(docIds)
+	service.process.PullDocumentsToProcess()
+	return result, nil
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"tryffel.net/go/virtualpaper/errors"
+	"tryffel.net/go/virtualpaper/models"
+	"tryffel.net/go/virtualpaper/storage"
+)
+
+func (service *MetadataService) GetVocabularies(ctx context.Context, userId int, sort storage.SortKey, paging storage.Paging) ([]*models.MetadataVocabulary, int, error) {
+	return service.db.MetadataStore.GetVocabularies(userId, sort, paging)
+}
+
+func (service *MetadataService) GetVocabulary(ctx context.Context, userId, vocabularyId int) (*models.MetadataVocabulary, error) {
+	return service.db.MetadataStore.GetVocabulary(userId, vocabularyId)
+}
+
+func (service *MetadataService) CreateVocabulary(ctx context.Context, vocabulary *models.MetadataVocabulary) error {
+	err := service.validateVocabularyKeys(vocabulary)
+	if err != nil {
+		return err
+	}
+	err = service.validateVocabularyMembers(vocabulary)
+	if err != nil {
+		return err
+	}
+	tx, err := storage.NewTx(service.db, ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+
+	err = service.db.MetadataStore.CreateVocabulary(tx, vocabulary)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateVocabulary updates the vocabulary. Only the owner can update the vocabulary.
+func (service *MetadataService) UpdateVocabulary(ctx context.Context, vocabulary *models.MetadataVocabulary) error {
+	_, err := service.getOwnVocabulary(vocabulary.UserId, vocabulary.Id)
+	if err != nil {
+		return err
+	}
+	err = service.validateVocabularyKeys(vocabulary)
+	if err != nil {
+		return err
+	}
+	err = service.validateVocabularyMembers(vocabulary)
+	if err != nil {
+		return err
+	}
+	tx, err := storage.NewTx(service.db, ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+
+	err = service.db.MetadataStore.UpdateVocabulary(tx, vocabulary)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteVocabulary deletes the vocabulary. Only the owner can delete the vocabulary.
+func (service *MetadataService) DeleteVocabulary(ctx context.Context, userId, vocabularyId int) error {
+	_, err := service.getOwnVocabulary(userId, vocabularyId)
+	if err != nil {
+		return err
+	}
+	return service.db.MetadataStore.DeleteVocabulary(userId, vocabularyId)
+}
+
+// SubscribeVocabulary allows the user to use the keys of the vocabulary. The owner must have added the user
+// as a member of the vocabulary.
+func (service *MetadataService) SubscribeVocabulary(ctx context.Context, userId, vocabularyId int) error {
+	vocabulary, err := service.db.MetadataStore.GetVocabulary(userId, vocabularyId)
+	if err != nil {
+		return err
+	}
+	if vocabulary.Owned {
+		e := errors.ErrInvalid
+		e.ErrMsg = "cannot subscribe to own vocabulary"
+		return e
+	}
+	if !vocabulary.Member {
+		e := errors.ErrForbidden
+		e.ErrMsg = "vocabulary owner has not allowed subscribing"
+		return e
+	}
+	return service.db.MetadataStore.SubscribeVocabulary(userId, vocabularyId)
+}
+
+// UnsubscribeVocabulary stops using the keys of the vocabulary. Documents keep the metadata they already have.
+func (service *MetadataService) UnsubscribeVocabulary(ctx context.Context, userId, vocabularyId int) error {
+	vocabulary, err := service.db.MetadataStore.GetVocabulary(userId, vocabularyId)
+	if err != nil {
+		return err
+	}
+	if !vocabulary.Subscribed {
+		return errors.ErrRecordNotFound
+	}
+	return service.db.MetadataStore.UnsubscribeVocabulary(userId, vocabularyId)
+}
+
+func (service *MetadataService) getOwnVocabulary(userId, vocabularyId int) (*models.MetadataVocabulary, error) {
+	vocabulary, err := service.db.MetadataStore.GetVocabulary(userId, vocabularyId)
+	if err != nil {
+		return nil, err
+	}
+	if !vocabulary.Owned {
+		return nil, errors.ErrRecordNotFound
+	}
+	return vocabulary, nil
+}
+
+// validateVocabularyKeys ensures user owns the keys of the vocabulary.
+func (service *MetadataService) validateVocabularyKeys(vocabulary *models.MetadataVocabulary) error {
+	keys := make(map[int]bool)
+	for _, v := range vocabulary.Keys {
+		if keys[v.KeyId] {
+			e := errors.ErrInvalid
+			e.ErrMsg = fmt.Sprintf("duplicate key %d in vocabulary", v.KeyId)
+			return e
+		}
+		keys[v.KeyId] = true
+
+		ok, err := service.db.MetadataStore.UserHasKey(vocabulary.UserId, v.KeyId)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			e := errors.ErrInvalid
+			e.ErrMsg = fmt.Sprintf("metadata key %d not found", v.KeyId)
+			return e
+		}
+	}
+	return nil
+}
+
+// validateVocabularyMembers ensures the members are existing users other than the owner.
+func (service *MetadataService) validateVocabularyMembers(vocabulary *models.MetadataVocabulary) error {
+	members := make(map[int]bool)
+	for _, v := range vocabulary.Members {
+		if members[v.UserId] || v.UserId == vocabulary.UserId {
+			e := errors.ErrInvalid
+			e.ErrMsg = fmt.Sprintf("invalid member %d in vocabulary", v.UserId)
+			return e
+		}
+		members[v.UserId] = true
+
+		_, err := service.db.UserStore.GetUser(v.UserId)
+		if errors.Is(err, errors.ErrRecordNotFound) {
+			e := errors.ErrInvalid
+			e.ErrMsg = fmt.Sprintf("user %d not found", v.UserId)
+			return e
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package process
+
+import (
+	"fmt"
+	"time"
+
+	"tryffel.net/go/virtualpaper/models"
+)
+
+// RuleChange is a single change that a rule makes to a document.
+type RuleChange struct {
+	// Action is the document history action, e.g. 'rename' or 'add metadata'.
+	Action   string `json:"action"`
+	OldValue string `json:"old_value"`
+	NewValue string `json:"new_value"`
+}
+
+// ApplyRule runs rule for a copy of the document. If the document matches the rule, the modified copy is returned.
+// If dryRun is set, no metadata values are created and actions that change other records are skipped.
+// The original document is not modified.
+func ApplyRule(doc *models.Document, rule *models.Rule, store MetadataValueStore, actions RuleActionStore, dryRun bool) (*models.Document, bool, error) {
+	updated := *doc
+	updated.Metadata = append([]models.Metadata{}, doc.Metadata...)
+
+	runner := NewDocumentRule(&updated, rule)
+	runner.SetMetadataStore(store)
+	runner.SetActionStore(actions)
+	runner.testing = dryRun
+	match, err := runner.Match()
+	if err != nil || !match {
+		return nil, false, err
+	}
+	err = runner.RunActions()
+	if err != nil {
+		return nil, true, err
+	}
+	return &updated, true, nil
+}
+
+// RuleChanges returns the changes between the original and the updated document.
+// Metadata is described with key and value names when they are known.
+func RuleChanges(original, updated *models.Document, rule *models.Rule) ([]RuleChange, error) {
+	diff, err := original.Diff(updated, 0)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]RuleChange, 0, len(diff))
+	for _, v := range diff {
+		change := RuleChange{Action: v.Action, OldValue: v.OldValue, NewValue: v.NewValue}
+		if v.Action == models.DocumentHistoryActionDate {
+			change.OldValue = formatRuleDate(original.Date)
+			change.NewValue = formatRuleDate(updated.Date)
+		}
+		changes = append(changes, change)
+	}
+
+	names := metadataNames(original, updated, rule)
+	hasMetadata := func(metadata []models.Metadata, m models.Metadata) bool {
+		for _, v := range metadata {
+			if v.KeyId == m.KeyId && v.ValueId == m.ValueId && (m.ValueId != 0 || v.Value == m.Value) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, v := range original.Metadata {
+		if !hasMetadata(updated.Metadata, v) {
+			changes = append(changes, RuleChange{Action: models.DocumentHistoryActionMetadataRemove, OldValue: names(v)})
+		}
+	}
+	for _, v := range updated.Metadata {
+		if !hasMetadata(original.Metadata, v) {
+			changes = append(changes, RuleChange{Action: models.DocumentHistoryActionMetadataAdd, NewValue: names(v)})
+		}
+	}
+	return changes, nil
+}
+
+func formatRuleDate(date time.Time) string {
+	if date.IsZero() {
+		return ""
+	}
+	return date.Format("2006-01-02")
+}
+
+// metadataNames returns a function that formats metadata as 'key: value'.
+func metadataNames(original, updated *models.Document, rule *models.Rule) func(m models.Metadata) string {
+	keys := map[int]string{}
+	values := map[int]string{}
+	add := func(keyId int, key string, valueId int, value string) {
+		if key != "" {
+			keys[keyId] = key
+		}
+		if value != "" && valueId != 0 {
+			values[valueId] = value
+		}
+	}
+	for _, v := range append(append([]models.Metadata{}, original.Metadata...), updated.Metadata...) {
+		add(v.KeyId, v.Key, v.ValueId, v.Value)
+	}
+	for _, v := range rule.Actions {
+		add(int(v.MetadataKey), v.MetadataKeyName.String(), int(v.MetadataValue), v.MetadataValueName.String())
+	}
+
+	return func(m models.Metadata) string {
+		key := keys[m.KeyId]
+		if key == "" {
+			key = fmt.Sprintf("key %d", m.KeyId)
+		}
+		value := m.Value
+		if m.ValueId != 0 {
+			value = values[m.ValueId]
+			if value == "" {
+				value = fmt.Sprintf("value %d", m.ValueId)
+			}
+		}
+		return fmt.Sprintf("%s: %s", key, value)
+	}
+}
@@ -0,0 +1,66 @@
+package process
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"tryffel.net/go/virtualpaper/models"
+)
+
+func TestApplyRule(t *testing.T) {
+	doc := &models.Document{
+		Id:          "1234",
+		UserId:      1,
+		Name:        "scan 1",
+		Description: "",
+		Content:     "Invoice from Acme, due date 2023-05-10",
+		Date:        time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		Metadata: []models.Metadata{
+			{KeyId: 1, Key: "type", ValueId: 2, Value: "receipt"},
+		},
+	}
+	rule := &models.Rule{
+		Id:   10,
+		Mode: models.RuleMatchAll,
+		Conditions: []*models.RuleCondition{
+			{Enabled: true, ConditionType: models.RuleConditionContentContains, Value: "Invoice"},
+		},
+		Actions: []*models.RuleAction{
+			{Enabled: true, Action: models.RuleActionSetName, Value: "Acme invoice"},
+			{Enabled: true, Action: models.RuleActionRemoveMetadata, MetadataKey: 1, MetadataValue: 2},
+			{Enabled: true, Action: models.RuleActionAddMetadata, MetadataKey: 1, MetadataValue: 3,
+				MetadataKeyName: "type", MetadataValueName: "invoice"},
+		},
+	}
+
+	updated, match, err := ApplyRule(doc, rule, nil, nil, true)
+	if err != nil {
+		t.Fatalf("ApplyRule() error = %v", err)
+	}
+	if !match {
+		t.Fatalf("ApplyRule() expected match")
+	}
+	if doc.Name != "scan 1" || len(doc.Metadata) != 1 || doc.Metadata[0].ValueId != 2 {
+		t.Errorf("ApplyRule() modified original document: %+v", doc)
+	}
+
+	changes, err := RuleChanges(doc, updated, rule)
+	if err != nil {
+		t.Fatalf("RuleChanges() error = %v", err)
+	}
+	want := []RuleChange{
+		{Action: models.DocumentHistoryActionRename, OldValue: "scan 1", NewValue: "Acme invoice"},
+		{Action: models.DocumentHistoryActionMetadataRemove, OldValue: "type: receipt"},
+		{Action: models.DocumentHistoryActionMetadataAdd, NewValue: "type: invoice"},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("RuleChanges() = %v, want %v", changes, want)
+	}
+
+	doc.Content = "Receipt"
+	updated, match, err = ApplyRule(doc, rule, nil, nil, true)
+	if err != nil || match || updated != nil {
+		t.Errorf("ApplyRule() expected no match, got: %v, %v, %v", updated, match, err)
+	}
+}
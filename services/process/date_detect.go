@@ -0,0 +1,353 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package process
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+	"tryffel.net/go/virtualpaper/models"
+)
+
+// dateCandidate is a date found in text.
+type dateCandidate struct {
+	Date time.Time
+	Text string
+	// Start is the byte offset of the date in the text.
+	Start int
+	// Keywords is the text before the date that is searched for role keywords, in lower case.
+	Keywords string
+	// InName is set if the date was found in document name.
+	InName bool
+}
+
+var (
+	// 30.11.2023, 30. 11. 2023, 30.11.23
+	dateDotRe = regexp.MustCompile(`\b(\d{1,2})\.\s?(\d{1,2})\.\s?(\d{4}|\d{2})\b`)
+	// 2023-11-30
+	dateIsoRe = regexp.MustCompile(`\b(\d{4})-(\d{1,2})-(\d{1,2})\b`)
+	// 30/11/2023 or 11/30/2023
+	dateSlashRe = regexp.MustCompile(`\b(\d{1,2})/(\d{1,2})/(\d{4}|\d{2})\b`)
+	// 30 November 2023, 30th Nov 2023, 30. marraskuuta 2023, 30. Nov. 2023
+	dateDayMonthRe = regexp.MustCompile(`(?i)\b(\d{1,2})(?:st|nd|rd|th)?\.?\s+(\p{L}+)\.?,?\s+(\d{4})\b`)
+	// November 30, 2023, Nov 30th 2023
+	dateMonthDayRe = regexp.MustCompile(`(?i)\b(\p{L}+)\.?\s+(\d{1,2})(?:st|nd|rd|th)?,?\s+(\d{4})\b`)
+)
+
+// dateMonthNames are English and German month names and abbreviations.
+var dateMonthNames = map[string]time.Month{
+	"january": time.January, "jan": time.January, "januar": time.January, "jänner": time.January,
+	"february": time.February, "feb": time.February, "februar": time.February,
+	"march": time.March, "mar": time.March, "märz": time.March, "maerz": time.March, "mär": time.March,
+	"april": time.April, "apr": time.April,
+	"may": time.May, "mai": time.May,
+	"june": time.June, "jun": time.June, "juni": time.June,
+	"july": time.July, "jul": time.July, "juli": time.July,
+	"august": time.August, "aug": time.August,
+	"september": time.September, "sep": time.September, "sept": time.September,
+	"october": time.October, "oct": time.October, "oktober": time.October, "okt": time.October,
+	"november": time.November, "nov": time.November,
+	"december": time.December, "dec": time.December, "dezember": time.December, "dez": time.December,
+}
+
+// dateFinnishMonths are the stems of Finnish month names, which are inflected, e.g. 'marraskuuta'.
+var dateFinnishMonths = []string{
+	"tammik", "helmik", "maalisk", "huhtik", "toukok", "kesäk",
+	"heinäk", "elok", "syysk", "lokak", "marrask", "jouluk",
+}
+
+// dateRoleKeywords are the keywords that precede a date with the role.
+var dateRoleKeywords = map[models.RuleDateRole][]string{
+	models.RuleDateRoleDocument: {
+		"date", "dated", "invoice date", "issue date", "date of issue",
+		"päiväys", "päivämäärä", "pvm", "laskun päivämäärä", "laskutuspäivä",
+		"datum", "rechnungsdatum", "ausstellungsdatum", "belegdatum",
+	},
+	models.RuleDateRoleDue: {
+		"due", "due date", "payment due", "pay by", "payable by",
+		"eräpäivä", "erääntyy", "maksettava viimeistään",
+		"fällig", "fälligkeit", "fälligkeitsdatum", "zahlbar bis", "zahlungsziel",
+	},
+}
+
+const (
+	// dateKeywordWindow is the number of bytes before the date that are searched for keywords.
+	dateKeywordWindow = 60
+	// dateKeywordScore is the maximum score of a date that has a keyword of the role before it.
+	dateKeywordScore = 10
+	// dateOtherRoleScore is the score of a date that has a keyword of another role before it.
+	dateOtherRoleScore = -3
+	// dateInNameScore is the score of a date in document name, which is likely the document date.
+	dateInNameScore = 3
+)
+
+// findDateCandidates finds dates in numeric and written formats in English, Finnish and German.
+// Ambiguous dates with slashes are read month first if lang is English, else day first.
+func findDateCandidates(text string, lang string) []dateCandidate {
+	candidates := make([]dateCandidate, 0)
+	found := map[int]bool{}
+	add := func(match []int, year, month, day int) {
+		start, end := match[0], match[1]
+		date, ok := newDetectedDate(year, month, day)
+		if !ok || found[start] {
+			return
+		}
+		found[start] = true
+		candidates = append(candidates, dateCandidate{
+			Date:  date,
+			Text:  text[start:end],
+			Start: start,
+		})
+	}
+
+	for _, m := range dateIsoRe.FindAllStringSubmatchIndex(text, -1) {
+		add(m, submatchInt(text, m, 1), submatchInt(text, m, 2), submatchInt(text, m, 3))
+	}
+	for _, m := range dateDotRe.FindAllStringSubmatchIndex(text, -1) {
+		add(m, detectedYear(submatchInt(text, m, 3)), submatchInt(text, m, 2), submatchInt(text, m, 1))
+	}
+	for _, m := range dateSlashRe.FindAllStringSubmatchIndex(text, -1) {
+		first, second := submatchInt(text, m, 1), submatchInt(text, m, 2)
+		year := detectedYear(submatchInt(text, m, 3))
+		monthFirst := lang == "en"
+		if first > 12 {
+			monthFirst = false
+		} else if second > 12 {
+			monthFirst = true
+		}
+		if monthFirst {
+			add(m, year, first, second)
+		} else {
+			add(m, year, second, first)
+		}
+	}
+	for _, m := range dateDayMonthRe.FindAllStringSubmatchIndex(text, -1) {
+		month := detectedMonth(text[m[4]:m[5]])
+		add(m, submatchInt(text, m, 3), int(month), submatchInt(text, m, 1))
+	}
+	for _, m := range dateMonthDayRe.FindAllStringSubmatchIndex(text, -1) {
+		month := detectedMonth(text[m[2]:m[3]])
+		add(m, submatchInt(text, m, 3), int(month), submatchInt(text, m, 2))
+	}
+
+	// keywords before the previous date belong to that date
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Start < candidates[j].Start
+	})
+	previousEnd := 0
+	for i, v := range candidates {
+		candidates[i].Keywords = dateKeywordText(text, previousEnd, v.Start)
+		previousEnd = v.Start + len(v.Text)
+	}
+	return candidates
+}
+
+func submatchInt(text string, match []int, group int) int {
+	value, err := strconv.Atoi(text[match[group*2]:match[group*2+1]])
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+// detectedYear converts two-digit year to this century.
+func detectedYear(year int) int {
+	if year < 100 {
+		return 2000 + year
+	}
+	return year
+}
+
+// detectedMonth returns the month by its name, or 0 if name is not a month.
+func detectedMonth(name string) time.Month {
+	name = strings.ToLower(name)
+	if month, ok := dateMonthNames[name]; ok {
+		return month
+	}
+	for i, stem := range dateFinnishMonths {
+		if strings.HasPrefix(name, stem) {
+			return time.Month(i + 1)
+		}
+	}
+	return 0
+}
+
+// newDetectedDate returns the date if it is valid, e.g. not 31.2.
+func newDetectedDate(year, month, day int) (time.Time, bool) {
+	if year < 1900 || year > 2100 || month < 1 || month > 12 || day < 1 || day > 31 {
+		return time.Time{}, false
+	}
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if date.Day() != day {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// dateKeywordText returns the text before start that is searched for keywords. The text begins at min at the earliest.
+func dateKeywordText(text string, min, start int) string {
+	from := start - dateKeywordWindow
+	if from < min {
+		from = min
+	}
+	if from > start {
+		return ""
+	}
+	for from < start && !utf8.RuneStart(text[from]) {
+		from++
+	}
+	return strings.ToLower(text[from:start])
+}
+
+// dateKeywordRole returns the role whose keyword is closest before the date, and the distance to the keyword.
+// If keywords of different roles end at the same position, e.g. 'date' and 'due date', the longer keyword wins.
+func dateKeywordRole(keywords string) (models.RuleDateRole, int) {
+	var role models.RuleDateRole
+	distance := -1
+	length := 0
+	for _, r := range models.AllRuleDateRoles {
+		for _, keyword := range dateRoleKeywords[r] {
+			index := lastKeywordIndex(keywords, keyword)
+			if index < 0 {
+				continue
+			}
+			d := len(keywords) - index - len(keyword)
+			if distance < 0 || d < distance || (d == distance && len(keyword) > length) {
+				role = r
+				distance = d
+				length = len(keyword)
+			}
+		}
+	}
+	return role, distance
+}
+
+// lastKeywordIndex returns the last index of keyword in text that does not start in the middle of a word.
+func lastKeywordIndex(text, keyword string) int {
+	end := len(text)
+	for {
+		index := strings.LastIndex(text[:end], keyword)
+		if index <= 0 {
+			return index
+		}
+		previous, _ := utf8.DecodeLastRuneInString(text[:index])
+		if !unicode.IsLetter(previous) {
+			return index
+		}
+		end = index
+	}
+}
+
+// pickDetectedDate scores the dates for the role and returns the date with the highest score.
+// Each occurrence of a date scores by the keywords before it. Dates in document name are preferred as document date.
+// Due date must have a keyword before it.
+func pickDetectedDate(candidates []dateCandidate, role models.RuleDateRole) (time.Time, bool) {
+	scores := map[time.Time]int{}
+	hasKeyword := map[time.Time]bool{}
+	order := make([]time.Time, 0, len(candidates))
+
+	for _, v := range candidates {
+		if _, ok := scores[v.Date]; !ok {
+			order = append(order, v.Date)
+		}
+		score := 1
+		keywordRole, distance := dateKeywordRole(v.Keywords)
+		if keywordRole == role {
+			score += dateKeywordScore - distance/(dateKeywordWindow/dateKeywordScore)
+			hasKeyword[v.Date] = true
+		} else if keywordRole != "" {
+			score += dateOtherRoleScore
+		}
+		if v.InName && role == models.RuleDateRoleDocument {
+			score += dateInNameScore
+		}
+		scores[v.Date] += score
+	}
+
+	var picked time.Time
+	pickedScore := 0
+	for _, date := range order {
+		if role != models.RuleDateRoleDocument && !hasKeyword[date] {
+			continue
+		}
+		if scores[date] > pickedScore {
+			picked = date
+			pickedScore = scores[date]
+		}
+	}
+	return picked, pickedScore > 0
+}
+
+// detectDate finds the date with the role in value from document name and content.
+func (d *DocumentRule) detectDate(condition *models.RuleCondition, logger *logrus.Logger) (bool, error) {
+	role, err := models.ParseRuleDateRole(condition.Value)
+	if err != nil {
+		return false, err
+	}
+	lang := d.Document.Lang.String()
+	candidates := findDateCandidates(d.Document.Name, lang)
+	for i := range candidates {
+		candidates[i].InName = true
+	}
+	candidates = append(candidates, findDateCandidates(d.Document.Content, lang)...)
+	if logger != nil {
+		logger.Infof("found %d dates", len(candidates))
+	}
+
+	date, ok := pickDetectedDate(candidates, role)
+	if !ok {
+		return false, nil
+	}
+	if logger != nil {
+		logger.Infof("selected %s date %s", role, date.Format("2006-01-02"))
+	}
+	if d.dates == nil {
+		d.dates = map[models.RuleDateRole]time.Time{}
+	}
+	d.dates[role] = date
+	if role == models.RuleDateRoleDocument {
+		d.date = date
+	}
+	return true, nil
+}
+
+// setDateMetadata adds the detected date with the role in action value as metadata value.
+func (d *DocumentRule) setDateMetadata(action *models.RuleAction, log logFunc) error {
+	role, err := models.ParseRuleDateRole(action.Value)
+	if err != nil {
+		return err
+	}
+	date, ok := d.dates[role]
+	if !ok && role == models.RuleDateRoleDocument && !d.date.IsZero() {
+		date, ok = d.date, true
+	}
+	if !ok {
+		if log != nil {
+			log(`no %s date found (skipping)`, role)
+		}
+		return nil
+	}
+	return d.addMetadataByName(int(action.MetadataKey), action.MetadataKeyName.String(), date.Format("2006-01-02"), log)
+}
@@ -0,0 +1,161 @@
+package process
+
+import (
+	"testing"
+	"time"
+
+	"tryffel.net/go/virtualpaper/models"
+)
+
+func TestFindDateCandidates(t *testing.T) {
+	date := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name string
+		text string
+		lang string
+		want []time.Time
+	}{
+		{"iso", "created 2023-11-30", "en", []time.Time{date(2023, 11, 30)}},
+		{"dots", "30.11.2023 and 1. 2. 24", "fi", []time.Time{date(2023, 11, 30), date(2024, 2, 1)}},
+		{"invalid date", "31.2.2023 and 2023-13-01", "fi", []time.Time{}},
+		{"slash day first", "01/02/2023", "de", []time.Time{date(2023, 2, 1)}},
+		{"slash month first", "01/02/2023", "en", []time.Time{date(2023, 1, 2)}},
+		{"slash unambiguous", "11/30/2023", "fi", []time.Time{date(2023, 11, 30)}},
+		{"english", "on 30th November 2023", "en", []time.Time{date(2023, 11, 30)}},
+		{"english month first", "Due Nov 30, 2023", "en", []time.Time{date(2023, 11, 30)}},
+		{"finnish", "eräpäivä 30. marraskuuta 2023", "fi", []time.Time{date(2023, 11, 30)}},
+		{"german", "Datum: 3. März 2023", "de", []time.Time{date(2023, 3, 3)}},
+		{"not month", "Total 12 EUR 2023", "en", []time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findDateCandidates(tt.text, tt.lang)
+			if len(got) != len(tt.want) {
+				t.Fatalf("findDateCandidates() = %v, want %v", got, tt.want)
+			}
+			for i, v := range got {
+				if !v.Date.Equal(tt.want[i]) {
+					t.Errorf("findDateCandidates() %d = %s, want %s", i, v.Date, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestPickDetectedDate(t *testing.T) {
+	date := func(y int, m time.Month, d int) time.Time {
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name     string
+		text     string
+		lang     string
+		role     models.RuleDateRole
+		want     time.Time
+		wantFind bool
+	}{
+		{
+			name:     "english invoice date",
+			text:     "Invoice date: 01.11.2023\nDue date: 30.11.2023\nDelivered 15.10.2023",
+			role:     models.RuleDateRoleDocument,
+			want:     date(2023, 11, 1),
+			wantFind: true,
+		},
+		{
+			name:     "english due date",
+			text:     "Invoice date: 01.11.2023\nDue date: 30.11.2023\nDelivered 15.10.2023",
+			role:     models.RuleDateRoleDue,
+			want:     date(2023, 11, 30),
+			wantFind: true,
+		},
+		{
+			name:     "finnish due date",
+			text:     "Päiväys 1.11.2023\nEräpäivä 30. marraskuuta 2023\nViitenumero 1234",
+			role:     models.RuleDateRoleDue,
+			want:     date(2023, 11, 30),
+			wantFind: true,
+		},
+		{
+			name:     "german due date",
+			text:     "Rechnungsdatum: 01.11.2023\nZahlbar bis 30.11.2023",
+			role:     models.RuleDateRoleDue,
+			want:     date(2023, 11, 30),
+			wantFind: true,
+		},
+		{
+			name:     "due date without keyword",
+			text:     "Letter 1.11.2023",
+			role:     models.RuleDateRoleDue,
+			wantFind: false,
+		},
+		{
+			name:     "most frequent document date",
+			text:     "1.11.2023 page 1\n5.11.2023\n1.11.2023 page 2",
+			role:     models.RuleDateRoleDocument,
+			want:     date(2023, 11, 1),
+			wantFind: true,
+		},
+		{
+			name:     "document date without due date",
+			text:     "Due date 30.11.2023, sent 10.11.2023",
+			role:     models.RuleDateRoleDocument,
+			want:     date(2023, 11, 10),
+			wantFind: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := pickDetectedDate(findDateCandidates(tt.text, tt.lang), tt.role)
+			if ok != tt.wantFind {
+				t.Fatalf("pickDetectedDate() found = %v, want %v", ok, tt.wantFind)
+			}
+			if ok && !got.Equal(tt.want) {
+				t.Errorf("pickDetectedDate() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocumentRule_detectDate(t *testing.T) {
+	doc := &models.Document{
+		Id:      "1234",
+		UserId:  1,
+		Name:    "Invoice 2023-11-01",
+		Content: "Acme Corporation\nDue date: November 30, 2023",
+		Lang:    "en",
+	}
+	rule := &models.Rule{
+		Id:   1,
+		Mode: models.RuleMatchAll,
+		Conditions: []*models.RuleCondition{
+			{Enabled: true, ConditionType: models.RuleConditionDateDetect},
+			{Enabled: true, ConditionType: models.RuleConditionDateDetect, Value: "due"},
+		},
+		Actions: []*models.RuleAction{
+			{Enabled: true, OnCondition: true, Action: models.RuleActionSetDate},
+			{Enabled: true, OnCondition: true, Action: models.RuleActionSetDateMetadata, Value: "due", MetadataKey: 5},
+		},
+	}
+	store := &testMetadataStore{}
+
+	dr := NewDocumentRule(doc, rule)
+	dr.SetMetadataStore(store)
+	match, err := dr.Match()
+	if err != nil || !match {
+		t.Fatalf("Match() = %v, %v", match, err)
+	}
+	if err := dr.RunActions(); err != nil {
+		t.Fatalf("RunActions() error = %v", err)
+	}
+	if !doc.Date.Equal(time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("document date = %s", doc.Date)
+	}
+	if len(store.values) != 1 || store.values[0].Value != "2023-11-30" || store.values[0].KeyId != 5 {
+		t.Fatalf("due date metadata value = %v", store.values)
+	}
+	if !doc.HasMetadataKeyValue(5, store.values[0].Id) {
+		t.Errorf("due date metadata not added to document: %v", doc.Metadata)
+	}
+}
@@ -0,0 +1,305 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package process
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"hash/fnv"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"math/bits"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"tryffel.net/go/virtualpaper/models"
+	"tryffel.net/go/virtualpaper/storage"
+	log "tryffel.net/go/virtualpaper/util/logger"
+)
+
+// minimum number of terms in content to compute content fingerprint.
+// Shorter texts produce too unstable fingerprints.
+const minSimHashTerms = 20
+
+// maximum hamming distances for fingerprints to be considered duplicates.
+const (
+	// content is nearly identical, e.g. same document with minor ocr differences.
+	duplicateContentDistance = 6
+	// content is similar and the pages look alike.
+	duplicateContentImageDistance = 12
+	duplicateImageContentDistance = 10
+	// documents without content, e.g. photos, that look alike.
+	duplicateImageDistance = 5
+)
+
+// dHash image size. Image is scaled to (dHashWidth+1) x dHashHeight to get 64 bits.
+const (
+	dHashWidth  = 8
+	dHashHeight = 8
+)
+
+// SimHash computes a 64-bit simhash fingerprint of the terms in text.
+// Returns false if text does not contain enough terms for a meaningful fingerprint.
+func SimHash(text string) (uint64, bool) {
+	terms := contentTermFrequencies(text)
+	total := 0
+	for _, count := range terms {
+		total += count
+	}
+	if total < minSimHashTerms {
+		return 0, false
+	}
+
+	weights := [64]int{}
+	hasher := fnv.New64a()
+	for term, count := range terms {
+		hasher.Reset()
+		hasher.Write([]byte(term))
+		termHash := hasher.Sum64()
+		for i := 0; i < 64; i++ {
+			if termHash&(1<<i) != 0 {
+				weights[i] += count
+			} else {
+				weights[i] -= count
+			}
+		}
+	}
+
+	var hash uint64
+	for i, v := range weights {
+		if v > 0 {
+			hash |= 1 << i
+		}
+	}
+	return hash, true
+}
+
+// DHash computes a 64-bit difference hash of the image. Image is scaled down to a 9x8 grayscale image
+// and each bit tells whether the pixel is brighter than its right neighbour.
+func DHash(img image.Image) uint64 {
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+	if width == 0 || height == 0 {
+		return 0
+	}
+
+	// scale image by averaging the pixels in each cell.
+	cols := dHashWidth + 1
+	pixels := make([]float64, cols*dHashHeight)
+	for y := 0; y < dHashHeight; y++ {
+		y0 := bounds.Min.Y + y*height/dHashHeight
+		y1 := bounds.Min.Y + (y+1)*height/dHashHeight
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < cols; x++ {
+			x0 := bounds.Min.X + x*width/cols
+			x1 := bounds.Min.X + (x+1)*width/cols
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			sum := 0.0
+			count := 0
+			for py := y0; py < y1 && py < bounds.Max.Y; py++ {
+				for px := x0; px < x1 && px < bounds.Max.X; px++ {
+					r, g, b, _ := img.At(px, py).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+					count += 1
+				}
+			}
+			if count > 0 {
+				pixels[y*cols+x] = sum / float64(count)
+			}
+		}
+	}
+
+	var hash uint64
+	bit := 0
+	for y := 0; y < dHashHeight; y++ {
+		for x := 0; x < dHashWidth; x++ {
+			if pixels[y*cols+x] > pixels[y*cols+x+1] {
+				hash |= 1 << bit
+			}
+			bit += 1
+		}
+	}
+	return hash
+}
+
+// HammingDistance returns the number of differing bits in a and b.
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// CompareFingerprints compares two document fingerprints and returns the pair with distances
+// and whether the documents are likely duplicates.
+func CompareFingerprints(a, b models.DocumentFingerprint) (models.DocumentDuplicate, bool) {
+	pair := models.DocumentDuplicate{DocA: a.DocumentId, DocB: b.DocumentId}
+	if pair.DocA > pair.DocB {
+		pair.DocA, pair.DocB = pair.DocB, pair.DocA
+	}
+	if a.ContentHash.Valid && b.ContentHash.Valid {
+		pair.ContentDistance = sql.NullInt32{
+			Int32: int32(HammingDistance(uint64(a.ContentHash.Int64), uint64(b.ContentHash.Int64))),
+			Valid: true,
+		}
+	}
+	if a.ImageHash.Valid && b.ImageHash.Valid {
+		pair.ImageDistance = sql.NullInt32{
+			Int32: int32(HammingDistance(uint64(a.ImageHash.Int64), uint64(b.ImageHash.Int64))),
+			Valid: true,
+		}
+	}
+
+	content := pair.ContentDistance
+	img := pair.ImageDistance
+	switch {
+	case content.Valid && content.Int32 <= duplicateContentDistance:
+		return pair, true
+	case content.Valid && img.Valid && content.Int32 <= duplicateContentImageDistance &&
+		img.Int32 <= duplicateImageContentDistance:
+		return pair, true
+	case !a.ContentHash.Valid && !b.ContentHash.Valid && img.Valid && img.Int32 <= duplicateImageDistance:
+		return pair, true
+	}
+	return pair, false
+}
+
+// ClusterDuplicates groups documents that are connected by duplicate pairs.
+// Clusters and the documents inside them are sorted to keep the output stable.
+func ClusterDuplicates(pairs []models.DocumentDuplicate) [][]string {
+	parent := make(map[string]string)
+	var find func(id string) string
+	find = func(id string) string {
+		if parent[id] != id {
+			parent[id] = find(parent[id])
+		}
+		return parent[id]
+	}
+	for _, v := range pairs {
+		for _, id := range []string{v.DocA, v.DocB} {
+			if _, ok := parent[id]; !ok {
+				parent[id] = id
+			}
+		}
+		rootA := find(v.DocA)
+		rootB := find(v.DocB)
+		if rootA != rootB {
+			parent[rootB] = rootA
+		}
+	}
+
+	groups := make(map[string][]string)
+	for id := range parent {
+		root := find(id)
+		groups[root] = append(groups[root], id)
+	}
+	clusters := make([][]string, 0, len(groups))
+	for _, v := range groups {
+		sort.Strings(v)
+		clusters = append(clusters, v)
+	}
+	sort.Slice(clusters, func(i, j int) bool {
+		return clusters[i][0] < clusters[j][0]
+	})
+	return clusters
+}
+
+// imageFingerprint computes dHash of the document thumbnail.
+// Returns false if document does not have thumbnail.
+func imageFingerprint(docId string) (uint64, bool, error) {
+	file, err := os.Open(storage.PreviewPath(docId))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("open thumbnail: %v", err)
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return 0, false, fmt.Errorf("decode thumbnail: %v", err)
+	}
+	return DHash(img), true, nil
+}
+
+func (fp *fileProcessor) detectDuplicates(ctx context.Context) error {
+	process := &models.ProcessItem{
+		DocumentId: fp.document.Id,
+		Action:     models.ProcessDuplicates,
+		CreatedAt:  time.Now(),
+	}
+	job, err := fp.db.JobStore.StartProcessItem(process, "detect duplicates")
+	// hotfix for failure when job item does not exist anymore.
+	if err != nil {
+		logrus.Warningf("persist job record: %v", err)
+		// use empty job to not panic the rest of the function
+		job = &models.Job{}
+	} else {
+		defer fp.completeProcessingStep(process, job)
+	}
+
+	fingerprint := models.DocumentFingerprint{DocumentId: fp.document.Id}
+	if hash, ok := SimHash(fp.document.Content); ok {
+		fingerprint.ContentHash = sql.NullInt64{Int64: int64(hash), Valid: true}
+	}
+	hash, ok, err := imageFingerprint(fp.document.Id)
+	if err != nil {
+		log.Context(ctx).WithField("documentId", fp.document.Id).Warnf("compute image fingerprint: %v", err)
+	} else if ok {
+		fingerprint.ImageHash = sql.NullInt64{Int64: int64(hash), Valid: true}
+	}
+
+	err = fp.db.DocumentStore.SetFingerprint(fp.document.UserId, fingerprint)
+	if err != nil {
+		job.Status = models.JobFailure
+		return err
+	}
+
+	fingerprints, err := fp.db.DocumentStore.GetFingerprints(fp.document.UserId)
+	if err != nil {
+		job.Status = models.JobFailure
+		return err
+	}
+
+	duplicates := make([]models.DocumentDuplicate, 0)
+	for _, v := range fingerprints {
+		if v.DocumentId == fp.document.Id {
+			continue
+		}
+		if pair, ok := CompareFingerprints(fingerprint, v); ok {
+			duplicates = append(duplicates, pair)
+		}
+	}
+	log.Context(ctx).WithField("documentId", fp.document.Id).Debugf("found %d possible duplicates", len(duplicates))
+
+	err = fp.db.DocumentStore.UpdateDuplicates(fp.document.UserId, fp.document.Id, duplicates)
+	if err != nil {
+		job.Status = models.JobFailure
+		return err
+	}
+	job.Status = models.JobFinished
+	return nil
+}
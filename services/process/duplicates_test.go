@@ -0,0 +1,151 @@
+package process
+
+import (
+	"database/sql"
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+
+	"tryffel.net/go/virtualpaper/models"
+)
+
+const duplicateTestLetter = `Dear customer, we would like to inform you that the annual maintenance of the heating system
+in your apartment building will take place next week. The technician will visit every apartment between
+eight and sixteen o'clock. Please make sure that the radiators are accessible and that somebody is at home.
+If the schedule does not suit you, please contact the property manager by phone or email before Friday.
+Best regards, property management company`
+
+func TestSimHash(t *testing.T) {
+	if _, ok := SimHash("too short text"); ok {
+		t.Errorf("expected no fingerprint for short text")
+	}
+
+	letter, ok := SimHash(duplicateTestLetter)
+	if !ok {
+		t.Fatalf("expected fingerprint for letter")
+	}
+	again, _ := SimHash(duplicateTestLetter)
+	if letter != again {
+		t.Errorf("simhash is not deterministic")
+	}
+
+	// same letter scanned again with a few ocr errors.
+	scanned := `Dear customer, we would 1ike to inform you that the annual maintenance of the heatinq system
+in your apartment building will take place next week. The technician will visit every apartment between
+eight and sixteen o'clock. Please make sure that the radiators are accessible and that somebody is at home.
+If the schedule does not suit you, please contact the property manager by phone or email before Friday.
+Best regards, property management company`
+	scannedHash, _ := SimHash(scanned)
+
+	recipe := `Mix flour, sugar and butter in a large bowl until the mixture resembles breadcrumbs. Add eggs
+and milk and stir until smooth. Pour the batter into a greased baking tin and bake in the preheated oven
+for forty minutes until golden brown. Let the cake cool down before serving it with whipped cream and berries.`
+	recipeHash, _ := SimHash(recipe)
+
+	scannedDistance := HammingDistance(letter, scannedHash)
+	recipeDistance := HammingDistance(letter, recipeHash)
+	if scannedDistance > duplicateContentDistance {
+		t.Errorf("expected scanned copy to be duplicate, distance %d", scannedDistance)
+	}
+	if recipeDistance <= duplicateContentImageDistance {
+		t.Errorf("expected unrelated document to have large distance, got %d", recipeDistance)
+	}
+}
+
+func gradientImage(width, height int, invert bool) image.Image {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			value := uint8(x * 255 / width)
+			if invert {
+				value = 255 - value
+			}
+			img.SetGray(x, y, color.Gray{Y: value})
+		}
+	}
+	return img
+}
+
+func TestDHash(t *testing.T) {
+	small := DHash(gradientImage(90, 80, false))
+	large := DHash(gradientImage(900, 800, false))
+	inverted := DHash(gradientImage(900, 800, true))
+
+	if d := HammingDistance(small, large); d != 0 {
+		t.Errorf("expected scaled images to have equal hash, distance %d", d)
+	}
+	if d := HammingDistance(large, inverted); d != 64 {
+		t.Errorf("expected inverted image to have opposite hash, distance %d", d)
+	}
+	if got := DHash(image.NewGray(image.Rect(0, 0, 0, 0))); got != 0 {
+		t.Errorf("expected zero hash for empty image, got %d", got)
+	}
+}
+
+func TestCompareFingerprints(t *testing.T) {
+	hash := func(v uint64) sql.NullInt64 {
+		return sql.NullInt64{Int64: int64(v), Valid: true}
+	}
+	tests := []struct {
+		name string
+		a    models.DocumentFingerprint
+		b    models.DocumentFingerprint
+		want bool
+	}{
+		{"same content",
+			models.DocumentFingerprint{DocumentId: "b", ContentHash: hash(0b1111)},
+			models.DocumentFingerprint{DocumentId: "a", ContentHash: hash(0b0011)},
+			true},
+		{"different content",
+			models.DocumentFingerprint{DocumentId: "a", ContentHash: hash(0)},
+			models.DocumentFingerprint{DocumentId: "b", ContentHash: hash(0xffff)},
+			false},
+		{"similar content and image",
+			models.DocumentFingerprint{DocumentId: "a", ContentHash: hash(0), ImageHash: hash(0)},
+			models.DocumentFingerprint{DocumentId: "b", ContentHash: hash(0x3ff), ImageHash: hash(0xff)},
+			true},
+		{"similar content, different image",
+			models.DocumentFingerprint{DocumentId: "a", ContentHash: hash(0), ImageHash: hash(0)},
+			models.DocumentFingerprint{DocumentId: "b", ContentHash: hash(0x3ff), ImageHash: hash(0xffff)},
+			false},
+		{"images without content",
+			models.DocumentFingerprint{DocumentId: "a", ImageHash: hash(0)},
+			models.DocumentFingerprint{DocumentId: "b", ImageHash: hash(0b111)},
+			true},
+		{"image matches but only one has content",
+			models.DocumentFingerprint{DocumentId: "a", ContentHash: hash(0), ImageHash: hash(0)},
+			models.DocumentFingerprint{DocumentId: "b", ImageHash: hash(0)},
+			false},
+		{"no fingerprints",
+			models.DocumentFingerprint{DocumentId: "a"},
+			models.DocumentFingerprint{DocumentId: "b"},
+			false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pair, got := CompareFingerprints(tt.a, tt.b)
+			if got != tt.want {
+				t.Errorf("CompareFingerprints() = %v, want %v", got, tt.want)
+			}
+			if pair.DocA != "a" || pair.DocB != "b" {
+				t.Errorf("expected ordered pair, got %s, %s", pair.DocA, pair.DocB)
+			}
+		})
+	}
+}
+
+func TestClusterDuplicates(t *testing.T) {
+	pairs := []models.DocumentDuplicate{
+		{DocA: "d", DocB: "e"},
+		{DocA: "a", DocB: "c"},
+		{DocA: "b", DocB: "c"},
+	}
+	want := [][]string{{"a", "b", "c"}, {"d", "e"}}
+	if got := ClusterDuplicates(pairs); !reflect.DeepEqual(got, want) {
+		t.Errorf("ClusterDuplicates() = %v, want %v", got, want)
+	}
+	if got := ClusterDuplicates(nil); len(got) != 0 {
+		t.Errorf("expected no clusters, got %v", got)
+	}
+}
@@ -68,14 +68,19 @@ func (fp *fileProcessor) extractPdf(ctx context.Context, file *os.File) error {
 		useOcr = true
 	}
 
+	pages := 0
 	if useOcr {
-		text, err = runOcr(ctx, file.Name(), fp.document.Id)
+		text, pages, err = runOcr(ctx, file.Name(), fp.document.Id)
 		if err != nil {
 			job.Message += "; " + err.Error()
 			job.Status = models.JobFailure
 			return fmt.Errorf("parse document content: %v", err)
 		}
+	} else {
+		// pdftotext ends each page with form feed
+		pages = strings.Count(text, "\f")
 	}
+	fp.setPageCount(pages)
 
 	if text == "" {
 		fp.Warn(" content seems to be empty")
@@ -110,12 +115,13 @@ func (fp *fileProcessor) extractImage(ctx context.Context, file *os.File) error
 
 	defer fp.completeProcessingStep(process, job)
 
-	text, err := runOcr(ctx, file.Name(), fp.document.Id)
+	text, _, err := runOcr(ctx, file.Name(), fp.document.Id)
 	if err != nil {
 		job.Message += "; " + err.Error()
 		job.Status = models.JobFailure
 		return fmt.Errorf("parse document text: %v", err)
 	} else {
+		fp.setPageCount(1)
 		text = strings.ToValidUTF8(text, "")
 		fp.document.Content = text
 		err = fp.db.DocumentStore.SetDocumentContent(fp.document.Id, fp.document.Content)
@@ -164,3 +170,13 @@ func (fp *fileProcessor) extractPandoc(ctx context.Context, file *os.File) error
 	}
 	return nil
 }
+
+// setPageCount saves the number of pages in document. Failure is only logged, since page count is not
+// required for processing.
+func (fp *fileProcessor) setPageCount(pages int) {
+	fp.document.PageCount = pages
+	err := fp.db.DocumentStore.SetDocumentPageCount(fp.document.Id, pages)
+	if err != nil {
+		logrus.Errorf("save document %s page count: %v", fp.document.Id, err)
+	}
+}
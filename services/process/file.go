@@ -338,8 +338,13 @@ func (fp *fileProcessor) indexSearchContent(ctx context.Context) error {
 		return errors.New("no search engine available")
 	}
 
-	log.Context(ctx).Info("Send document to search index")
-	err = fp.search.IndexDocuments(&[]models.Document{*fp.document}, fp.document.UserId)
+	if fp.document.DeletedAt.Valid {
+		log.Context(ctx).Info("Remove deleted document from search index")
+		err = fp.search.DeleteDocument(fp.document.Id, fp.document.UserId)
+	} else {
+		log.Context(ctx).Info("Send document to search index")
+		err = fp.search.IndexDocuments(&[]models.Document{*fp.document}, fp.document.UserId)
+	}
 	if err != nil {
 		job.Message += "; " + err.Error()
 		job.Status = models.JobFailure
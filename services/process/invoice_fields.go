@@ -0,0 +1,299 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package process
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+	"tryffel.net/go/virtualpaper/models"
+	log "tryffel.net/go/virtualpaper/util/logger"
+)
+
+var (
+	// FI21 1234 5600 0007 85, followed by any text that is cut off when validating
+	invoiceIbanRe = regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]){11,30}`)
+	// RF18 5390 0754 7034
+	invoiceCreditorReferenceRe = regexp.MustCompile(`\bRF\d{2}(?: ?[A-Z0-9]){1,21}`)
+	// groups of digits separated by single spaces
+	invoiceDigitGroupsRe = regexp.MustCompile(`\d+(?: \d+)*`)
+	// 1 234,50 €, EUR 1,234.50, 124.00
+	invoiceAmountRe   = regexp.MustCompile(`(?i)(?:(€|\$|£|\b(?:eur|usd|gbp|sek|nok|dkk|chf)\b)\s?)?(\d{1,3}(?:[ .\x{00a0}]\d{3})+,\d{2}|\d{1,3}(?:[ ,\x{00a0}]\d{3})+\.\d{2}|\d+[.,]\d{2})(?:\s?(€|\$|£|\b(?:eur|usd|gbp|sek|nok|dkk|chf)\b))?`)
+	invoiceCurrencyRe = regexp.MustCompile(`(?i)€|\beur\b`)
+	// Finnish business id, 1234567-8
+	invoiceBusinessIdRe = regexp.MustCompile(`\b\d{7}-\d\b`)
+	// Finnish VAT number has the business id as its number, FI12345678
+	invoiceFinnishVatRe = regexp.MustCompile(`\bFI ?(\d{7})(\d)\b`)
+	// VAT numbers of European countries
+	invoiceVatRe = regexp.MustCompile(`\b(?:ATU\d{8}|BE[01]\d{9}|CHE\d{9}(?:MWST|TVA|IVA)?|CZ\d{8,10}|DE\d{9}|DK\d{8}|EE\d{9}|EL\d{9}|ES[A-Z0-9]\d{7}[A-Z0-9]|FR[A-Z0-9]{2}\d{9}|GB\d{9}|IE\d{7}[A-Z]{1,2}|IT\d{11}|LT\d{9,12}|LU\d{8}|LV\d{11}|NL\d{9}B\d{2}|NO\d{9}MVA|PL\d{10}|PT\d{9}|SE\d{12}|SI\d{8}|SK\d{10})\b`)
+)
+
+// invoiceKeywords are the lower case keywords that precede the invoice fields.
+var (
+	invoiceReferenceKeywords = []string{
+		"viitenumero", "viitenro", "viite", "reference", "ref", "referens", "referensnummer", "referenz",
+	}
+	invoiceTotalKeywords = []string{
+		"maksettava", "yhteensä", "loppusumma", "summa", "total", "amount due", "balance due", "to pay",
+		"att betala", "totalt", "gesamtbetrag", "gesamtsumme", "rechnungsbetrag", "endbetrag", "zu zahlen",
+	}
+	invoiceVatKeywords = []string{
+		"vat", "alv", "y-tunnus", "business id", "moms", "ust-idnr", "ust-id", "ust.-id", "umsatzsteuer",
+		"tva", "iva", "btw", "mwst",
+	}
+)
+
+const (
+	// invoiceKeywordWindow is the number of bytes after the keyword that are searched for the value.
+	invoiceKeywordWindow = 50
+	// invoiceVatKeywordWindow is larger, since there may be e.g. 'registration number' between.
+	invoiceVatKeywordWindow = 80
+)
+
+func (fp *fileProcessor) extractInvoiceFields(ctx context.Context) error {
+	process := &models.ProcessItem{
+		DocumentId: fp.document.Id,
+		Action:     models.ProcessExtractFields,
+		CreatedAt:  time.Now(),
+	}
+	job, err := fp.db.JobStore.StartProcessItem(process, "extract invoice fields")
+	// hotfix for failure when job item does not exist anymore.
+	if err != nil {
+		logrus.Warningf("persist job record: %v", err)
+		// use empty job to not panic the rest of the function
+		job = &models.Job{}
+	} else {
+		defer fp.completeProcessingStep(process, job)
+	}
+
+	fields := findInvoiceFields(fp.document.Content, fp.document.Lang.String())
+	err = fp.db.DocumentStore.UpdateInvoiceFields(fp.document.Id, fields)
+	if err != nil {
+		job.Status = models.JobFailure
+		return err
+	}
+	fp.document.InvoiceFields = *fields
+	job.Status = models.JobFinished
+	log.Context(ctx).Debugf("found invoice fields: %v", !fields.IsEmpty())
+	return nil
+}
+
+// findInvoiceFields finds the IBAN, reference number, total amount, VAT number and due date in the text.
+// Account and reference numbers are validated with their checksums. Amount and due date must have a keyword
+// before them, e.g. 'total' or 'eräpäivä'.
+func findInvoiceFields(text string, lang string) *models.InvoiceFields {
+	fields := &models.InvoiceFields{
+		Iban:      findIban(text),
+		Reference: findReference(text),
+		VatNumber: findVatNumber(text),
+	}
+	amount, currency, ok := findTotalAmount(text)
+	if ok {
+		fields.Amount = &amount
+		fields.Currency = currency
+	}
+	if date, ok := pickDetectedDate(findDateCandidates(text, lang), models.RuleDateRoleDue); ok {
+		fields.DueDate = &date
+	}
+	return fields
+}
+
+// findIban returns the first valid IBAN in text.
+func findIban(text string) string {
+	for _, match := range invoiceIbanRe.FindAllString(text, -1) {
+		candidate := models.NormalizeIban(match)
+		if length := models.IbanLength(candidate[:2]); length > 0 {
+			if len(candidate) >= length && models.ValidIban(candidate[:length]) {
+				return candidate[:length]
+			}
+			continue
+		}
+		for length := len(candidate); length >= 15; length-- {
+			if models.ValidIban(candidate[:length]) {
+				return candidate[:length]
+			}
+		}
+	}
+	return ""
+}
+
+// findReference returns the first valid RF creditor reference, or the first valid Finnish reference number
+// that follows a reference keyword.
+func findReference(text string) string {
+	for _, match := range invoiceCreditorReferenceRe.FindAllString(text, -1) {
+		candidate := models.NormalizeIban(match)
+		for length := len(candidate); length >= 5; length-- {
+			if models.ValidCreditorReference(candidate[:length]) {
+				return candidate[:length]
+			}
+		}
+	}
+
+	for _, window := range keywordWindows(text, invoiceReferenceKeywords, invoiceKeywordWindow) {
+		match := invoiceDigitGroupsRe.FindString(window)
+		if match == "" {
+			continue
+		}
+		// the reference may be followed by other numbers, try the longest one first
+		groups := strings.Split(match, " ")
+		for n := len(groups); n > 0; n-- {
+			candidate := strings.Join(groups[:n], "")
+			if models.ValidFinnishReference(candidate) {
+				return candidate
+			}
+		}
+	}
+	return ""
+}
+
+// findTotalAmount returns the largest amount that follows a total keyword, and its currency.
+// If the amount has no currency, the currency is EUR if the text mentions euros.
+func findTotalAmount(text string) (float64, string, bool) {
+	found := false
+	amount := 0.0
+	currency := ""
+	for _, window := range keywordWindows(text, invoiceTotalKeywords, invoiceKeywordWindow) {
+		for _, match := range invoiceAmountRe.FindAllStringSubmatchIndex(window, -1) {
+			start, end := match[0], match[1]
+			if !isSeparateAmount(window, start, end) {
+				continue
+			}
+			value, err := models.ParseTypedMetadataValue(models.MetadataKeyTypeMoney, window[start:end])
+			if err != nil || value.Number == nil {
+				continue
+			}
+			if !found || *value.Number > amount {
+				found = true
+				amount = *value.Number
+				currency = value.Currency
+			}
+		}
+	}
+	if found && currency == "" && invoiceCurrencyRe.MatchString(text) {
+		currency = "EUR"
+	}
+	return amount, currency, found
+}
+
+// isSeparateAmount returns false if the amount is part of a longer number, date or a percentage.
+func isSeparateAmount(text string, start, end int) bool {
+	if start > 0 {
+		previous, _ := utf8.DecodeLastRuneInString(text[:start])
+		if unicode.IsDigit(previous) || previous == '.' || previous == ',' || previous == '-' {
+			return false
+		}
+	}
+	rest := strings.TrimLeft(text[end:], " ")
+	if rest == "" {
+		return true
+	}
+	next, size := utf8.DecodeRuneInString(rest)
+	if next == '%' || unicode.IsDigit(next) {
+		return false
+	}
+	if next == '.' || next == ',' {
+		following, _ := utf8.DecodeRuneInString(rest[size:])
+		return !unicode.IsDigit(following)
+	}
+	return true
+}
+
+// findVatNumber returns the first Finnish VAT number with valid checksum, or a VAT number or Finnish business id
+// that follows a VAT keyword. Business id is converted to VAT number.
+func findVatNumber(text string) string {
+	for _, match := range invoiceFinnishVatRe.FindAllStringSubmatch(text, -1) {
+		if models.ValidFinnishBusinessId(match[1] + "-" + match[2]) {
+			return "FI" + match[1] + match[2]
+		}
+	}
+
+	for _, window := range keywordWindows(text, invoiceVatKeywords, invoiceVatKeywordWindow) {
+		if match := invoiceVatRe.FindString(compactVatText(window)); match != "" {
+			return match
+		}
+		for _, match := range invoiceBusinessIdRe.FindAllString(window, -1) {
+			if models.ValidFinnishBusinessId(match) {
+				return "FI" + strings.Replace(match, "-", "", 1)
+			}
+		}
+	}
+	return ""
+}
+
+// compactVatText converts text to upper case and removes separators that are used inside VAT numbers,
+// e.g. 'de 123 456 789' -> 'DE123456789'.
+func compactVatText(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '.' || r == ' ' {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, text)
+}
+
+// keywordWindows returns the text after each occurrence of the keywords in lower case, in the order of the keywords
+// in text. Keywords in the middle of a word are ignored.
+func keywordWindows(text string, keywords []string, size int) []string {
+	lower := strings.ToLower(text)
+	type window struct {
+		start int
+		text  string
+	}
+	windows := make([]window, 0)
+	for _, keyword := range keywords {
+		offset := 0
+		for {
+			index := strings.Index(lower[offset:], keyword)
+			if index < 0 {
+				break
+			}
+			index += offset
+			offset = index + len(keyword)
+			if index > 0 {
+				previous, _ := utf8.DecodeLastRuneInString(lower[:index])
+				if unicode.IsLetter(previous) {
+					continue
+				}
+			}
+			end := offset + size
+			if end > len(lower) {
+				end = len(lower)
+			}
+			for end < len(lower) && !utf8.RuneStart(lower[end]) {
+				end++
+			}
+			windows = append(windows, window{start: index, text: lower[offset:end]})
+		}
+	}
+
+	sort.Slice(windows, func(i, j int) bool {
+		return windows[i].start < windows[j].start
+	})
+	result := make([]string, len(windows))
+	for i, v := range windows {
+		result[i] = v.text
+	}
+	return result
+}
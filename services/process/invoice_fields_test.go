@@ -0,0 +1,122 @@
+package process
+
+import (
+	"testing"
+	"time"
+)
+
+const testFinnishInvoice = `Yritys Oy
+Y-tunnus 0112038-9
+LASKU
+Laskun päivämäärä 1.3.2024
+Eräpäivä 15.3.2024
+Viitenumero 12345 614
+
+Tuote              Määrä   Hinta
+Konsultointi       10      100,00
+Veroton summa              1 000,00
+ALV 24 %                     240,00
+Maksettava yhteensä        1 240,00 €
+
+Tilinumero FI21 1234 5600 0007 85 BIC NDEAFIHH`
+
+const testEnglishInvoice = `ACME Ltd
+VAT reg. no: GB 123 456 789
+Invoice date: 1 March 2024
+Payment due: March 31, 2024
+Reference RF18 5390 0754 7034
+Subtotal 900.00
+Total due EUR 1,080.00
+IBAN: DE89 3704 0044 0532 0130 00`
+
+func TestFindInvoiceFields(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		lang      string
+		iban      string
+		reference string
+		amount    float64
+		currency  string
+		vat       string
+		due       time.Time
+	}{
+		{
+			name:      "finnish",
+			text:      testFinnishInvoice,
+			lang:      "fi",
+			iban:      "FI2112345600000785",
+			reference: "12345614",
+			amount:    1240,
+			currency:  "EUR",
+			vat:       "FI01120389",
+			due:       time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "english",
+			text:      testEnglishInvoice,
+			lang:      "en",
+			iban:      "DE89370400440532013000",
+			reference: "RF18539007547034",
+			amount:    1080,
+			currency:  "EUR",
+			vat:       "GB123456789",
+			due:       time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "not invoice",
+			text: "Meeting notes 1.3.2024. Total of 3 people attended. Reference to FI21 1234 5600 0007 86.",
+			lang: "en",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findInvoiceFields(tt.text, tt.lang)
+			if got.Iban != tt.iban {
+				t.Errorf("iban = %s, want %s", got.Iban, tt.iban)
+			}
+			if got.Reference != tt.reference {
+				t.Errorf("reference = %s, want %s", got.Reference, tt.reference)
+			}
+			if tt.amount == 0 && got.Amount != nil {
+				t.Errorf("amount = %f, want none", *got.Amount)
+			} else if tt.amount != 0 && (got.Amount == nil || *got.Amount != tt.amount) {
+				t.Errorf("amount = %v, want %f", got.Amount, tt.amount)
+			}
+			if got.Currency != tt.currency {
+				t.Errorf("currency = %s, want %s", got.Currency, tt.currency)
+			}
+			if got.VatNumber != tt.vat {
+				t.Errorf("vat number = %s, want %s", got.VatNumber, tt.vat)
+			}
+			if tt.due.IsZero() && got.DueDate != nil {
+				t.Errorf("due date = %s, want none", got.DueDate)
+			} else if !tt.due.IsZero() && (got.DueDate == nil || !got.DueDate.Equal(tt.due)) {
+				t.Errorf("due date = %v, want %s", got.DueDate, tt.due)
+			}
+		})
+	}
+}
+
+func TestIsSeparateAmount(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"124,00 €", true},
+		{"1.12.2024", false},
+		{"24,00 %", false},
+		{"124.00.", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			match := invoiceAmountRe.FindStringIndex(tt.text)
+			if match == nil {
+				t.Fatalf("no amount in %s", tt.text)
+			}
+			if got := isSeparateAmount(tt.text, match[0], match[1]); got != tt.want {
+				t.Errorf("isSeparateAmount() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,342 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package process
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"tryffel.net/go/virtualpaper/errors"
+	"tryffel.net/go/virtualpaper/models"
+	"tryffel.net/go/virtualpaper/storage"
+	log "tryffel.net/go/virtualpaper/util/logger"
+)
+
+// limits for training the classifier.
+const (
+	// number of latest classified documents to learn from.
+	suggestionTrainingDocuments = 2000
+	// number of characters of document content to learn from.
+	suggestionMaxContentLength = 20000
+	// classifier is trained again after it gets older than this.
+	suggestionClassifierMaxAge = 15 * time.Minute
+)
+
+// limits for suggesting values.
+const (
+	// minimum number of documents that value must have to be suggested.
+	suggestionMinExamples = 3
+	// minimum number of training documents that term must appear in to be used.
+	suggestionMinTermDocuments = 2
+	// number of the most informative terms that are used to score document.
+	suggestionEvidenceTerms = 15
+	// minimum confidence for value to be suggested.
+	minSuggestionConfidence = 0.5
+	// maximum number of values to suggest for each key.
+	maxSuggestionsPerKey = 3
+)
+
+// MetadataClassifier is a naive bayes classifier that learns metadata values from the content of documents.
+// Each value is a binary class: documents that have the value versus the rest of the documents.
+type MetadataClassifier struct {
+	documents int
+	// termDocuments is the number of documents that contain the term.
+	termDocuments map[string]int
+	values        []*metadataValueClass
+	trainedAt     time.Time
+}
+
+type metadataValueClass struct {
+	keyId     int
+	valueId   int
+	documents int
+	// termDocuments is the number of documents with the value that contain the term.
+	termDocuments map[string]int
+}
+
+// TrainMetadataClassifier learns the metadata values of the documents.
+// Values that have too few documents are not learned.
+func TrainMetadataClassifier(docs []models.MetadataTrainingDocument) *MetadataClassifier {
+	classifier := &MetadataClassifier{
+		documents:     len(docs),
+		termDocuments: make(map[string]int),
+		values:        make([]*metadataValueClass, 0),
+		trainedAt:     time.Now(),
+	}
+
+	classes := make(map[int]*metadataValueClass)
+	for _, doc := range docs {
+		terms := contentTerms(doc.Content)
+		for term := range terms {
+			classifier.termDocuments[term] += 1
+		}
+		for _, v := range doc.Metadata {
+			class, ok := classes[v.ValueId]
+			if !ok {
+				class = &metadataValueClass{keyId: v.KeyId, valueId: v.ValueId, termDocuments: make(map[string]int)}
+				classes[v.ValueId] = class
+			}
+			class.documents += 1
+			for term := range terms {
+				class.termDocuments[term] += 1
+			}
+		}
+	}
+
+	for _, class := range classes {
+		if class.documents >= suggestionMinExamples {
+			classifier.values = append(classifier.values, class)
+		}
+	}
+	sort.Slice(classifier.values, func(i, j int) bool {
+		return classifier.values[i].valueId < classifier.values[j].valueId
+	})
+	return classifier
+}
+
+// confidence returns the probability that document with the terms has the value.
+// Like in spam filters, only the most informative terms are used, which keeps long documents
+// from getting overconfident scores from terms that are not independent.
+func (c *MetadataClassifier) confidence(class *metadataValueClass, terms map[string]bool) float64 {
+	negatives := c.documents - class.documents
+	evidence := make([]float64, 0, len(terms))
+	for term := range terms {
+		total := c.termDocuments[term]
+		if total < suggestionMinTermDocuments {
+			continue
+		}
+		inClass := class.termDocuments[term]
+		// laplace smoothing
+		pTerm := float64(inClass+1) / float64(class.documents+2)
+		pTermOther := float64(total-inClass+1) / float64(negatives+2)
+		evidence = append(evidence, math.Log(pTerm/pTermOther))
+	}
+	sort.Slice(evidence, func(i, j int) bool {
+		return math.Abs(evidence[i]) > math.Abs(evidence[j])
+	})
+
+	score := math.Log(float64(class.documents+1) / float64(negatives+1))
+	for i := 0; i < len(evidence) && i < suggestionEvidenceTerms; i++ {
+		score += evidence[i]
+	}
+	return 1 / (1 + math.Exp(-score))
+}
+
+// Suggest returns the values that likely belong to the document with the content, most confident first.
+// Values that the document already has are not suggested.
+func (c *MetadataClassifier) Suggest(content string, existing []models.Metadata) []models.MetadataSuggestion {
+	suggestions := make([]models.MetadataSuggestion, 0)
+	terms := contentTerms(content)
+	if len(terms) == 0 {
+		return suggestions
+	}
+
+	hasValue := make(map[int]bool, len(existing))
+	for _, v := range existing {
+		hasValue[v.ValueId] = true
+	}
+
+	for _, class := range c.values {
+		if hasValue[class.valueId] {
+			continue
+		}
+		confidence := c.confidence(class, terms)
+		if confidence < minSuggestionConfidence {
+			continue
+		}
+		suggestions = append(suggestions, models.MetadataSuggestion{
+			KeyId:      class.keyId,
+			ValueId:    class.valueId,
+			Confidence: confidence,
+		})
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].Confidence > suggestions[j].Confidence
+	})
+
+	result := make([]models.MetadataSuggestion, 0, len(suggestions))
+	keySuggestions := make(map[int]int)
+	for _, v := range suggestions {
+		if keySuggestions[v.KeyId] >= maxSuggestionsPerKey {
+			continue
+		}
+		keySuggestions[v.KeyId] += 1
+		result = append(result, v)
+	}
+	return result
+}
+
+// metadataClassifierCache holds the trained classifier of each user.
+type metadataClassifierCache struct {
+	lock        sync.Mutex
+	classifiers map[int]*MetadataClassifier
+	// training holds a lock per user during training to not train the same classifier
+	// in multiple processors at once. Other users' classifiers are not blocked.
+	training map[int]*sync.Mutex
+}
+
+var metadataClassifiers = &metadataClassifierCache{
+	classifiers: make(map[int]*MetadataClassifier),
+	training:    make(map[int]*sync.Mutex),
+}
+
+// cached returns the classifier of the user if it is not too old.
+func (c *metadataClassifierCache) cached(userId int) *MetadataClassifier {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	classifier, ok := c.classifiers[userId]
+	if ok && time.Since(classifier.trainedAt) < suggestionClassifierMaxAge {
+		return classifier
+	}
+	return nil
+}
+
+func (c *metadataClassifierCache) trainingLock(userId int) *sync.Mutex {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	lock, ok := c.training[userId]
+	if !ok {
+		lock = &sync.Mutex{}
+		c.training[userId] = lock
+	}
+	return lock
+}
+
+// get returns the classifier of the user, training it if it does not exist or is too old.
+func (c *metadataClassifierCache) get(store *storage.MetadataStore, userId int) (*MetadataClassifier, error) {
+	if classifier := c.cached(userId); classifier != nil {
+		return classifier, nil
+	}
+
+	lock := c.trainingLock(userId)
+	lock.Lock()
+	defer lock.Unlock()
+	// classifier might have been trained while waiting for the lock
+	if classifier := c.cached(userId); classifier != nil {
+		return classifier, nil
+	}
+
+	docs, err := store.GetMetadataTrainingDocuments(userId, suggestionTrainingDocuments, suggestionMaxContentLength)
+	if err != nil {
+		return nil, fmt.Errorf("get training documents: %v", err)
+	}
+	classifier := TrainMetadataClassifier(docs)
+	c.lock.Lock()
+	c.classifiers[userId] = classifier
+	c.lock.Unlock()
+	logrus.Debugf("trained metadata classifier for user %d with %d documents and %d values",
+		userId, len(docs), len(classifier.values))
+	return classifier, nil
+}
+
+// invalidate removes the classifier of the user, e.g. when it refers to values that do not exist anymore.
+func (c *metadataClassifierCache) invalidate(userId int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.classifiers, userId)
+}
+
+func (fp *fileProcessor) suggestMetadata(ctx context.Context) error {
+	process := &models.ProcessItem{
+		DocumentId: fp.document.Id,
+		Action:     models.ProcessSuggestMetadata,
+		CreatedAt:  time.Now(),
+	}
+	job, err := fp.db.JobStore.StartProcessItem(process, "suggest metadata")
+	// hotfix for failure when job item does not exist anymore.
+	if err != nil {
+		logrus.Warningf("persist job record: %v", err)
+		// use empty job to not panic the rest of the function
+		job = &models.Job{}
+	} else {
+		defer fp.completeProcessingStep(process, job)
+	}
+
+	userId := fp.document.UserId
+	classifier, err := metadataClassifiers.get(fp.db.MetadataStore, userId)
+	if err != nil {
+		job.Status = models.JobFailure
+		return err
+	}
+	keys, err := fp.db.MetadataStore.GetSuggestionKeys(userId)
+	if err != nil {
+		job.Status = models.JobFailure
+		return err
+	}
+	userKeys := make(map[int]models.MetadataKey, len(keys))
+	for _, v := range keys {
+		userKeys[v.Id] = v
+	}
+
+	suggestions := make([]models.MetadataSuggestion, 0)
+	applied := make([]models.Metadata, 0)
+	for _, v := range classifier.Suggest(fp.document.Content, fp.document.Metadata) {
+		key, ok := userKeys[v.KeyId]
+		if !ok {
+			// key was deleted or changed to another type after training
+			continue
+		}
+		if key.AutoApplies(v) {
+			applied = append(applied, models.Metadata{KeyId: v.KeyId, ValueId: v.ValueId})
+		} else {
+			suggestions = append(suggestions, v)
+		}
+	}
+	log.Context(ctx).WithField("documentId", fp.document.Id).
+		Debugf("suggested %d metadata values, applied %d", len(suggestions), len(applied))
+
+	if len(applied) > 0 {
+		metadata := make([]models.Metadata, 0, len(fp.document.Metadata)+len(applied))
+		metadata = append(metadata, fp.document.Metadata...)
+		metadata = append(metadata, applied...)
+		err = fp.db.MetadataStore.UpdateDocumentKeyValues(userId, fp.document.Id, metadata)
+		if err != nil {
+			metadataClassifiers.invalidate(userId)
+			job.Status = models.JobFailure
+			return fmt.Errorf("apply suggested metadata: %v", err)
+		}
+		err = fp.db.JobStore.AddDocuments(fp.db, userId, []string{fp.document.Id}, []models.ProcessStep{models.ProcessFts})
+		if err != nil && !errors.Is(err, errors.ErrAlreadyExists) {
+			logrus.Errorf("queue document %s for indexing: %v", fp.document.Id, err)
+		}
+	}
+
+	tx, err := storage.NewTx(fp.db, ctx)
+	if err != nil {
+		job.Status = models.JobFailure
+		return err
+	}
+	defer tx.Close()
+	err = fp.db.MetadataStore.SetDocumentMetadataSuggestions(tx, fp.document.Id, suggestions)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		metadataClassifiers.invalidate(userId)
+		job.Status = models.JobFailure
+		return fmt.Errorf("save metadata suggestions: %v", err)
+	}
+	job.Status = models.JobFinished
+	return nil
+}
@@ -0,0 +1,91 @@
+package process
+
+import (
+	"fmt"
+	"testing"
+
+	"tryffel.net/go/virtualpaper/models"
+)
+
+func metadataTrainingDocs() []models.MetadataTrainingDocument {
+	invoice := []models.Metadata{{KeyId: 1, ValueId: 10}}
+	recipe := []models.Metadata{{KeyId: 1, ValueId: 11}}
+	electricity := []models.Metadata{{KeyId: 1, ValueId: 10}, {KeyId: 2, ValueId: 20}}
+	return []models.MetadataTrainingDocument{
+		{DocumentId: "1", Content: "Invoice number 123, amount due 45 EUR, due date 2023-01-31", Metadata: invoice},
+		{DocumentId: "2", Content: "Invoice for consulting, amount due 900 EUR, pay to bank account", Metadata: invoice},
+		{DocumentId: "3", Content: "Electricity invoice, amount due 80 EUR for 300 kWh", Metadata: electricity},
+		{DocumentId: "4", Content: "Electricity invoice, amount due 95 EUR for 350 kWh", Metadata: electricity},
+		{DocumentId: "5", Content: "Electricity invoice, amount due 70 EUR for 250 kWh", Metadata: electricity},
+		{DocumentId: "6", Content: "Recipe: mix flour, sugar and butter, bake in oven", Metadata: recipe},
+		{DocumentId: "7", Content: "Recipe: boil pasta, mix with butter and cheese", Metadata: recipe},
+		{DocumentId: "8", Content: "Recipe: mix flour and eggs, bake pancakes in butter", Metadata: recipe},
+		// too few examples to be learned
+		{DocumentId: "9", Content: "Rental contract for apartment", Metadata: []models.Metadata{{KeyId: 1, ValueId: 12}}},
+	}
+}
+
+func TestMetadataClassifier_Suggest(t *testing.T) {
+	classifier := TrainMetadataClassifier(metadataTrainingDocs())
+	if len(classifier.values) != 3 {
+		t.Fatalf("expected 3 values to be learned, got %d", len(classifier.values))
+	}
+
+	suggestions := classifier.Suggest("Electricity invoice, amount due 60 EUR for 200 kWh", nil)
+	if len(suggestions) != 2 {
+		t.Fatalf("expected 2 suggestions, got %v", suggestions)
+	}
+	if suggestions[0].Confidence < suggestions[1].Confidence {
+		t.Errorf("suggestions not sorted by confidence: %v", suggestions)
+	}
+	for _, v := range suggestions {
+		if v.ValueId != 10 && v.ValueId != 20 {
+			t.Errorf("unexpected suggestion: %v", v)
+		}
+		if v.Confidence < minSuggestionConfidence || v.Confidence > 1 {
+			t.Errorf("invalid confidence: %v", v)
+		}
+	}
+
+	suggestions = classifier.Suggest("Recipe: mix flour and butter, bake cookies", nil)
+	if len(suggestions) != 1 || suggestions[0].ValueId != 11 || suggestions[0].KeyId != 1 {
+		t.Errorf("expected recipe to be suggested, got %v", suggestions)
+	}
+
+	suggestions = classifier.Suggest("Electricity invoice, amount due 60 EUR for 200 kWh", []models.Metadata{{KeyId: 1, ValueId: 10}})
+	if len(suggestions) != 1 || suggestions[0].ValueId != 20 {
+		t.Errorf("expected existing value to be excluded, got %v", suggestions)
+	}
+
+	if suggestions := classifier.Suggest("", nil); len(suggestions) != 0 {
+		t.Errorf("expected no suggestions for empty content, got %v", suggestions)
+	}
+}
+
+func TestMetadataClassifier_SuggestEmpty(t *testing.T) {
+	classifier := TrainMetadataClassifier([]models.MetadataTrainingDocument{})
+	if suggestions := classifier.Suggest("Electricity invoice", nil); len(suggestions) != 0 {
+		t.Errorf("expected no suggestions without training documents, got %v", suggestions)
+	}
+}
+
+func TestMetadataClassifier_MaxSuggestionsPerKey(t *testing.T) {
+	docs := make([]models.MetadataTrainingDocument, 0)
+	content := "receipt"
+	for value := 1; value <= maxSuggestionsPerKey+2; value++ {
+		content += fmt.Sprintf(" store%d", value)
+		for i := 0; i < suggestionMinExamples; i++ {
+			docs = append(docs, models.MetadataTrainingDocument{
+				Content:  fmt.Sprintf("receipt store%d", value),
+				Metadata: []models.Metadata{{KeyId: 1, ValueId: value}},
+			})
+		}
+	}
+	docs = append(docs, models.MetadataTrainingDocument{Content: "unrelated letter", Metadata: []models.Metadata{{KeyId: 2, ValueId: 100}}})
+
+	classifier := TrainMetadataClassifier(docs)
+	suggestions := classifier.Suggest(content, nil)
+	if len(suggestions) != maxSuggestionsPerKey {
+		t.Errorf("expected %d suggestions, got %v", maxSuggestionsPerKey, suggestions)
+	}
+}
@@ -20,7 +20,7 @@ func (fp *fileProcessor) completeProcessingStep(process *models.ProcessItem, job
 	// if further steps do not absolutely require running this step.
 	removeStep := job.Status == models.JobFinished
 	switch process.Action {
-	case models.ProcessThumbnail, models.ProcessDetectLanguage, models.ProcessRules, models.ProcessFts:
+	case models.ProcessThumbnail, models.ProcessDetectLanguage, models.ProcessExtractFields, models.ProcessRules, models.ProcessFts, models.ProcessSimilarity, models.ProcessDuplicates, models.ProcessSuggestMetadata:
 		removeStep = true
 	}
 
@@ -167,13 +167,24 @@ func (fp *fileProcessor) processDocument() {
 				log.Errorf(ctx, "detect language: %v", err)
 				return
 			}
+		case models.ProcessExtractFields:
+			err := refreshDocument()
+			if err != nil {
+				log.Errorf(ctx, "refresh document: %v", err)
+				return
+			}
+			err = fp.extractInvoiceFields(ctx)
+			if err != nil {
+				log.Errorf(ctx, "extract invoice fields: %v", err)
+				return
+			}
 		case models.ProcessRules:
 			err := refreshDocument()
 			if err != nil {
 				log.Errorf(ctx, "refresh document: %v", err)
 				return
 			}
-			err = fp.runRules(ctx)
+			err = fp.runRules(ctx, step)
 			if err != nil {
 				log.Errorf(ctx, "run rules: %v", err)
 				return
@@ -189,13 +200,63 @@ func (fp *fileProcessor) processDocument() {
 				log.Errorf(ctx, "index search content: %v", err)
 				return
 			}
+		case models.ProcessSimilarity:
+			err := refreshDocument()
+			if err != nil {
+				log.Errorf(ctx, "refresh document: %v", err)
+				return
+			}
+			err = fp.computeSimilarity(ctx)
+			if err != nil {
+				log.Errorf(ctx, "compute similarity: %v", err)
+				return
+			}
+		case models.ProcessDuplicates:
+			err := refreshDocument()
+			if err != nil {
+				log.Errorf(ctx, "refresh document: %v", err)
+				return
+			}
+			err = fp.detectDuplicates(ctx)
+			if err != nil {
+				log.Errorf(ctx, "detect duplicates: %v", err)
+				return
+			}
+		case models.ProcessSuggestMetadata:
+			err := refreshDocument()
+			if err != nil {
+				log.Errorf(ctx, "refresh document: %v", err)
+				return
+			}
+			err = fp.suggestMetadata(ctx)
+			if err != nil {
+				log.Errorf(ctx, "suggest metadata: %v", err)
+				return
+			}
 		default:
 			logrus.Warningf("unhandled process step: %v, skipping", step.Action)
 		}
 	}
 }
 
-func (fp *fileProcessor) runRules(ctx context.Context) error {
+// saveRuleTraces replaces the rule traces of the document. Errors are only logged.
+func (fp *fileProcessor) saveRuleTraces(ctx context.Context, traces []*models.DocumentRuleTrace) {
+	tx, err := storage.NewTx(fp.db, ctx)
+	if err != nil {
+		logrus.Errorf("save rule traces: %v", err)
+		return
+	}
+	defer tx.Close()
+	err = fp.db.RuleStore.SaveDocumentRuleTraces(tx, fp.document.Id, traces)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		logrus.Errorf("save rule traces for document %s: %v", fp.document.Id, err)
+	}
+}
+
+func (fp *fileProcessor) runRules(ctx context.Context, step *models.ProcessItem) error {
 	if fp.document == nil {
 		return errors.New("no document set")
 	}
@@ -205,12 +266,19 @@ func (fp *fileProcessor) runRules(ctx context.Context) error {
 		return fmt.Errorf("load rules: %v", err)
 	}
 
+	// rules requested without a trigger, e.g. new document, are run on upload
+	triggers := step.Triggers
+	if len(triggers) == 0 {
+		triggers = models.RuleTriggers{models.RuleTriggerUpload}
+	}
+
 	process := &models.ProcessItem{
 		DocumentId: fp.document.Id,
 		Action:     models.ProcessRules,
 		CreatedAt:  time.Now(),
+		Triggers:   step.Triggers,
 	}
-	job, err := fp.db.JobStore.StartProcessItem(process, "process user rules")
+	job, err := fp.db.JobStore.StartProcessItem(process, fmt.Sprintf("process user rules (trigger: %s)", triggers))
 	// hotfix for failure when job item does not exist anymore.
 	if err != nil {
 		logrus.Warningf("persist job record: %v", err)
@@ -220,52 +288,32 @@ func (fp *fileProcessor) runRules(ctx context.Context) error {
 		defer fp.completeProcessingStep(process, job)
 	}
 
-	metadataValues, err := fp.db.MetadataStore.GetUserValuesWithMatching(fp.document.UserId)
-	if err != nil {
-		logrus.Errorf("get metadata values with matching for user %d: %v", fp.document.UserId, err)
-	} else if len(*metadataValues) != 0 {
-		err = matchMetadata(fp.document, metadataValues)
+	if triggers.Has(models.RuleTriggerUpload) {
+		metadataValues, err := fp.db.MetadataStore.GetUserValuesWithMatching(fp.document.UserId)
+		if err != nil {
+			logrus.Errorf("get metadata values with matching for user %d: %v", fp.document.UserId, err)
+		} else if len(*metadataValues) != 0 {
+			err = matchMetadata(fp.document, metadataValues)
+		}
 	}
 
 	log.Context(ctx).WithField("user", fp.document.UserId).WithField("documentId", fp.document.Id).
-		WithField("total-rules", len(rules)).Infof("Run user rules for document")
-
-	for i, rule := range rules {
-		logrus.Debugf("(%d.) run user rule %d", i, rule.Id)
-
-		if len(rule.Actions) == 0 {
-			logrus.Debugf("rule %d does not have actions, skip rule", rule.Id)
-			continue
-		}
-
-		if len(rule.Conditions) == 0 {
-			logrus.Debugf("rule %d does not have conditions, skip rule", rule.Id)
-			continue
-		}
+		WithField("total-rules", len(rules)).WithField("trigger", triggers.String()).Infof("Run user rules for document")
 
-		runner := NewDocumentRule(fp.document, rule)
-		match, err := runner.Match()
-		if err != nil {
-			logrus.Errorf("match rule (%d): %v", rule.Id, err)
-		}
-		if !match {
-			logrus.Debugf("document %s does not match rule: %d", fp.document.Id, rule.Id)
-		} else {
-
-			logrus.Debugf("document %s matches rule %d, run actions", fp.document.Id, rule.Id)
-			err = runner.RunActions()
-			if err != nil {
-				logrus.Errorf("rule (%d) actions: %v", rule.Id, err)
-			}
-		}
+	passes, traces, err := RunTriggeredRules(fp.document, rules, triggers, fp.db.MetadataStore, NewRuleActionStore(fp.db))
+	if errors.Is(err, ErrRuleLoop) {
+		log.Context(ctx).WithField("documentId", fp.document.Id).Warnf("stop running rules: %v", err)
+		job.Message += fmt.Sprintf(", stopped: %v", err)
 	}
 
 	if err != nil {
 		logrus.Errorf("run user rules: %v", err)
 		job.Status = models.JobFailure
 	} else {
+		logrus.Debugf("ran rules for document %s in %d passes", fp.document.Id, passes)
 		job.Status = models.JobFinished
 	}
+	fp.saveRuleTraces(ctx, traces)
 
 	err = fp.db.DocumentStore.Update(storage.UserIdInternal, fp.document)
 	if err != nil {
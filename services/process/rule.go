@@ -24,16 +24,36 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/sirupsen/logrus"
 	"tryffel.net/go/virtualpaper/errors"
 	"tryffel.net/go/virtualpaper/models"
 )
 
+// MetadataValueStore finds and creates metadata values that rules extract from documents.
+type MetadataValueStore interface {
+	GetKey(keyId int) (*models.MetadataKey, error)
+	GetValueByName(userId, keyId int, value string) (*models.MetadataValue, error)
+	CreateValue(value *models.MetadataValue) error
+	GetDocumentType(userId, typeId int) (*models.DocumentType, error)
+}
+
 type DocumentRule struct {
 	Rule     *models.Rule
 	Document *models.Document
 	date     time.Time
+	// dates are the dates found with date_detect conditions.
+	dates map[models.RuleDateRole]time.Time
+
+	// metadata is used to create extracted metadata values. If nil, values are not extracted.
+	metadata MetadataValueStore
+	// actions runs actions that change other records than the document. If nil, the actions are skipped.
+	actions RuleActionStore
+	// trace records the evaluated conditions and executed actions, if set.
+	trace *models.DocumentRuleTrace
+	// testing does not create any new metadata values.
+	testing bool
 }
 
 type RuleTestConditionResult struct {
@@ -41,6 +61,8 @@ type RuleTestConditionResult struct {
 	ConditionType string `json:"condition_type"`
 	Matched       bool   `json:"matched"`
 	Skipped       bool   `json:"skipped"`
+	// Children are the results of nested conditions, if condition is a group.
+	Children []RuleTestConditionResult `json:"children,omitempty"`
 }
 
 type RuleTestAction struct {
@@ -70,38 +92,59 @@ func NewDocumentRule(document *models.Document, rule *models.Rule) DocumentRule
 	}
 }
 
-func (d *DocumentRule) Match() (bool, error) {
-	hasMatch := false
+// SetMetadataStore sets the store that metadata values are extracted to.
+func (d *DocumentRule) SetMetadataStore(store MetadataValueStore) {
+	d.metadata = store
+}
+
+// SetActionStore sets the store that runs actions for sharing, linking, trashing and notifying.
+func (d *DocumentRule) SetActionStore(store RuleActionStore) {
+	d.actions = store
+}
+
+// SetTrace sets the trace to record the rule evaluation to.
+func (d *DocumentRule) SetTrace(trace *models.DocumentRuleTrace) {
+	d.trace = trace
+}
 
+func (d *DocumentRule) Match() (bool, error) {
 	logrus.Debugf("match document: %s, rule: %d", d.Document.Id, d.Rule.Id)
-	for i, condition := range d.Rule.Conditions {
+	if d.trace == nil {
+		return d.matchConditions(d.Rule.Conditions, d.Rule.Mode, "", nil)
+	}
+	d.trace.Conditions = models.NewRuleTraceConditions(d.Rule.Conditions)
+	match, err := d.matchConditions(d.Rule.Conditions, d.Rule.Mode, "", d.trace.Conditions)
+	d.trace.Matched = match
+	if err != nil {
+		d.trace.Error = err.Error()
+	}
+	return match, err
+}
+
+// matchConditions evaluates conditions with given match mode. Groups are evaluated recursively.
+// Path is the position of the group in the condition tree, used for logging.
+// If trace is not nil, it must have an item for each condition, and the results are stored to it.
+func (d *DocumentRule) matchConditions(conditions []*models.RuleCondition, mode models.RuleConditionMatchType, path string,
+	trace []models.RuleTraceCondition) (bool, error) {
+	hasMatch := false
+	for i, condition := range conditions {
+		position := fmt.Sprintf("%s%d", path, i+1)
 		if !condition.Enabled {
-			logrus.Debugf("rule %d - condition: %d (id:%d), %s is disabled", d.Rule.Id, i+1, condition.Id, condition.ConditionType)
+			logrus.Debugf("rule %d - condition: %s (id:%d), %s is disabled", d.Rule.Id, position, condition.Id, condition.ConditionType)
 			continue
 		}
 
-		logrus.Debugf("evaluate rule %d - condition: %d (id:%d), %s", d.Rule.Id, i+1, condition.Id, condition.ConditionType)
-		condText := string(condition.ConditionType)
-		var ok = false
+		logrus.Debugf("evaluate rule %d - condition: %s (id:%d), %s", d.Rule.Id, position, condition.Id, condition.ConditionType)
+		var ok bool
 		var err error
-		if strings.HasPrefix(condText, "name") {
-			ok, err = d.matchText(condition, d.Document.Name)
-		} else if strings.HasPrefix(condText, "description") {
-			ok, err = d.matchText(condition, d.Document.Description)
-		} else if strings.HasPrefix(condText, "content") {
-			ok, err = d.matchText(condition, d.Document.Content)
-		} else if strings.HasPrefix(condText, "date") {
-			ok, err = d.extractDates(condition, time.Now(), nil)
-		} else if strings.HasPrefix(condText, "metadata_count") {
-			ok, err = d.hasMetadataCount(condition)
-		} else if condition.ConditionType == models.RuleConditionMetadataHasKey {
-			ok = d.hasMetadataKey(condition)
-		} else if condition.ConditionType == models.RuleConditionMetadataHasKeyValue {
-			ok = d.hasMetadataKeyValue(condition)
+		if condition.IsGroup() {
+			var childTrace []models.RuleTraceCondition
+			if trace != nil {
+				childTrace = trace[i].Children
+			}
+			ok, err = d.matchConditions(condition.Children, condition.Mode, position+".", childTrace)
 		} else {
-			err := errors.ErrInternalError
-			err.ErrMsg = "unknown condition type: " + condText
-			return false, err
+			ok, err = d.matchCondition(condition, nil)
 		}
 		if err != nil {
 			return false, fmt.Errorf("evaluate condition: %v", err)
@@ -110,14 +153,18 @@ func (d *DocumentRule) Match() (bool, error) {
 		if condition.Inverted {
 			ok = !ok
 		}
+		if trace != nil {
+			trace[i].Skipped = false
+			trace[i].Matched = ok
+		}
 
 		if ok {
 			hasMatch = true
-		} else if d.Rule.Mode == models.RuleMatchAll {
+		} else if mode == models.RuleMatchAll {
 			return false, nil
 		}
 
-		if hasMatch && d.Rule.Mode == models.RuleMatchAny {
+		if hasMatch && mode == models.RuleMatchAny {
 			// already found a match, skip rest of the conditions
 			break
 		}
@@ -125,6 +172,48 @@ func (d *DocumentRule) Match() (bool, error) {
 	return hasMatch, nil
 }
 
+// matchCondition evaluates a single condition that is not a group.
+func (d *DocumentRule) matchCondition(condition *models.RuleCondition, logger *logrus.Logger) (bool, error) {
+	condText := string(condition.ConditionType)
+	switch condition.ConditionType {
+	case models.RuleConditionFilenameIs, models.RuleConditionFilenameStarts, models.RuleConditionFilenameContains:
+		return d.matchText(condition, d.Document.Filename)
+	case models.RuleConditionMimetypeIs, models.RuleConditionMimetypeStarts:
+		return d.matchMimetype(condition)
+	case models.RuleConditionLangIs:
+		return strings.EqualFold(d.Document.Lang.String(), strings.TrimSpace(condition.Value)), nil
+	case models.RuleConditionSizeLessThan, models.RuleConditionSizeMoreThan:
+		return d.matchSize(condition)
+	case models.RuleConditionPageCount, models.RuleConditionPageCountLessThan, models.RuleConditionPageCountMoreThan:
+		return d.matchPageCount(condition)
+	case models.RuleConditionCreatedOlderThan, models.RuleConditionCreatedNewerThan:
+		return d.matchCreated(condition, time.Now())
+	case models.RuleConditionExpression:
+		return d.matchExpression(condition, time.Now())
+	case models.RuleConditionDateDetect:
+		return d.detectDate(condition, logger)
+	}
+
+	if strings.HasPrefix(condText, "name") {
+		return d.matchText(condition, d.Document.Name)
+	} else if strings.HasPrefix(condText, "description") {
+		return d.matchText(condition, d.Document.Description)
+	} else if strings.HasPrefix(condText, "content") {
+		return d.matchText(condition, d.Document.Content)
+	} else if strings.HasPrefix(condText, "date") {
+		return d.extractDates(condition, time.Now(), logger)
+	} else if strings.HasPrefix(condText, "metadata_count") {
+		return d.hasMetadataCount(condition)
+	} else if condition.ConditionType == models.RuleConditionMetadataHasKey {
+		return d.hasMetadataKey(condition), nil
+	} else if condition.ConditionType == models.RuleConditionMetadataHasKeyValue {
+		return d.hasMetadataKeyValue(condition), nil
+	}
+	err := errors.ErrInternalError
+	err.ErrMsg = "unknown condition type: " + condText
+	return false, err
+}
+
 type formatter struct{}
 
 func (f *formatter) Format(entry *logrus.Entry) ([]byte, error) {
@@ -147,11 +236,14 @@ func (d *DocumentRule) matchText(condition *models.RuleCondition, text string) (
 		return matchTextByRegex(value, text)
 	} else {
 		switch condition.ConditionType {
-		case models.RuleConditionNameIs, models.RuleConditionDescriptionIs, models.RuleConditionContentIs:
+		case models.RuleConditionNameIs, models.RuleConditionDescriptionIs, models.RuleConditionContentIs,
+			models.RuleConditionFilenameIs:
 			return matchTextAllowTypo(value, text, false, true)
-		case models.RuleConditionNameStarts, models.RuleConditionDescriptionStarts, models.RuleConditionContentStarts:
+		case models.RuleConditionNameStarts, models.RuleConditionDescriptionStarts, models.RuleConditionContentStarts,
+			models.RuleConditionFilenameStarts:
 			return matchTextAllowTypo(value, text, true, false)
-		case models.RuleConditionNameContains, models.RuleConditionDescriptionContains, models.RuleConditionContentContains:
+		case models.RuleConditionNameContains, models.RuleConditionDescriptionContains, models.RuleConditionContentContains,
+			models.RuleConditionFilenameContains:
 			return matchTextAllowTypo(value, text, false, false)
 		default:
 			err := errors.ErrInternalError
@@ -200,6 +292,97 @@ func (d *DocumentRule) hasMetadataCount(condition *models.RuleCondition) (bool,
 	}
 }
 
+// matchMimetype matches mimetype exactly or by prefix, e.g. 'image/'. Mimetypes are case-insensitive.
+func (d *DocumentRule) matchMimetype(condition *models.RuleCondition) (bool, error) {
+	mimetype := strings.ToLower(d.Document.Mimetype)
+	value := strings.ToLower(strings.TrimSpace(condition.Value))
+	if condition.IsRegex {
+		return matchTextByRegex(condition.Value, d.Document.Mimetype)
+	}
+	if condition.ConditionType == models.RuleConditionMimetypeStarts {
+		return strings.HasPrefix(mimetype, value), nil
+	}
+	return mimetype == value, nil
+}
+
+func (d *DocumentRule) matchSize(condition *models.RuleCondition) (bool, error) {
+	limit, err := models.ParseRuleFileSize(condition.Value)
+	if err != nil {
+		e := errors.ErrInvalid
+		e.ErrMsg = "invalid size: " + err.Error()
+		return false, e
+	}
+	if condition.ConditionType == models.RuleConditionSizeLessThan {
+		return d.Document.Size < limit, nil
+	}
+	return d.Document.Size > limit, nil
+}
+
+// matchPageCount compares the number of pages. Document whose page count is not known never matches.
+func (d *DocumentRule) matchPageCount(condition *models.RuleCondition) (bool, error) {
+	limit, err := strconv.Atoi(condition.Value)
+	if err != nil || limit < 0 {
+		e := errors.ErrInvalid
+		e.ErrMsg = "value must be a non-negative number"
+		return false, e
+	}
+	if d.Document.PageCount == 0 {
+		return false, nil
+	}
+
+	switch condition.ConditionType {
+	case models.RuleConditionPageCount:
+		return d.Document.PageCount == limit, nil
+	case models.RuleConditionPageCountLessThan:
+		return d.Document.PageCount < limit, nil
+	case models.RuleConditionPageCountMoreThan:
+		return d.Document.PageCount > limit, nil
+	default:
+		return false, fmt.Errorf("not page count condition: %v", condition.ConditionType)
+	}
+}
+
+// matchCreated compares the upload date of the document to the age in condition.
+func (d *DocumentRule) matchCreated(condition *models.RuleCondition, now time.Time) (bool, error) {
+	age, err := models.ParseRuleAge(condition.Value)
+	if err != nil {
+		e := errors.ErrInvalid
+		e.ErrMsg = "invalid age: " + err.Error()
+		return false, e
+	}
+	limit := age.Before(now)
+	if condition.ConditionType == models.RuleConditionCreatedOlderThan {
+		return d.Document.CreatedAt.Before(limit), nil
+	}
+	return d.Document.CreatedAt.After(limit), nil
+}
+
+// conditionDocumentValue describes the document's value that the condition is matched against.
+// Returns empty string for conditions that explain the match themselves.
+func (d *DocumentRule) conditionDocumentValue(condition *models.RuleCondition) string {
+	switch condition.ConditionType {
+	case models.RuleConditionFilenameIs, models.RuleConditionFilenameStarts, models.RuleConditionFilenameContains:
+		return fmt.Sprintf("document filename: '%s'", d.Document.Filename)
+	case models.RuleConditionMimetypeIs, models.RuleConditionMimetypeStarts:
+		return fmt.Sprintf("document mimetype: '%s'", d.Document.Mimetype)
+	case models.RuleConditionLangIs:
+		return fmt.Sprintf("document language: '%s'", d.Document.Lang)
+	case models.RuleConditionSizeLessThan, models.RuleConditionSizeMoreThan:
+		limit, _ := models.ParseRuleFileSize(condition.Value)
+		return fmt.Sprintf("document size: %d bytes, limit: %d bytes", d.Document.Size, limit)
+	case models.RuleConditionPageCount, models.RuleConditionPageCountLessThan, models.RuleConditionPageCountMoreThan:
+		if d.Document.PageCount == 0 {
+			return "document page count is not known, process the document again to count pages"
+		}
+		return fmt.Sprintf("document page count: %d", d.Document.PageCount)
+	case models.RuleConditionCreatedOlderThan, models.RuleConditionCreatedNewerThan:
+		age, _ := models.ParseRuleAge(condition.Value)
+		return fmt.Sprintf("document uploaded at: %s, limit: %s",
+			d.Document.CreatedAt.Format("2006-01-02"), age.Before(time.Now()).Format("2006-01-02"))
+	}
+	return ""
+}
+
 // Try to extract all dates from the document.
 // In case there are multiple dates found, prioritice:
 // 1. a future date that has most matches
@@ -293,6 +476,17 @@ func (d *DocumentRule) RunActions() error {
 	var err error
 	for _, action := range d.Rule.Actions {
 		err = d.runAction(action, nil)
+		if d.trace != nil {
+			traceAction := models.RuleTraceAction{
+				ActionId:   action.Id,
+				ActionType: action.Action.String(),
+				Skipped:    !action.Enabled,
+			}
+			if err != nil {
+				traceAction.Error = err.Error()
+			}
+			d.trace.Actions = append(d.trace.Actions, traceAction)
+		}
 		if err != nil {
 			break
 		}
@@ -325,6 +519,22 @@ func (d *DocumentRule) runAction(action *models.RuleAction, log logFunc) error {
 		removeMetadata(d.Document, int(action.MetadataKey), int(action.MetadataValue), log)
 	case models.RuleActionSetDate:
 		actionError = d.setDate(action, log)
+	case models.RuleActionExtractMetadata:
+		actionError = d.extractMetadata(action, log)
+	case models.RuleActionSetLang:
+		actionError = d.setLang(action, log)
+	case models.RuleActionShare:
+		actionError = d.share(action, log)
+	case models.RuleActionLinkLatest:
+		actionError = d.linkLatest(action, log)
+	case models.RuleActionTrash:
+		actionError = d.trash(log)
+	case models.RuleActionNotify:
+		actionError = d.notify(action, log)
+	case models.RuleActionSetDateMetadata:
+		actionError = d.setDateMetadata(action, log)
+	case models.RuleActionSetDocumentType:
+		actionError = d.setDocumentType(action, log)
 	default:
 		e := errors.ErrInternalError
 		e.ErrMsg = fmt.Sprintf("unknown action type: %v", action.Action)
@@ -417,6 +627,125 @@ func addMetadata(doc *models.Document, key, value int, log logFunc) error {
 	return nil
 }
 
+// maximum length of extracted metadata value, same as metadata values created by user.
+const maxExtractedValueLength = 30
+
+// extractMetadataValue returns the first non-empty capture group that the regex matches in the document
+// name or content. Whitespace in the value is normalized.
+func extractMetadataValue(re *regexp.Regexp, doc *models.Document) (string, bool) {
+	for _, text := range []string{doc.Name, doc.Content} {
+		for _, match := range re.FindAllStringSubmatch(text, -1) {
+			for _, group := range match[1:] {
+				value := strings.Join(strings.Fields(group), " ")
+				if value != "" {
+					return value, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// validExtractedValue returns error message if value cannot be stored as metadata value.
+func validExtractedValue(value string) string {
+	if len([]rune(value)) > maxExtractedValueLength {
+		return fmt.Sprintf("value is longer than %d characters", maxExtractedValueLength)
+	}
+	if strings.ContainsAny(value, ";:") {
+		return "value cannot contain ';' or ':'"
+	}
+	return ""
+}
+
+func (d *DocumentRule) extractMetadata(action *models.RuleAction, log logFunc) error {
+	re, err := regexp.Compile(action.Value)
+	if err != nil {
+		return fmt.Errorf("invalid regex: %v", err)
+	}
+	keyName := action.MetadataKeyName.String()
+
+	value, ok := extractMetadataValue(re, d.Document)
+	if !ok {
+		if log != nil {
+			log("regex did not match (skipping)")
+		}
+		return nil
+	}
+	if msg := validExtractedValue(value); msg != "" {
+		if log != nil {
+			log(`extracted value "%s" is invalid (skipping): %s`, value, msg)
+		}
+		return nil
+	}
+
+	return d.addMetadataByName(int(action.MetadataKey), keyName, value, log)
+}
+
+// addMetadataByName adds metadata value to document. The value is created under the key if it does not exist yet.
+func (d *DocumentRule) addMetadataByName(keyId int, keyName, value string, log logFunc) error {
+	if d.metadata == nil {
+		if log != nil {
+			log(`extracted value "%s" for key "%s"`, value, keyName)
+		}
+		return nil
+	}
+
+	key, err := d.metadata.GetKey(keyId)
+	if err != nil {
+		return fmt.Errorf("get metadata key: %v", err)
+	}
+	// values belong to the key owner, who is not the document owner if the key is used through a vocabulary
+	newValue := &models.MetadataValue{
+		UserId:    key.UserId,
+		KeyId:     keyId,
+		Value:     value,
+		MatchType: models.MetadataMatchExact,
+	}
+	if key.Type.IsTyped() {
+		err = newValue.SetTypedValue(key.Type, value)
+		if err != nil {
+			if log != nil {
+				log(`skip extracted value "%s" for key "%s": %v`, value, keyName, err)
+			}
+			return nil
+		}
+		value = newValue.Value
+	}
+
+	existing, err := d.metadata.GetValueByName(key.UserId, keyId, value)
+	if err == nil {
+		if log != nil {
+			log(`extracted value "%s" for key "%s", value exists`, existing.Value, keyName)
+		}
+		return addMetadata(d.Document, keyId, existing.Id, log)
+	} else if !errors.Is(err, errors.ErrRecordNotFound) {
+		return fmt.Errorf("get metadata value: %v", err)
+	}
+
+	if d.testing {
+		if log != nil {
+			log(`extracted value "%s" for key "%s", would create new value`, value, keyName)
+		}
+		// value does not exist yet, show it without id
+		d.Document.Metadata = append(d.Document.Metadata, models.Metadata{
+			KeyId: keyId,
+			Key:   keyName,
+			Value: value,
+		})
+		return nil
+	}
+
+	err = d.metadata.CreateValue(newValue)
+	if err != nil {
+		return fmt.Errorf("create metadata value: %v", err)
+	}
+	logrus.Infof("rule %d created metadata value %d (%s) for key %d", d.Rule.Id, newValue.Id, value, keyId)
+	if log != nil {
+		log(`created value "%s" for key "%s"`, value, keyName)
+	}
+	return addMetadata(d.Document, keyId, newValue.Id, log)
+}
+
 // remove metadata. If valueId == 0, delete all metadata that matches the key.
 func removeMetadata(doc *models.Document, keyId, valueId int, log logFunc) {
 	i := 0
@@ -562,6 +891,68 @@ func matchTextByDistance(match, text string, maxTypos int, matchPrefix, matchIs
 	return false, nil
 }
 
+// SimilarTexts returns true if texts are equal allowing maxTypos of difference. Comparison is case-insensitive.
+func SimilarTexts(a, b string, maxTypos int) bool {
+	a = strings.ToLower(a)
+	b = strings.ToLower(b)
+	if a == b {
+		return true
+	}
+	if maxTypos < 1 {
+		return false
+	}
+	lenA := utf8.RuneCountInString(a)
+	lenB := utf8.RuneCountInString(b)
+	if lenA > lenB {
+		a, b = b, a
+		lenA, lenB = lenB, lenA
+	}
+	if lenB-lenA > maxTypos {
+		return false
+	}
+	return editDistance([]rune(a), []rune(b), maxTypos) <= maxTypos
+}
+
+// editDistance returns the number of insertions, deletions, substitutions and transpositions of adjacent
+// characters needed to turn a into b. Computing stops once distance exceeds max, in which case max+1 is returned.
+func editDistance(a, b []rune, max int) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d := prev[j-1] + cost
+			if prev[j]+1 < d {
+				d = prev[j] + 1
+			}
+			if curr[j-1]+1 < d {
+				d = curr[j-1] + 1
+			}
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] && prev2[j-2]+1 < d {
+				d = prev2[j-2] + 1
+			}
+			curr[j] = d
+			if d < rowMin {
+				rowMin = d
+			}
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+	return prev[len(b)]
+}
+
 func matchMetadata(document *models.Document, values *[]models.MetadataValue) error {
 	logrus.Debugf("match metadata keys for doc: %s, %d rules", document.Id, len(*values))
 	for _, v := range *values {
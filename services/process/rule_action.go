@@ -0,0 +1,278 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2021  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package process
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"tryffel.net/go/virtualpaper/config"
+	"tryffel.net/go/virtualpaper/errors"
+	"tryffel.net/go/virtualpaper/models"
+	"tryffel.net/go/virtualpaper/services/mail"
+	"tryffel.net/go/virtualpaper/storage"
+)
+
+// RuleActionStore executes the rule actions that change other records than the document itself.
+// Each action adds an entry to the document history.
+type RuleActionStore interface {
+	// ShareDocument shares the document with the user.
+	ShareDocument(ruleId int, doc *models.Document, sharing models.UpdateUserSharing) error
+	// LinkLatestDocument links the document to the latest other document that has any of the metadata values.
+	// Returns the id of the linked document, or empty string if there is no such document.
+	LinkLatestDocument(ruleId int, doc *models.Document, keyId int, valueIds []int) (string, error)
+	// TrashDocument moves the document to trash bin.
+	TrashDocument(ruleId int, doc *models.Document) error
+	// Notify sends the message to the document owner. Returns false if the notification was not sent.
+	Notify(ruleId int, doc *models.Document, message string) (bool, error)
+}
+
+type ruleActionStore struct {
+	db *storage.Database
+}
+
+// NewRuleActionStore returns RuleActionStore that persists the actions to the database.
+func NewRuleActionStore(db *storage.Database) RuleActionStore {
+	return &ruleActionStore{db: db}
+}
+
+func (r *ruleActionStore) ShareDocument(ruleId int, doc *models.Document, sharing models.UpdateUserSharing) error {
+	return r.inTx(func(tx storage.SqlExecer) error {
+		return r.db.DocumentStore.ShareByRule(tx, ruleId, doc, sharing)
+	})
+}
+
+func (r *ruleActionStore) LinkLatestDocument(ruleId int, doc *models.Document, keyId int, valueIds []int) (string, error) {
+	targetId, err := r.db.DocumentStore.GetLatestDocumentWithMetadata(doc.UserId, doc.Id, keyId, valueIds)
+	if errors.Is(err, errors.ErrRecordNotFound) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	err = r.inTx(func(tx storage.SqlExecer) error {
+		created, err := r.db.MetadataStore.LinkDocument(tx, doc.Id, targetId)
+		if err != nil || !created {
+			return err
+		}
+		return r.db.DocumentStore.AddRuleHistory(tx, ruleId, []models.DocumentHistory{{
+			DocumentId: doc.Id,
+			Action:     models.DocumentHistoryActionLink,
+			NewValue:   targetId,
+		}})
+	})
+	return targetId, err
+}
+
+func (r *ruleActionStore) TrashDocument(ruleId int, doc *models.Document) error {
+	err := r.inTx(func(tx storage.SqlExecer) error {
+		return r.db.DocumentStore.MarkDocumentDeletedByRule(tx, ruleId, doc.Id)
+	})
+	if err != nil {
+		return err
+	}
+	// remove document from search index
+	err = r.db.JobStore.AddDocuments(r.db, doc.UserId, []string{doc.Id}, []models.ProcessStep{models.ProcessFts})
+	if err != nil && !errors.Is(err, errors.ErrAlreadyExists) {
+		return fmt.Errorf("queue document for indexing: %v", err)
+	}
+	return nil
+}
+
+func (r *ruleActionStore) Notify(ruleId int, doc *models.Document, message string) (bool, error) {
+	if !mail.MailEnabled() {
+		logrus.Warningf("rule %d: cannot send notification, mail is not configured", ruleId)
+		return false, nil
+	}
+	user, err := r.db.UserStore.GetUser(doc.UserId)
+	if err != nil {
+		return false, fmt.Errorf("get user: %v", err)
+	}
+	if user.Email == "" {
+		logrus.Warningf("rule %d: cannot send notification, user %d does not have email", ruleId, doc.UserId)
+		return false, nil
+	}
+
+	msg := fmt.Sprintf("%s\n\nDocument: %s\n%s/#/documents/%s/show", message, doc.Name, config.C.Api.PublicUrl, doc.Id)
+	err = mail.SendMail(context.Background(), "Virtualpaper: "+doc.Name, msg, user.Email)
+	if err != nil {
+		return false, fmt.Errorf("send mail: %v", err)
+	}
+	return true, r.db.DocumentStore.AddRuleHistory(r.db, ruleId, []models.DocumentHistory{{
+		DocumentId: doc.Id,
+		Action:     models.DocumentHistoryActionNotification,
+		NewValue:   message,
+	}})
+}
+
+func (r *ruleActionStore) inTx(f func(tx storage.SqlExecer) error) error {
+	tx, err := storage.NewTx(r.db, context.Background())
+	if err != nil {
+		return err
+	}
+	defer tx.Close()
+	err = f(tx)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (d *DocumentRule) setLang(action *models.RuleAction, log logFunc) error {
+	if log != nil {
+		log(`set language: "%s" -> "%s"`, d.Document.Lang, action.Value)
+	}
+	d.Document.Lang = models.Lang(action.Value)
+	return nil
+}
+
+// setDocumentType sets the document type and adds the default values of the type's keys
+// that the document does not have yet.
+func (d *DocumentRule) setDocumentType(action *models.RuleAction, log logFunc) error {
+	typeId, err := action.DocumentTypeId()
+	if err != nil {
+		return err
+	}
+	if d.metadata == nil {
+		if log != nil {
+			log("would set document type %d", typeId)
+		}
+		return nil
+	}
+	docType, err := d.metadata.GetDocumentType(d.Rule.UserId, typeId)
+	if err != nil {
+		return fmt.Errorf("get document type %d: %v", typeId, err)
+	}
+	if log != nil {
+		log(`set document type: %d -> %d (%s)`, d.Document.DocumentTypeId, typeId, docType.Name)
+	}
+	d.Document.DocumentTypeId = models.IntId(typeId)
+	for _, v := range docType.Defaults(d.Document.Metadata) {
+		err = addMetadata(d.Document, v.KeyId, v.ValueId, log)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipSideEffect returns true if actions that change other records should not be run.
+func (d *DocumentRule) skipSideEffect(log logFunc, format string, args ...interface{}) bool {
+	if !d.testing && d.actions != nil {
+		return false
+	}
+	if log != nil {
+		log("would "+format, args...)
+	}
+	return true
+}
+
+func (d *DocumentRule) share(action *models.RuleAction, log logFunc) error {
+	sharing, err := action.Sharing()
+	if err != nil {
+		return err
+	}
+	if d.skipSideEffect(log, "share document with user %d", sharing.UserId) {
+		return nil
+	}
+	err = d.actions.ShareDocument(d.Rule.Id, d.Document, sharing)
+	if err != nil {
+		return fmt.Errorf("share document: %v", err)
+	}
+	if log != nil {
+		log("shared document with user %d", sharing.UserId)
+	}
+	return nil
+}
+
+func (d *DocumentRule) linkLatest(action *models.RuleAction, log logFunc) error {
+	keyId := int(action.MetadataKey)
+	valueIds := make([]int, 0, 1)
+	if action.MetadataValue != 0 {
+		valueIds = append(valueIds, int(action.MetadataValue))
+	} else {
+		for _, v := range d.Document.Metadata {
+			if v.KeyId == keyId && v.ValueId != 0 {
+				valueIds = append(valueIds, v.ValueId)
+			}
+		}
+	}
+	if len(valueIds) == 0 {
+		if log != nil {
+			log("document does not have metadata key (skipping)")
+		}
+		return nil
+	}
+	if d.skipSideEffect(log, "link document to latest document with key %d, values %v", keyId, valueIds) {
+		return nil
+	}
+	targetId, err := d.actions.LinkLatestDocument(d.Rule.Id, d.Document, keyId, valueIds)
+	if err != nil {
+		return fmt.Errorf("link document: %v", err)
+	}
+	if log != nil {
+		if targetId == "" {
+			log("no document to link (skipping)")
+		} else {
+			log("linked document to %s", targetId)
+		}
+	}
+	return nil
+}
+
+func (d *DocumentRule) trash(log logFunc) error {
+	if d.Document.DeletedAt.Valid {
+		if log != nil {
+			log("document is already in trash bin (skipping)")
+		}
+		return nil
+	}
+	if d.skipSideEffect(log, "move document to trash bin") {
+		return nil
+	}
+	err := d.actions.TrashDocument(d.Rule.Id, d.Document)
+	if err != nil {
+		return fmt.Errorf("move document to trash bin: %v", err)
+	}
+	d.Document.DeletedAt.Valid = true
+	d.Document.DeletedAt.Time = time.Now()
+	if log != nil {
+		log("moved document to trash bin")
+	}
+	return nil
+}
+
+func (d *DocumentRule) notify(action *models.RuleAction, log logFunc) error {
+	if d.skipSideEffect(log, `send notification: "%s"`, action.Value) {
+		return nil
+	}
+	sent, err := d.actions.Notify(d.Rule.Id, d.Document, action.Value)
+	if err != nil {
+		return fmt.Errorf("send notification: %v", err)
+	}
+	if log != nil {
+		if sent {
+			log("sent notification")
+		} else {
+			log("notifications are not available (skipping)")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package process
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"tryffel.net/go/virtualpaper/errors"
+	"tryffel.net/go/virtualpaper/models"
+)
+
+// ruleExpressionCache holds the compiled expressions of each rule, so that running a rule
+// against many documents compiles its expressions only once.
+type ruleExpressionCache struct {
+	lock  sync.Mutex
+	rules map[int]*ruleExpressions
+}
+
+// ruleExpressions are the compiled expressions of a rule, by condition id.
+type ruleExpressions struct {
+	updatedAt time.Time
+	programs  map[int]compiledExpression
+}
+
+type compiledExpression struct {
+	expression string
+	program    *vm.Program
+}
+
+var ruleExpressionPrograms = &ruleExpressionCache{
+	rules: make(map[int]*ruleExpressions),
+}
+
+// get returns the compiled expression of the condition. The cached programs of a rule are
+// discarded when the rule has been updated. Rules that are not saved yet are not cached.
+func (c *ruleExpressionCache) get(rule *models.Rule, condition *models.RuleCondition) (*vm.Program, error) {
+	if rule == nil || rule.Id == 0 || condition.Id == 0 {
+		return models.CompileRuleExpression(condition.Value)
+	}
+
+	c.lock.Lock()
+	cached, ok := c.rules[rule.Id]
+	if ok && cached.updatedAt.Equal(rule.UpdatedAt) {
+		compiled, ok := cached.programs[condition.Id]
+		if ok && compiled.expression == condition.Value {
+			c.lock.Unlock()
+			return compiled.program, nil
+		}
+	}
+	c.lock.Unlock()
+
+	program, err := models.CompileRuleExpression(condition.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	cached, ok = c.rules[rule.Id]
+	if !ok || !cached.updatedAt.Equal(rule.UpdatedAt) {
+		cached = &ruleExpressions{updatedAt: rule.UpdatedAt, programs: make(map[int]compiledExpression)}
+		c.rules[rule.Id] = cached
+	}
+	cached.programs[condition.Id] = compiledExpression{expression: condition.Value, program: program}
+	return program, nil
+}
+
+// matchExpression evaluates the expression condition against a read-only view of the document.
+func (d *DocumentRule) matchExpression(condition *models.RuleCondition, now time.Time) (bool, error) {
+	program, err := ruleExpressionPrograms.get(d.Rule, condition)
+	if err != nil {
+		e := errors.ErrInvalid
+		e.ErrMsg = "invalid expression: " + err.Error()
+		return false, e
+	}
+
+	output, err := expr.Run(program, d.expressionEnv(condition, now))
+	if err != nil {
+		return false, fmt.Errorf("run expression: %v", err)
+	}
+	match, ok := output.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression returned %T, expected bool", output)
+	}
+	return match, nil
+}
+
+func (d *DocumentRule) expressionEnv(condition *models.RuleCondition, now time.Time) models.RuleExpressionEnv {
+	doc := models.NewRuleExpressionDocument(d.Document)
+	regexes := map[string]*regexp.Regexp{}
+
+	return models.RuleExpressionEnv{
+		Doc: doc,
+		Now: now,
+		Regex: func(text, pattern string) (bool, error) {
+			re, ok := regexes[pattern]
+			if !ok {
+				var err error
+				re, err = regexp.Compile(pattern)
+				if err != nil {
+					return false, fmt.Errorf("invalid regex: %v", err)
+				}
+				regexes[pattern] = re
+			}
+			return re.MatchString(text), nil
+		},
+		Fuzzy: func(text, value string) (bool, error) {
+			if condition.CaseInsensitive {
+				text = strings.ToLower(text)
+				value = strings.ToLower(value)
+			}
+			return matchTextAllowTypo(value, text, false, false)
+		},
+		HasMetadata: func(key string, values ...string) bool {
+			docValues, ok := doc.Metadata[key]
+			if !ok {
+				return false
+			}
+			if len(values) == 0 {
+				return true
+			}
+			for _, v := range docValues {
+				for _, value := range values {
+					if v == value {
+						return true
+					}
+				}
+			}
+			return false
+		},
+		Quarter: func(date time.Time) int {
+			return (int(date.Month())-1)/3 + 1
+		},
+	}
+}
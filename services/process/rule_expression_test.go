@@ -0,0 +1,102 @@
+package process
+
+import (
+	"testing"
+	"time"
+
+	"tryffel.net/go/virtualpaper/models"
+)
+
+func TestDocumentRule_matchExpression(t *testing.T) {
+	doc := &models.Document{
+		Id:        "1234",
+		Name:      "Scanned invoice",
+		Content:   "Invoice from Acme Corporation, total 120 EUR, due date 2023-11-30. Payment reference 1234.",
+		Filename:  "scan.pdf",
+		Mimetype:  "application/pdf",
+		Lang:      "en",
+		Size:      2 << 20,
+		PageCount: 2,
+		Date:      time.Date(2023, 11, 15, 0, 0, 0, 0, time.UTC),
+		Metadata: []models.Metadata{
+			{KeyId: 1, Key: "category", ValueId: 2, Value: "invoice"},
+			{KeyId: 1, Key: "category", ValueId: 3, Value: "bills"},
+		},
+	}
+
+	tests := []struct {
+		name            string
+		expression      string
+		caseInsensitive bool
+		want            bool
+		wantErr         bool
+	}{
+		{"field", `doc.lang == "en" && doc.page_count > 1 && doc.size < 5 * 1024 * 1024`, false, true, false},
+		{"two of words in q4", `count(["invoice", "payment", "receipt"], fuzzy(doc.content, #)) >= 2 && quarter(doc.date) == 4`, true, true, false},
+		{"case sensitive", `fuzzy(doc.content, "acme corporation")`, false, false, false},
+		{"fuzzy with typo", `fuzzy(doc.content, "acme corporatoin")`, true, true, false},
+		{"regex", `regex(doc.content, "total \\d+ EUR")`, false, true, false},
+		{"invalid regex", `regex(doc.content, "total (")`, false, false, true},
+		{"metadata", `has_metadata("category", "receipt", "bills") && "invoice" in doc.metadata["category"]`, false, true, false},
+		{"missing metadata", `has_metadata("author")`, false, false, false},
+		{"date", `doc.date.Year() == now.Year() - 1`, false, true, false},
+		{"not bool", `doc.name`, false, false, true},
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition := &models.RuleCondition{
+				Enabled:         true,
+				ConditionType:   models.RuleConditionExpression,
+				Value:           tt.expression,
+				CaseInsensitive: tt.caseInsensitive,
+			}
+			d := NewDocumentRule(doc, &models.Rule{Mode: models.RuleMatchAll, Conditions: []*models.RuleCondition{condition}})
+			got, err := d.matchExpression(condition, now)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("matchExpression() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("matchExpression() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleExpressionCache_get(t *testing.T) {
+	cache := &ruleExpressionCache{rules: make(map[int]*ruleExpressions)}
+	rule := &models.Rule{Id: 1}
+	rule.UpdatedAt = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	condition := &models.RuleCondition{Id: 2, RuleId: 1, Value: `doc.lang == "en"`}
+
+	first, err := cache.get(rule, condition)
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	second, err := cache.get(rule, condition)
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	if first != second {
+		t.Errorf("expected cached program to be reused")
+	}
+
+	rule.UpdatedAt = rule.UpdatedAt.Add(time.Minute)
+	condition.Value = `doc.lang == "fi"`
+	updated, err := cache.get(rule, condition)
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	if updated == first {
+		t.Errorf("expected updated rule to be compiled again")
+	}
+
+	unsaved, err := cache.get(&models.Rule{}, &models.RuleCondition{Value: `doc.lang == "en"`})
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	if unsaved == nil || len(cache.rules) != 1 {
+		t.Errorf("expected unsaved rule not to be cached")
+	}
+}
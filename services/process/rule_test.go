@@ -3,9 +3,11 @@ package process
 import (
 	"database/sql"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"tryffel.net/go/virtualpaper/errors"
 	"tryffel.net/go/virtualpaper/models"
 )
 
@@ -429,6 +431,35 @@ func TestDocumentRule_matchTextByDistance(t *testing.T) {
 	}
 }
 
+func TestSimilarTexts(t *testing.T) {
+	tests := []struct {
+		a        string
+		b        string
+		maxTypos int
+		want     bool
+	}{
+		{"doyle", "Doyle", 0, true},
+		{"doyle", "doyel", 0, false},
+		{"doyle", "doyel", 1, true},
+		{"invoice", "invoices", 1, true},
+		{"paper", "papr", 1, true},
+		{"receipt", "reciept", 1, true},
+		{"doyle", "doylexx", 1, false},
+		{"doyle", "darwin", 1, false},
+		{"doyle", "boyle", 1, true},
+		{"doyle", "boyles", 1, false},
+		{"paper", "pepar", 1, false},
+		{"äiti", "aiti", 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+"-"+tt.b, func(t *testing.T) {
+			if got := SimilarTexts(tt.a, tt.b, tt.maxTypos); got != tt.want {
+				t.Errorf("SimilarTexts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func BenchmarkDocumentRule_matchTextByDistance_shorttext(b *testing.B) {
 	// 66 words to search from.
 	match := "a short match"
@@ -744,3 +775,538 @@ func TestDocumentRule_extractDates(t *testing.T) {
 		})
 	}
 }
+
+type testMetadataStore struct {
+	keys   []models.MetadataKey
+	values []models.MetadataValue
+	types  []models.DocumentType
+}
+
+// GetKey returns the key. Keys that are not listed are text keys of user 1.
+func (s *testMetadataStore) GetKey(keyId int) (*models.MetadataKey, error) {
+	for i, v := range s.keys {
+		if v.Id == keyId {
+			return &s.keys[i], nil
+		}
+	}
+	return &models.MetadataKey{Id: keyId, UserId: 1, Type: models.MetadataKeyTypeText}, nil
+}
+
+func (s *testMetadataStore) GetValueByName(userId, keyId int, value string) (*models.MetadataValue, error) {
+	for i, v := range s.values {
+		if v.UserId == userId && v.KeyId == keyId && strings.EqualFold(v.Value, value) {
+			return &s.values[i], nil
+		}
+	}
+	return nil, errors.ErrRecordNotFound
+}
+
+func (s *testMetadataStore) CreateValue(value *models.MetadataValue) error {
+	value.Id = len(s.values) + 100
+	s.values = append(s.values, *value)
+	return nil
+}
+
+func (s *testMetadataStore) GetDocumentType(userId, typeId int) (*models.DocumentType, error) {
+	for i, v := range s.types {
+		if v.UserId == userId && v.Id == typeId {
+			return &s.types[i], nil
+		}
+	}
+	return nil, errors.ErrRecordNotFound
+}
+
+func TestDocumentRule_setDocumentType(t *testing.T) {
+	store := &testMetadataStore{types: []models.DocumentType{
+		{Id: 3, UserId: 1, Name: "invoice", Keys: []models.DocumentTypeKey{
+			{KeyId: 1, Required: true},
+			{KeyId: 2, Required: true, DefaultValueId: 20},
+			{KeyId: 4, DefaultValueId: 40},
+		}},
+		{Id: 4, UserId: 2, Name: "contract"},
+	}}
+	newRule := func(typeId string) *models.Rule {
+		return &models.Rule{
+			Id:     1,
+			UserId: 1,
+			Actions: []*models.RuleAction{
+				{Enabled: true, OnCondition: true, Action: models.RuleActionSetDocumentType, Value: typeId},
+			},
+		}
+	}
+
+	doc := &models.Document{Id: "1234", UserId: 1, Metadata: []models.Metadata{{KeyId: 4, ValueId: 41}}}
+	dr := NewDocumentRule(doc, newRule("3"))
+	dr.SetMetadataStore(store)
+	if err := dr.RunActions(); err != nil {
+		t.Fatalf("run actions: %v", err)
+	}
+	if doc.DocumentTypeId != 3 {
+		t.Errorf("document type not set: %d", doc.DocumentTypeId)
+	}
+	if len(doc.Metadata) != 2 || !doc.HasMetadataKeyValue(2, 20) || !doc.HasMetadataKeyValue(4, 41) {
+		t.Errorf("invalid default metadata: %v", doc.Metadata)
+	}
+
+	// other user's type
+	doc = &models.Document{Id: "1234", UserId: 1}
+	dr = NewDocumentRule(doc, newRule("4"))
+	dr.SetMetadataStore(store)
+	if err := dr.RunActions(); err == nil {
+		t.Errorf("other user's document type was set")
+	}
+	if doc.DocumentTypeId != 0 {
+		t.Errorf("document type changed: %d", doc.DocumentTypeId)
+	}
+}
+
+func TestDocumentRule_extractMetadata(t *testing.T) {
+	newDoc := func() *models.Document {
+		return &models.Document{
+			Id:      "1234",
+			UserId:  1,
+			Name:    "invoice",
+			Content: "Invoice number 1234\nCustomer:   Acme   Corporation\nTotal 10 EUR",
+		}
+	}
+	action := &models.RuleAction{
+		Enabled:     true,
+		OnCondition: true,
+		Action:      models.RuleActionExtractMetadata,
+		Value:       `Customer:\s*(.+)`,
+		MetadataKey: 5,
+	}
+	rule := &models.Rule{
+		Id:     1,
+		UserId: 1,
+		Mode:   models.RuleMatchAll,
+		Conditions: []*models.RuleCondition{
+			{Enabled: true, ConditionType: models.RuleConditionNameIs, Value: "invoice"},
+		},
+		Actions: []*models.RuleAction{action},
+	}
+
+	store := &testMetadataStore{values: []models.MetadataValue{
+		{Id: 1, UserId: 1, KeyId: 4, Value: "Acme Corporation"},
+		{Id: 2, UserId: 2, KeyId: 5, Value: "Acme Corporation"},
+	}}
+
+	// test mode does not create values
+	doc := newDoc()
+	dr := NewDocumentRule(doc, rule)
+	dr.SetMetadataStore(store)
+	result := dr.MatchTest().ActionOutput
+	if len(store.values) != 2 {
+		t.Errorf("test mode created metadata value")
+	}
+	if len(doc.Metadata) != 1 || doc.Metadata[0].ValueId != 0 || doc.Metadata[0].Value != "Acme Corporation" {
+		t.Errorf("test mode did not add unsaved metadata: %v", doc.Metadata)
+	}
+	if len(result) != 1 || !strings.Contains(strings.Join(result[0], "\n"), `"Acme Corporation"`) {
+		t.Errorf("test output does not contain extracted value: %v", result)
+	}
+
+	// value is created on first run and reused after that
+	for i := 0; i < 2; i++ {
+		doc = newDoc()
+		dr = NewDocumentRule(doc, rule)
+		dr.SetMetadataStore(store)
+		if err := dr.RunActions(); err != nil {
+			t.Fatalf("run actions: %v", err)
+		}
+		if len(store.values) != 3 {
+			t.Fatalf("expected 3 metadata values, got %d", len(store.values))
+		}
+		created := store.values[2]
+		if created.Value != "Acme Corporation" || created.KeyId != 5 || created.UserId != 1 {
+			t.Errorf("invalid metadata value created: %+v", created)
+		}
+		if !doc.HasMetadataKeyValue(5, created.Id) {
+			t.Errorf("extracted metadata not added to document: %v", doc.Metadata)
+		}
+	}
+
+	// no match
+	doc = newDoc()
+	doc.Content = "no customer here"
+	dr = NewDocumentRule(doc, rule)
+	dr.SetMetadataStore(store)
+	if err := dr.RunActions(); err != nil {
+		t.Fatalf("run actions: %v", err)
+	}
+	if len(doc.Metadata) != 0 {
+		t.Errorf("metadata added without match: %v", doc.Metadata)
+	}
+
+	// value too long
+	doc = newDoc()
+	doc.Content = "Customer: " + strings.Repeat("a", maxExtractedValueLength+1)
+	dr = NewDocumentRule(doc, rule)
+	dr.SetMetadataStore(store)
+	if err := dr.RunActions(); err != nil {
+		t.Fatalf("run actions: %v", err)
+	}
+	if len(doc.Metadata) != 0 || len(store.values) != 3 {
+		t.Errorf("invalid value was extracted")
+	}
+}
+
+func TestDocumentRule_extractSubscribedMetadata(t *testing.T) {
+	// key 5 belongs to user 2 and user 1 uses it through a vocabulary
+	rule := &models.Rule{
+		Id:     1,
+		UserId: 1,
+		Mode:   models.RuleMatchAll,
+		Actions: []*models.RuleAction{{
+			Enabled:     true,
+			OnCondition: true,
+			Action:      models.RuleActionExtractMetadata,
+			Value:       `Vendor:\s*(.+)`,
+			MetadataKey: 5,
+		}},
+	}
+	store := &testMetadataStore{
+		keys:   []models.MetadataKey{{Id: 5, UserId: 2, Key: "vendor", Type: models.MetadataKeyTypeText}},
+		values: []models.MetadataValue{{Id: 1, UserId: 2, KeyId: 5, Value: "acme"}},
+	}
+
+	for _, content := range []string{"Vendor: Acme", "Vendor: Initech"} {
+		doc := &models.Document{Id: "1234", UserId: 1, Content: content}
+		dr := NewDocumentRule(doc, rule)
+		dr.SetMetadataStore(store)
+		if err := dr.RunActions(); err != nil {
+			t.Fatalf("run actions: %v", err)
+		}
+		if len(doc.Metadata) != 1 {
+			t.Fatalf("expected 1 metadata, got %v", doc.Metadata)
+		}
+	}
+	if len(store.values) != 2 {
+		t.Fatalf("expected 2 metadata values, got %+v", store.values)
+	}
+	if created := store.values[1]; created.Value != "Initech" || created.UserId != 2 {
+		t.Errorf("value not created for the key owner: %+v", created)
+	}
+}
+
+func TestDocumentRule_extractTypedMetadata(t *testing.T) {
+	rule := &models.Rule{
+		Id:     1,
+		UserId: 1,
+		Mode:   models.RuleMatchAll,
+		Actions: []*models.RuleAction{{
+			Enabled:     true,
+			OnCondition: true,
+			Action:      models.RuleActionExtractMetadata,
+			Value:       `Total\s*(.+)`,
+			MetadataKey: 5,
+		}},
+	}
+	store := &testMetadataStore{
+		keys: []models.MetadataKey{{Id: 5, UserId: 1, Key: "amount", Type: models.MetadataKeyTypeMoney}},
+		values: []models.MetadataValue{
+			{Id: 1, UserId: 1, KeyId: 5, Value: "10.00 EUR"},
+		},
+	}
+
+	tests := []struct {
+		content string
+		want    string
+		created bool
+	}{
+		{content: "Total 10 EUR", want: "10.00 EUR"},
+		{content: "Total €1 234,50", want: "1234.50 EUR", created: true},
+		{content: "Total unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.content, func(t *testing.T) {
+			valuesBefore := len(store.values)
+			doc := &models.Document{Id: "1234", UserId: 1, Content: tt.content}
+			dr := NewDocumentRule(doc, rule)
+			dr.SetMetadataStore(store)
+			if err := dr.RunActions(); err != nil {
+				t.Fatalf("run actions: %v", err)
+			}
+			if tt.want == "" {
+				if len(doc.Metadata) != 0 {
+					t.Errorf("invalid value was extracted: %v", doc.Metadata)
+				}
+				return
+			}
+			if len(doc.Metadata) != 1 {
+				t.Fatalf("expected 1 metadata, got %v", doc.Metadata)
+			}
+			value := store.values[0]
+			for _, v := range store.values {
+				if v.Id == doc.Metadata[0].ValueId {
+					value = v
+				}
+			}
+			if value.Value != tt.want {
+				t.Errorf("expected value %s, got %s", tt.want, value.Value)
+			}
+			if created := len(store.values) > valuesBefore; created != tt.created {
+				t.Errorf("expected value created: %v, got %v", tt.created, created)
+			}
+			if tt.created && (value.Currency != "EUR" || value.NumberValue == nil || *value.NumberValue != 1234.5) {
+				t.Errorf("typed value not set: %+v", value)
+			}
+		})
+	}
+}
+
+func TestDocumentRule_MatchGroups(t *testing.T) {
+	doc := &models.Document{
+		Id:       "1234",
+		UserId:   1,
+		Name:     "invoice",
+		Content:  "Lasku 123, eräpäivä 1.1.2024",
+		Metadata: []models.Metadata{{KeyId: 1, ValueId: 2}},
+	}
+	vendor := &models.RuleCondition{
+		Enabled:       true,
+		ConditionType: models.RuleConditionMetadataHasKeyValue,
+		MetadataKey:   1,
+		MetadataValue: 2,
+	}
+	newGroup := func(mode models.RuleConditionMatchType, values ...string) *models.RuleCondition {
+		group := &models.RuleCondition{Enabled: true, ConditionType: models.RuleConditionGroup, Mode: mode}
+		for _, v := range values {
+			group.Children = append(group.Children, &models.RuleCondition{
+				Enabled:         true,
+				ConditionType:   models.RuleConditionContentContains,
+				CaseInsensitive: true,
+				Value:           v,
+			})
+		}
+		return group
+	}
+
+	tests := []struct {
+		name       string
+		conditions []*models.RuleCondition
+		want       bool
+	}{
+		{"vendor and any of group", []*models.RuleCondition{vendor, newGroup(models.RuleMatchAny, "invoice", "lasku")}, true},
+		{"vendor and no match in group", []*models.RuleCondition{vendor, newGroup(models.RuleMatchAny, "invoice", "receipt")}, false},
+		{"vendor and all of group", []*models.RuleCondition{vendor, newGroup(models.RuleMatchAll, "lasku", "eräpäivä")}, true},
+		{"vendor and not all of group", []*models.RuleCondition{vendor, newGroup(models.RuleMatchAll, "lasku", "invoice")}, false},
+		{"nested groups", []*models.RuleCondition{
+			{
+				Enabled:       true,
+				ConditionType: models.RuleConditionGroup,
+				Mode:          models.RuleMatchAll,
+				Children:      []*models.RuleCondition{vendor, newGroup(models.RuleMatchAny, "receipt", "lasku")},
+			},
+		}, true},
+		{"inverted group", []*models.RuleCondition{
+			vendor,
+			func() *models.RuleCondition {
+				group := newGroup(models.RuleMatchAny, "receipt")
+				group.Inverted = true
+				return group
+			}(),
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := &models.Rule{Id: 1, Mode: models.RuleMatchAll, Conditions: tt.conditions}
+			dr := NewDocumentRule(doc, rule)
+			got, err := dr.Match()
+			if err != nil {
+				t.Fatalf("Match() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+
+			result := dr.MatchTest()
+			if result.Match != tt.want {
+				t.Errorf("MatchTest() = %v, want %v", result.Match, tt.want)
+			}
+		})
+	}
+
+	rule := &models.Rule{
+		Id:         1,
+		Mode:       models.RuleMatchAll,
+		Conditions: []*models.RuleCondition{vendor, newGroup(models.RuleMatchAny, "invoice", "lasku")},
+	}
+	dr := NewDocumentRule(doc, rule)
+	result := dr.MatchTest()
+	group := result.Conditions[1]
+	if len(group.Children) != 2 {
+		t.Fatalf("expected group to have 2 child results, got %d", len(group.Children))
+	}
+	if group.Children[0].Matched || group.Children[0].Skipped {
+		t.Errorf("expected first condition in group to be evaluated and not match: %+v", group.Children[0])
+	}
+	if !group.Children[1].Matched || !group.Matched {
+		t.Errorf("expected group to match: %+v", group)
+	}
+	output := strings.Join(result.ConditionOutput[1], "\n")
+	if !strings.Contains(output, "condition 2.2 matched") || !strings.Contains(output, "group 2 matched: true") {
+		t.Errorf("test output does not explain group: %s", output)
+	}
+}
+
+func TestDocumentRule_matchFileConditions(t *testing.T) {
+	now := time.Now()
+	doc := &models.Document{
+		Timestamp: models.Timestamp{CreatedAt: now.AddDate(-8, 0, 0)},
+		Id:        "1234",
+		Filename:  "SCAN_0012.png",
+		Mimetype:  "image/png",
+		Size:      6 << 20,
+		Lang:      "fi",
+		PageCount: 3,
+	}
+
+	tests := []struct {
+		name          string
+		conditionType models.RuleConditionType
+		value         string
+		want          bool
+		wantErr       bool
+	}{
+		{"filename starts", models.RuleConditionFilenameStarts, "SCAN_", true, false},
+		{"filename is", models.RuleConditionFilenameIs, "scan.png", false, false},
+		{"mimetype starts", models.RuleConditionMimetypeStarts, "image/", true, false},
+		{"mimetype is", models.RuleConditionMimetypeIs, "application/pdf", false, false},
+		{"mimetype case-insensitive", models.RuleConditionMimetypeIs, "IMAGE/PNG", true, false},
+		{"lang is", models.RuleConditionLangIs, "fi", true, false},
+		{"lang is not", models.RuleConditionLangIs, "en", false, false},
+		{"size more than", models.RuleConditionSizeMoreThan, "5 MB", true, false},
+		{"size less than", models.RuleConditionSizeLessThan, "5MB", false, false},
+		{"size in bytes", models.RuleConditionSizeLessThan, "10000000", true, false},
+		{"invalid size", models.RuleConditionSizeLessThan, "big", false, true},
+		{"page count", models.RuleConditionPageCount, "3", true, false},
+		{"page count less than", models.RuleConditionPageCountLessThan, "3", false, false},
+		{"page count more than", models.RuleConditionPageCountMoreThan, "2", true, false},
+		{"created older than", models.RuleConditionCreatedOlderThan, "7y", true, false},
+		{"created newer than", models.RuleConditionCreatedNewerThan, "7y", false, false},
+		{"created newer than days", models.RuleConditionCreatedNewerThan, "3000d", true, false},
+		{"invalid age", models.RuleConditionCreatedOlderThan, "7 years", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			condition := &models.RuleCondition{Enabled: true, ConditionType: tt.conditionType, Value: tt.value}
+			d := NewDocumentRule(doc, &models.Rule{Mode: models.RuleMatchAll, Conditions: []*models.RuleCondition{condition}})
+			got, err := d.matchCondition(condition, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("matchCondition() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("matchCondition() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	unknownPages := *doc
+	unknownPages.PageCount = 0
+	condition := &models.RuleCondition{Enabled: true, ConditionType: models.RuleConditionPageCountLessThan, Value: "5"}
+	d := NewDocumentRule(&unknownPages, &models.Rule{Mode: models.RuleMatchAll, Conditions: []*models.RuleCondition{condition}})
+	if got, _ := d.matchCondition(condition, nil); got {
+		t.Errorf("matchCondition() document without page count matched")
+	}
+}
+
+type testRuleActionStore struct {
+	shared   []models.UpdateUserSharing
+	linked   [][]int
+	trashed  []string
+	messages []string
+}
+
+func (s *testRuleActionStore) ShareDocument(ruleId int, doc *models.Document, sharing models.UpdateUserSharing) error {
+	s.shared = append(s.shared, sharing)
+	return nil
+}
+
+func (s *testRuleActionStore) LinkLatestDocument(ruleId int, doc *models.Document, keyId int, valueIds []int) (string, error) {
+	s.linked = append(s.linked, valueIds)
+	return "latest", nil
+}
+
+func (s *testRuleActionStore) TrashDocument(ruleId int, doc *models.Document) error {
+	s.trashed = append(s.trashed, doc.Id)
+	return nil
+}
+
+func (s *testRuleActionStore) Notify(ruleId int, doc *models.Document, message string) (bool, error) {
+	s.messages = append(s.messages, message)
+	return true, nil
+}
+
+func TestDocumentRule_sideEffectActions(t *testing.T) {
+	newDoc := func() *models.Document {
+		return &models.Document{
+			Id:     "1234",
+			UserId: 1,
+			Name:   "invoice",
+			Lang:   "en",
+			Metadata: []models.Metadata{
+				{KeyId: 5, ValueId: 10},
+				{KeyId: 5, ValueId: 11},
+				{KeyId: 6, ValueId: 12},
+			},
+		}
+	}
+	rule := &models.Rule{
+		Id:     1,
+		UserId: 1,
+		Mode:   models.RuleMatchAll,
+		Conditions: []*models.RuleCondition{
+			{Enabled: true, ConditionType: models.RuleConditionNameIs, Value: "invoice"},
+		},
+		Actions: []*models.RuleAction{
+			{Enabled: true, OnCondition: true, Action: models.RuleActionSetLang, Value: "fi"},
+			{Enabled: true, OnCondition: true, Action: models.RuleActionShare, Value: `{"user_id": 2, "permissions": {"read": true}}`},
+			{Enabled: true, OnCondition: true, Action: models.RuleActionLinkLatest, MetadataKey: 5},
+			{Enabled: true, OnCondition: true, Action: models.RuleActionLinkLatest, MetadataKey: 6, MetadataValue: 20},
+			{Enabled: true, OnCondition: true, Action: models.RuleActionLinkLatest, MetadataKey: 7},
+			{Enabled: true, OnCondition: true, Action: models.RuleActionNotify, Value: "new invoice"},
+			{Enabled: true, OnCondition: true, Action: models.RuleActionTrash},
+			{Enabled: true, OnCondition: true, Action: models.RuleActionTrash},
+		},
+	}
+
+	// test mode does not run the actions
+	store := &testRuleActionStore{}
+	doc := newDoc()
+	dr := NewDocumentRule(doc, rule)
+	dr.SetActionStore(store)
+	result := dr.MatchTest()
+	if len(store.shared)+len(store.linked)+len(store.trashed)+len(store.messages) != 0 {
+		t.Errorf("test mode ran actions: %+v", store)
+	}
+	if doc.Lang != "fi" {
+		t.Errorf("test mode did not set language: %s", doc.Lang)
+	}
+	if len(result.ActionOutput) != len(rule.Actions) || !strings.Contains(strings.Join(result.ActionOutput[6], "\n"), "would move document to trash bin") {
+		t.Errorf("test output does not describe actions: %v", result.ActionOutput)
+	}
+
+	doc = newDoc()
+	dr = NewDocumentRule(doc, rule)
+	dr.SetActionStore(store)
+	if err := dr.RunActions(); err != nil {
+		t.Fatalf("run actions: %v", err)
+	}
+	if doc.Lang != "fi" {
+		t.Errorf("language not set: %s", doc.Lang)
+	}
+	if !reflect.DeepEqual(store.shared, []models.UpdateUserSharing{{UserId: 2, Permissions: models.Permissions{Read: true}}}) {
+		t.Errorf("invalid sharing: %+v", store.shared)
+	}
+	if !reflect.DeepEqual(store.linked, [][]int{{10, 11}, {20}}) {
+		t.Errorf("invalid linked values: %v", store.linked)
+	}
+	if !reflect.DeepEqual(store.messages, []string{"new invoice"}) {
+		t.Errorf("invalid notifications: %v", store.messages)
+	}
+	if !reflect.DeepEqual(store.trashed, []string{"1234"}) || !doc.DeletedAt.Valid {
+		t.Errorf("document not moved to trash exactly once: %v", store.trashed)
+	}
+}
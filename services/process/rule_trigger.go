@@ -0,0 +1,161 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package process
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"tryffel.net/go/virtualpaper/errors"
+	"tryffel.net/go/virtualpaper/models"
+)
+
+// ErrRuleLoop is returned when rules keep changing the document.
+var ErrRuleLoop = errors.New("rule loop detected")
+
+// RunTriggeredRules runs the rules that have any of the triggers for the document.
+// Changes made by the rules trigger rules with edit and metadata triggers, which are then run again
+// until the document does not change anymore. The chain is stopped with ErrRuleLoop
+// if the document returns to a state it has already been in or if it exceeds models.MaxRulePasses.
+// Returns the number of passes run and the trace of each evaluated rule.
+func RunTriggeredRules(doc *models.Document, rules []*models.Rule, triggers models.RuleTriggers, store MetadataValueStore,
+	actions RuleActionStore) (int, []*models.DocumentRuleTrace, error) {
+	seen := map[string]bool{ruleDocumentState(doc): true}
+	traces := make([]*models.DocumentRuleTrace, 0, len(rules))
+	for pass := 1; ; pass++ {
+		original := *doc
+		original.Metadata = append([]models.Metadata{}, doc.Metadata...)
+
+		logrus.Debugf("run rules for document %s, pass %d, trigger: %s", doc.Id, pass, triggers)
+		passTraces, err := runRulesWithTriggers(doc, rules, triggers, pass, store, actions)
+		traces = append(traces, passTraces...)
+
+		triggers = models.ChangeTriggers(&original, doc)
+		if !rulesHaveTriggers(rules, triggers) {
+			return pass, traces, err
+		}
+		state := ruleDocumentState(doc)
+		if seen[state] {
+			return pass, traces, fmt.Errorf("%w: document returned to a previous state after %d passes", ErrRuleLoop, pass)
+		}
+		if pass >= models.MaxRulePasses {
+			return pass, traces, fmt.Errorf("%w: document still changing after %d passes", ErrRuleLoop, pass)
+		}
+		seen[state] = true
+	}
+}
+
+// runRulesWithTriggers runs each rule that has any of the triggers, until a matching rule stops processing.
+// Returns trace for each rule that has the triggers, and the last error.
+func runRulesWithTriggers(doc *models.Document, rules []*models.Rule, triggers models.RuleTriggers, pass int,
+	store MetadataValueStore, actions RuleActionStore) ([]*models.DocumentRuleTrace, error) {
+	var err error
+	traces := make([]*models.DocumentRuleTrace, 0, len(rules))
+	for i, rule := range rules {
+		if !ruleTriggers(rule).Any(triggers) {
+			continue
+		}
+		logrus.Debugf("(%d.) run user rule %d", i, rule.Id)
+		trace := &models.DocumentRuleTrace{
+			DocumentId: doc.Id,
+			RuleId:     models.IntId(rule.Id),
+			RuleName:   rule.Name,
+			Triggers:   triggers,
+			Pass:       pass,
+			Conditions: models.NewRuleTraceConditions(rule.Conditions),
+			Actions:    models.RuleTraceActions{},
+		}
+		traces = append(traces, trace)
+
+		if len(rule.Actions) == 0 {
+			logrus.Debugf("rule %d does not have actions, skip rule", rule.Id)
+			trace.Error = "rule does not have actions"
+			continue
+		}
+
+		if len(rule.Conditions) == 0 {
+			logrus.Debugf("rule %d does not have conditions, skip rule", rule.Id)
+			trace.Error = "rule does not have conditions"
+			continue
+		}
+
+		runner := NewDocumentRule(doc, rule)
+		runner.SetMetadataStore(store)
+		runner.SetActionStore(actions)
+		runner.SetTrace(trace)
+		match, matchErr := runner.Match()
+		if matchErr != nil {
+			logrus.Errorf("match rule (%d): %v", rule.Id, matchErr)
+			err = matchErr
+		}
+		if !match {
+			logrus.Debugf("document %s does not match rule: %d", doc.Id, rule.Id)
+			continue
+		}
+
+		logrus.Debugf("document %s matches rule %d, run actions", doc.Id, rule.Id)
+		actionErr := runner.RunActions()
+		if actionErr != nil {
+			logrus.Errorf("rule (%d) actions: %v", rule.Id, actionErr)
+			trace.Error = actionErr.Error()
+			err = actionErr
+		}
+		if rule.StopProcessing {
+			logrus.Debugf("rule %d stops processing rules for document %s", rule.Id, doc.Id)
+			trace.Stopped = true
+			break
+		}
+	}
+	return traces, err
+}
+
+// ruleTriggers returns the triggers of the rule. Rule without triggers is run on upload.
+func ruleTriggers(rule *models.Rule) models.RuleTriggers {
+	if len(rule.Triggers) == 0 {
+		return models.RuleTriggers{models.RuleTriggerUpload}
+	}
+	return rule.Triggers
+}
+
+func rulesHaveTriggers(rules []*models.Rule, triggers models.RuleTriggers) bool {
+	for _, v := range rules {
+		if ruleTriggers(v).Any(triggers) {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleDocumentState returns a string that identifies the values of the document that rules can change.
+func ruleDocumentState(doc *models.Document) string {
+	metadata := make([]string, len(doc.Metadata))
+	for i, v := range doc.Metadata {
+		metadata[i] = fmt.Sprintf("%d-%d-%s", v.KeyId, v.ValueId, v.Value)
+	}
+	sort.Strings(metadata)
+	return strings.Join([]string{
+		doc.Name,
+		doc.Description,
+		models.MidnightForDate(doc.Date).String(),
+		doc.Lang.String(),
+		strings.Join(metadata, ","),
+	}, "\n")
+}
@@ -0,0 +1,170 @@
+package process
+
+import (
+	"strconv"
+	"testing"
+
+	"tryffel.net/go/virtualpaper/errors"
+	"tryffel.net/go/virtualpaper/models"
+)
+
+func TestRunTriggeredRules(t *testing.T) {
+	nameRule := func(id int, triggers models.RuleTriggers, name string, action *models.RuleAction) *models.Rule {
+		return &models.Rule{
+			Id:       id,
+			Mode:     models.RuleMatchAll,
+			Triggers: triggers,
+			Conditions: []*models.RuleCondition{
+				{Enabled: true, ConditionType: models.RuleConditionNameIs, Value: name},
+			},
+			Actions: []*models.RuleAction{action},
+		}
+	}
+	setName := func(name string) *models.RuleAction {
+		return &models.RuleAction{Enabled: true, Action: models.RuleActionSetName, Value: name}
+	}
+	upload := models.RuleTriggers{models.RuleTriggerUpload}
+	edit := models.RuleTriggers{models.RuleTriggerEdit}
+
+	renameChain := []*models.Rule{}
+	for i := models.MaxRulePasses + 1; i > 0; i-- {
+		from := strconv.Itoa(i - 1)
+		if i == 1 {
+			from = "scan"
+		}
+		renameChain = append(renameChain, nameRule(i, edit, from, setName(strconv.Itoa(i))))
+	}
+
+	tests := []struct {
+		name       string
+		rules      []*models.Rule
+		triggers   models.RuleTriggers
+		wantName   string
+		wantPasses int
+		wantLoop   bool
+	}{
+		{
+			name:       "no rules for trigger",
+			rules:      []*models.Rule{nameRule(1, edit, "scan", setName("invoice"))},
+			triggers:   upload,
+			wantName:   "scan",
+			wantPasses: 1,
+		},
+		{
+			name:       "rule without triggers runs on upload",
+			rules:      []*models.Rule{nameRule(1, nil, "scan", setName("invoice"))},
+			triggers:   upload,
+			wantName:   "invoice",
+			wantPasses: 1,
+		},
+		{
+			name: "change triggers edit rule",
+			rules: []*models.Rule{
+				nameRule(1, upload, "scan", setName("invoice")),
+				nameRule(2, edit, "invoice", setName("invoice 2023")),
+			},
+			triggers:   upload,
+			wantName:   "invoice 2023",
+			wantPasses: 3,
+		},
+		{
+			name: "document returns to previous state",
+			rules: []*models.Rule{
+				nameRule(1, upload, "scan", setName("invoice")),
+				nameRule(2, edit, "invoice", setName("scan")),
+			},
+			triggers:   upload,
+			wantName:   "scan",
+			wantPasses: 2,
+			wantLoop:   true,
+		},
+		{
+			// each pass renames document once: scan -> 1 -> 2 -> ...
+			name:       "document keeps changing",
+			rules:      renameChain,
+			triggers:   edit,
+			wantName:   "5",
+			wantPasses: models.MaxRulePasses,
+			wantLoop:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := &models.Document{Id: "1234", Name: "scan"}
+			passes, _, err := RunTriggeredRules(doc, tt.rules, tt.triggers, nil, nil)
+			if errors.Is(err, ErrRuleLoop) != tt.wantLoop {
+				t.Errorf("RunTriggeredRules() error = %v, wantLoop %v", err, tt.wantLoop)
+			}
+			if !tt.wantLoop && err != nil {
+				t.Errorf("RunTriggeredRules() error = %v", err)
+			}
+			if passes != tt.wantPasses {
+				t.Errorf("RunTriggeredRules() passes = %d, want %d", passes, tt.wantPasses)
+			}
+			if doc.Name != tt.wantName {
+				t.Errorf("RunTriggeredRules() name = %s, want %s", doc.Name, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestRunTriggeredRules_stopProcessing(t *testing.T) {
+	upload := models.RuleTriggers{models.RuleTriggerUpload}
+	rules := []*models.Rule{
+		{
+			Id: 1, Name: "no match", Mode: models.RuleMatchAll, Triggers: upload,
+			Conditions: []*models.RuleCondition{
+				{Id: 10, Enabled: true, ConditionType: models.RuleConditionNameIs, Value: "receipt"},
+			},
+			Actions: []*models.RuleAction{{Id: 20, Enabled: true, Action: models.RuleActionSetName, Value: "receipt"}},
+		},
+		{
+			Id: 2, Name: "stop", Mode: models.RuleMatchAny, Triggers: upload, StopProcessing: true,
+			Conditions: []*models.RuleCondition{
+				{Id: 11, Enabled: true, ConditionType: models.RuleConditionNameIs, Value: "scan"},
+				{Id: 12, Enabled: true, ConditionType: models.RuleConditionDescriptionIs, Value: "invoice"},
+			},
+			Actions: []*models.RuleAction{{Id: 21, Enabled: true, Action: models.RuleActionSetDescription, Value: "invoice"}},
+		},
+		{
+			Id: 3, Name: "not run", Mode: models.RuleMatchAny, Triggers: upload,
+			Conditions: []*models.RuleCondition{
+				{Id: 13, Enabled: true, ConditionType: models.RuleConditionNameIs, Value: "scan"},
+			},
+			Actions: []*models.RuleAction{{Id: 22, Enabled: true, Action: models.RuleActionSetName, Value: "invoice"}},
+		},
+	}
+
+	doc := &models.Document{Id: "1234", Name: "scan"}
+	passes, traces, err := RunTriggeredRules(doc, rules, upload, nil, nil)
+	if err != nil {
+		t.Fatalf("RunTriggeredRules() error = %v", err)
+	}
+	if passes != 1 {
+		t.Errorf("RunTriggeredRules() passes = %d, want 1", passes)
+	}
+	if doc.Name != "scan" || doc.Description != "invoice" {
+		t.Errorf("RunTriggeredRules() name = %s, description = %s", doc.Name, doc.Description)
+	}
+	if len(traces) != 2 {
+		t.Fatalf("RunTriggeredRules() traces = %d, want 2", len(traces))
+	}
+
+	first, second := traces[0], traces[1]
+	if first.RuleId != 1 || first.Matched || first.Stopped || len(first.Actions) != 0 {
+		t.Errorf("first trace = %+v", first)
+	}
+	if first.Conditions[0].Skipped || first.Conditions[0].Matched {
+		t.Errorf("first trace condition = %+v", first.Conditions[0])
+	}
+	if second.RuleId != 2 || !second.Matched || !second.Stopped || second.Pass != 1 {
+		t.Errorf("second trace = %+v", second)
+	}
+	// match any stops at first matching condition
+	if !second.Conditions[0].Matched || !second.Conditions[1].Skipped {
+		t.Errorf("second trace conditions = %+v", second.Conditions)
+	}
+	if len(second.Actions) != 1 || second.Actions[0].ActionId != 21 || second.Actions[0].Skipped {
+		t.Errorf("second trace actions = %+v", second.Actions)
+	}
+}
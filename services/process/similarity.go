@@ -0,0 +1,200 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package process
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/sirupsen/logrus"
+	"tryffel.net/go/virtualpaper/models"
+	log "tryffel.net/go/virtualpaper/util/logger"
+)
+
+// number of hash functions in minhash signature.
+const minHashSize = 128
+
+// minimum length of term to include in signature. Shorter words are mostly noise.
+const minTermLength = 3
+
+// weights for similarity score components.
+const (
+	similarityContentWeight  = 0.8
+	similarityMetadataWeight = 0.2
+)
+
+// minimum score for document to be considered similar.
+const minSimilarityScore = 0.05
+
+// minHashSeeds are the random coefficients (a, b) for each hash function h(x) = a*x + b.
+var minHashSeeds = generateMinHashSeeds(minHashSize)
+
+// generateMinHashSeeds generates deterministic coefficients with splitmix64 so that
+// signatures stay comparable between restarts.
+func generateMinHashSeeds(size int) [][2]uint64 {
+	seeds := make([][2]uint64, size)
+	state := uint64(0x9e3779b97f4a7c15)
+	next := func() uint64 {
+		state += 0x9e3779b97f4a7c15
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		return z ^ (z >> 31)
+	}
+	for i := range seeds {
+		// a must be odd to make the multiplication a bijection
+		seeds[i] = [2]uint64{next() | 1, next()}
+	}
+	return seeds
+}
+
+// contentTermFrequencies returns normalized terms in text and the number of occurrences of each term.
+func contentTermFrequencies(text string) map[string]int {
+	terms := make(map[string]int)
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, v := range fields {
+		if len([]rune(v)) < minTermLength {
+			continue
+		}
+		terms[v] += 1
+	}
+	return terms
+}
+
+// contentTerms returns unique normalized terms in text.
+func contentTerms(text string) map[string]bool {
+	terms := make(map[string]bool)
+	for term := range contentTermFrequencies(text) {
+		terms[term] = true
+	}
+	return terms
+}
+
+// MinHashSignature computes minhash signature for the terms in text.
+// Returns empty signature if text does not contain any terms.
+func MinHashSignature(text string) []int64 {
+	terms := contentTerms(text)
+	if len(terms) == 0 {
+		return []int64{}
+	}
+
+	signature := make([]uint64, minHashSize)
+	for i := range signature {
+		signature[i] = math.MaxUint64
+	}
+
+	hasher := fnv.New64a()
+	for term := range terms {
+		hasher.Reset()
+		hasher.Write([]byte(term))
+		termHash := hasher.Sum64()
+		for i, seed := range minHashSeeds {
+			value := seed[0]*termHash + seed[1]
+			if value < signature[i] {
+				signature[i] = value
+			}
+		}
+	}
+
+	result := make([]int64, minHashSize)
+	for i, v := range signature {
+		result[i] = int64(v)
+	}
+	return result
+}
+
+// SignatureSimilarity estimates the Jaccard similarity of two documents' terms from their minhash signatures.
+func SignatureSimilarity(a, b []int64) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	equal := 0
+	for i := range a {
+		if a[i] == b[i] {
+			equal += 1
+		}
+	}
+	return float64(equal) / float64(len(a))
+}
+
+// RankSimilarDocuments scores candidates against the document with given signature and metadata count.
+// Returned documents are sorted by score, most similar first. Documents with too low score are excluded.
+func RankSimilarDocuments(signature []int64, metadataCount int, candidates []models.SimilarityCandidate) []models.SimilarDocument {
+	docs := make([]models.SimilarDocument, 0, len(candidates))
+	for _, v := range candidates {
+		contentScore := SignatureSimilarity(signature, v.Signature)
+		metadataScore := 0.0
+		if v.SharedMetadata > 0 {
+			union := metadataCount + v.MetadataCount - v.SharedMetadata
+			metadataScore = float64(v.SharedMetadata) / float64(union)
+		}
+		score := similarityContentWeight*contentScore + similarityMetadataWeight*metadataScore
+		if score < minSimilarityScore {
+			continue
+		}
+		docs = append(docs, models.SimilarDocument{
+			DocumentId:     v.DocumentId,
+			DocumentName:   v.DocumentName,
+			Date:           v.Date,
+			Score:          score,
+			ContentScore:   contentScore,
+			MetadataScore:  metadataScore,
+			SharedMetadata: v.SharedMetadata,
+		})
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		return docs[i].Score > docs[j].Score
+	})
+	return docs
+}
+
+func (fp *fileProcessor) computeSimilarity(ctx context.Context) error {
+	process := &models.ProcessItem{
+		DocumentId: fp.document.Id,
+		Action:     models.ProcessSimilarity,
+		CreatedAt:  time.Now(),
+	}
+	job, err := fp.db.JobStore.StartProcessItem(process, "compute similarity signature")
+	// hotfix for failure when job item does not exist anymore.
+	if err != nil {
+		logrus.Warningf("persist job record: %v", err)
+		// use empty job to not panic the rest of the function
+		job = &models.Job{}
+	} else {
+		defer fp.completeProcessingStep(process, job)
+	}
+
+	signature := MinHashSignature(fp.document.Content)
+	log.Context(ctx).WithField("documentId", fp.document.Id).Debugf("computed similarity signature, empty: %t", len(signature) == 0)
+
+	err = fp.db.DocumentStore.SetSimilaritySignature(fp.document.UserId, fp.document.Id, signature)
+	if err != nil {
+		job.Status = models.JobFailure
+		return err
+	}
+	job.Status = models.JobFinished
+	return nil
+}
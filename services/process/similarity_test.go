@@ -0,0 +1,90 @@
+package process
+
+import (
+	"reflect"
+	"testing"
+
+	"tryffel.net/go/virtualpaper/models"
+)
+
+func TestMinHashSignature(t *testing.T) {
+	contract := "This rental contract is made between the landlord and the tenant for the apartment in Helsinki"
+	contractCopy := "THIS RENTAL CONTRACT is made between the landlord, and the tenant: for the apartment in Helsinki!"
+	letter := "Regarding the rental contract of the apartment in Helsinki, the landlord asks the tenant to pay rent"
+	recipe := "Mix flour, sugar and butter. Bake in oven for twenty minutes until golden brown"
+
+	if got := MinHashSignature("a an of"); len(got) != 0 {
+		t.Errorf("expected empty signature for text without terms, got %d items", len(got))
+	}
+
+	sigContract := MinHashSignature(contract)
+	if len(sigContract) != minHashSize {
+		t.Fatalf("expected signature size %d, got %d", minHashSize, len(sigContract))
+	}
+
+	if !reflect.DeepEqual(sigContract, MinHashSignature(contract)) {
+		t.Errorf("signature is not deterministic")
+	}
+
+	if got := SignatureSimilarity(sigContract, MinHashSignature(contractCopy)); got != 1 {
+		t.Errorf("expected identical terms to have similarity 1, got %f", got)
+	}
+
+	related := SignatureSimilarity(sigContract, MinHashSignature(letter))
+	unrelated := SignatureSimilarity(sigContract, MinHashSignature(recipe))
+	if related <= unrelated {
+		t.Errorf("expected related documents to be more similar than unrelated: %f <= %f", related, unrelated)
+	}
+	if unrelated > 0.2 {
+		t.Errorf("expected unrelated documents to have low similarity, got %f", unrelated)
+	}
+}
+
+func TestSignatureSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a    []int64
+		b    []int64
+		want float64
+	}{
+		{"empty", []int64{}, []int64{}, 0},
+		{"missing signature", []int64{1, 2}, nil, 0},
+		{"different length", []int64{1, 2}, []int64{1, 2, 3}, 0},
+		{"half", []int64{1, 2, 3, 4}, []int64{1, 2, 5, 6}, 0.5},
+		{"equal", []int64{1, 2, 3, 4}, []int64{1, 2, 3, 4}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SignatureSimilarity(tt.a, tt.b); got != tt.want {
+				t.Errorf("SignatureSimilarity() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRankSimilarDocuments(t *testing.T) {
+	signature := []int64{1, 2, 3, 4}
+	candidates := []models.SimilarityCandidate{
+		{DocumentId: "unrelated", Signature: []int64{5, 6, 7, 8}, MetadataCount: 2},
+		{DocumentId: "metadata", Signature: nil, MetadataCount: 2, SharedMetadata: 2},
+		{DocumentId: "content", Signature: []int64{1, 2, 3, 9}, MetadataCount: 0},
+		{DocumentId: "both", Signature: []int64{1, 2, 3, 4}, MetadataCount: 3, SharedMetadata: 1},
+	}
+
+	got := RankSimilarDocuments(signature, 2, candidates)
+	ids := make([]string, len(got))
+	for i, v := range got {
+		ids[i] = v.DocumentId
+	}
+	want := []string{"both", "content", "metadata"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Errorf("RankSimilarDocuments() = %v, want %v", ids, want)
+	}
+
+	if got[0].ContentScore != 1 || got[0].MetadataScore != 0.25 || got[0].SharedMetadata != 1 {
+		t.Errorf("unexpected scores for document: %+v", got[0])
+	}
+	if got[2].MetadataScore != 1 || got[2].ContentScore != 0 {
+		t.Errorf("unexpected scores for document: %+v", got[2])
+	}
+}
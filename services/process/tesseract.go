@@ -36,7 +36,8 @@ import (
 	"tryffel.net/go/virtualpaper/storage"
 )
 
-func runOcr(ctx context.Context, inputImage, id string) (string, error) {
+// runOcr extracts text from each page of the input file with tesseract and returns the text and the number of pages.
+func runOcr(ctx context.Context, inputImage, id string) (string, int, error) {
 
 	var err error
 	var text string
@@ -44,7 +45,7 @@ func runOcr(ctx context.Context, inputImage, id string) (string, error) {
 	dir := storage.TempFilePath(id)
 	err = os.Mkdir(dir, os.ModePerm|os.ModeDir)
 	if err != nil {
-		return text, fmt.Errorf("create tmp dir: %v", err)
+		return text, 0, fmt.Errorf("create tmp dir: %v", err)
 	}
 	defer os.RemoveAll(dir)
 
@@ -54,7 +55,7 @@ func runOcr(ctx context.Context, inputImage, id string) (string, error) {
 	imageFile := path.Join(dir, "preview.png")
 	err = generatePicture(ctx, inputImage, imageFile)
 	if err != nil {
-		return text, fmt.Errorf("generate pictures from pdf pages: %v", err)
+		return text, 0, fmt.Errorf("generate pictures from pdf pages: %v", err)
 	}
 
 	pages := &[]string{}
@@ -104,7 +105,7 @@ func runOcr(ctx context.Context, inputImage, id string) (string, error) {
 	err = filepath.Walk(dir, walkFunc)
 
 	if err != nil {
-		return text, fmt.Errorf("ocr file: %v", err)
+		return text, 0, fmt.Errorf("ocr file: %v", err)
 	}
 
 	content := ""
@@ -114,7 +115,7 @@ func runOcr(ctx context.Context, inputImage, id string) (string, error) {
 		}
 		content += v
 	}
-	return content, err
+	return content, len(*pages), err
 }
 
 func GetTesseractVersion() string {
@@ -4,6 +4,7 @@
 package process
 
 import (
+	"context"
 	"os"
 	"path"
 	"strings"
@@ -30,7 +31,7 @@ func Test_runOcr(t *testing.T) {
 	inputDir := "e2e/test_data"
 
 	t.Log("Extract contents from JPG")
-	text, err := runOcr(path.Join(wd, inputDir, "jpg-1.jpg"), "test")
+	text, _, err := runOcr(context.Background(), path.Join(wd, inputDir, "jpg-1.jpg"), "test")
 	if err != nil {
 		t.Errorf("run ocr for jpg: %v", err)
 	}
@@ -39,7 +40,7 @@ func Test_runOcr(t *testing.T) {
 	}
 
 	t.Log("Extract contents from PNG")
-	text, err = runOcr(path.Join(wd, inputDir, "png-1.png"), "test")
+	text, _, err = runOcr(context.Background(), path.Join(wd, inputDir, "png-1.png"), "test")
 	if err != nil {
 		t.Errorf("run ocr for png: %v", err)
 	}
@@ -48,7 +49,7 @@ func Test_runOcr(t *testing.T) {
 	}
 
 	t.Log("Extract contents from PDF")
-	text, err = runOcr(path.Join(wd, inputDir, "pdf-1.pdf"), "test")
+	text, _, err = runOcr(context.Background(), path.Join(wd, inputDir, "pdf-1.pdf"), "test")
 	if err != nil {
 		t.Errorf("run ocr for pdf: %v", err)
 	}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"github.com/sirupsen/logrus"
+	"strconv"
 	"strings"
 	"time"
 	"tryffel.net/go/virtualpaper/errors"
@@ -25,6 +26,8 @@ func (d *DocumentRule) MatchTest() *RuleTestResult {
 	}
 
 	hasMatch := false
+	d.testing = true
+	defer func() { d.testing = false }()
 
 	result := &RuleTestResult{
 		StartedAt:       int(time.Now().UnixNano() / 1000000),
@@ -63,38 +66,7 @@ func (d *DocumentRule) MatchTest() *RuleTestResult {
 		} else {
 			result.Conditions[i].Skipped = false
 			logger.Infof("evaluate condition %d (id:%d), type: '%s'", condition.Id, i+1, condition.ConditionType)
-			condText := string(condition.ConditionType)
-			var ok = false
-			var err error
-			if strings.HasPrefix(condText, "name") {
-				ok, err = d.matchText(condition, d.Document.Name)
-			} else if strings.HasPrefix(condText, "description") {
-				ok, err = d.matchText(condition, d.Document.Description)
-			} else if strings.HasPrefix(condText, "content") {
-				ok, err = d.matchText(condition, d.Document.Content)
-			} else if strings.HasPrefix(condText, "metadata_has_key") {
-				ok = d.hasMetadataKey(condition)
-			} else if strings.HasPrefix(condText, "date") {
-				ok, err = d.extractDates(condition, time.Now(), logger)
-
-				if ok {
-					y, m, d := d.date.Date()
-					logger.Infof("found date %d-%d-%d", y, m, d)
-					logConditionOut("found date %d-%d-%d", y, m, d)
-				}
-
-			} else if strings.HasPrefix(condText, "metadata_count") {
-				ok, err = d.hasMetadataCount(condition)
-			} else if condition.ConditionType == models.RuleConditionMetadataHasKey {
-				ok = d.hasMetadataKey(condition)
-			} else if condition.ConditionType == models.RuleConditionMetadataHasKeyValue {
-				ok = d.hasMetadataKeyValue(condition)
-			} else {
-				err := errors.ErrInternalError
-				err.ErrMsg = "unknown condition type: " + condText
-				result.Error = err.Error()
-				break
-			}
+			ok, err := d.testCondition(condition, strconv.Itoa(i+1), &result.Conditions[i], logger, logConditionOut)
 			if err != nil {
 				e := errors.ErrInternalError
 				e.ErrMsg = fmt.Errorf("evaluate condition: %v", err).Error()
@@ -162,3 +134,75 @@ func (d *DocumentRule) MatchTest() *RuleTestResult {
 	result.Log = logBuf.String()
 	return result
 }
+
+// testCondition evaluates condition in test mode and explains the result. Nested conditions of a group are
+// evaluated recursively and their results are stored in result.Children.
+func (d *DocumentRule) testCondition(condition *models.RuleCondition, position string, result *RuleTestConditionResult,
+	logger *logrus.Logger, logOut logFunc) (bool, error) {
+	if !condition.IsGroup() {
+		if value := d.conditionDocumentValue(condition); value != "" {
+			logger.Info(value)
+			logOut(value)
+		}
+		ok, err := d.matchCondition(condition, logger)
+		if ok && strings.HasPrefix(string(condition.ConditionType), "date") {
+			date := d.date
+			if condition.ConditionType == models.RuleConditionDateDetect {
+				role, _ := models.ParseRuleDateRole(condition.Value)
+				date = d.dates[role]
+			}
+			y, m, day := date.Date()
+			logger.Infof("found date %d-%d-%d", y, m, day)
+			logOut("found date %d-%d-%d", y, m, day)
+		}
+		return ok, err
+	}
+
+	logger.Infof("evaluate group %s with %d conditions, mode: '%s'", position, len(condition.Children), condition.Mode.String())
+	logOut("group %s: mode is set to '%s'", position, condition.Mode.String())
+	result.Children = make([]RuleTestConditionResult, len(condition.Children))
+	for i, v := range condition.Children {
+		result.Children[i].ConditionId = v.Id
+		result.Children[i].ConditionType = v.ConditionType.String()
+		result.Children[i].Skipped = true
+	}
+
+	hasMatch := false
+	for i, child := range condition.Children {
+		childPosition := fmt.Sprintf("%s.%d", position, i+1)
+		childResult := &result.Children[i]
+		if !child.Enabled {
+			logOut("condition %s disabled", childPosition)
+			continue
+		}
+		childResult.Skipped = false
+		ok, err := d.testCondition(child, childPosition, childResult, logger, logOut)
+		if err != nil {
+			return false, err
+		}
+		if child.Inverted {
+			logOut("condition %s: invert condition matched: %t -> %t", childPosition, ok, !ok)
+			ok = !ok
+		}
+		childResult.Matched = ok
+
+		if ok {
+			hasMatch = true
+			logOut("condition %s matched", childPosition)
+			if condition.Mode == models.RuleMatchAny {
+				logOut("group %s mode is set to 'match any', skip rest conditions", position)
+				break
+			}
+		} else {
+			logOut("condition %s didn't match", childPosition)
+			if condition.Mode == models.RuleMatchAll {
+				logOut("group %s mode is set to 'match all', skip rest conditions", position)
+				hasMatch = false
+				break
+			}
+		}
+	}
+	logger.Infof("group %s matched: %t", position, hasMatch)
+	logOut("group %s matched: %t", position, hasMatch)
+	return hasMatch, nil
+}
@@ -68,9 +68,13 @@ func DeleteDocument(docId string) error {
 // RequiredProcessingSteps returns list of steps that are required to be execute after a given step.
 func RequiredProcessingSteps(startingStep models.ProcessStep) []models.ProcessStep {
 	switch startingStep {
-	case models.ProcessHash, models.ProcessThumbnail, models.ProcessFts:
+	case models.ProcessHash, models.ProcessFts, models.ProcessSimilarity, models.ProcessDuplicates, models.ProcessSuggestMetadata:
 		return []models.ProcessStep{}
-	case models.ProcessParseContent, models.ProcessRules, models.ProcessDetectLanguage:
+	case models.ProcessThumbnail:
+		return []models.ProcessStep{models.ProcessDuplicates}
+	case models.ProcessParseContent:
+		return []models.ProcessStep{models.ProcessExtractFields, models.ProcessFts, models.ProcessSimilarity, models.ProcessDuplicates, models.ProcessSuggestMetadata}
+	case models.ProcessRules, models.ProcessDetectLanguage, models.ProcessExtractFields:
 		return []models.ProcessStep{models.ProcessFts}
 	}
 	return []models.ProcessStep{}
@@ -0,0 +1,257 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"tryffel.net/go/virtualpaper/errors"
+	"tryffel.net/go/virtualpaper/models"
+	"tryffel.net/go/virtualpaper/services/process"
+	"tryffel.net/go/virtualpaper/storage"
+	"tryffel.net/go/virtualpaper/util/logger"
+)
+
+// number of documents to read and process at once when applying rule.
+const ruleApplyBatchSize = 100
+
+// RuleApplyDocument is a document that rule changes.
+type RuleApplyDocument struct {
+	DocumentId string               `json:"document_id"`
+	Name       string               `json:"name"`
+	Changes    []process.RuleChange `json:"changes"`
+}
+
+// RuleApplyPreview lists the documents that would change when rule is applied.
+type RuleApplyPreview struct {
+	RuleId int    `json:"rule_id"`
+	Query  string `json:"query"`
+	// Documents is the number of documents in scope.
+	Documents int                 `json:"documents"`
+	Matched   int                 `json:"matched"`
+	Changed   []RuleApplyDocument `json:"changed"`
+}
+
+// RuleApplyStatus is the status of applying rule to existing documents.
+type RuleApplyStatus struct {
+	RuleId     int       `json:"rule_id"`
+	Query      string    `json:"query"`
+	Running    bool      `json:"running"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Total      int       `json:"total"`
+	Processed  int       `json:"processed"`
+	Matched    int       `json:"matched"`
+	Changed    int       `json:"changed"`
+	Failed     int       `json:"failed"`
+	Error      string    `json:"error"`
+}
+
+// PreviewApplyRule runs rule against user's documents without saving anything and returns the documents that rule
+// would change. If query is not empty, only documents that match the search query are included.
+func (service *RuleService) PreviewApplyRule(ctx context.Context, userId, ruleId int, query string) (*RuleApplyPreview, error) {
+	rule, err := service.db.RuleStore.GetUserRule(userId, ruleId)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := service.ruleApplyScope(userId, query)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &RuleApplyPreview{
+		RuleId:    ruleId,
+		Query:     query,
+		Documents: len(ids),
+		Changed:   []RuleApplyDocument{},
+	}
+	err = service.forRuleApplyDocuments(userId, ids, func(doc *models.Document) error {
+		updated, match, err := process.ApplyRule(doc, rule, service.db.MetadataStore, nil, true)
+		if err != nil {
+			return fmt.Errorf("document %s: %v", doc.Id, err)
+		}
+		if !match {
+			return nil
+		}
+		preview.Matched += 1
+		changes, err := process.RuleChanges(doc, updated, rule)
+		if err != nil {
+			return err
+		}
+		if len(changes) > 0 {
+			preview.Changed = append(preview.Changed, RuleApplyDocument{DocumentId: doc.Id, Name: doc.Name, Changes: changes})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.Context(ctx).WithField("user", userId).WithField("rule", ruleId).
+		Infof("Preview applying rule: %d documents, %d matched, %d changed", preview.Documents, preview.Matched, len(preview.Changed))
+	return preview, nil
+}
+
+// StartApplyRule applies rule to user's existing documents in background. If query is not empty,
+// only documents that match the search query are included. Changes are recorded in document history
+// with the rule as the actor. Only one apply job per rule can run at a time.
+func (service *RuleService) StartApplyRule(ctx context.Context, userId, ruleId int, query string) (*RuleApplyStatus, error) {
+	rule, err := service.db.RuleStore.GetUserRule(userId, ruleId)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := service.ruleApplyScope(userId, query)
+	if err != nil {
+		return nil, err
+	}
+
+	service.applyLock.Lock()
+	defer service.applyLock.Unlock()
+	if status, ok := service.applyStatus[ruleId]; ok && status.Running {
+		e := errors.ErrAlreadyExists
+		e.ErrMsg = "rule is already being applied"
+		return nil, e
+	}
+
+	status := &RuleApplyStatus{
+		RuleId:    ruleId,
+		Query:     query,
+		Running:   true,
+		StartedAt: time.Now(),
+		Total:     len(ids),
+	}
+	service.applyStatus[ruleId] = status
+	logger.Context(ctx).WithField("user", userId).WithField("rule", ruleId).
+		Infof("Start applying rule to %d documents", len(ids))
+
+	go service.applyRule(userId, rule, ids, status)
+	copied := *status
+	return &copied, nil
+}
+
+// GetApplyRuleStatus returns the status of the latest apply job of the rule.
+func (service *RuleService) GetApplyRuleStatus(ctx context.Context, userId, ruleId int) (*RuleApplyStatus, error) {
+	service.applyLock.Lock()
+	defer service.applyLock.Unlock()
+	status, ok := service.applyStatus[ruleId]
+	if !ok {
+		e := errors.ErrRecordNotFound
+		e.ErrMsg = "rule has not been applied"
+		return nil, e
+	}
+	copied := *status
+	return &copied, nil
+}
+
+func (service *RuleService) applyRule(userId int, rule *models.Rule, ids []string, status *RuleApplyStatus) {
+	changedIds := make([]string, 0)
+	err := service.forRuleApplyDocuments(userId, ids, func(doc *models.Document) error {
+		changed, match, err := service.applyRuleToDocument(rule, doc)
+		service.applyLock.Lock()
+		defer service.applyLock.Unlock()
+		status.Processed += 1
+		if err != nil {
+			logrus.Errorf("apply rule %d to document %s: %v", rule.Id, doc.Id, err)
+			status.Failed += 1
+			return nil
+		}
+		if match {
+			status.Matched += 1
+		}
+		if changed {
+			status.Changed += 1
+			changedIds = append(changedIds, doc.Id)
+		}
+		return nil
+	})
+
+	if err == nil && len(changedIds) > 0 {
+		// need to reindex
+		err = service.db.JobStore.AddDocuments(service.db, userId, changedIds, []models.ProcessStep{models.ProcessFts})
+		if errors.Is(err, errors.ErrAlreadyExists) {
+			err = nil
+		}
+		service.process.PullDocumentsToProcess()
+	}
+
+	service.applyLock.Lock()
+	defer service.applyLock.Unlock()
+	status.Running = false
+	status.FinishedAt = time.Now()
+	if err != nil {
+		logrus.Errorf("apply rule %d: %v", rule.Id, err)
+		status.Error = err.Error()
+	}
+	logrus.Infof("applied rule %d to %d documents: %d matched, %d changed, %d failed",
+		rule.Id, status.Processed, status.Matched, status.Changed, status.Failed)
+}
+
+// applyRuleToDocument runs the rule for the document and saves the changes.
+func (service *RuleService) applyRuleToDocument(rule *models.Rule, doc *models.Document) (changed bool, match bool, err error) {
+	updated, match, err := process.ApplyRule(doc, rule, service.db.MetadataStore, process.NewRuleActionStore(service.db), false)
+	if err != nil || !match {
+		return false, match, err
+	}
+
+	tx, err := storage.NewTx(service.db, context.Background())
+	if err != nil {
+		return false, match, err
+	}
+	defer tx.Close()
+	history, err := service.db.DocumentStore.UpdateByRule(tx, rule.Id, updated)
+	if err != nil {
+		return false, match, err
+	}
+	return len(history) > 0, match, tx.Commit()
+}
+
+// ruleApplyScope returns the ids of user's documents that rule is applied to.
+func (service *RuleService) ruleApplyScope(userId int, query string) ([]string, error) {
+	if query == "" {
+		return service.db.DocumentStore.GetUserDocumentIds(userId, nil)
+	}
+
+	ids := make([]string, 0)
+	for offset := 0; ; offset += ruleApplyBatchSize {
+		docs, _, err := service.search.SearchDocuments(userId, query, storage.SortKey{}, storage.Paging{Offset: offset, Limit: ruleApplyBatchSize})
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range docs {
+			ids = append(ids, v.Id)
+		}
+		if len(docs) < ruleApplyBatchSize {
+			break
+		}
+	}
+	// search includes documents shared to user
+	return service.db.DocumentStore.GetUserDocumentIds(userId, ids)
+}
+
+// forRuleApplyDocuments reads documents with their metadata in batches and calls handle for each of them.
+func (service *RuleService) forRuleApplyDocuments(userId int, ids []string, handle func(doc *models.Document) error) error {
+	for start := 0; start < len(ids); start += ruleApplyBatchSize {
+		end := start + ruleApplyBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		docs, err := service.db.DocumentStore.GetDocumentsById(service.db, userId, ids[start:end])
+		if err != nil {
+			return fmt.Errorf("get documents: %v", err)
+		}
+		for i := range *docs {
+			doc := &(*docs)[i]
+			metadata, err := service.db.MetadataStore.GetDocumentMetadata(userId, doc.Id)
+			if err != nil {
+				return fmt.Errorf("get document metadata: %v", err)
+			}
+			doc.Metadata = *metadata
+			err = handle(doc)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,496 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"tryffel.net/go/virtualpaper/config"
+	"tryffel.net/go/virtualpaper/errors"
+	"tryffel.net/go/virtualpaper/models"
+	"tryffel.net/go/virtualpaper/storage"
+	"tryffel.net/go/virtualpaper/util/logger"
+)
+
+// RuleExportVersion is the version of the rule export format.
+const RuleExportVersion = 1
+
+const (
+	RuleExportFormatJson = "json"
+	RuleExportFormatYaml = "yaml"
+)
+
+// RuleExport contains user's rules in a format that can be imported to another user or instance.
+// Metadata keys, values and document types are referenced by their names instead of ids.
+// Share actions still reference users by their id.
+type RuleExport struct {
+	Version int                `json:"version" yaml:"version"`
+	Rules   []RuleExportedRule `json:"rules" yaml:"rules"`
+}
+
+type RuleExportedRule struct {
+	Name        string   `json:"name" yaml:"name"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+	Enabled     bool     `json:"enabled" yaml:"enabled"`
+	Mode        string   `json:"mode" yaml:"mode"`
+	Triggers    []string `json:"triggers,omitempty" yaml:"triggers,omitempty"`
+	Schedule    string   `json:"schedule,omitempty" yaml:"schedule,omitempty"`
+
+	StopProcessing bool                    `json:"stop_processing,omitempty" yaml:"stop_processing,omitempty"`
+	Conditions     []RuleExportedCondition `json:"conditions" yaml:"conditions"`
+	Actions        []RuleExportedAction    `json:"actions" yaml:"actions"`
+}
+
+type RuleExportedCondition struct {
+	Type            string `json:"type" yaml:"type"`
+	Enabled         bool   `json:"enabled" yaml:"enabled"`
+	CaseInsensitive bool   `json:"case_insensitive,omitempty" yaml:"case_insensitive,omitempty"`
+	Inverted        bool   `json:"inverted,omitempty" yaml:"inverted,omitempty"`
+	IsRegex         bool   `json:"is_regex,omitempty" yaml:"is_regex,omitempty"`
+	Value           string `json:"value,omitempty" yaml:"value,omitempty"`
+	DateFmt         string `json:"date_fmt,omitempty" yaml:"date_fmt,omitempty"`
+	MetadataKey     string `json:"metadata_key,omitempty" yaml:"metadata_key,omitempty"`
+	MetadataValue   string `json:"metadata_value,omitempty" yaml:"metadata_value,omitempty"`
+	// Mode and Conditions are set for groups.
+	Mode       string                  `json:"mode,omitempty" yaml:"mode,omitempty"`
+	Conditions []RuleExportedCondition `json:"conditions,omitempty" yaml:"conditions,omitempty"`
+}
+
+type RuleExportedAction struct {
+	Type          string `json:"type" yaml:"type"`
+	Enabled       bool   `json:"enabled" yaml:"enabled"`
+	OnCondition   bool   `json:"on_condition" yaml:"on_condition"`
+	Value         string `json:"value,omitempty" yaml:"value,omitempty"`
+	MetadataKey   string `json:"metadata_key,omitempty" yaml:"metadata_key,omitempty"`
+	MetadataValue string `json:"metadata_value,omitempty" yaml:"metadata_value,omitempty"`
+	// DocumentType is the name of the document type to set. Value is empty.
+	DocumentType string `json:"document_type,omitempty" yaml:"document_type,omitempty"`
+}
+
+// RuleImportConflict defines what to do when imported rule has the same name as an existing rule.
+type RuleImportConflict string
+
+const (
+	// RuleImportSkip keeps the existing rule and does not import the rule.
+	RuleImportSkip RuleImportConflict = "skip"
+	// RuleImportReplace replaces the contents of the existing rule.
+	RuleImportReplace RuleImportConflict = "replace"
+	// RuleImportDuplicate imports the rule as a new rule.
+	RuleImportDuplicate RuleImportConflict = "duplicate"
+)
+
+func (r RuleImportConflict) Validate() error {
+	switch r {
+	case RuleImportSkip, RuleImportReplace, RuleImportDuplicate:
+		return nil
+	}
+	e := errors.ErrInvalid
+	e.ErrMsg = "conflict mode must be one of: skip, replace, duplicate"
+	return e
+}
+
+// RuleImportResult is the result of importing a single rule.
+type RuleImportResult struct {
+	Name   string `json:"name"`
+	RuleId int    `json:"rule_id"`
+	// Status is one of 'created', 'replaced', 'skipped'.
+	Status string `json:"status"`
+}
+
+type RuleImportStatus struct {
+	Created       int                `json:"created"`
+	Replaced      int                `json:"replaced"`
+	Skipped       int                `json:"skipped"`
+	CreatedKeys   int                `json:"created_keys"`
+	CreatedValues int                `json:"created_values"`
+	CreatedTypes  int                `json:"created_document_types"`
+	Rules         []RuleImportResult `json:"rules"`
+}
+
+// MarshalRuleExport serializes the export in given format.
+func MarshalRuleExport(export *RuleExport, format string) ([]byte, error) {
+	switch format {
+	case RuleExportFormatJson:
+		return json.MarshalIndent(export, "", "  ")
+	case RuleExportFormatYaml:
+		return yaml.Marshal(export)
+	}
+	return nil, invalidRuleExportFormat()
+}
+
+// UnmarshalRuleExport parses the export in given format.
+func UnmarshalRuleExport(data []byte, format string) (*RuleExport, error) {
+	export := &RuleExport{}
+	var err error
+	switch format {
+	case RuleExportFormatJson:
+		err = json.Unmarshal(data, export)
+	case RuleExportFormatYaml:
+		err = yaml.Unmarshal(data, export)
+	default:
+		return nil, invalidRuleExportFormat()
+	}
+	if err != nil {
+		e := errors.ErrInvalid
+		e.ErrMsg = fmt.Sprintf("invalid %s: %v", format, err)
+		e.Err = err
+		return nil, e
+	}
+	if export.Version != RuleExportVersion {
+		e := errors.ErrInvalid
+		e.ErrMsg = fmt.Sprintf("unsupported export version %d", export.Version)
+		return nil, e
+	}
+	return export, nil
+}
+
+func invalidRuleExportFormat() error {
+	e := errors.ErrInvalid
+	e.ErrMsg = "format must be either json or yaml"
+	return e
+}
+
+// ExportRules exports all rules of the user in rule order.
+func (service *RuleService) ExportRules(ctx context.Context, userId int) (*RuleExport, error) {
+	rules, _, err := service.db.RuleStore.GetUserRules(userId, storage.Paging{Offset: 0, Limit: config.MaxRows})
+	if err != nil {
+		return nil, err
+	}
+	docTypes, _, err := service.db.MetadataStore.GetDocumentTypes(userId, storage.SortKey{}, storage.Paging{Offset: 0, Limit: config.MaxRows})
+	if err != nil {
+		return nil, err
+	}
+	typeNames := make(map[int]string, len(docTypes))
+	for _, v := range docTypes {
+		typeNames[v.Id] = v.Name
+	}
+	export := &RuleExport{
+		Version: RuleExportVersion,
+		Rules:   make([]RuleExportedRule, len(rules)),
+	}
+	for i, v := range rules {
+		export.Rules[i] = exportRule(v, typeNames)
+	}
+	return export, nil
+}
+
+func exportRule(rule *models.Rule, typeNames map[int]string) RuleExportedRule {
+	exported := RuleExportedRule{
+		Name:        rule.Name,
+		Description: rule.Description,
+		Enabled:     rule.Enabled,
+		Mode:        rule.Mode.String(),
+		Schedule:    rule.Schedule,
+
+		StopProcessing: rule.StopProcessing,
+		Conditions:     exportConditions(rule.Conditions),
+		Actions:        make([]RuleExportedAction, len(rule.Actions)),
+	}
+	for _, v := range rule.Triggers {
+		exported.Triggers = append(exported.Triggers, v.String())
+	}
+	for i, v := range rule.Actions {
+		exported.Actions[i] = RuleExportedAction{
+			Type:          v.Action.String(),
+			Enabled:       v.Enabled,
+			OnCondition:   v.OnCondition,
+			Value:         v.Value,
+			MetadataKey:   v.MetadataKeyName.String(),
+			MetadataValue: v.MetadataValueName.String(),
+		}
+		if v.Action == models.RuleActionSetDocumentType {
+			if typeId, err := v.DocumentTypeId(); err == nil {
+				exported.Actions[i].Value = ""
+				exported.Actions[i].DocumentType = typeNames[typeId]
+			}
+		}
+	}
+	return exported
+}
+
+func exportConditions(conditions []*models.RuleCondition) []RuleExportedCondition {
+	exported := make([]RuleExportedCondition, len(conditions))
+	for i, v := range conditions {
+		exported[i] = RuleExportedCondition{
+			Type:            v.ConditionType.String(),
+			Enabled:         v.Enabled,
+			CaseInsensitive: v.CaseInsensitive,
+			Inverted:        v.Inverted,
+			IsRegex:         v.IsRegex,
+			Value:           v.Value,
+			DateFmt:         v.DateFmt,
+			MetadataKey:     v.MetadataKeyName.String(),
+			MetadataValue:   v.MetadataValueName.String(),
+		}
+		if v.IsGroup() {
+			exported[i].Mode = v.Mode.String()
+			exported[i].Conditions = exportConditions(v.Children)
+		}
+	}
+	return exported
+}
+
+// ImportRules imports the rules for the user. Metadata keys and values that do not exist yet are created.
+// Rules are matched to the existing rules by name, and conflict defines how to handle existing rules.
+// Rules are imported in a single transaction, either all or none of them are saved.
+func (service *RuleService) ImportRules(ctx context.Context, userId int, export *RuleExport, conflict RuleImportConflict) (*RuleImportStatus, error) {
+	err := conflict.Validate()
+	if err != nil {
+		return nil, err
+	}
+	existingRules, _, err := service.db.RuleStore.GetUserRules(userId, storage.Paging{Offset: 0, Limit: config.MaxRows})
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]*models.Rule, len(existingRules))
+	for _, v := range existingRules {
+		existing[v.Name] = v
+	}
+
+	tx, err := storage.NewTx(service.db, ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Close()
+
+	docTypes, _, err := service.db.MetadataStore.GetDocumentTypes(userId, storage.SortKey{}, storage.Paging{Offset: 0, Limit: config.MaxRows})
+	if err != nil {
+		return nil, err
+	}
+
+	status := &RuleImportStatus{Rules: make([]RuleImportResult, 0, len(export.Rules))}
+	resolver := &ruleMetadataResolver{db: service.db, exec: tx, userId: userId, keys: map[string]int{}, values: map[string]int{},
+		types: make(map[string]int, len(docTypes))}
+	for _, v := range docTypes {
+		resolver.types[v.Name] = v.Id
+	}
+
+	rules := make([]*models.Rule, len(export.Rules))
+	for i, v := range export.Rules {
+		rules[i], err = resolver.importRule(v)
+		if err != nil {
+			if e, ok := err.(errors.Error); ok {
+				e.ErrMsg = fmt.Sprintf("rule %d (%s): %s", i+1, v.Name, e.ErrMsg)
+				return nil, e
+			}
+			return nil, fmt.Errorf("rule %d (%s): %v", i+1, v.Name, err)
+		}
+	}
+	status.CreatedKeys = resolver.createdKeys
+	status.CreatedValues = resolver.createdValues
+	status.CreatedTypes = resolver.createdTypes
+
+	for i, rule := range rules {
+		rule.UserId = userId
+		result := RuleImportResult{Name: rule.Name}
+		old := existing[rule.Name]
+		if old != nil && conflict == RuleImportSkip {
+			result.RuleId = old.Id
+			result.Status = "skipped"
+			status.Skipped += 1
+		} else if old != nil && conflict == RuleImportReplace {
+			rule.Id = old.Id
+			rule.Order = old.Order
+			err = service.db.RuleStore.UpdateRule(tx, userId, rule)
+			result.RuleId = rule.Id
+			result.Status = "replaced"
+			status.Replaced += 1
+		} else {
+			err = service.db.RuleStore.AddRule(tx, userId, rule)
+			result.RuleId = rule.Id
+			result.Status = "created"
+			status.Created += 1
+		}
+		if err != nil {
+			if e, ok := err.(errors.Error); ok {
+				e.ErrMsg = fmt.Sprintf("rule %d (%s): %s", i+1, rule.Name, e.ErrMsg)
+				return nil, e
+			}
+			return nil, fmt.Errorf("rule %d (%s): %v", i+1, rule.Name, err)
+		}
+		status.Rules = append(status.Rules, result)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	logger.Context(ctx).Infof("Imported rules for user %d: created %d, replaced %d, skipped %d",
+		userId, status.Created, status.Replaced, status.Skipped)
+	return status, nil
+}
+
+// ruleMetadataResolver maps metadata and document type names to ids, creating the ones that do not exist within exec.
+type ruleMetadataResolver struct {
+	db            *storage.Database
+	exec          storage.SqlExecer
+	userId        int
+	keys          map[string]int
+	values        map[string]int
+	types         map[string]int
+	createdKeys   int
+	createdValues int
+	createdTypes  int
+}
+
+func (r *ruleMetadataResolver) importRule(exported RuleExportedRule) (*models.Rule, error) {
+	rule := &models.Rule{
+		Name:        exported.Name,
+		Description: exported.Description,
+		Enabled:     exported.Enabled,
+		Schedule:    exported.Schedule,
+
+		StopProcessing: exported.StopProcessing,
+		Actions:        make([]*models.RuleAction, len(exported.Actions)),
+	}
+	if strings.TrimSpace(rule.Name) == "" {
+		e := errors.ErrInvalid
+		e.ErrMsg = "rule must have a name"
+		return nil, e
+	}
+	err := rule.Mode.FromString(exported.Mode)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range exported.Triggers {
+		rule.Triggers = rule.Triggers.Add(models.RuleTrigger(v))
+	}
+	rule.Conditions, err = r.importConditions(exported.Conditions)
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range exported.Actions {
+		action := &models.RuleAction{
+			Enabled:     v.Enabled,
+			OnCondition: v.OnCondition,
+			Action:      models.RuleActionType(v.Type),
+			Value:       v.Value,
+		}
+		action.MetadataKey, action.MetadataValue, err = r.resolve(v.MetadataKey, v.MetadataValue)
+		if err != nil {
+			return nil, err
+		}
+		if action.Action == models.RuleActionSetDocumentType && v.DocumentType != "" {
+			typeId, err := r.resolveDocumentType(v.DocumentType)
+			if err != nil {
+				return nil, err
+			}
+			action.Value = strconv.Itoa(typeId)
+		}
+		rule.Actions[i] = action
+	}
+	return rule, nil
+}
+
+func (r *ruleMetadataResolver) importConditions(exported []RuleExportedCondition) ([]*models.RuleCondition, error) {
+	conditions := make([]*models.RuleCondition, len(exported))
+	var err error
+	for i, v := range exported {
+		condition := &models.RuleCondition{
+			Enabled:         v.Enabled,
+			CaseInsensitive: v.CaseInsensitive,
+			Inverted:        v.Inverted,
+			ConditionType:   models.RuleConditionType(v.Type),
+			IsRegex:         v.IsRegex,
+			Value:           v.Value,
+			DateFmt:         v.DateFmt,
+		}
+		condition.MetadataKey, condition.MetadataValue, err = r.resolve(v.MetadataKey, v.MetadataValue)
+		if err != nil {
+			return nil, err
+		}
+		if condition.IsGroup() {
+			err = condition.Mode.FromString(v.Mode)
+			if err != nil {
+				return nil, err
+			}
+			condition.Children, err = r.importConditions(v.Conditions)
+			if err != nil {
+				return nil, err
+			}
+		}
+		conditions[i] = condition
+	}
+	return conditions, nil
+}
+
+// resolve returns ids for the metadata key and value. Empty name returns 0.
+func (r *ruleMetadataResolver) resolve(keyName, valueName string) (models.IntId, models.IntId, error) {
+	if keyName == "" {
+		if valueName != "" {
+			e := errors.ErrInvalid
+			e.ErrMsg = fmt.Sprintf("metadata value '%s' does not have a key", valueName)
+			return 0, 0, e
+		}
+		return 0, 0, nil
+	}
+	keyId, err := r.resolveKey(keyName)
+	if err != nil || valueName == "" {
+		return models.IntId(keyId), 0, err
+	}
+	valueId, err := r.resolveValue(keyId, valueName)
+	return models.IntId(keyId), models.IntId(valueId), err
+}
+
+func (r *ruleMetadataResolver) resolveKey(name string) (int, error) {
+	cacheKey := strings.ToLower(name)
+	if id, ok := r.keys[cacheKey]; ok {
+		return id, nil
+	}
+	key, err := r.db.MetadataStore.GetKeyByName(r.userId, name)
+	if errors.Is(err, errors.ErrRecordNotFound) {
+		key = &models.MetadataKey{UserId: r.userId, Key: name}
+		err = r.db.MetadataStore.CreateKeyTx(r.exec, r.userId, key)
+		if err != nil {
+			return 0, fmt.Errorf("create metadata key '%s': %v", name, err)
+		}
+		r.createdKeys += 1
+	} else if err != nil {
+		return 0, err
+	}
+	r.keys[cacheKey] = key.Id
+	return key.Id, nil
+}
+
+// resolveDocumentType returns the id of user's document type with the name, creating the type if it does not exist.
+func (r *ruleMetadataResolver) resolveDocumentType(name string) (int, error) {
+	if id, ok := r.types[name]; ok {
+		return id, nil
+	}
+	docType := &models.DocumentType{UserId: r.userId, Name: name}
+	err := r.db.MetadataStore.CreateDocumentType(r.exec, docType)
+	if err != nil {
+		return 0, fmt.Errorf("create document type '%s': %v", name, err)
+	}
+	r.createdTypes += 1
+	r.types[name] = docType.Id
+	return docType.Id, nil
+}
+
+func (r *ruleMetadataResolver) resolveValue(keyId int, name string) (int, error) {
+	cacheKey := fmt.Sprintf("%d:%s", keyId, strings.ToLower(name))
+	if id, ok := r.values[cacheKey]; ok {
+		return id, nil
+	}
+	value, err := r.db.MetadataStore.GetValueByName(r.userId, keyId, name)
+	if errors.Is(err, errors.ErrRecordNotFound) {
+		value = &models.MetadataValue{
+			UserId:    r.userId,
+			KeyId:     keyId,
+			Value:     name,
+			MatchType: models.MetadataMatchExact,
+		}
+		err = r.db.MetadataStore.CreateValueTx(r.exec, value)
+		if err != nil {
+			return 0, fmt.Errorf("create metadata value '%s': %v", name, err)
+		}
+		r.createdValues += 1
+	} else if err != nil {
+		return 0, err
+	}
+	r.values[cacheKey] = value.Id
+	return value.Id, nil
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"sync"
 	"tryffel.net/go/virtualpaper/errors"
 	"tryffel.net/go/virtualpaper/models"
 	"tryffel.net/go/virtualpaper/services/process"
@@ -14,6 +15,9 @@ type RuleService struct {
 	db      *storage.Database
 	search  *search.Engine
 	process *process.Manager
+
+	applyLock   sync.Mutex
+	applyStatus map[int]*RuleApplyStatus
 }
 
 func NewRuleService(db *storage.Database, search *search.Engine, manager *process.Manager) *RuleService {
@@ -21,6 +25,8 @@ func NewRuleService(db *storage.Database, search *search.Engine, manager *proces
 		db:      db,
 		search:  search,
 		process: manager,
+
+		applyStatus: map[int]*RuleApplyStatus{},
 	}
 }
 
@@ -96,6 +102,7 @@ func (service *RuleService) TestRule(ctx context.Context, userId int, ruleId int
 	doc.Metadata = *metadata
 	logger.Context(ctx).WithField("user", userId).WithField("documentId", doc.Id).WithField("rule", ruleId).Info("Test rule")
 	processRule := process.NewDocumentRule(doc, rule)
+	processRule.SetMetadataStore(service.db.MetadataStore)
 	status := processRule.MatchTest()
 
 	logger.Context(ctx).WithField("documentId", doc.Id).WithField("rule", ruleId).Infof("Test rule finished: %v", status.Match)
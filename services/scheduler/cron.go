@@ -17,6 +17,7 @@ type CronJobs struct {
 	removeExpiredPasswordPresets cron.EntryID
 	removeExpiredAuthTokens      cron.EntryID
 	cleanupDocumenTrashbins      cron.EntryID
+	scheduledRules               cron.EntryID
 }
 
 func NewCron(db *storage.Database) (*CronJobs, error) {
@@ -37,6 +38,11 @@ func NewCron(db *storage.Database) (*CronJobs, error) {
 	if err != nil {
 		return cj, fmt.Errorf("create removeExpiredAuthTokens job: %v", err)
 	}
+	// rules have their own schedules, check every minute which of them are due
+	cj.scheduledRules, err = cj.c.AddFunc("* * * * *", cj.JobRunScheduledRules)
+	if err != nil {
+		return cj, fmt.Errorf("create runScheduledRules job: %v", err)
+	}
 	return cj, nil
 }
 
@@ -0,0 +1,154 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"tryffel.net/go/virtualpaper/errors"
+	"tryffel.net/go/virtualpaper/models"
+	"tryffel.net/go/virtualpaper/services/process"
+	"tryffel.net/go/virtualpaper/storage"
+)
+
+// number of documents to read at once when running scheduled rules.
+const scheduledRulesBatchSize = 100
+
+// JobRunScheduledRules runs the rules whose schedule is due for all documents of the rule owner.
+func (c *CronJobs) JobRunScheduledRules() {
+	defer c.recover()
+	action := "run scheduled rules"
+	now := time.Now()
+
+	users, err := c.db.RuleStore.GetUsersWithScheduledRules()
+	if err != nil {
+		logCronOp(action, false).Error(err)
+		return
+	}
+
+	for _, userId := range users {
+		rules, err := c.db.RuleStore.GetActiveUserRules(userId)
+		if err != nil {
+			logCronOp(action, false).Errorf("get rules for user %d: %v", userId, err)
+			continue
+		}
+		dueRules := make([]*models.Rule, 0, len(rules))
+		for _, v := range rules {
+			if v.ScheduleDue(now) {
+				dueRules = append(dueRules, v)
+			}
+		}
+		if len(dueRules) == 0 {
+			continue
+		}
+		changed, err := c.runScheduledRules(userId, dueRules)
+		if err != nil {
+			logCronOp(action, false).Errorf("user %d: %v", userId, err)
+			continue
+		}
+		logCronOp(action, true).Infof("ran %d scheduled rules for user %d, %d documents changed", len(dueRules), userId, changed)
+	}
+}
+
+// runScheduledRules applies the rules to all user's documents and saves the changes.
+// Documents that changed are queued for rules with edit and metadata triggers, and for indexing.
+func (c *CronJobs) runScheduledRules(userId int, rules []*models.Rule) (int, error) {
+	ids, err := c.db.DocumentStore.GetUserDocumentIds(userId, nil)
+	if err != nil {
+		return 0, fmt.Errorf("get documents: %v", err)
+	}
+
+	changedIds := make([]string, 0)
+	for start := 0; start < len(ids); start += scheduledRulesBatchSize {
+		end := start + scheduledRulesBatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		docs, err := c.db.DocumentStore.GetDocumentsById(c.db, userId, ids[start:end])
+		if err != nil {
+			return len(changedIds), fmt.Errorf("get documents: %v", err)
+		}
+		for i := range *docs {
+			doc := &(*docs)[i]
+			metadata, err := c.db.MetadataStore.GetDocumentMetadata(userId, doc.Id)
+			if err != nil {
+				return len(changedIds), fmt.Errorf("get document metadata: %v", err)
+			}
+			doc.Metadata = *metadata
+
+			triggers := models.RuleTriggers{}
+			for _, rule := range rules {
+				changes, err := c.runScheduledRule(rule, doc)
+				if err != nil {
+					logrus.Errorf("run scheduled rule %d for document %s: %v", rule.Id, doc.Id, err)
+					continue
+				}
+				for _, v := range changes {
+					triggers = triggers.Add(v)
+				}
+			}
+			if len(triggers) == 0 {
+				continue
+			}
+			changedIds = append(changedIds, doc.Id)
+			err = c.db.JobStore.AddRuleTriggers(c.db, []string{doc.Id}, triggers)
+			if err != nil {
+				logrus.Errorf("queue rules for document %s: %v", doc.Id, err)
+			}
+		}
+	}
+
+	if len(changedIds) > 0 {
+		err = c.db.JobStore.AddDocuments(c.db, userId, changedIds, []models.ProcessStep{models.ProcessFts})
+		if err != nil && !errors.Is(err, errors.ErrAlreadyExists) {
+			return len(changedIds), fmt.Errorf("queue documents for indexing: %v", err)
+		}
+	}
+	return len(changedIds), nil
+}
+
+// runScheduledRule runs the rule for the document. If the document changes, the changes are saved
+// and recorded to the job log. Returns the triggers for the changes.
+func (c *CronJobs) runScheduledRule(rule *models.Rule, doc *models.Document) (models.RuleTriggers, error) {
+	job := &models.Job{
+		DocumentId: doc.Id,
+		Message:    fmt.Sprintf("process user rule %d (trigger: %s)", rule.Id, models.RuleTriggerSchedule),
+		Status:     models.JobRunning,
+		Step:       models.ProcessRules,
+		StartedAt:  time.Now(),
+	}
+	updated, match, err := process.ApplyRule(doc, rule, c.db.MetadataStore, process.NewRuleActionStore(c.db), false)
+	if err != nil || !match {
+		return nil, err
+	}
+	triggers := models.ChangeTriggers(doc, updated)
+	if len(triggers) == 0 {
+		return nil, nil
+	}
+
+	tx, err := storage.NewTx(c.db, context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Close()
+	_, err = c.db.DocumentStore.UpdateByRule(tx, rule.Id, updated)
+	if err == nil {
+		err = tx.Commit()
+	}
+
+	job.StoppedAt = time.Now()
+	job.Status = models.JobFinished
+	if err != nil {
+		job.Status = models.JobFailure
+	}
+	jobErr := c.db.JobStore.CreateJob(doc.Id, job)
+	if jobErr != nil {
+		logrus.Errorf("save job to database: %v", jobErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	*doc = *updated
+	return triggers, nil
+}
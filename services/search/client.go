@@ -78,12 +78,22 @@ func (e *Engine) ping() error {
 // IndexDocuments sends documents to meilisearch for indexing
 func (e *Engine) IndexDocuments(docs *[]models.Document, userId int) error {
 	data := make([]map[string]interface{}, len(*docs))
+	documentTypes := map[models.IntId]string{}
 	for i, v := range *docs {
 		shares, err := e.db.DocumentStore.GetSharedUsers(e.db, v.Id)
 		if err != nil {
 			return fmt.Errorf("get shares for document: %v", err)
 		}
 
+		notes, err := e.db.DocumentStore.GetDocumentNotes(v.Id)
+		if err != nil {
+			return fmt.Errorf("get notes for document: %v", err)
+		}
+		noteContents := make([]string, len(notes))
+		for noteI, note := range notes {
+			noteContents[noteI] = note.Content
+		}
+
 		sharedUsers := make([]int, 0, len(*shares))
 		for _, v := range *shares {
 			if v.Permissions.Read {
@@ -97,29 +107,65 @@ func (e *Engine) IndexDocuments(docs *[]models.Document, userId int) error {
 		}
 
 		metadata := make([]string, len(v.Metadata))
+		metadataKeys := make([]string, 0, len(v.Metadata))
 		for metadataI, v := range v.Metadata {
 			key := normalizeMetadataKey(v.Key)
 			value := normalizeMetadataValue(v.Value)
 			metadata[metadataI] = key + ":" + value
+			if !containsString(metadataKeys, key) {
+				metadataKeys = append(metadataKeys, key)
+			}
+		}
+
+		documentType, ok := documentTypes[v.DocumentTypeId]
+		if !ok && v.DocumentTypeId != 0 {
+			docType, err := e.db.MetadataStore.GetDocumentType(v.UserId, int(v.DocumentTypeId))
+			if err != nil {
+				return fmt.Errorf("get document type: %v", err)
+			}
+			documentType = strings.ToLower(docType.Name)
+			documentTypes[v.DocumentTypeId] = documentType
 		}
 
 		data[i] = map[string]interface{}{
-			"document_id": v.Id,
-			"user_id":     v.UserId,
-			"name":        v.Name,
-			"file_name":   v.Filename,
-			"content":     v.Content,
-			"hash":        v.Hash,
-			"created_at":  v.CreatedAt.Unix(),
-			"updated_at":  v.UpdatedAt.Unix(),
-			"tags":        tags,
-			"metadata":    metadata,
-			"date":        v.Date.Unix(),
-			"description": v.Description,
-			"mimetype":    v.Mimetype,
-			"lang":        v.Lang,
-			"shares":      sharedUsers,
-			"owner_id":    userId,
+			"document_id":  v.Id,
+			"user_id":      v.UserId,
+			"name":         v.Name,
+			"file_name":    v.Filename,
+			"content":      v.Content,
+			"hash":         v.Hash,
+			"created_at":   v.CreatedAt.Unix(),
+			"updated_at":   v.UpdatedAt.Unix(),
+			"tags":         tags,
+			"metadata":     metadata,
+			"metadata_key": metadataKeys,
+			"typed":        typedMetadata(v.Metadata),
+			"date":         v.Date.Unix(),
+			"description":  v.Description,
+			"mimetype":     v.Mimetype,
+			"lang":         v.Lang,
+			"shares":       sharedUsers,
+			"owner_id":     userId,
+			"size":         v.Size,
+
+			"document_type": documentType,
+			"notes":         noteContents,
+
+			// invoice fields are lower case like the query
+			"invoice_iban":       strings.ToLower(v.Iban),
+			"invoice_reference":  strings.ToLower(v.Reference),
+			"invoice_amount":     v.Amount,
+			"invoice_currency":   strings.ToLower(v.Currency),
+			"invoice_vat_number": strings.ToLower(v.VatNumber),
+			"invoice_due_date":   nil,
+			"invoice_paid":       v.PaidAt != nil,
+			"invoice_paid_date":  nil,
+		}
+		if v.DueDate != nil {
+			data[i]["invoice_due_date"] = v.DueDate.Unix()
+		}
+		if v.PaidAt != nil {
+			data[i]["invoice_paid_date"] = v.PaidAt.Unix()
 		}
 	}
 
@@ -131,6 +177,37 @@ func (e *Engine) IndexDocuments(docs *[]models.Document, userId int) error {
 	return nil
 }
 
+// typedMetadata returns the values of numeric metadata keys as numbers, so that they can be compared and sorted.
+// Keys with multiple values are stored as arrays.
+func typedMetadata(metadata []models.Metadata) map[string]interface{} {
+	typed := map[string]interface{}{}
+	for _, v := range metadata {
+		if !v.KeyType.IsNumeric() {
+			continue
+		}
+		value, err := models.ParseTypedMetadataValue(v.KeyType, v.Value)
+		if err != nil {
+			logrus.Warningf("invalid value '%s' for typed metadata key %d: %v", v.Value, v.KeyId, err)
+			continue
+		}
+		number, ok := value.SearchNumber()
+		if !ok {
+			continue
+		}
+
+		field := typedMetadataKey(v.Key)
+		switch existing := typed[field].(type) {
+		case nil:
+			typed[field] = number
+		case float64:
+			typed[field] = []float64{existing, number}
+		case []float64:
+			typed[field] = append(existing, number)
+		}
+	}
+	return typed
+}
+
 func (e *Engine) DeleteDocument(docId string, userId int) error {
 
 	_, err := e.client.Index(indexName()).DeleteDocument(docId)
@@ -241,6 +318,41 @@ func (e *Engine) DeleteDocuments(userId int) error {
 	return nil
 }
 
+// indexAttributes are the document attributes that are filterable, sortable and searchable.
+var indexAttributes = []string{
+	"document_id",
+	"user_id",
+	"name",
+	"file_name",
+	"content",
+	"hash",
+	"created_at",
+	"updated_at",
+	"tags",
+	"metadata",
+	"date",
+	"description",
+	"tags",
+	"metadata_key",
+	"metadata_value",
+	"typed",
+	"mimetype",
+	"lang",
+	"shares",
+	"owner_id",
+	"size",
+	"document_type",
+	"notes",
+	"invoice_iban",
+	"invoice_reference",
+	"invoice_amount",
+	"invoice_currency",
+	"invoice_vat_number",
+	"invoice_due_date",
+	"invoice_paid",
+	"invoice_paid_date",
+}
+
 func (e *Engine) AddIndex() error {
 	index := indexName()
 	indexExists := false
@@ -268,27 +380,7 @@ func (e *Engine) AddIndex() error {
 			PrimaryKey: "document_id",
 		})
 
-		fields := &[]string{
-			"document_id",
-			"user_id",
-			"name",
-			"file_name",
-			"content",
-			"hash",
-			"created_at",
-			"updated_at",
-			"tags",
-			"metadata",
-			"date",
-			"description",
-			"tags",
-			"metadata_key",
-			"metadata_value",
-			"mimetype",
-			"lang",
-			"shares",
-			"owner_id",
-		}
+		fields := &indexAttributes
 		_, err = e.client.Index(index).UpdateFilterableAttributes(fields)
 		if err != nil {
 			logrus.Errorf("meilisearch set filterable attributes: %v", err)
@@ -302,9 +394,54 @@ func (e *Engine) AddIndex() error {
 		if err != nil {
 			logrus.Errorf("meilisearch set searchable attributes: %v", err)
 		}
+	} else {
+		err = e.updateFilterableAttributes(index)
 	}
 	if err != nil {
 		return fmt.Errorf("create index: %v", err)
 	}
 	return nil
 }
+
+// updateFilterableAttributes adds any missing filterable, sortable and searchable attributes to existing index.
+// Documents indexed before the attribute existed need to be re-indexed to be matched by the new filters.
+func (e *Engine) updateFilterableAttributes(index string) error {
+	existing, err := e.client.Index(index).GetFilterableAttributes()
+	if err != nil {
+		return fmt.Errorf("get filterable attributes: %v", err)
+	}
+	missing := false
+	for _, v := range indexAttributes {
+		if existing == nil || !containsString(*existing, v) {
+			missing = true
+			break
+		}
+	}
+	if !missing {
+		return nil
+	}
+
+	logrus.Infof("update meilisearch filterable attributes for index '%s'", index)
+	_, err = e.client.Index(index).UpdateFilterableAttributes(&indexAttributes)
+	if err != nil {
+		return fmt.Errorf("set filterable attributes: %v", err)
+	}
+	_, err = e.client.Index(index).UpdateSortableAttributes(&indexAttributes)
+	if err != nil {
+		return fmt.Errorf("set sortable attributes: %v", err)
+	}
+	_, err = e.client.Index(index).UpdateSearchableAttributes(&indexAttributes)
+	if err != nil {
+		return fmt.Errorf("set searchable attributes: %v", err)
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
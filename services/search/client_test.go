@@ -21,6 +21,8 @@ package search
 import (
 	"reflect"
 	"testing"
+
+	"tryffel.net/go/virtualpaper/models"
 )
 
 func Test_buildSynonyms(t *testing.T) {
@@ -68,3 +70,24 @@ func Test_buildSynonyms(t *testing.T) {
 		})
 	}
 }
+
+func Test_typedMetadata(t *testing.T) {
+	metadata := []models.Metadata{
+		{KeyId: 1, Key: "class", Value: "invoice", KeyType: models.MetadataKeyTypeText},
+		{KeyId: 2, Key: "Amount", Value: "123.45 EUR", KeyType: models.MetadataKeyTypeMoney},
+		{KeyId: 3, Key: "due date", Value: "2024-05-01", KeyType: models.MetadataKeyTypeDate},
+		{KeyId: 4, Key: "paid", Value: "true", KeyType: models.MetadataKeyTypeBoolean},
+		{KeyId: 5, Key: "pages", Value: "2", KeyType: models.MetadataKeyTypeNumber},
+		{KeyId: 5, Key: "pages", Value: "3", KeyType: models.MetadataKeyTypeNumber},
+		{KeyId: 6, Key: "note", Value: "some text", KeyType: models.MetadataKeyTypeFreeText},
+	}
+	want := map[string]interface{}{
+		"amount":   123.45,
+		"due_date": float64(1714521600),
+		"paid":     float64(1),
+		"pages":    []float64{2, 3},
+	}
+	if got := typedMetadata(metadata); !reflect.DeepEqual(got, want) {
+		t.Errorf("typedMetadata() = %v, want %v", got, want)
+	}
+}
@@ -20,9 +20,10 @@ package search
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
-	"unicode/utf8"
 
 	"github.com/meilisearch/meilisearch-go"
 	"github.com/sirupsen/logrus"
@@ -46,19 +47,49 @@ type DocumentFilter struct {
 // else search only specified field
 func (e *Engine) SearchDocuments(userId int, query string, sort storage.SortKey, paging storage.Paging) ([]*models.Document, int, error) {
 
-	qs, err := parseFilter(query)
+	metadata := &metadataSuggest{
+		db:     e.db,
+		userId: userId,
+	}
+	qs, err := parseFilter(query, metadata)
 	if err != nil {
 		e := errors.ErrInvalid
 		e.ErrMsg = err.Error()
 		return nil, 0, e
 	}
 
-	request := qs.prepareMeiliQuery(userId, sort, paging)
-	logrus.Debugf("Meilisearch query: %s, %v", qs.Query, request.Filter)
+	settings, err := e.db.UserStore.GetSearchSettings(userId)
+	if err != nil {
+		logrus.Warningf("get search settings for user %d: %v", userId, err)
+	}
+	querySettings := newQuerySettings(settings)
 
-	docs := make([]*models.Document, 0)
+	request := qs.prepareMeiliQuery(userId, sort, paging)
+	if len(request.Sort) == 0 && len(querySettings.ranking) > 0 {
+		// explicit sort from the request overrides user's ranking
+		request.Sort = querySettings.ranking
+	}
 
-	res, err := e.client.Index(indexName()).Search(qs.Query, request)
+	queries := []string{qs.Query}
+	if qs.Query != "" {
+		queries = querySettings.expandQuery(qs.Query)
+	}
+	logrus.Debugf("Meilisearch query: %v, %v", queries, request.Filter)
+
+	var hits []interface{}
+	nHits := 0
+	if len(queries) == 1 {
+		var res *meilisearch.SearchResponse
+		res, err = e.client.Index(indexName()).Search(queries[0], request)
+		if err == nil {
+			hits = res.Hits
+			// If there are only filters and no query, meilisearch returns larger nbHits, probably count of all documents,
+			// which is incorrect for given filter.
+			nHits = int(res.EstimatedTotalHits)
+		}
+	} else {
+		hits, nHits, err = e.multiSearch(queries, request, paging)
+	}
 	if err != nil {
 		if meiliError, ok := err.(*meilisearch.Error); ok {
 			if meiliError.StatusCode == 400 {
@@ -71,15 +102,57 @@ func (e *Engine) SearchDocuments(userId int, query string, sort storage.SortKey,
 				logrus.Errorf("meilisearch error: %v", meiliError)
 			}
 		}
-		return docs, 0, err
+		return make([]*models.Document, 0), 0, err
+	}
+	if len(hits) == 0 {
+		return make([]*models.Document, 0), 0, nil
 	}
-	if len(res.Hits) == 0 {
-		return docs, 0, nil
+	return parseHits(hits), nHits, nil
+}
+
+// multiSearch searches with each query and merges the results. Returns the requested page of merged hits
+// and estimated total number of hits.
+func (e *Engine) multiSearch(queries []string, request *meilisearch.SearchRequest, paging storage.Paging) ([]interface{}, int, error) {
+	multi := &meilisearch.MultiSearchRequest{Queries: make([]meilisearch.SearchRequest, len(queries))}
+	for i, v := range queries {
+		query := *request
+		query.IndexUID = indexName()
+		query.Query = v
+		query.Offset = 0
+		query.Limit = int64(paging.Offset + paging.Limit)
+		multi.Queries[i] = query
+	}
+	res, err := e.client.MultiSearch(multi)
+	if err != nil {
+		return nil, 0, err
 	}
 
-	docs = make([]*models.Document, len(res.Hits))
+	results := make([][]interface{}, len(res.Results))
+	total := 0
+	for i, v := range res.Results {
+		results[i] = v.Hits
+		if int(v.EstimatedTotalHits) > total {
+			total = int(v.EstimatedTotalHits)
+		}
+	}
+	hits := mergeHits(results)
+	if len(hits) > total {
+		total = len(hits)
+	}
+	if paging.Offset >= len(hits) {
+		return []interface{}{}, total, nil
+	}
+	end := paging.Offset + paging.Limit
+	if end > len(hits) {
+		end = len(hits)
+	}
+	return hits[paging.Offset:end], total, nil
+}
 
-	for i, v := range res.Hits {
+// parseHits converts meilisearch hits to documents.
+func parseHits(hits []interface{}) []*models.Document {
+	docs := make([]*models.Document, 0, len(hits))
+	for _, v := range hits {
 		isMap, ok := v.(map[string]interface{})
 		if ok {
 			doc := &models.Document{}
@@ -90,6 +163,18 @@ func (e *Engine) SearchDocuments(userId int, query string, sort storage.SortKey,
 			doc.Date = time.Unix(int64(getInt("date", isMap)), 0)
 			doc.Mimetype = getString("mimetype", isMap)
 			doc.Lang = models.Lang(getString("lang", isMap))
+			if amount, ok := isMap["invoice_amount"].(float64); ok {
+				doc.Amount = &amount
+			}
+			doc.Currency = strings.ToUpper(getString("invoice_currency", isMap))
+			if _, ok := isMap["invoice_due_date"].(float64); ok {
+				dueDate := time.Unix(int64(getInt("invoice_due_date", isMap)), 0)
+				doc.DueDate = &dueDate
+			}
+			if _, ok := isMap["invoice_paid_date"].(float64); ok {
+				paidAt := time.Unix(int64(getInt("invoice_paid_date", isMap)), 0)
+				doc.PaidAt = &paidAt
+			}
 
 			shareArray, ok := isMap["shares"].([]interface{})
 			if !ok {
@@ -108,14 +193,10 @@ func (e *Engine) SearchDocuments(userId int, query string, sort storage.SortKey,
 					doc.Content = content
 				}
 			}
-			docs[i] = doc
-
+			docs = append(docs, doc)
 		}
 	}
-	// If there are only filters and no query, meilisearch returns larger nbHits, probably count of all documents,
-	// which is incorrect for given filter.
-	nHits := int(res.EstimatedTotalHits)
-	return docs, nHits, nil
+	return docs
 }
 
 func getString(key string, container map[string]interface{}) string {
@@ -147,72 +228,195 @@ func getInt(key string, container map[string]interface{}) int {
 	return 0
 }
 
+// filterToken is a single token of the search query.
+type filterToken struct {
+	value string
+	// position is the character position of the token in the query, starting from 1.
+	position int
+}
+
+// queryError describes a malformed search query and where in the query the problem is.
+type queryError struct {
+	position int
+	token    string
+	reason   string
+}
+
+func (e *queryError) Error() string {
+	return fmt.Sprintf("invalid query at position %d ('%s'): %s", e.position, e.token, e.reason)
+}
+
+func newQueryError(token filterToken, format string, args ...interface{}) error {
+	return &queryError{
+		position: token.position,
+		token:    token.value,
+		reason:   fmt.Sprintf(format, args...),
+	}
+}
+
 // tokenizes filter: 'a:misc and (topic:"unknown topic")' -> [a:misc, and, (, topic:unknown topic, )]
 func tokenizeFilter(filter string) []string {
+	tokens := tokenizeFilterPositions(filter)
+	values := make([]string, len(tokens))
+	for i, v := range tokens {
+		values[i] = v.value
+	}
+	return values
+}
+
+// tokenizeFilterPositions tokenizes the filter the same way as tokenizeFilter,
+// but keeps track of the position of each token.
+func tokenizeFilterPositions(filter string) []filterToken {
 	if filter == "" {
-		return []string{}
+		return []filterToken{}
 	}
 
-	tokens := make([]string, 0, 10)
+	tokens := make([]filterToken, 0, 10)
 	escapeChar := '"'
 	inEscape := false
-	textLeft := filter
+	skipSpaces := false
 	token := ""
+	tokenStart := 0
+	position := 0
 
-	for {
-		if textLeft == "" {
-			if token != "" {
-				tokens = append(tokens, token)
+	for _, character := range filter {
+		position += 1
+		if skipSpaces {
+			if character == ' ' {
+				continue
 			}
-			break
+			skipSpaces = false
+		}
+		if tokenStart == 0 {
+			tokenStart = position
 		}
-		character, width := utf8.DecodeRuneInString(textLeft)
 		if inEscape {
 			if character == escapeChar {
 				inEscape = false
-				textLeft = textLeft[width:]
 			} else {
 				token += string(character)
-				textLeft = textLeft[width:]
 			}
-		} else {
-			if character == escapeChar {
-				inEscape = true
-				textLeft = textLeft[width:]
-			} else if character == ' ' {
-				// next token
-				tokens = append(tokens, token)
-				textLeft = textLeft[width:]
+			continue
+		}
+
+		if character == escapeChar {
+			inEscape = true
+		} else if character == ' ' {
+			// next token
+			tokens = append(tokens, filterToken{value: token, position: tokenStart})
+			token = ""
+			tokenStart = 0
+		} else if character == ')' || character == '(' {
+			if token != "" {
+				tokens = append(tokens, filterToken{value: token, position: tokenStart})
 				token = ""
-			} else if character == ')' || character == '(' {
-				if token != "" {
-					tokens = append(tokens, token)
-					token = ""
-				}
-				tokens = append(tokens, string(character))
-				textLeft = textLeft[width:]
-				textLeft = strings.TrimLeft(textLeft, " ")
-			} else {
-				token += string(character)
-				textLeft = textLeft[width:]
 			}
+			tokens = append(tokens, filterToken{value: string(character), position: position})
+			tokenStart = 0
+			skipSpaces = true
+		} else {
+			token += string(character)
 		}
 	}
-
+	if token != "" {
+		tokens = append(tokens, filterToken{value: token, position: tokenStart})
+	}
 	return tokens
 }
 
-func parseFilter(filter string) (*searchQuery, error) {
+// filterExpression is a single 'key:value' token, e.g. 'author:doyle', '-class:invoice' or 'size>5mb'.
+type filterExpression struct {
+	token      filterToken
+	key        string
+	comparator string
+	value      string
+	negate     bool
+}
+
+// parseFilterExpression splits the token into a filter expression.
+// Returns false if token is not a filter expression but a plain search term.
+func parseFilterExpression(token filterToken) (*filterExpression, bool) {
+	text := token.value
+	expr := &filterExpression{token: token}
+	index := strings.IndexAny(text, ":<>")
+	if index < 0 {
+		return nil, false
+	}
+	if strings.HasPrefix(text, "-") && index > 1 {
+		expr.negate = true
+		text = text[1:]
+		index -= 1
+	}
+
+	expr.key = text[:index]
+	expr.comparator = text[index : index+1]
+	if expr.comparator != ":" && strings.HasPrefix(text[index+1:], "=") {
+		expr.comparator += "="
+	}
+	expr.value = text[index+len(expr.comparator):]
+	return expr, true
+}
+
+func parseFilter(filter string, metadata metadataQuerier) (*searchQuery, error) {
 	sq := &searchQuery{RawQuery: filter}
-	tokens := tokenizeFilter(strings.ToLower(filter))
+	tokens := tokenizeFilterPositions(strings.ToLower(filter))
 
 	operators := []string{"and", "or", "not", "(", ")"}
 	metadataQuery := []string{}
+	openParentheses := []filterToken{}
 
 	textQuery := []string{}
 
+	for _, token := range tokens {
+		isOperator := false
+		for _, v := range operators {
+			if token.value == v {
+				isOperator = true
+				break
+			}
+		}
+		if isOperator {
+			if token.value == "(" {
+				openParentheses = append(openParentheses, token)
+			} else if token.value == ")" {
+				if len(openParentheses) == 0 {
+					return sq, newQueryError(token, "closing parenthesis without opening one")
+				}
+				openParentheses = openParentheses[:len(openParentheses)-1]
+			}
+			metadataQuery = append(metadataQuery, strings.ToUpper(token.value))
+			continue
+		}
+
+		expr, ok := parseFilterExpression(token)
+		if !ok {
+			textQuery = append(textQuery, escapePhrase(token.value))
+			continue
+		}
+
+		filter, err := sq.parseExpression(expr, metadata)
+		if err != nil {
+			return sq, err
+		}
+		if filter != "" {
+			metadataQuery = append(metadataQuery, filter)
+		}
+	}
+	if len(openParentheses) > 0 {
+		return sq, newQueryError(openParentheses[len(openParentheses)-1], "parenthesis is not closed")
+	}
+
+	metadataFilter := fillMetadataQueryOperators(metadataQuery)
+	sq.MetadataQuery = metadataFilter
+	sq.MetadataString = strings.Join(metadataFilter, " ")
+	sq.Query = strings.Join(textQuery, " ")
+	return sq, nil
+}
+
+// parseExpression validates the expression and either sets the matching search field or
+// returns a meilisearch filter that needs to be appended to the filter query.
+func (sq *searchQuery) parseExpression(expr *filterExpression, metadata metadataQuerier) (string, error) {
 	matchers := map[string]parseFunc{
-		"date":        parseDate,
 		"name":        parseName,
 		"content":     parseContent,
 		"description": parseDescription,
@@ -221,62 +425,253 @@ func parseFilter(filter string) (*searchQuery, error) {
 		"shared":      parseShared,
 	}
 
-	tokensLeft := tokens
-	removeToken := func() {
-		tokensLeft = tokensLeft[1:]
-	}
-
-	maxIterations := len(tokens)
-	iteration := 0
-	for iteration < maxIterations && len(tokensLeft) > 0 {
-		iteration += 1
-		token := tokensLeft[0]
-		splits := strings.Split(tokensLeft[0], ":")
-		if len(splits) == 1 {
-			found := false
-			for _, v := range operators {
-				if token == v {
-					metadataQuery = append(metadataQuery, strings.ToUpper(v))
-					removeToken()
-					found = true
-					break
-				}
+	if expr.key == "" {
+		return "", newQueryError(expr.token, "missing key before '%s'", expr.comparator)
+	}
+	if expr.value == "" {
+		return "", newQueryError(expr.token, "missing value for '%s'", expr.key)
+	}
+
+	switch expr.key {
+	case "date":
+		if expr.negate {
+			return "", newQueryError(expr.token, "date cannot be negated, use date comparison instead")
+		}
+		if expr.comparator == ":" {
+			if !parseDate(expr.value, sq) {
+				return "", newQueryError(expr.token, "invalid date '%s'", expr.value)
 			}
-			if found {
-				continue
+			return "", nil
+		}
+		filter, ok := parseDateComparison("date", expr.comparator, expr.value)
+		if !ok {
+			return "", newQueryError(expr.token, "invalid date '%s'", expr.value)
+		}
+		return filter, nil
+	case "invoice.due":
+		if expr.negate {
+			return "", newQueryError(expr.token, "%s cannot be negated, use date comparison instead", expr.key)
+		}
+		if expr.comparator == ":" {
+			status, _, start, end := matchDate(expr.value)
+			if status != valueMatchStatusOk {
+				return "", newQueryError(expr.token, "invalid date '%s'", expr.value)
 			}
-			textQuery = append(textQuery, escapePhrase(token))
-			removeToken()
-			continue
+			return fmt.Sprintf("invoice_due_date %d TO %d", start.Unix(), end.Unix()-1), nil
 		}
-		found := false
-		for key, matcher := range matchers {
-
-			if splits[0] == key {
-				ok := matcher(splits[1], sq)
-				if !ok {
-					return sq, fmt.Errorf("invalid query: %v", token)
-				} else {
-					removeToken()
-					found = true
-					break
-				}
+		filter, ok := parseDateComparison("invoice_due_date", expr.comparator, expr.value)
+		if !ok {
+			return "", newQueryError(expr.token, "invalid date '%s'", expr.value)
+		}
+		return filter, nil
+	case "invoice.paid":
+		if expr.comparator != ":" {
+			if expr.negate {
+				return "", newQueryError(expr.token, "%s cannot be negated, use date comparison instead", expr.key)
 			}
+			filter, ok := parseDateComparison("invoice_paid_date", expr.comparator, expr.value)
+			if !ok {
+				return "", newQueryError(expr.token, "invalid date '%s'", expr.value)
+			}
+			return filter, nil
+		}
+		var paid bool
+		switch expr.value {
+		case "yes":
+			paid = true
+		case "no":
+			paid = false
+		default:
+			return "", newQueryError(expr.token, "invalid value '%s' for %s, expected yes or no", expr.value, expr.key)
+		}
+		if expr.negate {
+			paid = !paid
+		}
+		// documents indexed before paid date existed have no field, so match unpaid with '!='
+		if paid {
+			return "invoice_paid = true", nil
+		}
+		return "invoice_paid != true", nil
+	case "invoice.amount":
+		if expr.negate {
+			return "", newQueryError(expr.token, "%s cannot be negated, use comparison instead", expr.key)
+		}
+		amount, err := models.ParseTypedMetadataValue(models.MetadataKeyTypeNumber, expr.value)
+		if err != nil {
+			return "", newQueryError(expr.token, "invalid amount '%s'", expr.value)
+		}
+		comparator := expr.comparator
+		if comparator == ":" {
+			comparator = "="
+		}
+		return fmt.Sprintf("invoice_amount %s %s", comparator, amount.Value), nil
+	case "size":
+		if expr.negate {
+			return "", newQueryError(expr.token, "size cannot be negated")
+		}
+		if expr.comparator == ":" {
+			return "", newQueryError(expr.token, "size requires a comparison: >, >=, < or <=")
+		}
+		size, err := models.ParseRuleFileSize(expr.value)
+		if err != nil {
+			return "", newQueryError(expr.token, "invalid size '%s', expected e.g. 500kb, 5mb or 1gb", expr.value)
+		}
+		return fmt.Sprintf("size %s %d", expr.comparator, size), nil
+	case "type":
+		if expr.comparator != ":" {
+			return "", newQueryError(expr.token, "type does not support comparison '%s'", expr.comparator)
+		}
+		if strings.HasSuffix(expr.value, "*") {
+			return "", newQueryError(expr.token, "prefix matching is only supported for metadata")
+		}
+		operator := "="
+		if expr.negate {
+			operator = "!="
+		}
+		return fmt.Sprintf(`document_type %s "%s"`, operator, strings.ReplaceAll(expr.value, `"`, `\"`)), nil
+	}
 
+	if field, ok := invoiceTextFields[expr.key]; ok {
+		if expr.comparator != ":" {
+			return "", newQueryError(expr.token, "%s does not support comparison '%s'", expr.key, expr.comparator)
 		}
-		if found {
-			continue
+		if strings.HasSuffix(expr.value, "*") {
+			return "", newQueryError(expr.token, "prefix matching is only supported for metadata")
+		}
+		operator := "="
+		if expr.negate {
+			operator = "!="
 		}
+		// account and reference numbers are indexed without spaces
+		value := strings.ReplaceAll(expr.value, " ", "")
+		return fmt.Sprintf(`%s %s "%s"`, field, operator, strings.ReplaceAll(value, `"`, `\"`)), nil
+	}
 
-		metadataFilter := fmt.Sprintf(`metadata="%s:%s"`, normalizeMetadataKey(splits[0]), normalizeMetadataValue(splits[1]))
-		metadataQuery = append(metadataQuery, metadataFilter)
-		removeToken()
+	if matcher, ok := matchers[expr.key]; ok {
+		if expr.comparator != ":" {
+			return "", newQueryError(expr.token, "%s does not support comparison '%s'", expr.key, expr.comparator)
+		}
+		if strings.HasSuffix(expr.value, "*") {
+			return "", newQueryError(expr.token, "prefix matching is only supported for metadata")
+		}
+		if expr.negate {
+			if expr.key != "lang" {
+				return "", newQueryError(expr.token, "%s cannot be negated", expr.key)
+			}
+			return fmt.Sprintf(`lang != "%s"`, strings.ReplaceAll(expr.value, `"`, `\"`)), nil
+		}
+		matcher(expr.value, sq)
+		return "", nil
 	}
-	metadata := fillMetadataQueryOperators(metadataQuery)
-	sq.MetadataQuery = metadata
-	sq.MetadataString = strings.Join(metadata, " ")
-	sq.Query = strings.Join(textQuery, " ")
-	return sq, nil
+
+	if expr.comparator != ":" {
+		keyType := metadata.queryKeyType(expr.key)
+		if !keyType.IsNumeric() {
+			return "", newQueryError(expr.token, "comparison '%s' is not supported for metadata key '%s'", expr.comparator, expr.key)
+		}
+		filter, ok := parseTypedComparison(keyType, expr.key, expr.comparator, expr.value)
+		if !ok {
+			return "", newQueryError(expr.token, "invalid %s '%s'", keyType, expr.value)
+		}
+		if expr.negate {
+			filter = "NOT " + filter
+		}
+		return filter, nil
+	}
+
+	filter := ""
+	if expr.value == "*" {
+		filter = fmt.Sprintf(`metadata_key="%s"`, normalizeMetadataKey(expr.key))
+	} else if strings.HasSuffix(expr.value, "*") {
+		filter = metadataPrefixFilter(expr.key, strings.TrimSuffix(expr.value, "*"), metadata)
+	} else {
+		filter = metadataValueFilter(expr.key, expr.value, metadata)
+	}
+	if expr.negate {
+		filter = "NOT " + filter
+	}
+	return filter, nil
+}
+
+// metadataValueFilter matches the value and all values under it in the value hierarchy.
+func metadataValueFilter(key, value string, metadata metadataQuerier) string {
+	descendants := metadata.queryValueDescendants(key, value)
+	if len(descendants) == 0 {
+		return fmt.Sprintf(`metadata="%s:%s"`, normalizeMetadataKey(key), normalizeMetadataValue(value))
+	}
+
+	filters := make([]string, 0, len(descendants)+1)
+	filters = append(filters, fmt.Sprintf(`"%s:%s"`, normalizeMetadataKey(key), normalizeMetadataValue(value)))
+	for _, v := range descendants {
+		filters = append(filters, fmt.Sprintf(`"%s:%s"`, normalizeMetadataKey(key), normalizeMetadataValue(v)))
+	}
+	return fmt.Sprintf("metadata IN [%s]", strings.Join(filters, ", "))
+}
+
+// metadataPrefixFilter expands prefix to all user's metadata values that start with prefix.
+func metadataPrefixFilter(key, prefix string, metadata metadataQuerier) string {
+	values := metadata.queryValuesWithPrefix(key, prefix)
+	if len(values) == 0 {
+		// no values match, keep a filter that does not match any document
+		return fmt.Sprintf(`metadata="%s:%s*"`, normalizeMetadataKey(key), normalizeMetadataValue(prefix))
+	}
+
+	filters := make([]string, len(values))
+	for i, v := range values {
+		filters[i] = fmt.Sprintf(`"%s:%s"`, normalizeMetadataKey(key), normalizeMetadataValue(v))
+	}
+	return fmt.Sprintf("metadata IN [%s]", strings.Join(filters, ", "))
+}
+
+// parseDateComparison creates a filter for the date field. Value is any date accepted by date-filter, e.g. 2022, 2022-03-01 or today.
+// '>' matches dates after the whole period, '>=' matches dates from the start of the period.
+func parseDateComparison(field, comparator, value string) (string, bool) {
+	if strings.Contains(value, "|") {
+		return "", false
+	}
+	status, _, start, end := matchDate(value)
+	if status != valueMatchStatusOk {
+		return "", false
+	}
+
+	switch comparator {
+	case ">":
+		return fmt.Sprintf("%s >= %d", field, end.Unix()), true
+	case ">=":
+		return fmt.Sprintf("%s >= %d", field, start.Unix()), true
+	case "<":
+		return fmt.Sprintf("%s < %d", field, start.Unix()), true
+	case "<=":
+		return fmt.Sprintf("%s < %d", field, end.Unix()), true
+	}
+	return "", false
+}
+
+// parseTypedComparison creates a filter for a typed metadata key, e.g. 'amount>100' or 'due<2024-06-01'.
+// Dates are compared with parseDateComparison.
+func parseTypedComparison(keyType models.MetadataKeyType, key, comparator, value string) (string, bool) {
+	field := "typed." + typedMetadataKey(key)
+	if keyType == models.MetadataKeyTypeDate {
+		return parseDateComparison(field, comparator, value)
+	}
+
+	typed, err := models.ParseTypedMetadataValue(keyType, value)
+	if err != nil {
+		return "", false
+	}
+	number, ok := typed.SearchNumber()
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%s %s %s", field, comparator, strconv.FormatFloat(number, 'f', -1, 64)), true
+}
+
+// invoiceTextFields are the invoice fields that match exact value, e.g. 'invoice.iban:fi2112345600000785'.
+var invoiceTextFields = map[string]string{
+	"invoice.iban":      "invoice_iban",
+	"invoice.reference": "invoice_reference",
+	"invoice.currency":  "invoice_currency",
+	"invoice.vat":       "invoice_vat_number",
 }
 
 type parseFunc func(value string, sq *searchQuery) bool
@@ -325,6 +720,13 @@ func normalizeMetadataKey(key string) string {
 	return strings.Replace(key, " ", "_", -1)
 }
 
+var regexTypedField = regexp.MustCompile(`[^a-z0-9_]`)
+
+// typedMetadataKey returns the key of typed metadata values in the search index, under field 'typed'.
+func typedMetadataKey(key string) string {
+	return regexTypedField.ReplaceAllString(strings.ToLower(key), "_")
+}
+
 func normalizeMetadataValue(value string) string {
 	return normalizeMetadataKey(value)
 }
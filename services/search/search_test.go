@@ -19,6 +19,7 @@
 package search
 
 import (
+	"fmt"
 	"reflect"
 	"testing"
 	"time"
@@ -339,10 +340,135 @@ func Test_parseFilter(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "date comparison",
+			args: args{"date>2022-03-01 date<=2022-04"},
+			want: &searchQuery{
+				RawQuery:       "date>2022-03-01 date<=2022-04",
+				MetadataQuery:  []string{fmt.Sprintf("date >= %d", timeFromDate(2022, 3, 2).Unix()), "AND", fmt.Sprintf("date < %d", timeFromDate(2022, 5, 1).Unix())},
+				MetadataString: fmt.Sprintf("date >= %d AND date < %d", timeFromDate(2022, 3, 2).Unix(), timeFromDate(2022, 5, 1).Unix()),
+			},
+			wantErr: false,
+		},
+		{
+			name: "size comparison",
+			args: args{"size>5mb OR size<=100kb OR size<1.5g OR size>=2kib"},
+			want: &searchQuery{
+				RawQuery:       "size>5mb OR size<=100kb OR size<1.5g OR size>=2kib",
+				MetadataQuery:  []string{"size > 5242880", "OR", "size <= 102400", "OR", "size < 1610612736", "OR", "size >= 2048"},
+				MetadataString: "size > 5242880 OR size <= 102400 OR size < 1610612736 OR size >= 2048",
+			},
+			wantErr: false,
+		},
+		{
+			name: "invoice fields",
+			args: args{`invoice.amount>500 invoice.due<2024-04 -invoice.currency:usd invoice.iban:"FI21 1234 5600 0007 85"`},
+			want: &searchQuery{
+				RawQuery: `invoice.amount>500 invoice.due<2024-04 -invoice.currency:usd invoice.iban:"FI21 1234 5600 0007 85"`,
+				MetadataQuery: []string{"invoice_amount > 500", "AND", fmt.Sprintf("invoice_due_date < %d", timeFromDate(2024, 4, 1).Unix()),
+					"AND", `invoice_currency != "usd"`, "AND", `invoice_iban = "fi2112345600000785"`},
+				MetadataString: fmt.Sprintf(`invoice_amount > 500 AND invoice_due_date < %d AND invoice_currency != "usd" AND invoice_iban = "fi2112345600000785"`,
+					timeFromDate(2024, 4, 1).Unix()),
+			},
+			wantErr: false,
+		},
+		{
+			name: "invoice paid",
+			args: args{`invoice.paid:no OR -invoice.paid:no invoice.paid>=2024-04`},
+			want: &searchQuery{
+				RawQuery: `invoice.paid:no OR -invoice.paid:no invoice.paid>=2024-04`,
+				MetadataQuery: []string{"invoice_paid != true", "OR", "invoice_paid = true", "AND",
+					fmt.Sprintf("invoice_paid_date >= %d", timeFromDate(2024, 4, 1).Unix())},
+				MetadataString: fmt.Sprintf(`invoice_paid != true OR invoice_paid = true AND invoice_paid_date >= %d`,
+					timeFromDate(2024, 4, 1).Unix()),
+			},
+			wantErr: false,
+		},
+		{
+			name: "metadata value hierarchy",
+			args: args{`project:acme/2024 OR -project:acme`},
+			want: &searchQuery{
+				RawQuery: `project:acme/2024 OR -project:acme`,
+				MetadataQuery: []string{`metadata IN ["project:acme/2024", "project:acme/2024/phase-2"]`, "OR",
+					`NOT metadata IN ["project:acme", "project:acme/2023", "project:acme/2024", "project:acme/2024/phase-2"]`},
+				MetadataString: `metadata IN ["project:acme/2024", "project:acme/2024/phase-2"] OR ` +
+					`NOT metadata IN ["project:acme", "project:acme/2023", "project:acme/2024", "project:acme/2024/phase-2"]`,
+			},
+			wantErr: false,
+		},
+		{
+			name: "typed metadata comparison",
+			args: args{`amount>100.5 AND "due date"<2024-06-01 AND -pages<=2`},
+			want: &searchQuery{
+				RawQuery: `amount>100.5 AND "due date"<2024-06-01 AND -pages<=2`,
+				MetadataQuery: []string{"typed.amount > 100.5", "AND", "typed.due_date < 1717200000",
+					"AND", "NOT typed.pages <= 2"},
+				MetadataString: "typed.amount > 100.5 AND typed.due_date < 1717200000 AND NOT typed.pages <= 2",
+			},
+			wantErr: false,
+		},
+		{
+			name: "metadata key exists",
+			args: args{`text amount:* "whitespace key":*`},
+			want: &searchQuery{
+				RawQuery:       `text amount:* "whitespace key":*`,
+				Query:          "text",
+				MetadataQuery:  []string{`metadata_key="amount"`, "AND", `metadata_key="whitespace_key"`},
+				MetadataString: `metadata_key="amount" AND metadata_key="whitespace_key"`,
+			},
+			wantErr: false,
+		},
+		{
+			name: "negation",
+			args: args{"-class:invoice -amount:* -lang:fi -text"},
+			want: &searchQuery{
+				RawQuery:       "-class:invoice -amount:* -lang:fi -text",
+				Query:          "-text",
+				MetadataQuery:  []string{`NOT metadata="class:invoice"`, "AND", `NOT metadata_key="amount"`, "AND", `lang != "fi"`},
+				MetadataString: `NOT metadata="class:invoice" AND NOT metadata_key="amount" AND lang != "fi"`,
+			},
+			wantErr: false,
+		},
+		{
+			name: "metadata prefix",
+			args: args{"topic:t* OR author:du*"},
+			want: &searchQuery{
+				RawQuery:       "topic:t* OR author:du*",
+				MetadataQuery:  []string{`metadata IN ["topic:technology"]`, "OR", `metadata IN ["author:dustin", "author:dubai"]`},
+				MetadataString: `metadata IN ["topic:technology"] OR metadata IN ["author:dustin", "author:dubai"]`,
+			},
+			wantErr: false,
+		},
+		{
+			name: "document type",
+			args: args{`type:invoice or -type:"pay slip"`},
+			want: &searchQuery{
+				RawQuery:       `type:invoice or -type:"pay slip"`,
+				MetadataQuery:  []string{`document_type = "invoice"`, "OR", `document_type != "pay slip"`},
+				MetadataString: `document_type = "invoice" OR document_type != "pay slip"`,
+			},
+			wantErr: false,
+		},
+		{
+			name:    "document type comparison",
+			args:    args{"type>invoice"},
+			want:    &searchQuery{RawQuery: "type>invoice"},
+			wantErr: true,
+		},
+		{
+			name: "metadata prefix no match",
+			args: args{"topic:xyz*"},
+			want: &searchQuery{
+				RawQuery:       "topic:xyz*",
+				MetadataQuery:  []string{`metadata="topic:xyz*"`},
+				MetadataString: `metadata="topic:xyz*"`,
+			},
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := parseFilter(tt.args.filter)
+			got, err := parseFilter(tt.args.filter, newMetadata())
 			if (err != nil) != tt.wantErr {
 				t.Errorf("parseFilter() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -354,6 +480,107 @@ func Test_parseFilter(t *testing.T) {
 	}
 }
 
+func Test_parseFilterErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		filter  string
+		wantErr string
+	}{
+		{
+			name:    "missing value",
+			filter:  "text author:",
+			wantErr: "invalid query at position 6 ('author:'): missing value for 'author'",
+		},
+		{
+			name:    "invalid size",
+			filter:  "size>5xb",
+			wantErr: "invalid query at position 1 ('size>5xb'): invalid size '5xb', expected e.g. 500kb, 5mb or 1gb",
+		},
+		{
+			name:    "non-finite size",
+			filter:  "size>nan",
+			wantErr: "invalid query at position 1 ('size>nan'): invalid size 'nan', expected e.g. 500kb, 5mb or 1gb",
+		},
+		{
+			name:    "too large size",
+			filter:  "size>1e99",
+			wantErr: "invalid query at position 1 ('size>1e99'): invalid size '1e99', expected e.g. 500kb, 5mb or 1gb",
+		},
+		{
+			name:    "size without comparison",
+			filter:  "one size:5mb",
+			wantErr: "invalid query at position 5 ('size:5mb'): size requires a comparison: >, >=, < or <=",
+		},
+		{
+			name:    "invalid date",
+			filter:  "date>2022-13-45",
+			wantErr: "invalid query at position 1 ('date>2022-13-45'): invalid date '2022-13-45'",
+		},
+		{
+			name:    "text metadata comparison",
+			filter:  "class>100",
+			wantErr: "invalid query at position 1 ('class>100'): comparison '>' is not supported for metadata key 'class'",
+		},
+		{
+			name:    "invalid typed metadata comparison",
+			filter:  "amount>lots",
+			wantErr: "invalid query at position 1 ('amount>lots'): invalid money 'lots'",
+		},
+		{
+			name:    "invalid invoice amount",
+			filter:  "invoice.amount>lots",
+			wantErr: "invalid query at position 1 ('invoice.amount>lots'): invalid amount 'lots'",
+		},
+		{
+			name:    "negated invoice due date",
+			filter:  "-invoice.due<today",
+			wantErr: "invalid query at position 1 ('-invoice.due<today'): invoice.due cannot be negated, use date comparison instead",
+		},
+		{
+			name:    "invalid invoice paid",
+			filter:  "invoice.paid:maybe",
+			wantErr: "invalid query at position 1 ('invoice.paid:maybe'): invalid value 'maybe' for invoice.paid, expected yes or no",
+		},
+		{
+			name:    "invoice iban comparison",
+			filter:  "invoice.iban>fi21",
+			wantErr: "invalid query at position 1 ('invoice.iban>fi21'): invoice.iban does not support comparison '>'",
+		},
+		{
+			name:    "negated name",
+			filter:  "-name:test",
+			wantErr: "invalid query at position 1 ('-name:test'): name cannot be negated",
+		},
+		{
+			name:    "name prefix",
+			filter:  "name:test*",
+			wantErr: "invalid query at position 1 ('name:test*'): prefix matching is only supported for metadata",
+		},
+		{
+			name:    "parenthesis not closed",
+			filter:  "a (class:paper OR (class:invoice)",
+			wantErr: "invalid query at position 3 ('('): parenthesis is not closed",
+		},
+		{
+			name:    "extra closing parenthesis",
+			filter:  "class:paper) a",
+			wantErr: "invalid query at position 12 (')'): closing parenthesis without opening one",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseFilter(tt.filter, newMetadata())
+			if err == nil {
+				t.Errorf("parseFilter() expected error")
+				return
+			}
+			if err.Error() != tt.wantErr {
+				t.Errorf("parseFilter() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func timeFromDate(year, month, day int) time.Time {
 	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
 }
@@ -0,0 +1,163 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package search
+
+import (
+	"regexp"
+	"strings"
+
+	"tryffel.net/go/virtualpaper/models"
+)
+
+// maximum number of queries a single search is expanded to with synonyms.
+const maxQueryVariants = 8
+
+// RankingAttributes are the document attributes that user can rank search results with.
+var RankingAttributes = []string{"date", "created_at", "updated_at", "name", "size", "invoice_amount", "invoice_due_date"}
+
+var regexRankingRule = regexp.MustCompile(`^([a-z_]+):(asc|desc)$`)
+
+// IsValidRankingRule returns true if rule is a valid ranking rule, e.g. 'date:desc'.
+func IsValidRankingRule(rule string) bool {
+	match := regexRankingRule.FindStringSubmatch(rule)
+	if len(match) != 3 {
+		return false
+	}
+	return containsString(RankingAttributes, match[1])
+}
+
+// querySettings are user's search settings that are applied to the query.
+type querySettings struct {
+	synonyms  map[string][]string
+	stopWords map[string]bool
+	ranking   []string
+}
+
+func newQuerySettings(settings *models.SearchSettings) *querySettings {
+	qs := &querySettings{
+		synonyms:  map[string][]string{},
+		stopWords: map[string]bool{},
+		ranking:   []string{},
+	}
+	if settings == nil {
+		return qs
+	}
+
+	for _, group := range settings.Synonyms {
+		words := make([]string, len(group.Words))
+		for i, v := range group.Words {
+			words[i] = strings.ToLower(v)
+		}
+		// word may belong to multiple groups
+		for word, synonyms := range buildSynonyms([][]string{words}) {
+			for _, v := range synonyms {
+				if v != word && !containsString(qs.synonyms[word], v) {
+					qs.synonyms[word] = append(qs.synonyms[word], v)
+				}
+			}
+		}
+	}
+	for _, v := range settings.StopWords {
+		qs.stopWords[strings.ToLower(v)] = true
+	}
+	for _, v := range settings.Ranking {
+		if IsValidRankingRule(v) {
+			qs.ranking = append(qs.ranking, v)
+		}
+	}
+	return qs
+}
+
+// expandQuery removes stop words from query and expands the words that have synonyms.
+// Returns the queries to search with, the query without synonyms being first.
+// Quoted phrases are kept as they are.
+func (s *querySettings) expandQuery(query string) []string {
+	tokens := strings.Fields(query)
+	alternatives := make([][]string, 0, len(tokens))
+	quoted := false
+	for _, token := range tokens {
+		inPhrase := quoted || strings.HasPrefix(token, "\"")
+		if strings.Count(token, "\"")%2 == 1 {
+			quoted = !quoted
+		}
+		if inPhrase {
+			alternatives = append(alternatives, []string{token})
+			continue
+		}
+		word := strings.ToLower(token)
+		if s.stopWords[word] {
+			continue
+		}
+		alternatives = append(alternatives, append([]string{token}, s.synonyms[word]...))
+	}
+	if len(alternatives) == 0 {
+		// query contains only stop words, search with the original query rather than matching everything.
+		return []string{query}
+	}
+
+	queries := [][]string{{}}
+	for _, words := range alternatives {
+		next := make([][]string, 0, len(queries)*len(words))
+		for _, word := range words {
+			for _, q := range queries {
+				if len(next) >= maxQueryVariants {
+					break
+				}
+				variant := append(append(make([]string, 0, len(q)+1), q...), word)
+				next = append(next, variant)
+			}
+		}
+		queries = next
+	}
+
+	result := make([]string, len(queries))
+	for i, v := range queries {
+		result[i] = strings.Join(v, " ")
+	}
+	return result
+}
+
+// mergeHits merges the hits from multiple queries. Hits are interleaved to keep the ranking of each query,
+// and duplicate documents are removed.
+func mergeHits(results [][]interface{}) []interface{} {
+	merged := make([]interface{}, 0)
+	seen := map[string]bool{}
+	for i := 0; ; i++ {
+		found := false
+		for _, hits := range results {
+			if i >= len(hits) {
+				continue
+			}
+			found = true
+			hit := hits[i]
+			if doc, ok := hit.(map[string]interface{}); ok {
+				id := getString("document_id", doc)
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+			}
+			merged = append(merged, hit)
+		}
+		if !found {
+			break
+		}
+	}
+	return merged
+}
@@ -0,0 +1,81 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+
+	"tryffel.net/go/virtualpaper/models"
+)
+
+func TestIsValidRankingRule(t *testing.T) {
+	tests := map[string]bool{
+		"date:desc":      true,
+		"created_at:asc": true,
+		"size:desc":      true,
+		"date":           false,
+		"date:up":        false,
+		"content:asc":    false,
+		"":               false,
+	}
+	for rule, want := range tests {
+		if got := IsValidRankingRule(rule); got != want {
+			t.Errorf("IsValidRankingRule(%s) = %v, want %v", rule, got, want)
+		}
+	}
+}
+
+func Test_querySettings_expandQuery(t *testing.T) {
+	settings := newQuerySettings(&models.SearchSettings{
+		Synonyms: []models.SearchSynonym{
+			{Words: []string{"Car", "automobile"}},
+			{Words: []string{"invoice", "bill", "receipt"}},
+		},
+		StopWords: []string{"the", "A"},
+		Ranking:   []string{"date:desc", "invalid"},
+	})
+
+	if !reflect.DeepEqual(settings.ranking, []string{"date:desc"}) {
+		t.Errorf("expected invalid ranking rules to be ignored, got %v", settings.ranking)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"no synonyms", "insurance policy", []string{"insurance policy"}},
+		{"stop words", "the insurance of a car", []string{"insurance of car", "insurance of automobile"}},
+		{"only stop words", "the a", []string{"the a"}},
+		{"case insensitive", "CAR", []string{"CAR", "automobile"}},
+		{"multiple synonyms", "car invoice", []string{
+			"car invoice", "automobile invoice", "car bill", "automobile bill", "car receipt", "automobile receipt"}},
+		{"phrase", `"the car" invoice`, []string{`"the car" invoice`, `"the car" bill`, `"the car" receipt`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := settings.expandQuery(tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandQuery() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	got := settings.expandQuery("car car car car")
+	if len(got) != maxQueryVariants || got[0] != "car car car car" {
+		t.Errorf("expected %d variants with original query first, got %v", maxQueryVariants, got)
+	}
+}
+
+func Test_mergeHits(t *testing.T) {
+	hit := func(id string) interface{} {
+		return map[string]interface{}{"document_id": id}
+	}
+	results := [][]interface{}{
+		{hit("a"), hit("b"), hit("c")},
+		{hit("d"), hit("a")},
+		{},
+	}
+	want := []interface{}{hit("a"), hit("d"), hit("b"), hit("c")}
+	if got := mergeHits(results); !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeHits() = %v, want %v", got, want)
+	}
+}
@@ -94,6 +94,21 @@ func (m *metadataSuggest) queryValues(key, value string) []string {
 	return data
 }
 
+func (m *metadataSuggest) queryValuesWithPrefix(key, prefix string) []string {
+	values, err := m.db.MetadataStore.GetUserKeyValuesCached(m.userId, key)
+	if err != nil {
+		logrus.Error(err)
+		return []string{}
+	}
+	data := []string{}
+	for _, v := range *values {
+		if strings.HasPrefix(v.Value, prefix) {
+			data = append(data, v.Value)
+		}
+	}
+	return data
+}
+
 func (m *metadataSuggest) queryLangs(key string) []string {
 	candidates, err := m.db.MetadataStore.GetUserLangsCached(m.userId)
 	if err != nil {
@@ -115,6 +130,46 @@ func (m *metadataSuggest) queryLangs(key string) []string {
 	return values
 }
 
+func (m *metadataSuggest) queryKeyType(key string) models.MetadataKeyType {
+	keys, err := m.db.MetadataStore.GetUserKeysCached(m.userId)
+	if err != nil {
+		logrus.Error(err)
+		return models.MetadataKeyTypeText
+	}
+	for _, v := range *keys {
+		if v.Key == key || normalizeMetadataKey(v.Key) == key {
+			return v.Type
+		}
+	}
+	return models.MetadataKeyTypeText
+}
+
+func (m *metadataSuggest) queryValueDescendants(key, value string) []string {
+	values, err := m.db.MetadataStore.GetValueDescendants(m.userId, key, value)
+	if err != nil {
+		logrus.Error(err)
+		return []string{}
+	}
+	return values
+}
+
+func (m *metadataSuggest) queryDocumentTypes(name string) []string {
+	types, _, err := m.db.MetadataStore.GetDocumentTypes(m.userId, storage.SortKey{}, storage.Paging{Limit: MaxSuggestMetadata})
+	if err != nil {
+		logrus.Error(err)
+		return []string{}
+	}
+	lowerName := strings.ToLower(name)
+	values := make([]string, 0, len(types))
+	for _, v := range types {
+		typeName := strings.ToLower(v.Name)
+		if strings.Contains(typeName, lowerName) {
+			values = append(values, typeName)
+		}
+	}
+	return values
+}
+
 type searchQuery struct {
 	RawQuery       string
 	Query          string
@@ -136,17 +191,24 @@ func (s *searchQuery) addSuggestion(text string) {
 	s.Suggestions = append(s.Suggestions, text)
 }
 
+var searchAttributesToRetrieve = []string{"document_id", "name", "content", "description", "date", "mimetype", "lang", "shares", "owner_id",
+	"invoice_amount", "invoice_currency", "invoice_due_date"}
+
 func (s *searchQuery) prepareMeiliQuery(userId int, sort storage.SortKey, paging storage.Paging) *meilisearch.SearchRequest {
 	request := &meilisearch.SearchRequest{
 		Offset:                int64(paging.Offset),
 		Limit:                 int64(paging.Limit),
-		AttributesToRetrieve:  []string{"document_id", "name", "content", "description", "date", "mimetype", "lang", "shares", "owner_id"},
+		AttributesToRetrieve:  searchAttributesToRetrieve,
 		AttributesToCrop:      []string{"content"},
 		CropLength:            1000,
 		AttributesToHighlight: []string{"name"},
 		PlaceholderSearch:     false,
 	}
-	filter := strings.TrimSuffix(s.MetadataString, "AND")
+	filter := strings.TrimSpace(strings.TrimSuffix(s.MetadataString, "AND"))
+	if filter != "" {
+		// query may contain OR-operators, keep them from escaping the rest of the filters
+		filter = "(" + filter + ")"
+	}
 	if s.Query == "" {
 		request.PlaceholderSearch = true
 	}
@@ -328,15 +390,55 @@ func suggest(query string, metadata metadataQuerier) *QuerySuggestions {
 		}
 	}
 
-	keys := []string{"name", "description", "content", "date", "lang", "owner", "shared"}
+	keys := []string{"name", "description", "content", "date", "lang", "owner", "shared", "type"}
 	operators := []string{"AND", "OR", "NOT"}
 
+	// negated filter, e.g. '-class:invoice'. Only metadata, lang and type can be negated.
+	negation := ""
+	if strings.HasPrefix(lastToken, "-") && len(lastToken) > 1 {
+		negation = "-"
+		lastToken = lastToken[1:]
+		keys = []string{"lang", "type"}
+	}
+
 	parts := strings.Split(lastToken, ":")
-	if len(parts) == 1 {
+	if expr, ok := parseFilterExpression(filterToken{value: lastToken}); ok && expr.comparator != ":" && negation == "" {
+		// comparison, e.g. 'size>5mb'
+		for _, v := range suggestComparison(expr.key, expr.value) {
+			qs.addSuggestionValues(v, SuggestionTypeKey, "")
+		}
+		qs.Prefix = strings.Join(append(normalizedTokens, expr.key+expr.comparator), " ")
+	} else if len(parts) == 1 {
 		// no value yet, suggest key
 		for _, v := range keys {
 			if strings.Contains(v, parts[0]) {
-				qs.addSuggestionValues(v+":", SuggestionTypeKey, "")
+				qs.addSuggestionValues(negation+v+":", SuggestionTypeKey, "")
+			}
+		}
+		if negation == "" {
+			if parts[0] == "date" {
+				qs.addSuggestionValues("date>", SuggestionTypeKey, "after")
+				qs.addSuggestionValues("date<", SuggestionTypeKey, "before")
+			}
+			if strings.Contains("size", parts[0]) {
+				qs.addSuggestionValues("size>", SuggestionTypeKey, "larger than")
+				qs.addSuggestionValues("size<", SuggestionTypeKey, "smaller than")
+			}
+			if len(parts[0]) > 2 && strings.HasPrefix("invoice.amount", parts[0]) {
+				qs.addSuggestionValues("invoice.amount>", SuggestionTypeKey, "larger than")
+			}
+			if len(parts[0]) > 2 && strings.HasPrefix("invoice.due", parts[0]) {
+				qs.addSuggestionValues("invoice.due<", SuggestionTypeKey, "due before")
+			}
+			if len(parts[0]) > 2 && strings.HasPrefix("invoice.paid", parts[0]) {
+				qs.addSuggestionValues("invoice.paid:", SuggestionTypeKey, "")
+			}
+		}
+		if len(parts[0]) > 2 {
+			for _, v := range []string{"invoice.currency", "invoice.iban", "invoice.reference", "invoice.vat"} {
+				if strings.HasPrefix(v, parts[0]) {
+					qs.addSuggestionValues(negation+v+":", SuggestionTypeKey, "")
+				}
 			}
 		}
 
@@ -345,7 +447,7 @@ func suggest(query string, metadata metadataQuerier) *QuerySuggestions {
 			if strings.Contains(v, " ") {
 				v = `"` + v + `"`
 			}
-			qs.addSuggestionValues(v+":", SuggestionTypeMetadata, "")
+			qs.addSuggestionValues(negation+v+":", SuggestionTypeMetadata, "")
 		}
 
 		// suggest values too
@@ -355,7 +457,7 @@ func suggest(query string, metadata metadataQuerier) *QuerySuggestions {
 				// show only 5 keys per key when still typing key
 				break
 			}
-			qs.addSuggestionValues(parts[0]+":"+escapeMetadataValue(v), SuggestionTypeMetadata, "")
+			qs.addSuggestionValues(negation+parts[0]+":"+escapeMetadataValue(v), SuggestionTypeMetadata, "")
 		}
 
 		qs.Prefix = strings.Join(normalizedTokens, " ") + " "
@@ -392,6 +494,15 @@ func suggest(query string, metadata metadataQuerier) *QuerySuggestions {
 					qs.addSuggestionValues(v, SuggestionTypeKey, "")
 				}
 			}
+		} else if parts[0] == "type" {
+			typeSuggestions := metadata.queryDocumentTypes(parts[1])
+			tokenPrefix = "type:"
+			if len(typeSuggestions) > 0 {
+				addWhiteSpace = false
+				for _, v := range typeSuggestions {
+					qs.addSuggestionValues(escapeMetadataValue(v), SuggestionTypeKey, "")
+				}
+			}
 		} else if parts[0] == "owner" {
 			ownerSuggestions := suggestOwner(parts[1])
 			tokenPrefix = "owner:"
@@ -402,6 +513,15 @@ func suggest(query string, metadata metadataQuerier) *QuerySuggestions {
 					qs.addSuggestionValues(v, SuggestionTypeKey, "")
 				}
 			}
+		} else if parts[0] == "invoice.paid" {
+			paidSuggestions := suggestShared(parts[1])
+			tokenPrefix = "invoice.paid:"
+			if len(paidSuggestions) > 0 {
+				addWhiteSpace = false
+				for _, v := range paidSuggestions {
+					qs.addSuggestionValues(v, SuggestionTypeKey, "")
+				}
+			}
 		} else if parts[0] == "shared" {
 			ownerSuggestions := suggestShared(parts[1])
 			tokenPrefix = "shared:"
@@ -425,6 +545,9 @@ func suggest(query string, metadata metadataQuerier) *QuerySuggestions {
 				}
 				qs.addSuggestionValues(escapeMetadataValue(v), SuggestionTypeMetadata, "")
 			}
+			if parts[1] == "" && len(values) > 0 {
+				qs.addSuggestionValues("*", SuggestionTypeMetadata, "any value")
+			}
 			if len(values) > 0 && !perfectMatch {
 				tokenPrefix = tokenPrefix + ":"
 				addWhiteSpace = false
@@ -432,7 +555,7 @@ func suggest(query string, metadata metadataQuerier) *QuerySuggestions {
 
 			}
 		}
-		qs.Prefix = strings.Join(append(normalizedTokens, tokenPrefix), " ")
+		qs.Prefix = strings.Join(append(normalizedTokens, negation+tokenPrefix), " ")
 		if addWhiteSpace {
 			qs.Prefix += " "
 		}
@@ -480,7 +603,7 @@ func suggest(query string, metadata metadataQuerier) *QuerySuggestions {
 
 func suggestEmpty(metadata metadataQuerier) []Suggestion {
 
-	keys := []string{"name", "description", "content", "date", "lang", "owner", "shared"}
+	keys := []string{"name", "description", "content", "date", "lang", "owner", "shared", "size", "type"}
 	results := metadata.queryKeys("", "", ":")
 
 	suggestions := make([]Suggestion, 0, len(keys)+len(results))
@@ -642,6 +765,37 @@ func parseDateFromLayout(token string, addDigit bool, removeDigit bool) time.Tim
 	return time.Time{}
 }
 
+// suggestComparison suggests values for comparisons, e.g. 'date>' or 'size<'.
+func suggestComparison(key, token string) []string {
+	candidates := []string{}
+	switch key {
+	case "date":
+		now := time.Now().UTC()
+		candidates = []string{"today", "yesterday", now.Format("2006"), now.Format("2006-1"), now.Format("2006-1-2")}
+	case "size":
+		candidates = []string{"100kb", "1mb", "10mb", "100mb"}
+	case "invoice.due":
+		now := time.Now().UTC()
+		candidates = []string{"today", now.Format("2006-1"), now.Format("2006-1-2")}
+	case "invoice.amount":
+		candidates = []string{"100", "500", "1000"}
+	case "invoice.paid":
+		now := time.Now().UTC()
+		candidates = []string{"today", now.Format("2006-1"), now.Format("2006-1-2")}
+	}
+	if token == "" {
+		return candidates
+	}
+
+	suggestions := make([]string, 0, len(candidates))
+	for _, v := range candidates {
+		if strings.HasPrefix(v, token) && v != token {
+			suggestions = append(suggestions, v)
+		}
+	}
+	return suggestions
+}
+
 func suggestOwner(token string) []string {
 	keys := []string{"me", "anyone", "others"}
 	if token == "" {
@@ -677,5 +831,12 @@ func suggestShared(token string) []string {
 type metadataQuerier interface {
 	queryKeys(key string, prefis string, suffix string) []string
 	queryValues(key, value string) []string
+	queryValuesWithPrefix(key, prefix string) []string
 	queryLangs(key string) []string
+	// queryKeyType returns the type of the key, or text if key does not exist.
+	queryKeyType(key string) models.MetadataKeyType
+	// queryValueDescendants returns the values under the value in the value hierarchy.
+	queryValueDescendants(key, value string) []string
+	// queryDocumentTypes returns the lower-case names of document types that contain the name.
+	queryDocumentTypes(name string) []string
 }
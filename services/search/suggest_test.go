@@ -80,12 +80,26 @@ func Test_matchDate(t *testing.T) {
 type metadata struct {
 	keys     []string
 	metadata map[string][]models.Metadata
+	keyTypes map[string]models.MetadataKeyType
+	// children maps key and value to the child values
+	children map[string]map[string][]string
 }
 
 func newMetadata() *metadata {
 	m := &metadata{
 		keys:     []string{},
 		metadata: make(map[string][]models.Metadata),
+		keyTypes: map[string]models.MetadataKeyType{
+			"amount":   models.MetadataKeyTypeMoney,
+			"due date": models.MetadataKeyTypeDate,
+			"pages":    models.MetadataKeyTypeNumber,
+		},
+		children: map[string]map[string][]string{
+			"project": {
+				"acme":      {"acme/2023", "acme/2024"},
+				"acme/2024": {"acme/2024/phase-2"},
+			},
+		},
 	}
 	m.addKey("class")
 	m.addKey("author")
@@ -154,10 +168,46 @@ func (m *metadata) queryValues(key, value string) []string {
 	}
 	return results
 }
+func (m *metadata) queryValuesWithPrefix(key, prefix string) []string {
+	results := []string{}
+	for _, v := range m.metadata[key] {
+		if strings.HasPrefix(v.Value, prefix) {
+			results = append(results, v.Value)
+		}
+	}
+	return results
+}
+
 func (m *metadata) queryLangs(key string) []string {
 	return []string{"fi", "en"}
 }
 
+func (m *metadata) queryValueDescendants(key, value string) []string {
+	results := []string{}
+	for _, child := range m.children[key][value] {
+		results = append(results, child)
+		results = append(results, m.queryValueDescendants(key, child)...)
+	}
+	return results
+}
+
+func (m *metadata) queryDocumentTypes(name string) []string {
+	results := []string{}
+	for _, v := range []string{"invoice", "contract", "pay slip"} {
+		if strings.Contains(v, name) {
+			results = append(results, v)
+		}
+	}
+	return results
+}
+
+func (m *metadata) queryKeyType(key string) models.MetadataKeyType {
+	if keyType, ok := m.keyTypes[key]; ok {
+		return keyType
+	}
+	return models.MetadataKeyTypeText
+}
+
 func Test_suggest(t *testing.T) {
 	metadata := newMetadata()
 
@@ -180,6 +230,8 @@ func Test_suggest(t *testing.T) {
 				{Value: "lang", Type: "key", Hint: ""},
 				{Value: "owner", Type: "key", Hint: ""},
 				{Value: "shared", Type: "key", Hint: ""},
+				{Value: "size", Type: "key", Hint: ""},
+				{Value: "type", Type: "key", Hint: ""},
 				{Value: "class", Type: "metadata", Hint: ""},
 				{Value: "author", Type: "metadata", Hint: ""},
 				{Value: "authentic", Type: "metadata", Hint: ""},
@@ -301,6 +353,7 @@ func Test_suggest(t *testing.T) {
 				{Value: "doyle", Type: "metadata", Hint: ""},
 				{Value: "dustin", Type: "metadata", Hint: ""},
 				{Value: "dubai", Type: "metadata", Hint: ""},
+				{Value: "*", Type: "metadata", Hint: "any value"},
 			}, Prefix: "one author:", ValidQuery: false},
 		},
 		{
@@ -338,6 +391,22 @@ func Test_suggest(t *testing.T) {
 				{Value: "lang:", Type: "key"},
 			}, Prefix: "one ", ValidQuery: false},
 		},
+		{
+			name: "document type value",
+			args: args{"one type:"},
+			want: &QuerySuggestions{Suggestions: []Suggestion{
+				{Value: "invoice", Type: "key"},
+				{Value: "contract", Type: "key"},
+				{Value: `"pay slip"`, Type: "key"},
+			}, Prefix: "one type:", ValidQuery: false},
+		},
+		{
+			name: "negated document type value",
+			args: args{"-type:con"},
+			want: &QuerySuggestions{Suggestions: []Suggestion{
+				{Value: "contract", Type: "key"},
+			}, Prefix: "-type:", ValidQuery: false},
+		},
 		{
 			name: "owner",
 			args: args{"own"},
@@ -369,6 +438,85 @@ func Test_suggest(t *testing.T) {
 				{Value: "no", Type: "key"},
 			}, Prefix: "shared:", ValidQuery: false},
 		},
+		{
+			name: "size comparison",
+			args: args{"one siz"},
+			want: &QuerySuggestions{Suggestions: []Suggestion{
+				{Value: "size>", Type: "key", Hint: "larger than"},
+				{Value: "size<", Type: "key", Hint: "smaller than"},
+			}, Prefix: "one ", ValidQuery: false},
+		},
+		{
+			name: "size value",
+			args: args{"one size>1"},
+			want: &QuerySuggestions{Suggestions: []Suggestion{
+				{Value: "100kb", Type: "key"},
+				{Value: "1mb", Type: "key"},
+				{Value: "10mb", Type: "key"},
+				{Value: "100mb", Type: "key"},
+			}, Prefix: "one size>", ValidQuery: false},
+		},
+		{
+			name: "invoice fields",
+			args: args{"one invoice.a"},
+			want: &QuerySuggestions{Suggestions: []Suggestion{
+				{Value: "invoice.amount>", Type: "key", Hint: "larger than"},
+			}, Prefix: "one ", ValidQuery: false},
+		},
+		{
+			name: "invoice paid",
+			args: args{"one invoice.p"},
+			want: &QuerySuggestions{Suggestions: []Suggestion{
+				{Value: "invoice.paid:", Type: "key"},
+			}, Prefix: "one ", ValidQuery: false},
+		},
+		{
+			name: "invoice paid value",
+			args: args{"one invoice.paid:"},
+			want: &QuerySuggestions{Suggestions: []Suggestion{
+				{Value: "yes", Type: "key"},
+				{Value: "no", Type: "key"},
+			}, Prefix: "one invoice.paid:", ValidQuery: false},
+		},
+		{
+			name: "invoice amount value",
+			args: args{"one invoice.amount>1"},
+			want: &QuerySuggestions{Suggestions: []Suggestion{
+				{Value: "100", Type: "key"},
+				{Value: "1000", Type: "key"},
+			}, Prefix: "one invoice.amount>", ValidQuery: false},
+		},
+		{
+			name: "date comparison",
+			args: args{"one date"},
+			want: &QuerySuggestions{Suggestions: []Suggestion{
+				{Value: "date:", Type: "key"},
+				{Value: "date>", Type: "key", Hint: "after"},
+				{Value: "date<", Type: "key", Hint: "before"},
+			}, Prefix: "one ", ValidQuery: false},
+		},
+		{
+			name: "date comparison value",
+			args: args{"date>=yes"},
+			want: &QuerySuggestions{Suggestions: []Suggestion{
+				{Value: "yesterday", Type: "key"},
+			}, Prefix: "date>=", ValidQuery: false},
+		},
+		{
+			name: "negated metadata key",
+			args: args{"one -autho"},
+			want: &QuerySuggestions{Suggestions: []Suggestion{
+				{Value: "-author:", Type: "metadata"},
+			}, Prefix: "one ", ValidQuery: false},
+		},
+		{
+			name: "negated metadata value",
+			args: args{"one -author:du"},
+			want: &QuerySuggestions{Suggestions: []Suggestion{
+				{Value: "dustin", Type: "metadata"},
+				{Value: "dubai", Type: "metadata"},
+			}, Prefix: "one -author:", ValidQuery: false},
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,250 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/meilisearch/meilisearch-go"
+	"github.com/sirupsen/logrus"
+	"tryffel.net/go/virtualpaper/models"
+)
+
+// default number of documents to read and index at once.
+const verifyBatchSize = 200
+
+// stages of index verification.
+const (
+	VerifyStageDatabase = "database"
+	VerifyStageIndex    = "index"
+	VerifyStageReindex  = "reindex"
+	VerifyStageDelete   = "delete"
+	VerifyStageDone     = "done"
+)
+
+// VerifyOptions configure index verification.
+type VerifyOptions struct {
+	// UserId limits verification to user's documents. 0 verifies all documents.
+	UserId int
+	// DryRun only reports the differences and does not modify the index.
+	DryRun bool
+	// BatchSize is the number of documents to handle at once. Defaults to verifyBatchSize.
+	BatchSize int
+	// Progress is called after each batch, if set.
+	Progress func(progress VerifyProgress)
+}
+
+// VerifyProgress describes current stage of verification.
+type VerifyProgress struct {
+	Stage     string `json:"stage"`
+	Processed int    `json:"processed"`
+	// Total is the number of items in current stage, or 0 if not known.
+	Total int `json:"total"`
+}
+
+// VerifyReport contains the differences between database and search index.
+type VerifyReport struct {
+	UserId    int  `json:"user_id"`
+	DryRun    bool `json:"dry_run"`
+	Documents int  `json:"documents"`
+	Indexed   int  `json:"indexed"`
+	// documents that exist in database but not in index
+	Missing []string `json:"missing"`
+	// documents that have been modified after indexing
+	Stale []string `json:"stale"`
+	// documents in index that do not exist in database or are deleted
+	Orphaned  []string `json:"orphaned"`
+	Reindexed int      `json:"reindexed"`
+	Deleted   int      `json:"deleted"`
+}
+
+// indexedDocument is the document info stored in search index.
+type indexedDocument struct {
+	DocumentId string
+	OwnerId    int
+	UpdatedAt  int64
+}
+
+// compareIndex compares database documents with indexed documents and returns missing, stale and orphaned
+// document ids in sorted order.
+func compareIndex(docs map[string]models.DocumentIndexState, indexed map[string]indexedDocument) (missing, stale, orphaned []string) {
+	missing = []string{}
+	stale = []string{}
+	orphaned = []string{}
+	for id, doc := range docs {
+		item, ok := indexed[id]
+		if !ok {
+			missing = append(missing, id)
+		} else if item.UpdatedAt != doc.UpdatedAt.Unix() || item.OwnerId != doc.UserId {
+			stale = append(stale, id)
+		}
+	}
+	for id := range indexed {
+		if _, ok := docs[id]; !ok {
+			orphaned = append(orphaned, id)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(stale)
+	sort.Strings(orphaned)
+	return
+}
+
+// parseIndexedDocument reads document info from meilisearch document.
+func parseIndexedDocument(doc map[string]interface{}) (indexedDocument, bool) {
+	id, ok := doc["document_id"].(string)
+	if !ok {
+		return indexedDocument{}, false
+	}
+	item := indexedDocument{DocumentId: id}
+	if owner, ok := doc["owner_id"].(float64); ok {
+		item.OwnerId = int(owner)
+	}
+	if updatedAt, ok := doc["updated_at"].(float64); ok {
+		item.UpdatedAt = int64(updatedAt)
+	}
+	return item, true
+}
+
+// VerifyIndex compares search index against database and, unless opts.DryRun is set, re-indexes missing and stale
+// documents and deletes orphaned documents from the index.
+func (e *Engine) VerifyIndex(ctx context.Context, opts VerifyOptions) (*VerifyReport, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = verifyBatchSize
+	}
+	progress := func(stage string, processed, total int) {
+		if opts.Progress != nil {
+			opts.Progress(VerifyProgress{Stage: stage, Processed: processed, Total: total})
+		}
+	}
+
+	docs := make(map[string]models.DocumentIndexState)
+	lastId := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		batch, err := e.db.DocumentStore.GetIndexState(opts.UserId, lastId, opts.BatchSize)
+		if err != nil {
+			return nil, fmt.Errorf("get documents: %v", err)
+		}
+		for _, v := range batch {
+			docs[v.DocumentId] = v
+		}
+		progress(VerifyStageDatabase, len(docs), 0)
+		if len(batch) < opts.BatchSize {
+			break
+		}
+		lastId = batch[len(batch)-1].DocumentId
+	}
+
+	indexed := make(map[string]indexedDocument)
+	for offset := 0; ; offset += opts.BatchSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		resp := &meilisearch.DocumentsResult{}
+		err := e.client.Index(indexName()).GetDocuments(&meilisearch.DocumentsQuery{
+			Offset: int64(offset),
+			Limit:  int64(opts.BatchSize),
+			Fields: []string{"document_id", "owner_id", "updated_at"},
+		}, resp)
+		if err != nil {
+			return nil, fmt.Errorf("get indexed documents: %v", err)
+		}
+		for _, v := range resp.Results {
+			item, ok := parseIndexedDocument(v)
+			if !ok {
+				continue
+			}
+			if opts.UserId != 0 && item.OwnerId != opts.UserId {
+				continue
+			}
+			indexed[item.DocumentId] = item
+		}
+		progress(VerifyStageIndex, offset+len(resp.Results), int(resp.Total))
+		if len(resp.Results) < opts.BatchSize {
+			break
+		}
+	}
+
+	report := &VerifyReport{
+		UserId:    opts.UserId,
+		DryRun:    opts.DryRun,
+		Documents: len(docs),
+		Indexed:   len(indexed),
+	}
+	report.Missing, report.Stale, report.Orphaned = compareIndex(docs, indexed)
+	logrus.Infof("search index verification: %d documents, %d indexed, %d missing, %d stale, %d orphaned",
+		report.Documents, report.Indexed, len(report.Missing), len(report.Stale), len(report.Orphaned))
+
+	if opts.DryRun {
+		progress(VerifyStageDone, 0, 0)
+		return report, nil
+	}
+
+	reindex := append(append([]string{}, report.Missing...), report.Stale...)
+	for start := 0; start < len(reindex); start += opts.BatchSize {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		end := start + opts.BatchSize
+		if end > len(reindex) {
+			end = len(reindex)
+		}
+		n, err := e.reindexDocuments(reindex[start:end])
+		report.Reindexed += n
+		if err != nil {
+			return report, err
+		}
+		progress(VerifyStageReindex, end, len(reindex))
+	}
+
+	for start := 0; start < len(report.Orphaned); start += opts.BatchSize {
+		end := start + opts.BatchSize
+		if end > len(report.Orphaned) {
+			end = len(report.Orphaned)
+		}
+		_, err := e.client.Index(indexName()).DeleteDocuments(report.Orphaned[start:end])
+		if err != nil {
+			return report, fmt.Errorf("delete orphaned documents: %v", err)
+		}
+		report.Deleted += end - start
+		progress(VerifyStageDelete, end, len(report.Orphaned))
+	}
+	progress(VerifyStageDone, 0, 0)
+	return report, nil
+}
+
+// reindexDocuments reads documents with their tags and metadata and sends them to the index.
+// Returns number of documents indexed.
+func (e *Engine) reindexDocuments(ids []string) (int, error) {
+	docs, err := e.db.DocumentStore.GetDocumentsById(e.db, 0, ids)
+	if err != nil {
+		return 0, fmt.Errorf("get documents: %v", err)
+	}
+
+	byUser := make(map[int][]models.Document)
+	for _, doc := range *docs {
+		tags, err := e.db.MetadataStore.GetDocumentTags(doc.UserId, doc.Id)
+		if err == nil {
+			doc.Tags = *tags
+		}
+		metadata, err := e.db.MetadataStore.GetDocumentMetadata(doc.UserId, doc.Id)
+		if err != nil {
+			return 0, fmt.Errorf("get document metadata: %v", err)
+		}
+		doc.Metadata = *metadata
+		byUser[doc.UserId] = append(byUser[doc.UserId], doc)
+	}
+
+	indexed := 0
+	for userId, userDocs := range byUser {
+		err = e.IndexDocuments(&userDocs, userId)
+		if err != nil {
+			return indexed, err
+		}
+		indexed += len(userDocs)
+	}
+	return indexed, nil
+}
@@ -0,0 +1,57 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"tryffel.net/go/virtualpaper/models"
+)
+
+func Test_compareIndex(t *testing.T) {
+	updated := time.Unix(1680000000, 0)
+	docs := map[string]models.DocumentIndexState{
+		"ok":      {DocumentId: "ok", UserId: 1, UpdatedAt: updated},
+		"missing": {DocumentId: "missing", UserId: 1, UpdatedAt: updated},
+		"stale":   {DocumentId: "stale", UserId: 1, UpdatedAt: updated.Add(time.Minute)},
+		"owner":   {DocumentId: "owner", UserId: 2, UpdatedAt: updated},
+	}
+	indexed := map[string]indexedDocument{
+		"ok":       {DocumentId: "ok", OwnerId: 1, UpdatedAt: updated.Unix()},
+		"stale":    {DocumentId: "stale", OwnerId: 1, UpdatedAt: updated.Unix()},
+		"owner":    {DocumentId: "owner", OwnerId: 1, UpdatedAt: updated.Unix()},
+		"orphaned": {DocumentId: "orphaned", OwnerId: 1, UpdatedAt: updated.Unix()},
+	}
+
+	missing, stale, orphaned := compareIndex(docs, indexed)
+	if !reflect.DeepEqual(missing, []string{"missing"}) {
+		t.Errorf("missing = %v", missing)
+	}
+	if !reflect.DeepEqual(stale, []string{"owner", "stale"}) {
+		t.Errorf("stale = %v", stale)
+	}
+	if !reflect.DeepEqual(orphaned, []string{"orphaned"}) {
+		t.Errorf("orphaned = %v", orphaned)
+	}
+
+	missing, stale, orphaned = compareIndex(map[string]models.DocumentIndexState{}, map[string]indexedDocument{})
+	if len(missing) != 0 || len(stale) != 0 || len(orphaned) != 0 {
+		t.Errorf("expected no differences for empty input")
+	}
+}
+
+func Test_parseIndexedDocument(t *testing.T) {
+	got, ok := parseIndexedDocument(map[string]interface{}{
+		"document_id": "abc",
+		"owner_id":    float64(2),
+		"updated_at":  float64(1680000000),
+	})
+	want := indexedDocument{DocumentId: "abc", OwnerId: 2, UpdatedAt: 1680000000}
+	if !ok || got != want {
+		t.Errorf("parseIndexedDocument() = %v, %t, want %v", got, ok, want)
+	}
+
+	if _, ok := parseIndexedDocument(map[string]interface{}{"owner_id": float64(2)}); ok {
+		t.Errorf("expected document without id to be skipped")
+	}
+}
@@ -2,6 +2,8 @@ package services
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"tryffel.net/go/virtualpaper/errors"
 	"tryffel.net/go/virtualpaper/models"
 	"tryffel.net/go/virtualpaper/models/aggregates"
@@ -76,3 +78,136 @@ func (service *UserService) GetUsers(ctx context.Context) (*[]aggregates.User, e
 	}
 	return &users, nil
 }
+
+const (
+	maxSynonymGroups   = 500
+	maxSynonymWords    = 20
+	maxStopWords       = 500
+	maxSearchWordLen   = 50
+	maxSearchRankRules = 5
+)
+
+// normalizeSearchWords trims and lowercases words and validates that each of them is a single word.
+func normalizeSearchWords(words []string) ([]string, error) {
+	normalized := make([]string, 0, len(words))
+	for _, v := range words {
+		word := strings.ToLower(strings.TrimSpace(v))
+		if word == "" {
+			continue
+		}
+		if len([]rune(word)) > maxSearchWordLen {
+			e := errors.ErrInvalid
+			e.ErrMsg = fmt.Sprintf("word '%s' is too long, max %d characters", word, maxSearchWordLen)
+			return nil, e
+		}
+		if len(strings.Fields(word)) != 1 {
+			e := errors.ErrInvalid
+			e.ErrMsg = fmt.Sprintf("'%s' is not a single word", word)
+			return nil, e
+		}
+		duplicate := false
+		for _, existing := range normalized {
+			if existing == word {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			normalized = append(normalized, word)
+		}
+	}
+	return normalized, nil
+}
+
+func (service *UserService) GetSearchSettings(ctx context.Context, userId int) (*models.SearchSettings, error) {
+	return service.db.UserStore.GetSearchSettings(userId)
+}
+
+func validateSynonym(synonym *models.SearchSynonym) error {
+	words, err := normalizeSearchWords(synonym.Words)
+	if err != nil {
+		return err
+	}
+	if len(words) < 2 || len(words) > maxSynonymWords {
+		e := errors.ErrInvalid
+		e.ErrMsg = fmt.Sprintf("synonym group must have 2 - %d words", maxSynonymWords)
+		return e
+	}
+	synonym.Words = words
+	return nil
+}
+
+func (service *UserService) AddSearchSynonym(ctx context.Context, synonym *models.SearchSynonym) error {
+	err := validateSynonym(synonym)
+	if err != nil {
+		return err
+	}
+	existing, err := service.db.UserStore.GetSearchSynonyms(synonym.UserId)
+	if err != nil {
+		return err
+	}
+	if len(existing) >= maxSynonymGroups {
+		e := errors.ErrInvalid
+		e.ErrMsg = fmt.Sprintf("maximum number of synonym groups is %d", maxSynonymGroups)
+		return e
+	}
+	return service.db.UserStore.AddSearchSynonym(synonym)
+}
+
+func (service *UserService) UpdateSearchSynonym(ctx context.Context, synonym *models.SearchSynonym) error {
+	err := validateSynonym(synonym)
+	if err != nil {
+		return err
+	}
+	return service.db.UserStore.UpdateSearchSynonym(synonym)
+}
+
+func (service *UserService) DeleteSearchSynonym(ctx context.Context, userId int, id int) error {
+	return service.db.UserStore.DeleteSearchSynonym(userId, id)
+}
+
+func (service *UserService) SetSearchStopWords(ctx context.Context, userId int, words []string) ([]string, error) {
+	words, err := normalizeSearchWords(words)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) > maxStopWords {
+		e := errors.ErrInvalid
+		e.ErrMsg = fmt.Sprintf("maximum number of stop words is %d", maxStopWords)
+		return nil, e
+	}
+	err = service.db.UserStore.SetSearchStopWords(userId, words)
+	if err != nil {
+		return nil, err
+	}
+	return service.db.UserStore.GetSearchStopWords(userId)
+}
+
+func (service *UserService) SetSearchRanking(ctx context.Context, userId int, rules []string) ([]string, error) {
+	if len(rules) > maxSearchRankRules {
+		e := errors.ErrInvalid
+		e.ErrMsg = fmt.Sprintf("maximum number of ranking rules is %d", maxSearchRankRules)
+		return nil, e
+	}
+	attributes := map[string]bool{}
+	for _, v := range rules {
+		if !search.IsValidRankingRule(v) {
+			e := errors.ErrInvalid
+			e.ErrMsg = fmt.Sprintf("invalid ranking rule '%s', expected <attribute>:<asc|desc> with attribute one of %s",
+				v, strings.Join(search.RankingAttributes, ", "))
+			return nil, e
+		}
+		attribute := strings.Split(v, ":")[0]
+		if attributes[attribute] {
+			e := errors.ErrInvalid
+			e.ErrMsg = fmt.Sprintf("duplicate ranking rule for '%s'", attribute)
+			return nil, e
+		}
+		attributes[attribute] = true
+	}
+	err := service.db.UserStore.SetSearchRanking(userId, rules)
+	if err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
@@ -26,7 +26,7 @@ type Database struct {
 }
 
 func (d *Database) Exec(query string, args ...interface{}) (sql.Result, error) {
-	return d.conn.Exec(query, args)
+	return d.conn.Exec(query, args...)
 }
 
 func (d *Database) ExecSq(sql squirrel.Sqlizer) (sql.Result, error) {
@@ -65,6 +65,10 @@ func (d *Database) Get(destination interface{}, query string, args ...interface{
 	return d.conn.Get(destination, query, args...)
 }
 
+func (d *Database) Select(destination interface{}, query string, args ...interface{}) error {
+	return d.conn.Select(destination, query, args...)
+}
+
 func (d *Database) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
 	return d.conn.ExecContext(ctx, query, args...)
 }
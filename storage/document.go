@@ -23,6 +23,8 @@ import (
 	"github.com/Masterminds/squirrel"
 	"github.com/jmoiron/sqlx"
 	"github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
 	"time"
 	"tryffel.net/go/virtualpaper/errors"
 	"tryffel.net/go/virtualpaper/models"
@@ -62,7 +64,8 @@ func (s *DocumentStore) GetDocuments(exec SqlExecer, userId int, paging Paging,
 		contentSelect = "content"
 	}
 
-	query := s.sq.Select("id, name, filename, documents.created_at as created_at, documents.updated_at as updated_at, hash, mimetype, size, date, description, lang, deleted_at, count(shares.user_id) as shares", contentSelect).
+	query := s.sq.Select("id, name, filename, documents.created_at as created_at, documents.updated_at as updated_at, hash, mimetype, size, date, description, lang, deleted_at, document_type_id, count(shares.user_id) as shares", contentSelect,
+		"invoice_iban, invoice_reference, invoice_amount, invoice_currency, invoice_vat_number, invoice_due_date, invoice_paid_at").
 		From("documents").
 		LeftJoin("user_shared_documents shares on documents.id = shares.document_id")
 
@@ -93,7 +96,8 @@ WHERE share.user_id = ? AND (share.permission -> 'read')::boolean = true)`, user
 		ownerQuery,
 	})
 	query = query.GroupBy("documents.id")
-	query = query.OrderBy(fmt.Sprintf("%s %s", sort.QueryKey(), sort.SortOrder()))
+	// invoice fields are null if they were not found
+	query = query.OrderBy(fmt.Sprintf("%s %s NULLS LAST", sort.QueryKey(), sort.SortOrder()))
 	query = query.Offset(uint64(paging.Offset)).Limit(uint64(paging.Limit))
 
 	dest := &[]models.Document{}
@@ -272,32 +276,33 @@ INSERT INTO documents (id, user_id, name, content, filename, hash, mimetype, siz
 	return err
 }
 
-func addDocumentHistoryAction(db *sqlx.DB, queryBuilder squirrel.StatementBuilderType, items []models.DocumentHistory, userId int) error {
+func addDocumentHistoryAction(db Execer, queryBuilder squirrel.StatementBuilderType, items []models.DocumentHistory, userId int) error {
 	if len(items) == 0 {
 		return nil
 	}
 
-	query := queryBuilder.Insert("document_history").Columns("document_id", "action", "old_value", "new_value")
-	if userId != UserIdInternal {
-		query = query.Columns("user_id")
+	sql, args, err := documentHistoryQuery(queryBuilder, items, userId).ToSql()
+	if err != nil {
+		return fmt.Errorf("create sql: %v", err)
 	}
+	_, err = db.Exec(sql, args...)
+	return getDatabaseError(err, &DocumentStore{}, "add document_history actions")
+}
 
+func documentHistoryQuery(queryBuilder squirrel.StatementBuilderType, items []models.DocumentHistory, userId int) squirrel.InsertBuilder {
+	query := queryBuilder.Insert("document_history").Columns("document_id", "action", "old_value", "new_value", "rule_id")
 	if userId != UserIdInternal {
-		for _, v := range items {
-			query = query.Values(v.DocumentId, v.Action, v.OldValue, v.NewValue, userId)
-		}
-	} else {
-		for _, v := range items {
-			query = query.Values(v.DocumentId, v.Action, v.OldValue, v.NewValue)
-		}
+		query = query.Columns("user_id")
 	}
 
-	sql, args, err := query.ToSql()
-	if err != nil {
-		return fmt.Errorf("create sql: %v", err)
+	for _, v := range items {
+		if userId != UserIdInternal {
+			query = query.Values(v.DocumentId, v.Action, v.OldValue, v.NewValue, models.IntId(v.RuleId), userId)
+		} else {
+			query = query.Values(v.DocumentId, v.Action, v.OldValue, v.NewValue, models.IntId(v.RuleId))
+		}
 	}
-	_, err = db.Exec(sql, args...)
-	return getDatabaseError(err, &DocumentStore{}, "add document_history actions")
+	return query
 }
 
 // SetDocumentContent sets content for given document id
@@ -312,6 +317,17 @@ WHERE id=$1;
 	return s.parseError(err, "set content")
 }
 
+// SetDocumentPageCount sets number of pages for given document id
+func (s *DocumentStore) SetDocumentPageCount(id string, pages int) error {
+	sql := `
+UPDATE documents SET page_count=$2
+WHERE id=$1;
+`
+
+	_, err := s.db.Exec(sql, id, pages)
+	return s.parseError(err, "set page count")
+}
+
 // GetContent returns full content. If userId != 0, user must own the document of given id.
 func (s *DocumentStore) GetContent(id string) (*string, error) {
 	sql := `
@@ -325,35 +341,127 @@ WHERE id=$1
 	return &content, s.parseError(err, "get content")
 }
 
-// GetNeedsIndexing returns documents that need indexing ( awaits_indexing=true). If userId != 0, return
-// only documents for that user, else return any documents.
-func (s *DocumentStore) GetNeedsIndexing(userId int, paging Paging) (*[]models.Document, error) {
+// GetIndexState returns ids and modification times of non-deleted documents, ordered by id.
+// Returns at most limit documents whose id is greater than afterId, so that documents added or deleted
+// between calls do not shift the pages. If userId != 0, return only user's documents.
+func (s *DocumentStore) GetIndexState(userId int, afterId string, limit int) ([]models.DocumentIndexState, error) {
+	query := s.sq.Select("id", "user_id", "updated_at").From("documents").
+		Where("deleted_at IS NULL").
+		Where("id > ?", afterId).
+		OrderBy("id ASC").
+		Limit(uint64(limit))
+	if userId != 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("create sql: %v", err)
+	}
+	docs := &[]models.DocumentIndexState{}
+	err = s.db.Select(docs, sql, args...)
+	if err != nil {
+		return []models.DocumentIndexState{}, s.parseError(err, "get document index state")
+	}
+	return *docs, nil
+}
+
+// GetUserDocumentIds returns ids of user's documents that are not deleted. If ids is not nil,
+// only the documents in ids are returned.
+func (s *DocumentStore) GetUserDocumentIds(userId int, ids []string) ([]string, error) {
+	query := s.sq.Select("id").From("documents").
+		Where("user_id = ?", userId).
+		Where("deleted_at IS NULL").
+		OrderBy("created_at ASC")
+	if ids != nil {
+		query = query.Where(squirrel.Eq{"id": ids})
+	}
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("create sql: %v", err)
+	}
+	result := &[]string{}
+	err = s.db.Select(result, sql, args...)
+	return *result, s.parseError(err, "get user document ids")
+}
 
-	sql := `
-SELECT * 
-FROM documents
-WHERE awaits_indexing=True
-`
+// UpdateByRule saves the name, description, date and metadata of a document that a rule has modified.
+// Changes are recorded in document history with the rule as the actor. Returns the recorded changes.
+func (s *DocumentStore) UpdateByRule(exec SqlExecer, ruleId int, doc *models.Document) ([]models.DocumentHistory, error) {
+	oldDoc, err := s.GetDocument(doc.Id)
+	if err != nil {
+		return nil, err
+	}
+	oldMetadata, err := s.metadataStore.GetDocumentMetadata(doc.UserId, doc.Id)
+	if err != nil {
+		return nil, err
+	}
 
-	args := []interface{}{paging.Offset, paging.Limit}
-	if userId != 0 {
-		sql += " AND user_id = $3 "
-		args = append(args, userId)
+	diff, err := oldDoc.Diff(doc, UserIdInternal)
+	if err != nil {
+		return nil, fmt.Errorf("get diff for document: %v", err)
+	}
+	metadataDiff := models.MetadataDiff(doc.Id, UserIdInternal, oldMetadata, &doc.Metadata)
+	diff = append(diff, metadataDiff...)
+	if len(diff) == 0 {
+		return diff, nil
+	}
+	for i := range diff {
+		diff[i].UserId = 0
+		diff[i].RuleId = ruleId
 	}
 
-	sql += "OFFSET $1 LIMIT $2;"
+	doc.UpdatedAt = time.Now()
+	query := s.sq.Update("documents").SetMap(map[string]interface{}{
+		"name":             doc.Name,
+		"description":      doc.Description,
+		"date":             doc.Date,
+		"lang":             doc.Lang,
+		"document_type_id": doc.DocumentTypeId,
+		"updated_at":       doc.UpdatedAt,
+	}).Where("id = ?", doc.Id)
+	_, err = exec.ExecSq(query)
+	if err != nil {
+		return nil, getDatabaseError(err, s, "update document by rule")
+	}
 
-	docs := &[]models.Document{}
+	if len(metadataDiff) > 0 {
+		_, err = exec.ExecSq(s.sq.Delete("document_metadata").Where("document_id = ?", doc.Id))
+		if err != nil {
+			return nil, getDatabaseError(err, s, "delete document metadata")
+		}
+		if len(doc.Metadata) > 0 {
+			insert := s.sq.Insert("document_metadata").Columns("document_id", "key_id", "value_id")
+			for _, v := range doc.Metadata {
+				insert = insert.Values(doc.Id, v.KeyId, v.ValueId)
+			}
+			_, err = exec.ExecSq(insert)
+			if err != nil {
+				return nil, getDatabaseError(err, s, "insert document metadata")
+			}
+		}
+	}
 
-	err := s.db.Select(docs, sql, args...)
-	return docs, s.parseError(err, "get needs indexing")
+	_, err = exec.ExecSq(documentHistoryQuery(s.sq, diff, UserIdInternal))
+	if err != nil {
+		return nil, getDatabaseError(err, s, "add document history")
+	}
+	return diff, nil
 }
 
 // Update sets complete document record, not just changed attributes. Thus document must be read before updating.
 func (s *DocumentStore) Update(userId int, doc *models.Document) error {
+	return s.update(s.db, userId, doc)
+}
 
+// UpdateTx updates the document within the transaction.
+func (s *DocumentStore) UpdateTx(exec SqlExecer, userId int, doc *models.Document) error {
+	return s.update(exec, userId, doc)
+}
+
+func (s *DocumentStore) update(exec dbQuerier, userId int, doc *models.Document) error {
 	// TODO: metadata diff is not saved, bc the document metadata is saved separately
-	oldDoc, err := s.GetDocument(doc.Id)
+	oldDoc := &models.Document{}
+	err := exec.Get(oldDoc, "SELECT * FROM documents WHERE id = $1", doc.Id)
 	if err != nil {
 		return s.parseError(err, "get document by id")
 	}
@@ -361,12 +469,12 @@ func (s *DocumentStore) Update(userId int, doc *models.Document) error {
 	sql := `
 UPDATE documents SET 
 name=$2, content=$3, filename=$4, hash=$5, mimetype=$6, size=$7, date=$8,
-updated_at=$9, description=$10, lang=$11
+updated_at=$9, description=$10, lang=$11, document_type_id=$12
 WHERE id=$1
 `
 
-	_, err = s.db.Exec(sql, doc.Id, doc.Name, doc.Content, doc.Filename, doc.Hash, doc.Mimetype, doc.Size,
-		doc.Date, doc.UpdatedAt, doc.Description, doc.Lang)
+	_, err = exec.Exec(sql, doc.Id, doc.Name, doc.Content, doc.Filename, doc.Hash, doc.Mimetype, doc.Size,
+		doc.Date, doc.UpdatedAt, doc.Description, doc.Lang, doc.DocumentTypeId)
 	if err != nil {
 		return s.parseError(err, "update")
 	}
@@ -376,11 +484,66 @@ WHERE id=$1
 		return fmt.Errorf("get diff for document: %v", err)
 	}
 
-	err = addDocumentHistoryAction(s.db, s.sq, diff, userId)
+	err = addDocumentHistoryAction(exec, s.sq, diff, userId)
 	logrus.Infof("User %d edited document %s with %d actions", userId, doc.Id, len(diff))
 	return err
 }
 
+// UpdateInvoiceFields replaces the extracted invoice fields of the document.
+func (s *DocumentStore) UpdateInvoiceFields(docId string, fields *models.InvoiceFields) error {
+	query := s.sq.Update("documents").
+		Set("invoice_iban", fields.Iban).
+		Set("invoice_reference", fields.Reference).
+		Set("invoice_amount", fields.Amount).
+		Set("invoice_currency", fields.Currency).
+		Set("invoice_vat_number", fields.VatNumber).
+		Set("invoice_due_date", fields.DueDate).
+		Where("id = ?", docId)
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return fmt.Errorf("sql: %v", err)
+	}
+	_, err = s.db.Exec(sql, args...)
+	return s.parseError(err, "update invoice fields")
+}
+
+// SetInvoicePaid sets the date when the invoice was paid, or marks it as not paid if paidAt is nil.
+// Exec should be a transaction, the document row is locked until it finishes.
+func (s *DocumentStore) SetInvoicePaid(exec SqlExecer, userId int, docId string, paidAt *time.Time) error {
+	formatDate := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return strconv.Itoa(int(t.Unix()))
+	}
+
+	var oldPaidAt *time.Time
+	err := exec.Get(&oldPaidAt, "SELECT invoice_paid_at FROM documents WHERE id = $1 AND user_id = $2 FOR UPDATE",
+		docId, userId)
+	if err != nil {
+		return s.parseError(err, "get invoice paid date")
+	}
+	if formatDate(oldPaidAt) == formatDate(paidAt) {
+		return nil
+	}
+
+	query := s.sq.Update("documents").
+		Set("invoice_paid_at", paidAt).
+		Set("updated_at", time.Now()).
+		Where("id = ?", docId).
+		Where("user_id = ?", userId)
+	_, err = exec.ExecSq(query)
+	if err != nil {
+		return s.parseError(err, "set invoice paid")
+	}
+	return addDocumentHistoryAction(exec, s.sq, []models.DocumentHistory{{
+		DocumentId: docId,
+		Action:     models.DocumentHistoryActionInvoicePaid,
+		OldValue:   formatDate(oldPaidAt),
+		NewValue:   formatDate(paidAt),
+	}}, userId)
+}
+
 func (s *DocumentStore) SetModifiedAt(docIds []string, modifiedAt time.Time) error {
 	query := s.sq.Update("documents").Set("updated_at", modifiedAt).Where(squirrel.Eq{"id": docIds})
 	sql, args, err := query.ToSql()
@@ -392,6 +555,15 @@ func (s *DocumentStore) SetModifiedAt(docIds []string, modifiedAt time.Time) err
 }
 
 func (s *DocumentStore) MarkDocumentDeleted(userId int, docId string) error {
+	return s.markDocumentDeleted(s.db, userId, docId)
+}
+
+// MarkDocumentDeletedTx moves the document to trash bin within the transaction.
+func (s *DocumentStore) MarkDocumentDeletedTx(exec SqlExecer, userId int, docId string) error {
+	return s.markDocumentDeleted(exec, userId, docId)
+}
+
+func (s *DocumentStore) markDocumentDeleted(exec dbQuerier, userId int, docId string) error {
 	query := s.sq.Update("documents").Set("deleted_at", time.Now()).Where("id=?", docId)
 	if userId != 0 {
 		query = query.Where("user_id = ?", userId)
@@ -400,12 +572,12 @@ func (s *DocumentStore) MarkDocumentDeleted(userId int, docId string) error {
 	if err != nil {
 		return fmt.Errorf("sql: %v", err)
 	}
-	_, err = s.db.Exec(sql, args...)
+	_, err = exec.Exec(sql, args...)
 	if err != nil {
 		return s.parseError(err, "mark document deleted")
 	}
 
-	err = addDocumentHistoryAction(s.db, s.sq, []models.DocumentHistory{{
+	err = addDocumentHistoryAction(exec, s.sq, []models.DocumentHistory{{
 		DocumentId: docId,
 		Action:     models.DocumentHistoryActionDelete,
 		OldValue:   "",
@@ -419,6 +591,33 @@ func (s *DocumentStore) MarkDocumentDeleted(userId int, docId string) error {
 	return nil
 }
 
+// MarkDocumentDeletedByRule moves the document to trash bin and records the rule to the document history.
+func (s *DocumentStore) MarkDocumentDeletedByRule(exec SqlExecer, ruleId int, docId string) error {
+	query := s.sq.Update("documents").Set("deleted_at", time.Now()).
+		Where("id = ?", docId).
+		Where("deleted_at IS NULL")
+	_, err := exec.ExecSq(query)
+	if err != nil {
+		return getDatabaseError(err, s, "mark document deleted by rule")
+	}
+	return s.AddRuleHistory(exec, ruleId, []models.DocumentHistory{{
+		DocumentId: docId,
+		Action:     models.DocumentHistoryActionDelete,
+	}})
+}
+
+// AddRuleHistory adds document history items that are made by the rule.
+func (s *DocumentStore) AddRuleHistory(exec SqlExecer, ruleId int, items []models.DocumentHistory) error {
+	if len(items) == 0 {
+		return nil
+	}
+	for i := range items {
+		items[i].RuleId = ruleId
+	}
+	_, err := exec.ExecSq(documentHistoryQuery(s.sq, items, UserIdInternal))
+	return getDatabaseError(err, s, "add rule document history")
+}
+
 func (s *DocumentStore) MarkDocumentNonDeleted(userId int, docId string) error {
 	query := s.sq.Update("documents").Set("deleted_at", nil).Where("id=?", docId)
 	sql, args, err := query.ToSql()
@@ -459,10 +658,12 @@ func (s *DocumentStore) GetDocumentHistory(userId int, docId string) (*[]models.
 		dh.new_value as new_value,
 		dh.created_at as created_at,
 		coalesce(dh.user_id, 0) as user_id,
-		coalesce(u.name, 'Server') as user
+		coalesce(dh.rule_id, 0) as rule_id,
+		CASE WHEN r.id IS NOT NULL THEN 'Rule: ' || r.name ELSE coalesce(u.name, 'Server') END as user
 	FROM document_history dh 
 	LEFT JOIN documents d ON dh.document_id=d.id 
 	LEFT JOIN users u ON dh.user_id=u.id
+	LEFT JOIN rules r ON dh.rule_id=r.id
 	WHERE document_id=$1
 	ORDER BY created_at ASC;
 	`
@@ -611,3 +812,70 @@ func (s *DocumentStore) UpdateSharing(exec SqlExecer, docId string, sharing *[]m
 	}
 	return nil
 }
+
+// ShareByRule shares the document with the user, or updates the permissions if the document
+// is already shared with the user. Other shares of the document are kept.
+func (s *DocumentStore) ShareByRule(exec SqlExecer, ruleId int, doc *models.Document, sharing models.UpdateUserSharing) error {
+	if doc.UserId == sharing.UserId {
+		userErr := errors.ErrInvalid
+		userErr.ErrMsg = "cannot share with self"
+		return userErr
+	}
+
+	var userName string
+	err := exec.GetSq(&userName, s.sq.Select("name").From("users").Where("id = ?", sharing.UserId))
+	if err != nil {
+		dbErr := getDatabaseError(err, s, "get user")
+		if errors.Is(dbErr, errors.ErrRecordNotFound) {
+			noUserErr := errors.ErrRecordNotFound
+			noUserErr.ErrMsg = "user not found"
+			return noUserErr
+		}
+		return dbErr
+	}
+
+	query := s.sq.Insert("user_shared_documents").Columns("user_id", "document_id", "permission").
+		Values(sharing.UserId, doc.Id, sharing.Permissions).
+		Suffix("ON CONFLICT ON CONSTRAINT pk_user_shared_documents DO UPDATE SET permission = EXCLUDED.permission")
+	_, err = exec.ExecSq(query)
+	if err != nil {
+		return getDatabaseError(err, s, "share document by rule")
+	}
+
+	permissions := make([]string, 0, 3)
+	for _, v := range []struct {
+		name    string
+		enabled bool
+	}{{"read", sharing.Permissions.Read}, {"write", sharing.Permissions.Write}, {"delete", sharing.Permissions.Delete}} {
+		if v.enabled {
+			permissions = append(permissions, v.name)
+		}
+	}
+	return s.AddRuleHistory(exec, ruleId, []models.DocumentHistory{{
+		DocumentId: doc.Id,
+		Action:     models.DocumentHistoryActionShare,
+		NewValue:   fmt.Sprintf("%s: %s", userName, strings.Join(permissions, ", ")),
+	}})
+}
+
+// GetLatestDocumentWithMetadata returns the id of the user's latest document, by document date,
+// that has any of the metadata values for the key. Document excludeId and deleted documents are ignored.
+func (s *DocumentStore) GetLatestDocumentWithMetadata(userId int, excludeId string, keyId int, valueIds []int) (string, error) {
+	query := s.sq.Select("d.id").
+		From("documents d").
+		Join("document_metadata dm ON dm.document_id = d.id").
+		Where("d.user_id = ?", userId).
+		Where("d.id <> ?", excludeId).
+		Where("d.deleted_at IS NULL").
+		Where(squirrel.Eq{"dm.key_id": keyId, "dm.value_id": valueIds}).
+		OrderBy("d.date DESC", "d.created_at DESC").
+		Limit(1)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return "", fmt.Errorf("create sql: %v", err)
+	}
+	var id string
+	err = s.db.Get(&id, sql, args...)
+	return id, s.parseError(err, "get latest document with metadata")
+}
@@ -0,0 +1,93 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package storage
+
+import (
+	"fmt"
+
+	"tryffel.net/go/virtualpaper/models"
+)
+
+// GetUserDocumentsForExport returns all user's documents that are not deleted, without content.
+func (s *DocumentStore) GetUserDocumentsForExport(userId int) ([]models.Document, error) {
+	query := s.sq.Select("id", "user_id", "name", "filename", "date", "created_at", "updated_at").
+		From("documents").
+		Where("user_id = ?", userId).
+		Where("deleted_at IS NULL").
+		OrderBy("date ASC", "id ASC")
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("create sql: %v", err)
+	}
+	docs := []models.Document{}
+	err = s.db.Select(&docs, sql, args...)
+	return docs, s.parseError(err, "get documents for export")
+}
+
+// GetAccessibleKeys returns all keys the user owns or uses through vocabularies.
+// User's own keys are returned first.
+func (s *MetadataStore) GetAccessibleKeys(userId int) ([]models.MetadataKey, error) {
+	query := s.sq.Select("*").From("metadata_keys").
+		Where(accessibleKeysCondition("id", userId)).
+		OrderBy(fmt.Sprintf("user_id <> %d", userId), "lower(key) ASC", "id ASC")
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("create sql: %v", err)
+	}
+	keys := []models.MetadataKey{}
+	err = s.db.Select(&keys, sql, args...)
+	return keys, s.parseError(err, "get accessible keys")
+}
+
+type documentMetadataRow struct {
+	DocumentId string `db:"document_id"`
+	models.Metadata
+}
+
+// GetUserDocumentsMetadata returns the metadata of all user's documents that are not deleted,
+// mapped by document id.
+func (s *MetadataStore) GetUserDocumentsMetadata(userId int) (map[string][]models.Metadata, error) {
+	query := s.sq.Select("dm.document_id AS document_id", "mk.id AS key_id", "mk.key AS key",
+		"mk.icon AS icon", "mk.style AS style", "mv.id AS value_id", "mv.value AS value",
+		"COALESCE(mk.value_type, 'text') AS key_type").
+		From("document_metadata dm").
+		Join("documents d ON dm.document_id = d.id").
+		Join("metadata_keys mk ON dm.key_id = mk.id").
+		Join("metadata_values mv ON dm.value_id = mv.id").
+		Where("d.user_id = ?", userId).
+		Where("d.deleted_at IS NULL").
+		OrderBy("dm.document_id", "lower(mk.key)", "lower(mv.value)")
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("create sql: %v", err)
+	}
+	rows := []documentMetadataRow{}
+	err = s.db.Select(&rows, sql, args...)
+	if err != nil {
+		return nil, s.parseError(err, "get documents metadata")
+	}
+	metadata := make(map[string][]models.Metadata)
+	for _, v := range rows {
+		metadata[v.DocumentId] = append(metadata[v.DocumentId], v.Metadata)
+	}
+	return metadata, nil
+}
@@ -0,0 +1,117 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package storage
+
+import (
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+	"tryffel.net/go/virtualpaper/models"
+)
+
+func (s *DocumentStore) noteQuery() squirrel.SelectBuilder {
+	return s.sq.Select("n.id", "n.document_id", "n.user_id", "u.name AS user_name", "n.content", "n.page",
+		"n.position_x", "n.position_y", "n.created_at", "n.updated_at").
+		From("document_notes n").
+		LeftJoin("users u ON n.user_id = u.id")
+}
+
+// GetDocumentNotes returns all notes of the document, oldest first.
+func (s *DocumentStore) GetDocumentNotes(docId string) ([]models.DocumentNote, error) {
+	query := s.noteQuery().Where("n.document_id = ?", docId).OrderBy("n.created_at ASC", "n.id ASC")
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("create sql: %v", err)
+	}
+	notes := []models.DocumentNote{}
+	err = s.db.Select(&notes, sql, args...)
+	return notes, s.parseError(err, "get document notes")
+}
+
+// GetDocumentNote returns the note if it belongs to the document.
+func (s *DocumentStore) GetDocumentNote(docId string, noteId int) (*models.DocumentNote, error) {
+	query := s.noteQuery().Where("n.document_id = ?", docId).Where("n.id = ?", noteId)
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("create sql: %v", err)
+	}
+	note := &models.DocumentNote{}
+	err = s.db.Get(note, sql, args...)
+	return note, s.parseError(err, "get document note")
+}
+
+// CreateDocumentNote adds the note and a history entry for the author.
+func (s *DocumentStore) CreateDocumentNote(exec SqlExecer, note *models.DocumentNote) error {
+	query := s.sq.Insert("document_notes").
+		Columns("document_id", "user_id", "content", "page", "position_x", "position_y").
+		Values(note.DocumentId, note.UserId, note.Content, note.Page, note.PositionX, note.PositionY).
+		Suffix("RETURNING id, created_at, updated_at")
+	err := exec.GetSq(note, query)
+	if err != nil {
+		return s.parseError(err, "create document note")
+	}
+	return s.addNoteHistory(exec, note.UserId, models.DocumentHistory{
+		DocumentId: note.DocumentId,
+		Action:     models.DocumentHistoryActionNoteAdd,
+		NewValue:   note.Content,
+	})
+}
+
+// UpdateDocumentNote updates the note content and anchor. User is the one who made the change.
+func (s *DocumentStore) UpdateDocumentNote(exec SqlExecer, userId int, original, note *models.DocumentNote) error {
+	note.Update()
+	query := s.sq.Update("document_notes").
+		Set("content", note.Content).
+		Set("page", note.Page).
+		Set("position_x", note.PositionX).
+		Set("position_y", note.PositionY).
+		Set("updated_at", note.UpdatedAt).
+		Where("id = ?", note.Id).Where("document_id = ?", note.DocumentId)
+	_, err := exec.ExecSq(query)
+	if err != nil {
+		return s.parseError(err, "update document note")
+	}
+	if original.Content == note.Content {
+		return nil
+	}
+	return s.addNoteHistory(exec, userId, models.DocumentHistory{
+		DocumentId: note.DocumentId,
+		Action:     models.DocumentHistoryActionNoteEdit,
+		OldValue:   original.Content,
+		NewValue:   note.Content,
+	})
+}
+
+// DeleteDocumentNote deletes the note. User is the one who deleted the note.
+func (s *DocumentStore) DeleteDocumentNote(exec SqlExecer, userId int, note *models.DocumentNote) error {
+	_, err := exec.ExecSq(s.sq.Delete("document_notes").Where("id = ?", note.Id).Where("document_id = ?", note.DocumentId))
+	if err != nil {
+		return s.parseError(err, "delete document note")
+	}
+	return s.addNoteHistory(exec, userId, models.DocumentHistory{
+		DocumentId: note.DocumentId,
+		Action:     models.DocumentHistoryActionNoteRemove,
+		OldValue:   note.Content,
+	})
+}
+
+func (s *DocumentStore) addNoteHistory(exec SqlExecer, userId int, item models.DocumentHistory) error {
+	_, err := exec.ExecSq(documentHistoryQuery(s.sq, []models.DocumentHistory{item}, userId))
+	return s.parseError(err, "add note history")
+}
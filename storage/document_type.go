@@ -0,0 +1,204 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package storage
+
+import (
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+	"tryffel.net/go/virtualpaper/models"
+)
+
+// GetDocumentTypes returns user's document types with their keys.
+func (s *MetadataStore) GetDocumentTypes(userId int, sort SortKey, paging Paging) ([]*models.DocumentType, int, error) {
+	paging.Validate()
+	sort.SetDefaults("name", false)
+	query := s.sq.Select("*").From("document_types").Where("user_id = ?", userId).
+		OrderBy(fmt.Sprintf("%s %s", sort.QueryKey(), sort.SortOrder())).
+		Offset(uint64(paging.Offset)).Limit(uint64(paging.Limit))
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, 0, fmt.Errorf("create sql: %v", err)
+	}
+	types := []*models.DocumentType{}
+	err = s.db.Select(&types, sql, args...)
+	if err != nil {
+		return nil, 0, s.parseError(err, "get document types")
+	}
+	err = s.addDocumentTypeKeys(s.db, types)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	count := 0
+	err = s.db.Get(&count, "SELECT count(id) FROM document_types WHERE user_id = $1", userId)
+	return types, count, s.parseError(err, "count document types")
+}
+
+// GetDocumentType returns user's document type with its keys.
+func (s *MetadataStore) GetDocumentType(userId, typeId int) (*models.DocumentType, error) {
+	return s.getDocumentType(s.db, userId, typeId)
+}
+
+func (s *MetadataStore) getDocumentType(exec dbQuerier, userId, typeId int) (*models.DocumentType, error) {
+	docType := &models.DocumentType{}
+	err := exec.Get(docType, "SELECT * FROM document_types WHERE id = $1 AND user_id = $2", typeId, userId)
+	if err != nil {
+		return nil, s.parseError(err, "get document type")
+	}
+	err = s.addDocumentTypeKeys(exec, []*models.DocumentType{docType})
+	return docType, err
+}
+
+func (s *MetadataStore) addDocumentTypeKeys(exec dbQuerier, types []*models.DocumentType) error {
+	if len(types) == 0 {
+		return nil
+	}
+	ids := make([]int, len(types))
+	for i, v := range types {
+		ids[i] = v.Id
+		v.Keys = []models.DocumentTypeKey{}
+	}
+	query := s.sq.Select("tk.document_type_id", "tk.key_id", "mk.key", "tk.required", "tk.default_value_id").
+		From("document_type_keys tk").
+		Join("metadata_keys mk ON tk.key_id = mk.id").
+		Where(squirrel.Eq{"tk.document_type_id": ids}).
+		OrderBy("tk.required DESC", "mk.key ASC")
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return fmt.Errorf("create sql: %v", err)
+	}
+	keys := []models.DocumentTypeKey{}
+	err = exec.Select(&keys, sql, args...)
+	if err != nil {
+		return s.parseError(err, "get document type keys")
+	}
+	for _, key := range keys {
+		for _, docType := range types {
+			if docType.Id == key.DocumentTypeId {
+				docType.Keys = append(docType.Keys, key)
+			}
+		}
+	}
+	return nil
+}
+
+// CreateDocumentType creates a new document type with its keys.
+func (s *MetadataStore) CreateDocumentType(exec SqlExecer, docType *models.DocumentType) error {
+	query := s.sq.Insert("document_types").Columns("user_id", "name", "description").
+		Values(docType.UserId, docType.Name, docType.Description).
+		Suffix("RETURNING id, created_at, updated_at")
+	err := exec.GetSq(docType, query)
+	if err != nil {
+		return s.parseError(err, "create document type")
+	}
+	return s.setDocumentTypeKeys(exec, docType)
+}
+
+// UpdateDocumentType updates the document type and replaces its keys.
+func (s *MetadataStore) UpdateDocumentType(exec SqlExecer, docType *models.DocumentType) error {
+	docType.Update()
+	query := s.sq.Update("document_types").
+		Set("name", docType.Name).
+		Set("description", docType.Description).
+		Set("updated_at", docType.UpdatedAt).
+		Where("id = ?", docType.Id).Where("user_id = ?", docType.UserId)
+	_, err := exec.ExecSq(query)
+	if err != nil {
+		return s.parseError(err, "update document type")
+	}
+	_, err = exec.ExecSq(s.sq.Delete("document_type_keys").Where("document_type_id = ?", docType.Id))
+	if err != nil {
+		return s.parseError(err, "delete document type keys")
+	}
+	return s.setDocumentTypeKeys(exec, docType)
+}
+
+func (s *MetadataStore) setDocumentTypeKeys(exec SqlExecer, docType *models.DocumentType) error {
+	if len(docType.Keys) == 0 {
+		return nil
+	}
+	query := s.sq.Insert("document_type_keys").Columns("document_type_id", "key_id", "required", "default_value_id")
+	for i, v := range docType.Keys {
+		docType.Keys[i].DocumentTypeId = docType.Id
+		query = query.Values(docType.Id, v.KeyId, v.Required, v.DefaultValueId)
+	}
+	_, err := exec.ExecSq(query)
+	return s.parseError(err, "add document type keys")
+}
+
+// DeleteDocumentType deletes the document type. Documents of the type are left without a type.
+// DeleteDocumentType deletes user's document type. Documents of the type are left without a type.
+// Returns the ids of the documents that had the type.
+func (s *MetadataStore) DeleteDocumentType(exec SqlExecer, userId, typeId int) ([]string, error) {
+	docIds := []string{}
+	err := exec.Select(&docIds, "SELECT id FROM documents WHERE document_type_id = $1", typeId)
+	if err != nil {
+		return nil, s.parseError(err, "get documents of document type")
+	}
+	_, err = exec.Exec("DELETE FROM document_types WHERE id = $1 AND user_id = $2", typeId, userId)
+	return docIds, s.parseError(err, "delete document type")
+}
+
+// incompleteDocumentsCondition matches documents that do not have a type
+// or are missing any of the required keys of their type.
+const incompleteDocumentsCondition = `(documents.document_type_id IS NULL OR EXISTS (
+SELECT 1 FROM document_type_keys tk
+WHERE tk.document_type_id = documents.document_type_id
+AND tk.required
+AND NOT EXISTS (
+	SELECT 1 FROM document_metadata dm
+	WHERE dm.document_id = documents.id AND dm.key_id = tk.key_id)))`
+
+// GetIncompleteDocuments returns user's documents that still need classifying: documents without a type
+// and documents that are missing required metadata of their type. Content is not returned.
+func (s *DocumentStore) GetIncompleteDocuments(userId int, paging Paging, sort SortKey) (*[]models.Document, int, error) {
+	paging.Validate()
+	sort.SetDefaults("date", false)
+	where := squirrel.And{
+		squirrel.Eq{"documents.user_id": userId},
+		squirrel.Eq{"documents.deleted_at": nil},
+		squirrel.Expr(incompleteDocumentsCondition),
+	}
+	query := s.sq.Select("id, name, filename, created_at, updated_at, hash, mimetype, size, date, description, lang, document_type_id").
+		From("documents").
+		Where(where).
+		OrderBy(fmt.Sprintf("%s %s", sort.QueryKey(), sort.SortOrder())).
+		Offset(uint64(paging.Offset)).Limit(uint64(paging.Limit))
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, 0, fmt.Errorf("create sql: %v", err)
+	}
+	docs := &[]models.Document{}
+	err = s.db.Select(docs, sql, args...)
+	if err != nil {
+		return nil, 0, s.parseError(err, "get incomplete documents")
+	}
+
+	sql, args, err = s.sq.Select("count(id)").From("documents").Where(where).ToSql()
+	if err != nil {
+		return nil, 0, fmt.Errorf("create sql: %v", err)
+	}
+	count := 0
+	err = s.db.Get(&count, sql, args...)
+	return docs, count, s.parseError(err, "count incomplete documents")
+}
@@ -0,0 +1,194 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package storage
+
+import (
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+	"tryffel.net/go/virtualpaper/models"
+)
+
+// SetFingerprint stores the content and image fingerprints for document.
+func (s *DocumentStore) SetFingerprint(userId int, fingerprint models.DocumentFingerprint) error {
+	sql := `
+	INSERT INTO document_fingerprints (document_id, user_id, content_hash, image_hash, updated_at)
+	VALUES ($1, $2, $3, $4, now())
+	ON CONFLICT (document_id) DO UPDATE
+	SET user_id=EXCLUDED.user_id, content_hash=EXCLUDED.content_hash, image_hash=EXCLUDED.image_hash, updated_at=now();
+	`
+	_, err := s.db.Exec(sql, fingerprint.DocumentId, userId, fingerprint.ContentHash, fingerprint.ImageHash)
+	return s.parseError(err, "set fingerprint")
+}
+
+// GetFingerprints returns fingerprints of all user's non-deleted documents.
+func (s *DocumentStore) GetFingerprints(userId int) ([]models.DocumentFingerprint, error) {
+	sql := `
+	SELECT df.document_id, df.content_hash, df.image_hash
+	FROM document_fingerprints df
+	JOIN documents d ON df.document_id = d.id
+	WHERE df.user_id = $1
+	AND d.deleted_at IS NULL;
+	`
+	fingerprints := &[]models.DocumentFingerprint{}
+	err := s.db.Select(fingerprints, sql, userId)
+	if err != nil {
+		return []models.DocumentFingerprint{}, s.parseError(err, "get fingerprints")
+	}
+	return *fingerprints, nil
+}
+
+// UpdateDuplicates replaces the duplicates found for document.
+// Dismissed pairs are kept so that they are not reported again.
+func (s *DocumentStore) UpdateDuplicates(userId int, docId string, duplicates []models.DocumentDuplicate) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return s.parseError(err, "update duplicates, start tx")
+	}
+
+	delQuery := s.sq.Delete("document_duplicates").
+		Where(squirrel.Or{squirrel.Eq{"doc_a_id": docId}, squirrel.Eq{"doc_b_id": docId}}).
+		Where("dismissed = FALSE")
+	sql, args, err := delQuery.ToSql()
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("get DELETE sql: %v", err)
+	}
+	_, err = tx.Exec(sql, args...)
+	if err != nil {
+		tx.Rollback()
+		return s.parseError(err, "update duplicates - delete old")
+	}
+
+	if len(duplicates) > 0 {
+		insertQuery := s.sq.Insert("document_duplicates").
+			Columns("user_id", "doc_a_id", "doc_b_id", "content_distance", "image_distance")
+		for _, v := range duplicates {
+			insertQuery = insertQuery.Values(userId, v.DocA, v.DocB, v.ContentDistance, v.ImageDistance)
+		}
+		insertQuery = insertQuery.Suffix("ON CONFLICT (doc_a_id, doc_b_id) DO NOTHING")
+		sql, args, err = insertQuery.ToSql()
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("get INSERT sql: %v", err)
+		}
+		_, err = tx.Exec(sql, args...)
+		if err != nil {
+			tx.Rollback()
+			return s.parseError(err, "update duplicates - insert new")
+		}
+	}
+	return s.parseError(tx.Commit(), "update duplicates - commit")
+}
+
+// GetDuplicatePairs returns user's duplicate pairs that have not been dismissed
+// and where both documents are non-deleted.
+func (s *DocumentStore) GetDuplicatePairs(userId int) ([]models.DocumentDuplicate, error) {
+	sql := `
+	SELECT dd.doc_a_id, dd.doc_b_id, dd.content_distance, dd.image_distance
+	FROM document_duplicates dd
+	JOIN documents da ON dd.doc_a_id = da.id
+	JOIN documents db ON dd.doc_b_id = db.id
+	WHERE dd.user_id = $1
+	AND dd.dismissed = FALSE
+	AND da.deleted_at IS NULL
+	AND db.deleted_at IS NULL
+	ORDER BY dd.doc_a_id, dd.doc_b_id;
+	`
+	pairs := &[]models.DocumentDuplicate{}
+	err := s.db.Select(pairs, sql, userId)
+	if err != nil {
+		return []models.DocumentDuplicate{}, s.parseError(err, "get duplicate pairs")
+	}
+	return *pairs, nil
+}
+
+// GetDocumentDuplicates returns ids of the documents that are likely duplicates of the document.
+func (s *DocumentStore) GetDocumentDuplicates(docId string) ([]string, error) {
+	sql := `
+	SELECT CASE WHEN dd.doc_a_id = $1 THEN dd.doc_b_id ELSE dd.doc_a_id END AS id
+	FROM document_duplicates dd
+	JOIN documents da ON dd.doc_a_id = da.id
+	JOIN documents db ON dd.doc_b_id = db.id
+	WHERE (dd.doc_a_id = $1 OR dd.doc_b_id = $1)
+	AND dd.dismissed = FALSE
+	AND da.deleted_at IS NULL
+	AND db.deleted_at IS NULL
+	ORDER BY id;
+	`
+	ids := &[]string{}
+	err := s.db.Select(ids, sql, docId)
+	if err != nil {
+		return []string{}, s.parseError(err, "get document duplicates")
+	}
+	return *ids, nil
+}
+
+// GetDuplicateDocuments returns basic info of the given user's documents.
+func (s *DocumentStore) GetDuplicateDocuments(userId int, docIds []string) ([]models.DuplicateDocument, error) {
+	if len(docIds) == 0 {
+		return []models.DuplicateDocument{}, nil
+	}
+	query := s.sq.Select("id", "name", "date", "created_at", "size", "mimetype").
+		From("documents").
+		Where("user_id = ?", userId).
+		Where(squirrel.Eq{"id": docIds}).
+		OrderBy("created_at ASC")
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("create sql: %v", err)
+	}
+	docs := &[]models.DuplicateDocument{}
+	err = s.db.Select(docs, sql, args...)
+	if err != nil {
+		return []models.DuplicateDocument{}, s.parseError(err, "get duplicate documents")
+	}
+	return *docs, nil
+}
+
+// DismissDuplicates marks all duplicate pairs between given documents as not being duplicates.
+func (s *DocumentStore) DismissDuplicates(userId int, docIds []string) error {
+	query := s.sq.Update("document_duplicates").Set("dismissed", true).
+		Where("user_id = ?", userId).
+		Where(squirrel.Eq{"doc_a_id": docIds}).
+		Where(squirrel.Eq{"doc_b_id": docIds})
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return fmt.Errorf("create sql: %v", err)
+	}
+	_, err = s.db.Exec(sql, args...)
+	return s.parseError(err, "dismiss duplicates")
+}
+
+// AddDuplicateMergeHistory records merging duplicates into target document.
+func (s *DocumentStore) AddDuplicateMergeHistory(exec SqlExecer, userId int, targetId string, duplicates []string) error {
+	items := make([]models.DocumentHistory, 0, len(duplicates)*2)
+	for _, v := range duplicates {
+		items = append(items, models.DocumentHistory{
+			DocumentId: targetId,
+			Action:     models.DocumentHistoryActionMergeDuplicate,
+			NewValue:   v,
+		}, models.DocumentHistory{
+			DocumentId: v,
+			Action:     models.DocumentHistoryActionMergedInto,
+			NewValue:   targetId,
+		})
+	}
+	return addDocumentHistoryAction(exec, s.sq, items, userId)
+}
@@ -174,7 +174,7 @@ LIMIT 50`
 
 // GetNextStepForDocument returns next step that hasn't been started yet.
 func (s *JobStore) GetNextStepForDocument(documentId string) (*models.ProcessItem, error) {
-	sql := `SELECT document_id, action, created_at FROM process_queue
+	sql := `SELECT document_id, action, created_at, rule_triggers FROM process_queue
 WHERE document_id = $1 AND running = FALSE
 ORDER BY action_order ASC
 LIMIT 1`
@@ -237,9 +237,9 @@ GROUP BY running;
 func (s *JobStore) StartProcessItem(item *models.ProcessItem, msg string) (*models.Job, error) {
 	sql := `
 UPDATE process_queue SET running=TRUE 
-WHERE document_id = $1 AND action = $2 AND running=FALSE;
+WHERE document_id = $1 AND action = $2 AND rule_triggers = $3 AND running=FALSE;
 `
-	res, err := s.db.Exec(sql, item.DocumentId, item.Action)
+	res, err := s.db.Exec(sql, item.DocumentId, item.Action, item.Triggers)
 	if err != nil {
 		return nil, s.parseError(err, "start ProcessItem")
 	}
@@ -273,6 +273,7 @@ func (s *JobStore) MarkProcessingDone(item *models.ProcessItem, ok bool) error {
 			DELETE FROM process_queue
 			WHERE document_id = $1
 			AND action = $2
+			AND rule_triggers = $3
 			AND running =TRUE;
 			`
 	} else {
@@ -281,10 +282,11 @@ func (s *JobStore) MarkProcessingDone(item *models.ProcessItem, ok bool) error {
 			SET running=FALSE
 			WHERE document_id = $1
 			AND action = $2
+			AND rule_triggers = $3
 			AND running=FALSE;
 			`
 	}
-	_, err := s.db.Exec(sql, item.DocumentId, item.Action)
+	_, err := s.db.Exec(sql, item.DocumentId, item.Action, item.Triggers)
 	return s.parseError(err, "mark ProcessSteps done")
 }
 
@@ -410,6 +412,31 @@ func (s *JobStore) IndexDocumentsByMetadata(userId int, keyId int, valueId int)
 	return getDatabaseError(err, s, "queue documents by metadata")
 }
 
+// IndexDocumentsByDocumentType adds user's documents of the document type to the indexing queue.
+func (s *JobStore) IndexDocumentsByDocumentType(userId int, typeId int) error {
+	stepSql := fmt.Sprintf("('%s', %d)", models.ProcessFts, models.ProcessStepsOrder[models.ProcessFts])
+	selectQuery := s.sq.Select("documents.id as document_id, steps.action, steps.action_order").
+		From("documents").
+		Join(fmt.Sprintf("(SELECT DISTINCT * FROM (VALUES %s) AS v) AS steps(action, action_order) ON TRUE", stepSql)).
+		Where("documents.user_id = ?", userId).
+		Where("documents.document_type_id = ?", typeId)
+
+	query := s.sq.Insert("process_queue").
+		Columns("document_id", "action", "action_order").
+		Select(selectQuery).
+		Suffix("ON CONFLICT DO NOTHING")
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		e := errors.ErrInternalError
+		e.Err = err
+		return e
+	}
+
+	_, err = s.db.Exec(sql, args...)
+	return getDatabaseError(err, s, "queue documents by document type")
+}
+
 func (s *JobStore) AddDocuments(exec SqlExecer, userId int, documents []string, steps []models.ProcessStep) error {
 
 	stepsSql := ""
@@ -437,3 +464,44 @@ func (s *JobStore) AddDocuments(exec SqlExecer, userId int, documents []string,
 	_, err := exec.ExecSq(query)
 	return getDatabaseError(err, s, "queue documents by metadata")
 }
+
+// AddRuleTriggers queues running rules with triggers for the documents. Documents are only queued
+// if document owner has enabled rules with any of the triggers and the same triggers are not already queued.
+func (s *JobStore) AddRuleTriggers(exec SqlExecer, documents []string, triggers models.RuleTriggers) error {
+	if len(documents) == 0 || len(triggers) == 0 {
+		return nil
+	}
+
+	ruleTriggers := squirrel.Or{}
+	for _, v := range triggers {
+		ruleTriggers = append(ruleTriggers, squirrel.Expr("? = ANY(string_to_array(rules.triggers, ','))", v.String()))
+	}
+	// placeholders are replaced when the subquery is embedded to the insert
+	rules := squirrel.Select("1").From("rules").
+		Where("rules.user_id = documents.user_id").
+		Where("rules.enabled = TRUE").
+		Where(ruleTriggers)
+	rulesSql, rulesArgs, err := rules.ToSql()
+	if err != nil {
+		return fmt.Errorf("sql: %v", err)
+	}
+
+	selectQuery := s.sq.Select().
+		Column("documents.id AS document_id").
+		Column("CAST(? AS TEXT) AS action", models.ProcessRules.String()).
+		Column("CAST(? AS INT) AS action_order", models.ProcessStepsOrder[models.ProcessRules]).
+		Column("CAST(? AS TEXT) AS rule_triggers", triggers.String()).
+		From("documents").
+		Where(squirrel.Eq{"documents.id": documents}).
+		Where("documents.deleted_at IS NULL").
+		Where(squirrel.Expr("EXISTS ("+rulesSql+")", rulesArgs...)).
+		Where("NOT EXISTS (SELECT 1 FROM process_queue pq WHERE pq.document_id = documents.id "+
+			"AND pq.action = ? AND pq.rule_triggers = ? AND pq.running = FALSE)", models.ProcessRules.String(), triggers.String())
+
+	query := s.sq.Insert("process_queue").
+		Columns("document_id", "action", "action_order", "rule_triggers").
+		Select(selectQuery)
+
+	_, err = exec.ExecSq(query)
+	return getDatabaseError(err, s, "queue rule triggers")
+}
@@ -122,6 +122,10 @@ func (s MetadataStore) parseError(err error, action string) error {
 
 // GetDocumentMetadata returns key-value metadata for given document. If userId != 0, user must own document.
 func (s *MetadataStore) GetDocumentMetadata(userId int, documentId string) (*[]models.Metadata, error) {
+	return s.getDocumentMetadata(s.db, userId, documentId)
+}
+
+func (s *MetadataStore) getDocumentMetadata(exec dbQuerier, userId int, documentId string) (*[]models.Metadata, error) {
 	var sql string
 	var args []interface{}
 
@@ -134,7 +138,8 @@ SELECT
 	mk.icon as icon,
 	mk.style as style,
 	mv.id AS value_id,
-	mv.value AS value
+	mv.value AS value,
+	COALESCE(mk.value_type, 'text') AS key_type
 FROM documents d
 LEFT JOIN document_metadata dm ON d.id = dm.document_id
 LEFT JOIN metadata_keys mk ON dm.key_id = mk.id
@@ -153,7 +158,8 @@ SELECT
 	mk.icon as icon,
 	mk.style as style,
 	mv.id AS value_id,
-	mv.value AS value
+	mv.value AS value,
+	COALESCE(mk.value_type, 'text') AS key_type
 FROM documents d
 LEFT JOIN document_metadata dm ON d.id = dm.document_id
 LEFT JOIN metadata_keys mk ON dm.key_id = mk.id
@@ -165,7 +171,7 @@ ORDER BY key ASC;
 	}
 
 	object := &[]models.Metadata{}
-	err := s.db.Select(object, sql, args...)
+	err := exec.Select(object, sql, args...)
 	if err != nil {
 		if strings.Contains(err.Error(), "converting NULL to int") {
 			return object, nil
@@ -183,9 +189,9 @@ func (s *MetadataStore) GetUserKeysCached(userId int) (*[]models.MetadataKey, er
 	}
 
 	query := s.sq.Select("mk.id as id", "lower(mk.key) as key", "mk.comment as comment",
-		"mk.created_at as created_at").
+		"mk.created_at as created_at", "mk.value_type as value_type").
 		From("metadata_keys mk").LeftJoin("document_metadata dm ON mk.id = dm.key_id").
-		Where(squirrel.Eq{"user_id": userId}).GroupBy("mk.id").
+		Where(accessibleKeysCondition("mk.id", userId)).GroupBy("mk.id").
 		OrderBy("COUNT(dm.document_id) DESC").Limit(config.MaxRows)
 
 	sql, args, err := query.ToSql()
@@ -217,7 +223,7 @@ func (s *MetadataStore) GetUserKeyValuesCached(userId int, key string) (*[]model
 		From("metadata_values mv").
 		LeftJoin("metadata_keys mk on mv.key_id = mk.id").
 		LeftJoin("document_metadata dm on mv.id = dm.value_id").
-		Where(squirrel.Eq{"mv.user_id": userId}).
+		Where(accessibleKeysCondition("mk.id", userId)).
 		Where(squirrel.Eq{"lower(mk.key)": key}).
 		GroupBy("mv.id", "mv.value", "mk.id", "mk.key").
 		OrderBy("count(dm.document_id) DESC").Limit(config.MaxRows)
@@ -269,12 +275,13 @@ func (s *MetadataStore) GetUserLangsCached(userId int) (*[]string, error) {
 func (s *MetadataStore) GetKeys(userId int, ids []int, sort SortKey, paging Paging) (*[]models.MetadataKeyAnnotated, int, error) {
 	paging.Validate()
 	sort.Validate("id")
-	query := s.sq.Select("mk.id as id", "mk.key as key", "mk.comment as comment",
+	query := s.sq.Select("mk.id as id", "mk.key as key", "mk.comment as comment", "mk.value_type as value_type",
 		"mk.created_at as created_at", "COUNT(distinct(dm.document_id)) as documents_count", "COUNT(distinct(mv.id)) as values_count").
 		From("metadata_keys mk").
 		LeftJoin("document_metadata dm ON mk.id = dm.key_id").
 		LeftJoin("metadata_values mv on mk.id = mv.key_id").
-		Where(squirrel.Eq{"mk.user_id": userId}).GroupBy("mk.id")
+		Column(squirrel.Expr("mk.user_id <> ? AS shared", userId)).
+		Where(accessibleKeysCondition("mk.id", userId)).GroupBy("mk.id")
 
 	if len(ids) > 0 {
 		query = query.Where(squirrel.Eq{"mv.id": ids})
@@ -294,7 +301,7 @@ func (s *MetadataStore) GetKeys(userId int, ids []int, sort SortKey, paging Pagi
 		return keys, 0, s.parseError(err, "get keys")
 	}
 
-	countSql := "SELECT count(id) as count FROM metadata_keys WHERE user_id = $1"
+	countSql := "SELECT count(id) as count FROM metadata_keys WHERE id IN (" + accessibleKeys("$1") + ")"
 	count := 0
 	err = s.db.Get(&count, countSql, userId)
 	return keys, count, s.parseError(err, "get keys")
@@ -325,6 +332,11 @@ func (s *MetadataStore) GetValues(keyId int, sort SortKey, paging Paging) (*[]mo
 		"match_documents",
 		"match_type",
 		"match_filter",
+		"mv.value_number as value_number",
+		"mv.value_date as value_date",
+		"mv.value_bool as value_bool",
+		"mv.value_currency as value_currency",
+		"mv.parent_id as parent_id",
 		"count(dm.document_id) as documents_count").
 		From("metadata_values mv").
 		LeftJoin("document_metadata dm on mv.id = dm.value_id").
@@ -344,6 +356,26 @@ func (s *MetadataStore) GetValues(keyId int, sort SortKey, paging Paging) (*[]mo
 
 // UpdateDocumentKeyValues updates key-values for document.
 func (s *MetadataStore) UpdateDocumentKeyValues(userId int, documentId string, metadata []models.Metadata) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return s.parseError(err, "update document, start tx")
+	}
+	err = s.updateDocumentKeyValues(tx, userId, documentId, metadata)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			logrus.Warningf("rollback tx: %v", rollbackErr)
+		}
+		return err
+	}
+	return s.parseError(tx.Commit(), "update document key-values, commit")
+}
+
+// UpdateDocumentKeyValuesTx updates key-values for document within the transaction.
+func (s *MetadataStore) UpdateDocumentKeyValuesTx(exec SqlExecer, userId int, documentId string, metadata []models.Metadata) error {
+	return s.updateDocumentKeyValues(exec, userId, documentId, metadata)
+}
+
+func (s *MetadataStore) updateDocumentKeyValues(exec dbQuerier, userId int, documentId string, metadata []models.Metadata) error {
 	logrus.Debugf("update document %s metadata, key-values: %d", documentId, len(metadata))
 
 	var sql string
@@ -366,7 +398,7 @@ END;
 `
 
 			var ownership bool
-			err = s.db.Get(&ownership, sql, documentId, userId)
+			err = exec.Get(&ownership, sql, documentId, userId)
 			if err != nil {
 				return s.parseError(err, "update key-values, check ownership")
 			}
@@ -376,26 +408,20 @@ END;
 		}
 	}
 
-	originalMetadata, err := s.GetDocumentMetadata(userId, documentId)
+	originalMetadata, err := s.getDocumentMetadata(exec, userId, documentId)
 	if err != nil {
 		return s.parseError(err, "get document")
 	}
 
-	tx, err := s.db.Beginx()
-	if err != nil {
-		return s.parseError(err, "update document, start tx")
-	}
-
 	sql = `
 	DELETE
 	FROM document_metadata m
 	WHERE m.document_id = $1;
 	`
 
-	_, err = tx.Exec(sql, documentId)
+	_, err = exec.Exec(sql, documentId)
 	if err != nil {
-		logrus.Warningf("error deleting old metadata: %v", err)
-		return s.parseError(tx.Rollback(), "rollback tx")
+		return s.parseError(err, "delete old metadata")
 	}
 
 	if len(metadata) > 0 {
@@ -415,26 +441,19 @@ END;
 			args = append(args, v.KeyId, v.ValueId)
 		}
 
-		_, err = tx.Exec(sql, args...)
-
-	}
-	if err != nil {
-		err = tx.Rollback()
-	} else {
-		err = tx.Commit()
-	}
-
-	if err != nil {
-		return s.parseError(err, "update document key-values")
+		_, err = exec.Exec(sql, args...)
+		if err != nil {
+			return s.parseError(err, "update document key-values")
+		}
 	}
 
-	updatedMetadata, err := s.GetDocumentMetadata(userId, documentId)
+	updatedMetadata, err := s.getDocumentMetadata(exec, userId, documentId)
 	if err != nil {
 		return s.parseError(err, "get updated document metadata")
 	}
 
 	diff := models.MetadataDiff(documentId, userId, originalMetadata, updatedMetadata)
-	err = addDocumentHistoryAction(s.db, s.sq, diff, userId)
+	err = addDocumentHistoryAction(exec, s.sq, diff, userId)
 	logrus.Infof("User %d edited document %s with %d actions", userId, documentId, len(diff))
 	return err
 }
@@ -478,56 +497,82 @@ END AS exists;
 
 // CreateKey creates new metadata key.
 func (s *MetadataStore) CreateKey(userId int, key *models.MetadataKey) error {
+	return s.createKey(s.db, userId, key)
+}
 
+// CreateKeyTx creates new metadata key within the transaction.
+func (s *MetadataStore) CreateKeyTx(exec SqlExecer, userId int, key *models.MetadataKey) error {
+	return s.createKey(exec, userId, key)
+}
+
+func (s *MetadataStore) createKey(exec dbQuerier, userId int, key *models.MetadataKey) error {
 	sql := `
 INSERT INTO metadata_keys
-(user_id, key, comment, icon, style)
-VALUES ($1, $2, $3, $4, $5)
+(user_id, key, comment, icon, style, value_type, auto_apply_threshold)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
 RETURNING id;
 `
 
-	res, err := s.db.Query(sql, userId, key.Key, key.Comment, key.Icon, key.Style)
+	err := exec.Get(&key.Id, sql, userId, key.Key, key.Comment, key.Icon, key.Style, key.Type.String(), key.AutoApplyThreshold)
 	if err != nil {
 		return s.parseError(err, "create key")
 	}
-
-	if res.Next() {
-		var id int
-		err = res.Scan(&id)
-		if err != nil {
-			return s.parseError(err, "create key, scan id")
-		}
-		key.Id = id
-		res.Close()
-	}
 	s.flushCachedUserKeys(userId)
 	return nil
 }
 
 // CreateValue creates new metadata value.
 func (s *MetadataStore) CreateValue(value *models.MetadataValue) error {
+	return s.createValue(s.db, value)
+}
+
+// CreateValueTx creates new metadata value within the transaction.
+func (s *MetadataStore) CreateValueTx(exec SqlExecer, value *models.MetadataValue) error {
+	return s.createValue(exec, value)
+}
+
+func (s *MetadataStore) createValue(exec dbQuerier, value *models.MetadataValue) error {
 	sql := `
 INSERT INTO metadata_values
-(user_id, key_id, value, match_documents, match_type, match_filter)
-VALUES ($1, $2, $3, $4, $5, $6)
+(user_id, key_id, value, match_documents, match_type, match_filter, value_number, value_date, value_bool, value_currency, parent_id)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 RETURNING id;
 `
 
-	res, err := s.db.Query(sql, value.UserId, value.KeyId, value.Value, value.MatchDocuments, value.MatchType, value.MatchFilter)
-	if err != nil {
-		return s.parseError(err, "create value")
-	}
+	err := exec.Get(&value.Id, sql, value.UserId, value.KeyId, value.Value, value.MatchDocuments, value.MatchType, value.MatchFilter,
+		value.NumberValue, value.DateValue, value.BoolValue, value.Currency, value.ParentId)
+	return s.parseError(err, "create value")
+}
 
-	if res.Next() {
-		var id int
-		err = res.Scan(&id)
-		if err != nil {
-			return s.parseError(err, "create value, scan id")
-		}
-		value.Id = id
-		res.Close()
-	}
-	return nil
+// GetValueByName returns user's metadata value under key that matches the given value case-insensitively.
+func (s *MetadataStore) GetValueByName(userId, keyId int, value string) (*models.MetadataValue, error) {
+	sql := `
+SELECT *
+FROM metadata_values
+WHERE user_id = $1
+AND key_id = $2
+AND lower(value) = lower($3)
+ORDER BY id ASC
+LIMIT 1;
+`
+	object := &models.MetadataValue{}
+	err := s.db.Get(object, sql, userId, keyId, value)
+	return object, s.parseError(err, "get value by name")
+}
+
+// GetKeyByName returns user's metadata key that matches the given key case-insensitively.
+func (s *MetadataStore) GetKeyByName(userId int, key string) (*models.MetadataKey, error) {
+	sql := `
+SELECT *
+FROM metadata_keys
+WHERE user_id = $1
+AND lower(key) = lower($2)
+ORDER BY id ASC
+LIMIT 1;
+`
+	object := &models.MetadataKey{}
+	err := s.db.Get(object, sql, userId, key)
+	return object, s.parseError(err, "get key by name")
 }
 
 // GetDocumentTags returns tags for given document.
@@ -630,6 +675,7 @@ VALUES ($1, $2, $3, $4, $5) RETURNING id;
 	return nil
 }
 
+// UserHasKeyValue returns true if the value belongs to the key and the user can access the key.
 func (s *MetadataStore) UserHasKeyValue(userId, keyId, valueId int) (bool, error) {
 
 	sql := `
@@ -637,7 +683,7 @@ SELECT CASE WHEN EXISTS (
     SELECT mv.id
         FROM metadata_values mv
         LEFT JOIN metadata_keys mk ON mv.key_id = mk.id
-        WHERE mk.user_id = $1
+        WHERE mk.id IN (` + accessibleKeys("$1") + `)
             AND mv.id = $3
     AND mk.id = $2
     )
@@ -649,6 +695,7 @@ THEN TRUE ELSE FALSE END AS exists;
 	return ownership, s.parseError(err, "check user has key-value")
 }
 
+// UserHasKey returns true if the user owns the key.
 func (s *MetadataStore) UserHasKey(userId, keyId int) (bool, error) {
 	sql := `
 SELECT CASE WHEN EXISTS (
@@ -664,12 +711,13 @@ THEN TRUE ELSE FALSE END AS exists;
 	return ownership, s.parseError(err, "check user has key")
 }
 
+// UserHasKeys returns true if the user can access all the keys.
 func (s *MetadataStore) UserHasKeys(exec SqlExecer, userId int, keys []int) (bool, error) {
 
 	sql := `
 SELECT count(distinct(id)) 
 FROM metadata_keys
-WHERE user_id=$1 AND id IN (
+WHERE id IN (` + accessibleKeys("$1") + `) AND id IN (
 `
 	args := make([]interface{}, len(keys)+1)
 	args[0] = fmt.Sprintf("%d", userId)
@@ -693,22 +741,24 @@ WHERE user_id=$1 AND id IN (
 func (s *MetadataStore) UpdateValue(value *models.MetadataValue) error {
 	sql := `
 	UPDATE metadata_values
-	SET value=$1, match_documents=$2, match_type=$3, match_filter=$4
-	WHERE id=$5;
+	SET value=$1, match_documents=$2, match_type=$3, match_filter=$4,
+	    value_number=$5, value_date=$6, value_bool=$7, value_currency=$8, parent_id=$9
+	WHERE id=$10;
 `
 
-	_, err := s.db.Exec(sql, value.Value, value.MatchDocuments, value.MatchType, value.MatchFilter, value.Id)
+	_, err := s.db.Exec(sql, value.Value, value.MatchDocuments, value.MatchType, value.MatchFilter,
+		value.NumberValue, value.DateValue, value.BoolValue, value.Currency, value.ParentId, value.Id)
 	return s.parseError(err, "update value")
 }
 
 func (s *MetadataStore) UpdateKey(key *models.MetadataKey) error {
 	sql := `
 UPDATE metadata_keys 
-SET key=$1, comment=$2, icon=$3, style=$4
-WHERE id=$5;
+SET key=$1, comment=$2, icon=$3, style=$4, value_type=$5, auto_apply_threshold=$6
+WHERE id=$7;
 `
 
-	_, err := s.db.Exec(sql, key.Key, key.Comment, key.Icon, key.Style, key.Id)
+	_, err := s.db.Exec(sql, key.Key, key.Comment, key.Icon, key.Style, key.Type.String(), key.AutoApplyThreshold, key.Id)
 	if err != nil {
 		return s.parseError(err, "update key")
 	}
@@ -716,15 +766,93 @@ WHERE id=$5;
 	return nil
 }
 
+// GetValueAncestors returns the ids of the value and all its parents, starting from the value.
+func (s *MetadataStore) GetValueAncestors(valueId int) ([]int, error) {
+	sql := `
+WITH RECURSIVE ancestors AS (
+    SELECT id, parent_id, 0 AS depth FROM metadata_values WHERE id = $1
+    UNION
+    SELECT mv.id, mv.parent_id, a.depth + 1 FROM metadata_values mv
+    JOIN ancestors a ON mv.id = a.parent_id
+    WHERE a.depth <= $2
+)
+SELECT id FROM ancestors ORDER BY depth ASC;
+`
+	ids := []int{}
+	err := s.db.Select(&ids, sql, valueId, models.MaxMetadataValueDepth)
+	return ids, s.parseError(err, "get value ancestors")
+}
+
+// GetValueHeight returns the number of levels of values under the value, 0 if value has no children.
+func (s *MetadataStore) GetValueHeight(valueId int) (int, error) {
+	sql := `
+WITH RECURSIVE tree AS (
+    SELECT id, 0 AS depth FROM metadata_values WHERE id = $1
+    UNION
+    SELECT mv.id, t.depth + 1 FROM metadata_values mv
+    JOIN tree t ON mv.parent_id = t.id
+    WHERE t.depth <= $2
+)
+SELECT COALESCE(MAX(depth), 0) FROM tree;
+`
+	height := 0
+	err := s.db.Get(&height, sql, valueId, models.MaxMetadataValueDepth)
+	return height, s.parseError(err, "get value height")
+}
+
+// GetValueDescendants returns the lower-case names of all values under the value, excluding the value itself.
+// Key and value are matched case-insensitively.
+func (s *MetadataStore) GetValueDescendants(userId int, key, value string) ([]string, error) {
+	sql := `
+WITH RECURSIVE tree AS (
+    SELECT mv.id, 0 AS depth FROM metadata_values mv
+    JOIN metadata_keys mk ON mv.key_id = mk.id
+    WHERE mk.id IN (` + accessibleKeys("$1") + `)
+    AND lower(mk.key) = lower($2)
+    AND lower(mv.value) = lower($3)
+    UNION
+    SELECT mv.id, t.depth + 1 FROM metadata_values mv
+    JOIN tree t ON mv.parent_id = t.id
+    WHERE t.depth < $4
+)
+SELECT DISTINCT lower(mv.value) AS value
+FROM tree
+JOIN metadata_values mv ON mv.id = tree.id
+WHERE tree.depth > 0
+ORDER BY value ASC
+LIMIT $5;
+`
+	values := []string{}
+	err := s.db.Select(&values, sql, userId, key, value, models.MaxMetadataValueDepth, config.MaxRows)
+	return values, s.parseError(err, "get value descendants")
+}
+
+// KeyHasValues returns true if key has any values.
+func (s *MetadataStore) KeyHasValues(keyId int) (bool, error) {
+	sql := `
+SELECT CASE WHEN EXISTS (
+    SELECT id FROM metadata_values WHERE key_id = $1
+    )
+THEN TRUE ELSE FALSE END AS exists;
+`
+	var exists bool
+	err := s.db.Get(&exists, sql, keyId)
+	return exists, s.parseError(err, "check key has values")
+}
+
 // CheckKeyValuesExist verifies key-value pairs exist and user owns them.
 func (s *MetadataStore) CheckKeyValuesExist(userId int, values []models.Metadata) error {
+	return s.checkKeyValuesExist(s.db, userId, values)
+}
+
+func (s *MetadataStore) checkKeyValuesExist(exec dbQuerier, userId int, values []models.Metadata) error {
 	array := make(squirrel.Or, len(values))
 	for i, key := range values {
 		array[i] = squirrel.And{squirrel.Eq{"key_id": key.KeyId}, squirrel.Eq{"id": key.ValueId}}
 	}
 
 	query := s.sq.Select("count(id)").From("metadata_values").
-		Where(squirrel.And{squirrel.Eq{"user_id": userId}, array})
+		Where(squirrel.And{accessibleKeysCondition("key_id", userId), array})
 	sql, args, err := query.ToSql()
 	if err != nil {
 		err := errors.ErrInternalError
@@ -732,7 +860,7 @@ func (s *MetadataStore) CheckKeyValuesExist(userId int, values []models.Metadata
 		return err
 	}
 	var count int
-	err = s.db.Get(&count, sql, args...)
+	err = exec.Get(&count, sql, args...)
 	if err != nil {
 		return getDatabaseError(err, s, "verify metadata exists")
 	}
@@ -919,6 +1047,28 @@ func (s *MetadataStore) GetLinkedDocuments(userId int, docId string) ([]*models.
 	return docs, nil
 }
 
+// LinkDocument links two documents, if they are not linked yet. Returns true if the link was created.
+func (s *MetadataStore) LinkDocument(exec SqlExecer, docId, targetId string) (bool, error) {
+	sql := `
+INSERT INTO linked_documents (doc_a_id, doc_b_id)
+SELECT CAST($1 AS TEXT), CAST($2 AS TEXT)
+WHERE NOT EXISTS (
+    SELECT 1 FROM linked_documents
+    WHERE (doc_a_id = $1 AND doc_b_id = $2)
+       OR (doc_a_id = $2 AND doc_b_id = $1)
+);
+`
+	res, err := exec.Exec(sql, docId, targetId)
+	if err != nil {
+		return false, s.parseError(err, "link document")
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("get affected rows: %v", err)
+	}
+	return rows > 0, nil
+}
+
 // UpdateLinkedDocuments updates document. This does not validate ownership of the documents.
 func (s *MetadataStore) UpdateLinkedDocuments(userId int, docId string, docs []string) error {
 	tx, err := s.beginTx()
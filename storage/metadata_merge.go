@@ -0,0 +1,168 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Masterminds/squirrel"
+	"tryffel.net/go/virtualpaper/models"
+)
+
+// GetValue returns metadata value by id.
+func (s *MetadataStore) GetValue(exec SqlExecer, valueId int) (*models.MetadataValue, error) {
+	value := &models.MetadataValue{}
+	err := exec.GetSq(value, s.sq.Select("*").From("metadata_values").Where("id = ?", valueId))
+	return value, s.parseError(err, "get value")
+}
+
+// getKeyValues returns all values of the key.
+func (s *MetadataStore) getKeyValues(exec SqlExecer, keyId int) ([]*models.MetadataValue, error) {
+	values := []*models.MetadataValue{}
+	err := exec.SelectSq(&values, s.sq.Select("*").From("metadata_values").Where("key_id = ?", keyId).OrderBy("id ASC"))
+	return values, s.parseError(err, "get key values")
+}
+
+// GetKeyValues returns all values of the key without paging.
+func (s *MetadataStore) GetKeyValues(exec SqlExecer, keyId int) ([]*models.MetadataValue, error) {
+	return s.getKeyValues(exec, keyId)
+}
+
+// valueDocuments returns ids of the documents that have the value.
+func (s *MetadataStore) valueDocuments(exec SqlExecer, valueId int) ([]string, error) {
+	docs := []string{}
+	err := exec.SelectSq(&docs, s.sq.Select("DISTINCT document_id").From("document_metadata").Where("value_id = ?", valueId))
+	return docs, s.parseError(err, "get value documents")
+}
+
+// MergeValue rewrites all references to value source in documents and rules to value target and deletes the source
+// value. Children of source are moved under target. Returns the ids of the documents that had the source value.
+func (s *MetadataStore) MergeValue(exec SqlExecer, source, target *models.MetadataValue) ([]string, error) {
+	docs, err := s.valueDocuments(exec, source.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	query := s.sq.Insert("document_metadata").Columns("document_id", "key_id", "value_id").
+		Select(s.sq.Select("document_id", fmt.Sprint(target.KeyId), fmt.Sprint(target.Id)).
+			From("document_metadata").Where("value_id = ?", source.Id)).
+		Suffix("ON CONFLICT (document_id, key_id, value_id) DO NOTHING")
+	_, err = exec.ExecSq(query)
+	if err != nil {
+		return nil, s.parseError(err, "merge document metadata")
+	}
+	_, err = exec.ExecSq(s.sq.Delete("document_metadata").Where("value_id = ?", source.Id))
+	if err != nil {
+		return nil, s.parseError(err, "delete merged document metadata")
+	}
+
+	for _, table := range []string{"rule_conditions", "rule_actions"} {
+		_, err = exec.ExecSq(s.sq.Update(table).
+			Set("metadata_key", target.KeyId).
+			Set("metadata_value", target.Id).
+			Where("metadata_value = ?", source.Id))
+		if err != nil {
+			return nil, s.parseError(err, "merge metadata value in "+table)
+		}
+	}
+
+	_, err = exec.ExecSq(s.sq.Update("metadata_values").Set("parent_id", target.Id).
+		Where(squirrel.And{squirrel.Eq{"parent_id": source.Id}, squirrel.NotEq{"id": target.Id}}))
+	if err != nil {
+		return nil, s.parseError(err, "move child values")
+	}
+
+	_, err = exec.ExecSq(s.sq.Delete("metadata_values").Where("id = ?", source.Id))
+	if err != nil {
+		return nil, s.parseError(err, "delete merged value")
+	}
+	return docs, nil
+}
+
+// MoveValue moves value to another key, rewriting the key in documents and rules.
+// Returns the ids of the documents that have the value.
+func (s *MetadataStore) MoveValue(exec SqlExecer, value *models.MetadataValue, keyId int) ([]string, error) {
+	docs, err := s.valueDocuments(exec, value.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = exec.ExecSq(s.sq.Update("metadata_values").Set("key_id", keyId).Where("id = ?", value.Id))
+	if err != nil {
+		return nil, s.parseError(err, "move value")
+	}
+	_, err = exec.ExecSq(s.sq.Update("document_metadata").Set("key_id", keyId).Where("value_id = ?", value.Id))
+	if err != nil {
+		return nil, s.parseError(err, "move document metadata")
+	}
+	for _, table := range []string{"rule_conditions", "rule_actions"} {
+		_, err = exec.ExecSq(s.sq.Update(table).Set("metadata_key", keyId).Where("metadata_value = ?", value.Id))
+		if err != nil {
+			return nil, s.parseError(err, "move metadata value in "+table)
+		}
+	}
+	value.KeyId = keyId
+	return docs, nil
+}
+
+// DetachValue removes the value from its parent and moves its children to the top level.
+func (s *MetadataStore) DetachValue(exec SqlExecer, valueId int) error {
+	_, err := exec.ExecSq(s.sq.Update("metadata_values").Set("parent_id", nil).
+		Where(squirrel.Or{squirrel.Eq{"id": valueId}, squirrel.Eq{"parent_id": valueId}}))
+	return s.parseError(err, "detach value")
+}
+
+// MergeKey rewrites the remaining rule references from key source to target and deletes the source key.
+// Values of the source key must be moved before merging.
+func (s *MetadataStore) MergeKey(exec SqlExecer, userId int, source, target *models.MetadataKey) error {
+	for _, table := range []string{"rule_conditions", "rule_actions"} {
+		_, err := exec.ExecSq(s.sq.Update(table).Set("metadata_key", target.Id).Where("metadata_key = ?", source.Id))
+		if err != nil {
+			return s.parseError(err, "merge metadata key in "+table)
+		}
+	}
+	_, err := exec.ExecSq(s.sq.Delete("metadata_keys").Where("id = ?", source.Id))
+	if err != nil {
+		return s.parseError(err, "delete merged key")
+	}
+	s.flushCachedUserKeys(userId)
+	s.flushCachedUserKeyValues(userId, strings.ToLower(source.Key))
+	s.flushCachedUserKeyValues(userId, strings.ToLower(target.Key))
+	return nil
+}
+
+// AddMetadataMergeHistory records that value oldValue was replaced with newValue in the documents.
+// Values are formatted as 'key:value'.
+func (s *MetadataStore) AddMetadataMergeHistory(exec SqlExecer, userId int, docs []string, oldValue, newValue string) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	items := make([]models.DocumentHistory, len(docs))
+	for i, v := range docs {
+		items[i] = models.DocumentHistory{
+			DocumentId: v,
+			Action:     models.DocumentHistoryActionMetadataMerge,
+			OldValue:   oldValue,
+			NewValue:   newValue,
+		}
+	}
+	_, err := exec.ExecSq(documentHistoryQuery(s.sq, items, userId))
+	return s.parseError(err, "add metadata merge history")
+}
@@ -0,0 +1,143 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package storage
+
+import (
+	"github.com/lib/pq"
+	"tryffel.net/go/virtualpaper/models"
+)
+
+// GetMetadataTrainingDocuments returns the latest classified documents of the user, which metadata suggestions
+// are learned from. Only values of text keys are included. Content is truncated to maxContentLength characters.
+func (s *MetadataStore) GetMetadataTrainingDocuments(userId, limit, maxContentLength int) ([]models.MetadataTrainingDocument, error) {
+	sql := `
+SELECT d.id AS id, LEFT(d.content, $2) AS content
+FROM documents d
+WHERE d.user_id = $1
+AND d.deleted_at IS NULL
+AND EXISTS (
+    SELECT 1 FROM document_metadata dm
+    JOIN metadata_keys mk ON dm.key_id = mk.id
+    WHERE dm.document_id = d.id AND mk.value_type = $3
+)
+ORDER BY d.updated_at DESC
+LIMIT $4;
+`
+	type document struct {
+		Id      string `db:"id"`
+		Content string `db:"content"`
+	}
+	docs := make([]document, 0)
+	err := s.db.Select(&docs, sql, userId, maxContentLength, models.MetadataKeyTypeText.String(), limit)
+	if err != nil {
+		return nil, s.parseError(err, "get metadata training documents")
+	}
+	if len(docs) == 0 {
+		return []models.MetadataTrainingDocument{}, nil
+	}
+
+	ids := make([]string, len(docs))
+	for i, v := range docs {
+		ids[i] = v.Id
+	}
+
+	metadataSql := `
+SELECT dm.document_id AS document_id, dm.key_id AS key_id, dm.value_id AS value_id
+FROM document_metadata dm
+JOIN metadata_keys mk ON dm.key_id = mk.id
+WHERE dm.document_id = ANY($1)
+AND mk.value_type = $2;
+`
+	type documentMetadata struct {
+		DocumentId string `db:"document_id"`
+		models.Metadata
+	}
+	metadata := make([]documentMetadata, 0)
+	err = s.db.Select(&metadata, metadataSql, pq.StringArray(ids), models.MetadataKeyTypeText.String())
+	if err != nil {
+		return nil, s.parseError(err, "get metadata training documents metadata")
+	}
+
+	documentMetadataMap := make(map[string][]models.Metadata, len(docs))
+	for _, v := range metadata {
+		documentMetadataMap[v.DocumentId] = append(documentMetadataMap[v.DocumentId], v.Metadata)
+	}
+
+	result := make([]models.MetadataTrainingDocument, len(docs))
+	for i, v := range docs {
+		result[i] = models.MetadataTrainingDocument{
+			DocumentId: v.Id,
+			Content:    v.Content,
+			Metadata:   documentMetadataMap[v.Id],
+		}
+	}
+	return result, nil
+}
+
+// GetSuggestionKeys returns the keys of the user that metadata can be suggested for.
+func (s *MetadataStore) GetSuggestionKeys(userId int) ([]models.MetadataKey, error) {
+	sql := `
+SELECT *
+FROM metadata_keys
+WHERE user_id = $1
+AND value_type = $2;
+`
+	keys := make([]models.MetadataKey, 0)
+	err := s.db.Select(&keys, sql, userId, models.MetadataKeyTypeText.String())
+	return keys, s.parseError(err, "get suggestion keys")
+}
+
+// SetDocumentMetadataSuggestions replaces the metadata suggestions of the document.
+func (s *MetadataStore) SetDocumentMetadataSuggestions(exec SqlExecer, docId string, suggestions []models.MetadataSuggestion) error {
+	_, err := exec.ExecSq(s.sq.Delete("document_metadata_suggestions").Where("document_id = ?", docId))
+	if err != nil {
+		return s.parseError(err, "delete document metadata suggestions")
+	}
+	if len(suggestions) == 0 {
+		return nil
+	}
+
+	query := s.sq.Insert("document_metadata_suggestions").Columns("document_id", "key_id", "value_id", "confidence")
+	for _, v := range suggestions {
+		query = query.Values(docId, v.KeyId, v.ValueId, v.Confidence)
+	}
+	_, err = exec.ExecSq(query)
+	return s.parseError(err, "insert document metadata suggestions")
+}
+
+// GetDocumentMetadataSuggestions returns the metadata suggestions of the document, most confident first.
+// Suggestions that the document already has are excluded.
+func (s *MetadataStore) GetDocumentMetadataSuggestions(docId string) ([]models.MetadataSuggestion, error) {
+	sql := `
+SELECT dms.document_id AS document_id, dms.key_id AS key_id, mk.key AS key,
+       dms.value_id AS value_id, mv.value AS value, dms.confidence AS confidence, dms.created_at AS created_at
+FROM document_metadata_suggestions dms
+JOIN metadata_keys mk ON dms.key_id = mk.id
+JOIN metadata_values mv ON dms.value_id = mv.id
+WHERE dms.document_id = $1
+AND NOT EXISTS (
+    SELECT 1 FROM document_metadata dm
+    WHERE dm.document_id = dms.document_id AND dm.value_id = dms.value_id
+)
+ORDER BY dms.confidence DESC, mk.key ASC, mv.value ASC;
+`
+	suggestions := make([]models.MetadataSuggestion, 0)
+	err := s.db.Select(&suggestions, sql, docId)
+	return suggestions, s.parseError(err, "get document metadata suggestions")
+}
@@ -0,0 +1,111 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"tryffel.net/go/virtualpaper/models"
+)
+
+// GetMetadataValueUsage returns the values of user's own keys with the number of documents and rules that use them.
+func (s *MetadataStore) GetMetadataValueUsage(userId int) ([]models.MetadataValueUsage, error) {
+	query := s.sq.Select("mk.id AS key_id", "mk.key AS key", "mk.value_type AS key_type",
+		"mv.id AS value_id", "mv.value AS value").
+		Column("(SELECT COUNT(DISTINCT dm.document_id) FROM document_metadata dm WHERE dm.value_id = mv.id) AS documents_count").
+		Column(`(SELECT COUNT(DISTINCT r.rule_id) FROM (
+			SELECT rule_id FROM rule_conditions WHERE metadata_value = mv.id
+			UNION SELECT rule_id FROM rule_actions WHERE metadata_value = mv.id) r) AS rules_count`).
+		From("metadata_values mv").
+		Join("metadata_keys mk ON mv.key_id = mk.id").
+		Where("mk.user_id = ?", userId).
+		OrderBy("mk.key ASC", "mv.value ASC")
+
+	values := []models.MetadataValueUsage{}
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("construct sql: %v", err)
+	}
+	err = s.db.Select(&values, sql, args...)
+	return values, s.parseError(err, "get metadata value usage")
+}
+
+// GetRarelyUsedKeys returns user's own keys that are used in at most maxDocuments documents.
+func (s *MetadataStore) GetRarelyUsedKeys(userId, maxDocuments int) ([]models.MetadataKeyUsage, error) {
+	usage := s.sq.Select("mk.id AS key_id", "mk.key AS key").
+		Column("(SELECT COUNT(DISTINCT dm.document_id) FROM document_metadata dm WHERE dm.key_id = mk.id) AS documents_count").
+		Column("(SELECT COUNT(mv.id) FROM metadata_values mv WHERE mv.key_id = mk.id) AS values_count").
+		From("metadata_keys mk").
+		Where("mk.user_id = ?", userId)
+	query := s.sq.Select("*").FromSelect(usage, "k").
+		Where("documents_count <= ?", maxDocuments).
+		OrderBy("documents_count ASC", "key ASC")
+
+	keys := []models.MetadataKeyUsage{}
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("construct sql: %v", err)
+	}
+	err = s.db.Select(&keys, sql, args...)
+	return keys, s.parseError(err, "get rarely used metadata keys")
+}
+
+// PurgeValue deletes the value of the key. Rule conditions and actions that refer to the value are deleted with it,
+// so the rules should be disabled first, see RuleStore.DisableRulesByMetadata.
+// Returns the ids of the documents that had the value.
+func (s *MetadataStore) PurgeValue(exec SqlExecer, key *models.MetadataKey, value *models.MetadataValue) ([]string, error) {
+	docs, err := s.valueDocuments(exec, value.Id)
+	if err != nil {
+		return nil, err
+	}
+	_, err = exec.ExecSq(s.sq.Update("metadata_values").Set("parent_id", value.ParentId).
+		Where("parent_id = ?", value.Id))
+	if err != nil {
+		return nil, s.parseError(err, "move child values")
+	}
+	_, err = exec.ExecSq(s.sq.Delete("metadata_values").Where("id = ?", value.Id))
+	if err != nil {
+		return nil, s.parseError(err, "delete value")
+	}
+	s.flushCachedUserKeyValues(key.UserId, strings.ToLower(key.Key))
+	return docs, nil
+}
+
+// PurgeKey deletes the key and all its values. Rule conditions and actions that refer to the key are deleted
+// with it, so the rules should be disabled first. Returns the ids of the documents that had the key.
+func (s *MetadataStore) PurgeKey(exec SqlExecer, key *models.MetadataKey) ([]string, error) {
+	docs := []string{}
+	err := exec.SelectSq(&docs, s.sq.Select("DISTINCT document_id").From("document_metadata").Where("key_id = ?", key.Id))
+	if err != nil {
+		return nil, s.parseError(err, "get key documents")
+	}
+	// values do not cascade from keys
+	_, err = exec.ExecSq(s.sq.Delete("metadata_values").Where("key_id = ?", key.Id))
+	if err != nil {
+		return nil, s.parseError(err, "delete key values")
+	}
+	_, err = exec.ExecSq(s.sq.Delete("metadata_keys").Where("id = ?", key.Id))
+	if err != nil {
+		return nil, s.parseError(err, "delete key")
+	}
+	s.flushCachedUserKeys(key.UserId)
+	s.flushCachedUserKeyValues(key.UserId, strings.ToLower(key.Key))
+	return docs, nil
+}
@@ -0,0 +1,336 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package storage
+
+import (
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+	"tryffel.net/go/virtualpaper/models"
+)
+
+// accessibleKeysSql selects the keys that the user owns or uses through subscribed vocabularies.
+// Argument is the placeholder of the user id.
+const accessibleKeysSql = `SELECT id FROM metadata_keys WHERE user_id = %[1]s
+UNION
+SELECT vk.key_id FROM metadata_vocabulary_keys vk
+JOIN metadata_vocabulary_subscribers vs ON vk.vocabulary_id = vs.vocabulary_id
+WHERE vs.user_id = %[1]s`
+
+// editableKeysSql selects the keys that the user can add and edit values of.
+// Argument is the placeholder of the user id.
+const editableKeysSql = `SELECT id FROM metadata_keys WHERE user_id = %[1]s
+UNION
+SELECT vk.key_id FROM metadata_vocabulary_keys vk
+JOIN metadata_vocabularies vc ON vk.vocabulary_id = vc.id
+JOIN metadata_vocabulary_subscribers vs ON vk.vocabulary_id = vs.vocabulary_id
+WHERE vs.user_id = %[1]s AND vc.editable`
+
+// accessibleKeys returns the sql for selecting keys that the user can use, with user id in the given placeholder.
+func accessibleKeys(placeholder string) string {
+	return fmt.Sprintf(accessibleKeysSql, placeholder)
+}
+
+// accessibleKeysCondition matches rows where the key in column is accessible to the user.
+func accessibleKeysCondition(column string, userId int) squirrel.Sqlizer {
+	return squirrel.Expr(fmt.Sprintf("%s IN (%s)", column, accessibleKeys("?")), userId, userId)
+}
+
+// UserCanAccessKey returns true if the user owns the key or uses it through a vocabulary.
+func (s *MetadataStore) UserCanAccessKey(userId, keyId int) (bool, error) {
+	return s.userCanAccessKey(s.db, userId, keyId)
+}
+
+func (s *MetadataStore) userCanAccessKey(exec dbQuerier, userId, keyId int) (bool, error) {
+	return s.keyExists(exec, squirrel.Expr(fmt.Sprintf("id IN (%s)", accessibleKeys("?")), userId, userId), keyId)
+}
+
+// UserCanEditKeyValues returns true if the user owns the key or uses it through an editable vocabulary.
+func (s *MetadataStore) UserCanEditKeyValues(userId, keyId int) (bool, error) {
+	return s.userCanEditKeyValues(s.db, userId, keyId)
+}
+
+func (s *MetadataStore) userCanEditKeyValues(exec dbQuerier, userId, keyId int) (bool, error) {
+	return s.keyExists(exec, squirrel.Expr(fmt.Sprintf("id IN (%s)", fmt.Sprintf(editableKeysSql, "?")), userId, userId), keyId)
+}
+
+func (s *MetadataStore) keyExists(exec dbQuerier, condition squirrel.Sqlizer, keyId int) (bool, error) {
+	query := s.sq.Select("count(id) > 0").From("metadata_keys").Where("id = ?", keyId).Where(condition)
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return false, fmt.Errorf("create sql: %v", err)
+	}
+	exists := false
+	err = exec.Get(&exists, sql, args...)
+	return exists, s.parseError(err, "check key access")
+}
+
+func (s *MetadataStore) vocabularyQuery(userId int) squirrel.SelectBuilder {
+	vocabularies := s.sq.Select("vc.id AS id", "vc.user_id AS user_id", "u.name AS owner_name", "vc.name AS name",
+		"vc.description AS description", "vc.editable AS editable", "vc.created_at AS created_at",
+		"vc.updated_at AS updated_at").
+		Column(squirrel.Expr("vc.user_id = ? AS owned", userId)).
+		Column(squirrel.Expr("EXISTS (SELECT 1 FROM metadata_vocabulary_members vm "+
+			"WHERE vm.vocabulary_id = vc.id AND vm.user_id = ?) AS member", userId)).
+		Column(squirrel.Expr("EXISTS (SELECT 1 FROM metadata_vocabulary_subscribers vs "+
+			"WHERE vs.vocabulary_id = vc.id AND vs.user_id = ?) AS subscribed", userId)).
+		Column("(SELECT count(*) FROM metadata_vocabulary_subscribers vs WHERE vs.vocabulary_id = vc.id) AS subscribers").
+		From("metadata_vocabularies vc").
+		Join("users u ON vc.user_id = u.id")
+	// users only see vocabularies they own or are allowed to subscribe to
+	return s.sq.Select("*").FromSelect(vocabularies, "v").Where("owned OR member OR subscribed")
+}
+
+// GetVocabularies returns the vocabularies the user owns, is a member of or has subscribed to.
+func (s *MetadataStore) GetVocabularies(userId int, sort SortKey, paging Paging) ([]*models.MetadataVocabulary, int, error) {
+	paging.Validate()
+	sort.SetDefaults("name", false)
+	query := s.vocabularyQuery(userId).
+		OrderBy(fmt.Sprintf("%s %s", sort.QueryKey(), sort.SortOrder())).
+		Offset(uint64(paging.Offset)).Limit(uint64(paging.Limit))
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, 0, fmt.Errorf("create sql: %v", err)
+	}
+	vocabularies := []*models.MetadataVocabulary{}
+	err = s.db.Select(&vocabularies, sql, args...)
+	if err != nil {
+		return nil, 0, s.parseError(err, "get vocabularies")
+	}
+	err = s.addVocabularyKeys(vocabularies)
+	if err != nil {
+		return nil, 0, err
+	}
+	err = s.addVocabularyMembers(vocabularies)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sql, args, err = s.sq.Select("count(*)").FromSelect(s.vocabularyQuery(userId), "c").ToSql()
+	if err != nil {
+		return nil, 0, fmt.Errorf("create sql: %v", err)
+	}
+	count := 0
+	err = s.db.Get(&count, sql, args...)
+	return vocabularies, count, s.parseError(err, "count vocabularies")
+}
+
+// GetVocabulary returns the vocabulary with its keys.
+func (s *MetadataStore) GetVocabulary(userId, vocabularyId int) (*models.MetadataVocabulary, error) {
+	sql, args, err := s.vocabularyQuery(userId).Where("id = ?", vocabularyId).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("create sql: %v", err)
+	}
+	vocabulary := &models.MetadataVocabulary{}
+	err = s.db.Get(vocabulary, sql, args...)
+	if err != nil {
+		return nil, s.parseError(err, "get vocabulary")
+	}
+	err = s.addVocabularyKeys([]*models.MetadataVocabulary{vocabulary})
+	if err != nil {
+		return nil, err
+	}
+	err = s.addVocabularyMembers([]*models.MetadataVocabulary{vocabulary})
+	return vocabulary, err
+}
+
+// addVocabularyMembers adds the members to the vocabularies the user owns.
+func (s *MetadataStore) addVocabularyMembers(vocabularies []*models.MetadataVocabulary) error {
+	ids := make([]int, 0, len(vocabularies))
+	for _, v := range vocabularies {
+		v.Members = []models.MetadataVocabularyMember{}
+		if v.Owned {
+			ids = append(ids, v.Id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	query := s.sq.Select("vm.vocabulary_id", "vm.user_id", "u.name AS user_name").
+		From("metadata_vocabulary_members vm").
+		Join("users u ON vm.user_id = u.id").
+		Where(squirrel.Eq{"vm.vocabulary_id": ids}).
+		OrderBy("u.name ASC")
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return fmt.Errorf("create sql: %v", err)
+	}
+	members := []models.MetadataVocabularyMember{}
+	err = s.db.Select(&members, sql, args...)
+	if err != nil {
+		return s.parseError(err, "get vocabulary members")
+	}
+	for _, member := range members {
+		for _, vocabulary := range vocabularies {
+			if vocabulary.Id == member.VocabularyId {
+				vocabulary.Members = append(vocabulary.Members, member)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *MetadataStore) addVocabularyKeys(vocabularies []*models.MetadataVocabulary) error {
+	if len(vocabularies) == 0 {
+		return nil
+	}
+	ids := make([]int, len(vocabularies))
+	for i, v := range vocabularies {
+		ids[i] = v.Id
+		v.Keys = []models.MetadataVocabularyKey{}
+	}
+	query := s.sq.Select("vk.vocabulary_id", "vk.key_id", "mk.key").
+		From("metadata_vocabulary_keys vk").
+		Join("metadata_keys mk ON vk.key_id = mk.id").
+		Where(squirrel.Eq{"vk.vocabulary_id": ids}).
+		OrderBy("mk.key ASC")
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return fmt.Errorf("create sql: %v", err)
+	}
+	keys := []models.MetadataVocabularyKey{}
+	err = s.db.Select(&keys, sql, args...)
+	if err != nil {
+		return s.parseError(err, "get vocabulary keys")
+	}
+	for _, key := range keys {
+		for _, vocabulary := range vocabularies {
+			if vocabulary.Id == key.VocabularyId {
+				vocabulary.Keys = append(vocabulary.Keys, key)
+			}
+		}
+	}
+	return nil
+}
+
+// CreateVocabulary creates a new vocabulary with its keys.
+func (s *MetadataStore) CreateVocabulary(exec SqlExecer, vocabulary *models.MetadataVocabulary) error {
+	query := s.sq.Insert("metadata_vocabularies").Columns("user_id", "name", "description", "editable").
+		Values(vocabulary.UserId, vocabulary.Name, vocabulary.Description, vocabulary.Editable).
+		Suffix("RETURNING id, created_at, updated_at")
+	err := exec.GetSq(vocabulary, query)
+	if err != nil {
+		return s.parseError(err, "create vocabulary")
+	}
+	err = s.setVocabularyKeys(exec, vocabulary)
+	if err != nil {
+		return err
+	}
+	return s.setVocabularyMembers(exec, vocabulary)
+}
+
+// UpdateVocabulary updates the vocabulary and replaces its keys.
+func (s *MetadataStore) UpdateVocabulary(exec SqlExecer, vocabulary *models.MetadataVocabulary) error {
+	vocabulary.Update()
+	query := s.sq.Update("metadata_vocabularies").
+		Set("name", vocabulary.Name).
+		Set("description", vocabulary.Description).
+		Set("editable", vocabulary.Editable).
+		Set("updated_at", vocabulary.UpdatedAt).
+		Where("id = ?", vocabulary.Id).Where("user_id = ?", vocabulary.UserId)
+	_, err := exec.ExecSq(query)
+	if err != nil {
+		return s.parseError(err, "update vocabulary")
+	}
+	_, err = exec.ExecSq(s.sq.Delete("metadata_vocabulary_keys").Where("vocabulary_id = ?", vocabulary.Id))
+	if err != nil {
+		return s.parseError(err, "delete vocabulary keys")
+	}
+	err = s.setVocabularyKeys(exec, vocabulary)
+	if err != nil {
+		return err
+	}
+	_, err = exec.ExecSq(s.sq.Delete("metadata_vocabulary_members").Where("vocabulary_id = ?", vocabulary.Id))
+	if err != nil {
+		return s.parseError(err, "delete vocabulary members")
+	}
+	err = s.setVocabularyMembers(exec, vocabulary)
+	if err != nil {
+		return err
+	}
+
+	// users that are no longer members lose their subscription
+	removed := []int{}
+	err = exec.SelectSq(&removed, s.sq.Delete("metadata_vocabulary_subscribers").
+		Where("vocabulary_id = ?", vocabulary.Id).
+		Where("user_id NOT IN (SELECT user_id FROM metadata_vocabulary_members WHERE vocabulary_id = ?)", vocabulary.Id).
+		Suffix("RETURNING user_id"))
+	if err != nil {
+		return s.parseError(err, "delete vocabulary subscribers")
+	}
+	for _, v := range removed {
+		s.flushCachedUserKeys(v)
+	}
+	return nil
+}
+
+func (s *MetadataStore) setVocabularyMembers(exec SqlExecer, vocabulary *models.MetadataVocabulary) error {
+	if len(vocabulary.Members) == 0 {
+		return nil
+	}
+	query := s.sq.Insert("metadata_vocabulary_members").Columns("vocabulary_id", "user_id")
+	for i, v := range vocabulary.Members {
+		vocabulary.Members[i].VocabularyId = vocabulary.Id
+		query = query.Values(vocabulary.Id, v.UserId)
+	}
+	_, err := exec.ExecSq(query)
+	return s.parseError(err, "add vocabulary members")
+}
+
+func (s *MetadataStore) setVocabularyKeys(exec SqlExecer, vocabulary *models.MetadataVocabulary) error {
+	if len(vocabulary.Keys) == 0 {
+		return nil
+	}
+	query := s.sq.Insert("metadata_vocabulary_keys").Columns("vocabulary_id", "key_id")
+	for i, v := range vocabulary.Keys {
+		vocabulary.Keys[i].VocabularyId = vocabulary.Id
+		query = query.Values(vocabulary.Id, v.KeyId)
+	}
+	_, err := exec.ExecSq(query)
+	return s.parseError(err, "add vocabulary keys")
+}
+
+// DeleteVocabulary deletes the vocabulary. Metadata that subscribers have added to their documents is kept.
+func (s *MetadataStore) DeleteVocabulary(userId, vocabularyId int) error {
+	_, err := s.db.Exec("DELETE FROM metadata_vocabularies WHERE id = $1 AND user_id = $2", vocabularyId, userId)
+	return s.parseError(err, "delete vocabulary")
+}
+
+// SubscribeVocabulary adds the user as a subscriber of the vocabulary.
+func (s *MetadataStore) SubscribeVocabulary(userId, vocabularyId int) error {
+	sql := `
+INSERT INTO metadata_vocabulary_subscribers (vocabulary_id, user_id)
+VALUES ($1, $2)
+ON CONFLICT (vocabulary_id, user_id) DO NOTHING;
+`
+	_, err := s.db.Exec(sql, vocabularyId, userId)
+	s.flushCachedUserKeys(userId)
+	return s.parseError(err, "subscribe vocabulary")
+}
+
+// UnsubscribeVocabulary removes the user from the subscribers of the vocabulary.
+func (s *MetadataStore) UnsubscribeVocabulary(userId, vocabularyId int) error {
+	_, err := s.db.Exec("DELETE FROM metadata_vocabulary_subscribers WHERE vocabulary_id = $1 AND user_id = $2",
+		vocabularyId, userId)
+	s.flushCachedUserKeys(userId)
+	return s.parseError(err, "unsubscribe vocabulary")
+}
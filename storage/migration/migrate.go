@@ -123,6 +123,91 @@ var Migrations = []Migrator{
 		Level:  19,
 		Schema: schemaV19,
 	},
+	&Migration{
+		Name:   "add document similarity signatures",
+		Level:  20,
+		Schema: schemaV20,
+	},
+	&Migration{
+		Name:   "add document fingerprints and duplicates",
+		Level:  21,
+		Schema: schemaV21,
+	},
+	&Migration{
+		Name:   "add search synonyms and stop words",
+		Level:  22,
+		Schema: schemaV22,
+	},
+	&Migration{
+		Name:   "add nested rule condition groups",
+		Level:  23,
+		Schema: schemaV23,
+	},
+	&Migration{
+		Name:   "add rule to document history",
+		Level:  24,
+		Schema: schemaV24,
+	},
+	&Migration{
+		Name:   "add rule triggers",
+		Level:  25,
+		Schema: schemaV25,
+	},
+	&Migration{
+		Name:   "add document page count",
+		Level:  26,
+		Schema: schemaV26,
+	},
+	&Migration{
+		Name:   "add rule stop processing and document rule traces",
+		Level:  27,
+		Schema: schemaV27,
+	},
+	&Migration{
+		Name:   "add typed metadata keys",
+		Level:  28,
+		Schema: schemaV28,
+	},
+	&Migration{
+		Name:   "add metadata value parents",
+		Level:  29,
+		Schema: schemaV29,
+	},
+	&Migration{
+		Name:   "add document types",
+		Level:  30,
+		Schema: schemaV30,
+	},
+	&Migration{
+		Name:   "add metadata suggestions",
+		Level:  31,
+		Schema: schemaV31,
+	},
+	&Migration{
+		Name:   "add metadata vocabularies",
+		Level:  32,
+		Schema: schemaV32,
+	},
+	&Migration{
+		Name:   "add document notes",
+		Level:  33,
+		Schema: schemaV33,
+	},
+	&Migration{
+		Name:   "add invoice fields to documents",
+		Level:  34,
+		Schema: schemaV34,
+	},
+	&Migration{
+		Name:   "add metadata vocabulary members",
+		Level:  35,
+		Schema: schemaV35,
+	},
+	&Migration{
+		Name:   "add invoice paid date",
+		Level:  36,
+		Schema: schemaV36,
+	},
 }
 
 type Schema struct {
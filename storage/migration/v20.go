@@ -0,0 +1,39 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package migration
+
+const schemaV20 = `
+CREATE TABLE document_similarity (
+    document_id TEXT NOT NULL,
+    user_id INT NOT NULL,
+    -- minhash signature of document content terms
+    signature BIGINT[] NOT NULL,
+
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    CONSTRAINT pk_document_similarity PRIMARY KEY(document_id),
+    CONSTRAINT fk_document FOREIGN KEY(document_id) REFERENCES documents(id) ON DELETE CASCADE,
+    CONSTRAINT fk_user_id FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX document_similarity_user_id ON document_similarity(user_id);
+
+-- compute signatures for existing documents
+INSERT INTO process_queue (document_id, action, action_order)
+SELECT id, 'similarity', 7 FROM documents;
+`
@@ -0,0 +1,59 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package migration
+
+const schemaV21 = `
+CREATE TABLE document_fingerprints (
+    document_id TEXT NOT NULL,
+    user_id INT NOT NULL,
+    -- simhash of content, null if document has too little content
+    content_hash BIGINT,
+    -- dhash of thumbnail, null if document has no thumbnail
+    image_hash BIGINT,
+
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    CONSTRAINT pk_document_fingerprints PRIMARY KEY(document_id),
+    CONSTRAINT fk_document FOREIGN KEY(document_id) REFERENCES documents(id) ON DELETE CASCADE,
+    CONSTRAINT fk_user_id FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX document_fingerprints_user_id ON document_fingerprints(user_id);
+
+CREATE TABLE document_duplicates (
+    user_id INT NOT NULL,
+    doc_a_id TEXT NOT NULL,
+    doc_b_id TEXT NOT NULL,
+    content_distance INT,
+    image_distance INT,
+    dismissed BOOLEAN NOT NULL DEFAULT FALSE,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    CONSTRAINT pk_document_duplicates PRIMARY KEY(doc_a_id, doc_b_id),
+    CONSTRAINT fk_doc_a FOREIGN KEY(doc_a_id) REFERENCES documents(id) ON DELETE CASCADE,
+    CONSTRAINT fk_doc_b FOREIGN KEY(doc_b_id) REFERENCES documents(id) ON DELETE CASCADE,
+    CONSTRAINT fk_user_id FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT check_doc_order CHECK (doc_a_id < doc_b_id)
+);
+
+CREATE INDEX document_duplicates_user_id ON document_duplicates(user_id);
+
+INSERT INTO process_queue (document_id, action, action_order)
+SELECT id, 'duplicates', 8 FROM documents;
+`
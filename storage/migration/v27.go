@@ -0,0 +1,49 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package migration
+
+const schemaV27 = `
+ALTER TABLE rules
+ADD COLUMN stop_processing BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE document_rule_traces (
+	id SERIAL PRIMARY KEY,
+	document_id TEXT NOT NULL,
+	rule_id INT,
+	rule_name TEXT NOT NULL DEFAULT '',
+	triggers TEXT NOT NULL DEFAULT '',
+	pass INT NOT NULL DEFAULT 1,
+	matched BOOLEAN NOT NULL DEFAULT FALSE,
+	stopped BOOLEAN NOT NULL DEFAULT FALSE,
+	conditions TEXT NOT NULL DEFAULT '[]',
+	actions TEXT NOT NULL DEFAULT '[]',
+	error TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+	CONSTRAINT fk_document
+		FOREIGN KEY (document_id)
+		REFERENCES documents(id)
+		ON DELETE CASCADE,
+	CONSTRAINT fk_rule
+		FOREIGN KEY (rule_id)
+		REFERENCES rules(id)
+		ON DELETE SET NULL
+);
+
+CREATE INDEX document_rule_traces_document_id ON document_rule_traces(document_id);
+`
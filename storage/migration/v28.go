@@ -0,0 +1,32 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package migration
+
+const schemaV28 = `
+ALTER TABLE metadata_keys
+ADD COLUMN value_type TEXT NOT NULL DEFAULT 'text';
+
+ALTER TABLE metadata_values
+ADD COLUMN value_number NUMERIC,
+ADD COLUMN value_date DATE,
+ADD COLUMN value_bool BOOLEAN,
+ADD COLUMN value_currency TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX metadata_values_key_number ON metadata_values(key_id, value_number) WHERE value_number IS NOT NULL;
+CREATE INDEX metadata_values_key_date ON metadata_values(key_id, value_date) WHERE value_date IS NOT NULL;
+`
@@ -0,0 +1,29 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package migration
+
+const schemaV29 = `
+ALTER TABLE metadata_values
+ADD COLUMN parent_id INT,
+ADD CONSTRAINT fk_parent
+	FOREIGN KEY (parent_id)
+	REFERENCES metadata_values(id)
+	ON DELETE SET NULL;
+
+CREATE INDEX metadata_values_parent_id ON metadata_values(parent_id);
+`
@@ -0,0 +1,44 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package migration
+
+const schemaV30 = `
+CREATE TABLE document_types (
+	id          SERIAL PRIMARY KEY,
+	user_id     INT  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	name        TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+	CONSTRAINT unique_user_document_type UNIQUE (user_id, name)
+);
+
+CREATE TABLE document_type_keys (
+	document_type_id INT     NOT NULL REFERENCES document_types (id) ON DELETE CASCADE,
+	key_id           INT     NOT NULL REFERENCES metadata_keys (id) ON DELETE CASCADE,
+	required         BOOLEAN NOT NULL DEFAULT FALSE,
+	default_value_id INT REFERENCES metadata_values (id) ON DELETE SET NULL,
+	PRIMARY KEY (document_type_id, key_id)
+);
+
+ALTER TABLE documents
+ADD COLUMN document_type_id INT REFERENCES document_types (id) ON DELETE SET NULL;
+
+CREATE INDEX documents_document_type_id ON documents(document_type_id);
+`
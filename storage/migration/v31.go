@@ -0,0 +1,40 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package migration
+
+const schemaV31 = `
+-- confidence above which suggestions are added to documents automatically. 0 disables.
+ALTER TABLE metadata_keys ADD COLUMN auto_apply_threshold REAL NOT NULL DEFAULT 0;
+
+CREATE TABLE document_metadata_suggestions (
+    document_id TEXT NOT NULL,
+    key_id INT NOT NULL,
+    value_id INT NOT NULL,
+    confidence REAL NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+
+    CONSTRAINT pk_document_metadata_suggestions PRIMARY KEY(document_id, value_id),
+    CONSTRAINT fk_document FOREIGN KEY(document_id) REFERENCES documents(id) ON DELETE CASCADE,
+    CONSTRAINT fk_key FOREIGN KEY(key_id) REFERENCES metadata_keys(id) ON DELETE CASCADE,
+    CONSTRAINT fk_value FOREIGN KEY(value_id) REFERENCES metadata_values(id) ON DELETE CASCADE
+);
+
+-- suggest metadata for existing documents
+INSERT INTO process_queue (document_id, action, action_order)
+SELECT id, 'suggest-metadata', 9 FROM documents;
+`
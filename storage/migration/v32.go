@@ -0,0 +1,49 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+package migration
+
+const schemaV32 = `
+CREATE TABLE metadata_vocabularies (
+	id          SERIAL PRIMARY KEY,
+	user_id     INT     NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	name        TEXT    NOT NULL,
+	description TEXT    NOT NULL DEFAULT '',
+	-- subscribers can add and edit values of the keys
+	editable    BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+	CONSTRAINT unique_user_metadata_vocabulary UNIQUE (user_id, name)
+);
+
+CREATE TABLE metadata_vocabulary_keys (
+	vocabulary_id INT NOT NULL REFERENCES metadata_vocabularies (id) ON DELETE CASCADE,
+	key_id        INT NOT NULL REFERENCES metadata_keys (id) ON DELETE CASCADE,
+	PRIMARY KEY (vocabulary_id, key_id)
+);
+
+CREATE INDEX metadata_vocabulary_keys_key_id ON metadata_vocabulary_keys(key_id);
+
+CREATE TABLE metadata_vocabulary_subscribers (
+	vocabulary_id INT NOT NULL REFERENCES metadata_vocabularies (id) ON DELETE CASCADE,
+	user_id       INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (vocabulary_id, user_id)
+);
+
+CREATE INDEX metadata_vocabulary_subscribers_user_id ON metadata_vocabulary_subscribers(user_id);
+`
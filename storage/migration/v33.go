@@ -0,0 +1,37 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package migration
+
+const schemaV33 = `
+CREATE TABLE document_notes (
+	id          SERIAL PRIMARY KEY,
+	document_id TEXT NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+	-- author of the note, either owner or user the document is shared with
+	user_id     INT  NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	content     TEXT NOT NULL,
+	-- optional anchor: page starting from 1 and position relative to page size
+	page        INT,
+	position_x  REAL,
+	position_y  REAL,
+	created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+	updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX document_notes_document_id ON document_notes(document_id);
+`
@@ -0,0 +1,43 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package migration
+
+const schemaV34 = `
+-- fields extracted from invoices. Null and empty values are fields that were not found.
+ALTER TABLE documents
+ADD COLUMN invoice_iban TEXT NOT NULL DEFAULT '',
+ADD COLUMN invoice_reference TEXT NOT NULL DEFAULT '',
+ADD COLUMN invoice_amount NUMERIC,
+ADD COLUMN invoice_currency TEXT NOT NULL DEFAULT '',
+ADD COLUMN invoice_vat_number TEXT NOT NULL DEFAULT '',
+ADD COLUMN invoice_due_date TIMESTAMPTZ;
+
+CREATE INDEX documents_invoice_due_date ON documents(user_id, invoice_due_date) WHERE invoice_due_date IS NOT NULL;
+
+-- extract-fields runs before rules
+UPDATE process_queue SET action_order = action_order + 1 WHERE action_order >= 5;
+
+-- extract fields for existing documents and index them
+INSERT INTO process_queue (document_id, action, action_order)
+SELECT id, 'extract-fields', 5 FROM documents;
+
+INSERT INTO process_queue (document_id, action, action_order)
+SELECT id, 'fts', 7 FROM documents d
+WHERE NOT EXISTS (SELECT 1 FROM process_queue q WHERE q.document_id = d.id AND q.action = 'fts');
+`
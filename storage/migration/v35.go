@@ -0,0 +1,35 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package migration
+
+const schemaV35 = `
+-- users the owner has allowed to see and subscribe to the vocabulary
+CREATE TABLE metadata_vocabulary_members (
+	vocabulary_id INT NOT NULL REFERENCES metadata_vocabularies (id) ON DELETE CASCADE,
+	user_id       INT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (vocabulary_id, user_id)
+);
+
+CREATE INDEX metadata_vocabulary_members_user_id ON metadata_vocabulary_members(user_id);
+
+-- keep existing subscriptions
+INSERT INTO metadata_vocabulary_members (vocabulary_id, user_id)
+SELECT vocabulary_id, user_id FROM metadata_vocabulary_subscribers;
+`
@@ -136,16 +136,18 @@ WHERE id = $1`
 }
 
 func (s *RuleStore) AddRule(execer SqlExecer, userId int, rule *models.Rule) error {
-	err := s.validateRule(userId, rule)
+	err := s.validateRule(execer, userId, rule)
 	if err != nil {
 		return err
 	}
 
 	// insert rule
 	query := s.sq.Insert("rules").
-		Columns("user_id", "name", "description", "enabled", "rule_order", "mode").
+		Columns("user_id", "name", "description", "enabled", "rule_order", "mode", "triggers", "schedule",
+			"stop_processing").
 		Values(userId, rule.Name, rule.Description, rule.Enabled,
-			squirrel.Expr("(SELECT COALESCE(MAX(rule_order)+1, 1) FROM rules WHERE user_id=?)", userId), rule.Mode).
+			squirrel.Expr("(SELECT COALESCE(MAX(rule_order)+1, 1) FROM rules WHERE user_id=?)", userId), rule.Mode,
+			rule.Triggers, rule.Schedule, rule.StopProcessing).
 		Suffix("RETURNING \"id\"")
 	var id int
 	err = execer.GetSq(&id, query)
@@ -198,6 +200,19 @@ limit $2;`
 	return ruleArr, nil
 }
 
+// GetUsersWithScheduledRules returns ids of users that have enabled rules with schedule trigger.
+func (s *RuleStore) GetUsersWithScheduledRules() ([]int, error) {
+	sql := `
+SELECT DISTINCT user_id
+FROM rules
+WHERE enabled=TRUE
+AND $1 = ANY(string_to_array(triggers, ','));`
+
+	ids := []int{}
+	err := s.db.Select(&ids, sql, models.RuleTriggerSchedule.String())
+	return ids, s.parseError(err, "get users with scheduled rules")
+}
+
 func (s *RuleStore) getUserRuleConditionsForRules(userId int, rules []*models.Rule) error {
 	sql := `
 SELECT
@@ -213,7 +228,9 @@ SELECT
     metadata_value,
     mk.key as metadata_key_name,
     mv.value as metadata_value_name,
-	date_fmt
+	date_fmt,
+	parent_id,
+	group_mode
 FROM rule_conditions
 	LEFT JOIN rules ON rule_conditions.rule_id = rules.id
 	LEFT join metadata_keys mk on rule_conditions.metadata_key = mk.id
@@ -277,7 +294,7 @@ func (s *RuleStore) UserOwnsRule(userId, ruleId int) (bool, error) {
 }
 
 // UpdateRule updates rule.
-func (s *RuleStore) UpdateRule(exec ExecerSq, userId int, rule *models.Rule) error {
+func (s *RuleStore) UpdateRule(exec SqlExecer, userId int, rule *models.Rule) error {
 	owns, err := s.UserOwnsRule(userId, rule.Id)
 	if err != nil {
 		return err
@@ -288,19 +305,22 @@ func (s *RuleStore) UpdateRule(exec ExecerSq, userId int, rule *models.Rule) err
 		return err
 	}
 
-	err = s.validateRule(userId, rule)
+	err = s.validateRule(exec, userId, rule)
 	if err != nil {
 		return err
 	}
 
 	rule.Update()
 	query := s.sq.Update("rules").SetMap(map[string]interface{}{
-		"name":        rule.Name,
-		"description": rule.Description,
-		"enabled":     rule.Enabled,
-		"rule_order":  rule.Order,
-		"mode":        rule.Mode,
-		"updated_at":  rule.UpdatedAt,
+		"name":            rule.Name,
+		"description":     rule.Description,
+		"enabled":         rule.Enabled,
+		"rule_order":      rule.Order,
+		"mode":            rule.Mode,
+		"triggers":        rule.Triggers,
+		"schedule":        rule.Schedule,
+		"stop_processing": rule.StopProcessing,
+		"updated_at":      rule.UpdatedAt,
 	}).Where(squirrel.Eq{"user_id": userId, "id": rule.Id})
 
 	_, err = exec.ExecSq(query)
@@ -328,6 +348,30 @@ func (s *RuleStore) UpdateRule(exec ExecerSq, userId int, rule *models.Rule) err
 	return nil
 }
 
+// DisableRulesByMetadata disables the enabled rules that have conditions or actions with the metadata value,
+// or with the metadata key if valueId is 0. Returns the ids of the disabled rules.
+func (s *RuleStore) DisableRulesByMetadata(exec SqlExecer, keyId, valueId int) ([]int, error) {
+	column, id := "metadata_value", valueId
+	if valueId == 0 {
+		column, id = "metadata_key", keyId
+	}
+	query := s.sq.Update("rules").Set("enabled", false).Set("updated_at", time.Now()).
+		Where("enabled").
+		Where(fmt.Sprintf("id IN (SELECT rule_id FROM rule_conditions WHERE %[1]s = ? "+
+			"UNION SELECT rule_id FROM rule_actions WHERE %[1]s = ?)", column), id, id).
+		Suffix("RETURNING id")
+
+	ids := []int{}
+	err := exec.SelectSq(&ids, query)
+	if err != nil {
+		return nil, s.parseError(err, "disable rules by metadata")
+	}
+	for _, v := range ids {
+		s.cache.Delete(fmt.Sprintf("rule-%d", v))
+	}
+	return ids, nil
+}
+
 func (s *RuleStore) DeleteRule(ruleId int) error {
 	sql := `
 	DELETE FROM rules 
@@ -340,14 +384,19 @@ func (s *RuleStore) DeleteRule(ruleId int) error {
 	return nil
 }
 
-func (s *RuleStore) validateRule(userId int, rule *models.Rule) error {
+// validateRule checks the rule and that the user can use the metadata, document type and users it refers to.
+// Checks run with exec, so metadata created earlier in the same transaction is visible.
+func (s *RuleStore) validateRule(exec SqlExecer, userId int, rule *models.Rule) error {
+	if len(rule.Triggers) == 0 {
+		rule.Triggers = models.RuleTriggers{models.RuleTriggerUpload}
+	}
 	err := rule.Validate()
 	if err != nil {
 		return err
 	}
 
 	metadata := make([]models.Metadata, 0, 5)
-	for _, v := range rule.Conditions {
+	for _, v := range rule.AllConditions() {
 		if v.MetadataValue > 0 && v.MetadataKey > 0 {
 			m := models.Metadata{
 				KeyId:   int(v.MetadataKey),
@@ -357,6 +406,43 @@ func (s *RuleStore) validateRule(userId int, rule *models.Rule) error {
 		}
 	}
 	for _, v := range rule.Actions {
+		if v.Action == models.RuleActionShare {
+			err := s.validateShareUser(exec, userId, v)
+			if err != nil {
+				return err
+			}
+		}
+		if v.Action == models.RuleActionSetDocumentType {
+			typeId, err := v.DocumentTypeId()
+			if err != nil {
+				return err
+			}
+			_, err = s.metadata.getDocumentType(exec, userId, typeId)
+			if errors.Is(err, errors.ErrRecordNotFound) {
+				e := errors.ErrInvalid
+				e.ErrMsg = "document type does not exist"
+				return e
+			} else if err != nil {
+				return err
+			}
+		}
+		if v.Action == models.RuleActionExtractMetadata || v.Action == models.RuleActionLinkLatest ||
+			v.Action == models.RuleActionSetDateMetadata {
+			canUse := s.metadata.userCanAccessKey
+			if v.Action != models.RuleActionLinkLatest {
+				// extracting creates new values
+				canUse = s.metadata.userCanEditKeyValues
+			}
+			ok, err := canUse(exec, userId, int(v.MetadataKey))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				e := errors.ErrInvalid
+				e.ErrMsg = "metadata key does not exist"
+				return e
+			}
+		}
 		if v.MetadataValue > 0 && v.MetadataKey > 0 {
 			m := models.Metadata{
 				KeyId:   int(v.MetadataKey),
@@ -367,7 +453,7 @@ func (s *RuleStore) validateRule(userId int, rule *models.Rule) error {
 	}
 
 	if len(metadata) > 0 {
-		err := s.metadata.CheckKeyValuesExist(userId, metadata)
+		err := s.metadata.checkKeyValuesExist(exec, userId, metadata)
 		if err != nil {
 			return err
 		}
@@ -375,6 +461,30 @@ func (s *RuleStore) validateRule(userId int, rule *models.Rule) error {
 	return nil
 }
 
+// validateShareUser checks that the user to share the document with exists and is not the rule owner.
+func (s *RuleStore) validateShareUser(exec SqlExecer, userId int, action *models.RuleAction) error {
+	sharing, err := action.Sharing()
+	if err != nil {
+		return err
+	}
+	if sharing.UserId == userId {
+		e := errors.ErrInvalid
+		e.ErrMsg = "cannot share with self"
+		return e
+	}
+	var exists bool
+	err = exec.Get(&exists, "SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)", sharing.UserId)
+	if err != nil {
+		return s.parseError(err, "check share user exists")
+	}
+	if !exists {
+		e := errors.ErrInvalid
+		e.ErrMsg = "user to share with does not exist"
+		return e
+	}
+	return nil
+}
+
 func (s *RuleStore) addActionsToRule(exec ExecerSq, ruleId int, actions []*models.RuleAction) error {
 	query := s.sq.Insert("rule_actions").
 		Columns("rule_id", "enabled", "on_condition", "action", "value", "metadata_key", "metadata_value")
@@ -390,38 +500,97 @@ func (s *RuleStore) addActionsToRule(exec ExecerSq, ruleId int, actions []*model
 	return nil
 }
 
-func (s *RuleStore) addConditionsToRule(exec ExecerSq, ruleId int, conditions []*models.RuleCondition) error {
-	if len(conditions) == 0 {
-		return nil
-	}
-	query := s.sq.Insert("rule_conditions").
-		Columns("rule_id", "enabled", "case_insensitive", "inverted_match", "condition_type",
-			"is_regex", "value", "date_fmt", "metadata_key", "metadata_value")
+// addConditionsToRule inserts conditions in order. Nested conditions of groups are inserted after the group.
+func (s *RuleStore) addConditionsToRule(exec SqlExecer, ruleId int, conditions []*models.RuleCondition) error {
+	return s.addConditions(exec, ruleId, 0, conditions)
+}
 
+func (s *RuleStore) addConditions(exec SqlExecer, ruleId int, parentId models.IntId, conditions []*models.RuleCondition) error {
 	for _, v := range conditions {
-		query = query.Values(ruleId, v.Enabled, v.CaseInsensitive, v.Inverted, v.ConditionType, v.IsRegex, v.Value, v.DateFmt,
-			v.MetadataKey, v.MetadataValue)
-	}
-
-	_, err := exec.ExecSq(query)
-	if err != nil {
-		return getDatabaseError(err, s, "insert rule conditions")
+		v.ParentId = parentId
+		query := s.sq.Insert("rule_conditions").
+			Columns("rule_id", "enabled", "case_insensitive", "inverted_match", "condition_type",
+				"is_regex", "value", "date_fmt", "metadata_key", "metadata_value", "parent_id", "group_mode").
+			Values(ruleId, v.Enabled, v.CaseInsensitive, v.Inverted, v.ConditionType, v.IsRegex, v.Value, v.DateFmt,
+				v.MetadataKey, v.MetadataValue, v.ParentId, v.Mode).
+			Suffix("RETURNING \"id\"")
+
+		var id int
+		err := exec.GetSq(&id, query)
+		if err != nil {
+			return getDatabaseError(err, s, "insert rule conditions")
+		}
+		v.Id = id
+		v.RuleId = ruleId
+		if v.IsGroup() {
+			err = s.addConditions(exec, ruleId, models.IntId(id), v.Children)
+			if err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
+// mapConditionsToRules builds the condition tree for each rule. Conditions must be ordered by id
+// so that a group is always before its nested conditions.
 func mapConditionsToRules(rules []*models.Rule, conditions *[]models.RuleCondition) {
 	for i, _ := range rules {
 		rule := rules[i]
 		rule.Conditions = make([]*models.RuleCondition, 0, 10)
+		groups := make(map[int]*models.RuleCondition)
 		for conditionI, condition := range *conditions {
-			if condition.RuleId == rule.Id {
-				rule.Conditions = append(rule.Conditions, &(*conditions)[conditionI])
+			if condition.RuleId != rule.Id {
+				continue
+			}
+			item := &(*conditions)[conditionI]
+			if item.IsGroup() {
+				groups[item.Id] = item
+			}
+			if item.ParentId == 0 {
+				rule.Conditions = append(rule.Conditions, item)
+			} else if parent, ok := groups[int(item.ParentId)]; ok {
+				parent.Children = append(parent.Children, item)
 			}
 		}
 	}
 }
 
+// SaveDocumentRuleTraces replaces the rule traces of the document with the traces of the latest rule run.
+func (s *RuleStore) SaveDocumentRuleTraces(exec SqlExecer, docId string, traces []*models.DocumentRuleTrace) error {
+	_, err := exec.ExecSq(s.sq.Delete("document_rule_traces").Where("document_id = ?", docId))
+	if err != nil {
+		return getDatabaseError(err, s, "delete document rule traces")
+	}
+	if len(traces) == 0 {
+		return nil
+	}
+
+	query := s.sq.Insert("document_rule_traces").
+		Columns("document_id", "rule_id", "rule_name", "triggers", "pass", "matched", "stopped",
+			"conditions", "actions", "error")
+	for _, v := range traces {
+		query = query.Values(docId, v.RuleId, v.RuleName, v.Triggers, v.Pass, v.Matched, v.Stopped,
+			v.Conditions, v.Actions, v.Error)
+	}
+	_, err = exec.ExecSq(query)
+	return getDatabaseError(err, s, "insert document rule traces")
+}
+
+// GetDocumentRuleTraces returns the rule traces of the document in the order the rules were run.
+func (s *RuleStore) GetDocumentRuleTraces(docId string) ([]*models.DocumentRuleTrace, error) {
+	sql := `
+SELECT *
+FROM document_rule_traces
+WHERE document_id = $1
+ORDER BY id ASC
+LIMIT $2;`
+
+	traces := make([]*models.DocumentRuleTrace, 0)
+	err := s.db.Select(&traces, sql, docId, config.MaxRows)
+	return traces, s.parseError(err, "get document rule traces")
+}
+
 func mapActionsToRules(rules []*models.Rule, actions *[]models.RuleAction) {
 	for i, _ := range rules {
 		rule := rules[i]
@@ -0,0 +1,205 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/patrickmn/go-cache"
+	"tryffel.net/go/virtualpaper/errors"
+	"tryffel.net/go/virtualpaper/models"
+)
+
+// PreferenceSearchRanking stores user's search ranking rules as a comma-separated list.
+const PreferenceSearchRanking PreferenceKey = "search_ranking"
+
+func (s *UserStore) cacheNameSearchSettings(userId int) string {
+	return fmt.Sprintf("search-settings-%d", userId)
+}
+
+func (s *UserStore) flushCachedSearchSettings(userId int) {
+	s.cache.Delete(s.cacheNameSearchSettings(userId))
+}
+
+// GetSearchSynonyms returns user's synonym groups.
+func (s *UserStore) GetSearchSynonyms(userId int) ([]models.SearchSynonym, error) {
+	sql := `
+	SELECT id, user_id, words, created_at, updated_at
+	FROM search_synonyms
+	WHERE user_id = $1
+	ORDER BY id ASC;
+	`
+	type result struct {
+		models.SearchSynonym
+		Words pq.StringArray `db:"words"`
+	}
+	rows := &[]result{}
+	err := s.db.Select(rows, sql, userId)
+	if err != nil {
+		return []models.SearchSynonym{}, s.parseError(err, "get search synonyms")
+	}
+	synonyms := make([]models.SearchSynonym, len(*rows))
+	for i, v := range *rows {
+		synonyms[i] = v.SearchSynonym
+		synonyms[i].Words = v.Words
+	}
+	return synonyms, nil
+}
+
+// AddSearchSynonym adds new synonym group and sets its id.
+func (s *UserStore) AddSearchSynonym(synonym *models.SearchSynonym) error {
+	sql := `
+	INSERT INTO search_synonyms (user_id, words, created_at, updated_at)
+	VALUES ($1, $2, $3, $3)
+	RETURNING id;
+	`
+	now := time.Now()
+	err := s.db.Get(&synonym.Id, sql, synonym.UserId, pq.StringArray(synonym.Words), now)
+	s.flushCachedSearchSettings(synonym.UserId)
+	if err != nil {
+		return s.parseError(err, "add search synonym")
+	}
+	synonym.CreatedAt = now
+	synonym.UpdatedAt = now
+	return nil
+}
+
+// UpdateSearchSynonym updates the words of user's synonym group.
+func (s *UserStore) UpdateSearchSynonym(synonym *models.SearchSynonym) error {
+	sql := `
+	UPDATE search_synonyms
+	SET words = $3, updated_at = $4
+	WHERE id = $1 AND user_id = $2
+	RETURNING created_at;
+	`
+	now := time.Now()
+	err := s.db.Get(&synonym.CreatedAt, sql, synonym.Id, synonym.UserId, pq.StringArray(synonym.Words), now)
+	s.flushCachedSearchSettings(synonym.UserId)
+	if err != nil {
+		return s.parseError(err, "update search synonym")
+	}
+	synonym.UpdatedAt = now
+	return nil
+}
+
+// DeleteSearchSynonym deletes user's synonym group.
+func (s *UserStore) DeleteSearchSynonym(userId int, id int) error {
+	sql := `DELETE FROM search_synonyms WHERE id = $1 AND user_id = $2 RETURNING id;`
+	deleted := 0
+	err := s.db.Get(&deleted, sql, id, userId)
+	s.flushCachedSearchSettings(userId)
+	return s.parseError(err, "delete search synonym")
+}
+
+// GetSearchStopWords returns user's stop words in alphabetical order.
+func (s *UserStore) GetSearchStopWords(userId int) ([]string, error) {
+	sql := `SELECT word FROM search_stop_words WHERE user_id = $1 ORDER BY word ASC;`
+	words := &[]string{}
+	err := s.db.Select(words, sql, userId)
+	if err != nil {
+		return []string{}, s.parseError(err, "get search stop words")
+	}
+	return *words, nil
+}
+
+// SetSearchStopWords replaces user's stop words.
+func (s *UserStore) SetSearchStopWords(userId int, words []string) error {
+	defer s.flushCachedSearchSettings(userId)
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return s.parseError(err, "set stop words, start tx")
+	}
+	_, err = tx.Exec("DELETE FROM search_stop_words WHERE user_id = $1", userId)
+	if err != nil {
+		tx.Rollback()
+		return s.parseError(err, "set stop words - delete old")
+	}
+	if len(words) > 0 {
+		sql := `
+		INSERT INTO search_stop_words (user_id, word)
+		SELECT $1, unnest($2::TEXT[])
+		ON CONFLICT DO NOTHING;
+		`
+		_, err = tx.Exec(sql, userId, pq.StringArray(words))
+		if err != nil {
+			tx.Rollback()
+			return s.parseError(err, "set stop words - insert new")
+		}
+	}
+	return s.parseError(tx.Commit(), "set stop words - commit")
+}
+
+// GetSearchRanking returns user's search ranking rules.
+func (s *UserStore) GetSearchRanking(userId int) ([]string, error) {
+	value, err := s.GetPreferenceValue(userId, PreferenceSearchRanking)
+	if err != nil {
+		if errors.Is(err, errors.ErrRecordNotFound) {
+			return []string{}, nil
+		}
+		return []string{}, err
+	}
+	if value == "" {
+		return []string{}, nil
+	}
+	return strings.Split(value, ","), nil
+}
+
+// SetSearchRanking sets user's search ranking rules.
+func (s *UserStore) SetSearchRanking(userId int, rules []string) error {
+	for _, v := range rules {
+		if strings.Contains(v, ",") {
+			return fmt.Errorf("invalid ranking rule: %s", v)
+		}
+	}
+	defer s.flushCachedSearchSettings(userId)
+	return s.SetPreferenceValue(userId, PreferenceSearchRanking, strings.Join(rules, ","))
+}
+
+// GetSearchSettings returns all user's search settings. Settings are cached, the caller must not modify them.
+func (s *UserStore) GetSearchSettings(userId int) (*models.SearchSettings, error) {
+	if cached, found := s.cache.Get(s.cacheNameSearchSettings(userId)); found {
+		if settings, ok := cached.(*models.SearchSettings); ok {
+			return settings, nil
+		}
+		s.flushCachedSearchSettings(userId)
+	}
+
+	synonyms, err := s.GetSearchSynonyms(userId)
+	if err != nil {
+		return nil, err
+	}
+	stopWords, err := s.GetSearchStopWords(userId)
+	if err != nil {
+		return nil, err
+	}
+	ranking, err := s.GetSearchRanking(userId)
+	if err != nil {
+		return nil, err
+	}
+	settings := &models.SearchSettings{
+		Synonyms:  synonyms,
+		StopWords: stopWords,
+		Ranking:   ranking,
+	}
+	s.cache.Set(s.cacheNameSearchSettings(userId), settings, cache.DefaultExpiration)
+	return settings, nil
+}
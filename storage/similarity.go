@@ -0,0 +1,102 @@
+/*
+ * Virtualpaper is a service to manage users paper documents in virtual format.
+ * Copyright (C) 2023  Tero Vierimaa
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as published by
+ * the Free Software Foundation, either version 3 of the License, or
+ * (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package storage
+
+import (
+	"github.com/lib/pq"
+	"tryffel.net/go/virtualpaper/models"
+)
+
+// SetSimilaritySignature stores the content signature for document. Empty signature removes existing signature.
+func (s *DocumentStore) SetSimilaritySignature(userId int, docId string, signature []int64) error {
+	if len(signature) == 0 {
+		_, err := s.db.Exec("DELETE FROM document_similarity WHERE document_id=$1", docId)
+		return s.parseError(err, "delete similarity signature")
+	}
+
+	sql := `
+	INSERT INTO document_similarity (document_id, user_id, signature, updated_at)
+	VALUES ($1, $2, $3, now())
+	ON CONFLICT (document_id) DO UPDATE
+	SET user_id=EXCLUDED.user_id, signature=EXCLUDED.signature, updated_at=now();
+	`
+	_, err := s.db.Exec(sql, docId, userId, pq.Int64Array(signature))
+	return s.parseError(err, "set similarity signature")
+}
+
+// GetSimilaritySignature returns the content signature and the number of metadata values for document.
+// Signature is empty if it has not been computed yet.
+func (s *DocumentStore) GetSimilaritySignature(docId string) ([]int64, int, error) {
+	sql := `
+	SELECT ds.signature AS signature,
+		(SELECT count(*) FROM document_metadata dm WHERE dm.document_id = d.id) AS metadata_count
+	FROM documents d
+	LEFT JOIN document_similarity ds ON d.id = ds.document_id
+	WHERE d.id = $1;
+	`
+	type result struct {
+		Signature     pq.Int64Array `db:"signature"`
+		MetadataCount int           `db:"metadata_count"`
+	}
+	data := &result{}
+	err := s.db.Get(data, sql, docId)
+	if err != nil {
+		return []int64{}, 0, s.parseError(err, "get similarity signature")
+	}
+	return data.Signature, data.MetadataCount, nil
+}
+
+// GetSimilarityCandidates returns user's other non-deleted documents with their content signatures
+// and the number of metadata values each document shares with the document.
+func (s *DocumentStore) GetSimilarityCandidates(userId int, docId string) ([]models.SimilarityCandidate, error) {
+	sql := `
+	SELECT d.id AS document_id,
+		d.name AS name,
+		d.date AS date,
+		ds.signature AS signature,
+		count(dm.value_id) AS metadata_count,
+		count(dm.value_id) FILTER (
+			WHERE dm.value_id IN (SELECT value_id FROM document_metadata WHERE document_id = $2)
+		) AS shared_metadata
+	FROM documents d
+	LEFT JOIN document_similarity ds ON d.id = ds.document_id
+	LEFT JOIN document_metadata dm ON d.id = dm.document_id
+	WHERE d.user_id = $1
+	AND d.id != $2
+	AND d.deleted_at IS NULL
+	GROUP BY d.id, ds.signature;
+	`
+
+	type result struct {
+		models.SimilarityCandidate
+		Signature pq.Int64Array `db:"signature"`
+	}
+	rows := &[]result{}
+	err := s.db.Select(rows, sql, userId, docId)
+	if err != nil {
+		return []models.SimilarityCandidate{}, s.parseError(err, "get similarity candidates")
+	}
+
+	candidates := make([]models.SimilarityCandidate, len(*rows))
+	for i, v := range *rows {
+		candidates[i] = v.SimilarityCandidate
+		candidates[i].Signature = v.Signature
+	}
+	return candidates, nil
+}
@@ -90,6 +90,13 @@ type Querier interface {
 	SelectContext(ctx context.Context, destination interface{}, query string, args ...interface{}) error
 }
 
+// dbQuerier is implemented by both the database connection and SqlExecer.
+type dbQuerier interface {
+	Execer
+	Get(destination interface{}, query string, args ...interface{}) error
+	Select(destination interface{}, query string, args ...interface{}) error
+}
+
 type ExecerSq interface {
 	ExecContextSq(ctx context.Context, sql squirrel.Sqlizer) (sql.Result, error)
 	ExecSq(sql squirrel.Sqlizer) (sql.Result, error)
@@ -102,6 +109,7 @@ type QuerierSq interface {
 	GetContextSq(ctx context.Context, destination interface{}, sql squirrel.Sqlizer) error
 	GetSq(destination interface{}, sql squirrel.Sqlizer) error
 	Get(destination interface{}, query string, args ...interface{}) error
+	Select(destination interface{}, query string, args ...interface{}) error
 }
 
 type SqlExecer interface {
@@ -218,6 +226,10 @@ func (tx *tx) Get(destination interface{}, query string, args ...interface{}) er
 	return tx.tx.GetContext(tx.context, destination, query, args...)
 }
 
+func (tx *tx) Select(destination interface{}, query string, args ...interface{}) error {
+	return tx.tx.SelectContext(tx.context, destination, query, args...)
+}
+
 func (r *resource) beginTx() (*tx, error) {
 	xTx, err := r.db.Beginx()
 	if err != nil {